@@ -0,0 +1,324 @@
+// Package bench is the performance regression harness: a fixed suite of
+// workloads run against real stores and in-process clusters, reported as
+// JSON so two trees can be compared.
+//
+//	report, err := bench.Run(ctx, bench.DefaultConfig, nil, nil)
+//	regressions := bench.Compare(baseline, report, 0.10)
+//
+// The suite (see Suite) covers the costs a change is most likely to
+// move: WAL writes and their fsyncs in each sync mode (store.go),
+// snapshots and recovery
+// at several sizes (store.go), replication fan-out and quorum reads and
+// writes (cluster.go). cmd/bench runs it from the command line.
+//
+// A run is meant to be repeatable: every case starts from an empty data
+// directory, does a fixed number of operations (Config.Scale times its
+// own count, never "as many as fit in a second"), and draws its keys and
+// values from Config.Seed. Two runs of one tree on one machine do the
+// same work, so the difference between two trees is the code's. Numbers
+// from different machines, or a loaded one, are not comparable; the
+// Report records where it ran.
+//
+// kvcli bench is the other load generator: it measures a deployed
+// cluster over HTTP, network and all. This one measures the code.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config is what a run may vary. Reports made with different Configs
+// are not comparable.
+type Config struct {
+	Dir       string  `json:"-"`          // parent of the run's data directories ("" = the OS temp dir)
+	Scale     float64 `json:"scale"`      // multiplies every case's operation count
+	ValueSize int     `json:"value_size"` // bytes per written value
+	Seed      uint64  `json:"seed"`       // key and value generator seed
+}
+
+// DefaultConfig is the configuration reports are usually made with.
+var DefaultConfig = Config{Scale: 1, ValueSize: 256, Seed: 1}
+
+// Validate checks that c is usable.
+func (c Config) Validate() error {
+	switch {
+	case c.Scale <= 0:
+		return errors.New("scale must be positive")
+	case c.ValueSize < 1:
+		return errors.New("value size must be at least 1 byte")
+	}
+	return nil
+}
+
+// ops returns n operations, scaled; at least one.
+func (c Config) ops(n int) int {
+	return max(1, int(math.Round(float64(n)*c.Scale)))
+}
+
+// Case is one workload of the suite.
+type Case struct {
+	Name      string // group/variant, e.g. "wal/put/fsync=group/writers=8"
+	About     string // what it measures, one line
+	FsyncMode string // WAL sync mode the case runs with ("" = the default)
+	run       func(ctx context.Context, e *env) (Result, error)
+}
+
+// Result is one case's figures. Latencies are per operation.
+type Result struct {
+	Name      string             `json:"name"`
+	FsyncMode string             `json:"fsync_mode,omitempty"` // as Case.FsyncMode
+	Ops       int                `json:"ops"`
+	Errors    int                `json:"errors"`
+	Seconds   float64            `json:"seconds"`
+	OpsPerSec float64            `json:"ops_per_sec"`
+	P50Ms     float64            `json:"p50_ms"`
+	P90Ms     float64            `json:"p90_ms"`
+	P99Ms     float64            `json:"p99_ms"`
+	MaxMs     float64            `json:"max_ms"`
+	Extra     map[string]float64 `json:"extra,omitempty"` // case-specific figures, e.g. fsyncs_per_write
+}
+
+// Report is one run of the suite.
+type Report struct {
+	Started   time.Time `json:"started"`
+	Revision  string    `json:"revision,omitempty"` // VCS revision of the binary, if known
+	GoVersion string    `json:"go_version"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	CPUs      int       `json:"cpus"`
+	Config    Config    `json:"config"`
+	Results   []Result  `json:"results"`
+}
+
+// Run runs each case of the suite that match accepts (nil = all) in
+// order, calling progress (if not nil) after each. A case that cannot
+// run at all fails the run; errors of single operations are counted in
+// its Result.
+func Run(ctx context.Context, cfg Config, match func(name string) bool, progress func(Result)) (Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return Report{}, err
+	}
+	rep := Report{
+		Started:   time.Now().UTC(),
+		Revision:  revision(),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		Config:    cfg,
+	}
+	root, err := os.MkdirTemp(cfg.Dir, "kvbench-")
+	if err != nil {
+		return rep, err
+	}
+	defer os.RemoveAll(root)
+
+	for i, c := range Suite() {
+		if match != nil && !match(c.Name) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return rep, err
+		}
+		e := &env{cfg: cfg, dir: fmt.Sprintf("%s/%03d", root, i), rng: rand.New(rand.NewPCG(cfg.Seed, uint64(i)))}
+		res, err := c.run(ctx, e)
+		os.RemoveAll(e.dir)
+		if err != nil {
+			return rep, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		res.Name, res.FsyncMode = c.Name, c.FsyncMode
+		rep.Results = append(rep.Results, res)
+		if progress != nil {
+			progress(res)
+		}
+	}
+	return rep, nil
+}
+
+// Suite returns every case, in the order Run runs them.
+func Suite() []Case {
+	return slices.Concat(walCases(), snapshotCases(), replicationCases(), quorumCases())
+}
+
+// revision returns the VCS revision the binary was built from.
+func revision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	rev, dirty := "", false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if rev != "" && dirty {
+		rev += "+dirty"
+	}
+	return rev
+}
+
+// ─── Running a case ───────────────────────────────────────────────────────────
+
+// env is what a case runs with.
+type env struct {
+	cfg Config
+	dir string     // the case's own empty data directory
+	rng *rand.Rand // seeded by Config.Seed and the case
+}
+
+// keys returns n distinct keys, in a seeded order.
+func (e *env) keys(n int) []string {
+	keys := make([]string, n)
+	for i, p := range e.rng.Perm(n) {
+		keys[i] = fmt.Sprintf("bench:%08d", p)
+	}
+	return keys
+}
+
+// value returns a seeded value of Config.ValueSize letters and digits,
+// so compression does not flatter the numbers.
+func (e *env) value() string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, e.cfg.ValueSize)
+	for i := range b {
+		b[i] = alphabet[e.rng.IntN(len(alphabet))]
+	}
+	return string(b)
+}
+
+// measure calls op(ctx, i) for i in 0..ops-1 on workers goroutines and
+// times each call.
+func measure(ctx context.Context, ops, workers int, op func(ctx context.Context, i int) error) Result {
+	lat := make([]time.Duration, ops)
+	var (
+		next  atomic.Int64
+		errs  atomic.Int64
+		first sync.Once
+		wg    sync.WaitGroup
+	)
+	start := time.Now()
+	for range min(workers, ops) {
+		wg.Go(func() {
+			for ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= ops {
+					return
+				}
+				t := time.Now()
+				err := op(ctx, i)
+				lat[i] = time.Since(t)
+				if err != nil {
+					errs.Add(1)
+					first.Do(func() { fmt.Fprintf(os.Stderr, "bench: %v (further errors are only counted)\n", err) })
+				}
+			}
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	done := min(int(next.Load()), ops)
+	return summarize(lat[:done], int(errs.Load()), elapsed)
+}
+
+// timeEach runs op n times in a row and times each run.
+func timeEach(n int, op func() error) (Result, error) {
+	lat := make([]time.Duration, n)
+	start := time.Now()
+	for i := range lat {
+		t := time.Now()
+		if err := op(); err != nil {
+			return Result{}, err
+		}
+		lat[i] = time.Since(t)
+	}
+	return summarize(lat, 0, time.Since(start)), nil
+}
+
+func summarize(lat []time.Duration, errs int, elapsed time.Duration) Result {
+	r := Result{Ops: len(lat), Errors: errs, Seconds: elapsed.Seconds()}
+	if len(lat) == 0 {
+		return r
+	}
+	sorted := slices.Clone(lat)
+	slices.Sort(sorted)
+	pct := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return ms(sorted[max(i, 0)])
+	}
+	r.OpsPerSec = float64(len(lat)) / elapsed.Seconds()
+	r.P50Ms, r.P90Ms, r.P99Ms = pct(0.50), pct(0.90), pct(0.99)
+	r.MaxMs = ms(sorted[len(sorted)-1])
+	return r
+}
+
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+
+// ─── Comparing reports ────────────────────────────────────────────────────────
+
+// Regression is one figure that got worse by more than the threshold.
+type Regression struct {
+	Name      string  `json:"name"`
+	FsyncMode string  `json:"fsync_mode,omitempty"`
+	Metric    string  `json:"metric"` // ops_per_sec, p99_ms or errors
+	Base      float64 `json:"base"`
+	Current   float64 `json:"current"`
+	Change    float64 `json:"change"` // relative, +0.25 = 25% worse
+}
+
+// resultKey is what Compare matches results by: a case run in one fsync
+// mode is never compared with a run in another.
+type resultKey struct{ name, fsyncMode string }
+
+// p99Noise is the smallest p99 rise Compare reports, however large in
+// relative terms: a few microseconds either way is scheduling, not code.
+const p99Noise = 0.05 // ms
+
+// Compare returns the cases in both reports whose throughput fell, or
+// whose p99 latency rose, by more than threshold (0.10 = 10%), and those
+// that newly had errors. Cases are matched by name and fsync mode; those
+// only in one report are skipped.
+func Compare(base, cur Report, threshold float64) []Regression {
+	prev := make(map[resultKey]Result, len(base.Results))
+	for _, r := range base.Results {
+		prev[resultKey{r.Name, r.FsyncMode}] = r
+	}
+	var out []Regression
+	for _, r := range cur.Results {
+		b, ok := prev[resultKey{r.Name, r.FsyncMode}]
+		if !ok {
+			continue
+		}
+		regressed := func(metric string, base, cur, change float64) {
+			out = append(out, Regression{Name: r.Name, FsyncMode: r.FsyncMode, Metric: metric, Base: base, Current: cur, Change: change})
+		}
+		if r.Errors > b.Errors {
+			regressed("errors", float64(b.Errors), float64(r.Errors), 0)
+		}
+		if b.OpsPerSec > 0 {
+			if change := (b.OpsPerSec - r.OpsPerSec) / b.OpsPerSec; change > threshold {
+				regressed("ops_per_sec", b.OpsPerSec, r.OpsPerSec, change)
+			}
+		}
+		if b.P99Ms > 0 && r.P99Ms-b.P99Ms >= p99Noise {
+			if change := (r.P99Ms - b.P99Ms) / b.P99Ms; change > threshold {
+				regressed("p99_ms", b.P99Ms, r.P99Ms, change)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package bench
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+// BenchmarkWALPut is the WAL cases as go test benchmarks, b.N writes
+// per run:
+//
+//	go test ./bench -run '^$' -bench WALPut -benchtime 2000x
+func BenchmarkWALPut(b *testing.B) {
+	for _, mode := range store.WALSyncModes {
+		for _, writers := range walWriters {
+			b.Run(fmt.Sprintf("fsync=%s/writers=%d", mode, writers), func(b *testing.B) {
+				e := &env{cfg: DefaultConfig, dir: b.TempDir(), rng: rand.New(rand.NewPCG(DefaultConfig.Seed, 0))}
+				s, err := openWALStore(e.dir, mode)
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer s.Close()
+				keys, value := e.keys(b.N), e.value()
+
+				b.ResetTimer()
+				res := measure(context.Background(), b.N, writers, func(ctx context.Context, i int) error {
+					_, err := s.Put(ctx, store.NamespacedKey(store.DefaultNamespace, keys[i]), value, "", nil)
+					return err
+				})
+				b.StopTimer()
+				if res.Errors > 0 {
+					b.Fatalf("%d writes failed", res.Errors)
+				}
+				st := s.WALStats()
+				b.ReportMetric(ratio(st.Syncs, st.Entries), "fsyncs/op")
+				b.ReportMetric(res.P99Ms, "p99-ms")
+			})
+		}
+	}
+}
+
+func TestWALCasesCoverEveryFsyncMode(t *testing.T) {
+	seen := make(map[string]int)
+	for _, c := range walCases() {
+		seen[c.FsyncMode]++
+	}
+	for _, mode := range store.WALSyncModes {
+		if seen[mode] != len(walWriters) {
+			t.Errorf("fsync mode %s: %d cases, want %d", mode, seen[mode], len(walWriters))
+		}
+	}
+}
+
+func TestCompareKeysOnFsyncMode(t *testing.T) {
+	result := func(mode string, opsPerSec float64) Result {
+		return Result{Name: "wal/put", FsyncMode: mode, OpsPerSec: opsPerSec}
+	}
+	base := Report{Results: []Result{result(store.WALSyncAlways, 100), result(store.WALSyncInterval, 10000)}}
+
+	// interval against always would be a 99% "regression".
+	cur := Report{Results: []Result{result(store.WALSyncAlways, 95), result(store.WALSyncInterval, 9900)}}
+	if got := Compare(base, cur, 0.10); len(got) != 0 {
+		t.Errorf("within threshold per mode: got %+v", got)
+	}
+
+	cur = Report{Results: []Result{result(store.WALSyncAlways, 100), result(store.WALSyncInterval, 5000)}}
+	got := Compare(base, cur, 0.10)
+	if len(got) != 1 || got[0].FsyncMode != store.WALSyncInterval || got[0].Metric != "ops_per_sec" {
+		t.Fatalf("got %+v, want one ops_per_sec regression in interval mode", got)
+	}
+
+	// A mode the baseline did not run is skipped.
+	cur = Report{Results: []Result{result(store.WALSyncGroup, 1)}}
+	if got := Compare(base, cur, 0.10); len(got) != 0 {
+		t.Errorf("mode missing from baseline: got %+v", got)
+	}
+}
@@ -0,0 +1,183 @@
+package bench
+
+import (
+	"cmp"
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"distributed-kvstore/pkg/kv"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// ─── In-process clusters ──────────────────────────────────────────────────────
+//
+// The cluster cases run real nodes (pkg/kv) in this process, talking
+// over loopback HTTP: replication, quorum waits and read routing are the
+// server's, only the network is as fast as it gets. Operations go
+// through the first node, which is a replica of every key (N = cluster
+// size), so no case measures forwarding.
+
+// testCluster is a running in-process cluster.
+type testCluster []*kv.Node
+
+// startCluster starts nodes nodes with quorum n, w, r in dir.
+func startCluster(dir string, nodes, n, w, r int) (testCluster, error) {
+	if nodes == 1 {
+		node, err := kv.Open(kv.Config{ID: "n1", DataDir: dir, N: n, W: w, R: r})
+		if err != nil {
+			return nil, err
+		}
+		return testCluster{node}, nil
+	}
+
+	addrs, err := freeAddrs(nodes)
+	if err != nil {
+		return nil, err
+	}
+	var c testCluster
+	for i := range nodes {
+		peers := make(map[string]string)
+		for j, addr := range addrs {
+			if j != i {
+				peers[fmt.Sprintf("n%d", j+1)] = addr
+			}
+		}
+		node, err := kv.Open(kv.Config{ID: fmt.Sprintf("n%d", i+1), DataDir: dir, Addr: addrs[i], Peers: peers, N: n, W: w, R: r})
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+		c = append(c, node)
+	}
+	return c, nil
+}
+
+// close stops the nodes, all at once: one by one, each would wait out
+// the requests of the others still running.
+func (c testCluster) close() error {
+	errs := make([]error, len(c))
+	var wg sync.WaitGroup
+	for i, n := range c {
+		wg.Go(func() { errs[i] = n.Close() })
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// freeAddrs returns n loopback addresses nothing listens on right now.
+func freeAddrs(n int) ([]string, error) {
+	var addrs []string
+	for range n {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		defer ln.Close()
+		addrs = append(addrs, ln.Addr().String())
+	}
+	return addrs, nil
+}
+
+// clusterWorkers is how many operations the cluster cases keep in flight.
+const clusterWorkers = 16
+
+// load writes value to each of keys through the first node.
+func (c testCluster) load(ctx context.Context, keys []string, value string) Result {
+	return measure(ctx, len(keys), clusterWorkers, func(ctx context.Context, i int) error {
+		_, err := c[0].Put(ctx, store.DefaultNamespace, keys[i], value, "")
+		return err
+	})
+}
+
+// ─── Replication fan-out ──────────────────────────────────────────────────────
+
+// replicationSizes are the cluster sizes of the fan-out cases.
+var replicationSizes = []int{1, 3, 5}
+
+func replicationCases() []Case {
+	var cases []Case
+	for _, size := range replicationSizes {
+		q := size/2 + 1
+		cases = append(cases, Case{
+			Name:  fmt.Sprintf("replicate/nodes=%d", size),
+			About: fmt.Sprintf("Quorum writes to %d replicas, waiting for %d", size, q),
+			run: func(ctx context.Context, e *env) (Result, error) {
+				return clusterWrite(ctx, e, size, size, q, q)
+			},
+		})
+	}
+	return cases
+}
+
+// clusterWrite times writes of new keys on a cluster of nodes nodes.
+func clusterWrite(ctx context.Context, e *env, nodes, n, w, r int) (Result, error) {
+	c, err := startCluster(e.dir, nodes, n, w, r)
+	if err != nil {
+		return Result{}, err
+	}
+	res := c.load(ctx, e.keys(e.cfg.ops(1000)), e.value())
+	return res, c.close()
+}
+
+// ─── Quorum latency ───────────────────────────────────────────────────────────
+//
+// Three nodes, N = 3. The write cases move W (and R with it, to keep
+// R + W > N). The read cases read each of the keys written beforehand
+// once: with each read policy, and with R = 1 (see cluster/fastread.go).
+
+func quorumCases() []Case {
+	var cases []Case
+	for w := 1; w <= 3; w++ {
+		cases = append(cases, Case{
+			Name:  fmt.Sprintf("quorum/write/w=%d", w),
+			About: fmt.Sprintf("Writes on 3 nodes waiting for %d of them", w),
+			run: func(ctx context.Context, e *env) (Result, error) {
+				return clusterWrite(ctx, e, 3, 3, w, 4-w)
+			},
+		})
+	}
+	reads := []struct {
+		name   string
+		policy string
+		w, r   int
+	}{
+		{"ring", cluster.ReadRing, 2, 2},
+		{"nearest", cluster.ReadNearest, 2, 2},
+		{"one", cluster.ReadOne, 2, 2},
+		{"r=1", "", 3, 1},
+	}
+	for _, rd := range reads {
+		cases = append(cases, Case{
+			Name:  "quorum/read/" + rd.name,
+			About: fmt.Sprintf("Reads on 3 nodes with R=%d, policy %s", rd.r, cmp.Or(rd.policy, "ring")),
+			run: func(ctx context.Context, e *env) (Result, error) {
+				return clusterRead(ctx, e, rd.policy, rd.w, rd.r)
+			},
+		})
+	}
+	return cases
+}
+
+// clusterRead times reads of keys written beforehand on three nodes.
+func clusterRead(ctx context.Context, e *env, policy string, w, r int) (Result, error) {
+	c, err := startCluster(e.dir, 3, 3, w, r)
+	if err != nil {
+		return Result{}, err
+	}
+	keys := e.keys(e.cfg.ops(1000))
+	if load := c.load(ctx, keys, e.value()); load.Errors > 0 {
+		c.close()
+		return Result{}, fmt.Errorf("loading %d keys: %d writes failed", len(keys), load.Errors)
+	}
+	if policy != "" {
+		ctx = cluster.WithReadPolicy(ctx, policy)
+	}
+	res := measure(ctx, len(keys), clusterWorkers, func(ctx context.Context, i int) error {
+		_, err := c[0].Get(ctx, store.DefaultNamespace, keys[i])
+		return err
+	})
+	return res, c.close()
+}
@@ -0,0 +1,170 @@
+package bench
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ─── WAL writes ───────────────────────────────────────────────────────────────
+//
+// What a write costs is mostly when its WAL line is synced, which
+// --wal-sync decides (see store/wal_sync.go): with group commit, writers
+// that arrive while a sync runs share the next one; always syncs every
+// entry; interval syncs on a timer. So the cases run each mode with one
+// writer to many, and report fsyncs_per_write alongside the latencies.
+// Results carry their mode, and Compare only holds a mode against
+// itself.
+
+// walWriters are the writer counts of the WAL cases.
+var walWriters = []int{1, 8, 64}
+
+func walCases() []Case {
+	var cases []Case
+	for _, mode := range store.WALSyncModes {
+		for _, w := range walWriters {
+			cases = append(cases, Case{
+				Name:      fmt.Sprintf("wal/put/fsync=%s/writers=%d", mode, w),
+				About:     fmt.Sprintf("Store.Put of new keys from %d goroutines, WAL synced %s", w, syncAbout[mode]),
+				FsyncMode: mode,
+				run:       func(ctx context.Context, e *env) (Result, error) { return walPut(ctx, e, mode, w) },
+			})
+		}
+	}
+	return cases
+}
+
+var syncAbout = map[string]string{
+	store.WALSyncGroup:    "by group commit",
+	store.WALSyncAlways:   "per entry",
+	store.WALSyncInterval: "every " + store.DefaultWALSyncInterval.String(),
+}
+
+// openWALStore opens a store in dir syncing its WAL in mode.
+func openWALStore(dir, mode string) (*store.Store, error) {
+	s, err := store.New(dir, "bench")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SetWALSync(mode, store.DefaultWALSyncInterval); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func walPut(ctx context.Context, e *env, mode string, writers int) (Result, error) {
+	s, err := openWALStore(e.dir, mode)
+	if err != nil {
+		return Result{}, err
+	}
+	defer s.Close()
+
+	keys, value := e.keys(e.cfg.ops(2000)), e.value()
+	res := measure(ctx, len(keys), writers, func(ctx context.Context, i int) error {
+		_, err := s.Put(ctx, store.NamespacedKey(store.DefaultNamespace, keys[i]), value, "", nil)
+		return err
+	})
+	st := s.WALStats()
+	res.Extra = map[string]float64{
+		"fsyncs_per_write":    ratio(st.Syncs, st.Entries),
+		"wal_bytes_per_write": ratio(int(st.Bytes), st.Entries),
+	}
+	return res, nil
+}
+
+// ─── Snapshots and recovery ───────────────────────────────────────────────────
+//
+// A snapshot writes every record, so its cost grows with the store; so
+// does recovery, which loads it back. Each case fills a store with its
+// number of keys (untimed), takes full snapshots of it, then reopens it.
+
+// snapshotSizes are the key counts of the snapshot cases, before Scale.
+var snapshotSizes = []int{1_000, 10_000, 50_000}
+
+// snapshotRuns is how many snapshots each case times.
+const snapshotRuns = 3
+
+func snapshotCases() []Case {
+	var cases []Case
+	for _, n := range snapshotSizes {
+		cases = append(cases, Case{
+			Name:  fmt.Sprintf("snapshot/keys=%d", n),
+			About: fmt.Sprintf("Full snapshots of a store of %d keys, then recovery from one", n),
+			run:   func(ctx context.Context, e *env) (Result, error) { return snapshot(ctx, e, e.cfg.ops(n)) },
+		})
+	}
+	return cases
+}
+
+func snapshot(ctx context.Context, e *env, n int) (Result, error) {
+	s, err := store.New(e.dir, "bench")
+	if err != nil {
+		return Result{}, err
+	}
+	defer func() { s.Close() }()
+
+	keys, value := e.keys(n), e.value()
+	load := measure(ctx, n, 64, func(ctx context.Context, i int) error {
+		_, err := s.Put(ctx, store.NamespacedKey(store.DefaultNamespace, keys[i]), value, "", nil)
+		return err
+	})
+	if load.Errors > 0 {
+		return Result{}, fmt.Errorf("loading %d keys: %d writes failed", n, load.Errors)
+	}
+
+	res, err := timeEach(snapshotRuns, s.Snapshot)
+	if err != nil {
+		return Result{}, err
+	}
+	size, err := snapshotBytes(e.dir)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Recovery: the snapshot holds everything, the WAL nothing.
+	if err := s.Close(); err != nil {
+		return Result{}, err
+	}
+	start := time.Now()
+	reopened, err := store.New(e.dir, "bench")
+	if err != nil {
+		return Result{}, fmt.Errorf("reopen: %w", err)
+	}
+	recovery := time.Since(start)
+	s = reopened
+
+	res.Extra = map[string]float64{
+		"keys":           float64(n),
+		"snapshot_bytes": float64(size),
+		"recovery_ms":    ms(recovery),
+	}
+	return res, nil
+}
+
+// snapshotBytes returns the size of the snapshot files in dir.
+func snapshotBytes(dir string) (int64, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "snapshot-*.json"))
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return 0, err
+		}
+		total += fi.Size()
+	}
+	return total, nil
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
@@ -0,0 +1,132 @@
+// cmd/bench runs the performance regression suite (package bench) and
+// writes its report as JSON.
+//
+// Usage:
+//
+//	go run ./cmd/bench -o base.json                     (on the old tree)
+//	go run ./cmd/bench -o new.json -compare base.json   (on the new one)
+//	go run ./cmd/bench -run 'wal|snapshot' -scale 0.2   (a quick subset)
+//	go run ./cmd/bench -list
+//
+// Progress goes to stderr, one line per case. With -compare, every case
+// whose throughput fell or p99 latency rose by more than -threshold
+// against the baseline is listed, and the exit status is 3.
+package main
+
+import (
+	"context"
+	"distributed-kvstore/bench"
+	"distributed-kvstore/internal/logging"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+)
+
+func main() {
+	run := flag.String("run", "", "Run only the cases whose name matches this regexp")
+	list := flag.Bool("list", false, "List the cases and exit")
+	scale := flag.Float64("scale", bench.DefaultConfig.Scale, "Multiply every case's operation count by this")
+	valueSize := flag.Int("value-size", bench.DefaultConfig.ValueSize, "Bytes per written value")
+	seed := flag.Uint64("seed", bench.DefaultConfig.Seed, "Seed of the generated keys and values")
+	dir := flag.String("dir", "", "Where to create the data directories (default: the OS temp dir)")
+	out := flag.String("o", "-", "Write the JSON report to this file (- = stdout)")
+	compare := flag.String("compare", "", "Baseline report to compare against")
+	threshold := flag.Float64("threshold", 0.10, "Relative change that counts as a regression with -compare")
+	logLevel := flag.String("log-level", "error", "Log level of the nodes under test: debug, info, warn or error")
+	flag.Parse()
+
+	if *list {
+		for _, c := range bench.Suite() {
+			fmt.Printf("%-34s  %s\n", c.Name, c.About)
+		}
+		return
+	}
+
+	logger, err := logging.New(os.Stderr, *logLevel, "text")
+	if err != nil {
+		fail(err)
+	}
+	slog.SetDefault(logger)
+
+	var match func(string) bool
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			fail(fmt.Errorf("-run: %w", err))
+		}
+		match = re.MatchString
+	}
+	var base *bench.Report
+	if *compare != "" {
+		if base, err = readReport(*compare); err != nil {
+			fail(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cfg := bench.Config{Dir: *dir, Scale: *scale, ValueSize: *valueSize, Seed: *seed}
+	report, err := bench.Run(ctx, cfg, match, func(r bench.Result) {
+		fmt.Fprintf(os.Stderr, "%-34s  %7d ops  %9.0f ops/s  p50 %8.3fms  p99 %8.3fms  errors %d\n",
+			r.Name, r.Ops, r.OpsPerSec, r.P50Ms, r.P99Ms, r.Errors)
+	})
+	if err != nil {
+		fail(err)
+	}
+	if err := writeReport(*out, report); err != nil {
+		fail(err)
+	}
+
+	if base == nil {
+		return
+	}
+	if base.Config != report.Config {
+		fmt.Fprintf(os.Stderr, "warning: the baseline was made with %+v, this run with %+v\n", base.Config, report.Config)
+	}
+	regressions := bench.Compare(*base, report, *threshold)
+	if len(regressions) == 0 {
+		fmt.Fprintf(os.Stderr, "no regressions beyond %.0f%% against %s\n", *threshold*100, *compare)
+		return
+	}
+	for _, r := range regressions {
+		fmt.Fprintf(os.Stderr, "REGRESSION %-34s  %-11s  %.3f → %.3f (%+.0f%%)\n", r.Name, r.Metric, r.Base, r.Current, r.Change*100)
+	}
+	os.Exit(3)
+}
+
+func readReport(path string) (*bench.Report, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r bench.Report
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &r, nil
+}
+
+func writeReport(path string, r bench.Report) error {
+	w := os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
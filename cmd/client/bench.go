@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"distributed-kvstore/internal/client"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ─── bench ────────────────────────────────────────────────────────────────────
+//
+// bench runs phases of operations against the cluster, each with
+// --concurrency workers sharing one client, and reports per operation
+// the throughput and latency percentiles as seen from here: quorum
+// round trips, forwarding hops and client retries included.
+//
+// By default it writes --writes keys, reads --reads of them back and
+// deletes them. With --mix it writes the keys, then runs the mix over
+// them for --duration (or --ops operations), then deletes them. Keys
+// live under a fresh prefix (bench-<id>:) so runs do not meet.
+
+// benchOps are the operations a --mix may weigh.
+var benchOps = []string{"put", "get", "delete"}
+
+func benchCmd() *cobra.Command {
+	var (
+		writes      int
+		reads       int
+		concurrency int
+		valueSize   string
+		mix         string
+		duration    time.Duration
+		ops         int
+		keep        bool
+		output      string
+	)
+	cmd := &cobra.Command{
+		Use:   "bench [--writes n] [--concurrency c] [--value-size 1kb] [--mix put=20,get=80]",
+		Short: "Load-test the cluster and report throughput and latency percentiles",
+		Long: "Writes --writes keys, reads --reads of them back and deletes them,\n" +
+			"with --concurrency requests in flight, then prints ops/s and p50,\n" +
+			"p90, p99, p99.9 and max latency per operation. --mix instead runs a\n" +
+			"weighted mix of put, get and delete over the written keys for\n" +
+			"--duration. Latencies include client retries (see --retries); a get or\n" +
+			"delete of a key that is gone counts as a miss, not an error.",
+		Example: "  kvcli bench --writes 10000 --concurrency 64 --value-size 1kb\n" +
+			"  kvcli bench --writes 1000 --mix put=10,get=85,delete=5 --duration 1m -o json",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			size, err := parseByteSize(valueSize)
+			if err != nil {
+				return fmt.Errorf("--value-size: %w", err)
+			}
+			weights, err := parseMix(mix)
+			if err != nil {
+				return fmt.Errorf("--mix: %w", err)
+			}
+			switch {
+			case writes < 1 || concurrency < 1:
+				return errors.New("--writes and --concurrency must be at least 1")
+			case output != "table" && output != "json":
+				return fmt.Errorf("--output must be table or json, not %q", output)
+			}
+			if reads < 0 {
+				reads = writes
+			}
+			cmd.SilenceUsage = true
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			b := &bench{
+				c:           newClient(),
+				prefix:      fmt.Sprintf("bench-%s:", strconv.FormatInt(time.Now().UnixMilli(), 36)),
+				keys:        writes,
+				concurrency: concurrency,
+				value:       randomValue(int(size)),
+			}
+			var results []benchResult
+			if weights == nil {
+				results = b.runFixed(ctx, reads, keep)
+			} else {
+				results = b.runMix(ctx, weights, duration, ops, keep)
+			}
+			if output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(results)
+			}
+			printBenchResults(results)
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "interrupted: the results cover what ran")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&writes, "writes", 10000, "Keys to write (the keyspace of --mix)")
+	cmd.Flags().IntVar(&reads, "reads", -1, "Gets after the writes (default: --writes)")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "c", 16, "Requests in flight")
+	cmd.Flags().StringVar(&valueSize, "value-size", "100b", "Size of each value (512, 1kb, 4mb)")
+	cmd.Flags().StringVar(&mix, "mix", "", "Weighted mixed workload, e.g. put=20,get=75,delete=5")
+	cmd.Flags().DurationVar(&duration, "duration", 30*time.Second, "How long the --mix runs")
+	cmd.Flags().IntVar(&ops, "ops", 0, "Stop the --mix after this many operations (0 = run for --duration)")
+	cmd.Flags().BoolVar(&keep, "keep", false, "Do not delete the keys at the end")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+	return cmd
+}
+
+// benchResult is one operation's figures in one phase.
+type benchResult struct {
+	Phase     string  `json:"phase"`
+	Op        string  `json:"op"`
+	Ops       int     `json:"ops"`
+	Errors    int     `json:"errors"`
+	Misses    int     `json:"misses"` // get or delete of a missing key
+	Seconds   float64 `json:"seconds"`
+	OpsPerSec float64 `json:"ops_per_sec"`
+	P50Ms     float64 `json:"p50_ms"`
+	P90Ms     float64 `json:"p90_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	P999Ms    float64 `json:"p999_ms"`
+	MaxMs     float64 `json:"max_ms"`
+}
+
+type bench struct {
+	c           *client.Client
+	prefix      string
+	keys        int
+	concurrency int
+	value       string
+}
+
+func (b *bench) key(i int) string { return fmt.Sprintf("%s%08d", b.prefix, i) }
+
+func (b *bench) runFixed(ctx context.Context, reads int, keep bool) []benchResult {
+	out := b.phase(ctx, "put", b.keys, b.sequential("put", b.keys))
+	if reads > 0 {
+		out = append(out, b.phase(ctx, "get", reads, b.sequential("get", reads))...)
+	}
+	if !keep {
+		out = append(out, b.phase(ctx, "delete", b.keys, b.sequential("delete", b.keys))...)
+	}
+	return out
+}
+
+func (b *bench) runMix(ctx context.Context, weights map[string]int, duration time.Duration, ops int, keep bool) []benchResult {
+	out := b.phase(ctx, "load", b.keys, b.sequential("put", b.keys))
+
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	mixCtx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	var n atomic.Int64
+	next := func(r *rand.Rand) (string, int, bool) {
+		if ops > 0 && n.Add(1) > int64(ops) {
+			return "", 0, false
+		}
+		pick := r.IntN(total)
+		for _, op := range benchOps {
+			if pick < weights[op] {
+				return op, r.IntN(b.keys), true
+			}
+			pick -= weights[op]
+		}
+		panic("unreachable")
+	}
+	out = append(out, b.phase(mixCtx, "mix", ops, next)...)
+
+	if !keep && ctx.Err() == nil {
+		out = append(out, b.phase(ctx, "cleanup", b.keys, b.sequential("delete", b.keys))...)
+	}
+	return out
+}
+
+// sequential returns the op on keys 0..n-1, wrapping around the
+// keyspace when n exceeds it.
+func (b *bench) sequential(op string, n int) func(*rand.Rand) (string, int, bool) {
+	var i atomic.Int64
+	return func(*rand.Rand) (string, int, bool) {
+		k := int(i.Add(1) - 1)
+		if k >= n {
+			return "", 0, false
+		}
+		return op, k % b.keys, true
+	}
+}
+
+// opSamples is what one worker measured for one operation.
+type opSamples struct {
+	lat    []time.Duration
+	errors int
+	misses int
+}
+
+// phase runs next's operations on the workers until next is out of them
+// or ctx is done, and returns one result per operation that ran. total
+// sizes the progress line (0 = unknown).
+func (b *bench) phase(ctx context.Context, name string, total int, next func(*rand.Rand) (string, int, bool)) []benchResult {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		merged  = make(map[string]*opSamples)
+		done    atomic.Int64
+		reports sync.Map // op → printed its first error
+	)
+	stopProgress := benchProgress(name, total, &done)
+	start := time.Now()
+	for range b.concurrency {
+		wg.Go(func() {
+			r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+			local := make(map[string]*opSamples)
+			for ctx.Err() == nil {
+				op, k, ok := next(r)
+				if !ok {
+					break
+				}
+				t := time.Now()
+				miss, err := b.do(ctx, op, b.key(k))
+				d := time.Since(t)
+				if ctx.Err() != nil {
+					break // cut short, not a result
+				}
+				s := local[op]
+				if s == nil {
+					s = &opSamples{}
+					local[op] = s
+				}
+				s.lat = append(s.lat, d)
+				switch {
+				case err != nil:
+					s.errors++
+					if _, seen := reports.LoadOrStore(op, true); !seen {
+						fmt.Fprintf(os.Stderr, "%s %s: %v (further errors are only counted)\n", op, b.key(k), err)
+					}
+				case miss:
+					s.misses++
+				}
+				done.Add(1)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for op, s := range local {
+				m := merged[op]
+				if m == nil {
+					merged[op] = s
+					continue
+				}
+				m.lat = append(m.lat, s.lat...)
+				m.errors += s.errors
+				m.misses += s.misses
+			}
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	stopProgress()
+
+	var out []benchResult
+	for _, op := range benchOps {
+		if s, ok := merged[op]; ok {
+			out = append(out, summarize(name, op, s, elapsed))
+		}
+	}
+	return out
+}
+
+// do runs one operation. miss reports a get or delete of a missing key.
+func (b *bench) do(ctx context.Context, op, key string) (miss bool, err error) {
+	switch op {
+	case "put":
+		_, err = b.c.Put(ctx, key, b.value)
+	case "get":
+		_, err = b.c.Get(ctx, key)
+	case "delete":
+		err = b.c.Delete(ctx, key)
+	}
+	var apiErr *client.APIError
+	if errors.Is(err, client.ErrNotFound) || errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return true, nil
+	}
+	return false, err
+}
+
+func summarize(phase, op string, s *opSamples, elapsed time.Duration) benchResult {
+	slices.Sort(s.lat)
+	pct := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(s.lat)))) - 1
+		return ms(s.lat[max(i, 0)])
+	}
+	return benchResult{
+		Phase:     phase,
+		Op:        op,
+		Ops:       len(s.lat),
+		Errors:    s.errors,
+		Misses:    s.misses,
+		Seconds:   elapsed.Seconds(),
+		OpsPerSec: float64(len(s.lat)) / elapsed.Seconds(),
+		P50Ms:     pct(0.50),
+		P90Ms:     pct(0.90),
+		P99Ms:     pct(0.99),
+		P999Ms:    pct(0.999),
+		MaxMs:     ms(s.lat[len(s.lat)-1]),
+	}
+}
+
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+
+// benchProgress prints how far phase is on stderr every 2s until the
+// returned stop is called.
+func benchProgress(phase string, total int, done *atomic.Int64) (stop func()) {
+	start := time.Now()
+	quit := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		t := time.NewTicker(2 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				n := done.Load()
+				of := ""
+				if total > 0 {
+					of = fmt.Sprintf("/%d", total)
+				}
+				fmt.Fprintf(os.Stderr, "%s: %d%s ops (%.0f/s)\n", phase, n, of, float64(n)/time.Since(start).Seconds())
+			case <-quit:
+				return
+			}
+		}
+	})
+	return func() { close(quit); wg.Wait() }
+}
+
+func printBenchResults(results []benchResult) {
+	fmt.Printf("%-8s  %-6s  %8s  %6s  %6s  %9s  %8s  %8s  %8s  %8s  %8s\n",
+		"PHASE", "OP", "OPS", "ERRORS", "MISSES", "OPS/S", "P50", "P90", "P99", "P99.9", "MAX")
+	for _, r := range results {
+		fmt.Printf("%-8s  %-6s  %8d  %6d  %6d  %9.0f  %8s  %8s  %8s  %8s  %8s\n",
+			r.Phase, r.Op, r.Ops, r.Errors, r.Misses, r.OpsPerSec,
+			fmtMs(r.P50Ms), fmtMs(r.P90Ms), fmtMs(r.P99Ms), fmtMs(r.P999Ms), fmtMs(r.MaxMs))
+	}
+}
+
+func fmtMs(v float64) string {
+	if v < 10 {
+		return fmt.Sprintf("%.2fms", v)
+	}
+	return fmt.Sprintf("%.0fms", v)
+}
+
+// parseMix parses "put=20,get=75,delete=5" into weights; "" is nil.
+func parseMix(spec string) (map[string]int, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	weights := make(map[string]int)
+	total := 0
+	for part := range strings.SplitSeq(spec, ",") {
+		op, w, ok := strings.Cut(strings.TrimSpace(part), "=")
+		n, err := strconv.Atoi(w)
+		switch {
+		case !ok || err != nil || n < 0:
+			return nil, fmt.Errorf("%q is not op=weight", part)
+		case !slices.Contains(benchOps, op):
+			return nil, fmt.Errorf("unknown operation %q (want put, get or delete)", op)
+		}
+		weights[op] += n
+		total += n
+	}
+	if total == 0 {
+		return nil, errors.New("the weights add up to 0")
+	}
+	return weights, nil
+}
+
+// parseByteSize parses a size with an optional unit, in any case:
+// 512, 1kb, 1KiB, 4m. Units are binary.
+func parseByteSize(v string) (int64, error) {
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(v)), "b"), "i")
+	shift := 0
+	if n := len(num); n > 0 {
+		switch num[n-1] {
+		case 'k':
+			shift = 10
+		case 'm':
+			shift = 20
+		case 'g':
+			shift = 30
+		}
+		if shift > 0 {
+			num = num[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	return n << shift, nil
+}
+
+// randomValue returns n random letters and digits, so compression does
+// not flatter the numbers.
+func randomValue(n int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[rand.IntN(len(alphabet))]
+	}
+	return string(b)
+}
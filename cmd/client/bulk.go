@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"distributed-kvstore/internal/client"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ─── import / export ──────────────────────────────────────────────────────────
+//
+// Both speak NDJSON, one record per line:
+//
+//	{"key": "user:42", "value": "alice", "content_type": "text/plain"}
+//
+// import sends records as pipelines (POST /batch) from several workers;
+// export lists keys page by page and fetches each page's values as one
+// pipeline. Both report progress on stderr and keep a <file>.progress
+// next to their file, so an interrupted run continues with --resume
+// instead of starting over. The file is removed once a run completes.
+
+// bulkRecord is one line of an import or export file. Namespace is
+// optional on import (--namespace otherwise) and never written by
+// export, so a dump can be loaded into any namespace.
+type bulkRecord struct {
+	Namespace   string `json:"namespace,omitempty"`
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// maxRecordSize bounds one NDJSON line: the largest value, escaped.
+const maxRecordSize = 16 << 20
+
+func importCmd() *cobra.Command {
+	var (
+		file        string
+		batch       int
+		concurrency int
+		resume      bool
+	)
+	cmd := &cobra.Command{
+		Use:   "import --file data.ndjson",
+		Short: "Load NDJSON records into the cluster",
+		Long: "Writes every record of the file, --batch records per request, with\n" +
+			"--concurrency requests in flight. Records that fail are reported with\n" +
+			"their line number. After an interruption (Ctrl-C, lost connection),\n" +
+			"--resume skips the records already written.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if batch < 1 || concurrency < 1 {
+				return errors.New("--batch and --concurrency must be at least 1")
+			}
+			cmd.SilenceUsage = true
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return runImport(ctx, file, batch, concurrency, resume)
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "", "NDJSON file to load")
+	cmd.Flags().IntVar(&batch, "batch", 500, "Records per request")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Requests in flight")
+	cmd.Flags().BoolVar(&resume, "resume", false, "Continue an interrupted import of the same file")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func exportCmd() *cobra.Command {
+	var (
+		prefix      string
+		out         string
+		page        int
+		concurrency int
+		resume      bool
+	)
+	cmd := &cobra.Command{
+		Use:   "export [--prefix p] --out file.ndjson",
+		Short: "Dump keys and values as NDJSON",
+		Long: "Writes every live key of the namespace (starting with --prefix), in\n" +
+			"key order, with its value. --out - writes to stdout. With a file,\n" +
+			"--resume continues an interrupted export where it stopped.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if page < 1 || page > 1000 || concurrency < 1 {
+				return errors.New("--page must be 1 to 1000 and --concurrency at least 1")
+			}
+			if resume && out == "-" {
+				return errors.New("--resume needs an --out file")
+			}
+			cmd.SilenceUsage = true
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return runExport(ctx, prefix, out, page, concurrency, resume)
+		},
+	}
+	cmd.Flags().StringVar(&prefix, "prefix", "", "Only keys starting with this prefix")
+	cmd.Flags().StringVarP(&out, "out", "o", "", "File to write (- = stdout)")
+	cmd.Flags().IntVar(&page, "page", 1000, "Keys listed and fetched per request")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Pages fetched at once")
+	cmd.Flags().BoolVar(&resume, "resume", false, "Continue an interrupted export to the same file")
+	_ = cmd.MarkFlagRequired("out")
+	return cmd
+}
+
+// ─── import ───────────────────────────────────────────────────────────────────
+
+// importProgress is the <file>.progress of an import: every record
+// before Line (1-based, exclusive) is written.
+type importProgress struct {
+	Line int `json:"line"`
+}
+
+// importChunk is up to --batch consecutive records of the file.
+type importChunk struct {
+	seq   int
+	first int // line of recs[0]
+	next  int // line after the chunk
+	recs  []bulkRecord
+	lines []int // line of every record
+	bad   []string
+}
+
+func runImport(ctx context.Context, file string, batch, concurrency int, resume bool) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	state := file + ".progress"
+	start := 1
+	if resume {
+		var p importProgress
+		if err := readProgress(state, &p); err != nil {
+			return err
+		}
+		start = max(p.Line, 1)
+	}
+
+	c := newClient()
+	prog := newBulkProgress("imported")
+	defer prog.stop()
+
+	// The first chunk that cannot be written stops the rest.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan importChunk)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		readErr <- readChunks(ctx, f, start, batch, chunks)
+	}()
+
+	// Chunks finish out of order; the progress file only moves past a
+	// chunk once every chunk before it is done too.
+	var (
+		mu       sync.Mutex
+		finished = make(map[int]int) // seq → next line
+		nextSeq  int
+		fatal    error
+	)
+	done := func(ch importChunk) {
+		mu.Lock()
+		defer mu.Unlock()
+		finished[ch.seq] = ch.next
+		line := 0
+		for next, ok := finished[nextSeq]; ok; next, ok = finished[nextSeq] {
+			delete(finished, nextSeq)
+			nextSeq++
+			line = next
+		}
+		if line > 0 {
+			if err := writeProgress(state, importProgress{Line: line}); err != nil && fatal == nil {
+				fatal = err
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			for ch := range chunks {
+				if err := importChunkOnce(ctx, c, ch, prog); err != nil {
+					mu.Lock()
+					if fatal == nil && ctx.Err() == nil {
+						fatal = fmt.Errorf("lines %d-%d: %w", ch.first, ch.next-1, err)
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+				done(ch)
+			}
+		})
+	}
+	wg.Wait()
+	prog.stop()
+
+	if err := <-readErr; err != nil && fatal == nil {
+		fatal = err
+	}
+	if fatal == nil && ctx.Err() != nil {
+		fatal = ctx.Err()
+	}
+	if fatal != nil {
+		return fmt.Errorf("import stopped: %w (run again with --resume to continue)", fatal)
+	}
+	_ = os.Remove(state)
+	if n := prog.failed.Load(); n > 0 {
+		return fmt.Errorf("%d records failed", n)
+	}
+	return nil
+}
+
+// readChunks parses the file from line start and sends it in chunks of
+// batch records.
+func readChunks(ctx context.Context, r io.Reader, start, batch int, out chan<- importChunk) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), maxRecordSize)
+
+	ch := importChunk{first: start}
+	line := 0
+	send := func() bool {
+		ch.next = line + 1
+		select {
+		case out <- ch:
+		case <-ctx.Done():
+			return false
+		}
+		ch = importChunk{seq: ch.seq + 1, first: line + 1}
+		return true
+	}
+	for sc.Scan() {
+		line++
+		if line < start {
+			continue
+		}
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec bulkRecord
+		switch err := json.Unmarshal(sc.Bytes(), &rec); {
+		case err != nil:
+			ch.bad = append(ch.bad, fmt.Sprintf("line %d: %v", line, err))
+		case rec.Key == "":
+			ch.bad = append(ch.bad, fmt.Sprintf("line %d: no key", line))
+		default:
+			ch.recs = append(ch.recs, rec)
+			ch.lines = append(ch.lines, line)
+		}
+		if len(ch.recs)+len(ch.bad) == batch && !send() {
+			return nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("line %d: %w", line+1, err)
+	}
+	if len(ch.recs)+len(ch.bad) > 0 {
+		send()
+	}
+	return nil
+}
+
+// importChunkOnce writes one chunk: a pipeline per namespace. Records
+// the server rejects are reported and counted; an error means the
+// chunk as a whole may not have been written.
+func importChunkOnce(ctx context.Context, c *client.Client, ch importChunk, prog *bulkProgress) error {
+	for _, msg := range ch.bad {
+		prog.fail(msg)
+	}
+
+	pipes := make(map[string]*client.Pipeline)
+	lines := make(map[string][]int)
+	for i, rec := range ch.recs {
+		ns := rec.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+		if pipes[ns] == nil {
+			pipes[ns] = c.Namespace(ns).Pipeline()
+		}
+		pipes[ns].PutTyped(rec.Key, rec.Value, rec.ContentType)
+		lines[ns] = append(lines[ns], ch.lines[i])
+	}
+	for ns, p := range pipes {
+		results, err := p.Exec(ctx)
+		if err != nil {
+			return err
+		}
+		for i, r := range results {
+			if r.Err != nil {
+				prog.fail(fmt.Sprintf("line %d (%s/%s): %v", lines[ns][i], ns, r.Key, r.Err))
+				continue
+			}
+			prog.done.Add(1)
+		}
+	}
+	return nil
+}
+
+// ─── export ───────────────────────────────────────────────────────────────────
+
+// exportProgress is the <file>.progress of an export: the first Offset
+// bytes of the file hold Records records, and listing resumes at Cursor.
+type exportProgress struct {
+	Cursor  string `json:"cursor"`
+	Offset  int64  `json:"offset"`
+	Records int64  `json:"records"`
+}
+
+// exportPage is one listed page and, once fetched, its records.
+type exportPage struct {
+	seq  int
+	keys []string
+	next string // cursor after this page; "" = last
+	recs []bulkRecord
+	err  error
+}
+
+func runExport(ctx context.Context, prefix, out string, pageSize, concurrency int, resume bool) error {
+	var (
+		w     io.Writer = os.Stdout
+		state string
+		prog  exportProgress
+	)
+	if out != "-" {
+		state = out + ".progress"
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if resume {
+			if err := readProgress(state, &prog); err != nil {
+				return err
+			}
+			flags = os.O_CREATE | os.O_WRONLY
+		}
+		f, err := os.OpenFile(out, flags, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// Drop whatever a page cut short wrote after the last checkpoint.
+		if err := f.Truncate(prog.Offset); err != nil {
+			return err
+		}
+		if _, err := f.Seek(prog.Offset, io.SeekStart); err != nil {
+			return err
+		}
+		w = f
+	}
+	bw := bufio.NewWriterSize(w, 256<<10)
+
+	c := newClient()
+	report := newBulkProgress("exported")
+	defer report.stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// lister → fetchers → writer. Pages are fetched in parallel and
+	// written back in listing order.
+	listed := make(chan exportPage, concurrency)
+	fetched := make(chan exportPage, concurrency)
+	listErr := make(chan error, 1)
+	go func() {
+		defer close(listed)
+		listErr <- listPages(ctx, c, prefix, prog.Cursor, pageSize, listed)
+	}()
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Go(func() {
+			for p := range listed {
+				p.recs, p.err = fetchPage(ctx, c, p.keys)
+				fetched <- p
+			}
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(fetched)
+	}()
+
+	var (
+		pending = make(map[int]exportPage)
+		nextSeq int
+		werr    error
+	)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	for p := range fetched {
+		if werr != nil {
+			continue // drain
+		}
+		pending[p.seq] = p
+		for q, ok := pending[nextSeq]; ok; q, ok = pending[nextSeq] {
+			delete(pending, nextSeq)
+			nextSeq++
+			if q.err != nil {
+				werr = q.err
+				cancel()
+				break
+			}
+			for _, rec := range q.recs {
+				if werr = enc.Encode(rec); werr != nil {
+					break
+				}
+			}
+			if werr == nil {
+				werr = bw.Flush()
+			}
+			if werr != nil {
+				cancel()
+				break
+			}
+			report.done.Add(int64(len(q.recs)))
+			prog.Records += int64(len(q.recs))
+			if state != "" {
+				if prog.Offset, werr = w.(*os.File).Seek(0, io.SeekCurrent); werr == nil {
+					prog.Cursor = q.next
+					werr = writeProgress(state, prog)
+				}
+			}
+		}
+	}
+	report.stop()
+
+	if err := <-listErr; err != nil && werr == nil && !errors.Is(err, context.Canceled) {
+		werr = err
+	}
+	if werr == nil && ctx.Err() != nil {
+		werr = ctx.Err()
+	}
+	if werr != nil {
+		if state != "" {
+			return fmt.Errorf("export stopped: %w (run again with --resume to continue)", werr)
+		}
+		return fmt.Errorf("export stopped: %w", werr)
+	}
+	if state != "" {
+		_ = os.Remove(state)
+	}
+	return nil
+}
+
+// listPages sends every page of keys from cursor on.
+func listPages(ctx context.Context, c *client.Client, prefix, cursor string, pageSize int, out chan<- exportPage) error {
+	for seq := 0; ; seq++ {
+		page, err := c.KeysPage(ctx, prefix, cursor, pageSize)
+		if err != nil {
+			return fmt.Errorf("list keys: %w", err)
+		}
+		select {
+		case out <- exportPage{seq: seq, keys: page.Keys, next: page.NextCursor}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// fetchPage reads the values of keys as one pipeline. Keys deleted
+// since they were listed are skipped.
+func fetchPage(ctx context.Context, c *client.Client, keys []string) ([]bulkRecord, error) {
+	p := c.Pipeline()
+	for _, k := range keys {
+		p.Get(k)
+	}
+	results, err := p.Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recs := make([]bulkRecord, 0, len(results))
+	for _, r := range results {
+		switch {
+		case errors.Is(r.Err, client.ErrNotFound):
+		case r.Err != nil:
+			return nil, fmt.Errorf("get %s: %w", r.Key, r.Err)
+		default:
+			recs = append(recs, bulkRecord{Key: r.Key, Value: r.Value, ContentType: r.ContentType})
+		}
+	}
+	return recs, nil
+}
+
+// ─── progress ─────────────────────────────────────────────────────────────────
+
+// readProgress loads a .progress file into v; a missing one means
+// "from the start".
+func readProgress(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintln(os.Stderr, "no progress file, starting from the beginning")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// writeProgress replaces the .progress file atomically.
+func writeProgress(path string, v any) error {
+	data, _ := json.Marshal(v)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// maxReportedFailures caps the failed records printed one by one.
+const maxReportedFailures = 20
+
+// bulkProgress prints a rate line on stderr every 2s, and a summary.
+type bulkProgress struct {
+	verb   string
+	start  time.Time
+	done   atomic.Int64
+	failed atomic.Int64
+	quit   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+}
+
+func newBulkProgress(verb string) *bulkProgress {
+	p := &bulkProgress{verb: verb, start: time.Now(), quit: make(chan struct{})}
+	p.wg.Go(func() {
+		t := time.NewTicker(2 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				p.print()
+			case <-p.quit:
+				return
+			}
+		}
+	})
+	return p
+}
+
+// fail counts a failed record and prints the first few.
+func (p *bulkProgress) fail(msg string) {
+	if n := p.failed.Add(1); n <= maxReportedFailures {
+		fmt.Fprintln(os.Stderr, "failed:", msg)
+	} else if n == maxReportedFailures+1 {
+		fmt.Fprintln(os.Stderr, "failed: (further failures are only counted)")
+	}
+}
+
+// stop ends the periodic lines and prints the summary, once.
+func (p *bulkProgress) stop() {
+	p.once.Do(func() {
+		close(p.quit)
+		p.wg.Wait()
+		p.print()
+	})
+}
+
+func (p *bulkProgress) print() {
+	n, elapsed := p.done.Load(), time.Since(p.start)
+	line := fmt.Sprintf("%s %d records in %s (%.0f/s)", p.verb, n, elapsed.Round(100*time.Millisecond), float64(n)/elapsed.Seconds())
+	if f := p.failed.Load(); f > 0 {
+		line += fmt.Sprintf(", %d failed", f)
+	}
+	fmt.Fprintln(os.Stderr, line)
+}
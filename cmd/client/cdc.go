@@ -0,0 +1,78 @@
+package main
+
+import (
+	"distributed-kvstore/internal/client"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ─── cdc ──────────────────────────────────────────────────────────────────────
+
+func cdcCmd() *cobra.Command {
+	var (
+		from      uint64
+		reconnect bool
+	)
+	cmd := &cobra.Command{
+		Use:   "cdc",
+		Short: "Stream a node's numbered change log (change data capture)",
+		Long: "Prints every change the node applied, one JSON object per line, from\n" +
+			"change --from on (default: the oldest it retains), then live, until\n" +
+			"Ctrl-C. Numbers are per node: the feed always reads the first --server.\n" +
+			"Every namespace is included unless --namespace is given. When the\n" +
+			"stream drops it resumes after the last change printed, so nothing is\n" +
+			"skipped or repeated.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			ns := ""
+			if cmd.Flags().Changed("namespace") {
+				ns = namespace
+			}
+			c := newClient()
+			enc := json.NewEncoder(os.Stdout)
+			next := from
+			wait := watchRetryMin
+			for {
+				started := time.Now()
+				err := c.Changes(ctx, next, ns, func(ch client.Change) error {
+					next = ch.Seq + 1
+					return enc.Encode(ch)
+				})
+				var apiErr *client.APIError
+				switch {
+				case ctx.Err() != nil:
+					return nil
+				case errors.As(err, &apiErr) && apiErr.Status < http.StatusInternalServerError && apiErr.Status != http.StatusTooManyRequests:
+					return err
+				case !reconnect:
+					return err
+				}
+				if time.Since(started) > watchRetryMax {
+					wait = watchRetryMin
+				}
+				fmt.Fprintf(os.Stderr, "%v; resuming at change %d in %s\n", err, next, wait)
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(wait):
+				}
+				wait = min(2*wait, watchRetryMax)
+			}
+		},
+	}
+	cmd.Flags().Uint64Var(&from, "from", 0, "First change number to print (0 = the oldest retained)")
+	cmd.Flags().BoolVar(&reconnect, "reconnect", true, "Resume when the stream drops")
+	return cmd
+}
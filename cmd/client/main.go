@@ -3,56 +3,157 @@
 // Usage:
 //
 //	kvcli put mykey "hello world"      --server http://localhost:8080
+//	kvcli put mykey "v2" --if-match node1:3   (or --if-absent)
 //	kvcli get mykey                    --server http://localhost:8080
+//	kvcli get mykey --one              (one replica's copy: fast, may be stale)
+//	kvcli mget user:1 user:2 user:3
+//	kvcli put blob --file model.bin --type application/octet-stream   (then: kvcli get blob --out model.bin)
 //	kvcli delete mykey                 --server http://localhost:8080
+//	kvcli incr hits [5]
+//	kvcli inspect mykey --all-replicas
+//	kvcli versions mykey               (then: kvcli get mykey --clock node1:3)
+//	kvcli txn -f transfer.json
+//	kvcli lock acquire leader --ttl 15s --hold
 //	kvcli cluster nodes                --server http://localhost:8080
+//	kvcli cluster set-quorum --n 3 --w 2 --r 2
+//	kvcli cluster decommission node3
+//	kvcli cluster status
+//	kvcli cluster ring [--node node2]
+//	kvcli keys --namespace app1 --prefix user:
+//	kvcli keys --namespace app1 --prefix order: --field status --equals failed --since 24h
+//	kvcli watch user: [--replicas] [-o json]
+//	kvcli export --prefix user: --out users.ndjson [--resume]
+//	kvcli import --file users.ndjson --concurrency 8 [--resume]
+//	kvcli bench --writes 10000 --concurrency 64 --value-size 1kb [--mix put=20,get=80]
+//	kvcli repl                         --server http://localhost:8080
+//	kvcli namespace create app1 --max-keys 10000 [--versions 10]
+//	kvcli namespace create sessions --ttl 24h --read-policy nearest
+//	kvcli put session:9f2 token --ttl 30m
+//	kvcli acl set app1 config/=read app1/=readwrite
+//	kvcli acl list
+//	kvcli admin backup --out node1.kvbak
+//	kvcli admin backup --cluster [--out snap/] [--id <snapshot>]
+//	kvcli admin snapshots [delete <id>]
+//	kvcli admin restore --in node1.kvbak
+//	kvcli admin restore --snapshot snap/ [--map n1=a,n2=b,n3=b] [--dry-run]
+//	kvcli admin locate user:42
+//	kvcli admin hotkeys --limit 20
+//	kvcli admin repair user:42 | --prefix user:
+//	kvcli admin reload
+//	kvcli admin verify --data-dir /tmp/kvstore/node1
+//
+// Authentication: pass --token or set $KV_TOKEN.
 package main
 
 import (
+	"bufio"
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"distributed-kvstore/internal/client"
+	"distributed-kvstore/internal/store"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	serverAddr string
-	timeout    time.Duration
+	serverAddr = "http://localhost:8080"
+	timeout    = 10 * time.Second
+	token      = os.Getenv("KV_TOKEN")
+	tlsCA      string
+	namespace  = client.DefaultNamespace
+	compressed string
+	route      bool
+	retries    = 3
 )
 
 func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newRootCmd builds the command tree. The global flags default to the
+// current values of their variables: the repl builds a tree per line,
+// and the flags it was started with carry over.
+func newRootCmd() *cobra.Command {
 	root := &cobra.Command{
 		Use:   "kvcli",
 		Short: "CLI client for the distributed KV store",
 	}
 
 	root.PersistentFlags().StringVarP(&serverAddr, "server", "s",
-		"http://localhost:8080", "KV store server address")
-	root.PersistentFlags().DurationVar(&timeout, "timeout", 10*time.Second,
+		serverAddr, "KV store server address (comma-separate several for failover)")
+	root.PersistentFlags().DurationVar(&timeout, "timeout", timeout,
 		"HTTP request timeout")
+	root.PersistentFlags().StringVar(&token, "token", token,
+		"API token (defaults to $KV_TOKEN)")
+	root.PersistentFlags().StringVar(&tlsCA, "tls-ca", tlsCA,
+		"CA bundle used to verify an https:// server")
+	root.PersistentFlags().StringVarP(&namespace, "namespace", "n", namespace,
+		"Namespace to operate on")
+	root.PersistentFlags().StringVar(&compressed, "compress", compressed,
+		"HTTP compression codec: zstd, snappy or gzip (empty = off)")
+	root.PersistentFlags().BoolVar(&route, "route", route,
+		"Send key requests straight to the owning node (ring-aware routing)")
+	root.PersistentFlags().IntVar(&retries, "retries", retries,
+		"Tries per request on transient failures, across the servers (1 = no retries)")
 
-	root.AddCommand(putCmd(), getCmd(), deleteCmd(), clusterCmd())
-
-	if err := root.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
-	}
+	root.AddCommand(putCmd(), getCmd(), mgetCmd(), versionsCmd(), inspectCmd(), deleteCmd(), undeleteCmd(), counterCmd(1), counterCmd(-1), txnCmd(), lockCmd(), keysCmd(), watchCmd(), cdcCmd(), importCmd(), exportCmd(), benchCmd(), namespaceCmd(), aclCmd(), clusterCmd(), adminCmd(), replCmd())
+	return root
 }
 
 // ─── put ──────────────────────────────────────────────────────────────────────
 
 func putCmd() *cobra.Command {
-	return &cobra.Command{
-		Use:   "put <key> <value>",
+	var (
+		async       bool
+		contentType string
+		ifMatch     string
+		ifAbsent    bool
+		file        string
+		ttl         time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "put <key> <value> | put <key> --file <path>",
 		Short: "Store a key-value pair",
-		Args:  cobra.ExactArgs(2),
+		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c := client.New(serverAddr, timeout)
-			resp, err := c.Put(context.Background(), args[0], args[1])
+			if (file == "") == (len(args) == 1) {
+				return errors.New("give either a value or --file")
+			}
+			c := newClient()
+			ctx, err := conditionContext(replicationContext(cmd.Context(), async), ifMatch, ifAbsent)
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("ttl") {
+				ctx = client.WithTTL(ctx, ttl)
+			}
+			var resp *client.PutResponse
+			if file != "" {
+				resp, err = putFile(ctx, c, args[0], file, contentType)
+			} else {
+				resp, err = c.PutTyped(ctx, args[0], args[1], contentType)
+			}
 			if err != nil {
 				return err
 			}
@@ -60,18 +161,87 @@ func putCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&async, "async", false, "Acknowledge after the local write; replicate in the background")
+	cmd.Flags().StringVar(&contentType, "type", "", "Media type to store with the value, e.g. application/json")
+	cmd.Flags().StringVar(&ifMatch, "if-match", "", "Write only if the key is still at this clock, e.g. node1:3")
+	cmd.Flags().BoolVar(&ifAbsent, "if-absent", false, "Write only if the key does not exist")
+	cmd.Flags().StringVar(&file, "file", "", "Stream the value from this file (- = stdin) instead of an argument")
+	cmd.Flags().DurationVar(&ttl, "ttl", 0, "Expire the key after this long, e.g. 30m; 0 = never (default: the namespace's TTL)")
+	cmd.MarkFlagsMutuallyExclusive("if-match", "if-absent")
+	return cmd
+}
+
+// putFile streams the contents of path ("-" = stdin) into key.
+func putFile(ctx context.Context, c *client.Client, key, path, contentType string) (*client.PutResponse, error) {
+	if path == "-" {
+		return c.PutStream(ctx, key, os.Stdin, -1, contentType)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return c.PutStream(ctx, key, f, st.Size(), contentType)
+}
+
+// conditionContext returns ctx making the write conditional on the key
+// being at clock ifMatch, or absent.
+func conditionContext(ctx context.Context, ifMatch string, ifAbsent bool) (context.Context, error) {
+	switch {
+	case ifMatch != "":
+		vc, err := store.ParseClock(ifMatch)
+		if err != nil {
+			return nil, err
+		}
+		return client.IfMatch(ctx, vc), nil
+	case ifAbsent:
+		return client.IfAbsent(ctx), nil
+	}
+	return ctx, nil
+}
+
+// replicationContext returns ctx asking for async replication if async
+// is set, and for the namespace default otherwise.
+func replicationContext(ctx context.Context, async bool) context.Context {
+	if async {
+		return client.WithReplication(ctx, client.ReplicationAsync)
+	}
+	return ctx
 }
 
 // ─── get ──────────────────────────────────────────────────────────────────────
 
 func getCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		nearest bool
+		one     bool
+		clock   string
+		out     string
+	)
+	cmd := &cobra.Command{
 		Use:   "get <key>",
 		Short: "Retrieve a value by key",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c := client.New(serverAddr, timeout)
-			resp, err := c.Get(context.Background(), args[0])
+			c := newClient()
+			ctx := cmd.Context()
+			if nearest {
+				ctx = client.WithReadPolicy(ctx, client.ReadNearest)
+			}
+			if one {
+				ctx = client.WithReadPolicy(ctx, client.ReadOne)
+			}
+			if clock != "" {
+				return getVersion(ctx, c, args[0], clock)
+			}
+			if out != "" {
+				return getFile(ctx, c, args[0], out)
+			}
+			resp, err := c.Get(ctx, args[0])
 			if err == client.ErrNotFound {
 				fmt.Printf("key %q not found\n", args[0])
 				return nil
@@ -83,50 +253,593 @@ func getCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&nearest, "nearest", false, "Read from the R closest replicas instead of all of them")
+	cmd.Flags().BoolVar(&one, "one", false, "Read a single replica's copy (fast, may be stale)")
+	cmd.Flags().StringVar(&clock, "clock", "", "Read an older version, e.g. node1:3,node2:1 (see kvcli versions)")
+	cmd.Flags().StringVar(&out, "out", "", "Stream the raw value to this file (- = stdout)")
+	cmd.MarkFlagsMutuallyExclusive("clock", "out")
+	cmd.MarkFlagsMutuallyExclusive("nearest", "one")
+	return cmd
+}
+
+// getFile streams key's raw value into path ("-" = stdout).
+func getFile(ctx context.Context, c *client.Client, key, path string) error {
+	body, _, err := c.GetStream(ctx, key)
+	if err == client.ErrNotFound {
+		fmt.Fprintf(os.Stderr, "key %q not found\n", key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if path == "-" {
+		_, err = io.Copy(os.Stdout, body)
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, body)
+	return errors.Join(err, f.Close())
+}
+
+// getVersion prints the version of key with clock ("node1:3,node2:1").
+func getVersion(ctx context.Context, c *client.Client, key, clock string) error {
+	vc, err := store.ParseClock(clock)
+	if err != nil {
+		return err
+	}
+	v, err := c.GetVersion(ctx, key, vc)
+	if err == client.ErrNotFound {
+		fmt.Printf("no replica of %q still has version %s\n", key, clock)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	prettyPrint(v)
+	return nil
+}
+
+// ─── mget ─────────────────────────────────────────────────────────────────────
+
+func mgetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "mget <key>...",
+		Short: "Read many keys in one request",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := newClient().MultiGet(cmd.Context(), args...)
+			if err != nil {
+				return err
+			}
+			failures := 0
+			for _, r := range results {
+				switch {
+				case r.Err == client.ErrNotFound:
+					fmt.Printf("%s\t(not found)\n", r.Key)
+				case r.Err != nil:
+					fmt.Printf("%s\t(error: %v)\n", r.Key, r.Err)
+					failures++
+				default:
+					fmt.Printf("%s\t%s\n", r.Key, r.Value)
+				}
+			}
+			if failures > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d key(s) could not be read", failures)
+			}
+			return nil
+		},
+	}
+}
+
+// ─── inspect ──────────────────────────────────────────────────────────────────
+
+func inspectCmd() *cobra.Command {
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "inspect <key>",
+		Short: "Show a key's stored metadata: clock, tombstone, updated-at",
+		Long: "Shows the version a read would return. With --all-replicas, every\n" +
+			"replica's copy side by side, to debug divergence. Nothing is repaired.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			meta, err := newClient().KeyMeta(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if !all {
+				for _, r := range meta.Replicas {
+					if r.Relation == "winner" {
+						printStored(r.Value)
+						return nil
+					}
+				}
+				fmt.Printf("key %q not found\n", args[0])
+				return nil
+			}
+
+			fmt.Printf("%-8s %-20s %-8s %-11s %-11s %-8s %-30s %s\n",
+				"NODE", "ADDRESS", "ROLE", "STATUS", "RELATION", "SIZE", "UPDATED", "CLOCK")
+			for _, r := range meta.Replicas {
+				role := "replica"
+				if r.Primary {
+					role = "primary"
+				}
+				size, updated, clock := "-", "-", r.Error
+				if v := r.Value; v != nil {
+					size = formatBytes(int64(len(v.Data) + len(v.Compressed)))
+					updated = v.UpdatedAt.Format(time.RFC3339Nano)
+					clock = fmt.Sprint(v.Clock)
+				}
+				fmt.Printf("%-8s %-20s %-8s %-11s %-11s %-8s %-30s %s\n",
+					r.ID, r.Address, role, r.Status, r.Relation, size, updated, clock)
+			}
+			if meta.Divergent {
+				fmt.Println("\nreplicas diverge: reading the key repairs behind/concurrent/missing copies;")
+				fmt.Println("a conflict (same clock, different value) needs a new write")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&all, "all-replicas", false, "Show every replica's copy side by side")
+	return cmd
+}
+
+// printStored prints a stored value's metadata.
+func printStored(v *client.StoredValue) {
+	fmt.Printf("clock:      %v\n", v.Clock)
+	fmt.Printf("tombstone:  %v\n", v.Tombstone)
+	fmt.Printf("updated_at: %s\n", v.UpdatedAt.Format(time.RFC3339Nano))
+	if v.ContentType != "" {
+		fmt.Printf("type:       %s\n", v.ContentType)
+	}
+	if v.Encoding != "" {
+		fmt.Printf("encoding:   %s (%s compressed)\n", v.Encoding, formatBytes(int64(len(v.Compressed))))
+	} else {
+		fmt.Printf("size:       %s\n", formatBytes(int64(len(v.Data))))
+	}
 }
 
 // ─── delete ───────────────────────────────────────────────────────────────────
 
 func deleteCmd() *cobra.Command {
-	return &cobra.Command{
+	var (
+		async   bool
+		ifMatch string
+	)
+	cmd := &cobra.Command{
 		Use:   "delete <key>",
 		Short: "Delete a key",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c := client.New(serverAddr, timeout)
-			if err := c.Delete(context.Background(), args[0]); err != nil {
+			c := newClient()
+			ctx, err := conditionContext(replicationContext(cmd.Context(), async), ifMatch, false)
+			if err != nil {
+				return err
+			}
+			if err := c.Delete(ctx, args[0]); err != nil {
 				return err
 			}
 			fmt.Printf("deleted %q\n", args[0])
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&async, "async", false, "Acknowledge after the local delete; replicate in the background")
+	cmd.Flags().StringVar(&ifMatch, "if-match", "", "Delete only if the key is still at this clock, e.g. node1:3")
+	return cmd
 }
 
-// ─── cluster ──────────────────────────────────────────────────────────────────
+// ─── incr / decr ──────────────────────────────────────────────────────────────
 
-func clusterCmd() *cobra.Command {
+// counterCmd builds incr (sign 1) or decr (sign -1).
+func counterCmd(sign int64) *cobra.Command {
+	use, short := "incr", "Atomically add to a counter"
+	if sign < 0 {
+		use, short = "decr", "Atomically subtract from a counter"
+	}
+	return &cobra.Command{
+		Use:   use + " <key> [by]",
+		Short: short,
+		Long: short + " (default 1) and print the new count. A missing key\n" +
+			"counts from 0. Concurrent calls are never lost, unlike get + put.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			by := int64(1)
+			if len(args) == 2 {
+				var err error
+				if by, err = strconv.ParseInt(args[1], 10, 64); err != nil || by < 1 {
+					return fmt.Errorf("by must be a positive integer, got %q", args[1])
+				}
+			}
+			c := newClient()
+			count := c.Incr
+			if sign < 0 {
+				count = c.Decr
+			}
+			resp, err := count(cmd.Context(), args[0], by)
+			if err != nil {
+				return err
+			}
+			fmt.Println(resp.Count)
+			return nil
+		},
+	}
+}
+
+// ─── txn ──────────────────────────────────────────────────────────────────────
+
+func txnCmd() *cobra.Command {
+	var file string
 	cmd := &cobra.Command{
-		Use:   "cluster",
-		Short: "Cluster management commands",
+		Use:   "txn -f <file|->",
+		Short: "Run checks and writes on several keys atomically",
+		Long: "Reads a transaction as JSON:\n\n" +
+			`  {"checks": [{"key": "alice", "value": "100"}, {"key": "bob", "exists": true}],` + "\n" +
+			`   "ops":    [{"op": "put", "key": "alice", "value": "70"}, {"op": "put", "key": "bob", "value": "30"}]}` + "\n\n" +
+			"The ops are written together if every check holds. Keys on different\n" +
+			"replicas need all of those replicas up. Exits non-zero if a check failed.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := os.Stdin
+			if file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			var t client.Txn
+			if err := json.NewDecoder(in).Decode(&t); err != nil {
+				return fmt.Errorf("parse transaction: %w", err)
+			}
+			res, err := newClient().Txn(cmd.Context(), t)
+			if err != nil {
+				return err
+			}
+			prettyPrint(res)
+			if !res.Committed {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("not committed: checks %v failed", res.FailedChecks)
+			}
+			return nil
+		},
 	}
+	cmd.Flags().StringVarP(&file, "file", "f", "-", "Transaction JSON file (- = stdin)")
+	return cmd
+}
+
+// ─── lock ─────────────────────────────────────────────────────────────────────
 
-	// cluster nodes
-	cmd.AddCommand(&cobra.Command{
-		Use:   "nodes",
-		Short: "List all cluster nodes",
+func lockCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Distributed lock (lease) commands",
+	}
+
+	var holder string
+	var ttl time.Duration
+	var leaseToken uint64
+	host, _ := os.Hostname()
+	defaultHolder := fmt.Sprintf("%s-%d", host, os.Getpid())
+
+	var hold bool
+	acquireCmd := &cobra.Command{
+		Use:   "acquire <name>",
+		Short: "Take a lock; prints the lease with its fencing token",
+		Long: "Takes the lock for --ttl. With --hold, keeps renewing it until\n" +
+			"interrupted, then releases it; exits non-zero if the lock is lost.",
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c := client.New(serverAddr, timeout)
-			ctx := context.Background()
-			// Simple GET to /cluster/nodes
-			resp, err := c.GetRaw(ctx, "/cluster/nodes")
+			c := newClient()
+			lease, err := c.AcquireLock(cmd.Context(), args[0], holder, ttl)
 			if err != nil {
+				return lockFailed(cmd, err)
+			}
+			prettyPrint(lease)
+			if !hold {
+				return nil
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if err := c.KeepLock(ctx, lease, ttl); !errors.Is(err, context.Canceled) {
+				cmd.SilenceUsage = true
 				return err
 			}
-			fmt.Println(resp)
+			return c.ReleaseLock(cmd.Context(), lease)
+		},
+	}
+	acquireCmd.Flags().BoolVar(&hold, "hold", false, "Keep renewing until interrupted, then release")
+
+	renewCmd := &cobra.Command{
+		Use:   "renew <name> --token <n>",
+		Short: "Extend a lease you hold",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lease, err := newClient().RenewLock(cmd.Context(),
+				&client.Lease{Name: args[0], Holder: holder, Token: leaseToken}, ttl)
+			if err != nil {
+				return lockFailed(cmd, err)
+			}
+			prettyPrint(lease)
 			return nil
 		},
-	})
+	}
+
+	releaseCmd := &cobra.Command{
+		Use:   "release <name> --token <n>",
+		Short: "Release a lease you hold",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := newClient().ReleaseLock(cmd.Context(),
+				&client.Lease{Name: args[0], Holder: holder, Token: leaseToken})
+			return lockFailed(cmd, err)
+		},
+	}
+
+	getCmd := &cobra.Command{
+		Use:   "get <name>",
+		Short: "Show who holds a lock",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lease, err := newClient().GetLock(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			prettyPrint(lease)
+			return nil
+		},
+	}
+
+	for _, sub := range []*cobra.Command{acquireCmd, renewCmd, releaseCmd} {
+		sub.Flags().StringVar(&holder, "holder", defaultHolder, "Holder identity")
+	}
+	for _, sub := range []*cobra.Command{acquireCmd, renewCmd} {
+		sub.Flags().DurationVar(&ttl, "ttl", 15*time.Second, "Lease duration")
+	}
+	for _, sub := range []*cobra.Command{renewCmd, releaseCmd} {
+		sub.Flags().Uint64Var(&leaseToken, "token", 0, "Fencing token returned by acquire")
+		_ = sub.MarkFlagRequired("token")
+	}
+	cmd.AddCommand(acquireCmd, renewCmd, releaseCmd, getCmd)
+	return cmd
+}
+
+// lockFailed returns err, without the usage text if the server refused
+// the lock operation: the command was right, the lock was not free.
+func lockFailed(cmd *cobra.Command, err error) error {
+	var lockErr *client.LockError
+	if errors.As(err, &lockErr) {
+		cmd.SilenceUsage = true
+	}
+	return err
+}
+
+// ─── keys ─────────────────────────────────────────────────────────────────────
+
+func keysCmd() *cobra.Command {
+	var (
+		prefix, since string
+		filter        client.KeyFilter
+	)
+	cmd := &cobra.Command{
+		Use:   "keys [--prefix <p>] [--contains <s>] [--field <path> [--equals <v>]] [--since <time>]",
+		Short: "List the keys in the namespace, in order",
+		Long: "Streams the namespace's live keys from the server in sorted order,\n" +
+			"so even a very large namespace is listed without being buffered.\n" +
+			"The filter flags are checked on the servers: only matching keys are sent.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if since != "" {
+				t, err := parseSince(since)
+				if err != nil {
+					return fmt.Errorf("--since: %w", err)
+				}
+				filter.UpdatedAfter = t
+			}
+			w := bufio.NewWriter(os.Stdout)
+			defer w.Flush()
+			return newClient().ScanKeysWhere(cmd.Context(), prefix, filter, func(k string) error {
+				_, err := fmt.Fprintln(w, k)
+				return err
+			})
+		},
+	}
+	cmd.Flags().StringVar(&prefix, "prefix", "", "Only keys starting with this prefix")
+	cmd.Flags().StringVar(&filter.Contains, "contains", "", "Only keys whose value contains this")
+	cmd.Flags().StringVar(&filter.Field, "field", "", "Only keys whose value is JSON with this dotted path, e.g. user.plan")
+	cmd.Flags().StringVar(&filter.Equals, "equals", "", "With --field: only where it equals this (strings unquoted, others as JSON)")
+	cmd.Flags().StringVar(&since, "since", "", "Only keys written after this: an RFC 3339 time or a duration ago, e.g. 1h")
+	return cmd
+}
+
+// parseSince reads an RFC 3339 time, or a duration before now.
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", s)
+	}
+	return t, nil
+}
+
+// ─── namespace ────────────────────────────────────────────────────────────────
+
+func namespaceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "namespace",
+		Aliases: []string{"ns"},
+		Short:   "Namespace management commands",
+	}
+
+	var (
+		cfg      client.NamespaceConfig
+		maxBytes string
+		ttl      time.Duration
+	)
+	createCmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create a namespace (or update its config)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			n, err := store.ParseMemorySize(maxBytes)
+			if err != nil {
+				return fmt.Errorf("--max-bytes: %w", err)
+			}
+			cfg.MaxBytes = n
+			if ttl%time.Second != 0 {
+				return fmt.Errorf("--ttl: %s is not a whole number of seconds", ttl)
+			}
+			cfg.TTLSeconds = int64(ttl / time.Second)
+			return newClient().CreateNamespace(cmd.Context(), args[0], cfg)
+		},
+	}
+	createCmd.Flags().IntVar(&cfg.MaxKeys, "max-keys", 0, "Maximum number of keys per node (0 = unlimited)")
+	createCmd.Flags().StringVar(&maxBytes, "max-bytes", "0", "Maximum data per node, e.g. 1GiB (0 = unlimited)")
+	createCmd.Flags().Float64Var(&cfg.RateLimit, "rate-limit", 0, "Requests/sec each node serves for the namespace (0 = unlimited)")
+	createCmd.Flags().StringVar(&cfg.Compression, "compression", "",
+		"Value compression: zstd, snappy, none (empty = node default)")
+	createCmd.Flags().StringVar(&cfg.Replication, "replication", "",
+		"Default write mode: sync or async (empty = sync)")
+	createCmd.Flags().IntVar(&cfg.Versions, "versions", 0, "Replaced values to keep per key, for kvcli versions (0 = none)")
+	createCmd.Flags().DurationVar(&ttl, "ttl", 0, "Default TTL of written keys, e.g. 24h (0 = keys never expire)")
+	createCmd.Flags().StringVar(&cfg.ReadPolicy, "read-policy", "", "Default read policy: ring, nearest or one (empty = node default)")
+	createCmd.Flags().StringVar(&cfg.Tiebreak, "tiebreak", "", "Concurrent writes: time or node-id (empty = node default)")
+	createCmd.Flags().StringVar(&cfg.DeleteConflicts, "delete-conflicts", "",
+		"Deletes racing writes: tiebreak, delete-wins or write-wins (empty = node default)")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List namespaces",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := newClient().ListNamespaces(cmd.Context())
+			if err != nil {
+				return err
+			}
+			prettyPrint(list)
+			return nil
+		},
+	}
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete an empty namespace",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return newClient().DeleteNamespace(cmd.Context(), args[0])
+		},
+	}
+
+	cmd.AddCommand(createCmd, listCmd, deleteCmd)
+	return cmd
+}
+
+// ─── acl ──────────────────────────────────────────────────────────────────────
+
+func aclCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "acl",
+		Short: "Per-token key prefix rules",
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Show every token's rules",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			acls, err := newClient().ListACLs(cmd.Context())
+			if err != nil {
+				return err
+			}
+			for _, token := range slices.Sorted(maps.Keys(acls.Tokens)) {
+				fmt.Printf("%s:", token)
+				for _, r := range acls.Tokens[token] {
+					fmt.Printf(" %s=%s", r.Prefix, r.Access)
+				}
+				fmt.Println()
+			}
+			fmt.Printf("(version %d)\n", acls.Version)
+			return nil
+		},
+	}
+
+	getCmd := &cobra.Command{
+		Use:   "get <token>",
+		Short: "Show one token's rules",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			acl, err := newClient().GetACL(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			prettyPrint(acl)
+			return nil
+		},
+	}
+
+	setCmd := &cobra.Command{
+		Use:   "set <token> <prefix>=read|readwrite...",
+		Short: "Replace a token's rules on the whole cluster",
+		Long: "Replace a token's rules on the whole cluster. Prefixes are on\n" +
+			"\"<namespace>/<key>\": config/=read app1/=readwrite lets the token read\n" +
+			"namespace config, read and write namespace app1, and nothing else.",
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rules := make([]client.ACLRule, 0, len(args)-1)
+			for _, arg := range args[1:] {
+				prefix, access, ok := strings.Cut(arg, "=")
+				if !ok {
+					return fmt.Errorf("rule %q: want <prefix>=read|readwrite", arg)
+				}
+				rules = append(rules, client.ACLRule{Prefix: prefix, Access: access})
+			}
+			acl, err := newClient().SetACL(cmd.Context(), args[0], rules)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("rules for %s set (version %d)\n", acl.Token, acl.Version)
+			if acl.Warning != "" {
+				fmt.Fprintln(os.Stderr, "warning:", acl.Warning)
+			}
+			return nil
+		},
+	}
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete <token>",
+		Short: "Remove a token's rules (it is no longer restricted)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			acl, err := newClient().DeleteACL(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("rules for %s removed (version %d)\n", acl.Token, acl.Version)
+			if acl.Warning != "" {
+				fmt.Fprintln(os.Stderr, "warning:", acl.Warning)
+			}
+			return nil
+		},
+	}
+
+	cmd.AddCommand(listCmd, getCmd, setCmd, deleteCmd)
+	return cmd
+}
+
+// ─── cluster ──────────────────────────────────────────────────────────────────
+
+func clusterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Cluster management commands",
+	}
 
 	// cluster join
 	joinCmd := &cobra.Command{
@@ -134,28 +847,778 @@ func clusterCmd() *cobra.Command {
 		Short: "Join a node to the cluster",
 		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c := client.New(serverAddr, timeout)
-			return c.JoinCluster(context.Background(), args[0], args[1])
+			c := newClient()
+			return c.JoinCluster(cmd.Context(), args[0], args[1])
 		},
 	}
 
 	// cluster leave
 	leaveCmd := &cobra.Command{
 		Use:   "leave <nodeID>",
-		Short: "Remove a node from the cluster",
+		Short: "Remove a node from the cluster at once (data only it holds is lost; see decommission)",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			c := client.New(serverAddr, timeout)
-			return c.LeaveCluster(context.Background(), args[0])
+			c := newClient()
+			return c.LeaveCluster(cmd.Context(), args[0])
+		},
+	}
+
+	// cluster decommission
+	var pollEvery time.Duration
+	decommissionCmd := &cobra.Command{
+		Use:   "decommission <nodeID>",
+		Short: "Move a node's data to the new owners, then remove it from the cluster",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c := newClient()
+			ctx := cmd.Context()
+			id := args[0]
+			st, err := c.Decommission(ctx, id)
+			if err != nil {
+				return err
+			}
+			last := ""
+			for {
+				line := fmt.Sprintf("%s: %s", id, st.State)
+				if st.State != client.DecommissionDraining {
+					line += fmt.Sprintf(" (%d keys, %d sent, %d failed)", st.Keys, st.Sent, st.Failed)
+				}
+				if line != last {
+					fmt.Println(line)
+					last = line
+				}
+				switch st.State {
+				case client.DecommissionLeft:
+					fmt.Printf("%s has left the ring and can be stopped\n", id)
+					return nil
+				case client.DecommissionFailed:
+					return fmt.Errorf("decommission failed: %s (run again to resume)", st.Error)
+				}
+
+				time.Sleep(pollEvery)
+				st, err = c.DecommissionProgress(ctx, id)
+				var apiErr *client.APIError
+				if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+					// The member we ask has applied the leave already.
+					fmt.Printf("%s has left the ring and can be stopped\n", id)
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+		},
+	}
+	decommissionCmd.Flags().DurationVar(&pollEvery, "poll", time.Second, "How often to check progress")
+
+	// cluster quorum
+	quorumCmd := &cobra.Command{
+		Use:   "quorum",
+		Short: "Show N/W/R and re-replication progress",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			st, err := newClient().Quorum(cmd.Context())
+			if err != nil {
+				return err
+			}
+			prettyPrint(st)
+			return nil
+		},
+	}
+
+	// cluster set-quorum
+	var qn, qw, qr int
+	setQuorumCmd := &cobra.Command{
+		Use:   "set-quorum",
+		Short: "Change N/W/R on the whole cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ch, err := newClient().SetQuorum(cmd.Context(), qn, qw, qr)
+			if err != nil {
+				return err
+			}
+			q := ch.Quorum
+			fmt.Printf("quorum set to N=%d W=%d R=%d (version %d)\n", q.N, q.W, q.R, q.Version)
+			if ch.Warning != "" {
+				fmt.Fprintln(os.Stderr, "warning:", ch.Warning)
+			}
+			return nil
+		},
+	}
+	setQuorumCmd.Flags().IntVar(&qn, "n", 0, "Replication factor (N)")
+	setQuorumCmd.Flags().IntVar(&qw, "w", 0, "Write quorum (W)")
+	setQuorumCmd.Flags().IntVar(&qr, "r", 0, "Read quorum (R)")
+	for _, f := range []string{"n", "w", "r"} {
+		setQuorumCmd.MarkFlagRequired(f)
+	}
+
+	cmd.AddCommand(clusterNodesCmd(), clusterStatusCmd(), clusterRingCmd(), joinCmd, leaveCmd, decommissionCmd, quorumCmd, setQuorumCmd)
+	return cmd
+}
+
+// ─── admin ────────────────────────────────────────────────────────────────────
+
+func adminCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "admin",
+		Short: "Operator commands (admin scope)",
+	}
+
+	// admin backup
+	var out, snapshotID string
+	var wholeCluster, merged bool
+	var snapshotPoll time.Duration
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Download a backup archive",
+		Long: "Without --cluster, downloads the node's data as one archive (--out).\n\n" +
+			"--cluster takes a cluster snapshot — every node copies its data at about\n" +
+			"the same moment — waits for it, and downloads its manifest and each\n" +
+			"node's archive into the --out directory (default cluster-<id>).\n" +
+			"--id downloads an existing snapshot instead. --merged instead collects\n" +
+			"the nodes one after the other into one archive, as older servers do.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if wholeCluster && !merged {
+				dir := ""
+				if cmd.Flags().Changed("out") {
+					dir = out
+				}
+				return downloadClusterSnapshot(cmd, newClient(), snapshotID, dir, snapshotPoll)
+			}
+			f, err := os.Create(out)
+			if err != nil {
+				return err
+			}
+			if err := newClient().Backup(cmd.Context(), f, wholeCluster); err != nil {
+				f.Close()
+				os.Remove(out) // never leave a partial archive behind
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+			fmt.Printf("backup written to %s\n", out)
+			return nil
+		},
+	}
+	backupCmd.Flags().StringVar(&out, "out", "backup.kvbak", "Output file (with --cluster: directory)")
+	backupCmd.Flags().BoolVar(&wholeCluster, "cluster", false, "Back up the whole cluster, not just this node")
+	backupCmd.Flags().BoolVar(&merged, "merged", false, "With --cluster: one archive, read node by node")
+	backupCmd.Flags().StringVar(&snapshotID, "id", "", "With --cluster: download this snapshot rather than take one")
+	backupCmd.Flags().DurationVar(&snapshotPoll, "poll", time.Second, "With --cluster: how often to check the snapshot")
+
+	// admin snapshots
+	snapshotsCmd := &cobra.Command{
+		Use:   "snapshots",
+		Short: "List the cluster snapshots",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			list, err := newClient().ClusterSnapshots(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if len(list) == 0 {
+				fmt.Println("(no cluster snapshots)")
+			}
+			for _, m := range list {
+				var records int
+				var bytes int64
+				for _, p := range m.Parts {
+					records += p.Records
+					bytes += p.Bytes
+				}
+				fmt.Printf("%-24s %-8s %s  %d nodes, %d records, %d bytes, cut spread %s\n",
+					m.ID, m.State, m.Started.Local().Format(time.DateTime), len(m.Parts), records, bytes, cmp.Or(m.CutSpread, "-"))
+			}
+			return nil
+		},
+	}
+	snapshotsCmd.AddCommand(&cobra.Command{
+		Use:   "delete <id>",
+		Short: "Delete a cluster snapshot on every node",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			warning, err := newClient().DeleteClusterSnapshot(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("deleted %s\n", args[0])
+			if warning != "" {
+				fmt.Printf("warning: %s\n", warning)
+			}
+			return nil
+		},
+	})
+
+	// admin restore
+	var in, snapshotDir string
+	var nodeMap map[string]string
+	var dryRun bool
+	restoreCmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore a backup archive into the cluster",
+		Long: "Restores one archive (--in), or every part of a cluster snapshot\n" +
+			"downloaded with backup --cluster (--snapshot). Keys go to their owners\n" +
+			"under the cluster's current ring, whatever its size.\n\n" +
+			"--map old=new,… renames the snapshot's nodes in the restored clocks,\n" +
+			"e.g. onto new hardware. With --snapshot, old nodes that are not members\n" +
+			"of the cluster and not in --map are mapped in turn onto its nodes.\n" +
+			"Restore before the cluster takes writes.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if snapshotDir != "" {
+				if cmd.Flags().Changed("in") {
+					return errors.New("give --in or --snapshot, not both")
+				}
+				return restoreClusterSnapshot(cmd, newClient(), snapshotDir, nodeMap, dryRun)
+			}
+			if dryRun {
+				return errors.New("--dry-run needs --snapshot")
+			}
+			f, err := os.Open(in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			stats, err := newClient().Restore(cmd.Context(), f, nodeMap)
+			if err != nil {
+				return err
+			}
+			prettyPrint(stats)
+			return nil
+		},
+	}
+	restoreCmd.Flags().StringVar(&in, "in", "backup.kvbak", "Input file")
+	restoreCmd.Flags().StringVar(&snapshotDir, "snapshot", "", "Cluster snapshot directory (with manifest.json)")
+	restoreCmd.Flags().StringToStringVar(&nodeMap, "map", nil, "Old node ID = new node ID, comma-separated")
+	restoreCmd.Flags().BoolVar(&dryRun, "dry-run", false, "With --snapshot: check the parts and print the mapping only")
+
+	// admin locate
+	locateCmd := &cobra.Command{
+		Use:   "locate <key>",
+		Short: "Show which replicas own a key and what each holds",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			loc, err := newClient().Locate(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("key %s  token %d  range (%d, %d]\n", loc.Key, loc.Token, loc.Range.Start, loc.Range.End)
+			for _, r := range loc.Replicas {
+				role := "replica"
+				if r.Primary {
+					role = "primary"
+				}
+				fmt.Printf("  %-8s %-20s %-8s %-12s %v\n", r.ID, r.Address, role, r.Status, r.Clock)
+			}
+			return nil
+		},
+	}
+
+	// admin hotkeys
+	var hotLimit int
+	hotKeysCmd := &cobra.Command{
+		Use:   "hotkeys",
+		Short: "Show each node's most used keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hk, err := newClient().HotKeys(cmd.Context(), hotLimit)
+			if err != nil {
+				return err
+			}
+			for _, n := range hk.Nodes {
+				fmt.Printf("%s\n", n.Node)
+				if len(n.Keys) == 0 {
+					fmt.Println("  (no traffic)")
+				}
+				for _, k := range n.Keys {
+					fmt.Printf("  %-10s %-32s %8d  reads %-8d writes %d\n", k.Namespace, k.Key, k.Count, k.Reads, k.Writes)
+				}
+			}
+			for _, id := range hk.Unreachable {
+				fmt.Printf("%s\n  (unreachable)\n", id)
+			}
+			return nil
+		},
+	}
+	hotKeysCmd.Flags().IntVar(&hotLimit, "limit", 10, "Keys per node")
+
+	// admin reload
+	reloadCmd := &cobra.Command{
+		Use:   "reload",
+		Short: "Re-read the server's config file (log level, rate limits, timeouts, TLS cert)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			res, err := newClient().Reload(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if len(res.Reloaded) == 0 {
+				fmt.Printf("%s: nothing changed\n", res.Node)
+				return nil
+			}
+			fmt.Printf("%s: reloaded %s\n", res.Node, strings.Join(res.Reloaded, ", "))
+			return nil
+		},
+	}
+
+	// admin repair
+	var (
+		prefix          string
+		repairAll, wait bool
+		repairStatus    bool
+		repairNode      string
+		repairPoll      time.Duration
+	)
+	repairCmd := &cobra.Command{
+		Use:   "repair [<key>] [--prefix <p>] [--all [--wait]] [--status]",
+		Short: "Reconcile keys across their replicas and write the winner back, now",
+		Long: "Reads each key from all N replicas and writes the winning version to\n" +
+			"every replica that lacks it, waiting for them. --prefix repairs every\n" +
+			"live key of the namespace that starts with the prefix.\n\n" +
+			"--all starts a full repair in the background on one node (--node):\n" +
+			"it compares digests of every token range across its replicas, in\n" +
+			"every namespace, and repairs the keys that differ. --wait follows its\n" +
+			"progress; --status shows the last one.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			modes := 0
+			for _, on := range []bool{len(args) == 1, cmd.Flags().Changed("prefix"), repairAll, repairStatus} {
+				if on {
+					modes++
+				}
+			}
+			if modes != 1 {
+				return errors.New("give one of a key, --prefix, --all or --status")
+			}
+			c, ctx := newClient(), cmd.Context()
+			if repairAll || repairStatus {
+				return runRepairJob(cmd, c, repairNode, repairAll, wait, repairPoll)
+			}
+			keys := args
+			if len(args) == 0 {
+				all, err := c.Keys(ctx)
+				if err != nil {
+					return err
+				}
+				keys = nil
+				for _, k := range all {
+					if strings.HasPrefix(k, prefix) {
+						keys = append(keys, k)
+					}
+				}
+			}
+
+			repaired, failed := 0, 0
+			for _, k := range keys {
+				r, err := c.RepairKey(ctx, k)
+				if err != nil {
+					return err
+				}
+				switch {
+				case r.Clock == nil:
+					fmt.Printf("%s: not found on any replica\n", k)
+				case len(r.Repaired) == 0 && len(r.Failed) == 0:
+					fmt.Printf("%s: in sync %v\n", k, r.InSync)
+				default:
+					repaired++
+					note := ""
+					if r.Bumped {
+						note = " (same-clock conflict: written as a new version)"
+					}
+					fmt.Printf("%s: repaired %v, in sync %v%s\n", k, r.Repaired, r.InSync, note)
+				}
+				for id, msg := range r.Failed {
+					failed++
+					fmt.Printf("  %s failed: %s\n", id, msg)
+				}
+			}
+			if len(keys) > 1 {
+				fmt.Printf("\n%d keys checked, %d repaired, %d replica failures\n", len(keys), repaired, failed)
+			}
+			if failed > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d replica(s) could not be repaired (they were hinted)", failed)
+			}
+			return nil
+		},
+	}
+	repairCmd.Flags().StringVar(&prefix, "prefix", "", "Repair every live key starting with this prefix")
+	repairCmd.Flags().BoolVar(&repairAll, "all", false, "Start a full repair of every token range")
+	repairCmd.Flags().BoolVar(&wait, "wait", false, "With --all or --status: follow the repair until it ends")
+	repairCmd.Flags().BoolVar(&repairStatus, "status", false, "Show the last full repair")
+	repairCmd.Flags().StringVar(&repairNode, "node", "", "Node that runs the full repair (default: any)")
+	repairCmd.Flags().DurationVar(&repairPoll, "poll", time.Second, "With --wait: how often to check progress")
+
+	// admin verify
+	var dataDir string
+	var asJSON bool
+	verifyCmd := &cobra.Command{
+		Use:   "verify --data-dir <dir>",
+		Short: "Check a stopped node's WAL and snapshots for corruption (offline)",
+		Long: "Reads a node's data directory (the one holding wal.log) without changing it:\n" +
+			"WAL framing and checksums, snapshot decoding, and a full replay.\n" +
+			"Exits non-zero if anything is wrong. Stop the node first.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			report, err := store.Verify(dataDir)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				prettyPrint(report)
+			} else {
+				for _, f := range report.Files {
+					note := ""
+					if f.Ignored {
+						note = "  (older than the base, not loaded)"
+					}
+					fmt.Printf("%-28s %-10s %8d records%s\n", f.File, f.Kind, f.Records, note)
+				}
+				fmt.Printf("\nreplayed state: %d keys, %d tombstones", report.Keys, report.Tombstones)
+				if report.Unchecked > 0 {
+					fmt.Printf(" (%d WAL entries predate checksums)", report.Unchecked)
+				}
+				fmt.Println()
+				for _, p := range report.Problems {
+					fmt.Println("  " + p.String())
+				}
+			}
+			if !report.OK() {
+				cmd.SilenceUsage = true // the report says what is wrong
+				return fmt.Errorf("%d problem(s) found", len(report.Problems))
+			}
+			if !asJSON {
+				fmt.Println("OK")
+			}
+			return nil
 		},
 	}
+	verifyCmd.Flags().StringVar(&dataDir, "data-dir", "", "Node data directory (--data-dir/<node-id> of the server)")
+	verifyCmd.Flags().BoolVar(&asJSON, "json", false, "Print the report as JSON")
+	verifyCmd.MarkFlagRequired("data-dir")
 
-	cmd.AddCommand(joinCmd, leaveCmd)
+	cmd.AddCommand(backupCmd, snapshotsCmd, restoreCmd, locateCmd, hotKeysCmd, repairCmd, reloadCmd, verifyCmd)
 	return cmd
 }
 
+// runRepairJob starts (or, if !start, looks up) the full repair on
+// nodeID and prints its progress, following it to the end if wait.
+func runRepairJob(cmd *cobra.Command, c *client.Client, nodeID string, start, wait bool, poll time.Duration) error {
+	ctx := cmd.Context()
+	var (
+		st  *client.RepairStatus
+		err error
+	)
+	if start {
+		st, err = c.StartRepair(ctx, nodeID)
+	} else {
+		st, err = c.RepairProgress(ctx, nodeID)
+	}
+	if err != nil {
+		return err
+	}
+	if st.State == "" {
+		fmt.Printf("%s: no full repair has run\n", st.Node)
+		return nil
+	}
+
+	last := ""
+	for {
+		line := fmt.Sprintf("%s on %s: %s, ranges %d/%d, %d keys scanned, %d repaired, %d failed",
+			st.ID, st.Node, st.State, st.RangesDone, st.Ranges, st.Scanned, st.Repaired, st.Failed)
+		if len(st.Unreachable) > 0 {
+			line += fmt.Sprintf(" (unreachable: %s)", strings.Join(st.Unreachable, ", "))
+		}
+		if line != last {
+			fmt.Println(line)
+			last = line
+		}
+		if st.State != client.RepairRunning {
+			break
+		}
+		if !wait {
+			fmt.Printf("follow it with: kvcli admin repair --status --wait --node %s\n", st.Node)
+			return nil
+		}
+		time.Sleep(poll)
+		if st, err = c.RepairProgress(ctx, st.Node); err != nil {
+			return err
+		}
+	}
+
+	cmd.SilenceUsage = true
+	switch {
+	case st.State == client.RepairFailed:
+		return fmt.Errorf("repair failed: %s", st.Error)
+	case st.Failed > 0:
+		return fmt.Errorf("%d key(s) could not be repaired or verified", st.Failed)
+	}
+	return nil
+}
+
+// downloadClusterSnapshot takes a cluster snapshot (or uses snapshot id),
+// waits until it is done and writes its manifest and parts into dir.
+func downloadClusterSnapshot(cmd *cobra.Command, c *client.Client, id, dir string, poll time.Duration) error {
+	ctx := cmd.Context()
+	var (
+		m   *client.ClusterSnapshot
+		err error
+	)
+	if id == "" {
+		m, err = c.StartClusterSnapshot(ctx)
+	} else {
+		m, err = c.ClusterSnapshot(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+	for m.State == client.SnapshotRunning {
+		time.Sleep(poll)
+		if m, err = c.ClusterSnapshot(ctx, m.ID); err != nil {
+			return err
+		}
+	}
+	cmd.SilenceUsage = true
+	if m.State != client.SnapshotDone {
+		return fmt.Errorf("cluster snapshot %s failed: %s", m.ID, m.Error)
+	}
+	fmt.Printf("cluster snapshot %s: %d nodes, cut spread %s\n", m.ID, len(m.Parts), m.CutSpread)
+
+	if dir == "" {
+		dir = "cluster-" + m.ID
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for _, p := range m.Parts {
+		path := filepath.Join(dir, p.File)
+		if err := downloadSnapshotPart(ctx, c, m.ID, p, path); err != nil {
+			os.Remove(path)
+			return fmt.Errorf("node %s: %w", p.Node, err)
+		}
+		fmt.Printf("  %-10s %8d records  %s\n", p.Node, p.Records, path)
+	}
+	// The manifest last: a directory with one is complete.
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), data, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("snapshot written to %s\n", dir)
+	return nil
+}
+
+// restoreClusterSnapshot restores every part of the cluster snapshot in
+// dir, renaming its nodes by nodeMap completed with restorePlan.
+func restoreClusterSnapshot(cmd *cobra.Command, c *client.Client, dir string, nodeMap map[string]string, dryRun bool) error {
+	ctx := cmd.Context()
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+	var m client.ClusterSnapshot
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("read manifest: %w", err)
+	}
+	if m.State != client.SnapshotDone {
+		return fmt.Errorf("cluster snapshot %s is %s, not done", m.ID, m.State)
+	}
+	st, err := c.ClusterStatus(ctx)
+	if err != nil {
+		return err
+	}
+	members := make([]string, 0, len(st.Nodes))
+	for _, n := range st.Nodes {
+		members = append(members, n.ID)
+	}
+	slices.Sort(members)
+	old := make([]string, 0, len(m.Parts))
+	for _, p := range m.Parts {
+		old = append(old, p.Node)
+	}
+	slices.Sort(old)
+	for from, to := range nodeMap {
+		if !slices.Contains(members, to) {
+			return fmt.Errorf("--map %s=%s: %s is not a member of the cluster", from, to, to)
+		}
+	}
+	nodeMap = restorePlan(old, members, nodeMap)
+
+	fmt.Printf("snapshot %s: %d nodes, N=%d, taken %s\n", m.ID, len(old), m.Quorum.N, m.Started.Local().Format(time.DateTime))
+	fmt.Printf("cluster: %d nodes, N=%d\n", len(members), st.N)
+	for _, id := range old {
+		fmt.Printf("  %-10s → %s\n", id, cmp.Or(nodeMap[id], id))
+	}
+
+	// Check every part before restoring any.
+	for _, p := range m.Parts {
+		if err := checkSnapshotPart(filepath.Join(dir, p.File), p); err != nil {
+			return fmt.Errorf("node %s: %w", p.Node, err)
+		}
+	}
+	if dryRun {
+		fmt.Println("parts OK; nothing restored (--dry-run)")
+		return nil
+	}
+
+	var total client.RestoreStats
+	for _, p := range m.Parts {
+		f, err := os.Open(filepath.Join(dir, p.File))
+		if err != nil {
+			return err
+		}
+		stats, err := c.Restore(ctx, f, nodeMap)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("node %s: %w", p.Node, err)
+		}
+		fmt.Printf("  %-10s %8d records, %d applied, %d failed\n", p.Node, stats.Records, stats.Applied, stats.Failed)
+		total.Records += stats.Records
+		total.Applied += stats.Applied
+		total.Failed += stats.Failed
+		total.Relabeled += stats.Relabeled
+	}
+	prettyPrint(total)
+	if total.Failed > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%d record(s) were not restored", total.Failed)
+	}
+	return nil
+}
+
+// restorePlan completes nodeMap for the old nodes: one that is neither
+// mapped nor a member is mapped onto the members in turn. Members keep
+// their ID.
+func restorePlan(old, members []string, nodeMap map[string]string) map[string]string {
+	plan := maps.Clone(nodeMap)
+	if plan == nil {
+		plan = make(map[string]string)
+	}
+	next := 0
+	for _, id := range old {
+		if _, ok := plan[id]; ok || slices.Contains(members, id) || len(members) == 0 {
+			continue
+		}
+		plan[id] = members[next%len(members)]
+		next++
+	}
+	return plan
+}
+
+// checkSnapshotPart checks the archive at path against its manifest entry.
+func checkSnapshotPart(path string, p client.SnapshotPart) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); got != p.SHA256 {
+		return fmt.Errorf("checksum mismatch: got %s, manifest has %s", got, p.SHA256)
+	}
+	return nil
+}
+
+// downloadSnapshotPart writes part p of snapshot id to path and checks
+// it against the manifest.
+func downloadSnapshotPart(ctx context.Context, c *client.Client, id string, p client.SnapshotPart, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.New()
+	err = c.DownloadSnapshotPart(ctx, id, p.Node, io.MultiWriter(f, sum))
+	if err = errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); got != p.SHA256 {
+		return fmt.Errorf("checksum mismatch: got %s, manifest has %s", got, p.SHA256)
+	}
+	return nil
+}
+
 // ─── helpers ──────────────────────────────────────────────────────────────────
 
+// globalFlags is a snapshot of the global flags.
+type globalFlags struct {
+	server, token, tlsCA, namespace, compressed string
+	timeout                                     time.Duration
+	route                                       bool
+	retries                                     int
+}
+
+func currentFlags() globalFlags {
+	return globalFlags{server: serverAddr, token: token, tlsCA: tlsCA, namespace: namespace,
+		compressed: compressed, timeout: timeout, route: route, retries: retries}
+}
+
+// restore sets the global flags back to f.
+func (f globalFlags) restore() {
+	serverAddr, token, tlsCA, namespace = f.server, f.token, f.tlsCA, f.namespace
+	compressed, timeout, route, retries = f.compressed, f.timeout, f.route, f.retries
+}
+
+// The last client built, by the flags it was built from (namespace
+// aside: it is applied per call). Commands in the repl share it, and
+// with it the server connections.
+var (
+	cachedClient *client.Client
+	cachedFlags  globalFlags
+)
+
+// newClient returns an SDK client for the global flags.
+func newClient() *client.Client {
+	f := currentFlags()
+	f.namespace = ""
+	if cachedClient == nil || f != cachedFlags {
+		cachedClient, cachedFlags = buildClient(), f
+	}
+	return cachedClient.Namespace(namespace)
+}
+
+func buildClient() *client.Client {
+	opts := []client.Option{client.WithToken(token),
+		client.WithRetryPolicy(client.RetryPolicy{MaxAttempts: retries, Backoff: 100 * time.Millisecond, Jitter: 0.5})}
+	if compressed != "" {
+		opts = append(opts, client.WithCompression(compressed))
+	}
+	if route {
+		opts = append(opts, client.WithRingRouting(0))
+	}
+	if tlsCA != "" {
+		pem, err := os.ReadFile(tlsCA)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "read --tls-ca:", err)
+			os.Exit(1)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(pem)
+		opts = append(opts, client.WithTLSConfig(&tls.Config{RootCAs: pool}))
+	}
+	return client.New(serverAddr, timeout, opts...)
+}
+
+// formatBytes prints n with a binary unit (1.5MiB).
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func prettyPrint(v any) {
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
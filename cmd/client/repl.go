@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// ─── repl ─────────────────────────────────────────────────────────────────────
+
+// replBuiltins are the repl's own commands, next to kvcli's.
+var replBuiltins = []string{"exit", "help", "quit", "scan", "use"}
+
+const maxHistory = 1000
+
+func replCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "repl",
+		Short: "Interactive shell",
+		Long: "Reads kvcli commands line by line, without the kvcli prefix, over one\n" +
+			"client: connections to the server stay open between commands.\n\n" +
+			"  put k v            any kvcli command (quote values with spaces)\n" +
+			"  scan [prefix]      keys --prefix <prefix>\n" +
+			"  use <namespace>    switch namespace for the following commands\n" +
+			"  exit, quit, Ctrl-D leave\n\n" +
+			"Flags given on a line apply to that line only. Tab completes commands\n" +
+			"and flags, Up/Down walk the history (kept in ~/.kvcli_history), and\n" +
+			"Ctrl-C cancels the line being typed or the command running.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return runREPL(cmd.Context())
+		},
+	}
+}
+
+func runREPL(ctx context.Context) error {
+	session := currentFlags()
+	ed := newLineEditor(os.Stdin, os.Stdout, completeLine)
+	if home, err := os.UserHomeDir(); err == nil {
+		ed.loadHistory(filepath.Join(home, ".kvcli_history"))
+	}
+	defer ed.close()
+	if ed.tty {
+		fmt.Printf("kvcli repl on %s. Tab completes, \"help\" lists commands, Ctrl-D leaves.\n", session.server)
+	}
+
+	for {
+		line, err := ed.readLine("kvcli:" + session.namespace + "> ")
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case errors.Is(err, errInterrupted):
+			continue
+		case err != nil:
+			return err
+		}
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		ed.addHistory(strings.TrimSpace(line))
+
+		switch args[0] {
+		case "exit", "quit":
+			return nil
+		case "repl":
+			fmt.Fprintln(os.Stderr, "Error: already in the repl")
+			continue
+		case "use":
+			if len(args) != 2 {
+				fmt.Fprintln(os.Stderr, "Error: usage: use <namespace>")
+				continue
+			}
+			session.namespace = args[1]
+			continue
+		case "scan":
+			if len(args) > 2 {
+				fmt.Fprintln(os.Stderr, "Error: usage: scan [prefix]")
+				continue
+			}
+			args = append([]string{"keys", "--prefix"}, append(args[1:], "")[0])
+		}
+		session.restore()
+		runLine(ctx, args)
+	}
+}
+
+// runLine runs one kvcli command line. Ctrl-C cancels the command, not
+// the repl.
+func runLine(ctx context.Context, args []string) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	root := newRootCmd()
+	root.SetArgs(args)
+	root.SilenceErrors, root.SilenceUsage = true, true
+	if err := root.ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+}
+
+// splitArgs splits a line into words like a shell: single quotes keep
+// everything, double quotes allow \" and \\, and a backslash outside
+// quotes escapes the next character.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args  []string
+		word  strings.Builder
+		inArg bool
+		quote rune
+		rs    = []rune(line)
+	)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(rs) && (rs[i+1] == '"' || rs[i+1] == '\\'):
+				i++
+				word.WriteRune(rs[i])
+			default:
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == '\\' && i+1 < len(rs):
+			i++
+			word.WriteRune(rs[i])
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, word.String())
+				word.Reset()
+				inArg = false
+			}
+		default:
+			word.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// completeLine returns the word being typed at the end of head and the
+// candidates to complete it with: subcommands while head names only
+// commands so far, flags of the command for a word starting with "-".
+func completeLine(head string) (string, []string) {
+	words := strings.Fields(head)
+	partial := ""
+	if len(words) > 0 && !strings.HasSuffix(head, " ") {
+		partial, words = words[len(words)-1], words[:len(words)-1]
+	}
+
+	root := newRootCmd()
+	cmd, inArgs := root, false
+	for _, w := range words {
+		if strings.HasPrefix(w, "-") {
+			continue
+		}
+		sub := findSubcommand(cmd, w)
+		if sub == nil {
+			inArgs = true
+			break
+		}
+		cmd = sub
+	}
+
+	var names []string
+	switch {
+	case strings.HasPrefix(partial, "-"):
+		add := func(f *pflag.Flag) { names = append(names, "--"+f.Name) }
+		cmd.LocalFlags().VisitAll(add)
+		cmd.InheritedFlags().VisitAll(add)
+	case !inArgs:
+		for _, sub := range cmd.Commands() {
+			if sub.IsAvailableCommand() && sub.Name() != "repl" {
+				names = append(names, sub.Name())
+			}
+		}
+		if cmd == root {
+			names = append(names, replBuiltins...)
+		}
+	}
+
+	var out []string
+	for _, n := range names {
+		if strings.HasPrefix(n, partial) {
+			out = append(out, n)
+		}
+	}
+	slices.Sort(out)
+	return partial, slices.Compact(out)
+}
+
+func findSubcommand(cmd *cobra.Command, name string) *cobra.Command {
+	for _, sub := range cmd.Commands() {
+		if sub.Name() == name || sub.HasAlias(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// ─── line editing ─────────────────────────────────────────────────────────────
+
+// errInterrupted is returned by readLine for Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines from a terminal with Emacs-style editing keys,
+// history and Tab completion. When the input is not a terminal (a
+// script piped in) it reads plain lines and prints no prompt.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int
+	tty      bool
+	complete func(head string) (partial string, candidates []string)
+
+	history  []string
+	histFile *os.File // appended to; nil = history not saved
+}
+
+func newLineEditor(in *os.File, out io.Writer, complete func(string) (string, []string)) *lineEditor {
+	fd := int(in.Fd())
+	return &lineEditor{in: bufio.NewReader(in), out: out, fd: fd, tty: isTerminal(fd), complete: complete}
+}
+
+// loadHistory reads the history saved at path and appends new lines
+// there. Only the last maxHistory lines are kept.
+func (e *lineEditor) loadHistory(path string) {
+	if data, err := os.ReadFile(path); err == nil {
+		lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		if len(lines) > maxHistory {
+			lines = lines[len(lines)-maxHistory:]
+			_ = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+		}
+		if lines[0] != "" {
+			e.history = lines
+		}
+	}
+	if f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600); err == nil {
+		e.histFile = f
+	}
+}
+
+// addHistory records line, unless it repeats the previous one. Lines
+// with a --token stay out of the history file.
+func (e *lineEditor) addHistory(line string) {
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+	if e.histFile != nil && !strings.Contains(line, "--token") {
+		fmt.Fprintln(e.histFile, line)
+	}
+}
+
+func (e *lineEditor) close() {
+	if e.histFile != nil {
+		e.histFile.Close()
+	}
+}
+
+// readLine prints prompt and returns the line typed, io.EOF at the end
+// of the input (Ctrl-D on an empty line) and errInterrupted for Ctrl-C.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if !e.tty {
+		return e.readPlain()
+	}
+	restore, err := makeRaw(e.fd)
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		return e.readPlain()
+	}
+	defer restore()
+
+	var (
+		buf   []rune
+		pos   int
+		hi    = len(e.history) // history entry shown; len = the line being typed
+		draft []rune
+	)
+	insert := func(rs []rune) {
+		buf = slices.Insert(buf, pos, rs...)
+		pos += len(rs)
+	}
+	showHistory := func(i int) {
+		if hi == len(e.history) {
+			draft = buf
+		}
+		hi = i
+		if hi == len(e.history) {
+			buf = draft
+		} else {
+			buf = []rune(e.history[hi])
+		}
+		pos = len(buf)
+	}
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(e.out, "\r\n")
+			if len(buf) > 0 && errors.Is(err, io.EOF) {
+				return string(buf), nil
+			}
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = slices.Delete(buf, pos, pos+1)
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 2: // Ctrl-B
+			pos = max(pos-1, 0)
+		case 6: // Ctrl-F
+			pos = min(pos+1, len(buf))
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = slices.Delete(buf, pos-1, pos)
+				pos--
+			}
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf, pos = slices.Clone(buf[pos:]), 0
+		case 23: // Ctrl-W
+			start := pos
+			for start > 0 && buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && buf[start-1] != ' ' {
+				start--
+			}
+			buf, pos = slices.Delete(buf, start, pos), start
+		case 12: // Ctrl-L
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case 16: // Ctrl-P
+			if hi > 0 {
+				showHistory(hi - 1)
+			}
+		case 14: // Ctrl-N
+			if hi < len(e.history) {
+				showHistory(hi + 1)
+			}
+		case '\t':
+			partial, cands := e.complete(string(buf[:pos]))
+			switch {
+			case len(cands) == 0:
+				fmt.Fprint(e.out, "\a")
+			case len(cands) == 1:
+				insert([]rune(cands[0][len(partial):] + " "))
+			default:
+				if common := commonPrefix(cands); len(common) > len(partial) {
+					insert([]rune(common[len(partial):]))
+				} else {
+					fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(cands, "  "))
+				}
+			}
+		case 27: // Escape: arrows, Home, End, Delete
+			switch e.escapeKey() {
+			case 'A':
+				if hi > 0 {
+					showHistory(hi - 1)
+				}
+			case 'B':
+				if hi < len(e.history) {
+					showHistory(hi + 1)
+				}
+			case 'C':
+				pos = min(pos+1, len(buf))
+			case 'D':
+				pos = max(pos-1, 0)
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(buf)
+			case '3':
+				if pos < len(buf) {
+					buf = slices.Delete(buf, pos, pos+1)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				insert([]rune{r})
+			}
+		}
+		redraw()
+	}
+}
+
+// escapeKey reads the rest of an escape sequence (ESC [ A, ESC O H,
+// ESC [ 3 ~ ...) and returns the letter naming the key, or the digit of
+// a "~" sequence. 0 for one we do not know.
+func (e *lineEditor) escapeKey() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+	if r < '0' || r > '9' {
+		return r
+	}
+	digit := r
+	for {
+		if r, _, err = e.in.ReadRune(); err != nil || r == '~' {
+			break
+		}
+		if r < '0' || r > '9' {
+			return 0
+		}
+	}
+	switch digit {
+	case '1', '7':
+		return 'H'
+	case '4', '8':
+		return 'F'
+	}
+	return digit
+}
+
+// readPlain reads a line without editing.
+func (e *lineEditor) readPlain() (string, error) {
+	line, err := e.in.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func commonPrefix(words []string) string {
+	p := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, p) {
+			p = p[:len(p)-1]
+		}
+	}
+	return p
+}
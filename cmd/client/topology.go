@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"distributed-kvstore/internal/client"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ─── cluster nodes / status / ring ───────────────────────────────────────────
+
+func clusterNodesCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "nodes",
+		Short: "List the cluster's nodes as the server sees them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("--output must be table or json, not %q", output)
+			}
+			st, err := newClient().ClusterStatus(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if output == "json" {
+				prettyPrint(st.Nodes)
+				return nil
+			}
+			fmt.Printf("%-10s  %-24s  %6s  %-12s  %s\n", "NODE", "ADDRESS", "WEIGHT", "ZONE", "STATE")
+			for _, n := range st.Nodes {
+				state := "alive"
+				switch {
+				case n.Draining:
+					state = "draining"
+				case !n.IsAlive:
+					state = "down"
+				}
+				if n.ID == st.Self {
+					state += " (answered)"
+				}
+				fmt.Printf("%-10s  %-24s  %6d  %-12s  %s\n", n.ID, n.Address, max(n.Weight, 1), orDash(n.Zone), state)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+	return cmd
+}
+
+func clusterStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show every node's health, version, keys, ring share and replication lag",
+		Long: "One row per node:\n\n" +
+			"  HEALTH   up, down (did not answer), draining (being decommissioned) or\n" +
+			"           degraded (a peer's circuit breaker to it is open)\n" +
+			"  OWNS     share of the ring it is the primary replica for\n" +
+			"  OWED     writes other nodes still have to deliver to it: hints kept\n" +
+			"           while it was unreachable, plus queued async replication\n\n" +
+			"Needs the admin scope.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			v, err := fetchClusterView(cmd.Context(), newClient())
+			if err != nil {
+				return err
+			}
+			v.print()
+			return nil
+		},
+	}
+}
+
+func clusterRingCmd() *cobra.Command {
+	var node string
+	cmd := &cobra.Command{
+		Use:   "ring [--node <id>]",
+		Short: "Print the ring's token ranges with their replicas and key counts",
+		Long: "Each line is a token range (START, END] — a key belongs to the range\n" +
+			"its hash falls in — with its share of the ring and its replicas,\n" +
+			"primary first. KEYS is what each replica reports holding in the range,\n" +
+			"in the same order; a replica that missed writes shows fewer.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			m, err := newClient().Shards(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-10s  %-10s  %7s  %-26s  %s\n", "START", "END", "SHARE", "REPLICAS", "KEYS")
+			shown := 0
+			var share float64
+			for _, r := range m.Ranges {
+				if node != "" && !slices.Contains(r.Replicas, node) {
+					continue
+				}
+				keys := make([]string, len(r.Replicas))
+				for i, id := range r.Replicas {
+					keys[i] = "?"
+					if u, ok := r.Usage[id]; ok {
+						keys[i] = strconv.Itoa(u.Keys)
+					}
+				}
+				size := rangeShare(r.Start, r.End, len(m.Ranges))
+				fmt.Printf("0x%08x  0x%08x  %6.2f%%  %-26s  %s\n", r.Start, r.End, 100*size,
+					strings.Join(r.Replicas, ","), strings.Join(keys, "/"))
+				shown++
+				share += size
+			}
+			fmt.Printf("\n%d of %d ranges (%.1f%% of the ring), %d vnodes per unit of weight, N=%d\n",
+				shown, len(m.Ranges), 100*share, m.Vnodes, m.N)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&node, "node", "", "Only the ranges this node replicates")
+	return cmd
+}
+
+// rangeShare is the fraction of the ring in (start, end]. The first
+// range wraps around zero, which uint32 subtraction gets right; a lone
+// range has start == end and covers everything.
+func rangeShare(start, end uint32, ranges int) float64 {
+	if ranges == 1 {
+		return 1
+	}
+	return float64(end-start) / (1 << 32)
+}
+
+// clusterView is what cluster status shows, gathered from several admin
+// endpoints. Only stats is required: the other parts are nil when their
+// call failed, and their columns show "?".
+type clusterView struct {
+	stats    *client.ClusterStats
+	topology *client.ClusterStatus
+	shards   *client.ShardMap
+	repl     *client.ReplicationReport
+	errs     []error
+}
+
+func fetchClusterView(ctx context.Context, c *client.Client) (*clusterView, error) {
+	var (
+		v        clusterView
+		statsErr error
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+	)
+	note := func(what string, err error) {
+		if err != nil {
+			mu.Lock()
+			v.errs = append(v.errs, fmt.Errorf("%s: %w", what, err))
+			mu.Unlock()
+		}
+	}
+	wg.Add(4)
+	go func() { defer wg.Done(); v.stats, statsErr = c.Stats(ctx) }()
+	go func() {
+		defer wg.Done()
+		var err error
+		v.topology, err = c.ClusterStatus(ctx)
+		note("topology", err)
+	}()
+	go func() {
+		defer wg.Done()
+		var err error
+		v.shards, err = c.Shards(ctx)
+		note("ring ownership", err)
+	}()
+	go func() {
+		defer wg.Done()
+		var err error
+		v.repl, err = c.Replication(ctx)
+		note("replication", err)
+	}()
+	wg.Wait()
+	if statsErr != nil {
+		return nil, statsErr
+	}
+	return &v, nil
+}
+
+func (v *clusterView) print() {
+	stats := make(map[string]client.NodeStats)
+	ids := slices.Clone(v.stats.Unreachable)
+	for _, n := range v.stats.Nodes {
+		stats[n.Node] = n
+		ids = append(ids, n.Node)
+	}
+	draining := make(map[string]bool)
+	if v.topology != nil {
+		for _, n := range v.topology.Nodes {
+			draining[n.ID] = n.Draining
+		}
+	}
+	owns := make(map[string]float64)
+	if v.shards != nil {
+		for _, n := range v.shards.Nodes {
+			owns[n.ID] = n.Ownership
+		}
+	}
+	owed := make(map[string]int)
+	breakerOpen := make(map[string]bool)
+	if v.repl != nil {
+		for _, r := range v.repl.Nodes {
+			for _, p := range r.Peers {
+				owed[p.Peer] += p.HintsPending + p.OutboxPending
+				if p.Breaker == "open" {
+					breakerOpen[p.Peer] = true
+				}
+			}
+		}
+	}
+	slices.Sort(ids)
+	verW := len("VERSION")
+	for _, n := range stats {
+		verW = max(verW, len(n.Version))
+	}
+
+	fmt.Printf("%-10s  %-8s  %-*s  %8s  %10s  %10s  %10s  %6s  %6s  %10s  %s\n",
+		"NODE", "HEALTH", verW, "VERSION", "UPTIME", "KEYS", "TOMBSTONES", "VALUES", "OWNS", "OWED", "WAL", "LAST SNAPSHOT")
+	for _, id := range ids {
+		n, ok := stats[id]
+		health := "up"
+		switch {
+		case !ok:
+			health = "down"
+		case draining[id]:
+			health = "draining"
+		case breakerOpen[id]:
+			health = "degraded"
+		}
+		own, lag := "?", "?"
+		if v.shards != nil {
+			own = fmt.Sprintf("%.1f%%", 100*owns[id])
+		}
+		if v.repl != nil {
+			lag = strconv.Itoa(owed[id])
+		}
+		if !ok {
+			fmt.Printf("%-10s  %-8s  %-*s  %8s  %10s  %10s  %10s  %6s  %6s  %10s  %s\n",
+				id, health, verW, "-", "-", "-", "-", "-", own, lag, "-", "-")
+			continue
+		}
+		uptime := "-"
+		if !n.Started.IsZero() {
+			uptime = formatAge(time.Since(n.Started))
+		}
+		snap := "never"
+		if !n.LastSnapshot.IsZero() {
+			snap = formatAge(time.Since(n.LastSnapshot)) + " ago"
+		}
+		fmt.Printf("%-10s  %-8s  %-*s  %8s  %10d  %10d  %10s  %6s  %6s  %10s  %s\n",
+			id, health, verW, orDash(n.Version), uptime, n.Keys, n.Tombstones, formatBytes(n.ValueBytes),
+			own, lag, formatBytes(n.WALBytes), snap)
+	}
+
+	if t := v.topology; t != nil {
+		fmt.Printf("\nN=%d W=%d R=%d, %d vnodes per unit of weight, answered by %s\n", t.N, t.W, t.R, t.Vnodes, t.Self)
+		// While an upgrade rolls, the nodes still on an older protocol
+		// hold the cluster to it.
+		top := 0
+		for _, nv := range t.Versions {
+			top = max(top, nv.Protocol)
+		}
+		var behind []string
+		for _, nv := range t.Versions {
+			if nv.Protocol > 0 && nv.Protocol < top {
+				behind = append(behind, nv.Node)
+			}
+		}
+		if t.ClusterProtocol > 0 {
+			fmt.Printf("wire protocol %d", t.ClusterProtocol)
+			if len(behind) > 0 {
+				fmt.Printf(" (upgrade in progress: %s not on %d yet)", strings.Join(behind, ", "), top)
+			}
+			fmt.Println()
+		}
+	}
+	for _, err := range v.errs {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+}
+
+// formatAge prints d to the coarsest two units: 45s, 12m30s, 5h12m, 3d4h.
+func formatAge(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return d.String()
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%02ds", d/time.Minute, d%time.Minute/time.Second)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%02dm", d/time.Hour, d%time.Hour/time.Minute)
+	}
+	return fmt.Sprintf("%dd%dh", d/(24*time.Hour), d%(24*time.Hour)/time.Hour)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
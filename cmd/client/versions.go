@@ -0,0 +1,91 @@
+package main
+
+import (
+	"distributed-kvstore/internal/client"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ─── versions ─────────────────────────────────────────────────────────────────
+
+func versionsCmd() *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "versions <key>",
+		Short: "List the versions of a key the replicas still hold",
+		Long: "Shows a key's history, newest first: its current value (marked *) and\n" +
+			"the values it replaced, in namespaces created with --versions.\n" +
+			"Read one back with: kvcli get <key> --clock <clock>",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("--output must be table or json, not %q", output)
+			}
+			vs, err := newClient().Versions(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if output == "json" {
+				prettyPrint(vs)
+				return nil
+			}
+			if len(vs.Versions) == 0 {
+				fmt.Printf("key %q not found\n", args[0])
+				return nil
+			}
+			fmt.Printf("  %-24s  %-10s  %-14s  %s\n", "CLOCK", "AGE", "REPLICAS", "VALUE")
+			for _, v := range vs.Versions {
+				mark := " "
+				if v.Current {
+					mark = "*"
+				}
+				value := strconv.Quote(truncate(v.Value, 40))
+				if v.Deleted {
+					value = "(deleted)"
+				}
+				fmt.Printf("%s %-24s  %-10s  %-14s  %s\n", mark, client.FormatClock(v.Clock),
+					formatAge(time.Since(v.UpdatedAt)), strings.Join(v.Replicas, ","), value)
+			}
+			if len(vs.Unreachable) > 0 {
+				fmt.Printf("\nunreachable: %s (their versions are missing)\n", strings.Join(vs.Unreachable, ", "))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+	return cmd
+}
+
+// ─── undelete ─────────────────────────────────────────────────────────────────
+
+func undeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "undelete <key>",
+		Short: "Restore a deleted key's last value",
+		Long: "Writes a deleted key's value from before the delete again, as a new\n" +
+			"version. Works while a replica still keeps that value: in namespaces\n" +
+			"created with --versions, until enough writes have replaced it.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := newClient().Undelete(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("restored %q from %s: %s\n", args[0], client.FormatClock(resp.RestoredFrom),
+				strconv.Quote(truncate(resp.Value, 60)))
+			return nil
+		},
+	}
+}
+
+// truncate shortens s to n runes, marking the cut.
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"distributed-kvstore/internal/client"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ─── watch ────────────────────────────────────────────────────────────────────
+
+// Reconnect backoff of kvcli watch.
+const (
+	watchRetryMin = time.Second
+	watchRetryMax = 30 * time.Second
+)
+
+func watchCmd() *cobra.Command {
+	var (
+		output    string
+		replicas  bool
+		reconnect bool
+	)
+	cmd := &cobra.Command{
+		Use:   "watch [prefix]",
+		Short: "Tail the changes of the namespace's keys",
+		Long: "Prints every put and delete of a key starting with prefix, as it\n" +
+			"happens, until Ctrl-C. --replicas prints each replica's copy of a write\n" +
+			"with the node that applied it, to follow replication. When the stream\n" +
+			"drops the watch reconnects; changes made in between are not replayed.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var print func(client.Event)
+			switch output {
+			case "table":
+				print = printEventRow
+			case "json":
+				enc := json.NewEncoder(os.Stdout)
+				print = func(ev client.Event) { _ = enc.Encode(ev) }
+			default:
+				return fmt.Errorf("--output must be table or json, not %q", output)
+			}
+			prefix := ""
+			if len(args) == 1 {
+				prefix = args[0]
+			}
+			cmd.SilenceUsage = true
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if output == "table" {
+				fmt.Printf("%-12s  %-6s  %-30s  %-8s  %s\n", "TIME", "OP", "KEY", "NODE", "VALUE")
+			}
+			return runWatch(ctx, prefix, replicas, reconnect, print)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json (one event per line)")
+	cmd.Flags().BoolVar(&replicas, "replicas", false, "Print every replica's copy of a write, not just the first")
+	cmd.Flags().BoolVar(&reconnect, "reconnect", true, "Reconnect when the stream drops")
+	return cmd
+}
+
+// runWatch watches until ctx is done, reconnecting with backoff after
+// a break if reconnect. Refusals (a missing namespace, a bad token) are
+// returned at once.
+func runWatch(ctx context.Context, prefix string, replicas, reconnect bool, print func(client.Event)) error {
+	c := newClient()
+	watch := c.Watch
+	if replicas {
+		watch = c.WatchReplicas
+	}
+
+	wait := watchRetryMin
+	for {
+		started := time.Now()
+		err := watch(ctx, prefix, func(ev client.Event) error {
+			print(ev)
+			return nil
+		})
+		var apiErr *client.APIError
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.As(err, &apiErr) && apiErr.Status < http.StatusInternalServerError && apiErr.Status != http.StatusTooManyRequests:
+			return err
+		case !reconnect:
+			return err
+		}
+		if time.Since(started) > watchRetryMax {
+			wait = watchRetryMin // it ran a while: not a server failing over and over
+		}
+		fmt.Fprintf(os.Stderr, "%v; reconnecting in %s\n", err, wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, watchRetryMax)
+	}
+}
+
+// printEventRow prints ev as a table row. Values are quoted, and cut to
+// keep one event per line.
+func printEventRow(ev client.Event) {
+	const maxValue = 60
+	value := ""
+	if ev.Op == "put" {
+		r := []rune(ev.Value)
+		if len(r) > maxValue {
+			value = strconv.Quote(string(r[:maxValue])) + "…"
+		} else {
+			value = strconv.Quote(ev.Value)
+		}
+	}
+	fmt.Printf("%-12s  %-6s  %-30s  %-8s  %s\n", ev.UpdatedAt.Local().Format("15:04:05.000"), ev.Op, ev.Key, ev.Node, value)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envPrefix namespaces the environment variables that set flags.
+const envPrefix = "KV_"
+
+// flagsFromEnv sets every flag that was not given on the command line
+// from its environment variable, if present: --peer-timeout reads
+// KV_PEER_TIMEOUT. Call after fs.Parse.
+func flagsFromEnv(fs *flag.FlagSet, prefix string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || err != nil {
+			return
+		}
+		name := prefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := os.LookupEnv(name); ok {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("invalid %s: %w", name, e)
+			}
+		}
+	})
+	return err
+}
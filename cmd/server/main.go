@@ -1,7 +1,9 @@
 // cmd/server is the main entrypoint for a KV store node.
 //
 // Configuration is entirely via flags/environment so a single binary can
-// serve any role in the cluster.
+// serve any role in the cluster. Every flag can also be set as an
+// environment variable: --quorum-timeout is KV_QUORUM_TIMEOUT. A flag on
+// the command line wins over the environment.
 //
 // Example — single node:
 //
@@ -15,134 +17,747 @@
 //	         --peers node1=localhost:8080,node3=localhost:8082
 //	./server --id node3 --addr :8082 --data-dir /tmp/n3 \
 //	         --peers node1=localhost:8080,node2=localhost:8081
+//
+// Example — add a node to a running cluster through any member (seed):
+//
+//	./server --id node4 --addr :8083 --advertise node4.internal:8083 \
+//	         --data-dir /tmp/n4 --join localhost:8080
+//
+// Mixed hardware — node3 has twice the capacity, so it owns twice the keys.
+// Every node must agree on the weights (peers take them as id=host:port@weight):
+//
+//	./server --id node3 --addr :8082 --weight 2 --data-dir /tmp/n3 \
+//	         --peers node1=localhost:8080,node2=localhost:8081
+//	./server --id node1 --addr :8080 --data-dir /tmp/n1 \
+//	         --peers node2=localhost:8081,node3=localhost:8082@2
+//
+// Zones — with the nearest read policy, reads prefer this node and its zone:
+//
+//	./server --id node1 --zone us-east-1a --read-policy nearest \
+//	         --peers node2=10.0.1.2:8080,node3=10.0.2.3:8080 --peer-zones node2=us-east-1a,node3=us-east-1b
+//
+// Latency budget — a LAN cluster that should fail fast:
+//
+//	./server --quorum-timeout 200ms --peer-timeout 150ms --replicate-attempts 2 --retry-backoff 20ms
+//
+// ... and that should complain about any replica taking more than 50ms:
+//
+//	./server --slow-write 50ms --slow-read 50ms --slow-replicate 50ms --slow-fetch 50ms
+//	./server --read-cache-size 100000 --read-cache-ttl 500ms
+//
+// Snapshots — a write-heavy node that should keep restarts short:
+//
+//	./server --snapshot-policy wal-bytes=16MiB,wal-entries=20000,min-interval=5s,max-interval=5m
+//
+// ... and a large one that writes only the changed keys between full snapshots:
+//
+//	./server --snapshot-policy max-deltas=8
+//
+// ... and one that updates a few hot keys all day, and only needs their
+// last values replayed:
+//
+//	./server --wal-compaction 16MiB
+//
+// Replication under heavy write load — up to 64 writes per peer request:
+//
+//	./server --replicate-batch 64 --replicate-batch-delay 2ms
+//
+// A cache: keep the data under 2 GiB, dropping the least recently used keys:
+//
+//	./server --max-memory 2GiB --eviction lru
+//
+// ... telling the cache invalidator in front of it which keys went:
+//
+//	./server --max-memory 2GiB --eviction lru --eviction-webhook http://invalidator:9000/evicted
+//
+// Keeping 5% of the disk free: below that, writes get 507 but reads and
+// deletes go on:
+//
+//	./server --min-free-disk 5%
+//
+// Publishing committed writes: every write to a search indexer, orders to NATS:
+//
+//	./server --sinks search=http://indexer:9200/kv-events,orders=nats://nats:4222/kv.orders \
+//	         --sink-prefixes orders=orders/
+//
+// Shipping the audit log of admin and cluster operations to a sink too:
+//
+//	./server --sinks siem=https://siem.internal/kv --audit-sinks siem
+//
+// Change data capture for an ETL job, keeping 1 GiB of history past snapshots:
+//
+//	./server --cdc-retention 1GiB        # then: curl 'http://node1:8080/cdc?from=1'
+//
+// Replicating the orders and users namespaces to a standby cluster in
+// another region (its node IDs differ from ours):
+//
+//	./server --remote-cluster https://dr-1:8080,https://dr-2:8080 --remote-cluster-token $DR_TOKEN \
+//	         --remote-namespaces orders,users --cdc-retention 1GiB
+//
+// Logging:
+//
+//	./server --log-level debug --log-format json
+//
+// The KV API over gRPC too (proto/kv/v1/kv.proto), next to HTTP:
+//
+//	./server --grpc-addr :9090
+//
+// Settings that reload without a restart (kill -HUP, or POST /admin/reload):
+//
+//	./server --config /etc/kvstore/node1.json --tls-cert node1.crt --tls-key node1.key
+//
+// Authentication (see api.AuthConfig for the file format):
+//
+//	./server --auth-file /etc/kvstore/auth.json
+//
+// Rolling restarts and scale-down — on SIGTERM, a node to be restarted
+// tells its peers to route around it; one to be retired moves its data
+// and leaves the ring first:
+//
+//	./server --shutdown-mode restart --shutdown-timeout 30s
+//	./server --shutdown-mode decommission --shutdown-timeout 10m
+//
+// Mutual TLS between nodes (all certs signed by the same CA):
+//
+//	./server --tls-cert node1.crt --tls-key node1.key --tls-ca ca.crt \
+//	         --peers node2=node2.internal:8081
 package main
 
 import (
 	"context"
+	"crypto/tls"
 	"distributed-kvstore/internal/api"
 	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/grpcapi"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/metrics"
 	"distributed-kvstore/internal/store"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
 )
 
 func main() {
 	// ── Flags ──────────────────────────────────────────────────────────────
 	nodeID := flag.String("id", "node1", "Unique node identifier")
 	addr := flag.String("addr", ":8080", "Listen address (host:port)")
+	grpcAddr := flag.String("grpc-addr", "", "Listen address of the gRPC KV API (empty = off)")
 	dataDir := flag.String("data-dir", "/tmp/kvstore", "Directory for WAL and snapshots")
-	peersFlag := flag.String("peers", "", "Comma-separated list of peer nodes: id=host:port")
+	peersFlag := flag.String("peers", "", "Comma-separated list of peer nodes: id=host:port[@weight]")
+	joinAddr := flag.String("join", "", "Address (host:port) of an existing member to join the cluster through")
+	advertise := flag.String("advertise", "", "Address peers use to reach this node (default: --addr)")
+	weight := flag.Int("weight", 1, "This node's share of the ring relative to the others (2 = twice the keys)")
+	zone := flag.String("zone", "", "Zone (rack, availability zone) this node runs in")
+	peerZones := flag.String("peer-zones", "", "Comma-separated zones of the --peers: id=zone")
+	readPolicy := flag.String("read-policy", cluster.ReadRing, "Default read routing: ring (ask all replicas), nearest (ask the R closest) or one (a single replica, this node first)")
 	replicationN := flag.Int("n", 3, "Replication factor (N)")
 	writeQuorum := flag.Int("w", 2, "Write quorum (W)")
 	readQuorum := flag.Int("r", 2, "Read quorum (R)")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn, error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	authFile := flag.String("auth-file", "", "JSON file with API tokens and the cluster token (empty = auth disabled)")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file (enables HTTPS)")
+	tlsKey := flag.String("tls-key", "", "TLS private key file")
+	tlsCA := flag.String("tls-ca", "", "CA bundle used to verify peer certificates (enables mutual TLS)")
+	compression := flag.String("compression", "none", "Default value compression: none, zstd or snappy")
+	compressionThreshold := flag.Int("compression-threshold", 1024, "Compress values and HTTP bodies of at least this many bytes")
+	snapshotPolicy := flag.String("snapshot-policy", store.DefaultSnapshotPolicy.String(),
+		"When to snapshot: wal-bytes=SIZE,wal-entries=N,min-interval=DUR,max-interval=DUR (0 disables one),max-deltas=N (delta snapshots between full ones)")
+	maxKeyLength := flag.Int("max-key-length", store.DefaultMaxKeyLength, "Maximum key length in bytes (0 = unlimited)")
+	maxValueSize := flag.Int("max-value-size", store.DefaultMaxValueSize, "Maximum value size in bytes (0 = unlimited)")
+	maxMemory := flag.String("max-memory", "0", "Bound on the data's estimated memory, e.g. 512MiB (0 = unbounded)")
+	minFreeDisk := flag.String("min-free-disk", store.DefaultDiskReserve.String(), "Refuse writes while the data dir's file system has less free, e.g. 1GiB or 5% (0 = never)")
+	walSync := flag.String("wal-sync", store.WALSyncGroup, "When WAL writes are synced: group (writers share fsyncs), always (an fsync per entry) or interval (every --wal-sync-interval; a machine crash loses up to that)")
+	walSyncInterval := flag.Duration("wal-sync-interval", store.DefaultWALSyncInterval, "How often --wal-sync=interval syncs the WAL")
+	walCompaction := flag.String("wal-compaction", "0", "Rewrite the WAL keeping each key's last write (last Versions+1 where a namespace keeps history) whenever it grows this much, e.g. 16MiB (0 = off)")
+	cdcRetention := flag.String("cdc-retention", "0", "Snapshotted WAL kept for GET /cdc, e.g. 1GiB (0 = only the WAL since the last snapshot)")
+	eviction := flag.String("eviction", store.DefaultMemoryConfig.Policy, "At --max-memory: reject (refuse writes), lru (evict least recently used keys) or ttl (evict keys expiring soonest, then as lru)")
+	evictWebhook := flag.String("eviction-webhook", "", "URL to POST this node's evicted keys to (empty = off)")
+	evictWebhookRetries := flag.Int("eviction-webhook-retries", 5, "Retries of a failed eviction webhook batch before it is dropped")
+	sinkList := flag.String("sinks", "", "Event sinks for committed writes: name=url,... (http(s):// webhook or nats://host:port/subject)")
+	sinkPrefixes := flag.String("sink-prefixes", "", "Key prefix per sink: name=namespace/prefix,... (default = every key)")
+	sinkQueue := flag.Int("sink-queue", cluster.DefaultSinkQueue, "Undelivered events kept per sink before new ones are dropped")
+	auditSinks := flag.String("audit-sinks", "", "Comma-separated --sinks names that also get the audit log's entries (empty = none)")
+	remoteCluster := flag.String("remote-cluster", "", "Comma-separated base URLs of another cluster's nodes to replicate writes to, asynchronously (empty = off)")
+	remoteToken := flag.String("remote-cluster-token", "", "The remote cluster's cluster token")
+	remoteNamespaces := flag.String("remote-namespaces", "", "Comma-separated namespaces replicated to --remote-cluster (empty = all)")
+	maxBodySize := flag.Int64("max-body-size", api.DefaultMaxBodySize, "Maximum request body size in bytes (0 = unlimited)")
+	rateIP := flag.Float64("rate-limit-ip", 0, "Requests/sec allowed per client IP (0 = unlimited)")
+	rateIPBytes := flag.Float64("rate-limit-ip-bytes", 0, "Bytes/sec allowed per client IP (0 = unlimited)")
+	rateToken := flag.Float64("rate-limit-token", 0, "Requests/sec allowed per API token (0 = unlimited)")
+	rateTokenBytes := flag.Float64("rate-limit-token-bytes", 0, "Bytes/sec allowed per API token (0 = unlimited)")
+	rateBurst := flag.Duration("rate-limit-burst", time.Second, "Burst allowance, as time at the full rate")
+	maxInFlight := flag.Int("max-inflight", cluster.DefaultConcurrency.MaxInFlight, "Quorum operations running at once (0 = unlimited)")
+	maxQueue := flag.Int("max-queue", cluster.DefaultConcurrency.MaxQueue, "Quorum operations waiting for a slot before shedding with 503")
+	queueWait := flag.Duration("queue-wait", cluster.DefaultConcurrency.QueueWait, "Longest wait for an operation or peer slot")
+	peerConcurrency := flag.Int("peer-concurrency", cluster.DefaultConcurrency.PerPeer, "Concurrent requests to one peer (0 = unlimited)")
+	peerTimeout := flag.Duration("peer-timeout", cluster.DefaultTimeouts.Peer, "Timeout for one request to a peer")
+	quorumTimeout := flag.Duration("quorum-timeout", cluster.DefaultTimeouts.Quorum, "Longest wait for a write or read quorum (clients can ask for less with X-Request-Timeout)")
+	replicateAttempts := flag.Int("replicate-attempts", cluster.DefaultTimeouts.Attempts, "Tries per replica write before it becomes a hint")
+	slowWrite := flag.Duration("slow-write", cluster.DefaultSlowThresholds.Write, "Log quorum writes slower than this, with each replica's time (0 = off)")
+	slowRead := flag.Duration("slow-read", cluster.DefaultSlowThresholds.Read, "Log quorum reads slower than this, with each replica's time (0 = off)")
+	slowReplicate := flag.Duration("slow-replicate", cluster.DefaultSlowThresholds.Replicate, "Log replicate calls to a peer slower than this (0 = off)")
+	slowFetch := flag.Duration("slow-fetch", cluster.DefaultSlowThresholds.Fetch, "Log fetches from a peer slower than this (0 = off)")
+	readCacheSize := flag.Int("read-cache-size", cluster.DefaultReadCacheConfig.Size, "Keys whose read results are cached on this coordinator (0 = no cache)")
+	readCacheTTL := flag.Duration("read-cache-ttl", cluster.DefaultReadCacheConfig.TTL, "Longest a cached read is served; bounds staleness for writes this node did not see")
+	coalesceReads := flag.Bool("coalesce-reads", true, "Let concurrent client reads of one key share a single quorum read")
+	hedgeReads := flag.Bool("hedge-reads", true, "Ask a spare replica when a nearest or one read has waited the p99 fetch latency")
+	hedgeMinDelay := flag.Duration("hedge-min-delay", cluster.DefaultHedgeMinDelay, "Shortest wait before a read hedges")
+	selfFence := flag.Bool("self-fence", true, "Refuse writes while this node's ring differs from the majority's, until it resyncs")
+	maxClockSkew := flag.Duration("max-clock-skew", cluster.DefaultMaxClockSkew, "Warn when a peer's clock is further than this from ours (0 = never)")
+	tiebreak := flag.String("tiebreak", store.TiebreakTime, "How concurrent writes are settled: time (later HLC) or node-id (same on every node)")
+	clockPruneAfter := flag.Duration("clock-prune-after", cluster.DefaultClockPruneConfig.After, "Drop a departed node's vector clock entries this long after it left (0 = never)")
+	clockMaxEntries := flag.Int("clock-max-entries", cluster.DefaultClockPruneConfig.MaxEntries, "Shed departed nodes' entries from vector clocks longer than this (0 = no cap)")
+	deleteConflicts := flag.String("delete-conflicts", store.DeleteConflictsTiebreak, "How a delete concurrent with a write is settled: tiebreak (as --tiebreak), delete-wins or write-wins")
+	replicateBatch := flag.Int("replicate-batch", cluster.DefaultReplicateBatchConfig.MaxEntries, "Send up to this many replicated writes to a peer in one request (0 = one request per write)")
+	replicateBatchDelay := flag.Duration("replicate-batch-delay", cluster.DefaultReplicateBatchConfig.Delay, "Longest a replicated write waits for others to share its batch")
+	retryBackoff := flag.Duration("retry-backoff", cluster.DefaultTimeouts.RetryBackoff, "Wait before retrying a replica write; doubles after each try")
+	peerIdleConns := flag.Int("peer-max-idle-conns", cluster.DefaultTransportConfig.MaxIdleConnsPerHost, "Idle connections kept open per peer")
+	peerMaxConns := flag.Int("peer-max-conns", 0, "Maximum connections per peer (0 = unlimited)")
+	peerIdleTimeout := flag.Duration("peer-idle-timeout", cluster.DefaultTransportConfig.IdleConnTimeout, "Close idle peer connections after this long")
+	breakerThreshold := flag.Int("breaker-threshold", cluster.DefaultBreakerConfig.Threshold, "Consecutive peer failures that open its circuit breaker (0 = no breakers)")
+	breakerCooldown := flag.Duration("breaker-cooldown", cluster.DefaultBreakerConfig.Cooldown, "How long an open breaker fails fast before probing the peer again")
+	peerH2C := flag.Bool("peer-h2c", false, "Use HTTP/2 without TLS for peer traffic (every node must run a version that accepts it)")
+	configFile := flag.String("config", "", "JSON file of settings to reload on SIGHUP or POST /admin/reload (log level, rate limits, timeouts, slow thresholds)")
+	shutdownMode := flag.String("shutdown-mode", cluster.ShutdownRestart, "On SIGTERM: restart (tell peers we are down for a while) or decommission (move our data and leave the ring)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 15*time.Second, "Longest a graceful shutdown takes: handover, requests in flight, last snapshot")
+	idempotencyTTL := flag.Duration("idempotency-ttl", api.DefaultIdempotencyTTL, "How long responses to Idempotency-Key requests are remembered")
+	showVersion := flag.Bool("version", false, "Print the version and exit")
 	flag.Parse()
+	if *showVersion {
+		fmt.Println(buildVersion())
+		return
+	}
+	if err := flagsFromEnv(flag.CommandLine, envPrefix); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// ── Logging ────────────────────────────────────────────────────────────
+	logger, err := logging.New(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger.With("node", *nodeID))
 
 	if *writeQuorum+*readQuorum <= *replicationN {
-		log.Fatalf("FATAL: W(%d) + R(%d) must be > N(%d) for strong consistency",
-			*writeQuorum, *readQuorum, *replicationN)
+		fatal(fmt.Sprintf("W(%d) + R(%d) must be > N(%d) for strong consistency",
+			*writeQuorum, *readQuorum, *replicationN))
+	}
+
+	// ── TLS ────────────────────────────────────────────────────────────────
+	// The same cert/key pair is presented to clients (server side)
+	// and to peers (client side of replication).
+	var (
+		tlsCfg  *tls.Config
+		keyPair *cluster.KeyPair
+	)
+	if *tlsCert != "" || *tlsKey != "" {
+		tlsCfg, keyPair, err = cluster.LoadTLSConfig(*tlsCert, *tlsKey, *tlsCA)
+		if err != nil {
+			fatal("load tls config", "error", err)
+		}
+	}
+
+	// ── Listener ───────────────────────────────────────────────────────────
+	// Bind before loading the store: replaying a large WAL takes a while,
+	// and meanwhile probes should see a live node that is not ready yet
+	// (api.StartupHandler) rather than a closed port. The real router
+	// replaces it once everything below is set up. Binding first also
+	// opens the socket before --join announces us.
+	startedAt := time.Now()
+	recovery := new(store.Recovery)
+	var routes handlerSwitch
+	routes.set(api.StartupHandler(*nodeID, buildVersion(), recovery))
+	srv := &http.Server{
+		Addr:         *addr,
+		Handler:      &routes,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		TLSConfig:    tlsCfg,
+		Protocols:    cluster.ServerProtocols(),
+	}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fatal("listen", "addr", *addr, "error", err)
+	}
+	go func() {
+		slog.Info("listening", "addr", *addr, "version", buildVersion(), "tls", tlsCfg != nil)
+		var err error
+		if tlsCfg != nil {
+			// srv.TLSConfig serves the cert from keyPair (reloadable).
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("server error", "error", err)
+		}
+	}()
+	// gRPC calls go through the same routes, startup handler included.
+	var grpcSrv *grpc.Server
+	if *grpcAddr != "" {
+		grpcLn, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			fatal("listen", "addr", *grpcAddr, "error", err)
+		}
+		grpcSrv = grpcapi.NewServer(&routes, tlsCfg)
+		go func() {
+			slog.Info("listening for grpc", "addr", *grpcAddr)
+			if err := grpcSrv.Serve(grpcLn); err != nil {
+				fatal("grpc server error", "error", err)
+			}
+		}()
 	}
 
 	// ── Storage ────────────────────────────────────────────────────────────
 	nodeDataDir := fmt.Sprintf("%s/%s", *dataDir, *nodeID)
-	s, err := store.New(nodeDataDir, *nodeID)
+	stopProgress := logRecovery(recovery, 5*time.Second)
+	s, err := store.NewWithRecovery(nodeDataDir, *nodeID, recovery)
+	stopProgress()
 	if err != nil {
-		log.Fatalf("open store: %v", err)
+		fatal("open store", "error", err)
 	}
 	defer s.Close()
+	loaded := recovery.Status()
+	slog.Info("store loaded", "took", (time.Duration(loaded.ElapsedMs) * time.Millisecond),
+		"bytes", loaded.BytesDone, "snapshot_keys", loaded.SnapshotKeys, "wal_entries", loaded.WALEntries)
+
+	if err := s.SetTiebreak(*tiebreak); err != nil {
+		fatal("invalid --tiebreak", "error", err)
+	}
+	if err := s.SetDeleteConflicts(*deleteConflicts); err != nil {
+		fatal("invalid --delete-conflicts", "error", err)
+	}
+	if err := s.SetWALSync(*walSync, *walSyncInterval); err != nil {
+		fatal("invalid --wal-sync", "error", err)
+	}
+	if err := s.SetCompression(*compression, *compressionThreshold); err != nil {
+		fatal("invalid compression", "error", err)
+	}
+	s.SetLimits(store.Limits{MaxKeyLength: *maxKeyLength, MaxValueSize: *maxValueSize})
+	snapPolicy, err := store.ParseSnapshotPolicy(*snapshotPolicy)
+	if err != nil {
+		fatal("invalid --snapshot-policy", "error", err)
+	}
+	memBytes, err := store.ParseMemorySize(*maxMemory)
+	if err != nil {
+		fatal("invalid --max-memory", "error", err)
+	}
+	if err := s.SetMemory(store.MemoryConfig{MaxBytes: memBytes, Policy: *eviction}); err != nil {
+		fatal("invalid memory bound", "error", err)
+	}
+	retainBytes, err := store.ParseMemorySize(*cdcRetention)
+	if err != nil {
+		fatal("invalid --cdc-retention", "error", err)
+	}
+	if err := s.SetCDCRetention(retainBytes); err != nil {
+		fatal("invalid --cdc-retention", "error", err)
+	}
+	diskReserve, err := store.ParseDiskReserve(*minFreeDisk)
+	if err != nil {
+		fatal("invalid --min-free-disk", "error", err)
+	}
+	if err := s.SetDiskReserve(diskReserve); err != nil {
+		fatal("invalid --min-free-disk", "error", err)
+	}
+	compactBytes, err := store.ParseMemorySize(*walCompaction)
+	if err != nil {
+		fatal("invalid --wal-compaction", "error", err)
+	}
+	evictHook := cluster.EvictionWebhookConfig{URL: *evictWebhook, Retries: *evictWebhookRetries}
+	if err := evictHook.Validate(); err != nil {
+		fatal("invalid --eviction-webhook", "error", err)
+	}
+	sinks, err := cluster.ParseSinks(*sinkList, *sinkPrefixes)
+	if err != nil {
+		fatal("invalid --sinks", "error", err)
+	}
+	remote, err := cluster.ParseRemoteCluster(*remoteCluster, *remoteToken, *remoteNamespaces)
+	if err != nil {
+		fatal("invalid --remote-cluster", "error", err)
+	}
 
 	// ── Cluster membership ─────────────────────────────────────────────────
 	// Always add self to the membership list.
-	selfNode := cluster.Node{ID: *nodeID, Address: *addr}
+	selfAddr := *addr
+	if *advertise != "" {
+		selfAddr = *advertise
+	}
+	if *weight < 1 {
+		fatal("--weight must be at least 1", "weight", *weight)
+	}
+	selfNode := cluster.Node{ID: *nodeID, Address: selfAddr, Weight: *weight, Zone: *zone}
 	nodes := []cluster.Node{selfNode}
 
 	if *peersFlag != "" {
 		for _, entry := range strings.Split(*peersFlag, ",") {
 			parts := strings.SplitN(entry, "=", 2)
 			if len(parts) != 2 {
-				log.Fatalf("invalid peer format %q: expected id=host:port", entry)
+				fatal("invalid peer format: expected id=host:port[@weight]", "peer", entry)
+			}
+			peer := cluster.Node{ID: parts[0], Address: parts[1]}
+			if address, w, ok := strings.Cut(parts[1], "@"); ok {
+				n, err := strconv.Atoi(w)
+				if err != nil || n < 1 {
+					fatal("invalid peer weight: expected a positive integer", "peer", entry)
+				}
+				peer.Address, peer.Weight = address, n
+			}
+			nodes = append(nodes, peer)
+		}
+	}
+	if *peerZones != "" {
+		for _, entry := range strings.Split(*peerZones, ",") {
+			id, z, ok := strings.Cut(entry, "=")
+			i := slices.IndexFunc(nodes, func(n cluster.Node) bool { return n.ID == id })
+			if !ok || i < 0 {
+				fatal("invalid peer zone: expected id=zone for a node in --peers", "entry", entry)
 			}
-			nodes = append(nodes, cluster.Node{ID: parts[0], Address: parts[1]})
+			nodes[i].Zone = z
 		}
 	}
 
 	membership := cluster.NewMembership(nodes, 150)
 
 	// ── Replicator ─────────────────────────────────────────────────────────
+	// Quorum sizes are settled once membership is known (see below).
+	replicator := cluster.NewReplicator(*nodeID, membership, s, *replicationN, *writeQuorum, *readQuorum)
+	replicator.SetVersion(buildVersion())
+	transport := cluster.DefaultTransportConfig
+	transport.Timeout = *peerTimeout
+	transport.MaxIdleConnsPerHost = *peerIdleConns
+	transport.MaxConnsPerHost = *peerMaxConns
+	transport.IdleConnTimeout = *peerIdleTimeout
+	transport.H2C = *peerH2C
+	replicator.SetTransport(transport)
+	replicator.SetConcurrency(cluster.Concurrency{
+		MaxInFlight: *maxInFlight,
+		MaxQueue:    *maxQueue,
+		QueueWait:   *queueWait,
+		PerPeer:     *peerConcurrency,
+	})
+	replicator.SetBreakers(cluster.BreakerConfig{Threshold: *breakerThreshold, Cooldown: *breakerCooldown})
+	if err := replicator.SetTimeouts(cluster.Timeouts{
+		Quorum:       *quorumTimeout,
+		Peer:         *peerTimeout,
+		Attempts:     *replicateAttempts,
+		RetryBackoff: *retryBackoff,
+	}); err != nil {
+		fatal("invalid timeouts", "error", err)
+	}
+	if err := replicator.SetSlowThresholds(cluster.SlowThresholds{
+		Write:     *slowWrite,
+		Read:      *slowRead,
+		Replicate: *slowReplicate,
+		Fetch:     *slowFetch,
+	}); err != nil {
+		fatal("invalid slow thresholds", "error", err)
+	}
+	if err := replicator.SetReadCache(cluster.ReadCacheConfig{Size: *readCacheSize, TTL: *readCacheTTL}); err != nil {
+		fatal("invalid read cache", "error", err)
+	}
+	replicator.SetCoalesceReads(*coalesceReads)
+	if err := replicator.SetHedgeReads(*hedgeReads, *hedgeMinDelay); err != nil {
+		fatal("invalid read hedging", "error", err)
+	}
+	replicator.SetSelfFencing(*selfFence)
+	replicator.SetMaxClockSkew(*maxClockSkew)
+	if err := replicator.SetReplicateBatch(cluster.ReplicateBatchConfig{MaxEntries: *replicateBatch, Delay: *replicateBatchDelay}); err != nil {
+		fatal("invalid replicate batching", "error", err)
+	}
+	if err := replicator.SetReadPolicy(*readPolicy); err != nil {
+		fatal("invalid --read-policy", "error", err)
+	}
+	if err := replicator.SetShutdownMode(*shutdownMode); err != nil {
+		fatal("invalid --shutdown-mode", "error", err)
+	}
+
+	// ── Authentication ─────────────────────────────────────────────────────
+	var authCfg *api.AuthConfig
+	if *authFile != "" {
+		authCfg, err = api.LoadAuthConfig(*authFile)
+		if err != nil {
+			fatal("load auth file", "error", err)
+		}
+		replicator.SetClusterToken(authCfg.ClusterToken)
+		if err := replicator.SetPeerAuth(authCfg.PeerAuth); err != nil {
+			fatal("invalid peer_auth in auth file", "error", err)
+		}
+	}
+	authn := api.NewAuthenticator(authCfg)
+	if !authn.Enabled() {
+		slog.Warn("authentication disabled: every route is open")
+	}
+	if authCfg != nil && authCfg.OIDC != nil {
+		slog.Info("accepting OIDC tokens", "issuer", authCfg.OIDC.Issuer, "audience", authCfg.OIDC.Audience)
+	}
+
+	if tlsCfg != nil {
+		replicator.SetTLS(tlsCfg)
+	}
+
+	// ── Bootstrap via seed ─────────────────────────────────────────────────
+	// Learn the current members before serving; we announce ourselves
+	// once the listener is up.
+	var seedQuorum cluster.QuorumConfig
+	if *joinAddr != "" {
+		if host, _, _ := net.SplitHostPort(selfAddr); host == "" {
+			slog.Warn("advertised address has no host; peers will dial localhost", "address", selfAddr)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		seedQuorum, err = replicator.PullMembership(ctx, *joinAddr)
+		cancel()
+		if err != nil {
+			fatal("join cluster", "seed", *joinAddr, "error", err)
+		}
+		slog.Info("pulled membership from seed", "seed", *joinAddr, "nodes", membership.Ring().NodeCount())
+	}
+
+	// ── Quorum ─────────────────────────────────────────────────────────────
 	// If there are fewer nodes than N, cap quorum to avoid deadlock.
+	// A quorum changed at runtime (the seed's, or our own quorum.json)
+	// is newer than the flags and wins.
 	n := min(*replicationN, membership.Ring().NodeCount())
-	w := min(*writeQuorum, n)
-	r := min(*readQuorum, n)
-	replicator := cluster.NewReplicator(*nodeID, membership, s, n, w, r)
+	quorum := cluster.QuorumConfig{N: n, W: min(*writeQuorum, n), R: min(*readQuorum, n)}
+	if seedQuorum.Version > quorum.Version {
+		quorum = seedQuorum
+	}
+	if err := replicator.InitQuorum(filepath.Join(nodeDataDir, "quorum.json"), quorum); err != nil {
+		fatal("load quorum", "error", err)
+	}
+	if q := replicator.Quorum(); q.Version > 0 {
+		slog.Info("using runtime quorum", "n", q.N, "w", q.W, "r", q.R, "version", q.Version)
+	}
+	if err := replicator.InitACLs(filepath.Join(nodeDataDir, "acl.json")); err != nil {
+		fatal("load ACLs", "error", err)
+	}
+
+	// ── Async replication outbox ───────────────────────────────────────────
+	queued, err := replicator.OpenOutbox(filepath.Join(nodeDataDir, "outbox.log"))
+	if err != nil {
+		fatal("open outbox", "error", err)
+	}
+	if queued > 0 {
+		slog.Info("resuming async replication", "queued", queued)
+	}
+	defer replicator.CloseOutbox()
+
+	// ── Event sinks ────────────────────────────────────────────────────────
+	undelivered, err := replicator.OpenSinks(filepath.Join(nodeDataDir, "sinks"), sinks, *sinkQueue)
+	if err != nil {
+		fatal("open event sinks", "error", err)
+	}
+	if undelivered > 0 {
+		slog.Info("resuming event sink delivery", "pending", undelivered)
+	}
+	defer replicator.CloseSinks()
+
+	// ── Audit log ──────────────────────────────────────────────────────────
+	if err := replicator.OpenAudit(filepath.Join(nodeDataDir, "audit.log"), strings.FieldsFunc(*auditSinks, func(r rune) bool { return r == ',' })); err != nil {
+		fatal("open audit log", "error", err)
+	}
+	defer replicator.CloseAudit()
+
+	// ── Cross-cluster replication ──────────────────────────────────────────
+	shipped, err := replicator.OpenRemoteCluster(filepath.Join(nodeDataDir, "xdc.pos"), remote)
+	if err != nil {
+		fatal("open remote cluster bridge", "error", err)
+	}
+	if remote != nil {
+		slog.Info("replicating to remote cluster", "endpoints", remote.Endpoints, "namespaces", remote.Namespaces, "after_change", shipped)
+	}
+
+	// ── Vector clock pruning ───────────────────────────────────────────────
+	pruneCfg := cluster.ClockPruneConfig{After: *clockPruneAfter, MaxEntries: *clockMaxEntries}
+	if err := replicator.OpenClockPruning(filepath.Join(nodeDataDir, "departed.json"), pruneCfg); err != nil {
+		fatal("open departed nodes", "error", err)
+	}
+
+	// ── Two-phase transactions ─────────────────────────────────────────────
+	open, err := replicator.OpenTxnLog(filepath.Join(nodeDataDir, "txn.log"))
+	if err != nil {
+		fatal("open transaction log", "error", err)
+	}
+	if open > 0 {
+		slog.Info("resuming two-phase transactions", "open", open)
+	}
+	defer replicator.CloseTxnLog()
+
+	// ── Cluster snapshots ──────────────────────────────────────────────────
+	replicator.SetSnapshotDir(filepath.Join(nodeDataDir, "cluster-snapshots"))
+
+	// ── Reloadable settings ────────────────────────────────────────────────
+	// The flags above are the base; --config overrides them and can be
+	// re-read at runtime (see reload.go).
+	base := settings{
+		LogLevel: *logLevel,
+		RateLimit: api.RateLimitConfig{
+			IPRequests:    *rateIP,
+			IPBytes:       *rateIPBytes,
+			TokenRequests: *rateToken,
+			TokenBytes:    *rateTokenBytes,
+			Burst:         *rateBurst,
+		},
+		Timeouts: replicator.Timeouts(),
+		Slow:     replicator.SlowThresholds(),
+	}
+	limiter := api.NewRateLimiter(base.RateLimit)
+	reload := &reloader{
+		file:    *configFile,
+		base:    base,
+		current: base,
+		limiter: limiter,
+		rep:     replicator,
+		keyPair: keyPair,
+	}
+	if _, err := reload.reload(context.Background()); err != nil {
+		fatal("load --config", "error", err)
+	}
+	reload.reloadOnSIGHUP()
 
 	// ── HTTP server ────────────────────────────────────────────────────────
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
-	router.Use(api.Logger(), api.Recovery())
+	reg := metrics.NewRegistry()
+	router.Use(api.RequestID(), api.RequestMetrics(reg), api.Logger(), api.Recovery(), api.Auth(authn), limiter.Middleware(),
+		api.Compression(*compressionThreshold), api.BodyLimit(*maxBodySize), api.ValidateRequests())
+	if tlsCfg != nil && *tlsCA != "" {
+		router.Use(api.RequirePeerCert())
+	}
 
 	handler := api.NewHandler(s, replicator, membership, *nodeID)
+	handler.SetIdempotencyTTL(*idempotencyTTL)
+	handler.SetReloader(reload.reload)
+	handler.SetMetrics(reg)
+	replicator.RegisterMetrics(reg)
+	s.RegisterMetrics(reg)
 	handler.Register(router)
+	srv.RegisterOnShutdown(handler.StopWatches)
+	routes.set(router)
+	q := replicator.Quorum()
+	slog.Info("started", "took", time.Since(startedAt).Round(time.Millisecond), "n", q.N, "w", q.W, "r", q.R)
 
-	// Health check endpoint — useful for load balancers and readiness probes.
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"node":   *nodeID,
-			"status": "ok",
-			"nodes":  membership.Ring().NodeCount(),
-		})
-	})
-
-	srv := &http.Server{
-		Addr:         *addr,
-		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	if *joinAddr != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := replicator.Announce(ctx, selfNode); err != nil {
+			slog.Error("announce to some members failed; they will not route to us until joined", "error", err)
+		} else {
+			slog.Info("joined cluster", "seed", *joinAddr)
+		}
+		cancel()
 	}
 
+	// Background snapshots (when the WAL calls for one), WAL compaction,
+	// free disk space, hinted-handoff, async replication delivery and
+	// two-phase transaction recovery.
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	go s.RunSnapshots(bgCtx, snapPolicy)
+	go s.RunWALCompaction(bgCtx, compactBytes)
+	go s.RunDiskMonitor(bgCtx)
+	go replicator.RunHintedHandoff(bgCtx, 10*time.Second)
+	go replicator.RunOutbox(bgCtx, time.Second)
+	go replicator.RunTxnRecovery(bgCtx, 10*time.Second)
+	go replicator.RunReadiness(bgCtx) // coordinator routes open once ready
+	go replicator.RunReadCache(bgCtx)
+	go replicator.RunEvictionWebhook(bgCtx, evictHook)
+	go replicator.RunSinks(bgCtx)
+	go replicator.RunRemoteCluster(bgCtx)
+	go replicator.RunClockPruning(bgCtx)
+	go replicator.RunACLSync(bgCtx)
+	go replicator.RunExpiry(bgCtx)
+
 	// ── Graceful shutdown ──────────────────────────────────────────────────
-	// Listen for SIGINT/SIGTERM and give in-flight requests 15s to complete.
-	go func() {
-		log.Printf("Node %s listening on %s (N=%d W=%d R=%d)", *nodeID, *addr, n, w, r)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("server error: %v", err)
+	// On SIGINT/SIGTERM, hand over before exiting (see cluster/shutdown.go):
+	// stop taking client requests and tell the peers, let the requests in
+	// flight finish, pass on hints, then snapshot. All within --shutdown-timeout.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	stoppingAt := time.Now()
+
+	slog.Info("shutting down", "mode", *shutdownMode, "timeout", *shutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	replicator.BeginShutdown(ctx)
+
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("server shutdown failed", "error", err)
+	}
+	if grpcSrv != nil {
+		// Watches were ended with the HTTP server's; wait for the rest.
+		stopped := make(chan struct{})
+		go func() { grpcSrv.GracefulStop(); close(stopped) }()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcSrv.Stop()
 		}
-	}()
+	}
+	stopBackground()
+	replicator.HandOver(ctx)
+
+	// Take a final snapshot before exiting (a delta, if the policy allows).
+	if _, err := s.SnapshotDelta(snapPolicy.MaxDeltas); err != nil {
+		slog.Error("final snapshot failed", "error", err)
+	}
+	slog.Info("shut down", "took", time.Since(stoppingAt).Round(time.Millisecond))
+}
 
-	// Background snapshot every 60 seconds.
+// logRecovery logs the store's loading progress every interval until the
+// returned func is called.
+func logRecovery(rec *store.Recovery, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(60 * time.Second)
-		defer ticker.Stop()
-		for range ticker.C {
-			if err := s.Snapshot(); err != nil {
-				log.Printf("snapshot error: %v", err)
-			} else {
-				log.Printf("snapshot saved")
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				st := rec.Status()
+				slog.Info("loading store", "phase", st.Phase, "file", st.File,
+					"bytes", st.BytesDone, "of", st.BytesTotal,
+					"snapshot_keys", st.SnapshotKeys, "wal_entries", st.WALEntries,
+					"elapsed", time.Duration(st.ElapsedMs)*time.Millisecond,
+					"remaining", time.Duration(st.RemainingMs)*time.Millisecond)
 			}
 		}
 	}()
+	return func() { close(done) }
+}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+// fatal logs at ERROR level and exits.
+// slog has no Fatal, so this replaces log.Fatalf.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
 
-	log.Println("Shutting down node", *nodeID)
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
+// handlerSwitch serves whichever handler was set last.
+type handlerSwitch struct {
+	h atomic.Pointer[http.Handler]
+}
 
-	// Take a final snapshot before exiting.
-	if err := s.Snapshot(); err != nil {
-		log.Printf("final snapshot error: %v", err)
-	}
+func (hs *handlerSwitch) set(h http.Handler) { hs.h.Store(&h) }
 
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("server shutdown error: %v", err)
-	}
+func (hs *handlerSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*hs.h.Load()).ServeHTTP(w, r)
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"distributed-kvstore/internal/api"
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/logging"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Some settings can change without a restart. They live in the file
+// given by --config, a JSON object keyed by flag name:
+//
+//	{
+//	  "log-level": "debug",
+//	  "rate-limit-ip": 200,
+//	  "quorum-timeout": "800ms"
+//	}
+//
+// A key in the file overrides the flag; removing it goes back to the
+// flag's value. The TLS cert/key files are re-read too, so a renewed
+// certificate is picked up in place.
+//
+// SIGHUP or POST /admin/reload triggers a reload. Everything is parsed
+// and validated first: a bad file changes nothing.
+
+// reloadFlags are the flags --config may set.
+var reloadFlags = []string{
+	"log-level",
+	"rate-limit-ip", "rate-limit-ip-bytes", "rate-limit-token", "rate-limit-token-bytes", "rate-limit-burst",
+	"quorum-timeout", "peer-timeout", "replicate-attempts", "retry-backoff",
+	"slow-write", "slow-read", "slow-replicate", "slow-fetch",
+}
+
+// settings is everything a reload can change.
+type settings struct {
+	LogLevel  string
+	RateLimit api.RateLimitConfig
+	Timeouts  cluster.Timeouts
+	Slow      cluster.SlowThresholds
+}
+
+// reloader applies the --config file on top of the flags.
+type reloader struct {
+	file    string   // "" = only the TLS cert is reloadable
+	base    settings // from the flags
+	limiter *api.RateLimiter
+	rep     *cluster.Replicator
+	keyPair *cluster.KeyPair // nil without TLS
+
+	mu      sync.Mutex // one reload at a time
+	current settings
+}
+
+// reload re-reads the config file and the TLS cert and applies what
+// changed. It returns the names of the changed settings.
+func (r *reloader) reload(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := next.Timeouts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := next.Slow.Validate(); err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	if r.keyPair != nil {
+		// Reload keeps the old cert on error, so this can go first.
+		certChanged, err := r.keyPair.Reload()
+		if err != nil {
+			return nil, err
+		}
+		if certChanged {
+			changed = append(changed, "tls-cert")
+		}
+	}
+	if next.LogLevel != r.current.LogLevel {
+		logging.SetLevel(next.LogLevel)
+		changed = append(changed, "log-level")
+	}
+	if next.RateLimit != r.current.RateLimit {
+		r.limiter.SetConfig(next.RateLimit)
+		changed = append(changed, "rate-limits")
+	}
+	if next.Timeouts != r.current.Timeouts {
+		r.rep.SetTimeouts(next.Timeouts)
+		changed = append(changed, "timeouts")
+	}
+	if next.Slow != r.current.Slow {
+		r.rep.SetSlowThresholds(next.Slow)
+		changed = append(changed, "slow-thresholds")
+	}
+	r.current = next
+
+	if len(changed) > 0 {
+		logging.FromContext(ctx).Info("configuration reloaded", "changed", changed)
+	}
+	return changed, nil
+}
+
+// load returns the flag settings overlaid with the config file.
+func (r *reloader) load() (settings, error) {
+	s := r.base
+	if r.file == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(r.file)
+	if err != nil {
+		return s, fmt.Errorf("read config: %w", err)
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return s, fmt.Errorf("parse config %s: %w", r.file, err)
+	}
+
+	for name, raw := range entries {
+		if !slices.Contains(reloadFlags, name) {
+			return s, fmt.Errorf("config %s: %q cannot be reloaded (reloadable: %v)", r.file, name, reloadFlags)
+		}
+		// Accept both "800ms" and 200: unquote strings, keep the rest as is.
+		v := string(raw)
+		var str string
+		if json.Unmarshal(raw, &str) == nil {
+			v = str
+		}
+		if err := s.set(name, v); err != nil {
+			return s, fmt.Errorf("config %s: invalid %s: %w", r.file, name, err)
+		}
+	}
+	return s, nil
+}
+
+// set parses v into the setting of flag name.
+func (s *settings) set(name, v string) error {
+	var err error
+	switch name {
+	case "log-level":
+		if !logging.ValidLevel(v) {
+			return fmt.Errorf("must be debug, info, warn or error")
+		}
+		s.LogLevel = v
+	case "rate-limit-ip":
+		s.RateLimit.IPRequests, err = strconv.ParseFloat(v, 64)
+	case "rate-limit-ip-bytes":
+		s.RateLimit.IPBytes, err = strconv.ParseFloat(v, 64)
+	case "rate-limit-token":
+		s.RateLimit.TokenRequests, err = strconv.ParseFloat(v, 64)
+	case "rate-limit-token-bytes":
+		s.RateLimit.TokenBytes, err = strconv.ParseFloat(v, 64)
+	case "rate-limit-burst":
+		s.RateLimit.Burst, err = time.ParseDuration(v)
+	case "quorum-timeout":
+		s.Timeouts.Quorum, err = time.ParseDuration(v)
+	case "peer-timeout":
+		s.Timeouts.Peer, err = time.ParseDuration(v)
+	case "replicate-attempts":
+		s.Timeouts.Attempts, err = strconv.Atoi(v)
+	case "retry-backoff":
+		s.Timeouts.RetryBackoff, err = time.ParseDuration(v)
+	case "slow-write":
+		s.Slow.Write, err = time.ParseDuration(v)
+	case "slow-read":
+		s.Slow.Read, err = time.ParseDuration(v)
+	case "slow-replicate":
+		s.Slow.Replicate, err = time.ParseDuration(v)
+	case "slow-fetch":
+		s.Slow.Fetch, err = time.ParseDuration(v)
+	default:
+		panic("unhandled reloadable flag " + name)
+	}
+	return err
+}
+
+// reloadOnSIGHUP reloads every time the process gets SIGHUP.
+func (r *reloader) reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			changed, err := r.reload(context.Background())
+			switch {
+			case err != nil:
+				slog.Error("reload failed; keeping the current configuration", "error", err)
+			case len(changed) == 0:
+				slog.Info("reload: nothing changed")
+			}
+		}
+	}()
+}
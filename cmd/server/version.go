@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"runtime/debug"
+	"strings"
+)
+
+// version is set at build time:
+//
+//	go build -ldflags "-X main.version=v1.4.0" ./cmd/server
+//
+// Unset, buildVersion falls back to what the Go toolchain recorded.
+var version string
+
+// pseudoVersion matches the tail of a Go pseudo-version
+// (v0.0.0-20260102150405-abcdef123456), which go build stamps on
+// untagged checkouts.
+var pseudoVersion = regexp.MustCompile(`\d{14}-[0-9a-f]{12}$`)
+
+// buildVersion returns the version this binary reports in /health and
+// the cluster stats: the -X value, else a release's module version
+// (v1.4.0), else the short VCS revision, else "dev".
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "dev"
+	}
+	v := bi.Main.Version
+	if v == "(devel)" {
+		v = ""
+	}
+	if v != "" && !strings.Contains(v, "+") && !pseudoVersion.MatchString(v) {
+		return v // a clean release build
+	}
+	rev, dirty := "", false
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			rev = s.Value[:min(len(s.Value), 12)]
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	switch {
+	case rev == "" && v != "":
+		return v
+	case rev == "":
+		return "dev"
+	case dirty:
+		return rev + "-dirty"
+	}
+	return rev
+}
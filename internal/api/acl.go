@@ -0,0 +1,186 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Access control lists ─────────────────────────────────────────────────────
+//
+// Per-token key prefix rules (see cluster/acl.go), checked before a
+// request is served or forwarded. Forwarded requests carry the peer's
+// credentials and are not checked again.
+
+// errACLDenied is returned for keys a token's ACL does not allow.
+var errACLDenied = errors.New("denied by ACL")
+
+// aclSubject returns the token name ACLs apply to, or "" if the caller
+// is not restricted: auth off, a peer, an admin token, or no rules. A
+// principal that brings its own rules (an OIDC role) is held to those.
+func (h *Handler) aclSubject(c *gin.Context) (string, cluster.ACLConfig) {
+	p := CurrentPrincipal(c)
+	if p == nil || p.Cluster || p.Has(ScopeAdmin) {
+		return "", cluster.ACLConfig{}
+	}
+	if len(p.Rules) > 0 {
+		return p.Name, cluster.ACLConfig{Tokens: map[string][]cluster.ACLRule{p.Name: p.Rules}}
+	}
+	acl := h.replicator.ACLs()
+	if !acl.Restricted(p.Name) {
+		return "", cluster.ACLConfig{}
+	}
+	return p.Name, acl
+}
+
+// checkKeyACL returns errACLDenied if the caller may not read (or
+// write) the internal key.
+func (h *Handler) checkKeyACL(c *gin.Context, key string, write bool) error {
+	token, acl := h.aclSubject(c)
+	if token == "" || acl.Allows(token, key, write) {
+		return nil
+	}
+	verb := "read"
+	if write {
+		verb = "write"
+	}
+	return fmt.Errorf("%w: token %s may not %s %s", errACLDenied, token, verb, key)
+}
+
+// checkPrefixACL returns errACLDenied if the caller may not read every
+// key under the internal prefix.
+func (h *Handler) checkPrefixACL(c *gin.Context, prefix string) error {
+	token, acl := h.aclSubject(c)
+	if token == "" || acl.AllowsPrefix(token, prefix) {
+		return nil
+	}
+	return fmt.Errorf("%w: token %s may not read all of %q", errACLDenied, token, prefix)
+}
+
+// enforceACL returns middleware checking the route's key or prefix:
+//
+//	/kv/:namespace/:key...  the key; GET reads, the rest write
+//	/kv/:namespace          the namespace
+//	/kv?namespace=&prefix=  the namespace and prefix scanned
+//	/watch/:namespace       the namespace and prefix watched
+//	/cdc?namespace=         the namespace, or everything
+//	/locks/:name...         the lock's key in the locks namespace
+//
+// /batch, /txn and /kv/mget check each key themselves.
+func (h *Handler) enforceACL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead
+		ns := c.Param("namespace")
+		var err error
+		switch {
+		case c.Param("key") != "":
+			err = h.checkKeyACL(c, store.NamespacedKey(ns, c.Param("key")), write)
+		case c.Param("name") != "":
+			err = h.checkKeyACL(c, store.NamespacedKey(store.LocksNamespace, c.Param("name")), write)
+		case c.FullPath() == "/kv":
+			err = h.checkPrefixACL(c, store.NamespacedKey(c.DefaultQuery("namespace", store.DefaultNamespace), c.Query("prefix")))
+		case c.FullPath() == "/cdc":
+			prefix := ""
+			if ns := c.Query("namespace"); ns != "" {
+				prefix = store.NamespacedKey(ns, "")
+			}
+			err = h.checkPrefixACL(c, prefix)
+		case ns != "":
+			err = h.checkPrefixACL(c, store.NamespacedKey(ns, c.Query("prefix")))
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListACLs handles GET /admin/acl
+func (h *Handler) ListACLs(c *gin.Context) {
+	acl := h.replicator.ACLs()
+	if acl.Tokens == nil {
+		acl.Tokens = map[string][]cluster.ACLRule{}
+	}
+	c.JSON(http.StatusOK, acl)
+}
+
+// GetACL handles GET /admin/acl/:token
+// A token without rules is not restricted, and has an empty list.
+func (h *Handler) GetACL(c *gin.Context) {
+	acl := h.replicator.ACLs()
+	rules := acl.Tokens[c.Param("token")]
+	if rules == nil {
+		rules = []cluster.ACLRule{}
+	}
+	c.JSON(http.StatusOK, gin.H{"token": c.Param("token"), "rules": rules, "version": acl.Version})
+}
+
+// SetACL handles PUT /admin/acl/:token
+//
+// Body: {"rules": [{"prefix": "config/", "access": "read"}, {"prefix": "app1/", "access": "readwrite"}]}
+//
+// Replaces the token's rules on every node. Peers that could not be
+// reached are reported as a warning; they catch up by themselves.
+func (h *Handler) SetACL(c *gin.Context) {
+	var body struct {
+		Rules []cluster.ACLRule `json:"rules" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sort.Slice(body.Rules, func(i, j int) bool { return body.Rules[i].Prefix < body.Rules[j].Prefix })
+	h.setACL(c, body.Rules)
+}
+
+// DeleteACL handles DELETE /admin/acl/:token
+// Removes the token's rules: it is no longer restricted.
+func (h *Handler) DeleteACL(c *gin.Context) {
+	h.setACL(c, nil)
+}
+
+func (h *Handler) setACL(c *gin.Context, rules []cluster.ACLRule) {
+	ctx := c.Request.Context()
+	acl, err := h.replicator.SetACL(ctx, c.Param("token"), rules)
+	if errors.Is(err, cluster.ErrInvalidACL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if rules == nil {
+		rules = []cluster.ACLRule{}
+	}
+	resp := gin.H{"token": c.Param("token"), "rules": rules, "version": acl.Version}
+	if err != nil {
+		logging.FromContext(ctx).Warn("ACL propagation incomplete", "error", err)
+		resp["warning"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// InternalGetACLs handles GET /internal/acl
+// This node's ACLs, for a peer catching up.
+func (h *Handler) InternalGetACLs(c *gin.Context) {
+	c.JSON(http.StatusOK, h.replicator.ACLs())
+}
+
+// InternalPutACLs handles PUT /internal/acl
+// Applies ACLs broadcast by a peer, if they are newer than ours.
+func (h *Handler) InternalPutACLs(c *gin.Context) {
+	var acl cluster.ACLConfig
+	if err := c.ShouldBindJSON(&acl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.replicator.ApplyACLs(c.Request.Context(), acl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,358 @@
+package api
+
+import (
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Admin handlers ──────────────────────────────────────────────────────────
+//
+// Operator-only endpoints (admin scope when auth is enabled).
+
+// registerAdmin mounts /admin/* routes.
+func (h *Handler) registerAdmin(r *gin.Engine) {
+	admin := r.Group("/admin", h.audited()) // mutations are audited (see audit.go)
+	admin.GET("/backup", h.Backup)
+	admin.POST("/restore", h.Restore)
+	admin.GET("/shards", h.Shards)
+	admin.GET("/locate/:key", h.Locate)
+	admin.POST("/repair", h.StartRepair)
+	admin.GET("/repair", h.RepairStatus)
+	admin.POST("/repair/:key", h.RepairKey)
+	admin.GET("/replication", h.Replication)
+	admin.GET("/stats", h.Stats)
+	admin.GET("/hotkeys", h.HotKeys)
+	admin.GET("/quorum", h.GetQuorum)
+	admin.PUT("/quorum", h.SetQuorum)
+	admin.POST("/reload", h.Reload)
+	admin.GET("/audit", h.AuditLog)
+
+	// Per-token key prefix rules (see acl.go).
+	admin.GET("/acl", h.ListACLs)
+	admin.GET("/acl/:token", h.GetACL)
+	admin.PUT("/acl/:token", h.SetACL)
+	admin.DELETE("/acl/:token", h.DeleteACL)
+
+	// Coordinated cluster snapshots (see snapshot.go).
+	admin.POST("/cluster-snapshot", h.StartClusterSnapshot)
+	admin.GET("/cluster-snapshot", h.ListClusterSnapshots)
+	admin.GET("/cluster-snapshot/:id", h.ClusterSnapshot)
+	admin.GET("/cluster-snapshot/:id/:node", h.ClusterSnapshotPart)
+	admin.DELETE("/cluster-snapshot/:id", h.DeleteClusterSnapshot)
+}
+
+// Reloader re-reads the node's reloadable settings and applies them.
+// It returns the names of the settings that changed. On error nothing
+// is applied.
+type Reloader func(ctx context.Context) (changed []string, err error)
+
+// SetReloader enables POST /admin/reload.
+func (h *Handler) SetReloader(r Reloader) {
+	h.reload = r
+}
+
+// Reload handles POST /admin/reload
+// Same as sending the node SIGHUP: re-reads its --config file.
+func (h *Handler) Reload(c *gin.Context) {
+	if h.reload == nil {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "reload is not configured on this node"})
+		return
+	}
+	changed, err := h.reload(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"node": h.selfID, "reloaded": changed})
+}
+
+// GetQuorum handles GET /admin/quorum
+// Returns this node's quorum config and the last re-replication pass.
+func (h *Handler) GetQuorum(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"quorum":        h.replicator.Quorum(),
+		"rereplication": h.replicator.Rereplication(),
+	})
+}
+
+// SetQuorum handles PUT /admin/quorum
+//
+// Body: {"n": 3, "w": 2, "r": 2}
+//
+// Applies the new N/W/R on every node (see cluster/quorum.go).
+// Peers that could not be reached are reported as a warning;
+// re-running the command brings them up to date.
+func (h *Handler) SetQuorum(c *gin.Context) {
+	var body struct {
+		N int `json:"n" binding:"required"`
+		W int `json:"w" binding:"required"`
+		R int `json:"r" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	q, err := h.replicator.SetQuorum(ctx, body.N, body.W, body.R)
+	if errors.Is(err, cluster.ErrInvalidQuorum) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"quorum": q}
+	if err != nil {
+		logging.FromContext(ctx).Warn("quorum propagation incomplete", "error", err)
+		resp["warning"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// InternalQuorum handles PUT /internal/quorum
+// Applies a quorum config broadcast by a peer, if it is newer than ours.
+func (h *Handler) InternalQuorum(c *gin.Context) {
+	var q cluster.QuorumConfig
+	if err := c.ShouldBindJSON(&q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.replicator.ApplyQuorum(c.Request.Context(), q); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Replication handles GET /admin/replication
+//
+// Aggregates every node's replication counters: last successful
+// replication per peer, retries, failures, pending hints, read repairs.
+func (h *Handler) Replication(c *gin.Context) {
+	c.JSON(http.StatusOK, h.replicator.ReplicationReport(c.Request.Context()))
+}
+
+// InternalReplication handles GET /internal/replication
+// Returns this node's replication counters.
+func (h *Handler) InternalReplication(c *gin.Context) {
+	c.JSON(http.StatusOK, h.replicator.LocalReplicationReport())
+}
+
+// Stats handles GET /admin/stats
+//
+// Every node's key and tombstone counts, value bytes, WAL size and
+// last snapshot time.
+func (h *Handler) Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.replicator.Stats(c.Request.Context()))
+}
+
+// InternalStats handles GET /internal/stats
+// Returns this node's store statistics.
+func (h *Handler) InternalStats(c *gin.Context) {
+	c.JSON(http.StatusOK, h.replicator.LocalStats())
+}
+
+// HotKeys handles GET /admin/hotkeys?limit=
+//
+// Every node's most used keys, hottest first (see cluster/hotkeys.go).
+// limit is per node: 10 by default, at most cluster.MaxHotKeys.
+func (h *Handler) HotKeys(c *gin.Context) {
+	limit, ok := hotKeysLimit(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, h.replicator.HotKeys(c.Request.Context(), limit))
+}
+
+// InternalHotKeys handles GET /internal/hotkeys?limit=
+// Returns this node's hottest keys.
+func (h *Handler) InternalHotKeys(c *gin.Context) {
+	limit, ok := hotKeysLimit(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, h.replicator.LocalHotKeys(limit))
+}
+
+func hotKeysLimit(c *gin.Context) (int, bool) {
+	limit := 10
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > cluster.MaxHotKeys {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(cluster.MaxHotKeys)})
+			return 0, false
+		}
+		limit = n
+	}
+	return limit, true
+}
+
+// Shards handles GET /admin/shards
+//
+// Returns the ring's token ranges with their replicas and,
+// for each replica, how many keys/bytes it holds in that range.
+func (h *Handler) Shards(c *gin.Context) {
+	c.JSON(http.StatusOK, h.replicator.Shards(c.Request.Context()))
+}
+
+// Locate handles GET /admin/locate/:key?namespace=default
+//
+// Shows the key's token, its range and which replicas own it,
+// with what each replica currently holds.
+func (h *Handler) Locate(c *gin.Context) {
+	ns := c.DefaultQuery("namespace", store.DefaultNamespace)
+	if !store.ValidNamespace(ns) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrInvalidNamespace.Error()})
+		return
+	}
+	loc := h.replicator.Locate(c.Request.Context(), store.NamespacedKey(ns, c.Param("key")))
+	c.JSON(http.StatusOK, gin.H{"namespace": ns, "location": loc})
+}
+
+// RepairKey handles POST /admin/repair/:key?namespace=default
+//
+// Reads the key from all N replicas, reconciles and writes the winner
+// back to every replica that lacks it before answering. Replicas that
+// could not be repaired are listed under "failed" (and hinted), with a
+// warning.
+func (h *Handler) RepairKey(c *gin.Context) {
+	ns := c.DefaultQuery("namespace", store.DefaultNamespace)
+	if !store.ValidNamespace(ns) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrInvalidNamespace.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	r, err := h.replicator.RepairKey(ctx, store.NamespacedKey(ns, c.Param("key")))
+
+	resp := gin.H{"namespace": ns, "repair": r}
+	if err != nil {
+		logging.FromContext(ctx).Warn("key repair incomplete", "key", r.Key, "failed", r.Failed)
+		resp["warning"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// StartRepair handles POST /admin/repair?node=<id>
+//
+// Starts a full repair (see cluster/repair.go) on node, by default this
+// one, and returns its status at once. If one is already running there,
+// returns that one. Poll GET /admin/repair?node=<id> for progress.
+func (h *Handler) StartRepair(c *gin.Context) {
+	if id := c.Query("node"); id != "" && id != h.selfID {
+		h.forwardToNode(c, id, nil)
+		return
+	}
+	c.JSON(http.StatusAccepted, h.replicator.StartRepair(c.Request.Context()))
+}
+
+// RepairStatus handles GET /admin/repair?node=<id>
+// Returns the progress of the last full repair started on node.
+func (h *Handler) RepairStatus(c *gin.Context) {
+	if id := c.Query("node"); id != "" && id != h.selfID {
+		h.forwardToNode(c, id, nil)
+		return
+	}
+	c.JSON(http.StatusOK, h.replicator.RepairStatus())
+}
+
+// InternalDigests handles GET /internal/digests?start=&end=
+// Returns a digest of every local key in the token range (start, end].
+func (h *Handler) InternalDigests(c *gin.Context) {
+	start, err1 := strconv.ParseUint(c.Query("start"), 10, 32)
+	end, err2 := strconv.ParseUint(c.Query("end"), 10, 32)
+	if err := errors.Join(err1, err2); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start and end must be ring tokens"})
+		return
+	}
+	tr := cluster.TokenRange{Start: uint32(start), End: uint32(end)}
+	c.JSON(http.StatusOK, gin.H{"digests": h.replicator.LocalDigests(tr)})
+}
+
+// InternalShards handles GET /internal/shards
+// Returns this node's key counts grouped by token range.
+func (h *Handler) InternalShards(c *gin.Context) {
+	c.JSON(http.StatusOK, h.replicator.LocalShardUsage())
+}
+
+// Backup handles GET /admin/backup?scope=node|cluster
+//
+// Streams a .kvbak archive (see store/backup.go).
+//
+//	scope=node    → only this node's data (default)
+//	scope=cluster → this node fans out to every peer and merges
+func (h *Handler) Backup(c *gin.Context) {
+	scope := c.DefaultQuery("scope", "node")
+	if scope != "node" && scope != "cluster" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be node or cluster"})
+		return
+	}
+
+	startStream(c, "application/x-kvbak")
+	c.Header("Content-Disposition", `attachment; filename="`+h.selfID+`.kvbak"`)
+	c.Status(http.StatusOK)
+	c.Writer.Flush() // commit headers; the archive body follows
+
+	var err error
+	if scope == "cluster" {
+		err = h.replicator.BackupCluster(c.Request.Context(), c.Writer)
+	} else {
+		err = h.store.Backup(c.Writer)
+	}
+	if err != nil {
+		// Headers are already sent; the truncated archive tells the
+		// client something went wrong. Log it for the operator.
+		_ = c.Error(err)
+		CurrentLogger(c).Error("backup failed", "scope", scope, "error", err)
+	}
+}
+
+// Restore handles POST /admin/restore?map=old=new,…
+// Body: a .kvbak archive.
+//
+// Every record is routed to its owners under the current ring; map
+// renames the backed-up nodes in the records' clocks (see cluster.Restore).
+func (h *Handler) Restore(c *gin.Context) {
+	startStream(c, "")
+
+	nodeMap, err := cluster.ParseNodeMap(c.Query("map"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	stats, err := h.replicator.Restore(c.Request.Context(), c.Request.Body, nodeMap)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "stats": stats})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// InternalBackup handles GET /internal/backup
+// Streams this node's backup to the coordinator of a cluster backup.
+func (h *Handler) InternalBackup(c *gin.Context) {
+	startStream(c, "application/x-kvbak")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	if err := h.store.Backup(c.Writer); err != nil {
+		CurrentLogger(c).Error("internal backup failed", "error", err)
+	}
+}
+
+// startStream prepares a long-running request:
+//   - lifts the server's read/write deadlines (backups can take minutes)
+//   - sets the content type, if given
+func startStream(c *gin.Context, contentType string) {
+	rc := http.NewResponseController(c.Writer)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/logging"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Audit log ────────────────────────────────────────────────────────────────
+//
+// Mutations on /admin/*, /cluster/* and /namespaces/* are recorded in the
+// node's audit log once the handler has answered (see cluster/audit.go).
+
+// auditBodyMax is how much of a request body an audit entry keeps. The
+// admin bodies worth reading are small; a restore archive is not.
+const auditBodyMax = 4 << 10
+
+// audited returns middleware recording non-GET requests in the audit log.
+func (h *Handler) audited() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !h.replicator.Auditing() || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		body := &auditBody{r: c.Request.Body}
+		c.Request.Body = body
+
+		c.Next()
+
+		e := cluster.AuditEntry{
+			Actor:     "anonymous",
+			ClientIP:  c.ClientIP(),
+			RequestID: logging.RequestID(c.Request.Context()),
+			Action:    c.Request.Method + " " + c.FullPath(),
+			Path:      c.Request.URL.Path,
+			Status:    c.Writer.Status(),
+		}
+		if p := CurrentPrincipal(c); p != nil {
+			e.Actor = p.Name
+		}
+		if len(c.Params) > 0 || len(c.Request.URL.RawQuery) > 0 {
+			e.Params = make(map[string]string)
+			for _, p := range c.Params {
+				e.Params[p.Key] = p.Value
+			}
+			for k, v := range c.Request.URL.Query() {
+				e.Params[k] = v[0]
+			}
+		}
+		if b := body.buf; !body.truncated && json.Valid(b) {
+			e.Body = redact(b)
+		}
+		h.replicator.Audit(c.Request.Context(), e)
+	}
+}
+
+// auditBody keeps the first auditBodyMax bytes the handler reads.
+type auditBody struct {
+	r         io.ReadCloser
+	buf       []byte
+	truncated bool
+}
+
+func (b *auditBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	keep := min(n, auditBodyMax-len(b.buf))
+	b.buf = append(b.buf, p[:keep]...)
+	if keep < n {
+		b.truncated = true
+	}
+	return n, err
+}
+
+func (b *auditBody) Close() error { return b.r.Close() }
+
+// redact blanks top-level fields that look like credentials.
+func redact(body []byte) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil {
+		return body
+	}
+	changed := false
+	for k := range fields {
+		lk := strings.ToLower(k)
+		if strings.Contains(lk, "token") || strings.Contains(lk, "secret") || strings.Contains(lk, "password") {
+			fields[k] = json.RawMessage(`"[redacted]"`)
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	out, _ := json.Marshal(fields)
+	return out
+}
+
+// AuditLog handles GET /admin/audit
+//
+// Query params (all optional):
+//
+//	since   RFC 3339 time; entries at or after it
+//	actor   token name, "cluster" or "anonymous"
+//	action  substring of "METHOD /route", e.g. "quorum" or "POST /cluster"
+//	limit   newest entries to return (default 100)
+func (h *Handler) AuditLog(c *gin.Context) {
+	if !h.replicator.Auditing() {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "audit log is not enabled on this node"})
+		return
+	}
+	q := cluster.AuditQuery{Actor: c.Query("actor"), Action: c.Query("action")}
+	if v := c.Query("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 time"})
+			return
+		}
+		q.Since = t
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		q.Limit = n
+	}
+	entries, err := h.replicator.AuditEntries(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if entries == nil {
+		entries = []cluster.AuditEntry{}
+	}
+	c.JSON(http.StatusOK, gin.H{"node": h.selfID, "entries": entries})
+}
@@ -0,0 +1,362 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"distributed-kvstore/internal/cluster"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// AUTHENTICATION
+////////////////////////////////////////////////////////////////////////////////
+
+// Why authentication?
+//
+// Without it, anyone who can reach the port can:
+//   - read and overwrite every key
+//   - POST fake values to /internal/replicate (they win by vector clock!)
+//   - add or remove nodes via /cluster/*
+//
+// We use two kinds of credentials:
+//
+//  1. API tokens — for clients. Each token has scopes:
+//     read  → GET on /kv
+//     write → PUT/DELETE/POST on /kv
+//     admin → everything a client can do, plus /admin/* and /cluster/*
+//
+//  2. The cluster token — shared by nodes only.
+//     Required on /internal/* (replica traffic).
+//     Also accepted on /cluster/* so nodes can manage membership.
+//
+// Both are sent as:
+//
+//	Authorization: Bearer <token>
+//
+// unless peers sign their requests with the cluster token instead
+// (peer_auth, see cluster/signing.go). With peer_auth "strict" the
+// cluster token is never accepted as a bearer token: /internal/* and
+// peer calls to /cluster/* need a signature or a verified client
+// certificate. Operators still manage membership with admin tokens.
+//
+// Clients may also present a JWT from an OIDC identity provider (see
+// oidc.go). Its roles map to the same scopes.
+//
+// If no credentials are configured, auth is disabled (open cluster).
+
+// Scope is a permission attached to an API token.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	ScopeAdmin Scope = "admin"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Name   string  `json:"name"`
+	Scopes []Scope `json:"scopes"`
+	// Cluster is true when the caller used the cluster token (a peer node),
+	// or signed with it.
+	Cluster bool `json:"cluster"`
+	// Rules confine the caller to key prefixes, as its cluster ACL would
+	// (see acl.go). Set by providers; nil = the cluster ACLs decide.
+	Rules []cluster.ACLRule `json:"rules,omitempty"`
+}
+
+// Has reports whether p holds scope s.
+// Admin implies every other scope.
+func (p *Principal) Has(s Scope) bool {
+	for _, have := range p.Scopes {
+		if have == s || have == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken is one entry in the tokens file.
+type APIToken struct {
+	Name   string  `json:"name"`
+	Token  string  `json:"token"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// AuthConfig is the on-disk format of --auth-file.
+//
+// Example:
+//
+//	{
+//	  "cluster_token": "long-random-secret",
+//	  "peer_auth": "signed",
+//	  "tokens": [
+//	    {"name": "app1", "token": "t1", "scopes": ["read", "write"]},
+//	    {"name": "ops",  "token": "t2", "scopes": ["admin"]}
+//	  ],
+//	  "oidc": {"issuer": "https://sso.example.com", "audience": "kvstore", "roles": {…}}
+//	}
+type AuthConfig struct {
+	ClusterToken string      `json:"cluster_token"`
+	PeerAuth     string      `json:"peer_auth,omitempty"` // cluster.PeerAuth*; "" = token. Signed requests are accepted once (nonce, see cluster/signing.go)
+	Tokens       []APIToken  `json:"tokens"`
+	OIDC         *OIDCConfig `json:"oidc,omitempty"` // also accept JWTs (oidc.go)
+}
+
+// LoadAuthConfig reads and validates an auth file.
+func LoadAuthConfig(path string) (*AuthConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg AuthConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse auth file: %w", err)
+	}
+	if cfg.PeerAuth == "" {
+		cfg.PeerAuth = cluster.PeerAuthToken
+	}
+	if !cluster.ValidPeerAuth(cfg.PeerAuth) {
+		return nil, fmt.Errorf("unknown peer_auth %q", cfg.PeerAuth)
+	}
+	if cfg.PeerAuth != cluster.PeerAuthToken && cfg.ClusterToken == "" {
+		return nil, fmt.Errorf("peer_auth %q needs a cluster_token to sign with", cfg.PeerAuth)
+	}
+	for _, t := range cfg.Tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("token %q has an empty secret", t.Name)
+		}
+		if err := validScopes(t.Scopes); err != nil {
+			return nil, fmt.Errorf("token %q: %w", t.Name, err)
+		}
+	}
+	if cfg.OIDC != nil {
+		if err := cfg.OIDC.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &cfg, nil
+}
+
+func validScopes(scopes []Scope) error {
+	for _, s := range scopes {
+		switch s {
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+		default:
+			return fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	return nil
+}
+
+// Provider authenticates bearer tokens that are not in the auth file,
+// such as JWTs from an identity provider. It returns nil, nil for a
+// token it does not recognize, and an error for one it recognizes and
+// refuses.
+type Provider interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Authenticator checks bearer tokens against an AuthConfig, then its
+// providers.
+type Authenticator struct {
+	cfg       *AuthConfig
+	providers []Provider
+	replays   *cluster.ReplayGuard // nonces of accepted peer signatures
+}
+
+// NewAuthenticator creates an Authenticator.
+// A nil config disables authentication.
+func NewAuthenticator(cfg *AuthConfig) *Authenticator {
+	a := &Authenticator{cfg: cfg}
+	if cfg != nil {
+		a.replays = cluster.NewReplayGuard(cfg.PeerAuth == cluster.PeerAuthStrict)
+	}
+	if cfg != nil && cfg.OIDC != nil {
+		a.providers = append(a.providers, newOIDCProvider(*cfg.OIDC))
+	}
+	return a
+}
+
+// Enabled reports whether any credentials are configured.
+func (a *Authenticator) Enabled() bool {
+	return a.cfg != nil && (a.cfg.ClusterToken != "" || len(a.cfg.Tokens) > 0 || len(a.providers) > 0)
+}
+
+// strict reports whether peers must sign (or present a certificate).
+func (a *Authenticator) strict() bool {
+	return a.cfg.PeerAuth == cluster.PeerAuthStrict
+}
+
+// authenticateRequest finds the caller of req: a peer that signed it, a
+// peer with a client certificate (strict only), or a bearer token. A
+// signature or JWT that does not verify is an error; no credential is a
+// nil Principal.
+func (a *Authenticator) authenticateRequest(req *http.Request) (*Principal, error) {
+	signs := a.cfg.PeerAuth == cluster.PeerAuthSigned || a.strict()
+	if signs && req.Header.Get(cluster.SignatureHeader) != "" {
+		if err := cluster.VerifyRequest(req, []byte(a.cfg.ClusterToken), time.Now(), a.replays); err != nil {
+			return nil, err
+		}
+		return &Principal{Name: "cluster", Cluster: true}, nil
+	}
+	if a.strict() && req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		return &Principal{Name: "cluster", Cluster: true}, nil
+	}
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if p, ok := a.authenticate(token); ok || token == "" {
+		return p, nil
+	}
+	for _, pr := range a.providers {
+		if p, err := pr.Authenticate(req.Context(), token); p != nil || err != nil {
+			return p, err
+		}
+	}
+	return nil, nil
+}
+
+// authenticate maps a raw token to a Principal.
+//
+// We compare in constant time so response timing
+// does not leak how much of a token was correct.
+func (a *Authenticator) authenticate(token string) (*Principal, bool) {
+	if token == "" {
+		return nil, false
+	}
+	if a.cfg.ClusterToken != "" && !a.strict() &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.ClusterToken)) == 1 {
+		return &Principal{Name: "cluster", Cluster: true}, true
+	}
+	for _, t := range a.cfg.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t.Token)) == 1 {
+			return &Principal{Name: t.Name, Scopes: t.Scopes}, true
+		}
+	}
+	return nil, false
+}
+
+// principalKey is the gin context key holding the *Principal.
+const principalKey = "principal"
+
+// CurrentPrincipal returns the authenticated caller, or nil
+// if auth is disabled.
+func CurrentPrincipal(c *gin.Context) *Principal {
+	p, _ := c.Get(principalKey)
+	pr, _ := p.(*Principal)
+	return pr
+}
+
+// callerName returns the name of the principal a request acts for: the
+// authenticated caller's, or for a request a peer forwarded, the one the
+// peer passed on in PrincipalHeader. "" if auth is disabled.
+func callerName(c *gin.Context) string {
+	p := CurrentPrincipal(c)
+	if p == nil {
+		return ""
+	}
+	if name := c.GetHeader(PrincipalHeader); p.Cluster && name != "" {
+		return name
+	}
+	return p.Name
+}
+
+// Auth returns middleware enforcing authentication on every route.
+//
+// The required credential depends on the route:
+//
+//	/healthz, /readyz → open (load balancers must reach them; /health too)
+//	/internal/*       → cluster token (or signature) only
+//	/cluster/*        → cluster token (or signature) or admin scope
+//	/admin/*          → admin scope
+//	/namespaces/*     → admin scope (except GET)
+//	/batch            → read scope; write scope too for puts and deletes
+//	POST /kv/mget     → read scope
+//	GET  anything     → read scope
+//	else              → write scope
+func Auth(a *Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !a.Enabled() || isProbePath(path) {
+			c.Next()
+			return
+		}
+
+		p, err := a.authenticateRequest(c.Request)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if p == nil && a.strict() && c.GetHeader(cluster.PeerHeader) != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "peer requests must be signed"})
+			return
+		}
+		if p == nil {
+			c.Header("WWW-Authenticate", `Bearer realm="kvstore"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid token"})
+			return
+		}
+
+		if !allowed(p, c.Request.Method, path) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token lacks required scope"})
+			return
+		}
+
+		c.Set(principalKey, p)
+		c.Next()
+	}
+}
+
+// allowed decides whether p may call method on path.
+func allowed(p *Principal, method, path string) bool {
+	switch {
+	case strings.HasPrefix(path, "/internal/"):
+		return p.Cluster
+	case path == "/cluster/status" && method == http.MethodGet:
+		// Smart clients need the topology to route keys.
+		return p.Cluster || p.Has(ScopeRead)
+	case strings.HasPrefix(path, "/cluster/"):
+		return p.Cluster || p.Has(ScopeAdmin)
+	case strings.HasPrefix(path, "/admin/"):
+		return p.Has(ScopeAdmin)
+	case strings.HasPrefix(path, "/namespaces") && method != http.MethodGet:
+		return p.Has(ScopeAdmin)
+	case path == "/batch":
+		// Batch checks the write scope per op, so readers can batch gets.
+		return p.Cluster || p.Has(ScopeRead)
+	case path == "/kv/mget":
+		return p.Cluster || p.Has(ScopeRead)
+	case p.Cluster:
+		// Peers may use the public API too (e.g. request forwarding).
+		return true
+	case method == http.MethodGet || method == http.MethodHead:
+		return p.Has(ScopeRead)
+	default:
+		return p.Has(ScopeWrite)
+	}
+}
+
+// RequirePeerCert rejects /internal/* requests that did not present
+// a verified client certificate.
+//
+// Used when the node runs with mutual TLS: the TLS layer has already
+// checked the certificate against the cluster CA, we only need to make
+// sure one was presented at all (public clients may connect without).
+func RequirePeerCert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/internal/") {
+			tls := c.Request.TLS
+			if tls == nil || len(tls.VerifiedChains) == 0 {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "client certificate required"})
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Batches ──────────────────────────────────────────────────────────────────
+//
+//	POST /batch
+//	{"ops": [{"op": "put",    "namespace": "users", "key": "42", "value": "alice"},
+//	         {"op": "get",    "key": "config"},
+//	         {"op": "delete", "key": "tmp"}]}
+//	→ 200 {"results": [{"status": 200, "clock": {...}},
+//	                   {"status": 200, "value": "...", "clock": {...}, "updated_at": ...},
+//	                   {"status": 404, "error": "key not found"}]}
+//
+// Many independent operations in one round trip. Unlike /txn nothing is
+// atomic: each op succeeds or fails alone, with the status its own
+// request would have had. Ops on one key run in order; others run in
+// parallel. On a fenced node (cluster/fencing.go) the puts and deletes
+// fail with 503 and the gets still run.
+//
+// Ops are grouped by replica set. Groups this node coordinates run here;
+// each other group goes to an owner as one smaller batch, so a batch
+// costs one hop per replica set, not one per key.
+
+// MaxBatchOps caps the operations in one batch.
+const MaxBatchOps = 1000
+
+// batchParallelism caps the keys of one batch worked on at once.
+const batchParallelism = 32
+
+// errInvalidBatchOp is a 400 for one op.
+var errInvalidBatchOp = errors.New("invalid batch op")
+
+// batchOp is one operation of POST /batch.
+type batchOp struct {
+	Op          string `json:"op"`                  // get, put, delete
+	Namespace   string `json:"namespace,omitempty"` // "" = default
+	Key         string `json:"key"`
+	Value       string `json:"value,omitempty"`        // put
+	ContentType string `json:"content_type,omitempty"` // put
+}
+
+// batchResult is the outcome of one op, at the same index.
+type batchResult struct {
+	Status      int               `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Value       *string           `json:"value,omitempty"` // get
+	Clock       store.VectorClock `json:"clock,omitempty"`
+	UpdatedAt   *time.Time        `json:"updated_at,omitempty"` // get
+	ContentType string            `json:"content_type,omitempty"`
+	Replication string            `json:"replication,omitempty"` // put, delete: "async" if queued
+}
+
+func failed(status int, err error) batchResult {
+	return batchResult{Status: status, Error: err.Error()}
+}
+
+// Batch handles POST /batch
+func (h *Handler) Batch(c *gin.Context) {
+	var body struct {
+		Ops []batchOp `json:"ops"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		bodyError(c, err)
+		return
+	}
+	if len(body.Ops) == 0 || len(body.Ops) > MaxBatchOps {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a batch needs 1 to %d ops", MaxBatchOps)})
+		return
+	}
+	mode := c.GetHeader(ReplicationHeader)
+	if !store.ValidReplication(mode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": ReplicationHeader + " must be " + store.ReplicationSync + " or " + store.ReplicationAsync,
+		})
+		return
+	}
+
+	results := h.execBatch(c, c.Request.Context(), mode, body.Ops)
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// execBatch checks and runs ops, as POST /batch does, and returns their
+// results in order. Ops go to ctx, which bounds them all.
+func (h *Handler) execBatch(c *gin.Context, ctx context.Context, mode string, ops []batchOp) []batchResult {
+	p := CurrentPrincipal(c)
+	canWrite := p == nil || p.Cluster || p.Has(ScopeWrite)
+	var errFenced error // writes are refused while fenced, reads still run
+	if reason, fenced := h.replicator.Fenced(); fenced {
+		errFenced = fmt.Errorf("%w (%s)", cluster.ErrFenced, reason)
+	}
+
+	results := make([]batchResult, len(ops))
+	keys := make([]string, len(ops))
+	groups := make(map[string][]int) // replica set → op indexes, to forward
+	var local []int
+	forwarded := c.GetHeader(cluster.ForwardedHeader) != "" && !h.replicator.Stale(c.GetHeader(cluster.RingHeader))
+	for i := range ops {
+		op := &ops[i]
+		if op.Namespace == "" {
+			op.Namespace = store.DefaultNamespace
+		}
+		key, err := h.checkBatchOp(*op)
+		if err != nil {
+			results[i] = failed(errorStatus(err), err)
+			continue
+		}
+		if op.Op != "get" && !canWrite {
+			results[i] = batchResult{Status: http.StatusForbidden, Error: "token lacks required scope"}
+			continue
+		}
+		if op.Op != "get" && errFenced != nil {
+			results[i] = failed(errorStatus(errFenced), errFenced)
+			continue
+		}
+		if err := h.checkKeyACL(c, key, op.Op != "get"); err != nil {
+			results[i] = failed(http.StatusForbidden, err)
+			continue
+		}
+		if ok, _ := h.allowNamespace(c, op.Namespace); !ok {
+			results[i] = failed(http.StatusTooManyRequests, errNamespaceRate)
+			continue
+		}
+		keys[i] = key
+		if forwarded || h.replicator.Coordinates(key) {
+			local = append(local, i)
+			continue
+		}
+		set := h.replicator.ReplicaSet(key)
+		groups[set] = append(groups[set], i)
+	}
+
+	var wg sync.WaitGroup
+	for _, idx := range groups {
+		wg.Go(func() { h.forwardBatch(c, ctx, ops, keys, idx, results) })
+	}
+	wg.Go(func() { h.runBatch(ctx, mode, ops, keys, local, results) })
+	wg.Wait()
+	return results
+}
+
+// checkBatchOp validates op and returns its internal key. Errors are
+// the ones the op's own request would have failed with.
+func (h *Handler) checkBatchOp(op batchOp) (string, error) {
+	if !store.ValidNamespace(op.Namespace) {
+		return "", store.ErrInvalidNamespace
+	}
+	if op.Key == "" {
+		return "", fmt.Errorf("%w: key is required", errInvalidBatchOp)
+	}
+	limits := h.store.Limits()
+	if err := limits.CheckKey(op.Key); err != nil {
+		return "", err
+	}
+	switch op.Op {
+	case "get", "delete":
+	case "put":
+		if err := limits.CheckValue(op.Value); err != nil {
+			return "", err
+		}
+		if err := checkContentType(op.ContentType); err != nil {
+			return "", fmt.Errorf("%w: %w", errInvalidBatchOp, err)
+		}
+	default:
+		return "", fmt.Errorf("%w: op must be get, put or delete, got %q", errInvalidBatchOp, op.Op)
+	}
+	return store.NamespacedKey(op.Namespace, op.Key), nil
+}
+
+// runBatch runs the ops at idx on this node: one goroutine per key, at
+// most batchParallelism at a time.
+func (h *Handler) runBatch(ctx context.Context, mode string, ops []batchOp, keys []string, idx []int, results []batchResult) {
+	byKey := make(map[string][]int)
+	var order []string
+	for _, i := range idx {
+		if _, ok := byKey[keys[i]]; !ok {
+			order = append(order, keys[i])
+		}
+		byKey[keys[i]] = append(byKey[keys[i]], i)
+	}
+
+	sem := make(chan struct{}, batchParallelism)
+	var wg sync.WaitGroup
+	for _, key := range order {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			for _, i := range byKey[key] {
+				results[i] = h.runBatchOp(ctx, mode, ops[i], key)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// runBatchOp runs one op, as its own request would.
+func (h *Handler) runBatchOp(ctx context.Context, mode string, op batchOp, key string) batchResult {
+	h.replicator.TouchKey(key, op.Op != "get")
+	async := false
+	if op.Op != "get" {
+		if mode == "" {
+			ns, _ := h.store.GetNamespace(op.Namespace)
+			mode = ns.Replication
+		}
+		async = mode == store.ReplicationAsync
+	}
+	res := batchResult{Status: http.StatusOK}
+	if async {
+		res.Replication = store.ReplicationAsync
+	}
+
+	switch op.Op {
+	case "get":
+		val, err := h.replicator.CachedRead(ctx, key)
+		if err != nil {
+			return failed(errorStatus(err), err)
+		}
+		if val == nil {
+			return batchResult{Status: http.StatusNotFound, Error: "key not found"}
+		}
+		decoded, err := val.Decode()
+		if err != nil {
+			return failed(errorStatus(err), err)
+		}
+		res.Value, res.Clock, res.UpdatedAt = &decoded.Data, decoded.Clock, &decoded.UpdatedAt
+		res.ContentType = decoded.ContentType
+	case "put":
+		write := h.replicator.ReplicateWrite
+		if async {
+			write = h.replicator.ReplicateWriteAsync
+		}
+		val, err := write(ctx, key, op.Value, op.ContentType, nil)
+		if err != nil {
+			return failed(errorStatus(err), err)
+		}
+		res.Clock, res.ContentType = val.Clock, val.ContentType
+	case "delete":
+		del := h.replicator.DeleteReplicated
+		if async {
+			del = h.replicator.DeleteAsync
+		}
+		if err := del(ctx, key); err != nil {
+			return failed(errorStatus(err), err)
+		}
+	}
+	return res
+}
+
+// forwardBatch sends the ops at idx, which share a replica set, to one
+// of its owners as a batch of their own (POST /batch, whatever the
+// request was), and copies back the results.
+func (h *Handler) forwardBatch(c *gin.Context, ctx context.Context, ops []batchOp, keys []string, idx []int, results []batchResult) {
+	sub := make([]batchOp, len(idx))
+	for j, i := range idx {
+		sub[j] = ops[i]
+	}
+	body, _ := json.Marshal(gin.H{"ops": sub})
+
+	// The client's Idempotency-Key covers the whole batch, on this node.
+	r := c.Request.Clone(ctx)
+	r.Header.Del(IdempotencyHeader)
+	r.URL.Path, r.URL.RawPath, r.URL.RawQuery = "/batch", "", ""
+
+	fail := func(status int, err error) {
+		for _, i := range idx {
+			results[i] = failed(status, err)
+		}
+	}
+	resp, err := h.replicator.Forward(ctx, keys[idx[0]], r, body)
+	if err != nil {
+		CurrentLogger(c).Warn("forward batch failed", "ops", len(idx), "err", err)
+		fail(http.StatusBadGateway, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Results []batchResult `json:"results"`
+		Error   string        `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	switch {
+	case err != nil:
+		fail(http.StatusBadGateway, fmt.Errorf("forwarded batch: %w", err))
+	case resp.StatusCode != http.StatusOK:
+		fail(resp.StatusCode, fmt.Errorf("forwarded batch: %s", out.Error))
+	case len(out.Results) != len(idx):
+		fail(http.StatusBadGateway, fmt.Errorf("forwarded batch: %d results for %d ops", len(out.Results), len(idx)))
+	default:
+		for j, i := range idx {
+			results[i] = out.Results[j]
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Change data capture ──────────────────────────────────────────────────────
+//
+//	GET /cdc?from=1042&namespace=orders
+//	→ 200, then one JSON change per line, from change 1042 on, then live:
+//	{"seq": 1042, "op": "put", "namespace": "orders", "key": "o1", "value": "…", "clock": {...}, "updated_at": ..., "node": "n1"}
+//	{"seq": 1043, "op": "delete", "namespace": "orders", "key": "o7", "clock": {...}, "updated_at": ..., "node": "n1"}
+//	→ 410 {"error": ..., "oldest": 980} if change 1042 is no longer retained
+//
+// The changes are this node's, numbered by its WAL (see store/cdc.go):
+// resume with from = the last seq processed + 1, against the same node.
+// Without from the stream starts at the oldest change retained.
+// Heartbeats and the closing {"error": ...} line are as for watches.
+
+// CDCEvent is one change of the feed.
+type CDCEvent struct {
+	Seq         uint64            `json:"seq"`
+	Op          string            `json:"op"` // "put", "delete" or "evict"
+	Namespace   string            `json:"namespace"`
+	Key         string            `json:"key"`
+	Value       string            `json:"value,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Clock       store.VectorClock `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Node        string            `json:"node"`
+}
+
+// CDC handles GET /cdc?from=&namespace=
+func (h *Handler) CDC(c *gin.Context) {
+	var from uint64
+	if v := c.Query("from"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a change number"})
+			return
+		}
+		from = n
+	}
+	ns := c.Query("namespace")
+	if ns != "" && !store.ValidNamespace(ns) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrInvalidNamespace.Error()})
+		return
+	}
+	// Refuse a lost start up front, while we can still answer 410; a
+	// snapshot deleting it later ends the stream with an error line.
+	if oldest := h.store.OldestChange(); from > 0 && from < oldest {
+		c.JSON(http.StatusGone, gin.H{"error": fmt.Sprintf("%s; the oldest is %d", store.ErrChangesGone, oldest), "oldest": oldest})
+		return
+	}
+
+	streamEvents(h, c, func(ctx context.Context, fn func(CDCEvent) error) error {
+		return h.store.Changes(ctx, from, func(ch store.LoggedChange) error {
+			evNs, key := store.SplitKey(ch.Key)
+			if ns != "" && evNs != ns {
+				return nil
+			}
+			ev := CDCEvent{Seq: ch.Seq, Op: "put", Namespace: evNs, Key: key, Clock: ch.Value.Clock, UpdatedAt: ch.Value.UpdatedAt, Node: h.selfID}
+			switch {
+			case ch.Evicted:
+				ev.Op = "evict"
+			case ch.Value.Tombstone:
+				ev.Op = "delete"
+			default:
+				decoded, err := ch.Value.Decode()
+				if err != nil {
+					return err
+				}
+				ev.Value, ev.ContentType = decoded.Data, decoded.ContentType
+			}
+			return fn(ev)
+		})
+	})
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"distributed-kvstore/internal/compress"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// HTTP COMPRESSION MIDDLEWARE
+////////////////////////////////////////////////////////////////////////////////
+
+// Compression negotiates HTTP compression with clients.
+//
+// Requests:
+//
+//	Content-Encoding: zstd | snappy | gzip
+//	→ the body is decompressed before handlers see it.
+//
+// Responses:
+//
+//	Accept-Encoding: zstd, gzip
+//	→ bodies of at least minSize bytes are compressed with the best
+//	  codec the client accepts.
+//
+// The response is buffered so we can decide AFTER the handler ran whether
+// it is big enough to be worth compressing. Handlers that stream (call
+// Flush) switch the writer to pass-through, uncompressed.
+//
+// /internal/* is skipped: peers talk to each other with their own format.
+func Compression(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/internal/") {
+			c.Next()
+			return
+		}
+
+		// ── Request side ──
+		if enc := strings.ToLower(c.GetHeader("Content-Encoding")); enc != "" && enc != "identity" {
+			if !compress.Valid(enc) {
+				c.AbortWithStatusJSON(http.StatusUnsupportedMediaType,
+					gin.H{"error": "unsupported Content-Encoding " + strconv.Quote(enc)})
+				return
+			}
+			body, err := compress.NewReader(enc, c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.Request.Body = body
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.ContentLength = -1
+		}
+
+		// ── Response side ──
+		codec := compress.Negotiate(c.GetHeader("Accept-Encoding"))
+		if codec == compress.None {
+			c.Next()
+			return
+		}
+
+		bw := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = bw
+		c.Next()
+		c.Writer = bw.ResponseWriter
+
+		if bw.passthrough {
+			return
+		}
+
+		body := bw.buf.Bytes()
+		if len(body) >= minSize {
+			if out, err := compress.Encode(codec, body); err == nil && len(out) < len(body) {
+				h := c.Writer.Header()
+				h.Set("Content-Encoding", codec)
+				h.Add("Vary", "Accept-Encoding")
+				h.Del("Content-Length")
+				body = out
+			}
+		}
+		if len(body) > 0 {
+			_, _ = c.Writer.Write(body)
+		}
+	}
+}
+
+// bufferedWriter collects the response body in memory.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	buf         bytes.Buffer
+	passthrough bool // set once the handler flushes (streaming)
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush means the handler wants bytes on the wire NOW,
+// so we give up on compression for this response.
+func (w *bufferedWriter) Flush() {
+	if !w.passthrough {
+		w.passthrough = true
+		if w.buf.Len() > 0 {
+			_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+			w.buf.Reset()
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+// (e.g. to extend deadlines for long streams).
+func (w *bufferedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Conditional requests ─────────────────────────────────────────────────────
+
+// A key's ETag is its vector clock, in the form ?clock= takes:
+//
+//	GET /kv/ns/k                           → 200, ETag: "n1:3,n2:1"
+//	GET /kv/ns/k + If-None-Match: "n1:3,n2:1" → 304, no body
+//	PUT /kv/ns/k + If-Match: "n1:3,n2:1"      → written only if k is still at that version, else 412
+//	PUT /kv/ns/k + If-None-Match: *            → written only if k does not exist, else 412
+//	DELETE /kv/ns/k + If-Match: "n1:3,n2:1"   → the same for deletes
+//
+// A 304 still costs a quorum read, but not the value's transfer or
+// decoding: a client polling a large value it has cached pays for the
+// clocks only.
+//
+// Conditional writes are compare-and-set. They run like a one-key
+// transaction: on the key's primary, under the key's lock, from a
+// quorum read (see cluster.WriteIf). Other nodes forward them there. As
+// for transactions, the lock does not hold back unconditional writes of
+// the key; a client that relies on If-Match should use it for every
+// write of that key. They are always synchronous: X-Replication: async
+// is refused.
+
+// etag returns the ETag of v.
+func etag(v store.Value) string {
+	return `"` + store.FormatClock(v.Clock) + `"`
+}
+
+// etagMatch is a parsed If-Match or If-None-Match header.
+type etagMatch struct {
+	any    bool     // "*"
+	strong []string // opaque tags, quotes stripped
+	weak   []string // W/ tags (only If-None-Match compares those)
+}
+
+var errBadETags = errors.New("invalid entity tag list")
+
+// parseETags parses a header of quoted entity tags. Tags may contain
+// commas (ours do), so this scans quotes rather than splitting.
+func parseETags(h string) (etagMatch, error) {
+	var m etagMatch
+	if strings.TrimSpace(h) == "*" {
+		m.any = true
+		return m, nil
+	}
+	for rest := h; ; {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+		weak := strings.HasPrefix(rest, "W/")
+		if weak {
+			rest = rest[2:]
+		}
+		if !strings.HasPrefix(rest, `"`) {
+			return m, errBadETags
+		}
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return m, errBadETags
+		}
+		tag := rest[1 : 1+end]
+		rest = rest[2+end:]
+		if weak {
+			m.weak = append(m.weak, tag)
+		} else {
+			m.strong = append(m.strong, tag)
+		}
+	}
+	if len(m.strong)+len(m.weak) == 0 {
+		return m, errBadETags
+	}
+	return m, nil
+}
+
+// matches reports whether v is one of the tags: strongly for If-Match,
+// weakly (W/ tags too) for If-None-Match. A missing key (nil) matches
+// nothing, not even "*".
+func (m etagMatch) matches(v *store.Value, weak bool) bool {
+	if v == nil {
+		return false
+	}
+	if m.any {
+		return true
+	}
+	tag := store.FormatClock(v.Clock)
+	return slices.Contains(m.strong, tag) || weak && slices.Contains(m.weak, tag)
+}
+
+// notModified answers 304 if the request's If-None-Match names v.
+func notModified(c *gin.Context, v store.Value) bool {
+	h := c.GetHeader("If-None-Match")
+	if h == "" {
+		return false
+	}
+	m, err := parseETags(h)
+	if err != nil || !m.matches(&v, true) {
+		return false // an unparsable validator is ignored, as if absent
+	}
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// writeCondition parses If-Match and If-None-Match of a PUT or DELETE.
+// cond is nil for an unconditional write. On a malformed header it
+// writes a 400 and returns ok == false.
+func writeCondition(c *gin.Context) (cond func(*store.Value) bool, ok bool) {
+	parse := func(name string) (*etagMatch, bool) {
+		h := c.GetHeader(name)
+		if h == "" {
+			return nil, true
+		}
+		m, err := parseETags(h)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": name + ": " + err.Error()})
+			return nil, false
+		}
+		return &m, true
+	}
+	ifMatch, ok := parse("If-Match")
+	if !ok {
+		return nil, false
+	}
+	ifNoneMatch, ok := parse("If-None-Match")
+	if !ok {
+		return nil, false
+	}
+	if ifMatch == nil && ifNoneMatch == nil {
+		return nil, true
+	}
+	return func(v *store.Value) bool {
+		if ifMatch != nil && !ifMatch.matches(v, false) {
+			return false
+		}
+		return ifNoneMatch == nil || !ifNoneMatch.matches(v, true)
+	}, true
+}
+
+// conditionalWrite checks that a conditional write may run here, and
+// forwards it to the key's primary if not. Returns false if the response
+// is already written.
+func (h *Handler) conditionalWrite(c *gin.Context, key string, async bool) bool {
+	if async {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "conditional writes cannot be async"})
+		return false
+	}
+	coord, err := h.replicator.KeyCoordinator(key)
+	if err != nil {
+		writeError(c, err)
+		return false
+	}
+	if coord.ID == h.selfID || c.GetHeader(cluster.ForwardedHeader) != "" {
+		return true
+	}
+	raw, err := c.GetRawData()
+	if err != nil {
+		bodyError(c, err)
+		return false
+	}
+	h.forwardToNode(c, coord.ID, raw)
+	return false
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Counters ─────────────────────────────────────────────────────────────────
+
+// Incr handles POST /kv/:namespace/:key/incr
+//
+//	{"by": 5}   (optional; default 1)
+//	→ {"namespace": "app1", "key": "hits", "value": "47", "count": 47, "clock": {...}}
+//
+// Runs on the key's primary (see cluster/counters.go); other nodes
+// forward it there. 400 if the key holds something other than an
+// integer.
+func (h *Handler) Incr(c *gin.Context) { h.increment(c, 1) }
+
+// Decr handles POST /kv/:namespace/:key/decr, like Incr.
+func (h *Handler) Decr(c *gin.Context) { h.increment(c, -1) }
+
+func (h *Handler) increment(c *gin.Context, sign int64) {
+	key, ok := storeKey(c)
+	if !ok {
+		return
+	}
+	if err := h.store.Limits().CheckKey(c.Param("key")); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	raw, err := c.GetRawData()
+	if err != nil {
+		bodyError(c, err)
+		return
+	}
+	body := struct {
+		By int64 `json:"by"`
+	}{By: 1}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if body.By < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "by must be a positive integer"})
+		return
+	}
+
+	coord, err := h.replicator.KeyCoordinator(key)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if coord.ID != h.selfID && c.GetHeader(cluster.ForwardedHeader) == "" {
+		h.forwardToNode(c, coord.ID, raw)
+		return
+	}
+	h.replicator.TouchKey(key, true)
+
+	n, val, err := h.replicator.Increment(c.Request.Context(), key, sign*body.By)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	setSession(c, val)
+	c.JSON(http.StatusOK, gin.H{
+		"namespace": c.Param("namespace"),
+		"key":       c.Param("key"),
+		"value":     strconv.FormatInt(n, 10), // val.Data may be compressed
+		"count":     n,
+		"clock":     val.Clock,
+	})
+}
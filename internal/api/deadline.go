@@ -0,0 +1,40 @@
+package api
+
+import (
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A client with a deadline sends what is left of it:
+//
+//	X-Request-Timeout: 250ms
+//
+// The budget becomes the request context's deadline, so quorum waits
+// give up when the client would (→ 504) instead of after the node's
+// --quorum-timeout. A forwarded request passes on what is left.
+
+// requestDeadline applies X-Request-Timeout to the request context.
+func requestDeadline() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		v := c.GetHeader(cluster.RequestTimeoutHeader)
+		if v == "" {
+			c.Next()
+			return
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": cluster.RequestTimeoutHeader + " must be a positive duration, e.g. 250ms",
+			})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), d)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrincipalHeader names the principal a forwarded request acts for, as
+// the forwarding node authenticated it: the forward replaces the client's
+// Authorization with the cluster's credential (cluster/forward.go), so
+// the next node sees the cluster as the caller. It is only believed from
+// a peer (see callerName).
+const PrincipalHeader = "X-KV-Principal"
+
+// actFor sets PrincipalHeader on a request about to be forwarded. A
+// request a peer forwarded keeps the name that peer passed on; any other
+// value a client sent is dropped.
+func actFor(c *gin.Context) {
+	switch p := CurrentPrincipal(c); {
+	case p == nil:
+		c.Request.Header.Del(PrincipalHeader)
+	case !p.Cluster:
+		c.Request.Header.Set(PrincipalHeader, p.Name)
+	}
+}
+
+// forward proxies the request to an owner of key when this node
+// is not in the key's replica set, or is draining (decommission).
+//
+// Returns true if the request was forwarded (the response is already
+// written) and the handler must stop. A request that was forwarded
+// once is served locally — unless the forwarder routed it with an older
+// ring than ours: then it goes once more, to the owner our ring names.
+// Each extra hop needs a strictly newer ring, so there are no loops.
+func (h *Handler) forward(c *gin.Context, key string) bool {
+	if h.replicator.Coordinates(key) {
+		return false
+	}
+	if c.GetHeader(cluster.ForwardedHeader) != "" && !h.replicator.Stale(c.GetHeader(cluster.RingHeader)) {
+		return false
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		b, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			bodyError(c, err)
+			return true
+		}
+		body = b
+	}
+
+	actFor(c)
+	resp, err := h.replicator.Forward(c.Request.Context(), key, c.Request, body)
+	if err != nil {
+		CurrentLogger(c).Warn("forward failed", "key", key, "err", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return true
+	}
+	copyResponse(c, resp)
+	return true
+}
+
+// forwardToNode proxies the request, with body, to the member nodeID.
+func (h *Handler) forwardToNode(c *gin.Context, nodeID string, body []byte) {
+	actFor(c)
+	resp, err := h.replicator.ForwardTo(c.Request.Context(), nodeID, c.Request, body)
+	switch {
+	case errors.Is(err, cluster.ErrUnknownNode):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		CurrentLogger(c).Warn("forward failed", "node", nodeID, "err", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	copyResponse(c, resp)
+}
+
+// copyResponse writes a forwarded response back to the client
+// and closes it.
+func copyResponse(c *gin.Context, resp *http.Response) {
+	defer resp.Body.Close()
+
+	for _, name := range []string{"Content-Type", "Retry-After", "ETag", SessionHeader, "Idempotent-Replayed"} {
+		if v := resp.Header.Get(name); v != "" {
+			c.Header(name, v)
+		}
+	}
+	c.Status(resp.StatusCode)
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		CurrentLogger(c).Warn("copy forwarded response", "err", err)
+	}
+}
@@ -2,8 +2,8 @@
 // - This file is the "front door" of your distributed key-value store.
 //
 // Clients talk to:
-//   - PUT /kv/:key
-//   - GET /kv/:key
+//   - PUT /kv/:namespace/:key
+//   - GET /kv/:namespace/:key
 //
 // Nodes talk to each other using:
 //
@@ -18,9 +18,22 @@
 package api
 
 import (
+	"context"
 	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/metrics"
 	"distributed-kvstore/internal/store"
+	"distributed-kvstore/internal/wire"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,92 +45,568 @@ type Handler struct {
 	replicator *cluster.Replicator
 	membership *cluster.Membership
 	selfID     string
+	idem       *idempotencyCache
+	reload     Reloader          // nil = POST /admin/reload is not available
+	metrics    *metrics.Registry // nil = no GET /metrics
+	nsRates    namespaceRates    // per-namespace rate limits (see ratelimit.go)
+	openapi    []byte            // GET /openapi.json, built by Register
+
+	watches     context.Context // canceled by StopWatches
+	stopWatches context.CancelFunc
 }
 
 // NewHandler creates a Handler.
 func NewHandler(s *store.Store, r *cluster.Replicator, m *cluster.Membership, selfID string) *Handler {
-	return &Handler{store: s, replicator: r, membership: m, selfID: selfID}
+	h := &Handler{
+		store:      s,
+		replicator: r,
+		membership: m,
+		selfID:     selfID,
+		idem:       newIdempotencyCache(DefaultIdempotencyTTL),
+	}
+	h.watches, h.stopWatches = context.WithCancel(context.Background())
+	return h
 }
 
 // Register mounts all routes on r.
 func (h *Handler) Register(r *gin.Engine) {
+	// Match routes on the escaped path, so a key with an encoded "/"
+	// (a%2Fb) stays one :key param instead of two path segments.
+	r.UseRawPath = true
+
+	// Probes for load balancers and orchestrators (see health.go).
+	r.GET("/health", h.Healthz)
+	r.GET("/healthz", h.Healthz)
+	r.GET("/readyz", h.Readyz)
+	if h.metrics != nil {
+		r.GET("/metrics", h.Metrics) // see metrics.go
+	}
+
 	// Public KV API — used by clients.
-	kv := r.Group("/kv")
-	kv.GET("/:key", h.Get)
-	kv.PUT("/:key", h.Put)
-	kv.DELETE("/:key", h.Delete)
+	kv := r.Group("/kv", h.requireReady(), h.enforceACL(), requestDeadline(), h.observeRing(), h.namespaceRate(), h.idempotent())
+	kv.GET("", h.ScanKeys)
+	kv.POST("/mget", h.MultiGet)
+	kv.GET("/:namespace", h.ListKeys)
+	kv.GET("/:namespace/:key", h.Get)
+	kv.GET("/:namespace/:key/meta", h.KeyMeta)
+	kv.GET("/:namespace/:key/versions", h.KeyVersions)
+	kv.GET("/:namespace/:key/raw", h.GetRaw)
+	kv.PUT("/:namespace/:key", h.Put)
+	kv.PUT("/:namespace/:key/raw", h.PutRaw)
+	kv.DELETE("/:namespace/:key", h.Delete)
+	kv.POST("/:namespace/:key/incr", h.Incr)
+	kv.POST("/:namespace/:key/decr", h.Decr)
+	kv.POST("/:namespace/:key/undelete", h.Undelete)
+
+	// Change streams (see watch.go, cdc.go). No request deadline: they stay open.
+	r.GET("/watch/:namespace", h.requireReady(), h.enforceACL(), h.observeRing(), h.Watch)
+	r.GET("/cdc", h.enforceACL(), h.CDC)
+
+	// Multi-key transactions (see txn.go).
+	r.POST("/txn", h.requireReady(), requestDeadline(), h.observeRing(), h.idempotent(), h.Txn)
+	r.POST("/batch", h.requireReady(), requestDeadline(), h.observeRing(), h.idempotent(), h.Batch)
+
+	// Leases (see locks.go).
+	locks := r.Group("/locks", h.requireReady(), h.enforceACL(), requestDeadline(), h.observeRing())
+	locks.GET("/:name", h.GetLock)
+	locks.POST("/:name/acquire", h.AcquireLock)
+	locks.POST("/:name/renew", h.RenewLock)
+	locks.POST("/:name/release", h.ReleaseLock)
+
+	// Namespace management.
+	ns := r.Group("/namespaces", h.audited())
+	ns.GET("", h.ListNamespaces)
+	ns.GET("/:namespace", h.GetNamespace)
+	ns.PUT("/:namespace", h.PutNamespace)
+	ns.DELETE("/:namespace", h.DeleteNamespace)
 
 	// Cluster management.
-	clusterGroup := r.Group("/cluster")
+	clusterGroup := r.Group("/cluster", h.audited())
 	clusterGroup.POST("/join", h.Join)
 	clusterGroup.POST("/leave", h.Leave)
+	clusterGroup.POST("/decommission", h.Decommission)
+	clusterGroup.GET("/decommission/:id", h.DecommissionStatus)
 	clusterGroup.GET("/nodes", h.ListNodes)
+	clusterGroup.GET("/status", h.Status)
 
 	// Internal endpoints used only by peer nodes.
-	internal := r.Group("/internal")
+	internal := r.Group("/internal", h.observeRing())
 	internal.POST("/replicate", h.InternalReplicate)
-	internal.GET("/fetch/:key", h.InternalFetch)
+	internal.POST("/replicate/batch", h.InternalReplicateBatch)
+	internal.GET("/fetch/:namespace/:key", h.InternalFetch)
+	internal.GET("/versions/:namespace/:key", h.InternalVersions)
+	internal.GET("/keys/:namespace", h.InternalKeys)
+	internal.PUT("/namespaces/:namespace", h.InternalPutNamespace)
+	internal.GET("/acl", h.InternalGetACLs)
+	internal.PUT("/acl", h.InternalPutACLs)
+	internal.DELETE("/namespaces/:namespace", h.InternalDeleteNamespace)
+	internal.GET("/backup", h.InternalBackup)
+	internal.POST("/cluster-snapshot", h.InternalTakeSnapshot)
+	internal.PUT("/cluster-snapshot/:id", h.InternalPutSnapshot)
+	internal.DELETE("/cluster-snapshot/:id", h.InternalDeleteSnapshot)
+	internal.GET("/cluster-snapshot/:id/part", h.InternalSnapshotPart)
+	internal.GET("/cluster-snapshot/:id/archive", h.InternalSnapshotArchive)
+	internal.GET("/shards", h.InternalShards)
+	internal.GET("/replication", h.InternalReplication)
+	internal.GET("/stats", h.InternalStats)
+	internal.GET("/hotkeys", h.InternalHotKeys)
+	internal.GET("/digests", h.InternalDigests)
+	internal.GET("/watch/:namespace", h.InternalWatch)
+	internal.POST("/xdc", h.InternalXDC)
+	internal.POST("/txn", h.InternalTxn)
+	internal.POST("/txn/prepare", h.InternalTxnPrepare)
+	internal.POST("/txn/commit", h.InternalTxnCommit)
+	internal.POST("/txn/abort", h.InternalTxnAbort)
+	internal.GET("/txn/:id", h.InternalTxnDecision)
+	internal.POST("/membership", h.InternalMembership)
+	internal.POST("/shutdown", h.InternalShutdown)
+	internal.POST("/hints", h.InternalHints)
+	internal.PUT("/quorum", h.InternalQuorum)
+
+	h.registerAdmin(r)
+
+	// The API description, of every route above (see openapi.go).
+	r.GET("/openapi.json", h.OpenAPI)
+	h.openapi = buildOpenAPI(r.Routes())
+}
+
+// storeKey reads :namespace and :key from the URL
+// and builds the internal store key.
+//
+// On an invalid namespace or key it writes a 400 and returns ok=false.
+// The router unescapes :key, so a key with "/" arrives as a%2Fb.
+func storeKey(c *gin.Context) (string, bool) {
+	ns := c.Param("namespace")
+	if !store.ValidNamespace(ns) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrInvalidNamespace.Error()})
+		return "", false
+	}
+	if err := store.ValidateKey(c.Param("key")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return store.NamespacedKey(ns, c.Param("key")), true
+}
+
+// maxContentTypeLen bounds the content_type stored with a value.
+const maxContentTypeLen = 255
+
+// checkContentType accepts "" or a media type such as
+// "application/json" or "text/plain; charset=utf-8".
+func checkContentType(ct string) error {
+	if ct == "" {
+		return nil
+	}
+	if len(ct) > maxContentTypeLen {
+		return fmt.Errorf("content_type is longer than %d bytes", maxContentTypeLen)
+	}
+	if _, _, err := mime.ParseMediaType(ct); err != nil {
+		return fmt.Errorf("content_type %q: %w", ct, err)
+	}
+	return nil
+}
+
+// writeError maps store and replicator errors to HTTP status codes.
+// Anything unknown is a 500.
+func writeError(c *gin.Context, err error) {
+	status := errorStatus(err)
+	if status == http.StatusServiceUnavailable {
+		c.Header("Retry-After", "1")
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// errorStatus is the HTTP status writeError uses for err.
+func errorStatus(err error) int {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, store.ErrInvalidNamespace), errors.Is(err, store.ErrInvalidConfig),
+		errors.Is(err, store.ErrKeyTooLong), errors.Is(err, store.ErrInvalidKey), errors.Is(err, cluster.ErrTxnInvalid),
+		errors.Is(err, cluster.ErrTxnOwners), errors.Is(err, cluster.ErrNotCounter),
+		errors.Is(err, errInvalidBatchOp):
+		status = http.StatusBadRequest
+	case errors.Is(err, errACLDenied):
+		status = http.StatusForbidden
+	case errors.Is(err, store.ErrValueTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, store.ErrNamespaceNotFound), errors.Is(err, cluster.ErrNoLiveVersion):
+		status = http.StatusNotFound
+	case errors.Is(err, store.ErrNamespaceNotEmpty), errors.Is(err, cluster.ErrNotDeleted):
+		status = http.StatusConflict
+	case errors.Is(err, cluster.ErrPreconditionFailed):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, store.ErrQuotaExceeded), errors.Is(err, store.ErrMemoryFull),
+		errors.Is(err, store.ErrDiskFull), errors.Is(err, syscall.ENOSPC):
+		status = http.StatusInsufficientStorage
+	case errors.Is(err, cluster.ErrOverloaded), errors.Is(err, cluster.ErrStaleRing), errors.Is(err, cluster.ErrFenced),
+		errors.Is(err, cluster.ErrTxnAborted), errors.Is(err, cluster.ErrSessionBehind):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	return status
 }
 
 // ─── Public KV handlers ───────────────────────────────────────────────────────
 
-// Put handles PUT /kv/:key
+// Put handles PUT /kv/:namespace/:key
 // Body: {"value": "<string>"}
 func (h *Handler) Put(c *gin.Context) {
-	key := c.Param("key")
-
+	w, ok := h.startPut(c)
+	if !ok {
+		return
+	}
 	var body struct {
-		Value string `json:"value" binding:"required"`
+		Value       string `json:"value" binding:"required"`
+		ContentType string `json:"content_type"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
+		bodyError(c, err)
+		return
+	}
+	if err := checkContentType(body.ContentType); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	h.finishPut(c, w, body.Value, body.ContentType, true)
+}
+
+// pendingPut is a PUT that startPut let through: this node writes it.
+type pendingPut struct {
+	key   string
+	async bool
+	cond  func(*store.Value) bool // nil = unconditional
+	ttl   *time.Duration          // X-TTL; nil = the namespace's
+}
 
-	val, err := h.replicator.ReplicateWrite(key, body.Value, nil)
+// startPut checks what PUT and PUT .../raw have in common before the
+// body is read: the key, the replication mode and condition headers,
+// and whether another node should coordinate (then the request has
+// been forwarded and ok is false).
+func (h *Handler) startPut(c *gin.Context) (w pendingPut, ok bool) {
+	if w.key, ok = storeKey(c); !ok {
+		return w, false
+	}
+	if err := h.store.Limits().CheckKey(c.Param("key")); err != nil {
+		writeError(c, err)
+		return w, false
+	}
+	if w.async, ok = h.asyncWrite(c); !ok {
+		return w, false
+	}
+	if w.cond, ok = writeCondition(c); !ok {
+		return w, false
+	}
+	if w.ttl, ok = writeTTL(c); !ok {
+		return w, false
+	}
+	if w.cond != nil {
+		if !h.conditionalWrite(c, w.key, w.async) {
+			return w, false
+		}
+	} else if h.forward(c, w.key) {
+		return w, false
+	}
+	h.replicator.TouchKey(w.key, true)
+	return w, true
+}
+
+// finishPut writes value and answers. echo puts the value back in the
+// response, as PUT always has.
+func (h *Handler) finishPut(c *gin.Context, w pendingPut, value, contentType string, echo bool) {
+	// Checked here too (not only in the store), so an oversized value
+	// fails before the coordinator does any work.
+	if err := h.store.Limits().CheckValue(value); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var (
+		val store.Value
+		err error
+		ctx = c.Request.Context()
+	)
+	if w.ttl != nil {
+		ctx = store.WithTTL(ctx, *w.ttl)
+	}
+	switch {
+	case w.cond != nil:
+		tw := store.TxnWrite{Key: w.key, Data: value, ContentType: contentType}
+		val, err = h.replicator.WriteIf(ctx, tw, w.cond)
+	case w.async:
+		val, err = h.replicator.ReplicateWriteAsync(ctx, w.key, value, contentType, nil)
+	default:
+		val, err = h.replicator.ReplicateWrite(ctx, w.key, value, contentType, nil)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"key":   key,
-		"value": val.Data,
-		"clock": val.Clock,
-	})
+	resp := gin.H{
+		"namespace": c.Param("namespace"),
+		"key":       c.Param("key"),
+		"clock":     val.Clock,
+	}
+	if echo {
+		resp["value"] = value // val.Data may be compressed
+	} else {
+		resp["size"] = len(value)
+	}
+	if val.ContentType != "" {
+		resp["content_type"] = val.ContentType
+	}
+	if !val.ExpiresAt.IsZero() {
+		resp["expires_at"] = val.ExpiresAt
+	}
+	if w.async {
+		resp["replication"] = store.ReplicationAsync
+	}
+	setSession(c, val)
+	c.Header("ETag", etag(val))
+	c.JSON(http.StatusOK, resp)
 }
 
-// Get handles GET /kv/:key
+// Get handles GET /kv/:namespace/:key
 func (h *Handler) Get(c *gin.Context) {
-	key := c.Param("key")
-
-	val, err := h.replicator.CoordinateRead(key)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	key, ok := storeKey(c)
+	if !ok {
 		return
 	}
-	if val == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+	if c.Query("clock") != "" {
+		h.getVersion(c, key) // see versions.go
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"key":        key,
+	val, ok := h.readKey(c, key)
+	if !ok {
+		return
+	}
+	resp := gin.H{
+		"namespace":  c.Param("namespace"),
+		"key":        c.Param("key"),
 		"value":      val.Data,
 		"clock":      val.Clock,
 		"updated_at": val.UpdatedAt,
-	})
+	}
+	if val.ContentType != "" {
+		resp["content_type"] = val.ContentType
+	}
+	if !val.ExpiresAt.IsZero() {
+		resp["expires_at"] = val.ExpiresAt
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// readKey reads key with the read quorum for GET and GET .../raw and
+// returns its decoded value. ok is false once it has answered: the
+// request was forwarded, the key was not found or not modified, or the
+// read failed.
+func (h *Handler) readKey(c *gin.Context, key string) (store.Value, bool) {
+	ctx, ok := readContext(c)
+	if !ok {
+		return store.Value{}, false
+	}
+	if ctx, ok = sessionContext(c, ctx); !ok {
+		return store.Value{}, false
+	}
+	if h.forward(c, key) {
+		return store.Value{}, false
+	}
+	h.replicator.TouchKey(key, false)
+
+	val, err := h.replicator.CachedRead(ctx, key)
+	if err != nil {
+		writeError(c, err)
+		return store.Value{}, false
+	}
+	if val == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		return store.Value{}, false
+	}
+	setSession(c, *val)
+	c.Header("ETag", etag(*val))
+	if notModified(c, *val) {
+		return store.Value{}, false
+	}
+	decoded, err := val.Decode()
+	if err != nil {
+		writeError(c, err)
+		return store.Value{}, false
+	}
+	return decoded, true
 }
 
-// Delete handles DELETE /kv/:key
+// KeyMeta handles GET /kv/:namespace/:key/meta
+//
+// Returns every replica's stored Value (clock, tombstone, updated_at)
+// side by side, for debugging divergence. Values are shown as stored:
+// compressed ones stay compressed.
+func (h *Handler) KeyMeta(c *gin.Context) {
+	key, ok := storeKey(c)
+	if !ok {
+		return
+	}
+	ctx, ok := readContext(c)
+	if !ok {
+		return
+	}
+	meta := h.replicator.KeyMeta(ctx, key)
+	c.JSON(http.StatusOK, gin.H{"namespace": c.Param("namespace"), "key": c.Param("key"), "meta": meta})
+}
+
+// Delete handles DELETE /kv/:namespace/:key
 func (h *Handler) Delete(c *gin.Context) {
-	key := c.Param("key")
+	key, ok := storeKey(c)
+	if !ok {
+		return
+	}
+	if err := h.store.Limits().CheckKey(c.Param("key")); err != nil {
+		writeError(c, err)
+		return
+	}
+	async, ok := h.asyncWrite(c)
+	if !ok {
+		return
+	}
+	cond, ok := writeCondition(c)
+	if !ok {
+		return
+	}
+	if cond != nil {
+		if !h.conditionalWrite(c, key, async) {
+			return
+		}
+	} else if h.forward(c, key) {
+		return
+	}
+	h.replicator.TouchKey(key, true)
+
+	var err error
+	switch {
+	case cond != nil:
+		_, err = h.replicator.WriteIf(c.Request.Context(), store.TxnWrite{Key: key, Delete: true}, cond)
+	case async:
+		err = h.replicator.DeleteAsync(c.Request.Context(), key)
+	default:
+		err = h.replicator.DeleteReplicated(c.Request.Context(), key)
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	// Our tombstone, or a newer version if a write raced in: either way
+	// at least as new as the delete.
+	if val, ok := h.store.GetRaw(key); ok {
+		setSession(c, val)
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": c.Param("key")})
+}
 
-	if err := h.replicator.DeleteReplicated(key); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+// ListKeys handles GET /kv/:namespace
+// Returns every live key in the namespace, across the whole cluster.
+func (h *Handler) ListKeys(c *gin.Context) {
+	ns := c.Param("namespace")
+	if _, ok := h.store.GetNamespace(ns); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": store.ErrNamespaceNotFound.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"deleted": key})
+	keys := h.replicator.ListKeys(c.Request.Context(), ns)
+	c.JSON(http.StatusOK, gin.H{"namespace": ns, "keys": keys})
+}
+
+// ─── Namespace handlers ──────────────────────────────────────────────────────
+
+// ListNamespaces handles GET /namespaces
+// Key counts are local to this node.
+func (h *Handler) ListNamespaces(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"namespaces": h.store.Namespaces()})
+}
+
+// GetNamespace handles GET /namespaces/:namespace
+func (h *Handler) GetNamespace(c *gin.Context) {
+	ns, ok := h.store.GetNamespace(c.Param("namespace"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": store.ErrNamespaceNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ns)
+}
+
+// PutNamespace handles PUT /namespaces/:namespace
+// Body (optional): {"max_keys": 1000, "max_bytes": 1073741824, "rate_limit": 500, "compression": "zstd",
+// "ttl_seconds": 86400, "read_policy": "nearest", "tiebreak": "node-id", "delete_conflicts": "delete-wins"}
+//
+// Creates or updates the namespace locally, then broadcasts it to every
+// other node so the whole cluster agrees on namespace configs.
+func (h *Handler) PutNamespace(c *gin.Context) {
+	var body struct {
+		MaxKeys     int     `json:"max_keys"`
+		MaxBytes    int64   `json:"max_bytes"`
+		RateLimit   float64 `json:"rate_limit"`
+		Compression string  `json:"compression"`
+		Replication string  `json:"replication"`
+		Versions    int     `json:"versions"`
+
+		TTLSeconds      int64  `json:"ttl_seconds"`
+		ReadPolicy      string `json:"read_policy"`
+		Tiebreak        string `json:"tiebreak"`
+		DeleteConflicts string `json:"delete_conflicts"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !cluster.ValidReadPolicy(body.ReadPolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%v: read_policy must be %s", store.ErrInvalidConfig, cluster.ReadPolicies)})
+		return
+	}
+
+	ns, err := h.store.PutNamespace(store.Namespace{
+		Name:        c.Param("namespace"),
+		MaxKeys:     body.MaxKeys,
+		MaxBytes:    body.MaxBytes,
+		RateLimit:   body.RateLimit,
+		Compression: body.Compression,
+		Replication: body.Replication,
+		Versions:    body.Versions,
+
+		TTLSeconds:      body.TTLSeconds,
+		ReadPolicy:      body.ReadPolicy,
+		Tiebreak:        body.Tiebreak,
+		DeleteConflicts: body.DeleteConflicts,
+	})
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	resp := gin.H{"namespace": ns}
+	if err := h.replicator.Broadcast(ctx, http.MethodPut, "/internal/namespaces/"+ns.Name, ns); err != nil {
+		logging.FromContext(ctx).Warn("namespace propagation incomplete", "namespace", ns.Name, "error", err)
+		resp["warning"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteNamespace handles DELETE /namespaces/:namespace
+// Only empty namespaces can be deleted.
+func (h *Handler) DeleteNamespace(c *gin.Context) {
+	name := c.Param("namespace")
+	if err := h.store.DeleteNamespace(name); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	resp := gin.H{"deleted": name}
+	if err := h.replicator.Broadcast(ctx, http.MethodDelete, "/internal/namespaces/"+name, nil); err != nil {
+		logging.FromContext(ctx).Warn("namespace propagation incomplete", "namespace", name, "error", err)
+		resp["warning"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // ─── Cluster management handlers ─────────────────────────────────────────────
@@ -134,7 +623,11 @@ func (h *Handler) Join(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"joined": node.ID})
+
+	// Send the full member list, so the new node learns everyone too.
+	resp := gin.H{"joined": node.ID}
+	h.propagateMembership(c, cluster.MembershipUpdate{Join: h.membership.All()}, resp)
+	c.JSON(http.StatusOK, resp)
 }
 
 // Leave handles POST /cluster/leave
@@ -151,7 +644,107 @@ func (h *Handler) Leave(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"left": body.ID})
+
+	resp := gin.H{"left": body.ID}
+	h.propagateMembership(c, cluster.MembershipUpdate{Leave: []string{body.ID}}, resp)
+	c.JSON(http.StatusOK, resp)
+}
+
+// Decommission handles POST /cluster/decommission
+// Body: {"id": "<nodeID>"}
+//
+// Moves the node's data to the new owners, then removes it from the ring
+// (see cluster/decommission.go). The node runs it itself, so any other
+// node passes the request on. Answers 202 at once; progress is at
+// GET /cluster/decommission/:id.
+func (h *Handler) Decommission(c *gin.Context) {
+	raw, err := c.GetRawData()
+	if err != nil {
+		bodyError(c, err)
+		return
+	}
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(raw, &body); err != nil || body.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `body must be {"id": "<nodeID>"}`})
+		return
+	}
+	if body.ID != h.selfID {
+		h.forwardToNode(c, body.ID, raw)
+		return
+	}
+
+	st, err := h.replicator.Decommission(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "decommission": st})
+		return
+	}
+	c.JSON(http.StatusAccepted, st)
+}
+
+// DecommissionStatus handles GET /cluster/decommission/:id
+func (h *Handler) DecommissionStatus(c *gin.Context) {
+	if id := c.Param("id"); id != h.selfID {
+		h.forwardToNode(c, id, nil)
+		return
+	}
+	c.JSON(http.StatusOK, h.replicator.DecommissionStatus())
+}
+
+// propagateMembership broadcasts u to every other member.
+// A partial failure is reported as a "warning" in resp.
+func (h *Handler) propagateMembership(c *gin.Context, u cluster.MembershipUpdate, resp gin.H) {
+	ctx := c.Request.Context()
+	if err := h.replicator.BroadcastMembership(ctx, u); err != nil {
+		logging.FromContext(ctx).Warn("membership propagation incomplete", "error", err)
+		resp["warning"] = err.Error()
+	}
+}
+
+// InternalMembership handles POST /internal/membership
+// Applies a membership update from a peer, without re-broadcasting it.
+func (h *Handler) InternalMembership(c *gin.Context) {
+	var u cluster.MembershipUpdate
+	if err := c.ShouldBindJSON(&u); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	u.ResolveSender(c.Request.RemoteAddr)
+	if h.membership.Apply(u, h.selfID) {
+		CurrentLogger(c).Info("membership updated", "from", u.From, "join", len(u.Join), "leave", u.Leave,
+			"nodes", h.membership.Ring().NodeCount(), "ring", h.membership.View().String())
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// InternalShutdown handles POST /internal/shutdown
+// A peer is going down for a while: route around it until it is back.
+func (h *Handler) InternalShutdown(c *gin.Context) {
+	var n cluster.ShutdownNotice
+	if err := c.ShouldBindJSON(&n); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.replicator.PeerShuttingDown(c.Request.Context(), n.From)
+	c.Status(http.StatusNoContent)
+}
+
+// InternalHints handles POST /internal/hints
+// Takes over the hints a peer shutting down could not deliver.
+func (h *Handler) InternalHints(c *gin.Context) {
+	var body cluster.HintHandover
+	if err := c.ShouldBindJSON(&body); err != nil {
+		bodyError(c, err)
+		return
+	}
+	kept, err := h.replicator.TakeHints(body)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	CurrentLogger(c).Info("hints taken over", "from", body.From, "peer", body.Peer, "count", kept)
+	c.Status(http.StatusNoContent)
 }
 
 // ListNodes handles GET /cluster/nodes
@@ -159,33 +752,170 @@ func (h *Handler) ListNodes(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"nodes": h.membership.All()})
 }
 
+// Status handles GET /cluster/status
+//
+// It returns everything a client needs to rebuild the ring locally
+// and send requests straight to a key's owners.
+func (h *Handler) Status(c *gin.Context) {
+	q := h.replicator.Quorum()
+	c.JSON(http.StatusOK, gin.H{
+		"self":   h.selfID,
+		"vnodes": h.membership.Ring().Vnodes(),
+		"n":      q.N,
+		"w":      q.W,
+		"r":      q.R,
+		"quorum": q,
+		"ring":   h.membership.View(),
+		"nodes":  h.membership.All(),
+		// Builds and wire protocols, for rolling upgrades (see cluster/protocol.go).
+		"versions":         h.replicator.NodeVersions(),
+		"cluster_protocol": h.replicator.ClusterProtocol(),
+	})
+}
+
 // ─── Internal (peer-to-peer) handlers ────────────────────────────────────────
 
 // InternalReplicate handles POST /internal/replicate
 // Accepts a value from a peer and applies it using vector-clock conflict resolution.
+//
+// The body is msgpack or JSON, as its Content-Type says.
 func (h *Handler) InternalReplicate(c *gin.Context) {
 	var req cluster.ReplicateRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if c.ContentType() == wire.ContentType {
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			bodyError(c, err)
+			return
+		}
+		if req.Key, req.Value, err = wire.UnmarshalReplicate(data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		bodyError(c, err)
+		return
+	}
+	if h.rejectStale(c, req.Key) {
 		return
 	}
 
 	_, err := h.store.ApplyRemote(req.Key, req.Value)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err) // 507 for a replica short of disk
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
 
-// InternalFetch handles GET /internal/fetch/:key
-// Returns the raw value (including tombstones) so peers can do read repair.
+// InternalReplicateBatch handles POST /internal/replicate/batch
+// Applies each write of a batch as InternalReplicate would, and reports
+// the ones it refused or failed; the batch itself always succeeds.
+func (h *Handler) InternalReplicateBatch(c *gin.Context) {
+	var req cluster.ReplicateBatchRequest
+	if c.ContentType() == wire.ContentType {
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			bodyError(c, err)
+			return
+		}
+		writes, err := wire.UnmarshalReplicateBatch(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.Writes = make([]cluster.ReplicateRequest, len(writes))
+		for i, w := range writes {
+			req.Writes[i] = cluster.ReplicateRequest{Key: w.Key, Value: w.Value}
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		bodyError(c, err)
+		return
+	}
+
+	var resp cluster.ReplicateBatchResponse
+	stale := h.replicator.Stale(c.GetHeader(cluster.RingHeader))
+	for i, w := range req.Writes {
+		if stale && !h.replicator.IsOwner(w.Key) {
+			resp.Stale = append(resp.Stale, i)
+			continue
+		}
+		if _, err := h.store.ApplyRemote(w.Key, w.Value); err != nil {
+			resp.Failed = append(resp.Failed, cluster.ReplicateBatchFailure{Index: i, Error: err.Error()})
+		}
+	}
+	if len(resp.Stale) > 0 {
+		view := h.membership.View()
+		c.Header(cluster.RingHeader, view.String())
+		resp.Ring = view.String()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// InternalFetch handles GET /internal/fetch/:namespace/:key
+// Returns the raw value (including tombstones) so peers can do read repair,
+// in msgpack if the caller accepts it.
 func (h *Handler) InternalFetch(c *gin.Context) {
-	key := c.Param("key")
+	key, ok := storeKey(c)
+	if !ok {
+		return
+	}
+	if h.rejectStale(c, key) {
+		return
+	}
 	val, ok := h.store.GetRaw(key)
 	if !ok {
 		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
 		return
 	}
+	if strings.Contains(c.GetHeader("Accept"), wire.ContentType) {
+		c.Data(http.StatusOK, wire.ContentType, wire.MarshalValue(val))
+		return
+	}
 	c.JSON(http.StatusOK, val)
 }
+
+// InternalKeys handles GET /internal/keys/:namespace
+// Returns the live keys of a namespace stored on THIS node only.
+// With ?limit= only one page: the first limit keys after ?after= that
+// start with ?prefix=, in order (see ListKeysPage), and pass the scan
+// filter in the query (see store/filter.go).
+func (h *Handler) InternalKeys(c *gin.Context) {
+	ns := c.Param("namespace")
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		f, err := store.ParseFilter(c.Request.URL.Query())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		keys := h.store.KeysPage(ns, c.Query("prefix"), c.Query("after"), limit, f)
+		c.JSON(http.StatusOK, gin.H{"keys": keys})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": h.store.Keys(ns)})
+}
+
+// InternalPutNamespace handles PUT /internal/namespaces/:namespace
+// Applies a namespace config broadcast by another node (no re-broadcast).
+func (h *Handler) InternalPutNamespace(c *gin.Context) {
+	var ns store.Namespace
+	if err := c.ShouldBindJSON(&ns); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ns.Name = c.Param("namespace")
+	if _, err := h.store.PutNamespace(ns); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// InternalDeleteNamespace handles DELETE /internal/namespaces/:namespace
+func (h *Handler) InternalDeleteNamespace(c *gin.Context) {
+	err := h.store.DeleteNamespace(c.Param("namespace"))
+	if err != nil && !errors.Is(err, store.ErrNamespaceNotFound) {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
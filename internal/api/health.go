@@ -0,0 +1,159 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Liveness and readiness ──────────────────────────────────────────────────
+//
+//	GET /healthz → 200 while the process runs: {"node", "status", "version",
+//	               "protocol", "ring", "time"}
+//	GET /readyz  → 200 when ready for client traffic, else 503; both with
+//	               {"ready": bool, "checks": [{"name", "ok", "detail"}]}
+//
+// /health is /healthz under its old name. status is "starting" while the
+// WAL replays (StartupHandler answers then) and "ok" after, which is how
+// peers tell a node that can take their traffic (see cluster/readiness.go).
+// While the store loads, /readyz also has "startup": the phase, bytes
+// read of the total, records applied and an estimate of the time left.
+//
+// Until the node has been ready once, the coordinator routes (/kv,
+// /batch, /txn, /locks, /watch) answer 503 with Retry-After: peer,
+// cluster and admin routes work from the start. While the node is fenced
+// (cluster/fencing.go) they answer 503 to everything but reads, and once
+// it is shutting down (cluster/shutdown.go) to everything.
+
+// isProbePath reports whether path is a health probe: open without auth
+// and never rate limited.
+func isProbePath(path string) bool {
+	return path == "/health" || path == "/healthz" || path == "/readyz"
+}
+
+// Healthz handles GET /healthz (and /health).
+func (h *Handler) Healthz(c *gin.Context) {
+	// Peers probe this every few seconds: what they run is learnt here.
+	h.replicator.ObserveVersion(c.Request.Context(), c.GetHeader(cluster.PeerHeader), c.Request.Header)
+	h.replicator.SetProtocolHeaders(c.Writer.Header())
+	c.JSON(http.StatusOK, gin.H{
+		"node":     h.selfID,
+		"status":   "ok",
+		"nodes":    h.membership.Ring().NodeCount(),
+		"ring":     h.membership.View().String(), // compared by self-fencing
+		"version":  h.replicator.Version(),
+		"protocol": cluster.ProtocolVersion, // see cluster/protocol.go
+		"time":     time.Now().UTC(),        // peers read our clock (see cluster/skew.go)
+	})
+}
+
+// recoveryDetail describes st for the wal check, e.g.
+// "replaying wal.log: 41% of 2.1 GiB, about 1m20s left".
+func recoveryDetail(st store.RecoveryStatus) string {
+	if st.Phase == store.RecoveryDone {
+		return "replayed; starting services"
+	}
+	verb := "replaying"
+	if st.Phase == store.RecoverySnapshot {
+		verb = "loading snapshot"
+	}
+	detail := verb
+	if st.File != "" {
+		detail += " " + st.File
+	}
+	if st.BytesTotal > 0 {
+		detail += fmt.Sprintf(": %d%% of %s", 100*st.BytesDone/st.BytesTotal, approxBytes(st.BytesTotal))
+	}
+	if st.RemainingMs > 0 {
+		detail += fmt.Sprintf(", about %s left", (time.Duration(st.RemainingMs) * time.Millisecond).Round(time.Second))
+	}
+	return detail
+}
+
+// approxBytes renders n to one decimal in the largest unit that fits.
+func approxBytes(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		shift  uint
+	}{{"GiB", 30}, {"MiB", 20}, {"KiB", 10}} {
+		if n >= 1<<u.shift {
+			return fmt.Sprintf("%.1f %s", float64(n)/float64(int64(1)<<u.shift), u.suffix)
+		}
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// Readyz handles GET /readyz
+func (h *Handler) Readyz(c *gin.Context) {
+	r := h.replicator.Ready()
+	status := http.StatusOK
+	if !r.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, r)
+}
+
+// servedWhileFenced are the routes besides GET and HEAD that a fenced
+// node still serves: POST /kv/mget only reads, and a batch fails just
+// its writes (execBatch).
+var servedWhileFenced = map[string]bool{"/kv/mget": true, "/batch": true}
+
+// requireReady refuses coordinator requests until the node has been
+// ready once and after shutdown began, and writes while it is fenced.
+func (h *Handler) requireReady() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.replicator.ShuttingDown() {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": cluster.ErrShuttingDown.Error()})
+			return
+		}
+		if !h.replicator.Serving() {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":  "node is not ready yet",
+				"checks": h.replicator.Ready().Checks,
+			})
+			return
+		}
+		if reason, fenced := h.replicator.Fenced(); fenced && c.Request.Method != http.MethodGet &&
+			c.Request.Method != http.MethodHead && !servedWhileFenced[c.FullPath()] {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":  cluster.ErrFenced.Error(),
+				"reason": reason,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// StartupHandler answers while the store is still loading: probes get
+// "starting" and not ready, with rec's progress, everything else a 503.
+// The server swaps in the real router once the node is set up.
+func StartupHandler(selfID, version string, rec *store.Recovery) http.Handler {
+	reply := func(w http.ResponseWriter, status int, body any) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health", "/healthz":
+			reply(w, http.StatusOK, gin.H{"node": selfID, "status": "starting", "version": version})
+		case "/readyz":
+			st := rec.Status()
+			reply(w, http.StatusServiceUnavailable, gin.H{"ready": false, "startup": st, "checks": []gin.H{
+				{"name": "wal", "ok": false, "detail": recoveryDetail(st)},
+			}})
+		default:
+			w.Header().Set("Retry-After", "5")
+			reply(w, http.StatusServiceUnavailable, gin.H{"error": "node is starting: replaying its WAL"})
+		}
+	})
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Idempotent writes
+//
+// A client that times out on PUT cannot know whether the write happened.
+// If it simply retries, the coordinator runs ReplicateWrite again: a second
+// vector-clock bump, and for a DELETE after someone else's PUT, a lost write.
+//
+// So clients may send a unique key per logical operation:
+//
+//	Idempotency-Key: 6f1c…
+//
+// The coordinator remembers the response for that key (for a TTL).
+// A retry with the same key gets the SAME response back, marked with
+// "Idempotent-Replayed: true", without touching the store.
+//
+//   - Same key, different request (method, path or body) → 422.
+//   - Same key while the first request is still running → wait for it.
+//   - 5xx responses are not remembered, so those can be retried for real.
+//
+// Keys are scoped per principal, so two tokens can never collide. On a
+// forwarded request the caller is the forwarding peer; the scope is then
+// the principal that peer authenticated (PrincipalHeader, forward.go).
+//
+// The fingerprint of most requests hashes the body, read up front. A raw
+// PUT (raw.go) streams its body into the value, bounded by
+// --max-value-size as it reads; buffering it here first would hold it
+// twice, and all of it before the limit applies. So its body is hashed
+// as the handler reads it, and a retry compares hashes once the first
+// attempt is done: it waits for that attempt, then reads and hashes its
+// own body (discarding it) before it is replayed or refused. A raw PUT
+// whose body was not read to the end (refused early, or too large) is
+// not remembered, as if it had failed with a 5xx.
+
+// IdempotencyHeader carries the client-chosen idempotency key.
+const IdempotencyHeader = "Idempotency-Key"
+
+// DefaultIdempotencyTTL is how long responses are remembered.
+const DefaultIdempotencyTTL = 10 * time.Minute
+
+// idemEntry is one remembered (or in-flight) request.
+type idemEntry struct {
+	fingerprint string
+	done        chan struct{} // closed when the response is recorded
+	status      int
+	contentType string
+	session     string // X-Session of the response, if any
+	etag        string
+	body        []byte
+	expires     time.Time
+
+	streamed bool   // body hashed as it is read: sum, not fingerprint, covers it
+	sum      string // of a streamed body, once done
+	retry    bool   // forgotten once done: waiters run their own request
+}
+
+// idempotencyCache maps scoped idempotency keys to responses.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	entries   map[string]*idemEntry
+	lastSweep time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{ttl: ttl, entries: make(map[string]*idemEntry)}
+}
+
+// begin returns the existing entry for key (owner=false), or registers
+// a new in-flight entry that the caller must finish (owner=true).
+func (ic *idempotencyCache) begin(key, fingerprint string, streamed bool) (e *idemEntry, owner bool) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(ic.lastSweep) > time.Minute {
+		for k, e := range ic.entries {
+			if !e.expires.IsZero() && now.After(e.expires) {
+				delete(ic.entries, k)
+			}
+		}
+		ic.lastSweep = now
+	}
+
+	if e, ok := ic.entries[key]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false
+	}
+	e = &idemEntry{fingerprint: fingerprint, streamed: streamed, done: make(chan struct{})}
+	ic.entries[key] = e
+	return e, true
+}
+
+// finish records the response, or forgets the key for 5xx (and streamed
+// bodies not read to the end, sum "") so the client can retry for real.
+func (ic *idempotencyCache) finish(key string, e *idemEntry, status int, contentType, session, etag string, body []byte, sum string) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	e.status, e.contentType, e.session, e.etag, e.body, e.sum = status, contentType, session, etag, body, sum
+	e.expires = time.Now().Add(ic.ttl)
+	if status >= 500 || e.streamed && sum == "" {
+		e.retry = true
+		delete(ic.entries, key)
+	}
+	close(e.done)
+}
+
+// hashingBody hashes a request body as the handler reads it.
+type hashingBody struct {
+	io.ReadCloser
+	h   hash.Hash
+	eof bool // read to the end
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.h.Write(p[:n])
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// sum returns the hash of the body, or "" if it was not read to the end.
+func (b *hashingBody) sum() string {
+	if !b.eof {
+		return ""
+	}
+	return hex.EncodeToString(b.h.Sum(nil))
+}
+
+// streamsBody reports whether c's handler reads its body as a stream
+// (see the note on raw PUTs above).
+func streamsBody(c *gin.Context) bool {
+	return c.Request.Method == http.MethodPut && strings.HasSuffix(c.FullPath(), "/raw")
+}
+
+// recordingWriter copies the response body while it is written.
+type recordingWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// SetIdempotencyTTL changes how long idempotent responses are remembered.
+func (h *Handler) SetIdempotencyTTL(ttl time.Duration) {
+	h.idem.mu.Lock()
+	h.idem.ttl = ttl
+	h.idem.mu.Unlock()
+}
+
+// idempotent is the middleware for PUT/DELETE on /kv and POST /txn.
+// Requests without an Idempotency-Key pass through untouched.
+func (h *Handler) idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idemKey := c.GetHeader(IdempotencyHeader)
+		if idemKey == "" || c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+
+		streamed := streamsBody(c)
+		fingerprint := c.Request.Method + " " + c.Request.URL.Path
+		if !streamed {
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				bodyError(c, err)
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			fingerprint += " " + hex.EncodeToString(sum[:])
+		}
+
+		key := callerName(c) + "\x00" + idemKey
+
+		e, owner := h.idem.begin(key, fingerprint, streamed)
+		if !owner {
+			if e.fingerprint != fingerprint {
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity,
+					gin.H{"error": "idempotency key reused with a different request"})
+				return
+			}
+			select {
+			case <-e.done:
+			case <-c.Request.Context().Done():
+				c.AbortWithStatusJSON(http.StatusConflict,
+					gin.H{"error": "request with this idempotency key is still in progress"})
+				return
+			}
+			if e.retry {
+				// The first attempt failed and was forgotten: run again.
+				h.idempotent()(c)
+				return
+			}
+			if streamed {
+				hb := &hashingBody{ReadCloser: c.Request.Body, h: sha256.New()}
+				if _, err := io.Copy(io.Discard, hb); err != nil {
+					bodyError(c, err)
+					return
+				}
+				if hb.sum() != e.sum {
+					c.AbortWithStatusJSON(http.StatusUnprocessableEntity,
+						gin.H{"error": "idempotency key reused with a different request"})
+					return
+				}
+			}
+			c.Header("Idempotent-Replayed", "true")
+			if e.session != "" {
+				c.Header(SessionHeader, e.session)
+			}
+			if e.etag != "" {
+				c.Header("ETag", e.etag)
+			}
+			c.Data(e.status, e.contentType, e.body)
+			c.Abort()
+			return
+		}
+
+		var hb *hashingBody
+		if streamed {
+			hb = &hashingBody{ReadCloser: c.Request.Body, h: sha256.New()}
+			c.Request.Body = hb
+		}
+		rec := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = rec
+		defer func() {
+			c.Writer = rec.ResponseWriter
+			if r := recover(); r != nil {
+				h.idem.finish(key, e, http.StatusInternalServerError, "", "", "", nil, "")
+				panic(r) // let Recovery answer
+			}
+			sum := ""
+			if hb != nil {
+				sum = hb.sum()
+			}
+			h.idem.finish(key, e, rec.Status(), rec.Header().Get("Content-Type"), rec.Header().Get(SessionHeader), rec.Header().Get("ETag"), rec.buf.Bytes(), sum)
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultMaxBodySize caps request bodies. It leaves room for a value of
+// store.DefaultMaxValueSize even after JSON escaping.
+const DefaultMaxBodySize = 8 << 20 // 8 MiB
+
+// BodyLimit rejects request bodies larger than maxBytes with 413.
+//
+// The limit is enforced while the body is read (http.MaxBytesReader),
+// so an oversized upload is cut off after maxBytes instead of being
+// buffered whole. /admin/restore streams archives and is exempt.
+//
+// Register AFTER Compression so the limit applies to the decompressed
+// body: a tiny zstd body can expand to gigabytes.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 || c.Request.Body == nil || strings.HasPrefix(c.Request.URL.Path, "/admin/restore") {
+			c.Next()
+			return
+		}
+		if c.Request.ContentLength > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLargeMessage(maxBytes)})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// bodyError answers a failed body read or bind:
+// 413 if the body hit the BodyLimit, 400 otherwise.
+func bodyError(c *gin.Context, err error) {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": tooLargeMessage(mbe.Limit)})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+func tooLargeMessage(limit int64) string {
+	return "request body too large: limit is " + formatBytes(limit)
+}
+
+// formatBytes renders n as B, KiB or MiB.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return strconv.FormatInt(n>>20, 10) + " MiB"
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return strconv.FormatInt(n>>10, 10) + " KiB"
+	}
+	return strconv.FormatInt(n, 10) + " bytes"
+}
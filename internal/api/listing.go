@@ -0,0 +1,117 @@
+package api
+
+import (
+	"distributed-kvstore/internal/store"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Paged key listing ───────────────────────────────────────────────────────
+//
+// GET /kv/:namespace builds the whole key list in memory, on every node
+// and again on the coordinator. GET /kv walks the keys in sorted order
+// instead, a page at a time:
+//
+//	GET /kv?namespace=app1&prefix=user:&limit=500
+//	→ {"namespace": "app1", "keys": [...], "next_cursor": "dXNlcjo0Mg"}
+//	GET /kv?namespace=app1&prefix=user:&limit=500&cursor=dXNlcjo0Mg
+//	→ ... until there is no next_cursor
+//
+// The cursor is opaque to clients (it encodes the last key returned), so
+// a listing survives writes in between: it resumes after that key.
+//
+// With stream=true the server does the paging itself and sends every
+// matching key from the cursor on as NDJSON, one {"key": ...} per line,
+// flushed page by page; limit is then the page size. An error after the
+// first line is sent as a final {"error": ...} line.
+//
+// contains=, field= (with equals=) and updated_after= list only the keys
+// whose value matches (see store/filter.go). Every node filters as it
+// walks its own keys, so only matches cross the network:
+//
+//	GET /kv?namespace=app1&prefix=order:&field=status&equals=failed&updated_after=2026-10-01T00:00:00Z
+
+// Page sizes for GET /kv.
+const (
+	defaultPageSize = 1000
+	maxPageSize     = 10000
+)
+
+// listPage is one page of GET /kv.
+type listPage struct {
+	Namespace  string   `json:"namespace"`
+	Keys       []string `json:"keys"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// ScanKeys handles GET /kv?namespace=&prefix=&cursor=&limit=&stream=&contains=&field=&equals=&updated_after=
+func (h *Handler) ScanKeys(c *gin.Context) {
+	ns := c.DefaultQuery("namespace", store.DefaultNamespace)
+	if _, ok := h.store.GetNamespace(ns); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": store.ErrNamespaceNotFound.Error()})
+		return
+	}
+	prefix := c.Query("prefix")
+	after, err := decodeCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+		return
+	}
+	limit := defaultPageSize
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxPageSize)})
+			return
+		}
+	}
+	f, err := store.ParseFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if c.Query("stream") != "true" {
+		keys, more := h.replicator.ListKeysPage(ctx, ns, prefix, after, limit, f)
+		page := listPage{Namespace: ns, Keys: keys}
+		if more && len(keys) > 0 {
+			page.NextCursor = encodeCursor(keys[len(keys)-1])
+		}
+		c.JSON(http.StatusOK, page)
+		return
+	}
+
+	startStream(c, "application/x-ndjson")
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	for {
+		keys, more := h.replicator.ListKeysPage(ctx, ns, prefix, after, limit, f)
+		for _, k := range keys {
+			if err := enc.Encode(gin.H{"key": k}); err != nil {
+				return // client went away
+			}
+		}
+		c.Writer.Flush()
+		if !more || len(keys) == 0 {
+			return
+		}
+		if err := ctx.Err(); err != nil {
+			_ = enc.Encode(gin.H{"error": err.Error()})
+			return
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	return string(b), err
+}
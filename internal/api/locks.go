@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Locks ────────────────────────────────────────────────────────────────────
+//
+//	POST /locks/:name/acquire  {"holder": "worker-1", "ttl_ms": 15000}
+//	→ 200 {"name": "leader", "holder": "worker-1", "token": 7, "expires": ...}
+//	POST /locks/:name/renew    {"holder": "worker-1", "token": 7, "ttl_ms": 15000}
+//	POST /locks/:name/release  {"holder": "worker-1", "token": 7}
+//	GET  /locks/:name
+//
+// A lock held by someone else (acquire), or no longer held with this
+// token (renew, release), is a 409 with the current lease. Changes run
+// on the lock's primary replica (see cluster/locks.go); other nodes
+// forward them there.
+
+// lockBody is the body of the POST /locks/:name/* requests.
+type lockBody struct {
+	Holder string `json:"holder"`
+	Token  uint64 `json:"token"`  // renew, release
+	TTLMs  int64  `json:"ttl_ms"` // acquire, renew; 0 = cluster.DefaultLeaseTTL
+}
+
+// AcquireLock handles POST /locks/:name/acquire
+func (h *Handler) AcquireLock(c *gin.Context) {
+	h.changeLock(c, func(ctx context.Context, name string, b lockBody, ttl time.Duration) (cluster.Lease, error) {
+		return h.replicator.AcquireLock(ctx, name, b.Holder, ttl)
+	})
+}
+
+// RenewLock handles POST /locks/:name/renew
+func (h *Handler) RenewLock(c *gin.Context) {
+	h.changeLock(c, func(ctx context.Context, name string, b lockBody, ttl time.Duration) (cluster.Lease, error) {
+		return h.replicator.RenewLock(ctx, name, b.Holder, b.Token, ttl)
+	})
+}
+
+// ReleaseLock handles POST /locks/:name/release
+func (h *Handler) ReleaseLock(c *gin.Context) {
+	h.changeLock(c, func(ctx context.Context, name string, b lockBody, _ time.Duration) (cluster.Lease, error) {
+		return h.replicator.ReleaseLock(ctx, name, b.Holder, b.Token)
+	})
+}
+
+// changeLock parses a lock request, forwards it to the lock's primary
+// if need be, and runs change there.
+func (h *Handler) changeLock(c *gin.Context, change func(context.Context, string, lockBody, time.Duration) (cluster.Lease, error)) {
+	name := c.Param("name")
+	if err := h.store.Limits().CheckKey(name); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	raw, err := c.GetRawData()
+	if err != nil {
+		bodyError(c, err)
+		return
+	}
+	var body lockBody
+	if err := json.Unmarshal(raw, &body); err != nil || body.Holder == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be JSON with a holder"})
+		return
+	}
+	ttl := cluster.DefaultLeaseTTL
+	if body.TTLMs != 0 {
+		ttl = time.Duration(body.TTLMs) * time.Millisecond
+	}
+	if ttl <= 0 || ttl > cluster.MaxLeaseTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ttl_ms must be between 1 and " + cluster.MaxLeaseTTL.String()})
+		return
+	}
+
+	coord, err := h.replicator.LockCoordinator(name)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if coord.ID != h.selfID && c.GetHeader(cluster.ForwardedHeader) == "" {
+		h.forwardToNode(c, coord.ID, raw)
+		return
+	}
+
+	lease, err := change(c.Request.Context(), name, body, ttl)
+	switch {
+	case errors.Is(err, cluster.ErrLockHeld), errors.Is(err, cluster.ErrLockLost):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "lease": lease})
+	case err != nil:
+		writeError(c, err)
+	default:
+		c.JSON(http.StatusOK, lease)
+	}
+}
+
+// GetLock handles GET /locks/:name
+// 404 if the lock was never taken; a released or expired one is returned
+// with "held": false.
+func (h *Handler) GetLock(c *gin.Context) {
+	name := c.Param("name")
+	lease, ok, err := h.replicator.GetLock(c.Request.Context(), name)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "lock not found"})
+		return
+	}
+	c.JSON(http.StatusOK, struct {
+		cluster.Lease
+		Held bool `json:"held"`
+	}{lease, lease.HeldAt(time.Now())})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"distributed-kvstore/internal/metrics"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Request metrics ─────────────────────────────────────────────────────────
+//
+//	GET /metrics → every metric in the Prometheus text format (read scope)
+//
+// RequestMetrics records each request under its route template
+// (/kv/:namespace/:key, never the concrete key, so the series stay few)
+// and the group the route belongs to:
+//
+//	kv_http_requests_total{group, method, route, code}
+//	kv_http_request_duration_seconds{group, method, route}  (histogram)
+//	kv_http_requests_in_flight{group}
+//
+// It runs before authentication and rate limiting, so 401s and 429s are
+// counted too. Requests that match no route count as route="unmatched".
+
+// RequestMetrics returns middleware recording every request in reg.
+func RequestMetrics(reg *metrics.Registry) gin.HandlerFunc {
+	requests := reg.Counter("kv_http_requests_total",
+		"HTTP requests handled, by route and status code.", "group", "method", "route", "code")
+	latency := reg.Histogram("kv_http_request_duration_seconds",
+		"Time to handle an HTTP request, by route.", nil, "group", "method", "route")
+	inFlight := reg.Gauge("kv_http_requests_in_flight",
+		"HTTP requests being handled.", "group")
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		group, method := routeGroup(route), metricMethod(c.Request.Method)
+		gauge := inFlight.With(group)
+		gauge.Add(1)
+		start := time.Now()
+
+		c.Next()
+
+		gauge.Add(-1)
+		requests.With(group, method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		latency.With(group, method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// routeGroup classifies a route template: public (client API), internal
+// (peer traffic), admin (including namespace management), cluster
+// (membership), probe or other.
+func routeGroup(route string) string {
+	switch {
+	case isProbePath(route), route == "/metrics":
+		return "probe"
+	case strings.HasPrefix(route, "/internal/"):
+		return "internal"
+	case strings.HasPrefix(route, "/admin/"), strings.HasPrefix(route, "/namespaces"):
+		return "admin"
+	case strings.HasPrefix(route, "/cluster/"):
+		return "cluster"
+	case route == "unmatched":
+		return "other"
+	}
+	return "public"
+}
+
+// metricMethod bounds the method label: anything unusual is "other".
+func metricMethod(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch, http.MethodOptions:
+		return m
+	}
+	return "other"
+}
+
+// SetMetrics serves reg on GET /metrics. Call before Register.
+func (h *Handler) SetMetrics(reg *metrics.Registry) {
+	h.metrics = reg
+}
+
+// Metrics handles GET /metrics
+func (h *Handler) Metrics(c *gin.Context) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", metrics.ContentType)
+	_, _ = h.metrics.WriteTo(c.Writer)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Multi-get ────────────────────────────────────────────────────────────────
+//
+//	POST /kv/mget
+//	{"namespace": "users", "keys": ["42", "43", "44"]}
+//	→ 200 {"results": [{"key": "42", "status": 200, "value": "alice", "clock": {...}, "updated_at": ...},
+//	                   {"key": "43", "status": 404, "error": "key not found"}, ...]}
+//
+// N keys for the latency of about one quorum read instead of N in a row.
+// The keys are read like the gets of a batch (see batch.go): grouped by
+// replica set, the groups this node coordinates read here in parallel,
+// each other group forwarded to an owner in one request. Every read
+// shares one deadline: the client's X-Request-Timeout, or the quorum
+// timeout. A key that misses it fails with 504 on its own; the others
+// are still returned.
+//
+// Takes the read scope, and X-Read-Policy like GET.
+
+// mgetResult is the read of one key, at the key's index.
+type mgetResult struct {
+	Key string `json:"key"`
+	batchResult
+}
+
+// MultiGet handles POST /kv/mget
+func (h *Handler) MultiGet(c *gin.Context) {
+	var body struct {
+		Namespace string   `json:"namespace"`
+		Keys      []string `json:"keys"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		bodyError(c, err)
+		return
+	}
+	if len(body.Keys) == 0 || len(body.Keys) > MaxBatchOps {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("mget needs 1 to %d keys", MaxBatchOps)})
+		return
+	}
+	ctx, ok := readContext(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.replicator.Timeouts().Quorum)
+	defer cancel()
+
+	ops := make([]batchOp, len(body.Keys))
+	for i, key := range body.Keys {
+		ops[i] = batchOp{Op: "get", Namespace: body.Namespace, Key: key}
+	}
+	results := make([]mgetResult, len(ops))
+	for i, res := range h.execBatch(c, ctx, "", ops) {
+		results[i] = mgetResult{Key: body.Keys[i], batchResult: res}
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
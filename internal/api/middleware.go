@@ -1,12 +1,48 @@
 package api
 
 import (
-	"log"
+	"distributed-kvstore/internal/logging"
+	"log/slog"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+////////////////////////////////////////////////////////////////////////////////
+// REQUEST ID MIDDLEWARE
+////////////////////////////////////////////////////////////////////////////////
+
+// RequestID makes sure every request carries an ID.
+//
+// If the caller already sent X-Request-ID (a client, or a coordinator
+// calling us as a replica) we reuse it. Otherwise we generate one.
+//
+// The ID is:
+//   - stored in the request context (so handlers and the replicator see it)
+//   - echoed back in the response header (so clients can report it)
+//
+// Must be registered BEFORE Logger and Recovery so they can log it.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(logging.RequestIDHeader)
+		if id == "" {
+			id = logging.NewRequestID()
+		}
+
+		ctx := logging.WithRequestID(c.Request.Context(), id)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(logging.RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// CurrentLogger returns the slog logger for this request
+// (with the request ID attached).
+func CurrentLogger(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
+
 ////////////////////////////////////////////////////////////////////////////////
 // REQUEST LOGGER MIDDLEWARE
 ////////////////////////////////////////////////////////////////////////////////
@@ -28,7 +64,12 @@ import (
 //	→ Debugging becomes painful.
 //	→ Production issues are invisible.
 //
-// This middleware prints structured logs for each request.
+// This middleware prints one structured log line per request.
+// The level depends on the status code:
+//
+//	5xx → ERROR
+//	4xx → WARN
+//	else → INFO
 func Logger() gin.HandlerFunc {
 
 	// Gin middleware always returns a function
@@ -50,13 +91,25 @@ func Logger() gin.HandlerFunc {
 		// Calculate how long the request took.
 		latency := time.Since(start)
 
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		if isProbePath(c.Request.URL.Path) {
+			level = slog.LevelDebug // polled every few seconds; a 503 while starting is expected
+		}
+
 		// Log useful request details.
-		log.Printf("[%s] %s %s | %d | %s",
-			c.Request.Method,   // GET, PUT, DELETE, etc.
-			c.Request.URL.Path, // /kv/mykey
-			c.ClientIP(),       // client IP address
-			c.Writer.Status(),  // HTTP status code (200, 404, 500)
-			latency,            // total processing time
+		logging.FromContext(c.Request.Context()).Log(c.Request.Context(), level, "request",
+			"method", c.Request.Method, // GET, PUT, DELETE, etc.
+			"path", c.Request.URL.Path, // /kv/mykey
+			"client_ip", c.ClientIP(), // client IP address
+			"status", status, // HTTP status code (200, 404, 500)
+			"latency", latency, // total processing time
 		)
 	}
 }
@@ -96,7 +149,8 @@ func Recovery() gin.HandlerFunc {
 			if err := recover(); err != nil {
 
 				// Log the panic.
-				log.Printf("PANIC recovered: %v", err)
+				logging.FromContext(c.Request.Context()).Error("panic recovered",
+					"error", err, "path", c.Request.URL.Path)
 
 				// Abort the request.
 				// We return a safe generic error to the client.
@@ -0,0 +1,499 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // crypto.SHA256 for RS256, PS256, ES256
+	_ "crypto/sha512" // crypto.SHA384 and SHA512
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/logging"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// OIDC / JWT TOKENS
+////////////////////////////////////////////////////////////////////////////////
+
+// Static tokens live in the auth file: every new person or service is an
+// edit on every node, and a leaked token works until someone notices.
+// With an "oidc" section the nodes also accept JWTs (ID or access tokens)
+// from the company's identity provider:
+//
+//	"oidc": {
+//	  "issuer":   "https://sso.example.com/realms/corp",
+//	  "audience": "kvstore",
+//	  "roles_claim": "groups",
+//	  "roles": {
+//	    "kv-admins": {"scopes": ["admin"]},
+//	    "team-app1": {"scopes": ["read", "write"], "namespaces": ["app1"]},
+//	    "analysts":  {"scopes": ["read"]}
+//	  }
+//	}
+//
+// A JWT is accepted when its signature verifies against the issuer's
+// published keys (JWKS) and its iss, aud, exp and nbf claims hold. The
+// caller is named by name_claim (default "sub"). Its scopes are those of
+// every role listed in roles_claim (default "roles"; a dotted path such
+// as "realm_access.roles" reaches into nested claims) that the config
+// maps; a token with no mapped role authenticates but may do nothing.
+//
+// A role with namespaces confines the caller to them, as an ACL does
+// (see acl.go): readwrite where the role can write, read otherwise. The
+// roles add up, and one role without namespaces lifts the confinement.
+// Without any, cluster ACLs set for the caller's name apply.
+//
+// The keys come from jwks_url, or from the issuer's discovery document
+// when it is not set. They are fetched on first use, again every
+// jwksRefresh, and when a token names a key we do not have (the
+// provider rotated), at most once per jwksMinRefresh.
+
+// OIDCConfig is the "oidc" section of the auth file.
+type OIDCConfig struct {
+	Issuer     string              `json:"issuer"`
+	Audience   string              `json:"audience"`
+	JWKSURL    string              `json:"jwks_url,omitempty"`    // "" = from the issuer's discovery document
+	NameClaim  string              `json:"name_claim,omitempty"`  // "" = "sub"
+	RolesClaim string              `json:"roles_claim,omitempty"` // "" = "roles"
+	Roles      map[string]OIDCRole `json:"roles"`
+}
+
+// OIDCRole is what a role in the roles claim grants.
+type OIDCRole struct {
+	Scopes     []Scope  `json:"scopes"`
+	Namespaces []string `json:"namespaces,omitempty"` // empty = every namespace
+}
+
+const (
+	jwksRefresh    = time.Hour
+	jwksMinRefresh = time.Minute
+	jwksTimeout    = 10 * time.Second
+
+	// jwtLeeway absorbs clock skew between us and the issuer on exp/nbf.
+	jwtLeeway = time.Minute
+)
+
+// errInvalidJWT wraps every reason a JWT is refused.
+var errInvalidJWT = errors.New("invalid JWT")
+
+// validate checks the section and fills in its defaults.
+func (o *OIDCConfig) validate() error {
+	if o.Issuer == "" || o.Audience == "" {
+		return errors.New("oidc needs an issuer and an audience")
+	}
+	if o.NameClaim == "" {
+		o.NameClaim = "sub"
+	}
+	if o.RolesClaim == "" {
+		o.RolesClaim = "roles"
+	}
+	for name, role := range o.Roles {
+		if err := validScopes(role.Scopes); err != nil {
+			return fmt.Errorf("oidc role %q: %w", name, err)
+		}
+		if len(role.Namespaces) > 0 && slices.Contains(role.Scopes, ScopeAdmin) {
+			return fmt.Errorf("oidc role %q: admin cannot be limited to namespaces", name)
+		}
+	}
+	return nil
+}
+
+// oidcProvider verifies JWTs from one issuer.
+type oidcProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]jwk // by kid
+	fetched  time.Time      // when keys were last fetched (tried)
+	fetching chan struct{}  // closed when the running fetch is done; nil = none
+}
+
+// jwk is one verification key of the issuer.
+type jwk struct {
+	alg string // "" = any the key type allows
+	key crypto.PublicKey
+}
+
+func newOIDCProvider(cfg OIDCConfig) *oidcProvider {
+	return &oidcProvider{cfg: cfg, client: &http.Client{Timeout: jwksTimeout}}
+}
+
+// Authenticate implements Provider. Tokens that are not JWTs are not
+// ours: nil, nil.
+func (o *oidcProvider) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, nil
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad signature encoding", errInvalidJWT)
+	}
+
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return nil, fmt.Errorf("%w: key %s is for %s, not %s", errInvalidJWT, header.Kid, key.alg, header.Alg)
+	}
+	if err := verifyJWS(header.Alg, key.key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: bad claims", errInvalidJWT)
+	}
+	if err := o.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	name, _ := claimAt(claims, o.cfg.NameClaim).(string)
+	if name == "" {
+		return nil, fmt.Errorf("%w: no %s claim", errInvalidJWT, o.cfg.NameClaim)
+	}
+	return o.principal(name, claimAt(claims, o.cfg.RolesClaim)), nil
+}
+
+// checkClaims checks iss, aud, exp and nbf.
+func (o *oidcProvider) checkClaims(claims map[string]any, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != o.cfg.Issuer {
+		return fmt.Errorf("%w: issuer %q is not %q", errInvalidJWT, iss, o.cfg.Issuer)
+	}
+	var aud []string
+	switch v := claims["aud"].(type) {
+	case string:
+		aud = []string{v}
+	case []any:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+	}
+	if !slices.Contains(aud, o.cfg.Audience) {
+		return fmt.Errorf("%w: audience is not %q", errInvalidJWT, o.cfg.Audience)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("%w: no exp claim", errInvalidJWT)
+	}
+	if now.Add(-jwtLeeway).After(time.Unix(int64(exp), 0)) {
+		return fmt.Errorf("%w: expired", errInvalidJWT)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("%w: not valid yet", errInvalidJWT)
+	}
+	return nil
+}
+
+// principal maps the caller's roles to scopes and, for roles limited to
+// namespaces, ACL rules.
+func (o *oidcProvider) principal(name string, rolesClaim any) *Principal {
+	var roles []string
+	switch v := rolesClaim.(type) {
+	case string:
+		roles = strings.Fields(v) // some providers put space-separated scopes here
+	case []any:
+		for _, r := range v {
+			if s, ok := r.(string); ok {
+				roles = append(roles, s)
+			}
+		}
+	}
+
+	p := &Principal{Name: name}
+	access := make(map[string]string) // namespace → ACL access
+	confined := true
+	for _, r := range roles {
+		role, ok := o.cfg.Roles[r]
+		if !ok {
+			continue
+		}
+		for _, s := range role.Scopes {
+			if !slices.Contains(p.Scopes, s) {
+				p.Scopes = append(p.Scopes, s)
+			}
+		}
+		if len(role.Namespaces) == 0 {
+			confined = false
+			continue
+		}
+		a := cluster.ACLRead
+		if slices.Contains(role.Scopes, ScopeWrite) {
+			a = cluster.ACLReadWrite
+		}
+		for _, ns := range role.Namespaces {
+			if access[ns] != cluster.ACLReadWrite {
+				access[ns] = a
+			}
+		}
+	}
+	if confined && len(access) > 0 {
+		for _, ns := range slices.Sorted(maps.Keys(access)) {
+			p.Rules = append(p.Rules, cluster.ACLRule{Prefix: ns + "/", Access: access[ns]})
+		}
+	}
+	return p
+}
+
+// claimAt returns the claim at a dotted path, or nil.
+func claimAt(claims map[string]any, path string) any {
+	var v any = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	return v
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifyJWS checks sig over signed with alg. Only asymmetric algorithms
+// are accepted: with HS256 anyone holding the "key" (our JWKS is public)
+// could sign, and "none" signs nothing.
+func verifyJWS(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var h crypto.Hash
+	if len(alg) == 5 {
+		switch alg[2:] {
+		case "256":
+			h = crypto.SHA256
+		case "384":
+			h = crypto.SHA384
+		case "512":
+			h = crypto.SHA512
+		}
+	}
+	if h == 0 {
+		return fmt.Errorf("%w: unsupported alg %q", errInvalidJWT, alg)
+	}
+	hw := h.New()
+	hw.Write([]byte(signed))
+	digest := hw.Sum(nil)
+
+	var err error
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(pub, h, digest, sig)
+		case "PS":
+			err = rsa.VerifyPSS(pub, h, digest, sig, nil)
+		default:
+			return fmt.Errorf("%w: alg %s on an RSA key", errInvalidJWT, alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" || esCurves[alg] != pub.Curve {
+			return fmt.Errorf("%w: alg %s on an EC %s key", errInvalidJWT, alg, pub.Curve.Params().Name)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("%w: bad signature", errInvalidJWT)
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			err = errors.New("verification failed")
+		}
+	default:
+		return fmt.Errorf("%w: unsupported key type", errInvalidJWT)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: bad signature", errInvalidJWT)
+	}
+	return nil
+}
+
+// esCurves binds each ECDSA alg to its curve (RFC 7518 §3.4).
+var esCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+// key returns the issuer key kid, fetching the key set when it is stale
+// or does not have kid. A token without kid may use the only key.
+//
+// Requests that need a fetch at the same time share one, which runs
+// without o.mu held and outlives the request that started it: a client
+// giving up must not leave everyone without keys until jwksMinRefresh.
+func (o *oidcProvider) key(ctx context.Context, kid string) (jwk, error) {
+	o.mu.Lock()
+	k, ok := o.lookup(kid)
+	since := time.Since(o.fetched)
+	if (!ok && since >= jwksMinRefresh) || since >= jwksRefresh {
+		done := o.refresh(ctx)
+		o.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return jwk{}, ctx.Err()
+		}
+		o.mu.Lock()
+		k, ok = o.lookup(kid)
+	}
+	o.mu.Unlock()
+	if !ok {
+		return jwk{}, fmt.Errorf("%w: unknown signing key %q", errInvalidJWT, kid)
+	}
+	return k, nil
+}
+
+// refresh starts fetching the key set unless a fetch is running, and
+// returns a channel closed when it is done. Caller holds o.mu.
+func (o *oidcProvider) refresh(ctx context.Context) <-chan struct{} {
+	if o.fetching == nil {
+		o.fetching = make(chan struct{})
+		go o.fetch(context.WithoutCancel(ctx), o.fetching)
+	}
+	return o.fetching
+}
+
+// fetch fetches the key set and closes done.
+func (o *oidcProvider) fetch(ctx context.Context, done chan struct{}) {
+	keys, err := o.fetchKeys(ctx)
+	if err != nil {
+		// Keep serving with the keys we have: the issuer being down
+		// must not log everyone out.
+		logging.FromContext(ctx).Warn("fetch OIDC signing keys", "issuer", o.cfg.Issuer, "error", err)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err == nil {
+		o.keys = keys
+	}
+	o.fetched = time.Now()
+	o.fetching = nil
+	close(done)
+}
+
+func (o *oidcProvider) lookup(kid string) (jwk, bool) {
+	if kid == "" && len(o.keys) == 1 {
+		for _, k := range o.keys {
+			return k, true
+		}
+	}
+	k, ok := o.keys[kid]
+	return k, ok
+}
+
+// fetchKeys downloads the issuer's JWKS, discovering its URL if needed.
+func (o *oidcProvider) fetchKeys(ctx context.Context) (map[string]jwk, error) {
+	url := o.cfg.JWKSURL
+	if url == "" {
+		var disc struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := o.getJSON(ctx, strings.TrimSuffix(o.cfg.Issuer, "/")+"/.well-known/openid-configuration", &disc); err != nil {
+			return nil, fmt.Errorf("discovery: %w", err)
+		}
+		if disc.Issuer != o.cfg.Issuer || disc.JWKSURI == "" {
+			return nil, fmt.Errorf("discovery document is for issuer %q", disc.Issuer)
+		}
+		url = disc.JWKSURI
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := o.getJSON(ctx, url, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]jwk)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var pub crypto.PublicKey
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil || len(e) > 4 {
+				continue
+			}
+			pub = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			pub = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		default:
+			continue
+		}
+		keys[k.Kid] = jwk{alg: k.Alg, key: pub}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s has no usable signing keys", url)
+	}
+	return keys, nil
+}
+
+func (o *oidcProvider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
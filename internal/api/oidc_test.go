@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// esSign signs signed with key as a JWS does: r and s, each padded to
+// the curve's size.
+func esSign(t *testing.T, key *ecdsa.PrivateKey, h crypto.Hash, signed string) []byte {
+	t.Helper()
+	hw := h.New()
+	hw.Write([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hw.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+}
+
+func TestVerifyJWSBindsCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const signed = "header.claims"
+	if err := verifyJWS("ES384", &key.PublicKey, signed, esSign(t, key, crypto.SHA384, signed)); err != nil {
+		t.Errorf("ES384 on P-384: %v", err)
+	}
+	if err := verifyJWS("ES256", &key.PublicKey, signed, esSign(t, key, crypto.SHA256, signed)); err == nil {
+		t.Error("ES256 on P-384 accepted")
+	}
+}
+
+func TestOIDCKeyFetchOutlivesCaller(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC", "kid": "k1", "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		w.Write(set)
+	}))
+	defer srv.Close()
+	o := newOIDCProvider(OIDCConfig{Issuer: srv.URL, JWKSURL: srv.URL})
+
+	// The first caller gives up while the issuer is slow.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := o.key(ctx, "k1"); err == nil {
+		t.Fatal("key found before the fetch finished")
+	}
+
+	// The fetch it started goes on, and the callers after it share it.
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() {
+			if _, err := o.key(context.Background(), "k1"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("%d fetches, want 1", n)
+	}
+}
@@ -0,0 +1,502 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── OpenAPI ──────────────────────────────────────────────────────────────────
+//
+//	GET /openapi.json
+//	→ 200, an OpenAPI 3.0 document of the public API
+//
+// The paths come from the router itself (gin's Routes), so a route
+// registered without a description still shows up, with its path
+// parameters. The operations table below adds the summaries, query and
+// header parameters and JSON bodies. ValidateRequests checks requests
+// against the same table (see validate.go), so the document and the
+// server cannot disagree about what a valid request is.
+//
+// The /internal routes are for peers only and are left out.
+
+// operation describes one route: "METHOD /gin/path".
+type operation struct {
+	Summary string
+	Params  []param
+	// Body is the schema of a JSON request body; nil = no JSON body.
+	Body         *schema
+	BodyOptional bool
+	// BodyType is the media type of a non-JSON request body.
+	BodyType string
+	// Status is the success status; 0 = 200.
+	Status int
+	// Response is the schema of a JSON success body; nil = unspecified.
+	Response *schema
+	// Stream is the media type of a streamed success body, instead of
+	// Response.
+	Stream string
+}
+
+// param is a query or header parameter. Path parameters come from the
+// route and are always required strings.
+type param struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // "path", "query" or "header"
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+// ─── Schemas used by several operations ──────────────────────────────────────
+
+var (
+	clockSchema = &schema{
+		Type:                 "object",
+		Description:          "Vector clock: node ID → counter",
+		AdditionalProperties: &schema{Type: "integer", Minimum: ptr[int64](0)},
+	}
+	timeSchema        = &schema{Type: "string", Format: "date-time"}
+	expiresSchema     = &schema{Type: "string", Format: "date-time", Description: "When the value expires; absent = never"}
+	contentTypeSchema = &schema{Type: "string", Description: "Media type of the value, e.g. application/json"}
+	errorSchema       = object(map[string]*schema{
+		"error": {Type: "string"},
+		"field": {Type: "string", Description: "The invalid parameter or body field, for validation errors"},
+	}, "error")
+
+	valueSchema = object(map[string]*schema{
+		"namespace":    {Type: "string"},
+		"key":          {Type: "string"},
+		"value":        {Type: "string"},
+		"content_type": contentTypeSchema,
+		"clock":        clockSchema,
+		"updated_at":   timeSchema,
+		"expires_at":   expiresSchema,
+	}, "namespace", "key", "value", "clock")
+
+	namespaceSchema = object(map[string]*schema{
+		"name":        {Type: "string"},
+		"max_keys":    {Type: "integer", Minimum: ptr[int64](0), Description: "0 = unlimited"},
+		"max_bytes":   {Type: "integer", Minimum: ptr[int64](0), Description: "0 = unlimited"},
+		"rate_limit":  {Type: "number", Minimum: ptr[int64](0), Description: "Requests/sec per coordinating node; 0 = unlimited"},
+		"compression": {Type: "string", Description: `"" = node default, "none", "zstd" or "snappy"`},
+		"replication": {Type: "string", Enum: []string{store.ReplicationSync, store.ReplicationAsync}},
+		"versions":    {Type: "integer", Minimum: ptr[int64](0), Description: "Replaced values kept per key"},
+		"ttl_seconds": {Type: "integer", Minimum: ptr[int64](0), Description: "Keys expire this long after each write; 0 = never"},
+		"read_policy": {Type: "string", Enum: []string{cluster.ReadRing, cluster.ReadNearest, cluster.ReadOne}, Description: "Default: the node's --read-policy"},
+		"tiebreak":    {Type: "string", Enum: []string{store.TiebreakTime, store.TiebreakNodeID}, Description: "Default: the node's --tiebreak"},
+		"delete_conflicts": {Type: "string", Enum: []string{store.DeleteConflictsTiebreak, store.DeleteConflictsDeleteWins, store.DeleteConflictsWriteWins},
+			Description: "Default: the node's --delete-conflicts"},
+		"created_at": timeSchema,
+	}, "name")
+
+	leaseSchema = object(map[string]*schema{
+		"name":    {Type: "string"},
+		"holder":  {Type: "string", Description: "Empty if the lock is free"},
+		"token":   {Type: "integer", Description: "Fencing token of the last acquisition"},
+		"expires": timeSchema,
+	}, "name", "token")
+
+	keyParam = &schema{Type: "string", MinLength: ptr(1)}
+)
+
+// Parameters used by several operations.
+var (
+	namespaceQuery  = param{Name: "namespace", In: "query", Description: "Default: " + store.DefaultNamespace, Schema: &schema{Type: "string"}}
+	prefixQuery     = param{Name: "prefix", In: "query", Description: "Only keys starting with prefix", Schema: &schema{Type: "string"}}
+	timeoutHeader   = param{Name: cluster.RequestTimeoutHeader, In: "header", Description: "Time budget of the request, e.g. 250ms", Schema: &schema{Type: "string"}}
+	idempotencyHdr  = param{Name: IdempotencyHeader, In: "header", Description: "Retries with the same key get the first response", Schema: &schema{Type: "string"}}
+	replicationHdr  = param{Name: ReplicationHeader, In: "header", Description: "Default: the namespace's replication", Schema: &schema{Type: "string", Enum: []string{store.ReplicationSync, store.ReplicationAsync}}}
+	readPolicyHdr   = param{Name: ReadPolicyHeader, In: "header", Description: "Which replicas serve the read", Schema: &schema{Type: "string", Enum: []string{cluster.ReadRing, cluster.ReadNearest, cluster.ReadOne}}}
+	sessionHdr      = param{Name: SessionHeader, In: "header", Description: "Session token from an earlier response, for read-your-writes", Schema: &schema{Type: "string"}}
+	ifMatchHdr      = param{Name: "If-Match", In: "header", Description: `An ETag, or * for "exists"`, Schema: &schema{Type: "string"}}
+	ifNoneMatchHdr  = param{Name: "If-None-Match", In: "header", Description: `An ETag (GET: 304 if unchanged), or * for "absent" (PUT)`, Schema: &schema{Type: "string"}}
+	nodeQuery       = param{Name: "node", In: "query", Description: "Node to ask; default: this one", Schema: &schema{Type: "string"}}
+	hotKeysQuery    = param{Name: "limit", In: "query", Schema: &schema{Type: "integer", Minimum: ptr[int64](1), Maximum: ptr[int64](cluster.MaxHotKeys)}}
+	ttlHdr          = param{Name: TTLHeader, In: "header", Description: "Expire this write after a duration, 0 = never (default: the namespace's ttl_seconds)", Schema: &schema{Type: "string"}}
+	kvWriteHeaders  = []param{timeoutHeader, idempotencyHdr, replicationHdr, ifMatchHdr, ifNoneMatchHdr}
+	kvPutHeaders    = []param{timeoutHeader, idempotencyHdr, replicationHdr, ttlHdr, ifMatchHdr, ifNoneMatchHdr}
+	lockBodySchema  = object(map[string]*schema{"holder": {Type: "string", MinLength: ptr(1)}, "token": {Type: "integer", Minimum: ptr[int64](0)}, "ttl_ms": {Type: "integer", Minimum: ptr[int64](0)}}, "holder")
+	nodeIDBody      = object(map[string]*schema{"id": {Type: "string", MinLength: ptr(1)}}, "id")
+	counterResponse = object(map[string]*schema{"namespace": {Type: "string"}, "key": {Type: "string"}, "value": {Type: "string"}, "count": {Type: "integer"}, "clock": clockSchema})
+)
+
+// operations describes the public routes.
+var operations = map[string]operation{
+	"GET /health":  {Summary: "Liveness probe"},
+	"GET /healthz": {Summary: "Liveness probe"},
+	"GET /readyz":  {Summary: "Readiness probe: 503 until the node can serve its quorum"},
+	"GET /metrics": {Summary: "Prometheus metrics", Stream: "text/plain"},
+
+	"GET /kv": {
+		Summary: "List keys in sorted order, a page at a time",
+		Params: []param{
+			namespaceQuery, prefixQuery,
+			{Name: "cursor", In: "query", Description: "next_cursor of the previous page", Schema: &schema{Type: "string"}},
+			{Name: "limit", In: "query", Description: "Page size (default " + strconv.Itoa(defaultPageSize) + ")", Schema: &schema{Type: "integer", Minimum: ptr[int64](1), Maximum: ptr[int64](maxPageSize)}},
+			{Name: "stream", In: "query", Description: "Send every key from the cursor on as NDJSON", Schema: &schema{Type: "boolean"}},
+			{Name: "contains", In: "query", Description: "Only keys whose value contains this", Schema: &schema{Type: "string"}},
+			{Name: "field", In: "query", Description: "Only keys whose value is JSON with this dotted path", Schema: &schema{Type: "string"}},
+			{Name: "equals", In: "query", Description: "With field: only where it equals this (strings unquoted, others as JSON)", Schema: &schema{Type: "string"}},
+			{Name: "updated_after", In: "query", Description: "Only keys written after this time", Schema: timeSchema},
+			timeoutHeader,
+		},
+		Response: object(map[string]*schema{"namespace": {Type: "string"}, "keys": arrayOf(&schema{Type: "string"}), "next_cursor": {Type: "string"}}, "namespace", "keys"),
+	},
+	"GET /kv/:namespace": {
+		Summary:  "List every live key of a namespace",
+		Params:   []param{timeoutHeader},
+		Response: object(map[string]*schema{"namespace": {Type: "string"}, "keys": arrayOf(&schema{Type: "string"})}, "namespace", "keys"),
+	},
+	"GET /kv/:namespace/:key": {
+		Summary: "Read a key with the read quorum",
+		Params: []param{
+			{Name: "clock", In: "query", Description: "Read this older version (see GET .../versions)", Schema: &schema{Type: "string"}},
+			timeoutHeader, readPolicyHdr, sessionHdr, ifNoneMatchHdr,
+		},
+		Response: valueSchema,
+	},
+	"GET /kv/:namespace/:key/meta":     {Summary: "Every replica's copy of a key, for debugging", Params: []param{timeoutHeader, readPolicyHdr}},
+	"GET /kv/:namespace/:key/versions": {Summary: "The versions a key keeps (see the namespace's versions)", Params: []param{timeoutHeader}},
+	"GET /kv/:namespace/:key/raw": {
+		Summary: "Read a key's value as the response body, with its content type",
+		Params:  []param{timeoutHeader, readPolicyHdr, sessionHdr, ifNoneMatchHdr},
+		Stream:  "application/octet-stream",
+	},
+	"PUT /kv/:namespace/:key/raw": {
+		Summary:  "Write the request body as the value, streamed; its Content-Type is stored with it",
+		Params:   kvPutHeaders,
+		BodyType: "application/octet-stream",
+		Response: object(map[string]*schema{
+			"namespace":    {Type: "string"},
+			"key":          {Type: "string"},
+			"size":         {Type: "integer", Description: "Bytes written"},
+			"content_type": contentTypeSchema,
+			"clock":        clockSchema,
+			"expires_at":   expiresSchema,
+			"replication":  {Type: "string", Description: `"async" if the write was queued`},
+		}, "namespace", "key", "size", "clock"),
+	},
+	"PUT /kv/:namespace/:key": {
+		Summary: "Write a key and wait for the write quorum",
+		Params:  kvPutHeaders,
+		Body: object(map[string]*schema{
+			"value":        {Type: "string", MinLength: ptr(1)},
+			"content_type": contentTypeSchema,
+		}, "value"),
+		Response: object(map[string]*schema{
+			"namespace":    {Type: "string"},
+			"key":          {Type: "string"},
+			"value":        {Type: "string"},
+			"content_type": contentTypeSchema,
+			"clock":        clockSchema,
+			"expires_at":   expiresSchema,
+			"replication":  {Type: "string", Description: `"async" if the write was queued`},
+		}, "namespace", "key", "value", "clock"),
+	},
+	"DELETE /kv/:namespace/:key": {
+		Summary:  "Delete a key (a tombstone, replicated like a write)",
+		Params:   kvWriteHeaders,
+		Response: object(map[string]*schema{"deleted": {Type: "string"}}, "deleted"),
+	},
+	"POST /kv/:namespace/:key/incr": {
+		Summary:      "Add to a counter",
+		Params:       []param{timeoutHeader, idempotencyHdr},
+		Body:         object(map[string]*schema{"by": {Type: "integer", Minimum: ptr[int64](1), Description: "Default 1"}}),
+		BodyOptional: true,
+		Response:     counterResponse,
+	},
+	"POST /kv/:namespace/:key/decr": {
+		Summary:      "Subtract from a counter",
+		Params:       []param{timeoutHeader, idempotencyHdr},
+		Body:         object(map[string]*schema{"by": {Type: "integer", Minimum: ptr[int64](1), Description: "Default 1"}}),
+		BodyOptional: true,
+		Response:     counterResponse,
+	},
+	"POST /kv/:namespace/:key/undelete": {
+		Summary: "Restore the newest version from before a delete",
+		Params:  []param{timeoutHeader, idempotencyHdr},
+	},
+
+	"GET /watch/:namespace": {
+		Summary: "Stream the changes to a namespace as NDJSON",
+		Params: []param{
+			prefixQuery,
+			{Name: "replicas", In: "query", Description: "all = every replica's copy of each write", Schema: &schema{Type: "string", Enum: []string{"all"}}},
+		},
+		Stream: "application/x-ndjson",
+	},
+	"GET /cdc": {
+		Summary: "Stream this node's changes by change number as NDJSON",
+		Params: []param{
+			{Name: "from", In: "query", Description: "First change to send; default: the oldest retained", Schema: &schema{Type: "integer", Minimum: ptr[int64](0)}},
+			{Name: "namespace", In: "query", Description: "Only this namespace", Schema: &schema{Type: "string"}},
+		},
+		Stream: "application/x-ndjson",
+	},
+
+	"POST /txn": {
+		Summary: "Commit writes if every check holds, atomically",
+		Params:  []param{timeoutHeader, idempotencyHdr},
+		Body: object(map[string]*schema{
+			"namespace": {Type: "string"},
+			"checks": arrayOf(object(map[string]*schema{
+				"key":    {Type: "string"},
+				"exists": {Type: "boolean"},
+				"value":  {Type: "string"},
+				"clock":  clockSchema,
+			}, "key")),
+			"ops": {Type: "array", MinItems: ptr(1), Items: object(map[string]*schema{
+				"op":    {Type: "string", Enum: []string{"put", "delete"}},
+				"key":   {Type: "string"},
+				"value": {Type: "string"},
+			}, "op", "key")},
+		}, "ops"),
+		Response: object(map[string]*schema{
+			"namespace": {Type: "string"},
+			"committed": {Type: "boolean"},
+			"clocks":    {Type: "object", AdditionalProperties: clockSchema},
+		}, "namespace", "committed"),
+	},
+	"POST /kv/mget": {
+		Summary: "Read many keys with parallel quorum reads",
+		Params:  []param{timeoutHeader, readPolicyHdr},
+		Body: object(map[string]*schema{
+			"namespace": {Type: "string", Description: "Default: " + store.DefaultNamespace},
+			"keys":      {Type: "array", MinItems: ptr(1), MaxItems: ptr(MaxBatchOps), Items: &schema{Type: "string"}},
+		}, "keys"),
+		Response: object(map[string]*schema{
+			"results": arrayOf(object(map[string]*schema{
+				"key":          {Type: "string"},
+				"status":       {Type: "integer"},
+				"error":        {Type: "string"},
+				"value":        {Type: "string"},
+				"clock":        clockSchema,
+				"updated_at":   timeSchema,
+				"content_type": contentTypeSchema,
+			}, "key", "status")),
+		}, "results"),
+	},
+	"POST /batch": {
+		Summary: "Run independent gets, puts and deletes in one request",
+		Params:  []param{timeoutHeader, idempotencyHdr, replicationHdr},
+		Body: object(map[string]*schema{
+			"ops": {Type: "array", MinItems: ptr(1), MaxItems: ptr(MaxBatchOps), Items: object(map[string]*schema{
+				"op":           {Type: "string", Enum: []string{"get", "put", "delete"}},
+				"namespace":    {Type: "string"},
+				"key":          {Type: "string"},
+				"value":        {Type: "string"},
+				"content_type": contentTypeSchema,
+			}, "op", "key")},
+		}, "ops"),
+		Response: object(map[string]*schema{
+			"results": arrayOf(object(map[string]*schema{
+				"status":       {Type: "integer"},
+				"error":        {Type: "string"},
+				"value":        {Type: "string"},
+				"clock":        clockSchema,
+				"updated_at":   timeSchema,
+				"content_type": contentTypeSchema,
+				"replication":  {Type: "string"},
+			}, "status")),
+		}, "results"),
+	},
+
+	"GET /locks/:name":           {Summary: "Read a lock's lease", Params: []param{timeoutHeader}, Response: leaseSchema},
+	"POST /locks/:name/acquire":  {Summary: "Acquire a lock lease", Params: []param{timeoutHeader}, Body: lockBodySchema, Response: leaseSchema},
+	"POST /locks/:name/renew":    {Summary: "Extend a lock lease", Params: []param{timeoutHeader}, Body: lockBodySchema, Response: leaseSchema},
+	"POST /locks/:name/release":  {Summary: "Release a lock lease", Params: []param{timeoutHeader}, Body: lockBodySchema, Response: leaseSchema},
+	"GET /namespaces":            {Summary: "List namespaces, with this node's usage", Response: object(map[string]*schema{"namespaces": arrayOf(namespaceSchema)}, "namespaces")},
+	"GET /namespaces/:namespace": {Summary: "Read a namespace's settings", Response: namespaceSchema},
+	"PUT /namespaces/:namespace": {
+		Summary: "Create or update a namespace on every node",
+		Body: object(map[string]*schema{
+			"max_keys":         namespaceSchema.Properties["max_keys"],
+			"max_bytes":        namespaceSchema.Properties["max_bytes"],
+			"rate_limit":       namespaceSchema.Properties["rate_limit"],
+			"compression":      namespaceSchema.Properties["compression"],
+			"replication":      namespaceSchema.Properties["replication"],
+			"versions":         namespaceSchema.Properties["versions"],
+			"ttl_seconds":      namespaceSchema.Properties["ttl_seconds"],
+			"read_policy":      namespaceSchema.Properties["read_policy"],
+			"tiebreak":         namespaceSchema.Properties["tiebreak"],
+			"delete_conflicts": namespaceSchema.Properties["delete_conflicts"],
+		}),
+		BodyOptional: true,
+		Response:     object(map[string]*schema{"namespace": namespaceSchema, "warning": {Type: "string"}}, "namespace"),
+	},
+	"DELETE /namespaces/:namespace": {Summary: "Delete an empty namespace on every node", Response: object(map[string]*schema{"deleted": {Type: "string"}, "warning": {Type: "string"}}, "deleted")},
+
+	"POST /cluster/join": {
+		Summary: "Add a node to the cluster",
+		Body: object(map[string]*schema{
+			"id":      {Type: "string", MinLength: ptr(1)},
+			"address": {Type: "string", Description: "host:port"},
+			"weight":  {Type: "integer", Minimum: ptr[int64](0)},
+			"zone":    {Type: "string"},
+		}, "id", "address"),
+	},
+	"POST /cluster/leave":                   {Summary: "Remove a node from the cluster", Body: nodeIDBody},
+	"POST /cluster/decommission":            {Summary: "Drain a node's data to the others", Body: nodeIDBody, Status: http.StatusAccepted},
+	"GET /cluster/decommission/:id":         {Summary: "Progress of a decommission"},
+	"GET /cluster/nodes":                    {Summary: "List the members"},
+	"GET /cluster/status":                   {Summary: "The ring and quorum, for clients that route to owners"},
+	"GET /admin/backup":                     {Summary: "Download a backup archive", Params: []param{{Name: "scope", In: "query", Description: "Default: node", Schema: &schema{Type: "string", Enum: []string{"node", "cluster"}}}}, Stream: "application/x-kvbak"},
+	"POST /admin/restore":                   {Summary: "Restore a backup archive", Params: []param{{Name: "map", In: "query", Description: "old=new node IDs, comma-separated, to rename in the clocks", Schema: &schema{Type: "string"}}}, BodyType: "application/x-kvbak"},
+	"GET /admin/shards":                     {Summary: "Ring ranges and their replicas"},
+	"GET /admin/locate/:key":                {Summary: "Which replicas own a key, and what each holds", Params: []param{namespaceQuery}},
+	"POST /admin/repair":                    {Summary: "Start an anti-entropy repair", Params: []param{nodeQuery}, Status: http.StatusAccepted},
+	"GET /admin/repair":                     {Summary: "Progress of the last repair", Params: []param{nodeQuery}},
+	"POST /admin/repair/:key":               {Summary: "Repair one key now", Params: []param{namespaceQuery}},
+	"GET /admin/replication":                {Summary: "Replication health: hints, outbox, lag"},
+	"GET /admin/stats":                      {Summary: "Storage statistics of every node"},
+	"GET /admin/hotkeys":                    {Summary: "The cluster's hottest keys", Params: []param{hotKeysQuery}},
+	"GET /admin/quorum":                     {Summary: "The current N, W and R"},
+	"PUT /admin/quorum":                     {Summary: "Change N, W and R on every node", Body: object(map[string]*schema{"n": {Type: "integer", Minimum: ptr[int64](1)}, "w": {Type: "integer", Minimum: ptr[int64](1)}, "r": {Type: "integer", Minimum: ptr[int64](1)}}, "n", "w", "r")},
+	"POST /admin/cluster-snapshot":          {Summary: "Start a snapshot of every node at about the same cut", Status: http.StatusAccepted},
+	"GET /admin/cluster-snapshot":           {Summary: "List the cluster snapshots"},
+	"GET /admin/cluster-snapshot/:id":       {Summary: "A cluster snapshot's manifest"},
+	"GET /admin/cluster-snapshot/:id/:node": {Summary: "Download one node's part of a cluster snapshot", Stream: "application/x-kvbak"},
+	"DELETE /admin/cluster-snapshot/:id":    {Summary: "Delete a cluster snapshot on every node"},
+	"POST /admin/reload":                    {Summary: "Re-read the node's --config file, as on SIGHUP"},
+	"GET /openapi.json":                     {Summary: "This document"},
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func object(props map[string]*schema, required ...string) *schema {
+	return &schema{Type: "object", Properties: props, Required: required}
+}
+
+func arrayOf(items *schema) *schema { return &schema{Type: "array", Items: items} }
+
+// OpenAPI handles GET /openapi.json
+func (h *Handler) OpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", h.openapi)
+}
+
+// buildOpenAPI renders the document for the routes of a router.
+func buildOpenAPI(routes gin.RoutesInfo) []byte {
+	paths := make(map[string]map[string]any)
+	taken := make(map[string]bool)
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Path+" "+routes[i].Method < routes[j].Path+" "+routes[j].Method
+	})
+	for _, rt := range routes {
+		if strings.HasPrefix(rt.Path, "/internal/") {
+			continue
+		}
+		path, pathParams := openAPIPath(rt.Path)
+		op := operations[rt.Method+" "+rt.Path]
+
+		params := append(pathParams, op.Params...)
+		doc := map[string]any{
+			"operationId": operationID(rt, taken),
+			"tags":        []string{routeTag(rt.Path)},
+			"responses":   responses(op),
+		}
+		if op.Summary != "" {
+			doc["summary"] = op.Summary
+		}
+		if len(params) > 0 {
+			doc["parameters"] = params
+		}
+		switch {
+		case op.Body != nil:
+			doc["requestBody"] = map[string]any{
+				"required": !op.BodyOptional,
+				"content":  map[string]any{"application/json": map[string]any{"schema": op.Body}},
+			}
+		case op.BodyType != "":
+			doc["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{op.BodyType: map[string]any{"schema": &schema{Type: "string", Format: "binary"}}},
+			}
+		}
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(rt.Method)] = doc
+	}
+
+	data, err := json.Marshal(map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "distributed-kvstore",
+			"version":     "1",
+			"description": "Public HTTP API of a node. Keys are routed to their owners by any node.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas":         map[string]any{"Error": errorSchema},
+			"securitySchemes": map[string]any{"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"}},
+		},
+		// Tokens are optional: a node without --auth-file accepts anyone.
+		"security": []map[string][]string{{}, {"bearerAuth": {}}},
+	})
+	if err != nil {
+		panic(err) // only static data above
+	}
+	return data
+}
+
+// openAPIPath turns /kv/:namespace/:key into /kv/{namespace}/{key} and
+// its path parameters.
+func openAPIPath(p string) (string, []param) {
+	var params []param
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		if s != "" && (s[0] == ':' || s[0] == '*') {
+			params = append(params, param{Name: s[1:], In: "path", Required: true, Schema: keyParam})
+			segs[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/"), params
+}
+
+// operationID names an operation after its handler (Handler.Put → Put),
+// with the path added when two routes share a handler.
+func operationID(rt gin.RouteInfo, taken map[string]bool) string {
+	name := strings.TrimSuffix(rt.Handler, "-fm")
+	name = name[strings.LastIndexByte(name, '.')+1:]
+	if taken[name] {
+		name += strings.NewReplacer("/", "_", ":", "", ".", "_").Replace(rt.Path)
+	}
+	taken[name] = true
+	return name
+}
+
+// routeTag groups operations by their first path segment.
+func routeTag(p string) string {
+	tag, _, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	return strings.TrimSuffix(tag, ".json")
+}
+
+func responses(op operation) map[string]any {
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case op.Stream != "":
+		ok["content"] = map[string]any{op.Stream: map[string]any{"schema": &schema{Type: "string"}}}
+	case op.Response != nil:
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": op.Response}}
+	default:
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": &schema{Type: "object"}}}
+	}
+	return map[string]any{
+		strconv.Itoa(status): ok,
+		"default": map[string]any{
+			"description": "Error",
+			"content":     map[string]any{"application/json": map[string]any{"schema": map[string]string{"$ref": "#/components/schemas/Error"}}},
+		},
+	}
+}
@@ -0,0 +1,323 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limiting
+//
+// One noisy client should not be able to starve everyone else.
+// Each client gets token buckets that refill at a fixed rate:
+//
+//   - per IP    (c.ClientIP())
+//   - per token (the authenticated principal; only with auth enabled)
+//
+// and each of those has a requests/sec and a bytes/sec bucket.
+// A request must pass every configured bucket, or it gets 429 with
+// Retry-After telling the client when to come back.
+//
+// Bytes (request body read + response body written) are only known
+// once the request is done, so they are charged afterwards and may push
+// a bucket into debt; the next request waits until the debt is repaid.
+// That way a single large request is never rejected outright, it just
+// costs its share of time.
+//
+// Peer traffic (/internal/*, forwarded requests, anything sent with the
+// cluster token) is never limited: throttling replication would only
+// fail quorums. Neither are the health probes, polled by load balancers.
+
+// RateLimitConfig sets the limits. A zero rate disables that bucket.
+type RateLimitConfig struct {
+	IPRequests    float64       // requests/sec per client IP
+	IPBytes       float64       // bytes/sec per client IP
+	TokenRequests float64       // requests/sec per API token
+	TokenBytes    float64       // bytes/sec per API token
+	Burst         time.Duration // bucket size, as time at the full rate (default 1s)
+}
+
+// enabled reports whether any bucket is configured.
+func (cfg RateLimitConfig) enabled() bool {
+	return cfg.IPRequests > 0 || cfg.IPBytes > 0 || cfg.TokenRequests > 0 || cfg.TokenBytes > 0
+}
+
+// bucket is a token bucket. tokens may go negative (debt) for byte buckets.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter holds one kind of bucket (e.g. "bytes per IP") for every client.
+type limiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens/sec
+	burst     float64 // bucket capacity
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newLimiter(rate float64, burst time.Duration) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{
+		rate:    rate,
+		burst:   math.Max(rate*burst.Seconds(), 1),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// refill returns the bucket for key, topped up to now. Caller holds l.mu.
+func (l *limiter) refill(key string, now time.Time) *bucket {
+	if now.Sub(l.lastSweep) > time.Minute {
+		// A bucket idle long enough to be full again carries no state.
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	return b
+}
+
+// take removes n tokens if the bucket holds at least need.
+// Otherwise it returns how long until it will.
+func (l *limiter) take(key string, need, n float64) (ok bool, wait time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key, time.Now())
+	if b.tokens < need {
+		return false, time.Duration((need - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens -= n
+	return true, 0
+}
+
+// charge removes n tokens unconditionally (may go into debt).
+func (l *limiter) charge(key string, n float64) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(key, time.Now()).tokens -= n
+}
+
+// countingReader counts the request body bytes actually read.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// exemptFromRateLimit reports whether the request is peer traffic.
+//
+// A forwarded request was already limited on the node that received it.
+// With auth enabled it carries the cluster token; without auth, the
+// forwarded header is all we have (and /internal/* is open anyway).
+func exemptFromRateLimit(c *gin.Context, p *Principal) bool {
+	switch {
+	case strings.HasPrefix(c.Request.URL.Path, "/internal/"), isProbePath(c.Request.URL.Path):
+		return true
+	case p != nil:
+		return p.Cluster
+	default:
+		return c.GetHeader(cluster.ForwardedHeader) != ""
+	}
+}
+
+// RateLimiter enforces a RateLimitConfig that can be replaced at runtime.
+type RateLimiter struct {
+	state atomic.Pointer[rateState]
+}
+
+// rateState is one config with its buckets.
+type rateState struct {
+	cfg                                    RateLimitConfig
+	ipReqs, ipBytes, tokenReqs, tokenBytes *limiter
+}
+
+// NewRateLimiter creates a RateLimiter enforcing cfg.
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{}
+	rl.SetConfig(cfg)
+	return rl
+}
+
+// SetConfig replaces the limits. Every bucket starts full again.
+func (rl *RateLimiter) SetConfig(cfg RateLimitConfig) {
+	if cfg.Burst <= 0 {
+		cfg.Burst = time.Second
+	}
+	rl.state.Store(&rateState{
+		cfg:        cfg,
+		ipReqs:     newLimiter(cfg.IPRequests, cfg.Burst),
+		ipBytes:    newLimiter(cfg.IPBytes, cfg.Burst),
+		tokenReqs:  newLimiter(cfg.TokenRequests, cfg.Burst),
+		tokenBytes: newLimiter(cfg.TokenBytes, cfg.Burst),
+	})
+}
+
+// Config returns the limits in force.
+func (rl *RateLimiter) Config() RateLimitConfig {
+	return rl.state.Load().cfg
+}
+
+// RateLimit returns the middleware for a fixed cfg.
+func RateLimit(cfg RateLimitConfig) gin.HandlerFunc {
+	return NewRateLimiter(cfg).Middleware()
+}
+
+// Middleware returns the rate limiting middleware.
+//
+// Register AFTER Auth (it needs the principal for per-token limits).
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		st := rl.state.Load()
+		if !st.cfg.enabled() {
+			c.Next()
+			return
+		}
+		ipReqs, ipBytes, tokenReqs, tokenBytes := st.ipReqs, st.ipBytes, st.tokenReqs, st.tokenBytes
+
+		p := CurrentPrincipal(c)
+		if exemptFromRateLimit(c, p) {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		token, tReqs, tBytes := "", tokenReqs, tokenBytes
+		if p != nil {
+			token = p.Name
+		} else {
+			tReqs, tBytes = nil, nil // auth disabled: per-IP only
+		}
+
+		// Byte buckets only need to be out of debt; request buckets
+		// need one whole token.
+		checks := []struct {
+			l       *limiter
+			key     string
+			need, n float64
+		}{
+			{ipBytes, ip, 0, 0},
+			{tBytes, token, 0, 0},
+			{ipReqs, ip, 1, 1},
+			{tReqs, token, 1, 1},
+		}
+		for _, chk := range checks {
+			if ok, wait := chk.l.take(chk.key, chk.need, chk.n); !ok {
+				retry := max(1, int(math.Ceil(wait.Seconds())))
+				c.Header("Retry-After", strconv.Itoa(retry))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+				return
+			}
+		}
+
+		var body *countingReader
+		if c.Request.Body != nil && (ipBytes != nil || tBytes != nil) {
+			body = &countingReader{ReadCloser: c.Request.Body}
+			c.Request.Body = body
+		}
+
+		c.Next()
+
+		size := float64(max(c.Writer.Size(), 0))
+		if body != nil {
+			size += float64(body.n)
+		}
+		ipBytes.charge(ip, size)
+		tBytes.charge(token, size)
+	}
+}
+
+// Per-namespace limits
+//
+// A namespace's rate_limit (store.Namespace.RateLimit) caps the requests
+// per second this node coordinates for it: one bucket per namespace,
+// shared by every client. /kv requests and transactions take one token;
+// a batch takes one per op, and ops over the limit fail on their own.
+// Forwarded requests were charged by the node that received them.
+
+// namespaceRates holds the bucket of each rate-limited namespace.
+type namespaceRates struct {
+	mu       sync.Mutex
+	limiters map[string]*limiter // rebuilt when the namespace's rate changes
+}
+
+// take takes one token from ns's bucket at rate.
+func (r *namespaceRates) take(ns string, rate float64) (bool, time.Duration) {
+	r.mu.Lock()
+	l, ok := r.limiters[ns]
+	if !ok || l.rate != rate {
+		if r.limiters == nil {
+			r.limiters = make(map[string]*limiter)
+		}
+		l = newLimiter(rate, time.Second)
+		r.limiters[ns] = l
+	}
+	r.mu.Unlock()
+	return l.take("", 1, 1)
+}
+
+// allowNamespace charges one request to ns, reporting how long to wait
+// if its rate limit is used up.
+func (h *Handler) allowNamespace(c *gin.Context, ns string) (bool, time.Duration) {
+	info, ok := h.store.GetNamespace(ns)
+	if !ok || info.RateLimit <= 0 || exemptFromRateLimit(c, CurrentPrincipal(c)) {
+		return true, 0
+	}
+	return h.nsRates.take(ns, info.RateLimit)
+}
+
+// errNamespaceRate is the error of a request over its namespace's rate.
+var errNamespaceRate = errors.New("namespace rate limit exceeded")
+
+// abortNamespaceRate answers 429 with Retry-After.
+func abortNamespaceRate(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(max(1, int(math.Ceil(wait.Seconds())))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": errNamespaceRate.Error()})
+}
+
+// namespaceRate enforces the rate limit of the :namespace in the path.
+func (h *Handler) namespaceRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ns := c.Param("namespace"); ns != "" {
+			if ok, wait := h.allowNamespace(c, ns); !ok {
+				abortNamespaceRate(c, wait)
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"distributed-kvstore/internal/store"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Raw values ───────────────────────────────────────────────────────────────
+//
+//	PUT /kv/:namespace/:key/raw   body: the value itself, any Content-Type
+//	GET /kv/:namespace/:key/raw   → the value itself, with its Content-Type
+//
+// A JSON PUT of a large value is held in memory two or three times over:
+// the escaped body (buffered whole for validation), then the decoded
+// string. A raw PUT is read once, straight into the value, as it arrives
+// — Content-Length or Transfer-Encoding: chunked — and stops at
+// --max-value-size with 413 instead of reading the rest. The request's
+// Content-Type is stored with the value.
+//
+// The value is still whole in memory before it is written: the store
+// keeps values whole. What streaming saves is the copies, and reading an
+// oversized upload at all.
+
+// PutRaw handles PUT /kv/:namespace/:key/raw
+// Takes the same headers as Put. The response has the value's size
+// instead of echoing it.
+func (h *Handler) PutRaw(c *gin.Context) {
+	w, ok := h.startPut(c)
+	if !ok {
+		return
+	}
+	contentType := c.GetHeader("Content-Type")
+	if err := checkContentType(contentType); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	value, err := readValue(c.Request, h.store.Limits().MaxValueSize)
+	switch {
+	case errors.Is(err, store.ErrValueTooLarge):
+		writeError(c, err)
+		return
+	case err != nil:
+		bodyError(c, err)
+		return
+	case value == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty body: the value is required"})
+		return
+	}
+	h.finishPut(c, w, value, contentType, false)
+}
+
+// readValue reads the body of r into a value of at most limit bytes
+// (0 = no limit). A Content-Length over the limit fails before reading;
+// a chunked body fails as soon as it passes it.
+func readValue(r *http.Request, limit int) (string, error) {
+	if r.Body == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	if n := r.ContentLength; n > 0 {
+		if limit > 0 && n > int64(limit) {
+			return "", fmt.Errorf("%w: %d bytes, limit is %d", store.ErrValueTooLarge, n, limit)
+		}
+		b.Grow(int(n))
+	}
+	body := io.Reader(r.Body)
+	if limit > 0 {
+		body = io.LimitReader(r.Body, int64(limit)+1)
+	}
+	if _, err := io.Copy(&b, body); err != nil {
+		return "", err
+	}
+	if limit > 0 && b.Len() > limit {
+		return "", fmt.Errorf("%w: more than the limit of %d bytes", store.ErrValueTooLarge, limit)
+	}
+	return b.String(), nil
+}
+
+// GetRaw handles GET /kv/:namespace/:key/raw
+// The value is the body: Content-Type is the stored one (default
+// application/octet-stream), ETag the clock, Last-Modified its time.
+func (h *Handler) GetRaw(c *gin.Context) {
+	key, ok := storeKey(c)
+	if !ok {
+		return
+	}
+	val, ok := h.readKey(c, key)
+	if !ok {
+		return
+	}
+	contentType := val.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Length", strconv.Itoa(len(val.Data)))
+	if !val.UpdatedAt.IsZero() {
+		c.Header("Last-Modified", val.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+	io.WriteString(c.Writer, val.Data)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reads use the node's --read-policy unless the request picks one
+// (see cluster/nearest.go):
+//
+//	X-Read-Policy: nearest
+//	X-Read-Policy: one        a single replica: this node's copy if it has one
+//
+// Like X-Replication, the header survives forwarding.
+
+// ReadPolicyHeader selects the read routing of one read.
+const ReadPolicyHeader = "X-Read-Policy"
+
+// readContext returns the request context carrying the read policy of c.
+// On an invalid header it writes a 400 and returns ok == false.
+func readContext(c *gin.Context) (ctx context.Context, ok bool) {
+	p := c.GetHeader(ReadPolicyHeader)
+	if !cluster.ValidReadPolicy(p) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": ReadPolicyHeader + " must be " + cluster.ReadPolicies,
+		})
+		return nil, false
+	}
+	ctx = c.Request.Context()
+	if p != "" {
+		ctx = cluster.WithReadPolicy(ctx, p)
+	}
+	return ctx, true
+}
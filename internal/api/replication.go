@@ -0,0 +1,38 @@
+package api
+
+import (
+	"distributed-kvstore/internal/store"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Writes are sync (wait for W replicas) unless the request or its
+// namespace asks for async (ack after the local write, replicate in the
+// background — see cluster/outbox.go):
+//
+//	X-Replication: async          per request, wins
+//	{"replication": "async"}      namespace default
+//
+// The header survives forwarding, so the owner that coordinates the write
+// sees the same choice.
+
+// ReplicationHeader selects the replication mode of one write.
+const ReplicationHeader = "X-Replication"
+
+// asyncWrite reports whether the write in c should replicate async.
+// On an invalid header it writes a 400 and returns ok == false.
+func (h *Handler) asyncWrite(c *gin.Context) (async, ok bool) {
+	mode := c.GetHeader(ReplicationHeader)
+	if !store.ValidReplication(mode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": ReplicationHeader + " must be " + store.ReplicationSync + " or " + store.ReplicationAsync,
+		})
+		return false, false
+	}
+	if mode == "" {
+		ns, _ := h.store.GetNamespace(c.Param("namespace"))
+		mode = ns.Replication
+	}
+	return mode == store.ReplicationAsync, true
+}
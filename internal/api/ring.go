@@ -0,0 +1,39 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Peers send their ring view on every request (see cluster/epoch.go).
+// observeRing lets a newer view catch this node up; rejectStale refuses
+// work that an older view routed to the wrong node.
+
+// observeRing checks the ring view of peer requests. It also notes the
+// peer's protocol and answers with ours (see cluster/protocol.go).
+func (h *Handler) observeRing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		peer := c.GetHeader(cluster.PeerHeader)
+		if v, ok := cluster.ParseRingView(c.GetHeader(cluster.RingHeader)); ok {
+			h.replicator.ObserveRing(c.Request.Context(), peer, v)
+		}
+		h.replicator.ObserveVersion(c.Request.Context(), peer, c.Request.Header)
+		h.replicator.SetProtocolHeaders(c.Writer.Header())
+		c.Next()
+	}
+}
+
+// rejectStale answers 409 with our ring view if the peer routed a request
+// for key with an older ring and, on ours, we do not own key.
+// Returns true if the request was rejected.
+func (h *Handler) rejectStale(c *gin.Context, key string) bool {
+	if !h.replicator.Stale(c.GetHeader(cluster.RingHeader)) || h.replicator.IsOwner(key) {
+		return false
+	}
+	view := h.membership.View()
+	c.Header(cluster.RingHeader, view.String())
+	c.JSON(http.StatusConflict, gin.H{"error": cluster.ErrStaleRing.Error(), "ring": view})
+	return true
+}
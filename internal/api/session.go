@@ -0,0 +1,64 @@
+package api
+
+import (
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Session tokens give one client read-your-writes and monotonic reads
+// (see cluster/session.go):
+//
+//	PUT /kv/ns/k            → X-Session: <token of the write>
+//	GET /kv/ns/k            → X-Session: <token of the value read>
+//	GET /kv/ns/k + X-Session: <token>  → that version or newer, else 503
+//
+// A token is opaque to clients: base64url of the key's vector clock and
+// timestamp. It belongs to one key; a token from another key is
+// accepted but meaningless. Writes (PUT, DELETE, incr/decr) and reads
+// that found the key answer with a token; clients keep the latest per
+// key. Forwarded requests carry the header both ways.
+
+// SessionHeader carries a session token.
+const SessionHeader = "X-Session"
+
+// encodeSession returns the token for s.
+func encodeSession(s cluster.Session) string {
+	data, _ := json.Marshal(s)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSession parses a token.
+func decodeSession(token string) (cluster.Session, error) {
+	var s cluster.Session
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(data, &s)
+}
+
+// sessionContext adds the session token of c, if any, to ctx.
+// On an invalid token it writes a 400 and returns ok == false.
+func sessionContext(c *gin.Context, ctx context.Context) (context.Context, bool) {
+	token := c.GetHeader(SessionHeader)
+	if token == "" {
+		return ctx, true
+	}
+	s, err := decodeSession(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + SessionHeader + " token"})
+		return nil, false
+	}
+	return cluster.WithSession(ctx, s), true
+}
+
+// setSession answers with the token of v.
+func setSession(c *gin.Context, v store.Value) {
+	c.Header(SessionHeader, encodeSession(cluster.SessionOf(v)))
+}
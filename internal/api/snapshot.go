@@ -0,0 +1,163 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Cluster snapshots ────────────────────────────────────────────────────────
+//
+//	POST   /admin/cluster-snapshot           → 202, the snapshot, running
+//	GET    /admin/cluster-snapshot           → every snapshot this node knows
+//	GET    /admin/cluster-snapshot/:id       → its manifest, once done
+//	GET    /admin/cluster-snapshot/:id/:node → that node's .kvbak part
+//	DELETE /admin/cluster-snapshot/:id       → delete it on every node
+//
+// See cluster/snapshot.go. Every node keeps its own part and a copy of
+// the manifest, so any node can serve both; a part is streamed from its
+// node if asked elsewhere.
+
+func snapshotError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, cluster.ErrSnapshotsDisabled):
+		status = http.StatusNotImplemented
+	case errors.Is(err, cluster.ErrSnapshotNotFound), errors.Is(err, cluster.ErrUnknownNode):
+		status = http.StatusNotFound
+	case errors.Is(err, cluster.ErrSnapshotRunning):
+		status = http.StatusConflict
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// StartClusterSnapshot handles POST /admin/cluster-snapshot
+func (h *Handler) StartClusterSnapshot(c *gin.Context) {
+	m, err := h.replicator.StartClusterSnapshot(c.Request.Context())
+	if err != nil {
+		snapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, m)
+}
+
+// ListClusterSnapshots handles GET /admin/cluster-snapshot
+func (h *Handler) ListClusterSnapshots(c *gin.Context) {
+	list, err := h.replicator.Snapshots()
+	if err != nil {
+		snapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"snapshots": list})
+}
+
+// ClusterSnapshot handles GET /admin/cluster-snapshot/:id
+func (h *Handler) ClusterSnapshot(c *gin.Context) {
+	m, err := h.replicator.SnapshotStatus(c.Param("id"))
+	if err != nil {
+		snapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// ClusterSnapshotPart handles GET /admin/cluster-snapshot/:id/:node
+func (h *Handler) ClusterSnapshotPart(c *gin.Context) {
+	h.streamSnapshotPart(c, c.Param("node"))
+}
+
+// DeleteClusterSnapshot handles DELETE /admin/cluster-snapshot/:id
+// Deletes it here, then on every other node; nodes that could not be
+// reached are reported as a warning.
+func (h *Handler) DeleteClusterSnapshot(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.replicator.RemoveSnapshot(id); err != nil {
+		snapshotError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	resp := gin.H{"deleted": id}
+	if err := h.replicator.Broadcast(ctx, http.MethodDelete, "/internal/cluster-snapshot/"+id, nil); err != nil {
+		CurrentLogger(c).Warn("cluster snapshot deletion incomplete", "id", id, "error", err)
+		resp["warning"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// InternalTakeSnapshot handles POST /internal/cluster-snapshot
+// Body: {"id": "<snapshot ID>"}. Copies this node's part now.
+func (h *Handler) InternalTakeSnapshot(c *gin.Context) {
+	var body struct {
+		ID string `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		bodyError(c, err)
+		return
+	}
+	part, err := h.replicator.TakeSnapshotPart(body.ID)
+	if err != nil {
+		snapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, part)
+}
+
+// InternalSnapshotPart handles GET /internal/cluster-snapshot/:id/part
+func (h *Handler) InternalSnapshotPart(c *gin.Context) {
+	part, err := h.replicator.SnapshotPartStatus(c.Param("id"))
+	if err != nil {
+		snapshotError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, part)
+}
+
+// InternalSnapshotArchive handles GET /internal/cluster-snapshot/:id/archive
+func (h *Handler) InternalSnapshotArchive(c *gin.Context) {
+	h.streamSnapshotPart(c, h.selfID)
+}
+
+// InternalPutSnapshot handles PUT /internal/cluster-snapshot/:id
+// Stores a finished snapshot's manifest sent by its coordinator.
+func (h *Handler) InternalPutSnapshot(c *gin.Context) {
+	var m cluster.SnapshotManifest
+	if err := c.ShouldBindJSON(&m); err != nil {
+		bodyError(c, err)
+		return
+	}
+	m.ID = c.Param("id")
+	if err := h.replicator.SaveSnapshotManifest(m); err != nil {
+		snapshotError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// InternalDeleteSnapshot handles DELETE /internal/cluster-snapshot/:id
+func (h *Handler) InternalDeleteSnapshot(c *gin.Context) {
+	if err := h.replicator.RemoveSnapshot(c.Param("id")); err != nil {
+		snapshotError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) streamSnapshotPart(c *gin.Context, node string) {
+	body, err := h.replicator.OpenSnapshotPart(c.Request.Context(), c.Param("id"), node)
+	if err != nil {
+		snapshotError(c, err)
+		return
+	}
+	defer body.Close()
+
+	startStream(c, "application/x-kvbak")
+	c.Header("Content-Disposition", `attachment; filename="`+node+`.kvbak"`)
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, body); err != nil {
+		CurrentLogger(c).Error("cluster snapshot download failed", "id", c.Param("id"), "node", node, "error", err)
+	}
+}
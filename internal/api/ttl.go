@@ -0,0 +1,35 @@
+package api
+
+import (
+	"distributed-kvstore/internal/store"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A write expires after its namespace's ttl_seconds (store/ttl.go)
+// unless it says otherwise:
+//
+//	X-TTL: 30m      this write expires 30 minutes from now
+//	X-TTL: 0        this write never expires
+//
+// Like X-Replication, the header survives forwarding.
+
+// TTLHeader sets the TTL of one write, as a Go duration.
+const TTLHeader = "X-TTL"
+
+// writeTTL returns the TTL the write in c asked for (nil = none given).
+// On an invalid header it writes a 400 and returns ok == false.
+func writeTTL(c *gin.Context) (ttl *time.Duration, ok bool) {
+	v := c.GetHeader(TTLHeader)
+	if v == "" {
+		return nil, true
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 || d > store.MaxTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": TTLHeader + " must be a duration from 0 (never expire) to " + store.MaxTTL.String()})
+		return nil, false
+	}
+	return &d, true
+}
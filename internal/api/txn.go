@@ -0,0 +1,196 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Transactions ─────────────────────────────────────────────────────────────
+
+// txnBody is the body of POST /txn. Keys are user keys in Namespace.
+type txnBody struct {
+	Namespace string `json:"namespace"`
+	cluster.Txn
+}
+
+// Txn handles POST /txn
+//
+//	{"namespace": "bank",
+//	 "checks": [{"key": "alice", "value": "100"}, {"key": "bob", "exists": true}],
+//	 "ops":    [{"op": "put", "key": "alice", "value": "70"},
+//	            {"op": "put", "key": "bob",   "value": "30"}]}
+//
+// Runs on the keys' primary replica (see cluster/txn.go); other nodes
+// forward it there. Keys on different replicas are committed in two
+// phases from this node (see cluster/twophase.go). 200 with the new clocks if committed, 409 with the
+// indexes of the failed checks if not.
+func (h *Handler) Txn(c *gin.Context) {
+	raw, err := c.GetRawData()
+	if err != nil {
+		bodyError(c, err)
+		return
+	}
+	var body txnBody
+	if err := json.Unmarshal(raw, &body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ns := body.Namespace
+	if ns == "" {
+		ns = store.DefaultNamespace
+	}
+	if !store.ValidNamespace(ns) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": store.ErrInvalidNamespace.Error()})
+		return
+	}
+	if _, ok := h.store.GetNamespace(ns); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": store.ErrNamespaceNotFound.Error()})
+		return
+	}
+	if ok, wait := h.allowNamespace(c, ns); !ok {
+		abortNamespaceRate(c, wait)
+		return
+	}
+
+	// Work on internal keys from here on.
+	t := body.Txn
+	limits := h.store.Limits()
+	internal := func(key string, write bool) (string, bool) {
+		if err := limits.CheckKey(key); err != nil {
+			writeError(c, err)
+			return "", false
+		}
+		key = store.NamespacedKey(ns, key)
+		if err := h.checkKeyACL(c, key, write); err != nil {
+			writeError(c, err)
+			return "", false
+		}
+		return key, true
+	}
+	t.Checks = append([]cluster.TxnCheck(nil), t.Checks...)
+	for i := range t.Checks {
+		var ok bool
+		if t.Checks[i].Key, ok = internal(t.Checks[i].Key, false); !ok {
+			return
+		}
+	}
+	t.Ops = append([]cluster.TxnOp(nil), t.Ops...)
+	for i := range t.Ops {
+		var ok bool
+		if t.Ops[i].Key, ok = internal(t.Ops[i].Key, true); !ok {
+			return
+		}
+	}
+	if err := t.Validate(); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var res cluster.TxnResult
+	coord, err := h.replicator.TxnCoordinator(t)
+	switch {
+	case errors.Is(err, cluster.ErrTxnOwners):
+		// No node holds every key: two-phase commit, coordinated here.
+		res, err = h.replicator.ExecuteDistributedTxn(c.Request.Context(), t)
+	case err != nil:
+	case coord.ID != h.selfID && c.GetHeader(cluster.ForwardedHeader) == "":
+		// Forwarded once already: serve here, as forward does.
+		h.forwardToNode(c, coord.ID, raw)
+		return
+	default:
+		res, err = h.replicator.ExecuteTxn(c.Request.Context(), t)
+	}
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if !res.Committed {
+		c.JSON(http.StatusConflict, gin.H{"namespace": ns, "committed": false, "failed_checks": res.Failed})
+		return
+	}
+	// Report keys the way the client sent them.
+	clocks := make(map[string]store.VectorClock, len(res.Clocks))
+	for k, clock := range res.Clocks {
+		_, key := store.SplitKey(k)
+		clocks[key] = clock
+	}
+	c.JSON(http.StatusOK, gin.H{"namespace": ns, "committed": true, "clocks": clocks})
+}
+
+// InternalTxn handles POST /internal/txn
+// Applies a transaction's writes, sent by its coordinator, as one batch.
+func (h *Handler) InternalTxn(c *gin.Context) {
+	var req cluster.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bodyError(c, err)
+		return
+	}
+	for _, e := range req.Entries {
+		if h.rejectStale(c, e.Key) {
+			return
+		}
+	}
+	if _, err := h.store.ApplyBatch(req.Entries); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// InternalTxnPrepare handles POST /internal/txn/prepare
+// Locks this node's keys of a two-phase transaction. An error is a no
+// vote.
+func (h *Handler) InternalTxnPrepare(c *gin.Context) {
+	var req cluster.PhaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bodyError(c, err)
+		return
+	}
+	for _, key := range req.Keys {
+		if h.rejectStale(c, key) {
+			return
+		}
+	}
+	if err := h.replicator.PrepareTxn(c.Request.Context(), req); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// InternalTxnCommit handles POST /internal/txn/commit
+// Applies this node's writes of a committed two-phase transaction.
+func (h *Handler) InternalTxnCommit(c *gin.Context) {
+	var req cluster.PhaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bodyError(c, err)
+		return
+	}
+	if err := h.replicator.CommitTxn(req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// InternalTxnAbort handles POST /internal/txn/abort
+func (h *Handler) InternalTxnAbort(c *gin.Context) {
+	var req cluster.PhaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bodyError(c, err)
+		return
+	}
+	h.replicator.AbortTxn(req.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// InternalTxnDecision handles GET /internal/txn/:id?node=
+// Tells a replica left prepared how a transaction coordinated here ended.
+func (h *Handler) InternalTxnDecision(c *gin.Context) {
+	c.JSON(http.StatusOK, h.replicator.TxnDecision(c.Param("id"), c.Query("node")))
+}
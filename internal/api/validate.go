@@ -0,0 +1,255 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Request validation ───────────────────────────────────────────────────────
+//
+// ValidateRequests checks the query and header parameters and the JSON
+// body of each request against its operation in openapi.go, before the
+// handler runs. Whatever is wrong, the answer is the same 400:
+//
+//	PUT /kv/app/k1 {"content_type": "text/plain"}
+//	→ 400 {"error": "value is required", "field": "value"}
+//	POST /batch {"ops": [{"op": "get", "key": "a"}, {"op": "set", "key": "b"}]}
+//	→ 400 {"error": "ops[1].op must be one of get, put, delete", "field": "ops[1].op"}
+//
+// The handlers keep their own checks, for the pkg/kv calls that skip
+// the router and for nodes on an older version: validation only makes
+// the common mistakes fail early and alike. Unknown fields are allowed, as
+// the handlers ignore them.
+
+// schema is the part of an OpenAPI 3.0 schema object the API uses.
+type schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// validationError is an invalid parameter or body field.
+type validationError struct {
+	Field string // "" = the whole body
+	Msg   string
+}
+
+func (e *validationError) Error() string {
+	if e.Field == "" {
+		return "request body " + e.Msg
+	}
+	return e.Field + " " + e.Msg
+}
+
+// ValidateRequests rejects requests that do not match their operation
+// in the OpenAPI document. It must run after BodyLimit and Compression,
+// which it relies on to bound and decode the body.
+func ValidateRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		op, ok := operations[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			c.Next()
+			return
+		}
+		for _, p := range op.Params {
+			var v string
+			switch p.In {
+			case "query":
+				v = c.Query(p.Name)
+			case "header":
+				v = c.GetHeader(p.Name)
+			}
+			if v == "" {
+				continue
+			}
+			if err := p.Schema.validateParam(p.Name, v); err != nil {
+				abortInvalid(c, err)
+				return
+			}
+		}
+		if op.Body != nil {
+			data, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				bodyError(c, err)
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+			if len(bytes.TrimSpace(data)) == 0 {
+				if !op.BodyOptional {
+					abortInvalid(c, &validationError{Msg: "is required"})
+					return
+				}
+				c.Next()
+				return
+			}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			var doc any
+			if err := dec.Decode(&doc); err != nil {
+				abortInvalid(c, &validationError{Msg: "must be JSON: " + err.Error()})
+				return
+			}
+			if err := op.Body.validate("", doc); err != nil {
+				abortInvalid(c, err)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+func abortInvalid(c *gin.Context, err *validationError) {
+	resp := gin.H{"error": err.Error()}
+	if err.Field != "" {
+		resp["field"] = err.Field
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, resp)
+}
+
+// validateParam checks a query or header value, which is text whatever
+// its schema's type.
+func (s *schema) validateParam(name, v string) *validationError {
+	var doc any = v
+	switch s.Type {
+	case "integer", "number":
+		doc = json.Number(v)
+	case "boolean":
+		// Not strconv.ParseBool: the handlers compare with "true".
+		if v != "true" && v != "false" {
+			return &validationError{Field: name, Msg: "must be true or false"}
+		}
+		doc = v == "true"
+	}
+	return s.validate(name, doc)
+}
+
+// validate checks doc, decoded with UseNumber, against s. field is
+// doc's path in the body, e.g. ops[1].op.
+func (s *schema) validate(field string, doc any) *validationError {
+	invalid := func(format string, args ...any) *validationError {
+		return &validationError{Field: field, Msg: fmt.Sprintf(format, args...)}
+	}
+	switch s.Type {
+	case "object":
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return invalid("must be an object")
+		}
+		for _, name := range s.Required {
+			if _, ok := m[name]; !ok {
+				return &validationError{Field: join(field, name), Msg: "is required"}
+			}
+		}
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		slices.Sort(names) // report the same field every time
+		for _, name := range names {
+			sub := s.Properties[name]
+			if sub == nil {
+				sub = s.AdditionalProperties
+			}
+			if sub == nil || m[name] == nil && !slices.Contains(s.Required, name) {
+				continue // unknown, or an optional field sent as null
+			}
+			if err := sub.validate(join(field, name), m[name]); err != nil {
+				return err
+			}
+		}
+
+	case "array":
+		items, ok := doc.([]any)
+		if !ok {
+			return invalid("must be an array")
+		}
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			return invalid("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			return invalid("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", field, i), item); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "string":
+		v, ok := doc.(string)
+		if !ok {
+			return invalid("must be a string")
+		}
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			return invalid("must not be empty")
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, v) {
+			return invalid("must be one of %s", strings.Join(s.Enum, ", "))
+		}
+
+	case "integer", "number":
+		n, ok := doc.(json.Number)
+		if !ok {
+			return invalid("must be %s", map[string]string{"integer": "an integer", "number": "a number"}[s.Type])
+		}
+		var v float64
+		if s.Type == "integer" {
+			i, err := n.Int64()
+			if err != nil {
+				// Clocks and fencing tokens are uint64.
+				u, err := strconv.ParseUint(n.String(), 10, 64)
+				if err != nil {
+					return invalid("must be an integer")
+				}
+				v = float64(u)
+			} else {
+				v = float64(i)
+			}
+		} else {
+			f, err := n.Float64()
+			if err != nil {
+				return invalid("must be a number")
+			}
+			v = f
+		}
+		if s.Minimum != nil && v < float64(*s.Minimum) {
+			return invalid("must be at least %d", *s.Minimum)
+		}
+		if s.Maximum != nil && v > float64(*s.Maximum) {
+			return invalid("must be at most %d", *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := doc.(bool); !ok {
+			return invalid("must be true or false")
+		}
+	}
+	return nil
+}
+
+func join(field, name string) string {
+	if field == "" {
+		return name
+	}
+	return field + "." + name
+}
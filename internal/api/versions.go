@@ -0,0 +1,162 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version history (namespaces created with "versions": K):
+//
+//	GET /kv/:namespace/:key/versions       → every version the replicas still hold, newest first
+//	GET /kv/:namespace/:key?clock=n1:3,n2:1 → that one version (404 once it has aged out)
+//	POST /kv/:namespace/:key/undelete       → a deleted key's last value, written again
+//
+// To undo a write, read the version you want back and PUT its value.
+
+// versionJSON is one version as clients see it: decoded.
+type versionJSON struct {
+	Value       string            `json:"value,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Clock       store.VectorClock `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	HLC         string            `json:"hlc,omitempty"` // tie-break stamp; unset on values older than HLCs
+	Deleted     bool              `json:"deleted,omitempty"`
+	Current     bool              `json:"current,omitempty"`
+	Replicas    []string          `json:"replicas"`
+}
+
+// KeyVersions handles GET /kv/:namespace/:key/versions
+func (h *Handler) KeyVersions(c *gin.Context) {
+	key, ok := storeKey(c)
+	if !ok {
+		return
+	}
+	kv := h.replicator.KeyVersions(c.Request.Context(), key)
+	versions := make([]versionJSON, 0, len(kv.Versions))
+	for _, v := range kv.Versions {
+		decoded, err := v.Decode()
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		vj := versionJSON{
+			Value:       decoded.Data,
+			ContentType: decoded.ContentType,
+			Clock:       decoded.Clock,
+			UpdatedAt:   decoded.UpdatedAt,
+			Deleted:     decoded.Tombstone,
+			Current:     v.Current,
+			Replicas:    v.Replicas,
+		}
+		if decoded.HLC != 0 {
+			vj.HLC = decoded.HLC.String()
+		}
+		versions = append(versions, vj)
+	}
+	resp := gin.H{"namespace": c.Param("namespace"), "key": c.Param("key"), "versions": versions}
+	if len(kv.Unreachable) > 0 {
+		resp["unreachable"] = kv.Unreachable
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// getVersion answers GET /kv/:namespace/:key?clock=… with that version.
+func (h *Handler) getVersion(c *gin.Context, key string) {
+	clock, err := store.ParseClock(c.Query("clock"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	v, ok := h.replicator.KeyVersion(c.Request.Context(), key, clock)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no replica has this version"})
+		return
+	}
+	decoded, err := v.Decode()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	resp := gin.H{
+		"namespace":  c.Param("namespace"),
+		"key":        c.Param("key"),
+		"value":      decoded.Data,
+		"clock":      decoded.Clock,
+		"updated_at": decoded.UpdatedAt,
+	}
+	if decoded.ContentType != "" {
+		resp["content_type"] = decoded.ContentType
+	}
+	if decoded.Tombstone {
+		resp["deleted"] = true
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Undelete handles POST /kv/:namespace/:key/undelete
+//
+// Runs on the key's primary (see cluster/undelete.go); other nodes
+// forward it there. 409 if the key is live, 404 if no replica kept a
+// version from before the delete.
+func (h *Handler) Undelete(c *gin.Context) {
+	key, ok := storeKey(c)
+	if !ok {
+		return
+	}
+	if err := h.store.Limits().CheckKey(c.Param("key")); err != nil {
+		writeError(c, err)
+		return
+	}
+	coord, err := h.replicator.KeyCoordinator(key)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if coord.ID != h.selfID && c.GetHeader(cluster.ForwardedHeader) == "" {
+		h.forwardToNode(c, coord.ID, nil)
+		return
+	}
+	h.replicator.TouchKey(key, true)
+
+	val, from, err := h.replicator.Undelete(c.Request.Context(), key)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	decoded, err := val.Decode()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	resp := gin.H{
+		"namespace":     c.Param("namespace"),
+		"key":           c.Param("key"),
+		"value":         decoded.Data,
+		"clock":         val.Clock,
+		"restored_from": from.Clock,
+	}
+	if val.ContentType != "" {
+		resp["content_type"] = val.ContentType
+	}
+	setSession(c, val)
+	c.Header("ETag", etag(val))
+	c.JSON(http.StatusOK, resp)
+}
+
+// InternalVersions handles GET /internal/versions/:namespace/:key
+// Returns this replica's current value and history, as stored.
+func (h *Handler) InternalVersions(c *gin.Context) {
+	key, ok := storeKey(c)
+	if !ok {
+		return
+	}
+	vs := h.store.Versions(key)
+	if vs == nil {
+		vs = []store.Value{}
+	}
+	c.JSON(http.StatusOK, vs)
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ─── Watch ────────────────────────────────────────────────────────────────────
+//
+//	GET /watch/:namespace?prefix=user:
+//	→ 200, then one JSON event per line, as the changes happen:
+//	{"op": "put", "key": "user:42", "value": "alice", "clock": {...}, "updated_at": ..., "node": "n2"}
+//	{"op": "delete", "key": "user:7", "clock": {...}, "updated_at": ..., "node": "n1"}
+//
+// replicas=all sends every replica's copy of a write instead of the first
+// one (see cluster/watch.go). An empty line is sent every
+// watchHeartbeat, so idle streams stay open through proxies and a dead
+// one is noticed. The stream ends with an {"error": ...} line if the
+// client reads slower than the cluster writes; watch again then.
+
+// watchHeartbeat is the longest a watch stream stays silent.
+const watchHeartbeat = 15 * time.Second
+
+// StopWatches ends the open watch and CDC streams. A graceful shutdown
+// waits for requests to finish, and those never do.
+func (h *Handler) StopWatches() { h.stopWatches() }
+
+// Watch handles GET /watch/:namespace?prefix=&replicas=
+func (h *Handler) Watch(c *gin.Context) {
+	ns := c.Param("namespace")
+	all := c.Query("replicas") == "all"
+	if c.Query("replicas") != "" && !all {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `replicas must be "all" or empty`})
+		return
+	}
+	h.streamWatch(c, ns, func(ctx context.Context, fn func(cluster.WatchEvent) error) error {
+		return h.replicator.Watch(ctx, ns, c.Query("prefix"), all, fn)
+	})
+}
+
+// InternalWatch handles GET /internal/watch/:namespace?prefix=
+// The changes this node applies, for a peer serving a watch.
+func (h *Handler) InternalWatch(c *gin.Context) {
+	ns := c.Param("namespace")
+	h.streamWatch(c, ns, func(ctx context.Context, fn func(cluster.WatchEvent) error) error {
+		return h.replicator.WatchLocal(ctx, ns, c.Query("prefix"), fn)
+	})
+}
+
+// streamWatch sends the events of run as NDJSON until the client goes
+// away or run fails.
+func (h *Handler) streamWatch(c *gin.Context, ns string, run func(context.Context, func(cluster.WatchEvent) error) error) {
+	if _, ok := h.store.GetNamespace(ns); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": store.ErrNamespaceNotFound.Error()})
+		return
+	}
+	streamEvents(h, c, run)
+}
+
+// streamEvents sends the events of run as NDJSON, with heartbeats,
+// until the client goes away, run fails, or StopWatches is called.
+func streamEvents[T any](h *Handler, c *gin.Context, run func(context.Context, func(T) error) error) {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	defer context.AfterFunc(h.watches, cancel)()
+	events := make(chan T)
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, func(ev T) error {
+			select {
+			case events <- ev:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	startStream(c, "application/x-ndjson")
+	c.Status(http.StatusOK)
+	c.Writer.Flush() // the client knows the watch is on
+	enc := json.NewEncoder(c.Writer)
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case ev := <-events:
+			err = enc.Encode(ev)
+		case <-heartbeat.C:
+			_, err = c.Writer.Write([]byte("\n"))
+		case err := <-done:
+			switch {
+			case h.watches.Err() != nil:
+				_ = enc.Encode(gin.H{"error": "node is shutting down"})
+			case !errors.Is(err, context.Canceled):
+				_ = enc.Encode(gin.H{"error": err.Error()})
+			}
+			return
+		}
+		if err != nil {
+			return // client went away
+		}
+		c.Writer.Flush()
+	}
+}
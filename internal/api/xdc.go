@@ -0,0 +1,28 @@
+package api
+
+import (
+	"distributed-kvstore/internal/cluster"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InternalXDC handles POST /internal/xdc
+//
+// Writes shipped by another cluster's bridge (see cluster/xdc.go), with
+// this cluster's token. Each is applied by its coordinator here; 200
+// {"applied": n} once all of them are, else an error and the bridge
+// sends the batch again.
+func (h *Handler) InternalXDC(c *gin.Context) {
+	var req cluster.XDCRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		bodyError(c, err)
+		return
+	}
+	n, err := h.replicator.ApplyXDC(c.Request.Context(), req)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cluster.XDCResponse{Applied: n})
+}
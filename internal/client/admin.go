@@ -0,0 +1,628 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RestoreStats is returned by Restore.
+type RestoreStats struct {
+	Records int64 `json:"records"`
+	Applied int64 `json:"applied"`
+	Failed  int64 `json:"failed"`
+
+	Relabeled int64 `json:"relabeled,omitempty"` // records whose clock the node map renamed
+}
+
+// Backup streams a backup archive (.kvbak) into w.
+//
+// cluster=false backs up only the node the client talks to;
+// cluster=true asks that node to collect every node's data.
+//
+// The client's timeout does not apply: backups can take a long time.
+// Use ctx to bound it.
+func (c *Client) Backup(ctx context.Context, w io.Writer, cluster bool) error {
+	scope := "node"
+	if cluster {
+		scope = "cluster"
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, "/admin/backup?scope="+scope, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.streamingClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("backup request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Restore uploads a backup archive read from r.
+//
+// nodeMap, if not empty, maps the node IDs of the cluster the archive
+// came from to members of this one; the server renames them in the
+// restored clocks.
+func (c *Client) Restore(ctx context.Context, r io.Reader, nodeMap map[string]string) (*RestoreStats, error) {
+	path := "/admin/restore"
+	if len(nodeMap) > 0 {
+		pairs := make([]string, 0, len(nodeMap))
+		for old, id := range nodeMap {
+			pairs = append(pairs, old+"="+id)
+		}
+		slices.Sort(pairs)
+		path += "?map=" + url.QueryEscape(strings.Join(pairs, ","))
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, path, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-kvbak")
+
+	resp, err := c.streamingClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("restore request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var stats RestoreStats
+	return &stats, json.NewDecoder(resp.Body).Decode(&stats)
+}
+
+// streamingClient is the client's HTTP client without the overall timeout,
+// for long transfers. It shares the same transport (and connection pool).
+func (c *Client) streamingClient() *http.Client {
+	hc := *c.httpClient
+	hc.Timeout = 0
+	return &hc
+}
+
+// Cluster snapshot states.
+const (
+	SnapshotRunning = "running"
+	SnapshotDone    = "done"
+	SnapshotFailed  = "failed"
+)
+
+// ClusterSnapshot is a cluster snapshot's manifest.
+type ClusterSnapshot struct {
+	ID          string    `json:"id"`
+	State       string    `json:"state"`
+	Coordinator string    `json:"coordinator"`
+	Started     time.Time `json:"started"`
+	Finished    time.Time `json:"finished,omitzero"`
+	Error       string    `json:"error,omitempty"`
+	Ring        string    `json:"ring"`
+	Vnodes      int       `json:"vnodes"`
+	Quorum      Quorum    `json:"quorum"`
+	Nodes       []struct {
+		ID      string `json:"id"`
+		Address string `json:"address"`
+		IsAlive bool   `json:"is_alive"`
+		Weight  int    `json:"weight,omitempty"`
+		Zone    string `json:"zone,omitempty"`
+	} `json:"nodes"`
+	Parts     []SnapshotPart `json:"parts"`
+	CutSpread string         `json:"cut_spread,omitempty"`
+}
+
+// SnapshotPart is one node's archive in a cluster snapshot.
+type SnapshotPart struct {
+	Node    string    `json:"node"`
+	State   string    `json:"state"`
+	File    string    `json:"file"`
+	Records int       `json:"records"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Seq     uint64    `json:"seq"`
+	TakenAt time.Time `json:"taken_at"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// StartClusterSnapshot has every node snapshot its data at about the
+// same moment and returns at once: poll ClusterSnapshot with the
+// returned ID. Any node can answer for it once it is done.
+func (c *Client) StartClusterSnapshot(ctx context.Context) (*ClusterSnapshot, error) {
+	var m ClusterSnapshot
+	if err := c.doJSON(ctx, http.MethodPost, "/admin/cluster-snapshot", nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ClusterSnapshot returns the manifest of snapshot id.
+func (c *Client) ClusterSnapshot(ctx context.Context, id string) (*ClusterSnapshot, error) {
+	var m ClusterSnapshot
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/cluster-snapshot/"+url.PathEscape(id), nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ClusterSnapshots lists the cluster snapshots the server knows, oldest first.
+func (c *Client) ClusterSnapshots(ctx context.Context) ([]ClusterSnapshot, error) {
+	var resp struct {
+		Snapshots []ClusterSnapshot `json:"snapshots"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/cluster-snapshot", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Snapshots, nil
+}
+
+// DownloadSnapshotPart streams node's archive of snapshot id into w.
+// Like Backup, it is bounded by ctx only.
+func (c *Client) DownloadSnapshotPart(ctx context.Context, id, node string, w io.Writer) error {
+	req, err := c.newRequest(ctx, http.MethodGet, "/admin/cluster-snapshot/"+url.PathEscape(id)+"/"+url.PathEscape(node), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.streamingClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("snapshot download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// DeleteClusterSnapshot deletes snapshot id on every node. A non-empty
+// warning lists the nodes that could not be reached.
+func (c *Client) DeleteClusterSnapshot(ctx context.Context, id string) (warning string, err error) {
+	var resp struct {
+		Warning string `json:"warning"`
+	}
+	if err := c.doJSON(ctx, http.MethodDelete, "/admin/cluster-snapshot/"+url.PathEscape(id), nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Warning, nil
+}
+
+// ReplicaLocation is one replica of a located key.
+type ReplicaLocation struct {
+	ID      string            `json:"id"`
+	Address string            `json:"address"`
+	Primary bool              `json:"primary"`
+	Status  string            `json:"status"` // present, deleted, missing, unreachable
+	Clock   map[string]uint64 `json:"clock,omitempty"`
+}
+
+// KeyLocation describes where a key lives on the ring.
+type KeyLocation struct {
+	Key   string `json:"key"` // internal key: "<namespace>/<key>"
+	Token uint32 `json:"token"`
+	Range struct {
+		Start    uint32   `json:"start"`
+		End      uint32   `json:"end"`
+		Replicas []string `json:"replicas"`
+	} `json:"range"`
+	Replicas []ReplicaLocation `json:"replicas"`
+}
+
+// Locate asks the server which replicas own key (in the client's
+// namespace) and what each of them holds.
+func (c *Client) Locate(ctx context.Context, key string) (*KeyLocation, error) {
+	var resp struct {
+		Location KeyLocation `json:"location"`
+	}
+	path := "/admin/locate/" + url.PathEscape(key) + "?namespace=" + url.QueryEscape(c.namespace)
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Location, nil
+}
+
+// StoredValue is a value exactly as a replica stores it.
+type StoredValue struct {
+	Data       string            `json:"data"`
+	Clock      map[string]uint64 `json:"clock"`
+	Tombstone  bool              `json:"tombstone"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	Encoding   string            `json:"encoding,omitempty"`   // compression codec; Data is then empty
+	Compressed []byte            `json:"compressed,omitempty"` // compressed Data
+
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// ReplicaValue is one replica's copy of a key.
+type ReplicaValue struct {
+	ID       string       `json:"id"`
+	Address  string       `json:"address"`
+	Primary  bool         `json:"primary"`
+	Status   string       `json:"status"`             // present, deleted, missing, unreachable
+	Relation string       `json:"relation,omitempty"` // winner, behind, concurrent, conflict, missing
+	Error    string       `json:"error,omitempty"`
+	Value    *StoredValue `json:"value,omitempty"`
+}
+
+// KeyMeta is every replica's copy of a key, side by side.
+type KeyMeta struct {
+	Key       string         `json:"key"` // internal key: "<namespace>/<key>"
+	Divergent bool           `json:"divergent"`
+	Replicas  []ReplicaValue `json:"replicas"`
+}
+
+// KeyMeta fetches key (in the client's namespace) from every replica,
+// without repairing anything.
+func (c *Client) KeyMeta(ctx context.Context, key string) (*KeyMeta, error) {
+	var resp struct {
+		Meta KeyMeta `json:"meta"`
+	}
+	path := "/kv/" + url.PathEscape(c.namespace) + "/" + url.PathEscape(key) + "/meta"
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Meta, nil
+}
+
+// KeyRepair reports what RepairKey did.
+type KeyRepair struct {
+	Key      string            `json:"key"`
+	Clock    map[string]uint64 `json:"clock,omitempty"` // the winner's; nil if no replica has the key
+	InSync   []string          `json:"in_sync,omitempty"`
+	Repaired []string          `json:"repaired,omitempty"`
+	Failed   map[string]string `json:"failed,omitempty"` // replica → error
+	Bumped   bool              `json:"bumped,omitempty"` // winner re-versioned to settle a same-clock conflict
+}
+
+// RepairKey makes the server reconcile key (in the client's namespace)
+// across all its replicas and write the winner back, synchronously.
+// A non-empty Failed means some replicas are still not repaired.
+func (c *Client) RepairKey(ctx context.Context, key string) (*KeyRepair, error) {
+	var resp struct {
+		Repair KeyRepair `json:"repair"`
+	}
+	path := "/admin/repair/" + url.PathEscape(key) + "?namespace=" + url.QueryEscape(c.namespace)
+	if err := c.doJSON(ctx, http.MethodPost, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Repair, nil
+}
+
+// Repair job states.
+const (
+	RepairRunning = "running"
+	RepairDone    = "done"
+	RepairFailed  = "failed"
+)
+
+// RepairStatus is the progress of a full repair.
+type RepairStatus struct {
+	ID          string    `json:"id,omitempty"`
+	Node        string    `json:"node"` // where it runs
+	State       string    `json:"state,omitempty"`
+	Ranges      int       `json:"ranges"`
+	RangesDone  int       `json:"ranges_done"`
+	Scanned     int       `json:"scanned"`
+	Repaired    int       `json:"repaired"`
+	Failed      int       `json:"failed"`
+	Unreachable []string  `json:"unreachable,omitempty"`
+	Started     time.Time `json:"started,omitzero"`
+	Finished    time.Time `json:"finished,omitzero"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// StartRepair starts a full repair of every token range on nodeID
+// ("" = whichever node answers) and returns at once: poll RepairProgress
+// with the returned Node.
+func (c *Client) StartRepair(ctx context.Context, nodeID string) (*RepairStatus, error) {
+	var st RepairStatus
+	if err := c.doJSON(ctx, http.MethodPost, "/admin/repair?node="+url.QueryEscape(nodeID), nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// RepairProgress returns the state of the last full repair on nodeID.
+func (c *Client) RepairProgress(ctx context.Context, nodeID string) (*RepairStatus, error) {
+	var st RepairStatus
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/repair?node="+url.QueryEscape(nodeID), nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// Quorum is a cluster's replication settings.
+type Quorum struct {
+	N       int    `json:"n"`
+	W       int    `json:"w"`
+	R       int    `json:"r"`
+	Version uint64 `json:"version"`
+	Origin  string `json:"origin,omitempty"`
+}
+
+// QuorumStatus is returned by Quorum.
+type QuorumStatus struct {
+	Quorum        Quorum `json:"quorum"`
+	Rereplication struct {
+		Running  bool      `json:"running"`
+		FromN    int       `json:"from_n,omitempty"`
+		ToN      int       `json:"to_n,omitempty"`
+		Started  time.Time `json:"started,omitzero"`
+		Finished time.Time `json:"finished,omitzero"`
+		Keys     int       `json:"keys"`
+		Sent     int       `json:"sent"`
+		Failed   int       `json:"failed"`
+	} `json:"rereplication"`
+}
+
+// QuorumChange is returned by SetQuorum.
+// Warning lists the nodes that did not receive the change.
+type QuorumChange struct {
+	Quorum  Quorum `json:"quorum"`
+	Warning string `json:"warning,omitempty"`
+}
+
+// Quorum returns the server's quorum config and re-replication progress.
+func (c *Client) Quorum(ctx context.Context) (*QuorumStatus, error) {
+	var st QuorumStatus
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/quorum", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// ACLRule grants a token access to keys under a prefix
+// ("<namespace>/<key prefix>"). Access is "read" or "readwrite".
+type ACLRule struct {
+	Prefix string `json:"prefix"`
+	Access string `json:"access"`
+}
+
+// ACL is one token's rules. Warning (from SetACL and DeleteACL) lists
+// the nodes that did not receive the change.
+type ACL struct {
+	Token   string    `json:"token"`
+	Rules   []ACLRule `json:"rules"` // empty = not restricted
+	Version uint64    `json:"version"`
+	Warning string    `json:"warning,omitempty"`
+}
+
+// ACLs is the cluster's ACL config: rules by token name.
+type ACLs struct {
+	Tokens  map[string][]ACLRule `json:"tokens"`
+	Version uint64               `json:"version"`
+}
+
+// ListACLs returns every token's rules.
+func (c *Client) ListACLs(ctx context.Context) (*ACLs, error) {
+	var acls ACLs
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/acl", nil, &acls); err != nil {
+		return nil, err
+	}
+	return &acls, nil
+}
+
+// GetACL returns one token's rules.
+func (c *Client) GetACL(ctx context.Context, token string) (*ACL, error) {
+	var acl ACL
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/acl/"+url.PathEscape(token), nil, &acl); err != nil {
+		return nil, err
+	}
+	return &acl, nil
+}
+
+// SetACL replaces a token's rules on the whole cluster.
+func (c *Client) SetACL(ctx context.Context, token string, rules []ACLRule) (*ACL, error) {
+	var acl ACL
+	body := map[string][]ACLRule{"rules": rules}
+	if err := c.doJSON(ctx, http.MethodPut, "/admin/acl/"+url.PathEscape(token), body, &acl); err != nil {
+		return nil, err
+	}
+	return &acl, nil
+}
+
+// DeleteACL removes a token's rules: it is no longer restricted.
+func (c *Client) DeleteACL(ctx context.Context, token string) (*ACL, error) {
+	var acl ACL
+	if err := c.doJSON(ctx, http.MethodDelete, "/admin/acl/"+url.PathEscape(token), nil, &acl); err != nil {
+		return nil, err
+	}
+	return &acl, nil
+}
+
+// ReloadResult is returned by Reload.
+type ReloadResult struct {
+	Node     string   `json:"node"`
+	Reloaded []string `json:"reloaded"`
+}
+
+// Reload makes the server re-read its reloadable settings.
+func (c *Client) Reload(ctx context.Context) (*ReloadResult, error) {
+	var res ReloadResult
+	if err := c.doJSON(ctx, http.MethodPost, "/admin/reload", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// SetQuorum changes N/W/R on the whole cluster.
+func (c *Client) SetQuorum(ctx context.Context, n, w, r int) (*QuorumChange, error) {
+	var ch QuorumChange
+	body := map[string]int{"n": n, "w": w, "r": r}
+	if err := c.doJSON(ctx, http.MethodPut, "/admin/quorum", body, &ch); err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// NodeStats is what one node holds.
+type NodeStats struct {
+	Node         string           `json:"node"`
+	Version      string           `json:"version,omitempty"` // empty for older servers
+	Started      time.Time        `json:"started,omitzero"`
+	Keys         int              `json:"keys"`
+	Tombstones   int              `json:"tombstones"`
+	ValueBytes   int64            `json:"value_bytes"`
+	WALBytes     int64            `json:"wal_bytes"`
+	WALEntries   int              `json:"wal_entries"`
+	WALCommits   int              `json:"wal_commits"`  // 0 for older servers
+	WALSyncs     int              `json:"wal_syncs"`    // 0 for older servers
+	WALSync      string           `json:"wal_sync"`     // empty for older servers
+	MemoryBytes  int64            `json:"memory_bytes"` // estimated; 0 for older servers
+	MaxMemory    int64            `json:"max_memory_bytes,omitempty"`
+	Evictions    uint64           `json:"evictions"`
+	DiskFree     int64            `json:"disk_free_bytes,omitempty"` // 0 for older servers
+	DiskLow      bool             `json:"disk_low,omitempty"`        // the node refuses writes
+	LastSnapshot time.Time        `json:"last_snapshot,omitzero"`
+	LastCompact  time.Time        `json:"last_wal_compaction,omitzero"`
+	WALCompacted int64            `json:"wal_compacted_bytes,omitempty"`
+	ChangeSeq    uint64           `json:"change_seq"` // last change in the node's CDC feed; 0 for older servers
+	OldestChange uint64           `json:"oldest_change,omitempty"`
+	HLCAheadMs   int64            `json:"hlc_ahead_ms,omitempty"` // the node's HLC lead over its wall clock
+	Namespaces   []NamespaceUsage `json:"namespaces,omitempty"`   // nil for older servers
+}
+
+// NamespaceUsage is what one node holds of a namespace, against its quotas.
+type NamespaceUsage struct {
+	Name     string `json:"name"`
+	Keys     int    `json:"keys"`
+	MaxKeys  int    `json:"max_keys,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+// ClusterStats is returned by Stats.
+type ClusterStats struct {
+	Nodes       []NodeStats `json:"nodes"`
+	Unreachable []string    `json:"unreachable,omitempty"`
+}
+
+// Stats returns every node's key counts, sizes and snapshot state.
+func (c *Client) Stats(ctx context.Context) (*ClusterStats, error) {
+	var st ClusterStats
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/stats", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// HotKey is one frequently used key of a node.
+type HotKey struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Count     uint32 `json:"count"` // estimated recent operations
+	Reads     uint64 `json:"reads"`
+	Writes    uint64 `json:"writes"`
+}
+
+// NodeHotKeys is one node's hottest keys, hottest first.
+type NodeHotKeys struct {
+	Node string   `json:"node"`
+	Keys []HotKey `json:"keys"`
+}
+
+// ClusterHotKeys is returned by HotKeys.
+type ClusterHotKeys struct {
+	Nodes       []NodeHotKeys `json:"nodes"`
+	Unreachable []string      `json:"unreachable,omitempty"`
+}
+
+// HotKeys returns every node's limit most used keys (0 = the server's
+// default of 10).
+func (c *Client) HotKeys(ctx context.Context, limit int) (*ClusterHotKeys, error) {
+	path := "/admin/hotkeys"
+	if limit > 0 {
+		path += "?limit=" + strconv.Itoa(limit)
+	}
+	var hk ClusterHotKeys
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &hk); err != nil {
+		return nil, err
+	}
+	return &hk, nil
+}
+
+// ShardMap is the ring layout returned by Shards.
+type ShardMap struct {
+	Vnodes int `json:"vnodes"`
+	N      int `json:"n"`
+	Nodes  []struct {
+		ID        string  `json:"id"`
+		Weight    int     `json:"weight"`
+		Ranges    int     `json:"ranges"`    // ranges where it is primary
+		Ownership float64 `json:"ownership"` // fraction of the ring it is primary for
+		Keys      int     `json:"keys"`
+		Bytes     int     `json:"bytes"`
+		Reachable bool    `json:"reachable"`
+	} `json:"nodes"`
+	Ranges []ShardRange `json:"ranges"`
+}
+
+// ShardRange is one token range, (Start, End], with what each replica
+// reports holding in it.
+type ShardRange struct {
+	Start    uint32   `json:"start"`
+	End      uint32   `json:"end"`
+	Replicas []string `json:"replicas"` // primary first
+	Usage    map[string]struct {
+		Keys  int `json:"keys"`
+		Bytes int `json:"bytes"`
+	} `json:"usage"`
+}
+
+// Shards returns the token ranges of the ring, their replicas, and every
+// node's share of the keys.
+func (c *Client) Shards(ctx context.Context) (*ShardMap, error) {
+	var m ShardMap
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/shards", nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// PeerReplication is what one node reports about replicating to a peer.
+type PeerReplication struct {
+	Peer          string     `json:"peer"`
+	LastSuccess   *time.Time `json:"last_success,omitempty"`
+	LastFailure   *time.Time `json:"last_failure,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	Successes     int64      `json:"successes"`
+	Retries       int64      `json:"retries"`
+	Failures      int64      `json:"failures"`
+	HintsPending  int        `json:"hints_pending"`  // writes held for the peer until it is back
+	OutboxPending int        `json:"outbox_pending"` // async writes not yet sent
+	Breaker       string     `json:"breaker,omitempty"`
+	ClockOffsetMs *float64   `json:"clock_offset_ms,omitempty"` // the peer's clock minus the node's
+	ClockSkewed   bool       `json:"clock_skewed,omitempty"`    // offset over the node's --max-clock-skew
+}
+
+// ReplicationReport is returned by Replication: each reachable node's
+// view of its peers.
+type ReplicationReport struct {
+	Nodes []struct {
+		Node  string            `json:"node"`
+		Peers []PeerReplication `json:"peers"`
+	} `json:"nodes"`
+	Unreachable []string `json:"unreachable,omitempty"`
+}
+
+// Replication returns every node's replication counters per peer.
+func (c *Client) Replication(ctx context.Context) (*ReplicationReport, error) {
+	var r ReplicationReport
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/replication", nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ─── Change data capture ──────────────────────────────────────────────────────
+
+// Change is one change of a node's CDC feed.
+type Change struct {
+	Seq         uint64            `json:"seq"`
+	Op          string            `json:"op"` // "put", "delete" or "evict"
+	Namespace   string            `json:"namespace"`
+	Key         string            `json:"key"`
+	Value       string            `json:"value,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Clock       map[string]uint64 `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Node        string            `json:"node"`
+}
+
+// ErrChangesGone is returned by Changes when the node no longer retains
+// the change asked for. The message names the oldest it does.
+var ErrChangesGone = errors.New("changes no longer retained")
+
+// Changes calls fn with every change the first endpoint's node applied,
+// from change number from on (0 = the oldest it retains), then live,
+// until ctx is done, fn fails, or the stream breaks (ErrWatchEnded).
+// namespace limits it to one namespace ("" = all).
+//
+// Change numbers are per node, so the feed never fails over to another
+// endpoint. To resume, call Changes again with the last Seq seen + 1:
+//
+//	next := uint64(0)
+//	err := c.Changes(ctx, next, "", func(ch client.Change) error {
+//		index(ch)
+//		next = ch.Seq + 1
+//		return nil
+//	})
+func (c *Client) Changes(ctx context.Context, from uint64, namespace string, fn func(Change) error) error {
+	if len(c.pool.eps) == 0 {
+		return fmt.Errorf("no server endpoints configured")
+	}
+	q := url.Values{}
+	if from > 0 {
+		q.Set("from", strconv.FormatUint(from, 10))
+	}
+	if namespace != "" {
+		q.Set("namespace", namespace)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var timedOut atomic.Bool
+	idle := time.AfterFunc(watchIdle, func() { timedOut.Store(true); cancel() })
+	defer idle.Stop()
+
+	path := "/cdc"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	resp, err := c.send(withStreaming(ctx), []string{c.pool.eps[0].url}, http.MethodGet, path, nil)
+	if err != nil {
+		return fmt.Errorf("cdc: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return fmt.Errorf("%w: %w", ErrChangesGone, checkStatus(resp))
+	}
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for {
+		idle.Reset(watchIdle)
+		line, err := r.ReadBytes('\n')
+		idle.Stop()
+		switch {
+		case timedOut.Load():
+			return fmt.Errorf("%w: no heartbeat from the server for %s", ErrWatchEnded, watchIdle)
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return fmt.Errorf("%w: %w", ErrWatchEnded, err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue // heartbeat
+		}
+		var msg struct {
+			Change
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return fmt.Errorf("%w: %w", ErrWatchEnded, err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("%w: %s", ErrWatchEnded, msg.Error)
+		}
+		if err := fn(msg.Change); err != nil {
+			return err
+		}
+	}
+}
@@ -26,12 +26,14 @@
 package client
 
 import (
-	"bytes"
+	"cmp"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -46,9 +48,45 @@ import (
 //
 // So the client does NOT implement distributed logic.
 // It just talks to one node.
+//
+// The one exception is WithRingRouting (see routing.go), which only
+// picks WHICH node to talk to; quorum logic stays on the server.
 type Client struct {
-	baseURL    string
+	pool       *pool // server endpoints (see endpoints.go)
+	retry      RetryPolicy
 	httpClient *http.Client
+	token      string  // API token sent as "Authorization: Bearer <token>"
+	namespace  string  // namespace used by Put/Get/Delete/Keys
+	codec      string  // HTTP compression codec ("" = none)
+	router     *router // ring-aware routing, nil = always use baseURL
+
+	valueCodecs map[string]Codec // by media type, for GetAs (see codec.go)
+}
+
+// Option customizes a Client.
+//
+// Example:
+//
+//	c := client.New(url, 5*time.Second, client.WithToken("s3cr3t"))
+type Option func(*Client)
+
+// WithToken authenticates every request with the given API token.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithNamespace makes Put/Get/Delete/Keys operate on namespace
+// instead of "default".
+func WithNamespace(namespace string) Option {
+	return func(c *Client) { c.namespace = namespace }
+}
+
+// WithTLSConfig sets the TLS settings used for https:// servers,
+// e.g. a private CA or a client certificate.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.httpClient.Transport.(*http.Transport).TLSClientConfig = cfg
+	}
 }
 
 // New creates a new Client.
@@ -57,18 +95,97 @@ type Client struct {
 //
 //	"http://localhost:8080"
 //
+// baseURL may also list several nodes separated by commas;
+// calls then fail over between them (see endpoints.go).
+//
 // timeout protects us from hanging forever.
 // In distributed systems:
 //
 //	NEVER call network without timeout.
-func New(baseURL string, timeout time.Duration) *Client {
+func New(baseURL string, timeout time.Duration, opts ...Option) *Client {
 	if timeout == 0 {
 		timeout = 10 * time.Second
 	}
-	return &Client{
-		baseURL:    baseURL,
-		httpClient: &http.Client{Timeout: timeout},
+	c := &Client{
+		pool:       newPool(baseURL),
+		retry:      defaultRetryPolicy,
+		httpClient: &http.Client{Timeout: timeout, Transport: newTransport()},
+		namespace:  DefaultNamespace,
 	}
+	c.valueCodecs = builtinCodecs()
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.pool.prober = c.httpClient
+	if c.codec != "" {
+		c.httpClient.Transport = newCompressingTransport(c.httpClient.Transport, c.codec)
+	}
+	return c
+}
+
+// newTransport returns the connection pool shared by all calls.
+//
+// The default transport keeps only 2 idle connections per host,
+// so a busy client would keep reconnecting. We keep more.
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 100
+	t.MaxIdleConnsPerHost = 32
+	t.IdleConnTimeout = 90 * time.Second
+	return t
+}
+
+// newRequest builds a request for path on the preferred endpoint
+// and attaches headers shared by every call (auth, content type).
+//
+// It does not fail over; use send (via doJSON) for calls that can be replayed.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	bases := c.pool.order()
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("no server endpoints configured")
+	}
+	return c.newRequestTo(ctx, bases[0], method, path, body)
+}
+
+// requestTimeoutHeader carries what is left of ctx's deadline.
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// newRequestTo is newRequest against an explicit node (base URL).
+func (c *Client) newRequestTo(ctx context.Context, base, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if k := idempotencyKey(ctx); k != "" {
+		req.Header.Set(idempotencyHeader, k)
+	}
+	if m := replicationMode(ctx); m != "" {
+		req.Header.Set(replicationHeader, m)
+	}
+	if p := readPolicy(ctx); p != "" {
+		req.Header.Set(readPolicyHeader, p)
+	}
+	if ttl, ok := ttlFrom(ctx); ok {
+		req.Header.Set(ttlHeader, ttl.String())
+	}
+	if t := sessionToken(ctx); t != "" {
+		req.Header.Set(sessionHeader, t)
+	}
+	if cond, ok := conditionFrom(ctx); ok {
+		req.Header.Set(cond.header, cond.value)
+	}
+	// Tell the server how long we will wait, so it gives up (504)
+	// instead of working on after we are gone.
+	if dl, ok := ctx.Deadline(); ok {
+		req.Header.Set(requestTimeoutHeader, max(time.Until(dl), time.Millisecond).Round(time.Millisecond).String())
+	}
+	return req, nil
 }
 
 // PutResponse is returned after a successful write.
@@ -79,9 +196,14 @@ func New(baseURL string, timeout time.Duration) *Client {
 // Each write updates a vector clock.
 // The client may need that for debugging or conflict handling.
 type PutResponse struct {
-	Key   string            `json:"key"`
-	Value string            `json:"value"`
-	Clock map[string]uint64 `json:"clock"`
+	Namespace   string            `json:"namespace"`
+	Key         string            `json:"key"`
+	Value       string            `json:"value,omitempty"` // not echoed by PutStream
+	Size        int               `json:"size,omitempty"`  // PutStream: bytes written
+	Clock       map[string]uint64 `json:"clock"`
+	ContentType string            `json:"content_type,omitempty"`
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`   // zero = never
+	Replication string            `json:"replication,omitempty"` // "async" if not yet replicated
 }
 
 // GetResponse includes:
@@ -92,10 +214,13 @@ type PutResponse struct {
 //
 // This gives full version information.
 type GetResponse struct {
-	Key       string            `json:"key"`
-	Value     string            `json:"value"`
-	Clock     map[string]uint64 `json:"clock"`
-	UpdatedAt time.Time         `json:"updated_at"`
+	Namespace   string            `json:"namespace"`
+	Key         string            `json:"key"`
+	Value       string            `json:"value"`
+	Clock       map[string]uint64 `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	ContentType string            `json:"content_type,omitempty"` // as given to PutTyped; "" if none
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`    // zero = never (see WithTTL)
 }
 
 // Put stores key=value in the cluster.
@@ -111,29 +236,90 @@ type GetResponse struct {
 // The distributed logic happens inside the server.
 // This client only performs the HTTP call.
 func (c *Client) Put(ctx context.Context, key, value string) (*PutResponse, error) {
-	body, _ := json.Marshal(map[string]string{"value": value})
+	return c.PutTyped(ctx, key, value, "")
+}
+
+// PutTyped is Put, storing contentType (a media type such as
+// "application/json") with the value. Get returns it in ContentType.
+func (c *Client) PutTyped(ctx context.Context, key, value, contentType string) (*PutResponse, error) {
+	body, _ := json.Marshal(struct {
+		Value       string `json:"value"`
+		ContentType string `json:"content_type,omitempty"`
+	}{value, contentType})
+
+	ctx = ensureIdempotencyKey(ctx)
+	resp, err := c.doKey(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return nil, fmt.Errorf("PUT request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return nil, preconditionError(err)
+	}
+
+	var result PutResponse
+	return &result, json.NewDecoder(resp.Body).Decode(&result)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
-		fmt.Sprintf("%s/kv/%s", c.baseURL, key), bytes.NewReader(body))
+// PutStream stores the bytes read from r as key's value, streamed as
+// the request body of PUT .../raw rather than held in memory. size is
+// the value's length, or -1 if unknown (then it is sent chunked).
+//
+// r can only be read once, so unlike Put the request is not retried
+// or sent to another server. With routing it goes to an owner of key.
+func (c *Client) PutStream(ctx context.Context, key string, r io.Reader, size int64, contentType string) (*PutResponse, error) {
+	bases := c.pool.order()
+	if c.router != nil {
+		c.maybeRefresh(ctx)
+		if owners := c.router.owners(key); len(owners) > 0 {
+			bases = owners
+		}
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("no server endpoints configured")
+	}
+	req, err := c.newRequestTo(ctx, bases[0], http.MethodPut, c.keyPath(key)+"/raw", r)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	req.Header.Set("Content-Type", cmp.Or(contentType, "application/octet-stream"))
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.streamingClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("PUT request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if err := checkStatus(resp); err != nil {
-		return nil, err
+		return nil, preconditionError(err)
 	}
-
 	var result PutResponse
 	return &result, json.NewDecoder(resp.Body).Decode(&result)
 }
 
+// GetStream returns key's value as a stream, with its content type
+// (application/octet-stream if none was stored). The caller must close
+// it.
+func (c *Client) GetStream(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	resp, err := c.doKeyAt(withStreaming(ctx), http.MethodGet, key, c.keyPath(key)+"/raw", nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("GET request failed: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, "", ErrNotFound
+	}
+	if err := checkStatus(resp); err != nil {
+		resp.Body.Close()
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
 // Get retrieves value for key.
 //
 // Special case:
@@ -141,13 +327,7 @@ func (c *Client) Put(ctx context.Context, key, value string) (*PutResponse, erro
 //	If server returns 404
 //	We convert it into ErrNotFound
 func (c *Client) Get(ctx context.Context, key string) (*GetResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
-		fmt.Sprintf("%s/kv/%s", c.baseURL, key), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doKey(ctx, http.MethodGet, key, nil)
 	if err != nil {
 		return nil, fmt.Errorf("GET request failed: %w", err)
 	}
@@ -173,19 +353,14 @@ func (c *Client) Get(ctx context.Context, key string) (*GetResponse, error) {
 // Client doesn't care.
 // It just sends DELETE request.
 func (c *Client) Delete(ctx context.Context, key string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
-		fmt.Sprintf("%s/kv/%s", c.baseURL, key), nil)
-	if err != nil {
-		return err
-	}
-
-	resp, err := c.httpClient.Do(req)
+	ctx = ensureIdempotencyKey(ctx)
+	resp, err := c.doKey(ctx, http.MethodDelete, key, nil)
 	if err != nil {
 		return fmt.Errorf("DELETE request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	return checkStatus(resp)
+	return preconditionError(checkStatus(resp))
 }
 
 // JoinCluster registers a node into the cluster.
@@ -195,36 +370,77 @@ func (c *Client) Delete(ctx context.Context, key string) error {
 //   - Hash ring update
 //   - Key redistribution
 func (c *Client) JoinCluster(ctx context.Context, nodeID, address string) error {
-	body, _ := json.Marshal(map[string]string{"id": nodeID, "address": address})
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-		fmt.Sprintf("%s/cluster/join", c.baseURL), bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	return checkStatus(resp)
+	return c.doJSON(ctx, http.MethodPost, "/cluster/join", map[string]string{"id": nodeID, "address": address}, nil)
 }
 
 // LeaveCluster removes a node from the cluster.
+// Data held only by that node is lost; see Decommission.
 func (c *Client) LeaveCluster(ctx context.Context, nodeID string) error {
-	body, _ := json.Marshal(map[string]string{"id": nodeID})
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-		fmt.Sprintf("%s/cluster/leave", c.baseURL), bytes.NewReader(body))
-	if err != nil {
-		return err
+	return c.doJSON(ctx, http.MethodPost, "/cluster/leave", map[string]string{"id": nodeID}, nil)
+}
+
+// Decommission states.
+const (
+	DecommissionDraining  = "draining"
+	DecommissionStreaming = "streaming"
+	DecommissionLeft      = "left"
+	DecommissionFailed    = "failed"
+)
+
+// DecommissionStatus is the progress of a node's decommission.
+type DecommissionStatus struct {
+	Node     string    `json:"node"`
+	State    string    `json:"state"`
+	Keys     int       `json:"keys"`
+	Sent     int       `json:"sent"`
+	Failed   int       `json:"failed"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Decommission starts moving nodeID's data to the nodes that take over
+// its ranges; the node leaves the ring once that is done. It returns
+// at once: poll DecommissionProgress.
+func (c *Client) Decommission(ctx context.Context, nodeID string) (*DecommissionStatus, error) {
+	var st DecommissionStatus
+	if err := c.doJSON(ctx, http.MethodPost, "/cluster/decommission", map[string]string{"id": nodeID}, &st); err != nil {
+		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.httpClient.Do(req)
+	return &st, nil
+}
+
+// DecommissionProgress returns the state of nodeID's decommission.
+// Once the node has left, members no longer know it: 404.
+func (c *Client) DecommissionProgress(ctx context.Context, nodeID string) (*DecommissionStatus, error) {
+	var st DecommissionStatus
+	if err := c.doJSON(ctx, http.MethodGet, "/cluster/decommission/"+url.PathEscape(nodeID), nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// doJSON sends body (if non-nil) as JSON and decodes the response into out
+// (if non-nil). Non-2xx responses become *APIError.
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out any) error {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+
+	resp, err := c.send(ctx, c.pool.order(), method, path, data)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	return checkStatus(resp)
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
 }
 
 // ─── Errors ───────────────────────────────────────────────────────────────────
@@ -0,0 +1,193 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+// ─── Codecs ───────────────────────────────────────────────────────────────────
+//
+// Values are strings. Instead of marshaling structs by hand:
+//
+//	_, err := c.PutJSON(ctx, "user:42", User{Name: "alice"})
+//	var u User
+//	_, err = c.GetJSON(ctx, "user:42", &u)
+//
+// The codec's media type is stored with the value (content_type), so a
+// reader can decode it without knowing how it was written:
+//
+//	_, err := c.PutAs(ctx, "user:42", client.Msgpack, u)
+//	_, err = c.GetAs(ctx, "user:42", &u) // picks Msgpack
+//
+// Text formats (JSON, text/*) are stored as is, so GET and kvcli still
+// show them. Binary ones (msgpack, protobuf) are stored base64-encoded.
+
+// Codec turns Go values into stored values and back.
+type Codec interface {
+	ContentType() string // media type stored with the value
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Built-in codecs. GetAs knows them all; WithCodecs adds more.
+var (
+	JSON    Codec = jsonCodec{}
+	Msgpack Codec = msgpackCodec{}
+	Proto   Codec = protoCodec{} // values must be proto.Message
+)
+
+// ErrContentType is returned when a value cannot be decoded as asked:
+// its content type is not the codec's, or no codec handles it.
+var ErrContentType = errors.New("unsupported content type")
+
+// WithCodecs lets GetAs decode values stored with these codecs' content
+// types. A codec replaces a built-in one of the same type.
+func WithCodecs(codecs ...Codec) Option {
+	return func(c *Client) {
+		for _, cd := range codecs {
+			c.valueCodecs[mediaType(cd.ContentType())] = cd
+		}
+	}
+}
+
+func builtinCodecs() map[string]Codec {
+	m := make(map[string]Codec)
+	for _, cd := range []Codec{JSON, Msgpack, Proto} {
+		m[mediaType(cd.ContentType())] = cd
+	}
+	return m
+}
+
+// PutJSON stores v as JSON.
+func (c *Client) PutJSON(ctx context.Context, key string, v any) (*PutResponse, error) {
+	return c.PutAs(ctx, key, JSON, v)
+}
+
+// GetJSON decodes the JSON value of key into out. Values stored without
+// a content type are assumed to be JSON.
+func (c *Client) GetJSON(ctx context.Context, key string, out any) (*GetResponse, error) {
+	resp, err := c.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentType != "" && mediaType(resp.ContentType) != mediaType(JSON.ContentType()) {
+		return resp, fmt.Errorf("%w: %s is %s, not JSON", ErrContentType, key, resp.ContentType)
+	}
+	return resp, decodeValue(JSON, resp.Value, out)
+}
+
+// PutAs stores v encoded with cd, and cd's content type with it.
+func (c *Client) PutAs(ctx context.Context, key string, cd Codec, v any) (*PutResponse, error) {
+	data, err := cd.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", cd.ContentType(), err)
+	}
+	value := string(data)
+	if !isText(cd.ContentType()) {
+		value = base64.StdEncoding.EncodeToString(data)
+	}
+	return c.PutTyped(ctx, key, value, cd.ContentType())
+}
+
+// GetAs decodes the value of key into out, with the codec of its
+// content type (JSON if it has none).
+func (c *Client) GetAs(ctx context.Context, key string, out any) (*GetResponse, error) {
+	resp, err := c.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	cd := JSON
+	if resp.ContentType != "" {
+		var ok bool
+		if cd, ok = c.valueCodecs[mediaType(resp.ContentType)]; !ok {
+			return resp, fmt.Errorf("%w: %s is %s", ErrContentType, key, resp.ContentType)
+		}
+	}
+	return resp, decodeValue(cd, resp.Value, out)
+}
+
+// decodeValue undoes PutAs.
+func decodeValue(cd Codec, value string, out any) error {
+	data := []byte(value)
+	if !isText(cd.ContentType()) {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(value); err != nil {
+			return fmt.Errorf("decode %s: value is not base64: %w", cd.ContentType(), err)
+		}
+	}
+	if err := cd.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decode %s: %w", cd.ContentType(), err)
+	}
+	return nil
+}
+
+// mediaType strips parameters and case: "Text/Plain; charset=utf-8"
+// is "text/plain".
+func mediaType(ct string) string {
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		return mt
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// isText reports whether values of content type ct are stored as is.
+func isText(ct string) bool {
+	mt := mediaType(ct)
+	return mt == "application/json" || strings.HasSuffix(mt, "+json") || strings.HasPrefix(mt, "text/")
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                { return "application/json" }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// msgpackHandle honors `json` struct tags (after `codec` ones), so one
+// struct works with both JSON and Msgpack.
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true // decode strings into any as string, not []byte
+	return h
+}()
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var b []byte
+	err := codec.NewEncoderBytes(&b, msgpackHandle).Encode(v)
+	return b, err
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	return codec.NewDecoderBytes(data, msgpackHandle).Decode(v)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"bytes"
+	"distributed-kvstore/internal/compress"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// minCompressSize is the smallest request body we bother compressing.
+const minCompressSize = 1024
+
+// WithCompression enables HTTP compression with the given codec
+// ("zstd", "snappy" or "gzip"):
+//
+//   - request bodies >= 1 KiB are sent with Content-Encoding
+//   - responses are requested with Accept-Encoding and decoded transparently
+//
+// Useful when storing large values over slow links.
+func WithCompression(codec string) Option {
+	return func(c *Client) { c.codec = codec }
+}
+
+// compressingTransport is an http.RoundTripper that adds compression
+// on top of another transport, so every SDK call gets it for free.
+type compressingTransport struct {
+	base  http.RoundTripper
+	codec string
+}
+
+func newCompressingTransport(base http.RoundTripper, codec string) *compressingTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &compressingTransport{base: base, codec: codec}
+}
+
+func (t *compressingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	req.Header.Set("Accept-Encoding", t.codec)
+
+	if req.Body != nil && req.ContentLength >= minCompressSize {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		out, err := compress.Encode(t.codec, data)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(out))
+		req.ContentLength = int64(len(out))
+		req.Header.Set("Content-Encoding", t.codec)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if enc := strings.ToLower(resp.Header.Get("Content-Encoding")); enc != "" && compress.Valid(enc) {
+		body, err := compress.NewReader(enc, resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = &readCloser{Reader: body, closers: []io.Closer{body, resp.Body}}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+	}
+	return resp, nil
+}
+
+// readCloser reads from Reader and closes every closer on Close.
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var first error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Conditional requests use the key's clock as an HTTP entity tag:
+//
+//	v, _ := c.Get(ctx, "cfg")
+//	...
+//	v2, err := c.GetIfChanged(ctx, "cfg", v.Clock) // ErrNotModified: keep v
+//	_, err = c.Put(client.IfMatch(ctx, v.Clock), "cfg", edit(v.Value))
+//	if errors.Is(err, client.ErrPreconditionFailed) { /* someone wrote in between: re-read */ }
+//
+// IfMatch works for Put, PutTyped and Delete; IfAbsent makes a Put
+// create the key only if it does not exist yet.
+
+var (
+	// ErrNotModified is returned by GetIfChanged when the key is still at
+	// the given clock.
+	ErrNotModified = errors.New("not modified")
+	// ErrPreconditionFailed is returned by a conditional write whose key
+	// was not in the expected state.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+type conditionCtx struct{}
+
+// condition is one conditional header a request carries.
+type condition struct{ header, value string }
+
+func withCondition(ctx context.Context, header, value string) context.Context {
+	return context.WithValue(ctx, conditionCtx{}, condition{header, value})
+}
+
+// conditionFrom returns the condition stored in ctx, if any.
+func conditionFrom(ctx context.Context) (condition, bool) {
+	c, ok := ctx.Value(conditionCtx{}).(condition)
+	return c, ok
+}
+
+// etag is the entity tag the server gives the version at clock.
+func etag(clock map[string]uint64) string {
+	return `"` + FormatClock(clock) + `"`
+}
+
+// GetIfChanged is Get, but returns ErrNotModified, without transferring
+// the value, if key is still at clock.
+func (c *Client) GetIfChanged(ctx context.Context, key string, clock map[string]uint64) (*GetResponse, error) {
+	ctx = withCondition(ctx, "If-None-Match", etag(clock))
+	resp, err := c.doKey(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("GET request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, ErrNotModified
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	}
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var result GetResponse
+	return &result, json.NewDecoder(resp.Body).Decode(&result)
+}
+
+// IfMatch returns a ctx whose Put/Delete calls write only if the key is
+// still at clock (the Clock of a Get or Put), and fail with
+// ErrPreconditionFailed otherwise.
+func IfMatch(ctx context.Context, clock map[string]uint64) context.Context {
+	return withCondition(ctx, "If-Match", etag(clock))
+}
+
+// IfAbsent returns a ctx whose Put calls write only if the key does not
+// exist (or was deleted), and fail with ErrPreconditionFailed otherwise.
+func IfAbsent(ctx context.Context) context.Context {
+	return withCondition(ctx, "If-None-Match", "*")
+}
+
+// preconditionError turns a 412 into ErrPreconditionFailed.
+func preconditionError(err error) error {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusPreconditionFailed {
+		return ErrPreconditionFailed
+	}
+	return err
+}
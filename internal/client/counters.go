@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ─── Counters ─────────────────────────────────────────────────────────────────
+
+// CounterResponse is the result of Incr and Decr.
+type CounterResponse struct {
+	Namespace string            `json:"namespace"`
+	Key       string            `json:"key"`
+	Value     string            `json:"value"` // Count, as GET returns it
+	Count     int64             `json:"count"`
+	Clock     map[string]uint64 `json:"clock"`
+}
+
+// Incr atomically adds by (at least 1) to the counter at key and
+// returns the new count. A missing key counts from 0; one holding
+// anything but an integer is an error.
+//
+// Unlike Get followed by Put, concurrent increments are never lost:
+// the server serializes them on the key's primary.
+func (c *Client) Incr(ctx context.Context, key string, by int64) (*CounterResponse, error) {
+	return c.count(ctx, key, "incr", by)
+}
+
+// Decr atomically subtracts by (at least 1) from the counter at key.
+func (c *Client) Decr(ctx context.Context, key string, by int64) (*CounterResponse, error) {
+	return c.count(ctx, key, "decr", by)
+}
+
+func (c *Client) count(ctx context.Context, key, op string, by int64) (*CounterResponse, error) {
+	body, _ := json.Marshal(map[string]int64{"by": by})
+
+	// A retried increment must not count twice.
+	ctx = ensureIdempotencyKey(ctx)
+	resp, err := c.doKeyAt(ctx, http.MethodPost, key, c.keyPath(key)+"/"+op, body)
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var result CounterResponse
+	return &result, json.NewDecoder(resp.Body).Decode(&result)
+}
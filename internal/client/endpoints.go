@@ -0,0 +1,272 @@
+package client
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Multiple endpoints and failover
+//
+// With one hardcoded URL the SDK dies with that node. Instead, New accepts
+// a comma-separated list of nodes:
+//
+//	client.New("http://node1:8080,http://node2:8080,http://node3:8080", timeout)
+//
+// Every node can serve every request (non-owners forward), so any
+// endpoint is as good as another — for a first try. A retry of a write
+// that may have reached a node goes back to it (see retry.go). We only
+// need to:
+//
+//  1. Pick one per call (round-robin or least-latency).
+//  2. Notice when one is down and stop sending it traffic.
+//  3. Notice when it comes back.
+//
+// Health checking is passive + lazy: a connection error marks the endpoint
+// down for downCooldown. Once the cooldown expires, a single background
+// GET /health probe decides whether it rejoins the rotation, so real
+// requests never pay for testing a dead node.
+
+// downCooldown is how long a failed endpoint is skipped before it is probed.
+const downCooldown = 5 * time.Second
+
+// Selection decides which endpoint is tried first.
+type Selection int
+
+const (
+	// RoundRobin spreads calls over the healthy endpoints in turn.
+	RoundRobin Selection = iota
+	// LeastLatency prefers the endpoint with the lowest recent latency.
+	LeastLatency
+)
+
+// WithSelection sets how endpoints are picked (default RoundRobin).
+func WithSelection(s Selection) Option {
+	return func(c *Client) { c.pool.selection = s }
+}
+
+// endpoint is one server URL and what we know about its health.
+type endpoint struct {
+	url       string
+	downUntil atomic.Int64 // unix nanos; 0 = healthy
+	latency   atomic.Int64 // moving average in ns; 0 = not measured yet
+	probing   atomic.Bool
+}
+
+func (ep *endpoint) healthy() bool { return ep.downUntil.Load() == 0 }
+
+func (ep *endpoint) markDown() {
+	if ep != nil {
+		ep.downUntil.Store(time.Now().Add(downCooldown).UnixNano())
+	}
+}
+
+func (ep *endpoint) markUp() {
+	if ep != nil {
+		ep.downUntil.Store(0)
+	}
+}
+
+// observe folds one request duration into the moving average (α = 0.2).
+func (ep *endpoint) observe(d time.Duration) {
+	if ep == nil {
+		return
+	}
+	old := ep.latency.Load()
+	if old == 0 {
+		ep.latency.Store(int64(d))
+		return
+	}
+	ep.latency.Store(old - old/5 + int64(d)/5)
+}
+
+// pool is the set of configured endpoints.
+// It is shared by every copy made with Namespace.
+type pool struct {
+	eps       []*endpoint
+	selection Selection
+	next      atomic.Uint64
+	prober    *http.Client
+}
+
+func newPool(urls string) *pool {
+	p := &pool{}
+	for u := range strings.SplitSeq(urls, ",") {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			p.eps = append(p.eps, &endpoint{url: u})
+		}
+	}
+	return p
+}
+
+// lookup returns the endpoint for url, or nil if url is not configured
+// (e.g. a node discovered through ring routing).
+func (p *pool) lookup(url string) *endpoint {
+	for _, ep := range p.eps {
+		if ep.url == url {
+			return ep
+		}
+	}
+	return nil
+}
+
+// order returns endpoint URLs in the order they should be tried:
+// healthy ones first (by the selection policy), then the ones marked
+// down as a last resort. It also kicks off probes of expired endpoints.
+func (p *pool) order() []string {
+	now := time.Now().UnixNano()
+	var healthy, down []*endpoint
+	for _, ep := range p.eps {
+		if ep.healthy() {
+			healthy = append(healthy, ep)
+			continue
+		}
+		if now > ep.downUntil.Load() && ep.probing.CompareAndSwap(false, true) {
+			go p.probe(ep)
+		}
+		down = append(down, ep)
+	}
+
+	switch {
+	case len(healthy) == 0:
+	case p.selection == LeastLatency:
+		slices.SortStableFunc(healthy, func(a, b *endpoint) int {
+			return cmp.Compare(a.latency.Load(), b.latency.Load())
+		})
+	default:
+		start := int(p.next.Add(1) % uint64(len(healthy)))
+		healthy = slices.Concat(healthy[start:], healthy[:start])
+	}
+
+	out := make([]string, 0, len(p.eps))
+	for _, ep := range append(healthy, down...) {
+		out = append(out, ep.url)
+	}
+	return out
+}
+
+// probe checks GET /health on a down endpoint.
+func (p *pool) probe(ep *endpoint) {
+	defer ep.probing.Store(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ep.url+"/health", nil)
+	if err != nil {
+		return
+	}
+	resp, err := p.prober.Do(req)
+	if err != nil {
+		ep.markDown()
+		return
+	}
+	defer resp.Body.Close()
+	// A node replaying its WAL is alive but answers "starting": keep
+	// skipping it until it serves.
+	var health struct {
+		Status string `json:"status"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&health)
+	if resp.StatusCode == http.StatusOK && health.Status != "starting" {
+		ep.markUp()
+	} else {
+		ep.markDown()
+	}
+}
+
+// send performs one logical call, failing over across bases
+// according to the retry policy (see retry.go). body is replayed on
+// every attempt. A call that is not replay-safe anywhere is pinned to
+// the base of the first try that may have reached it.
+func (c *Client) send(ctx context.Context, bases []string, method, path string, body []byte) (*http.Response, error) {
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("no server endpoints configured")
+	}
+	safe, anywhere := replaySafe(ctx, method)
+	hc := c.httpClient
+	if ctx.Value(streamingCtx{}) != nil {
+		hc = c.streamingClient()
+	}
+
+	var (
+		lastErr    error
+		retryAfter time.Duration // asked for by the last 429
+		pinned     string        // the base every further try goes to
+		pinnedTry  int           // tries on pinned so far
+	)
+	for attempt := 0; attempt < c.retry.MaxAttempts; attempt++ {
+		wait := retryAfter
+		if pinned != "" {
+			pinnedTry++
+			wait = max(wait, c.retry.backoff(pinnedTry))
+		} else if round := attempt / len(bases); round > 0 && attempt%len(bases) == 0 {
+			wait = max(wait, c.retry.backoff(round))
+		}
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		base := cmp.Or(pinned, bases[attempt%len(bases)])
+		ep := c.pool.lookup(base)
+
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := c.newRequestTo(ctx, base, method, path, reader)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		resp, err := hc.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			ep.markDown()
+			if c.router != nil {
+				c.router.invalidate() // a node is down: the ring likely changed
+			}
+			if !c.retry.retryError(err, safe) {
+				return nil, err
+			}
+			if !anywhere && reached(err) {
+				pinned = base
+			}
+			lastErr, retryAfter = err, 0
+			continue
+		}
+		ep.observe(time.Since(start))
+		ep.markUp()
+
+		if attempt < c.retry.MaxAttempts-1 && c.retry.retryStatus(resp.StatusCode, safe) {
+			retryAfter = 0
+			if resp.StatusCode == http.StatusTooManyRequests {
+				if retryAfter = parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > c.retry.MaxBackoff {
+					return resp, nil // longer than we are willing to wait
+				}
+			} else if !anywhere {
+				pinned = base // a 5xx may come after the write was applied
+			}
+			lastErr = checkStatus(resp)
+			resp.Body.Close()
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Put and Delete send an Idempotency-Key header, generated once per call,
+// so the automatic retries in send can safely replay them. The key is
+// remembered by the node the call reached, which answers a replay from
+// its cache instead of writing twice; another node would not know it.
+// So once a keyed call may have reached a node, send retries it there
+// only (see retry.go).
+//
+// Callers that retry on their own can pin the key with WithIdempotencyKey.
+
+const idempotencyHeader = "Idempotency-Key"
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns a ctx whose Put/Delete calls use key
+// instead of a freshly generated one.
+//
+//	ctx = client.WithIdempotencyKey(ctx, orderID)
+//	c.Put(ctx, "order:"+orderID, payload) // safe to call again after a timeout
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// ensureIdempotencyKey adds a random key to ctx unless one is set.
+func ensureIdempotencyKey(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(idempotencyKeyCtx{}).(string); ok {
+		return ctx
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return WithIdempotencyKey(ctx, hex.EncodeToString(b))
+}
+
+// idempotencyKey returns the key stored in ctx, if any.
+func idempotencyKey(ctx context.Context) string {
+	k, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	return k
+}
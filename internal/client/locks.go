@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ─── Locks ────────────────────────────────────────────────────────────────────
+
+// Lease is the state of a distributed lock. Locks are cluster-wide, not
+// per namespace.
+type Lease struct {
+	Name    string    `json:"name"`
+	Holder  string    `json:"holder,omitempty"` // "" = free
+	Token   uint64    `json:"token"`            // fencing token: send it to the guarded resource
+	Expires time.Time `json:"expires,omitzero"` // by the server's clock
+	Held    bool      `json:"held,omitempty"`   // set by GetLock
+}
+
+var (
+	// ErrLockHeld means another holder has the lock.
+	ErrLockHeld = errors.New("lock is held by another holder")
+	// ErrLockLost means the lease is no longer the caller's: stop using
+	// what the lock guards.
+	ErrLockLost = errors.New("lock is no longer held with this token")
+)
+
+// LockError is returned when the server refuses a lock operation. It
+// matches ErrLockHeld or ErrLockLost with errors.Is; Lease is the lock's
+// current state.
+type LockError struct {
+	Lease Lease
+	Err   error
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("lock %s: %v (holder %q, token %d)", e.Lease.Name, e.Err, e.Lease.Holder, e.Lease.Token)
+}
+
+func (e *LockError) Unwrap() error { return e.Err }
+
+// AcquireLock takes lock name for holder, for ttl (0 = the server's
+// default). Acquiring a lock the holder already has extends it.
+//
+//	lease, err := c.AcquireLock(ctx, "leader", hostname, 15*time.Second)
+//	if errors.Is(err, client.ErrLockHeld) { ... someone else leads ... }
+//	go func() { lost <- c.KeepLock(ctx, lease, 15*time.Second) }()
+func (c *Client) AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	return c.lockOp(ctx, name, "acquire", lockRequest{Holder: holder, TTLMs: ttl.Milliseconds()}, ErrLockHeld)
+}
+
+// RenewLock extends l to ttl from now (0 = the server's default).
+func (c *Client) RenewLock(ctx context.Context, l *Lease, ttl time.Duration) (*Lease, error) {
+	return c.lockOp(ctx, l.Name, "renew", lockRequest{Holder: l.Holder, Token: l.Token, TTLMs: ttl.Milliseconds()}, ErrLockLost)
+}
+
+// ReleaseLock frees l, so another holder can take it before it expires.
+func (c *Client) ReleaseLock(ctx context.Context, l *Lease) error {
+	_, err := c.lockOp(ctx, l.Name, "release", lockRequest{Holder: l.Holder, Token: l.Token}, ErrLockLost)
+	return err
+}
+
+// GetLock returns the state of lock name, or ErrNotFound if it was
+// never taken.
+func (c *Client) GetLock(ctx context.Context, name string) (*Lease, error) {
+	var l Lease
+	err := c.doJSON(ctx, http.MethodGet, "/locks/"+url.PathEscape(name), nil, &l)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// KeepLock renews l every ttl/3, until ctx is done (it then returns
+// ctx.Err()) or the lease is lost. It returns an error matching
+// ErrLockLost as soon as the server says so, or when renewals have
+// failed for a whole ttl. Run it next to the work the lock guards, and
+// stop that work when it returns.
+func (c *Client) KeepLock(ctx context.Context, l *Lease, ttl time.Duration) error {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(ttl)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		_, err := c.RenewLock(ctx, l, ttl)
+		switch {
+		case err == nil:
+			deadline = time.Now().Add(ttl)
+		case errors.Is(err, ErrLockLost):
+			return err
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case time.Now().After(deadline):
+			return fmt.Errorf("%w: not renewed in time: %w", ErrLockLost, err)
+		}
+	}
+}
+
+// lockRequest is the body of POST /locks/:name/*.
+type lockRequest struct {
+	Holder string `json:"holder"`
+	Token  uint64 `json:"token,omitempty"`
+	TTLMs  int64  `json:"ttl_ms,omitempty"`
+}
+
+// lockOp runs one lock operation. A refusal (409) is a *LockError
+// wrapping refused.
+func (c *Client) lockOp(ctx context.Context, name, op string, req lockRequest, refused error) (*Lease, error) {
+	body, _ := json.Marshal(req)
+	// Replaying any lock call does no harm: acquiring what the holder
+	// has extends it, and releasing twice is fine.
+	ctx = withReplaySafe(ctx)
+	resp, err := c.send(ctx, c.pool.order(), http.MethodPost, "/locks/"+url.PathEscape(name)+"/"+op, body)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s request failed: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		var out struct {
+			Lease Lease `json:"lease"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return nil, &LockError{Lease: out.Lease, Err: refused}
+	}
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var l Lease
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
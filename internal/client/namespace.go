@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultNamespace is the namespace used when none is chosen.
+const DefaultNamespace = "default"
+
+// Namespace returns a copy of the client bound to another namespace.
+//
+// The copy shares the underlying HTTP connection pool, so this is cheap:
+//
+//	users := c.Namespace("users")
+//	users.Put(ctx, "42", "alice")
+func (c *Client) Namespace(namespace string) *Client {
+	cp := *c
+	cp.namespace = namespace
+	return &cp
+}
+
+// keyPath builds /kv/<namespace>/<key>.
+func (c *Client) keyPath(key string) string {
+	return "/kv/" + url.PathEscape(c.namespace) + "/" + url.PathEscape(key)
+}
+
+// NamespaceConfig is the settable part of a namespace.
+type NamespaceConfig struct {
+	MaxKeys     int     `json:"max_keys,omitempty"`    // 0 = unlimited
+	MaxBytes    int64   `json:"max_bytes,omitempty"`   // estimated data size per node; 0 = unlimited
+	RateLimit   float64 `json:"rate_limit,omitempty"`  // requests/sec per node; 0 = unlimited
+	Compression string  `json:"compression,omitempty"` // "", "none", "zstd", "snappy"
+	Replication string  `json:"replication,omitempty"` // "", "sync", "async"
+	Versions    int     `json:"versions,omitempty"`    // replaced values kept per key (see versions.go)
+
+	// Defaults for the namespace's writes and reads; "" / 0 = the node's.
+	TTLSeconds      int64  `json:"ttl_seconds,omitempty"`      // keys expire this long after each write; 0 = never
+	ReadPolicy      string `json:"read_policy,omitempty"`      // ReadRing, ReadNearest or ReadOne
+	Tiebreak        string `json:"tiebreak,omitempty"`         // "time" or "node-id", for concurrent writes
+	DeleteConflicts string `json:"delete_conflicts,omitempty"` // "tiebreak", "delete-wins" or "write-wins"
+}
+
+// NamespaceInfo describes a namespace and its usage on the answering node.
+type NamespaceInfo struct {
+	Name string `json:"name"`
+	NamespaceConfig
+	CreatedAt time.Time `json:"created_at"`
+	Keys      int       `json:"keys"`
+	Bytes     int64     `json:"bytes"`
+}
+
+// Keys lists every live key in the client's namespace.
+func (c *Client) Keys(ctx context.Context) ([]string, error) {
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/kv/"+c.namespace, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Keys, nil
+}
+
+// KeyPage is one page of a key listing.
+type KeyPage struct {
+	Keys       []string `json:"keys"`
+	NextCursor string   `json:"next_cursor,omitempty"` // "" = last page
+}
+
+// KeysPage lists, in order, up to limit live keys of the client's
+// namespace that start with prefix, resuming after cursor ("" = from
+// the start). limit 0 uses the server's default page size.
+func (c *Client) KeysPage(ctx context.Context, prefix, cursor string, limit int) (*KeyPage, error) {
+	var page KeyPage
+	if err := c.doJSON(ctx, http.MethodGet, "/kv?"+c.listQuery(prefix, cursor, limit).Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// ScanKeys calls fn, in order, for every live key of the client's
+// namespace that starts with prefix. The server streams the keys, so
+// neither side holds the whole list. An error from fn stops the scan
+// and is returned.
+func (c *Client) ScanKeys(ctx context.Context, prefix string, fn func(key string) error) error {
+	return c.ScanKeysWhere(ctx, prefix, KeyFilter{}, fn)
+}
+
+// KeyFilter narrows a key scan to the keys whose value matches. The
+// servers check it as they walk their keys; every condition given must
+// hold.
+type KeyFilter struct {
+	Contains     string    // the value contains this
+	Field        string    // the value is JSON with this dotted path...
+	Equals       string    // ...equal to this: strings unquoted, others as JSON ("" = any)
+	UpdatedAfter time.Time // written after this
+}
+
+// ScanKeysWhere is ScanKeys for the keys whose value passes f.
+func (c *Client) ScanKeysWhere(ctx context.Context, prefix string, f KeyFilter, fn func(key string) error) error {
+	q := c.listQuery(prefix, "", 0)
+	q.Set("stream", "true")
+	if f.Contains != "" {
+		q.Set("contains", f.Contains)
+	}
+	if f.Field != "" {
+		q.Set("field", f.Field)
+	}
+	if f.Equals != "" {
+		q.Set("equals", f.Equals)
+	}
+	if !f.UpdatedAfter.IsZero() {
+		q.Set("updated_after", f.UpdatedAfter.Format(time.RFC3339Nano))
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, "/kv?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.streamingClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("list keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var line struct {
+			Key   string `json:"key"`
+			Error string `json:"error"`
+		}
+		switch err := dec.Decode(&line); {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return fmt.Errorf("list keys: %w", err)
+		case line.Error != "":
+			return fmt.Errorf("list keys: %s", line.Error)
+		}
+		if err := fn(line.Key); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) listQuery(prefix, cursor string, limit int) url.Values {
+	q := url.Values{"namespace": {c.namespace}}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	return q
+}
+
+// CreateNamespace creates (or updates) a namespace.
+func (c *Client) CreateNamespace(ctx context.Context, name string, cfg NamespaceConfig) error {
+	return c.doJSON(ctx, http.MethodPut, "/namespaces/"+name, cfg, nil)
+}
+
+// DeleteNamespace deletes an empty namespace.
+func (c *Client) DeleteNamespace(ctx context.Context, name string) error {
+	return c.doJSON(ctx, http.MethodDelete, "/namespaces/"+name, nil, nil)
+}
+
+// ListNamespaces returns every namespace.
+func (c *Client) ListNamespaces(ctx context.Context) ([]NamespaceInfo, error) {
+	var result struct {
+		Namespaces []NamespaceInfo `json:"namespaces"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/namespaces", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Namespaces, nil
+}
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ─── Pipelines ────────────────────────────────────────────────────────────────
+
+// maxBatchOps is the server's limit on ops per POST /batch; longer
+// pipelines are sent in several.
+const maxBatchOps = 1000
+
+// Pipeline queues operations and sends them in one request (POST /batch),
+// to save a round trip per key in bulk work:
+//
+//	p := c.Pipeline()
+//	p.Put("a", "1").Put("b", "2").Get("c").Delete("d")
+//	results, err := p.Exec(ctx)
+//	for _, r := range results {
+//		if r.Err != nil { ... }
+//	}
+//
+// The operations are independent, not a transaction: each succeeds or
+// fails alone (see Txn for all-or-nothing). Ops on the same key run in
+// the order queued. A Pipeline is not safe for concurrent use.
+type Pipeline struct {
+	c   *Client
+	ops []batchOp
+}
+
+// batchOp is one op of POST /batch.
+type batchOp struct {
+	Op          string `json:"op"`
+	Namespace   string `json:"namespace"`
+	Key         string `json:"key"`
+	Value       string `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// BatchResult is the outcome of one queued op, in queue order.
+type BatchResult struct {
+	Op          string            `json:"-"` // get, put or delete
+	Key         string            `json:"-"`
+	Status      int               `json:"status"` // what the op's own request would have returned
+	Value       string            `json:"value"`  // get
+	Clock       map[string]uint64 `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"` // get
+	ContentType string            `json:"content_type"`
+	Replication string            `json:"replication"` // "async" if not yet replicated
+	Error       string            `json:"error"`
+
+	// Err is nil on success, ErrNotFound for a missing key, or an
+	// *APIError.
+	Err error `json:"-"`
+}
+
+// Pipeline returns an empty pipeline on c's namespace.
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// Put queues a write.
+func (p *Pipeline) Put(key, value string) *Pipeline {
+	return p.PutTyped(key, value, "")
+}
+
+// PutTyped queues a write with a content type (see Client.PutTyped).
+func (p *Pipeline) PutTyped(key, value, contentType string) *Pipeline {
+	return p.add(batchOp{Op: "put", Key: key, Value: value, ContentType: contentType})
+}
+
+// Get queues a read.
+func (p *Pipeline) Get(key string) *Pipeline {
+	return p.add(batchOp{Op: "get", Key: key})
+}
+
+// Delete queues a delete.
+func (p *Pipeline) Delete(key string) *Pipeline {
+	return p.add(batchOp{Op: "delete", Key: key})
+}
+
+// Len returns the number of queued operations.
+func (p *Pipeline) Len() int { return len(p.ops) }
+
+func (p *Pipeline) add(op batchOp) *Pipeline {
+	op.Namespace = p.c.namespace
+	p.ops = append(p.ops, op)
+	return p
+}
+
+// Exec sends the queued operations and empties the pipeline. It returns
+// one result per op, in order; the error is for the request as a whole
+// (then results holds the chunks that were sent before it).
+//
+// Each request carries an Idempotency-Key, so retries never apply a
+// batch twice.
+func (p *Pipeline) Exec(ctx context.Context) ([]BatchResult, error) {
+	ops := p.ops
+	p.ops = nil
+
+	results := make([]BatchResult, 0, len(ops))
+	for start := 0; start < len(ops); start += maxBatchOps {
+		chunk := ops[start:min(start+maxBatchOps, len(ops))]
+		out, err := p.c.batch(chunkContext(ctx, start/maxBatchOps), chunk)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, out...)
+	}
+	return results, nil
+}
+
+// chunkContext gives chunk n of a pipeline its own Idempotency-Key: a
+// fresh one, or the caller's pinned one with the chunk number appended.
+func chunkContext(ctx context.Context, n int) context.Context {
+	if k := idempotencyKey(ctx); k != "" && n > 0 {
+		return WithIdempotencyKey(ctx, fmt.Sprintf("%s.%d", k, n))
+	}
+	return ensureIdempotencyKey(ctx)
+}
+
+// batch sends one POST /batch.
+func (c *Client) batch(ctx context.Context, ops []batchOp) ([]BatchResult, error) {
+	body, _ := json.Marshal(map[string]any{"ops": ops})
+	resp, err := c.send(ctx, c.pool.order(), http.MethodPost, "/batch", body)
+	if err != nil {
+		return nil, fmt.Errorf("batch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Results []BatchResult `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if len(out.Results) != len(ops) {
+		return nil, fmt.Errorf("batch: %d results for %d ops", len(out.Results), len(ops))
+	}
+	for i := range out.Results {
+		r := &out.Results[i]
+		r.Op, r.Key = ops[i].Op, ops[i].Key
+		switch {
+		case r.Status == http.StatusNotFound && r.Op == "get":
+			r.Err = ErrNotFound
+		case r.Status >= 300:
+			r.Err = &APIError{Status: r.Status, Message: r.Error}
+		}
+	}
+	return out.Results, nil
+}
+
+// MultiGet reads keys in c's namespace with POST /kv/mget: one request,
+// the server's quorum reads running in parallel. It returns one result
+// per key, in order; a missing key has Err ErrNotFound. More than the
+// server's limit of keys are sent in several requests.
+func (c *Client) MultiGet(ctx context.Context, keys ...string) ([]BatchResult, error) {
+	ctx = withReplaySafe(ctx) // a read
+	results := make([]BatchResult, 0, len(keys))
+	for start := 0; start < len(keys); start += maxBatchOps {
+		chunk := keys[start:min(start+maxBatchOps, len(keys))]
+		body, _ := json.Marshal(map[string]any{"namespace": c.namespace, "keys": chunk})
+		resp, err := c.send(ctx, c.pool.order(), http.MethodPost, "/kv/mget", body)
+		if err != nil {
+			return results, fmt.Errorf("mget request failed: %w", err)
+		}
+		var out struct {
+			Results []BatchResult `json:"results"`
+		}
+		err = checkStatus(resp)
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&out)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return results, err
+		}
+		if len(out.Results) != len(chunk) {
+			return results, fmt.Errorf("mget: %d results for %d keys", len(out.Results), len(chunk))
+		}
+		for i := range out.Results {
+			r := &out.Results[i]
+			r.Op, r.Key = "get", chunk[i]
+			switch {
+			case r.Status == http.StatusNotFound:
+				r.Err = ErrNotFound
+			case r.Status >= 300:
+				r.Err = &APIError{Status: r.Status, Message: r.Error}
+			}
+		}
+		results = append(results, out.Results...)
+	}
+	return results, nil
+}
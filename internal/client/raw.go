@@ -2,7 +2,6 @@ package client
 
 import (
 	"context"
-	"fmt"
 	"io"
 	"net/http"
 )
@@ -31,13 +30,7 @@ import (
 // It keeps the client reusable without needing
 // to constantly add new structs.
 func (c *Client) GetRaw(ctx context.Context, path string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
-		fmt.Sprintf("%s%s", c.baseURL, path), nil)
-	if err != nil {
-		return "", err
-	}
-
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.send(ctx, c.pool.order(), http.MethodGet, path, nil)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,34 @@
+package client
+
+import "context"
+
+// Quorum reads normally ask every replica. The nearest policy asks only
+// the R replicas closest to the coordinator (itself, then its zone):
+// fewer cross-zone requests, same answer. The one policy takes the
+// first answer of a single replica — the coordinator's own copy if it
+// has one — and may return a stale value.
+//
+//	ctx = client.WithReadPolicy(ctx, client.ReadNearest)
+//	c.Get(ctx, "user:42")
+
+const readPolicyHeader = "X-Read-Policy"
+
+// Read policies for WithReadPolicy.
+const (
+	ReadRing    = "ring"
+	ReadNearest = "nearest"
+	ReadOne     = "one"
+)
+
+type readPolicyCtx struct{}
+
+// WithReadPolicy returns a ctx whose Get calls use policy p.
+func WithReadPolicy(ctx context.Context, p string) context.Context {
+	return context.WithValue(ctx, readPolicyCtx{}, p)
+}
+
+// readPolicy returns the policy stored in ctx, if any.
+func readPolicy(ctx context.Context) string {
+	p, _ := ctx.Value(readPolicyCtx{}).(string)
+	return p
+}
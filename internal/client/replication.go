@@ -0,0 +1,33 @@
+package client
+
+import "context"
+
+// Writes wait for a write quorum unless asked otherwise. Async writes are
+// acknowledged once the coordinator has written locally; replicas catch
+// up in the background, so a read right after may still see old data.
+//
+//	ctx = client.WithReplication(ctx, client.ReplicationAsync)
+//	c.Put(ctx, "metrics:cpu", "0.7")
+//
+// A namespace can also default to async (NamespaceConfig.Replication).
+
+const replicationHeader = "X-Replication"
+
+// Replication modes for WithReplication and NamespaceConfig.Replication.
+const (
+	ReplicationSync  = "sync"
+	ReplicationAsync = "async"
+)
+
+type replicationCtx struct{}
+
+// WithReplication returns a ctx whose Put/Delete calls use mode.
+func WithReplication(ctx context.Context, mode string) context.Context {
+	return context.WithValue(ctx, replicationCtx{}, mode)
+}
+
+// replicationMode returns the mode stored in ctx, if any.
+func replicationMode(ctx context.Context) string {
+	m, _ := ctx.Value(replicationCtx{}).(string)
+	return m
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ─── Retries ──────────────────────────────────────────────────────────────────
+//
+// The servers retry among themselves (replication, hints), but a
+// transient failure between the client and its node — a restart, a
+// shed request, a rate limit — would otherwise surface to the caller. So
+// send retries a call according to a RetryPolicy, moving to the next
+// endpoint on every try (see endpoints.go).
+//
+// Retrying must not turn one write into two. A call is replay-safe when
+// the server would do the same thing twice: GET/HEAD, POSTs idempotent by
+// design (locks), and anything sent with an Idempotency-Key (Put, Delete,
+// Txn and the counters always are, see idempotency.go). A PUT or DELETE
+// is not safe by its method alone: in between, another client's write
+// changes what it overwrites or deletes.
+//
+// An Idempotency-Key is remembered by the node that got the call, not by
+// the cluster: any owner may coordinate a write, so the same key sent to
+// another node applies it again. Once a keyed call may have reached its
+// node, its retries stay on that node. Other calls are retried only when
+// they cannot have reached the server: a failed dial, or a 429.
+
+// RetryOn is a set of failure classes a call is retried on.
+type RetryOn uint8
+
+const (
+	RetryConnErrors   RetryOn = 1 << iota // no connection, or it broke before a response
+	RetryTimeouts                         // an attempt hit the client's timeout
+	RetryUnavailable                      // 502, 503, 504
+	RetryServerErrors                     // any other 5xx
+	RetryThrottled                        // 429, after its Retry-After
+
+	// DefaultRetryOn leaves out RetryServerErrors: a 500 is usually a
+	// bug that fails the same way again.
+	DefaultRetryOn = RetryConnErrors | RetryTimeouts | RetryUnavailable | RetryThrottled
+)
+
+// RetryPolicy controls retries and failover.
+//
+// Each try goes to the next endpoint, except for the retries of a keyed
+// write that may have reached its node, which go to that node again.
+// Once every endpoint was tried (or for each retry on the same node),
+// further tries wait Backoff, doubled each round up to MaxBackoff, minus
+// a random fraction (up to Jitter) so that clients failing together do
+// not retry in lockstep. A 429 waits at least its Retry-After; one that
+// asks for more than MaxBackoff is returned as is.
+type RetryPolicy struct {
+	MaxAttempts int           // total tries per call (default 3)
+	Backoff     time.Duration // wait before the second round (default 100ms)
+	MaxBackoff  time.Duration // longest single wait (0 = 5s)
+	Jitter      float64       // 0..1; 0 = always wait the full backoff
+	RetryOn     RetryOn       // 0 = DefaultRetryOn
+	RetryUnsafe bool          // retry calls that are not replay-safe after any failure too
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+	Jitter:      0.5,
+	RetryOn:     DefaultRetryOn,
+}
+
+// WithRetryPolicy overrides the retry policy.
+//
+//	client.WithRetryPolicy(client.RetryPolicy{
+//		MaxAttempts: 5, Backoff: 200 * time.Millisecond, Jitter: 0.5,
+//		RetryOn: client.DefaultRetryOn | client.RetryServerErrors,
+//	})
+//
+// MaxAttempts 1 disables retries.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		if p.MaxAttempts <= 0 {
+			p.MaxAttempts = 1
+		}
+		if p.MaxBackoff <= 0 {
+			p.MaxBackoff = defaultRetryPolicy.MaxBackoff
+		}
+		p.Jitter = min(max(p.Jitter, 0), 1)
+		if p.RetryOn == 0 {
+			p.RetryOn = DefaultRetryOn
+		}
+		c.retry = p
+	}
+}
+
+// backoff returns the wait before round (1 = the second round).
+func (p RetryPolicy) backoff(round int) time.Duration {
+	d := p.MaxBackoff
+	if shift := round - 1; shift < 32 && p.Backoff<<shift < p.MaxBackoff {
+		d = p.Backoff << shift
+	}
+	return d - time.Duration(p.Jitter*rand.Float64()*float64(d))
+}
+
+// retryError reports whether a call that failed with err (no response)
+// should be tried again.
+func (p RetryPolicy) retryError(err error, safe bool) bool {
+	if !reached(err) {
+		return p.RetryOn&RetryConnErrors != 0 // nothing was sent
+	}
+	if !safe && !p.RetryUnsafe {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return p.RetryOn&RetryTimeouts != 0
+	}
+	return p.RetryOn&RetryConnErrors != 0
+}
+
+// retryStatus reports whether a call answered with status should be
+// tried again.
+func (p RetryPolicy) retryStatus(status int, safe bool) bool {
+	if status == http.StatusTooManyRequests {
+		return p.RetryOn&RetryThrottled != 0 // refused before any work
+	}
+	if status < 500 || !safe && !p.RetryUnsafe {
+		return false
+	}
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return p.RetryOn&RetryUnavailable != 0
+	}
+	return p.RetryOn&RetryServerErrors != 0
+}
+
+type replaySafeCtx struct{}
+
+// withReplaySafe marks calls made with ctx as replay-safe, for POST
+// endpoints that are idempotent by design (e.g. locks).
+func withReplaySafe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replaySafeCtx{}, true)
+}
+
+// replaySafe reports whether a method call with ctx can be sent twice,
+// and whether to any node (anywhere) or only to the one that saw it
+// first, which remembers its Idempotency-Key.
+func replaySafe(ctx context.Context, method string) (safe, anywhere bool) {
+	if method == http.MethodGet || method == http.MethodHead || ctx.Value(replaySafeCtx{}) != nil {
+		return true, true
+	}
+	return idempotencyKey(ctx) != "", false
+}
+
+// reached reports whether a try that failed with err (no response) may
+// have reached the server.
+func reached(err error) bool {
+	var opErr *net.OpError
+	return !errors.As(err, &opErr) || opErr.Op != "dial"
+}
+
+// parseRetryAfter reads a Retry-After in seconds; 0 if absent or an
+// HTTP date (which our servers never send).
+func parseRetryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// node counts the requests it gets. The first request of all gets a
+// 503 (failed is shared); the rest ok.
+type node struct {
+	failed *atomic.Bool
+	hits   int
+	keys   []string // Idempotency-Key of each request
+	failer bool     // this node answered the 503
+}
+
+func (n *node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.hits++
+	n.keys = append(n.keys, r.Header.Get(idempotencyHeader))
+	if n.failed.CompareAndSwap(false, true) {
+		n.failer = true
+		http.Error(w, `{"error":"unavailable"}`, http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"key":"k","value":"v"}`))
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name   string
+		call   func(context.Context, *Client) error
+		pinned bool // retried on the node that answered 503
+	}{
+		{"keyed write pinned", func(ctx context.Context, c *Client) error {
+			_, err := c.Put(ctx, "k", "v")
+			return err
+		}, true},
+		{"read fails over", func(ctx context.Context, c *Client) error {
+			_, err := c.Get(ctx, "k")
+			return err
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failed atomic.Bool
+			nodes := [2]*node{{failed: &failed}, {failed: &failed}}
+			urls := ""
+			for _, n := range nodes {
+				srv := httptest.NewServer(n)
+				defer srv.Close()
+				urls += srv.URL + ","
+			}
+			c := New(urls, time.Second, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}))
+			if err := tt.call(context.Background(), c); err != nil {
+				t.Fatal(err)
+			}
+
+			first, other := nodes[0], nodes[1]
+			if other.failer {
+				first, other = other, first
+			}
+			if tt.pinned {
+				if first.hits != 2 || other.hits != 0 {
+					t.Fatalf("hits = %d on the node that failed, %d on the other; want 2, 0", first.hits, other.hits)
+				}
+				if first.keys[0] == "" || first.keys[0] != first.keys[1] {
+					t.Errorf("Idempotency-Key per try = %q", first.keys)
+				}
+				return
+			}
+			if first.hits != 1 || other.hits != 1 {
+				t.Errorf("hits = %d on the node that failed, %d on the other; want 1, 1", first.hits, other.hits)
+			}
+		})
+	}
+}
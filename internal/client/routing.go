@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"distributed-kvstore/internal/cluster"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Ring-aware routing ("smart client")
+//
+// A plain client sends everything to one node, which forwards requests
+// for keys it does not own: one extra hop per operation.
+//
+// With WithRingRouting the client downloads the topology from
+// GET /cluster/status, builds the SAME consistent-hash ring the nodes use,
+// and sends each key straight to one of its owners.
+//
+// The topology is refreshed in the background every interval (and right
+// after a node fails). If the ring is unknown or every owner is down
+// we fall back to the configured base URL, so a stale ring only costs a
+// hop — the server still forwards to the right owner.
+
+const defaultRefreshInterval = 30 * time.Second
+
+// WithRingRouting enables ring-aware routing, refreshing the topology
+// every refresh (0 = 30s).
+func WithRingRouting(refresh time.Duration) Option {
+	return func(c *Client) {
+		if refresh <= 0 {
+			refresh = defaultRefreshInterval
+		}
+		c.router = &router{refresh: refresh}
+	}
+}
+
+// ClusterStatus is the topology returned by GET /cluster/status.
+type ClusterStatus struct {
+	Self   string `json:"self"`
+	Vnodes int    `json:"vnodes"`
+	N      int    `json:"n"`
+	W      int    `json:"w"`
+	R      int    `json:"r"`
+	Nodes  []struct {
+		ID       string `json:"id"`
+		Address  string `json:"address"`
+		IsAlive  bool   `json:"is_alive"`
+		Weight   int    `json:"weight"`
+		Zone     string `json:"zone"`
+		Draining bool   `json:"draining"`
+	} `json:"nodes"`
+	Versions        []NodeVersion `json:"versions"`
+	ClusterProtocol int           `json:"cluster_protocol"` // lowest protocol among Versions
+}
+
+// NodeVersion is a node's build and wire protocol, as the answering node
+// last heard them. Protocol 0 = not heard from.
+type NodeVersion struct {
+	Node     string `json:"node"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+}
+
+// ClusterStatus fetches the cluster topology from the server.
+func (c *Client) ClusterStatus(ctx context.Context) (*ClusterStatus, error) {
+	var st ClusterStatus
+	if err := c.doJSON(ctx, http.MethodGet, "/cluster/status", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// router holds the client's view of the ring.
+// It is shared by every copy made with Namespace.
+type router struct {
+	refresh    time.Duration
+	refreshing atomic.Bool
+
+	mu       sync.RWMutex
+	ring     *cluster.Ring
+	addrs    map[string]string // nodeID → base URL
+	draining map[string]bool   // being decommissioned: not a coordinator
+	n        int
+	fetched  time.Time
+}
+
+// owners returns base URLs of key's replicas, best first,
+// or nil if the ring is not known yet.
+func (rt *router) owners(key string) []string {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	if rt.ring == nil {
+		return nil
+	}
+	var out []string
+	for _, id := range rt.ring.GetNodes(key, rt.n) {
+		if u, ok := rt.addrs[id]; ok && !rt.draining[id] {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+func (rt *router) stale() bool {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+	return rt.ring == nil || time.Since(rt.fetched) > rt.refresh
+}
+
+// invalidate forces a refresh on the next request.
+func (rt *router) invalidate() {
+	rt.mu.Lock()
+	rt.fetched = time.Time{}
+	rt.mu.Unlock()
+}
+
+// update replaces the ring with st, which was fetched from seed.
+// Node URLs reuse the seed's scheme (http or https).
+func (rt *router) update(st *ClusterStatus, seed *url.URL) {
+	ring := cluster.NewRing(st.Vnodes)
+	addrs := make(map[string]string, len(st.Nodes))
+	draining := make(map[string]bool)
+	for _, n := range st.Nodes {
+		if !n.IsAlive {
+			continue
+		}
+		addr := n.Address
+		// A node lists itself by its listen address (":8080");
+		// we reached it through the seed host, so reuse that.
+		if host, port, err := net.SplitHostPort(addr); err == nil && host == "" && n.ID == st.Self {
+			addr = net.JoinHostPort(seed.Hostname(), port)
+		}
+		ring.AddNode(n.ID, n.Weight)
+		addrs[n.ID] = seed.Scheme + "://" + addr
+		if n.Draining {
+			draining[n.ID] = true
+		}
+	}
+
+	rt.mu.Lock()
+	rt.ring, rt.addrs, rt.draining, rt.n, rt.fetched = ring, addrs, draining, st.N, time.Now()
+	rt.mu.Unlock()
+}
+
+// refreshTopology reloads the ring from any reachable endpoint.
+func (c *Client) refreshTopology(ctx context.Context) error {
+	resp, err := c.send(ctx, c.pool.order(), http.MethodGet, "/cluster/status", nil)
+	if err != nil {
+		return fmt.Errorf("fetch cluster status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return fmt.Errorf("fetch cluster status: %w", err)
+	}
+	var st ClusterStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		return err
+	}
+	// resp.Request.URL tells us which endpoint answered: the seed.
+	c.router.update(&st, resp.Request.URL)
+	return nil
+}
+
+// maybeRefresh loads the ring synchronously the first time,
+// and in the background once it gets stale.
+func (c *Client) maybeRefresh(ctx context.Context) {
+	rt := c.router
+	if !rt.stale() || !rt.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+
+	rt.mu.RLock()
+	first := rt.ring == nil
+	rt.mu.RUnlock()
+
+	if first {
+		defer rt.refreshing.Store(false)
+		_ = c.refreshTopology(ctx) // on failure we just use the base URL
+		return
+	}
+	go func() {
+		defer rt.refreshing.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), c.httpClient.Timeout)
+		defer cancel()
+		_ = c.refreshTopology(ctx)
+	}()
+}
+
+// doKey sends a request for key, to its owners first when routing is on,
+// then to the configured endpoints.
+func (c *Client) doKey(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	return c.doKeyAt(ctx, method, key, c.keyPath(key), body)
+}
+
+// doKeyAt is doKey for another path of key, such as its counter.
+func (c *Client) doKeyAt(ctx context.Context, method, key, path string, body []byte) (*http.Response, error) {
+	bases := c.pool.order()
+	if c.router != nil {
+		c.maybeRefresh(ctx)
+		if owners := c.router.owners(key); len(owners) > 0 {
+			bases = dedup(append(owners, bases...))
+		}
+	}
+	sess := sessionFrom(ctx)
+	if sess == nil {
+		return c.send(ctx, bases, method, path, body)
+	}
+	// Session tokens are per key (see session.go).
+	kp := c.keyPath(key)
+	if t := sess.token(kp); t != "" {
+		ctx = withSessionToken(ctx, t)
+	}
+	resp, err := c.send(ctx, bases, method, path, body)
+	if err == nil {
+		sess.observe(kp, resp)
+	}
+	return resp, err
+}
+
+// dedup removes repeated URLs, keeping the first occurrence.
+func dedup(urls []string) []string {
+	seen := make(map[string]bool, len(urls))
+	out := urls[:0]
+	for _, u := range urls {
+		if !seen[u] {
+			seen[u] = true
+			out = append(out, u)
+		}
+	}
+	return out
+}
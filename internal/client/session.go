@@ -0,0 +1,81 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// A Session makes a client's reads return nothing older than what it
+// wrote or read before, even through async writes, R=1 reads or
+// failover to another node:
+//
+//	sess := client.NewSession()
+//	ctx = client.WithSession(ctx, sess)
+//	c.Put(ctx, "user:42", "v2")
+//	c.Get(ctx, "user:42") // "v2" or newer, never "v1"
+//
+// The server answers every write and read with a token for the version
+// (X-Session); the session keeps the latest one per key and sends it
+// with the next request for that key. A read no replica can satisfy in
+// time fails with a 503, and is retried on the next endpoint.
+//
+// A Session is safe for concurrent use. It holds one token per key it
+// has touched; start a new one to forget them.
+
+const sessionHeader = "X-Session"
+
+// Session holds per-key session tokens.
+type Session struct {
+	mu     sync.Mutex
+	tokens map[string]string // key path → token
+}
+
+// NewSession returns an empty session.
+func NewSession() *Session {
+	return &Session{tokens: make(map[string]string)}
+}
+
+type sessionCtx struct{}
+
+// WithSession returns a ctx whose Put, Get, Delete and counter calls
+// take part in s.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionCtx{}, s)
+}
+
+// sessionFrom returns the session in ctx, or nil.
+func sessionFrom(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionCtx{}).(*Session)
+	return s
+}
+
+func (s *Session) token(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokens[key]
+}
+
+// observe keeps the token resp carries for key, if any.
+func (s *Session) observe(key string, resp *http.Response) {
+	t := resp.Header.Get(sessionHeader)
+	if t == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = t
+}
+
+type sessionTokenCtx struct{}
+
+// withSessionToken returns a ctx whose requests send token.
+func withSessionToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, sessionTokenCtx{}, token)
+}
+
+// sessionToken returns the token to send with a request from ctx.
+func sessionToken(ctx context.Context) string {
+	t, _ := ctx.Value(sessionTokenCtx{}).(string)
+	return t
+}
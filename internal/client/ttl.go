@@ -0,0 +1,30 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Keys live until deleted, or for their namespace's TTL
+// (NamespaceConfig.TTLSeconds). A write can set its own:
+//
+//	ctx = client.WithTTL(ctx, 30*time.Minute)
+//	c.Put(ctx, "session:9f2", token)
+//
+// WithTTL(ctx, 0) writes a key that never expires, whatever the
+// namespace says. Get reports when a key expires in ExpiresAt.
+
+const ttlHeader = "X-TTL"
+
+type ttlCtx struct{}
+
+// WithTTL returns a ctx whose Put calls expire after ttl (0 = never).
+func WithTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, ttlCtx{}, ttl)
+}
+
+// ttlFrom returns the TTL stored in ctx, if any.
+func ttlFrom(ctx context.Context) (time.Duration, bool) {
+	ttl, ok := ctx.Value(ttlCtx{}).(time.Duration)
+	return ttl, ok
+}
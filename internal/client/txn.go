@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// TxnCheck is one condition of a transaction; build it with IfExists,
+// IfMissing, IfValue or IfClock.
+type TxnCheck struct {
+	Key    string            `json:"key"`
+	Exists *bool             `json:"exists,omitempty"`
+	Value  *string           `json:"value,omitempty"`
+	Clock  map[string]uint64 `json:"clock,omitempty"`
+}
+
+// IfExists holds if key is live.
+func IfExists(key string) TxnCheck {
+	t := true
+	return TxnCheck{Key: key, Exists: &t}
+}
+
+// IfMissing holds if key is absent or deleted.
+func IfMissing(key string) TxnCheck {
+	f := false
+	return TxnCheck{Key: key, Exists: &f}
+}
+
+// IfValue holds if key is live and holds exactly value.
+func IfValue(key, value string) TxnCheck { return TxnCheck{Key: key, Value: &value} }
+
+// IfClock holds if key is still at the version a Get returned.
+func IfClock(key string, clock map[string]uint64) TxnCheck { return TxnCheck{Key: key, Clock: clock} }
+
+// TxnOp is one write of a transaction; build it with PutOp or DeleteOp.
+type TxnOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// PutOp writes value to key.
+func PutOp(key, value string) TxnOp { return TxnOp{Op: "put", Key: key, Value: value} }
+
+// DeleteOp deletes key.
+func DeleteOp(key string) TxnOp { return TxnOp{Op: "delete", Key: key} }
+
+// Txn is a transaction on keys of the client's namespace. Keys on
+// different replicas are committed in two phases, which needs every one
+// of their replicas to be up.
+type Txn struct {
+	Checks []TxnCheck `json:"checks,omitempty"`
+	Ops    []TxnOp    `json:"ops"`
+}
+
+// TxnResult is the outcome of a transaction.
+type TxnResult struct {
+	Committed    bool                         `json:"committed"`
+	FailedChecks []int                        `json:"failed_checks,omitempty"` // indexes into Checks
+	Clocks       map[string]map[string]uint64 `json:"clocks,omitempty"`        // written key → new version
+}
+
+// Txn runs t: if every check holds, all ops are written together.
+// A failed check is not an error: Committed is false and FailedChecks
+// says which.
+//
+//	res, err := c.Txn(ctx, client.Txn{
+//		Checks: []client.TxnCheck{client.IfValue("alice", "100")},
+//		Ops:    []client.TxnOp{client.PutOp("alice", "70"), client.PutOp("bob", "30")},
+//	})
+func (c *Client) Txn(ctx context.Context, t Txn) (*TxnResult, error) {
+	body, _ := json.Marshal(struct {
+		Namespace string `json:"namespace"`
+		Txn
+	}{c.namespace, t})
+
+	ctx = ensureIdempotencyKey(ctx)
+	resp, err := c.send(ctx, c.pool.order(), http.MethodPost, "/txn", body)
+	if err != nil {
+		return nil, fmt.Errorf("txn request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusConflict {
+		if err := checkStatus(resp); err != nil {
+			return nil, err
+		}
+	}
+	var res struct {
+		TxnResult
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, &APIError{Status: resp.StatusCode, Message: res.Error}
+	}
+	return &res.TxnResult, nil
+}
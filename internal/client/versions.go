@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Namespaces created with NamespaceConfig.Versions = K keep the last K
+// values of each key. Versions lists them; GetVersion reads one back,
+// for instance to undo a write:
+//
+//	vs, _ := c.Versions(ctx, "user:42")
+//	old, _ := c.GetVersion(ctx, "user:42", vs.Versions[1].Clock)
+//	c.Put(ctx, "user:42", old.Value)
+//
+// Undelete does the same for a deleted key, on the server.
+
+// KeyVersion is one version of a key.
+type KeyVersion struct {
+	Value       string            `json:"value,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Clock       map[string]uint64 `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	HLC         string            `json:"hlc,omitempty"`      // the stamp concurrent writes are ordered by
+	Deleted     bool              `json:"deleted,omitempty"`  // a tombstone
+	Current     bool              `json:"current,omitempty"`  // what Get returns now
+	Replicas    []string          `json:"replicas,omitempty"` // replicas that still hold it
+}
+
+// KeyVersions is a key's history, newest first.
+type KeyVersions struct {
+	Namespace   string       `json:"namespace"`
+	Key         string       `json:"key"`
+	Versions    []KeyVersion `json:"versions"`
+	Unreachable []string     `json:"unreachable,omitempty"`
+}
+
+// Versions returns every version of key the replicas still hold.
+func (c *Client) Versions(ctx context.Context, key string) (*KeyVersions, error) {
+	var vs KeyVersions
+	path := "/kv/" + url.PathEscape(c.namespace) + "/" + url.PathEscape(key) + "/versions"
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &vs); err != nil {
+		return nil, err
+	}
+	return &vs, nil
+}
+
+// GetVersion returns the version of key with clock. It returns
+// ErrNotFound once no replica keeps that version any more.
+func (c *Client) GetVersion(ctx context.Context, key string, clock map[string]uint64) (*KeyVersion, error) {
+	var v KeyVersion
+	path := "/kv/" + url.PathEscape(c.namespace) + "/" + url.PathEscape(key) + "?clock=" + url.QueryEscape(FormatClock(clock))
+	err := c.doJSON(ctx, http.MethodGet, path, nil, &v)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// UndeleteResponse is the result of Undelete.
+type UndeleteResponse struct {
+	Namespace    string            `json:"namespace"`
+	Key          string            `json:"key"`
+	Value        string            `json:"value"`
+	ContentType  string            `json:"content_type,omitempty"`
+	Clock        map[string]uint64 `json:"clock"`         // of the restored value
+	RestoredFrom map[string]uint64 `json:"restored_from"` // the version it copies
+}
+
+// Undelete writes a deleted key's last value again. It fails with a 409
+// APIError if the key is not deleted, and a 404 one if no replica kept
+// a version from before the delete (the namespace needs Versions > 0).
+func (c *Client) Undelete(ctx context.Context, key string) (*UndeleteResponse, error) {
+	// Retried after it went through, it would find the key live.
+	ctx = ensureIdempotencyKey(ctx)
+	resp, err := c.doKeyAt(ctx, http.MethodPost, key, c.keyPath(key)+"/undelete", nil)
+	if err != nil {
+		return nil, fmt.Errorf("undelete request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	var result UndeleteResponse
+	return &result, json.NewDecoder(resp.Body).Decode(&result)
+}
+
+// FormatClock writes clock as "node1:3,node2:1", the form the server
+// takes in ?clock=.
+func FormatClock(clock map[string]uint64) string {
+	parts := make([]string, 0, len(clock))
+	for _, node := range slices.Sorted(maps.Keys(clock)) {
+		parts = append(parts, fmt.Sprintf("%s:%d", node, clock[node]))
+	}
+	return strings.Join(parts, ",")
+}
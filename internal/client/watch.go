@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// ─── Watch ────────────────────────────────────────────────────────────────────
+
+// Event is one change reported by Watch.
+type Event struct {
+	Op          string            `json:"op"` // "put", "delete", or "evict" (one node dropped its copy)
+	Key         string            `json:"key"`
+	Value       string            `json:"value,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Clock       map[string]uint64 `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Node        string            `json:"node"` // the replica that applied the write
+}
+
+// ErrWatchEnded is returned when a watch stream breaks: the server went
+// away, is shutting down, or the reader fell behind. Changes made until
+// the next Watch are not replayed.
+var ErrWatchEnded = errors.New("watch ended")
+
+// watchIdle is how long a watch waits for a line before it gives the
+// server up; the server sends a heartbeat every 15s.
+const watchIdle = 45 * time.Second
+
+// Watch calls fn for every change of a key under prefix in the client's
+// namespace, as it happens, until ctx is done (it returns ctx.Err()), fn
+// fails, or the stream breaks (an error matching ErrWatchEnded). It does
+// not reconnect by itself.
+//
+//	err := c.Watch(ctx, "user:", func(ev client.Event) error {
+//		log.Println(ev.Op, ev.Key, ev.Value)
+//		return nil
+//	})
+func (c *Client) Watch(ctx context.Context, prefix string, fn func(Event) error) error {
+	return c.watch(ctx, prefix, false, fn)
+}
+
+// WatchReplicas is Watch reporting every replica's copy of a write, each
+// with the node that applied it, instead of only the first.
+func (c *Client) WatchReplicas(ctx context.Context, prefix string, fn func(Event) error) error {
+	return c.watch(ctx, prefix, true, fn)
+}
+
+func (c *Client) watch(ctx context.Context, prefix string, allReplicas bool, fn func(Event) error) error {
+	q := url.Values{}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if allReplicas {
+		q.Set("replicas", "all")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var timedOut atomic.Bool
+	idle := time.AfterFunc(watchIdle, func() { timedOut.Store(true); cancel() })
+	defer idle.Stop()
+
+	path := "/watch/" + c.namespace
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	resp, err := c.send(withStreaming(ctx), c.pool.order(), http.MethodGet, path, nil)
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for {
+		idle.Reset(watchIdle) // not while fn runs: a slow fn is not a dead server
+		line, err := r.ReadBytes('\n')
+		idle.Stop()
+		switch {
+		case timedOut.Load():
+			return fmt.Errorf("%w: no heartbeat from the server for %s", ErrWatchEnded, watchIdle)
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return fmt.Errorf("%w: %w", ErrWatchEnded, err)
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue // heartbeat
+		}
+		var msg struct {
+			Event
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return fmt.Errorf("%w: %w", ErrWatchEnded, err)
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("%w: %s", ErrWatchEnded, msg.Error)
+		}
+		if err := fn(msg.Event); err != nil {
+			return err
+		}
+	}
+}
+
+type streamingCtx struct{}
+
+// withStreaming tells send that the response is a long stream, to be
+// read without the client's overall timeout.
+func withStreaming(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamingCtx{}, true)
+}
@@ -0,0 +1,259 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// ACCESS CONTROL LISTS
+////////////////////////////////////////////////////////////////////////////////
+
+// Token scopes (api/auth.go) say what a token may do, not where: a
+// "write" token for one team can overwrite every other team's keys. ACLs
+// narrow a token to key prefixes:
+//
+//	app1   config/ read, app1/ readwrite
+//	batch  app1/jobs: read
+//
+// Prefixes are on the namespaced key ("<namespace>/<key>"), so "app1/"
+// is a whole namespace and "app1/jobs:" part of one. For each key the
+// longest prefix that matches decides; a key no rule matches is denied.
+// A token without rules is not restricted, nor are admin tokens and
+// peers. So ACLs are opt-in per token, and scopes still apply on top.
+//
+// The rules are a versioned config, replicated like the quorum
+// (quorum.go): PUT /admin/acl/:token on any node bumps the version and
+// broadcasts it (PUT /internal/acl); a node only takes a newer version,
+// and persists it to acl.json. A node that was down for a change pulls
+// the rules from a peer at startup and every aclSyncInterval after.
+// Two changes at once on different nodes get the same version, and the
+// one from the higher node ID wins: re-read with GET /admin/acl.
+
+// ACL access levels.
+const (
+	ACLRead      = "read"
+	ACLReadWrite = "readwrite"
+)
+
+// aclSyncInterval is how often RunACLSync compares rules with a peer.
+const aclSyncInterval = 30 * time.Second
+
+// ErrInvalidACL wraps every rule validation failure.
+var ErrInvalidACL = errors.New("invalid ACL")
+
+// ACLRule grants access to keys under a prefix.
+type ACLRule struct {
+	Prefix string `json:"prefix"` // namespaced key prefix; "" = every key
+	Access string `json:"access"` // ACLRead or ACLReadWrite
+}
+
+// ACLConfig is one version of the cluster's ACLs.
+type ACLConfig struct {
+	Tokens  map[string][]ACLRule `json:"tokens"` // token name → rules
+	Version uint64               `json:"version"`
+	Origin  string               `json:"origin,omitempty"` // node that made the change
+}
+
+// newerThan reports whether a should replace cur.
+func (a ACLConfig) newerThan(cur ACLConfig) bool {
+	if a.Version != cur.Version {
+		return a.Version > cur.Version
+	}
+	return a.Origin > cur.Origin
+}
+
+// ValidateACLRules checks one token's rules.
+func ValidateACLRules(rules []ACLRule) error {
+	seen := make(map[string]bool)
+	for _, r := range rules {
+		if r.Access != ACLRead && r.Access != ACLReadWrite {
+			return fmt.Errorf("%w: access must be %s or %s, not %q", ErrInvalidACL, ACLRead, ACLReadWrite, r.Access)
+		}
+		if seen[r.Prefix] {
+			return fmt.Errorf("%w: prefix %q given twice", ErrInvalidACL, r.Prefix)
+		}
+		seen[r.Prefix] = true
+	}
+	return nil
+}
+
+// Restricted reports whether token has rules.
+func (a ACLConfig) Restricted(token string) bool {
+	return len(a.Tokens[token]) > 0
+}
+
+// Allows reports whether token may read (or, with write, write) key.
+func (a ACLConfig) Allows(token, key string, write bool) bool {
+	rules := a.Tokens[token]
+	if len(rules) == 0 {
+		return true
+	}
+	best := -1
+	for i, r := range rules {
+		if strings.HasPrefix(key, r.Prefix) && (best < 0 || len(r.Prefix) > len(rules[best].Prefix)) {
+			best = i
+		}
+	}
+	return best >= 0 && (!write || rules[best].Access == ACLReadWrite)
+}
+
+// AllowsPrefix reports whether token may read every key under prefix,
+// as listing, scanning and watching it does: some rule must cover all of
+// prefix. Every rule allows reads, so rules inside it cannot take any
+// key away.
+func (a ACLConfig) AllowsPrefix(token, prefix string) bool {
+	rules := a.Tokens[token]
+	if len(rules) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(rules, func(r ACLRule) bool { return strings.HasPrefix(prefix, r.Prefix) })
+}
+
+// acls is this node's current config.
+type acls struct {
+	mu   sync.RWMutex
+	cfg  ACLConfig
+	file string // where cfg is persisted; "" = nowhere
+}
+
+// ACLs returns the current ACL config.
+func (rep *Replicator) ACLs() ACLConfig {
+	rep.acls.mu.RLock()
+	defer rep.acls.mu.RUnlock()
+	return rep.acls.cfg
+}
+
+// InitACLs loads the ACL config persisted at path by an earlier run.
+func (rep *Replicator) InitACLs(path string) error {
+	var cfg ACLConfig
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	rep.acls.mu.Lock()
+	rep.acls.cfg, rep.acls.file = cfg, path
+	rep.acls.mu.Unlock()
+	return nil
+}
+
+// SetACL replaces token's rules cluster-wide; no rules lifts its
+// restriction. The new config is returned even when some peers could
+// not be reached; the error then lists them.
+func (rep *Replicator) SetACL(ctx context.Context, token string, rules []ACLRule) (ACLConfig, error) {
+	if token == "" {
+		return ACLConfig{}, fmt.Errorf("%w: empty token name", ErrInvalidACL)
+	}
+	if err := ValidateACLRules(rules); err != nil {
+		return ACLConfig{}, err
+	}
+
+	rep.acls.mu.Lock()
+	old := rep.acls.cfg
+	cfg := ACLConfig{Tokens: maps.Clone(old.Tokens), Version: old.Version + 1, Origin: rep.selfID}
+	if cfg.Tokens == nil {
+		cfg.Tokens = make(map[string][]ACLRule)
+	}
+	if len(rules) == 0 {
+		delete(cfg.Tokens, token)
+	} else {
+		cfg.Tokens[token] = slices.Clone(rules)
+	}
+	rep.acls.cfg = cfg
+	rep.acls.mu.Unlock()
+
+	rep.aclsChanged(ctx, cfg)
+	return cfg, rep.Broadcast(ctx, http.MethodPut, "/internal/acl", cfg)
+}
+
+// ApplyACLs installs a config from a peer if it is newer than ours. It
+// reports whether anything changed.
+func (rep *Replicator) ApplyACLs(ctx context.Context, cfg ACLConfig) (bool, error) {
+	for token, rules := range cfg.Tokens {
+		if err := ValidateACLRules(rules); err != nil {
+			return false, fmt.Errorf("token %s: %w", token, err)
+		}
+	}
+
+	rep.acls.mu.Lock()
+	if !cfg.newerThan(rep.acls.cfg) {
+		rep.acls.mu.Unlock()
+		return false, nil
+	}
+	rep.acls.cfg = cfg
+	rep.acls.mu.Unlock()
+
+	rep.aclsChanged(ctx, cfg)
+	return true, nil
+}
+
+// aclsChanged persists cfg.
+func (rep *Replicator) aclsChanged(ctx context.Context, cfg ACLConfig) {
+	logger := logging.FromContext(ctx)
+	logger.Info("ACLs changed", "tokens", len(cfg.Tokens), "version", cfg.Version, "origin", cfg.Origin)
+
+	rep.acls.mu.RLock()
+	path := rep.acls.file
+	rep.acls.mu.RUnlock()
+	if path == "" {
+		return
+	}
+	data, err := json.Marshal(cfg)
+	if err == nil {
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		// Not fatal: we enforce cfg now, and a restart pulls it again.
+		logger.Error("persist ACLs", "error", err)
+	}
+}
+
+// RunACLSync pulls the ACLs from the peers now and every aclSyncInterval
+// until ctx is done, taking them if they are newer.
+func (rep *Replicator) RunACLSync(ctx context.Context) {
+	ticker := time.NewTicker(aclSyncInterval)
+	defer ticker.Stop()
+	for {
+		rep.syncACLs(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncACLs asks every reachable peer for its ACLs. The config is small
+// and there is one call per peer per interval.
+func (rep *Replicator) syncACLs(ctx context.Context) {
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID || rep.breakers.isOpen(n.ID) {
+			continue
+		}
+		var cfg ACLConfig
+		if err := rep.callPeer(ctx, &n, http.MethodGet, "/internal/acl", nil, &cfg); err != nil {
+			continue
+		}
+		if _, err := rep.ApplyACLs(ctx, cfg); err != nil {
+			logging.FromContext(ctx).Warn("peer sent invalid ACLs", "peer", n.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// AUDIT LOG
+////////////////////////////////////////////////////////////////////////////////
+
+// Admin and membership operations change what the whole cluster does: a
+// node joins or leaves, the quorum changes, a backup is restored over
+// the data. Afterwards "who did that, and when?" must have an answer
+// that survives restarts. Every such request that reaches a handler is
+// recorded in <data-dir>/audit.log:
+//
+//	{"seq":7,"time":"…","node":"n1","actor":"ops","action":"PUT /admin/quorum",
+//	 "path":"/admin/quorum","body":{"n":3,"w":2,"r":2},"status":200}
+//
+// What is recorded (the api package decides, see api/audit.go):
+//
+//   - non-GET requests to /admin/*, /cluster/* and /namespaces/*
+//   - the actor: the token's name, "cluster" for a peer, "anonymous"
+//     without auth; the client IP and request ID
+//   - route and query parameters, and the JSON body (first few KiB)
+//   - the status the node answered
+//
+// The file is append-only: entries are never rewritten or removed, and
+// each is fsynced before the request's response is finished. Requests
+// refused by auth never reach a handler and are not recorded; the
+// request log has them.
+//
+// GET /admin/audit reads one node's log. For one view of the cluster,
+// --audit-sinks ships every entry to event sinks too, as op "audit"
+// events (see sinks.go), with the entry as their JSON value.
+
+// AuditEntry is one audited operation.
+type AuditEntry struct {
+	Seq       uint64            `json:"seq"`
+	Time      time.Time         `json:"time"`
+	Node      string            `json:"node"`
+	Actor     string            `json:"actor"`
+	ClientIP  string            `json:"client_ip,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Action    string            `json:"action"` // method and route, e.g. "POST /cluster/join"
+	Path      string            `json:"path"`
+	Params    map[string]string `json:"params,omitempty"` // route and query parameters
+	Body      json.RawMessage   `json:"body,omitempty"`
+	Status    int               `json:"status"`
+}
+
+// AuditQuery selects entries for GET /admin/audit.
+type AuditQuery struct {
+	Since  time.Time // zero = from the start
+	Actor  string    // exact; "" = any
+	Action string    // substring of Action; "" = any
+	Limit  int       // the newest Limit matches; 0 = DefaultAuditLimit
+}
+
+// DefaultAuditLimit is how many entries GET /admin/audit returns by default.
+const DefaultAuditLimit = 100
+
+// auditLog is the open audit file.
+type auditLog struct {
+	mu    sync.Mutex
+	path  string
+	file  *os.File
+	next  uint64
+	sinks []*sinkQueue // --audit-sinks
+}
+
+// OpenAudit starts recording to path, shipping entries to the sinks
+// named in sinkNames (already opened by OpenSinks). Call before serving.
+func (rep *Replicator) OpenAudit(path string, sinkNames []string) error {
+	a := &auditLog{path: path, next: 1}
+	for _, name := range sinkNames {
+		i := slices.IndexFunc(rep.sinks, func(q *sinkQueue) bool { return q.cfg.Name == name })
+		if i < 0 {
+			return fmt.Errorf("audit sink %q is not in --sinks", name)
+		}
+		a.sinks = append(a.sinks, rep.sinks[i])
+	}
+
+	// Number on from the last entry. A torn last line (a crash in the
+	// middle of a write) is skipped here and by readers.
+	err := a.scan(func(e AuditEntry) { a.next = e.Seq + 1 })
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	a.file = f
+	rep.audit = a
+	return nil
+}
+
+// CloseAudit closes the audit file.
+func (rep *Replicator) CloseAudit() error {
+	if rep.audit == nil {
+		return nil
+	}
+	rep.audit.mu.Lock()
+	defer rep.audit.mu.Unlock()
+	return rep.audit.file.Close()
+}
+
+// Auditing reports whether OpenAudit was called.
+func (rep *Replicator) Auditing() bool {
+	return rep.audit != nil
+}
+
+// Audit records e, numbering and timestamping it, and queues it for the
+// audit sinks. A failure is logged: the operation has already happened.
+func (rep *Replicator) Audit(ctx context.Context, e AuditEntry) {
+	a := rep.audit
+	if a == nil {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	e.Node = rep.selfID
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	a.mu.Lock()
+	e.Seq = a.next
+	line, err := json.Marshal(e)
+	if err == nil {
+		_, err = a.file.Write(append(line, '\n'))
+	}
+	if err == nil {
+		err = a.file.Sync()
+	}
+	if err == nil {
+		a.next++
+	}
+	a.mu.Unlock()
+	if err != nil {
+		logger.Error("audit log write failed", "action", e.Action, "actor", e.Actor, "error", err)
+		return
+	}
+
+	ev := SinkEvent{Op: "audit", Key: e.Action, Value: string(line), ContentType: "application/json", UpdatedAt: e.Time, Node: rep.selfID}
+	for _, q := range a.sinks {
+		err := q.enqueue(ev)
+		switch {
+		case errors.Is(err, errSinkFull):
+			if !q.full.Swap(true) {
+				logger.Warn("sink queue full, dropping events", "sink", q.cfg.Name, "queue", q.max)
+			}
+		case err != nil:
+			logger.Error("sink queue", "sink", q.cfg.Name, "action", e.Action, "error", err)
+		}
+	}
+}
+
+// AuditEntries returns the entries matching q, oldest first.
+func (rep *Replicator) AuditEntries(q AuditQuery) ([]AuditEntry, error) {
+	if rep.audit == nil {
+		return nil, nil
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultAuditLimit
+	}
+	var out []AuditEntry
+	err := rep.audit.scan(func(e AuditEntry) {
+		if e.Time.Before(q.Since) || (q.Actor != "" && e.Actor != q.Actor) ||
+			(q.Action != "" && !strings.Contains(e.Action, q.Action)) {
+			return
+		}
+		out = append(out, e)
+		if len(out) > 2*q.Limit {
+			out = slices.Delete(out, 0, len(out)-q.Limit)
+		}
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+	return out, nil
+}
+
+// scan calls fn for every entry in the file.
+func (a *auditLog) scan(fn func(AuditEntry)) error {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var e AuditEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		fn(e)
+	}
+	return sc.Err()
+}
@@ -0,0 +1,190 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKPRESSURE
+////////////////////////////////////////////////////////////////////////////////
+
+// Every quorum operation fans out one goroutine (and one HTTP request) per
+// replica. Without a cap, a burst of writes — or one slow peer holding
+// every request open for seconds — grows goroutines and sockets without
+// bound until the node falls over.
+//
+// Two limits keep that bounded:
+//
+//  1. Admission: at most MaxInFlight quorum operations run at once.
+//     Up to MaxQueue more wait (for QueueWait at most) for a slot.
+//     Anything beyond that is shed at once with ErrOverloaded → 503,
+//     which clients treat as "try another node".
+//
+//  2. Per peer: at most PerPeer requests are outstanding to one peer.
+//     A request that cannot get a slot within QueueWait fails; for
+//     writes that means a hint, so one slow peer cannot pin every
+//     admission slot.
+//
+// Failing fast is the point: a request queued for seconds has usually
+// been given up on by its client already.
+
+// ErrOverloaded is returned when the node sheds a request.
+var ErrOverloaded = errors.New("node overloaded, try again later")
+
+// errPeerBusy is returned when no request slot to a peer frees up in time.
+var errPeerBusy = errors.New("too many requests in flight to peer")
+
+// Concurrency configures backpressure. Zero values mean unlimited.
+type Concurrency struct {
+	MaxInFlight int           // quorum operations running at once
+	MaxQueue    int           // operations waiting for a slot
+	QueueWait   time.Duration // longest wait for a slot
+	PerPeer     int           // concurrent requests to one peer
+}
+
+// DefaultConcurrency is used unless SetConcurrency is called.
+var DefaultConcurrency = Concurrency{
+	MaxInFlight: 1024,
+	MaxQueue:    1024,
+	QueueWait:   200 * time.Millisecond,
+	PerPeer:     128,
+}
+
+// BackpressureStats is reported in /admin/replication.
+type BackpressureStats struct {
+	InFlight     int64            `json:"in_flight"`
+	Queued       int64            `json:"queued"`
+	Shed         int64            `json:"shed"`
+	PeerInFlight map[string]int   `json:"peer_in_flight,omitempty"`
+	PeerBusy     map[string]int64 `json:"peer_busy,omitempty"` // requests that found the peer full
+}
+
+// backpressure holds the semaphores.
+type backpressure struct {
+	cfg   Concurrency
+	slots chan struct{} // nil = unlimited
+
+	inFlight atomic.Int64
+	queued   atomic.Int64
+	shed     atomic.Int64
+
+	mu    sync.Mutex
+	peers map[string]chan struct{}
+	busy  map[string]int64
+}
+
+func newBackpressure(cfg Concurrency) *backpressure {
+	bp := &backpressure{cfg: cfg, peers: make(map[string]chan struct{}), busy: make(map[string]int64)}
+	if cfg.MaxInFlight > 0 {
+		bp.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return bp
+}
+
+// SetConcurrency replaces the backpressure limits. Call before serving.
+func (rep *Replicator) SetConcurrency(cfg Concurrency) {
+	rep.bp = newBackpressure(cfg)
+}
+
+// admit waits for an operation slot. The returned func releases it.
+func (bp *backpressure) admit(ctx context.Context) (func(), error) {
+	release := func() { bp.inFlight.Add(-1) }
+	if bp.slots == nil {
+		bp.inFlight.Add(1)
+		return release, nil
+	}
+
+	select {
+	case bp.slots <- struct{}{}:
+		bp.inFlight.Add(1)
+		return func() { <-bp.slots; release() }, nil
+	default:
+	}
+
+	if bp.queued.Add(1) > int64(bp.cfg.MaxQueue) {
+		bp.queued.Add(-1)
+		bp.shed.Add(1)
+		return nil, ErrOverloaded
+	}
+	defer bp.queued.Add(-1)
+
+	timer := time.NewTimer(bp.cfg.QueueWait)
+	defer timer.Stop()
+	select {
+	case bp.slots <- struct{}{}:
+		bp.inFlight.Add(1)
+		return func() { <-bp.slots; release() }, nil
+	case <-timer.C:
+		bp.shed.Add(1)
+		return nil, ErrOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// peer waits for a request slot to peerID. The returned func releases it.
+func (bp *backpressure) peer(ctx context.Context, peerID string) (func(), error) {
+	if bp.cfg.PerPeer <= 0 {
+		return func() {}, nil
+	}
+
+	bp.mu.Lock()
+	sem, ok := bp.peers[peerID]
+	if !ok {
+		sem = make(chan struct{}, bp.cfg.PerPeer)
+		bp.peers[peerID] = sem
+	}
+	bp.mu.Unlock()
+
+	release := func() { <-sem }
+	select {
+	case sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := time.NewTimer(bp.cfg.QueueWait)
+	defer timer.Stop()
+	select {
+	case sem <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	bp.mu.Lock()
+	bp.busy[peerID]++
+	bp.mu.Unlock()
+	return nil, fmt.Errorf("%w %s", errPeerBusy, peerID)
+}
+
+// stats snapshots the counters.
+func (bp *backpressure) stats() BackpressureStats {
+	st := BackpressureStats{
+		InFlight: bp.inFlight.Load(),
+		Queued:   bp.queued.Load(),
+		Shed:     bp.shed.Load(),
+	}
+
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	for id, sem := range bp.peers {
+		if n := len(sem); n > 0 {
+			if st.PeerInFlight == nil {
+				st.PeerInFlight = make(map[string]int)
+			}
+			st.PeerInFlight[id] = n
+		}
+	}
+	for id, n := range bp.busy {
+		if st.PeerBusy == nil {
+			st.PeerBusy = make(map[string]int64)
+		}
+		st.PeerBusy[id] = n
+	}
+	return st
+}
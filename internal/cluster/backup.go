@@ -0,0 +1,261 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// BACKUP / RESTORE
+////////////////////////////////////////////////////////////////////////////////
+
+// A node backup only contains the keys that node replicates.
+// A cluster backup asks EVERY node for its backup and concatenates them
+// into one archive.
+//
+// Each key appears up to N times (once per replica) in a cluster backup.
+// That is fine: restore resolves duplicates with vector clocks,
+// exactly like replication does.
+
+// restoreWorkers bounds how many records are restored in parallel.
+const restoreWorkers = 16
+
+// BackupCluster streams a backup of the whole cluster to w.
+//
+// If any node cannot be backed up, it returns an error and the
+// archive is left unterminated, so it cannot be mistaken for a full one.
+func (rep *Replicator) BackupCluster(ctx context.Context, w io.Writer) error {
+	recs, nss := rep.store.BackupRecords()
+
+	bw, err := store.NewBackupWriter(w, store.BackupHeader{
+		Node:       rep.selfID,
+		Scope:      "cluster",
+		CreatedAt:  time.Now().UTC(),
+		Namespaces: nss,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range recs {
+		if err := bw.Write(rec); err != nil {
+			return err
+		}
+	}
+
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		if err := rep.copyPeerBackup(ctx, &n, bw); err != nil {
+			return fmt.Errorf("backup node %s: %w", n.ID, err)
+		}
+	}
+
+	return bw.Close()
+}
+
+// copyPeerBackup streams one peer's node backup into bw.
+func (rep *Replicator) copyPeerBackup(ctx context.Context, peer *Node, bw *store.BackupWriter) error {
+	body, err := rep.streamPeer(ctx, peer, "/internal/backup")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	br, err := store.NewBackupReader(body)
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+
+	for {
+		rec, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := bw.Write(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// RestoreStats summarizes a restore.
+type RestoreStats struct {
+	Records int64 `json:"records"` // records read from the archive
+	Applied int64 `json:"applied"` // records accepted by at least one replica
+	Failed  int64 `json:"failed"`  // records no replica accepted
+
+	Relabeled int64 `json:"relabeled,omitempty"` // records whose clock nodeMap renamed
+}
+
+// Restore reads a backup archive and writes every record to the nodes
+// that own it under the CURRENT ring.
+//
+// So a backup taken on a 3-node cluster can be restored onto a 5-node one:
+// keys land wherever the new ring says they belong.
+//
+// Records are applied with ApplyRemote semantics (vector clocks),
+// so restoring never overwrites data that is newer than the backup.
+//
+// nodeMap, if not empty, maps the backed-up cluster's node IDs to members
+// of this one. The records' clocks are rewritten to match, so they name
+// live nodes rather than ones that are gone; several old nodes mapped to
+// one new node keep the highest counter. Restore before the cluster takes
+// writes: a mapped counter can exceed the new node's own.
+func (rep *Replicator) Restore(ctx context.Context, r io.Reader, nodeMap map[string]string) (RestoreStats, error) {
+	for old, id := range nodeMap {
+		if _, ok := rep.membership.GetNode(id); !ok {
+			return RestoreStats{}, fmt.Errorf("%w: %s (mapped from %s)", ErrUnknownNode, id, old)
+		}
+	}
+
+	br, err := store.NewBackupReader(r)
+	if err != nil {
+		return RestoreStats{}, err
+	}
+	defer br.Close()
+
+	// Namespaces first, or writes into them would be meaningless.
+	for _, ns := range br.Header.Namespaces {
+		if ns.Name == store.LocksNamespace {
+			continue // always exists, and PutNamespace refuses its name
+		}
+		if _, err := rep.store.PutNamespace(ns); err != nil {
+			return RestoreStats{}, fmt.Errorf("restore namespace %s: %w", ns.Name, err)
+		}
+		if err := rep.Broadcast(ctx, http.MethodPut, "/internal/namespaces/"+ns.Name, ns); err != nil {
+			return RestoreStats{}, fmt.Errorf("propagate namespace %s: %w", ns.Name, err)
+		}
+	}
+
+	var (
+		stats RestoreStats
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, restoreWorkers)
+	)
+
+	for {
+		rec, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			wg.Wait()
+			return stats, fmt.Errorf("read record %d: %w", stats.Records+1, err)
+		}
+		stats.Records++
+		if relabelClock(&rec.Value, nodeMap) {
+			stats.Relabeled++
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(rec store.BackupRecord) {
+			defer func() { <-sem; wg.Done() }()
+			if rep.restoreRecord(ctx, rec) {
+				atomic.AddInt64(&stats.Applied, 1)
+			} else {
+				atomic.AddInt64(&stats.Failed, 1)
+			}
+		}(rec)
+	}
+
+	wg.Wait()
+	return stats, nil
+}
+
+// relabelClock renames v's clock entries by nodeMap. It reports whether
+// anything changed.
+func relabelClock(v *store.Value, nodeMap map[string]string) bool {
+	changed := false
+	for id := range v.Clock {
+		if to, ok := nodeMap[id]; ok && to != id {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false
+	}
+	clock := make(store.VectorClock, len(v.Clock))
+	for id, n := range v.Clock {
+		if to, ok := nodeMap[id]; ok {
+			id = to
+		}
+		clock[id] = max(clock[id], n)
+	}
+	v.Clock = clock
+	return true
+}
+
+// ParseNodeMap parses a restore node map: "old=new" pairs separated by
+// commas, e.g. "n1=a,n2=b,n3=b".
+func ParseNodeMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for pair := range strings.SplitSeq(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		old, id, ok := strings.Cut(pair, "=")
+		if !ok || old == "" || id == "" {
+			return nil, fmt.Errorf("invalid node mapping %q: want old=new", pair)
+		}
+		if _, dup := m[old]; dup {
+			return nil, fmt.Errorf("node %s is mapped twice", old)
+		}
+		m[old] = id
+	}
+	return m, nil
+}
+
+// restoreRecord writes one record to all of its replicas.
+// Returns true if at least one replica stored it.
+func (rep *Replicator) restoreRecord(ctx context.Context, rec store.BackupRecord) bool {
+	ok := false
+	for _, n := range rep.membership.ReplicaNodes(rec.Key, rep.Quorum().N) {
+		if n.ID == rep.selfID {
+			if _, err := rep.store.ApplyRemote(rec.Key, rec.Value); err == nil {
+				ok = true
+			}
+			continue
+		}
+		if err := rep.sendReplicateRequest(ctx, n, rec.Key, rec.Value); err == nil {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// streamPeer opens a GET to a peer and returns the body for streaming.
+//
+// Unlike callPeer there is no overall timeout: a backup of a large
+// node can take minutes. The caller's ctx bounds it instead.
+func (rep *Replicator) streamPeer(ctx context.Context, peer *Node, path string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rep.peerURL(peer, path), nil)
+	if err != nil {
+		return nil, err
+	}
+	rep.setHeaders(ctx, req)
+
+	resp, err := rep.streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("peer returned HTTP %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// BOOTSTRAP (SEED NODES)
+////////////////////////////////////////////////////////////////////////////////
+
+// Without seeds, every node must be started with the full --peers list,
+// and every list must agree. With --join, a new node only needs ONE
+// address of an existing member:
+//
+//  1. PullMembership: GET /cluster/status from the seed and add every
+//     member to our own ring. Done before we start serving.
+//  2. Announce: once our listener is up, POST /cluster/join to every
+//     member so they add us to THEIR rings.
+//
+// Step 2 must come after we listen, or peers would immediately
+// replicate to a socket that is not open yet.
+
+// statusError is returned by callPeer for non-2xx peer responses.
+type statusError struct {
+	Status int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("peer returned HTTP %d", e.Status)
+}
+
+// PullMembership fetches the member list from seed (host:port)
+// and makes it ours, ring epoch included.
+//
+// It also returns the seed's quorum config, so a node joining after
+// a runtime quorum change does not fall back to its own flags.
+func (rep *Replicator) PullMembership(ctx context.Context, seed string) (QuorumConfig, error) {
+	var st struct {
+		Self   string       `json:"self"`
+		Quorum QuorumConfig `json:"quorum"`
+		Ring   RingView     `json:"ring"`
+		Nodes  []Node       `json:"nodes"`
+	}
+	seedNode := &Node{ID: "seed", Address: seed}
+	if err := rep.callPeer(ctx, seedNode, http.MethodGet, "/cluster/status", nil, &st); err != nil {
+		return QuorumConfig{}, fmt.Errorf("contact seed %s: %w", seed, err)
+	}
+
+	nodes := make([]Node, 0, len(st.Nodes)+1)
+	for _, n := range st.Nodes {
+		if n.ID == rep.selfID {
+			continue
+		}
+		// The seed lists itself by its listen address (":8080");
+		// we reached it as seed, so use that instead.
+		if host, _, err := net.SplitHostPort(n.Address); err == nil && host == "" && n.ID == st.Self {
+			n.Address = seed
+		}
+		nodes = append(nodes, n)
+	}
+	// Keep ourselves; we join the seed's ring once we announce.
+	if self, ok := rep.membership.GetNode(rep.selfID); ok {
+		nodes = append(nodes, *self)
+	}
+	rep.membership.replace(nodes, st.Ring.Epoch, rep.selfID)
+	return st.Quorum, nil
+}
+
+// Announce registers self with every other member.
+//
+// A member that already knows us (409) counts as success.
+// All members are tried; the error joins every failure.
+func (rep *Replicator) Announce(ctx context.Context, self Node) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Add(1)
+		go func(p Node) {
+			defer wg.Done()
+			err := rep.callPeer(ctx, &p, http.MethodPost, "/cluster/join", self, nil)
+			var se *statusError
+			if err == nil || (errors.As(err, &se) && se.Status == http.StatusConflict) {
+				return
+			}
+			mu.Lock()
+			errs = append(errs, fmt.Errorf("node %s: %w", p.ID, err))
+			mu.Unlock()
+		}(n)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,204 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CIRCUIT BREAKERS
+////////////////////////////////////////////////////////////////////////////////
+
+// Without breakers, every write to a dead peer burns 3 attempts with
+// backoff (~300ms plus timeouts) before it becomes a hint, and every read
+// waits for the peer's timeout. One dead node slows down every request.
+//
+// So each peer has a breaker:
+//
+//	closed    → requests go through; consecutive faults are counted
+//	open      → Threshold faults in a row: requests fail at once with
+//	            errBreakerOpen (writes become hints, reads use the
+//	            other replicas) for Cooldown
+//	half-open → after Cooldown, ONE request probes the peer:
+//	            success closes the breaker, a fault opens it again
+//
+// A fault is a transport error or a 5xx. A 4xx (or a stale-ring 409)
+// means the peer is alive and answering; it resets the count. A call
+// canceled on our side counts for nothing.
+//
+// A peer that announces its shutdown (shutdown.go) opens at once. Open
+// peers are also tried last by nearest reads (see nearest.go) and by
+// forwarding.
+// Breakers only guard replicate and fetch calls; membership and admin
+// calls always go through.
+
+// errBreakerOpen is returned instead of calling a peer whose breaker is open.
+var errBreakerOpen = errors.New("circuit breaker open")
+
+// BreakerConfig configures the per-peer circuit breakers.
+type BreakerConfig struct {
+	Threshold int           // consecutive faults that open the breaker (0 = disabled)
+	Cooldown  time.Duration // how long it stays open before a probe
+}
+
+// DefaultBreakerConfig is used unless SetBreakers is called.
+var DefaultBreakerConfig = BreakerConfig{Threshold: 5, Cooldown: 5 * time.Second}
+
+// Breaker states, as reported in /admin/replication.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+type breaker struct {
+	state    string
+	faults   int // consecutive
+	openedAt time.Time
+	probing  bool // half-open: the probe is in flight
+}
+
+// breakers holds one breaker per peer.
+type breakers struct {
+	mu  sync.Mutex
+	cfg BreakerConfig
+	m   map[string]*breaker
+}
+
+func newBreakers(cfg BreakerConfig) *breakers {
+	return &breakers{cfg: cfg, m: make(map[string]*breaker)}
+}
+
+// SetBreakers replaces the circuit breaker config. Call before serving.
+func (rep *Replicator) SetBreakers(cfg BreakerConfig) {
+	rep.breakers = newBreakers(cfg)
+}
+
+// get returns the breaker for id. Caller must hold b.mu.
+func (b *breakers) get(id string) *breaker {
+	br, ok := b.m[id]
+	if !ok {
+		br = &breaker{state: breakerClosed}
+		b.m[id] = br
+	}
+	return br
+}
+
+// allow reports whether a request to id may go out.
+func (b *breakers) allow(id string) error {
+	if b.cfg.Threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br := b.get(id)
+	switch br.state {
+	case breakerOpen:
+		if time.Since(br.openedAt) < b.cfg.Cooldown {
+			return errBreakerOpen
+		}
+		br.state = breakerHalfOpen
+	case breakerHalfOpen:
+		if br.probing {
+			return errBreakerOpen
+		}
+	default:
+		return nil
+	}
+	br.probing = true
+	return nil
+}
+
+// record feeds the outcome of an allowed request to id.
+// Returns true if the breaker just opened.
+func (b *breakers) record(id string, err error) bool {
+	if b.cfg.Threshold <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br := b.get(id)
+	probe := br.probing
+	br.probing = false
+
+	switch {
+	case errors.Is(err, errPeerBusy) || errors.Is(err, errBreakerOpen):
+		// We never reached the peer: says nothing about it.
+		return false
+	case errors.Is(err, context.Canceled):
+		// Our caller gave up (e.g. a client hung up mid-batch), not the peer.
+		return false
+	case !isPeerFault(err):
+		br.state, br.faults = breakerClosed, 0
+		return false
+	}
+
+	br.faults++
+	if br.state == breakerOpen || (!probe && br.faults < b.cfg.Threshold) {
+		return false
+	}
+	br.state, br.openedAt = breakerOpen, time.Now()
+	return true
+}
+
+// trip opens id's breaker now, for a peer that said it is going down.
+func (b *breakers) trip(id string) {
+	if b.cfg.Threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.get(id)
+	br.state, br.openedAt, br.probing = breakerOpen, time.Now(), false
+}
+
+// isOpen reports whether id is failing fast right now.
+func (b *breakers) isOpen(id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.m[id]
+	return ok && br.state == breakerOpen && time.Since(br.openedAt) < b.cfg.Cooldown
+}
+
+// states returns the state of every breaker that has seen traffic.
+func (b *breakers) states() map[string]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make(map[string]string, len(b.m))
+	for id, br := range b.m {
+		out[id] = br.state
+	}
+	return out
+}
+
+// isPeerFault reports whether err means the peer is unhealthy.
+func isPeerFault(err error) bool {
+	if err == nil || errors.Is(err, ErrStaleRing) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.Status >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// guard asks peerID's breaker for permission to send one request.
+// The returned func must be called with the outcome.
+func (rep *Replicator) guard(ctx context.Context, peerID string) (func(error), error) {
+	if err := rep.breakers.allow(peerID); err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		if rep.breakers.record(peerID, err) {
+			logging.FromContext(ctx).Warn("circuit breaker opened", "peer", peerID,
+				"cooldown", rep.breakers.cfg.Cooldown, "error", err)
+		}
+	}, nil
+}
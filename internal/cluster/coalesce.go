@@ -0,0 +1,129 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"sync"
+	"sync/atomic"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// READ COALESCING
+////////////////////////////////////////////////////////////////////////////////
+
+// A thousand clients reading the same key at once would cost a thousand
+// quorum reads, R replica fetches each, all returning the same version.
+// Instead, client reads of a key that arrive while a quorum read of it is
+// running wait for that read and share its winner: one fetch per replica
+// however many readers.
+//
+// A joined read began before the reader arrived, so it may miss a write
+// acknowledged in between; the reader gets the version a read started a
+// few milliseconds earlier would have. Sessions still hold: a winner older
+// than the reader's token is read again (see CoordinateRead). Only client
+// reads (GET, batch gets) coalesce; compare-and-set paths need a read that
+// starts after they hold their lock, and call CoordinateRead.
+//
+// Reads with different read policies do not share: a nearest read must not
+// wait on a ring read, nor a ring read settle for nearest. A shared read
+// runs until the last of its readers is gone, bounded by the quorum
+// timeout; a reader cancelling does not fail the others.
+
+// readFlight is one quorum read and the readers waiting for it.
+type readFlight struct {
+	done    chan struct{}
+	value   *store.Value
+	err     error
+	readers int
+	cancel  context.CancelFunc
+}
+
+// readFlights are the running shared reads, by policy and key.
+type readFlights struct {
+	off       atomic.Bool // --coalesce-reads=false
+	coalesced atomic.Uint64
+
+	mu      sync.Mutex
+	flights map[string]*readFlight
+}
+
+// SetCoalesceReads turns read coalescing on (the default) or off.
+func (rep *Replicator) SetCoalesceReads(on bool) {
+	rep.flights.off.Store(!on)
+}
+
+// CoalescedReads returns how many client reads shared another's quorum read.
+func (rep *Replicator) CoalescedReads() uint64 {
+	return rep.flights.coalesced.Load()
+}
+
+// sharedRead is coordinateRead, joining a running read of key if there
+// is one.
+func (rep *Replicator) sharedRead(ctx context.Context, key string) (*store.Value, error) {
+	if v, ok := rep.localRead(ctx, key); ok {
+		return v, nil // nothing to share (see fastread.go)
+	}
+	f := &rep.flights
+	if f.off.Load() {
+		return rep.coordinateRead(ctx, key)
+	}
+	id := rep.readPolicyFor(ctx, key) + "\x00" + key
+
+	f.mu.Lock()
+	fl, ok := f.flights[id]
+	if ok {
+		fl.readers++
+		f.coalesced.Add(1)
+	} else {
+		fctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		fl = &readFlight{done: make(chan struct{}), readers: 1, cancel: cancel}
+		if f.flights == nil {
+			f.flights = make(map[string]*readFlight)
+		}
+		f.flights[id] = fl
+		go f.run(id, fl, func() (*store.Value, error) { return rep.coordinateRead(fctx, key) })
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-fl.done:
+		if fl.value == nil {
+			return nil, fl.err
+		}
+		v := *fl.value // each reader gets its own copy
+		return &v, fl.err
+	case <-ctx.Done():
+		f.leave(id, fl)
+		return nil, ctx.Err()
+	}
+}
+
+// run performs the read of fl and wakes its readers.
+func (f *readFlights) run(id string, fl *readFlight, read func() (*store.Value, error)) {
+	defer fl.cancel()
+	v, err := read()
+
+	f.mu.Lock()
+	if f.flights[id] == fl {
+		delete(f.flights, id) // later readers start a new read
+	}
+	f.mu.Unlock()
+
+	fl.value, fl.err = v, err
+	close(fl.done)
+}
+
+// leave drops a reader that gave up on fl, cancelling the read if it was
+// the last. A read nobody waits for is no longer joinable either.
+func (f *readFlights) leave(id string, fl *readFlight) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fl.readers--
+	if fl.readers > 0 {
+		return
+	}
+	if f.flights[id] == fl {
+		delete(f.flights, id)
+	}
+	fl.cancel()
+}
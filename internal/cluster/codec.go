@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"distributed-kvstore/internal/wire"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// WIRE ENCODING NEGOTIATION
+////////////////////////////////////////////////////////////////////////////////
+
+// Replicate requests and fetch responses carry values in msgpack
+// (see package wire) by default.
+//
+// Writes: we POST msgpack. A peer that predates msgpack cannot parse it
+// and answers 400 (or 415). Then we resend the same write as JSON, and
+// if that works we remember the peer as JSON-only — until it announces
+// a protocol with msgpack (see protocol.go), or we restart. A peer that
+// announced an older protocol is sent JSON straight away.
+//
+// Reads: we send "Accept: application/msgpack" and decode whatever the
+// response's Content-Type says. Old peers ignore Accept and answer JSON.
+
+// jsonPeers remembers peers that only understand JSON bodies.
+type jsonPeers struct{ m sync.Map } // peer ID → struct{}
+
+func (j *jsonPeers) has(id string) bool {
+	_, ok := j.m.Load(id)
+	return ok
+}
+
+func (j *jsonPeers) add(id string) { j.m.Store(id, struct{}{}) }
+
+// postReplicate sends one replicate request in the best encoding peer
+// understands.
+func (rep *Replicator) postReplicate(ctx context.Context, peer *Node, body ReplicateRequest) error {
+	if rep.jsonOnly.has(peer.ID) || !rep.speaks(peer.ID, protoMsgpack) {
+		return rep.callPeer(ctx, peer, http.MethodPost, "/internal/replicate", body, nil)
+	}
+
+	err := rep.postMsgpack(ctx, peer, "/internal/replicate", wire.MarshalReplicate(body.Key, body.Value), nil)
+	var se *statusError
+	if !errors.As(err, &se) || (se.Status != http.StatusBadRequest && se.Status != http.StatusUnsupportedMediaType) {
+		return err
+	}
+
+	if err := rep.callPeer(ctx, peer, http.MethodPost, "/internal/replicate", body, nil); err != nil {
+		return err // JSON failed too: the request itself is bad, not the encoding
+	}
+	logging.FromContext(ctx).Info("peer does not accept msgpack, using JSON", "peer", peer.ID)
+	rep.jsonOnly.add(peer.ID)
+	return nil
+}
+
+// postMsgpack POSTs a msgpack body and checks the status code. If out
+// is non-nil, the JSON response is decoded into it.
+func (rep *Replicator) postMsgpack(ctx context.Context, peer *Node, path string, data []byte, out any) error {
+	ctx, cancel := rep.peerContext(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rep.peerURL(peer, path), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", wire.ContentType)
+	rep.setHeaders(ctx, req)
+
+	resp, err := rep.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	rep.ObserveVersion(ctx, peer.ID, resp.Header)
+	defer io.Copy(io.Discard, resp.Body) // let the connection be reused
+
+	if err := rep.staleRingError(ctx, peer, resp); err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return &statusError{Status: resp.StatusCode}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// decodeValue reads a fetch response in whichever encoding it came in.
+func decodeValue(resp *http.Response) (store.Value, error) {
+	if resp.Header.Get("Content-Type") == wire.ContentType {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return store.Value{}, err
+		}
+		return wire.UnmarshalValue(data)
+	}
+	var val store.Value
+	err := json.NewDecoder(resp.Body).Decode(&val)
+	return val, err
+}
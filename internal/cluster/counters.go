@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// COUNTERS
+////////////////////////////////////////////////////////////////////////////////
+
+// GET + PUT loses increments: two clients read 5, both write 6. Increment
+// does the read-modify-write on the server instead, as an UpdateKey on
+// the key's primary (see txn.go), so concurrent increments run one after
+// the other and all of them count.
+//
+// A counter is an ordinary key holding a decimal int64 ("42"): GET reads
+// it, PUT resets it. A missing or deleted key counts from 0.
+//
+// Counters could have been CRDTs (a PN-counter per replica, summed on
+// read), which keep counting while the primary is down. But then the
+// value is no longer a plain string that every other API understands,
+// and a PUT could not reset it. Serializing on the primary keeps it one.
+
+// ErrNotCounter means the key holds something other than an integer, or
+// the increment would overflow it.
+var ErrNotCounter = errors.New("value is not a 64-bit integer counter")
+
+// Increment adds delta (negative to decrement) to the counter at key and
+// returns the new count. Must run on KeyCoordinator(key).
+func (rep *Replicator) Increment(ctx context.Context, key string, delta int64) (int64, store.Value, error) {
+	var n int64
+	val, err := rep.UpdateKey(ctx, key, func(v *store.Value) (string, error) {
+		n = 0
+		if v != nil {
+			decoded, err := v.Decode()
+			if err != nil {
+				return "", err
+			}
+			if n, err = strconv.ParseInt(decoded.Data, 10, 64); err != nil {
+				return "", fmt.Errorf("%w: %q", ErrNotCounter, decoded.Data)
+			}
+		}
+		if delta > 0 && n > math.MaxInt64-delta || delta < 0 && n < math.MinInt64-delta {
+			return "", fmt.Errorf("%w: %d%+d overflows", ErrNotCounter, n, delta)
+		}
+		n += delta
+		return strconv.FormatInt(n, 10), nil
+	})
+	return n, val, err
+}
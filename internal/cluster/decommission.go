@@ -0,0 +1,304 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// DECOMMISSION
+////////////////////////////////////////////////////////////////////////////////
+
+// POST /cluster/leave drops a node from every ring at once. Whatever only
+// that node held — hints for down peers, queued async writes, keys whose
+// other replicas missed a write — is gone, and its ranges start out on
+// the new owners with one copy fewer.
+//
+// Decommission moves the data first. It runs on the leaving node:
+//
+//  1. DRAIN   the node is marked draining on every member (ring epoch +1).
+//     Nobody picks it as coordinator: it forwards its own client
+//     requests, forwarding and smart clients skip it. It is still a
+//     replica, but every write ALSO goes to the node that will take
+//     over the range once it is gone (PendingNodes). Acks from those
+//     do not count towards W; R and W keep their meaning.
+//  2. STREAM  after one quorum timeout (writes routed before the drain
+//     have landed by then), the node delivers its hints and async
+//     queue, then pushes every local record — tombstones too — to the
+//     key's owners on the ring without it.
+//  3. LEAVE   only if everything was delivered, the node removes itself,
+//     like /cluster/leave. It can then be stopped.
+//
+// If a step fails, the node stays draining and the status says why.
+// Decommissioning again resumes: every step is idempotent.
+
+// Decommission states.
+const (
+	DecommissionDraining  = "draining"
+	DecommissionStreaming = "streaming"
+	DecommissionLeft      = "left"
+	DecommissionFailed    = "failed"
+)
+
+// DecommissionStatus describes this node's decommission.
+type DecommissionStatus struct {
+	Node     string    `json:"node"`
+	State    string    `json:"state,omitempty"` // "" = never started
+	Keys     int       `json:"keys"`            // local records streamed
+	Sent     int       `json:"sent"`
+	Failed   int       `json:"failed"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// running reports whether the decommission is in progress.
+func (s DecommissionStatus) running() bool {
+	return s.State == DecommissionDraining || s.State == DecommissionStreaming
+}
+
+// decommission tracks this node's decommission.
+type decommission struct {
+	mu     sync.Mutex
+	status DecommissionStatus
+}
+
+func (d *decommission) get() DecommissionStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status
+}
+
+func (d *decommission) set(s DecommissionStatus) {
+	d.mu.Lock()
+	d.status = s
+	d.mu.Unlock()
+}
+
+// ─── Membership side ──────────────────────────────────────────────────────────
+
+// Drain marks nodeID as draining. Draining an already draining node
+// changes nothing.
+func (m *Membership) Drain(nodeID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.nodes[nodeID]
+	if !ok {
+		return fmt.Errorf("node %s not in cluster", nodeID)
+	}
+	if !n.Draining {
+		m.setDraining(n)
+		m.advance(0)
+	}
+	return nil
+}
+
+// setDraining replaces n with a draining copy (readers may hold n).
+// Caller must hold m.mu.
+func (m *Membership) setDraining(n *Node) {
+	cp := *n
+	cp.Draining = true
+	m.nodes[n.ID] = &cp
+}
+
+// IsDraining reports whether nodeID is being decommissioned.
+func (m *Membership) IsDraining(nodeID string) bool {
+	n, ok := m.GetNode(nodeID)
+	return ok && n.Draining
+}
+
+// FutureReplicaNodes returns key's replicas on the ring without the
+// draining nodes: the owners once they are gone. Without draining
+// nodes it is ReplicaNodes.
+func (m *Membership) FutureReplicaNodes(key string, n int) []*Node {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	draining := 0
+	for _, node := range m.nodes {
+		if node.Draining {
+			draining++
+		}
+	}
+
+	var out []*Node
+	for _, id := range m.ring.GetNodes(key, n+draining) {
+		if node, ok := m.nodes[id]; ok && !node.Draining && len(out) < n {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// PendingNodes returns the nodes that will replicate key once the
+// draining nodes are gone, but do not yet. Usually empty.
+func (m *Membership) PendingNodes(key string, n int) []*Node {
+	if !m.anyDraining() {
+		return nil
+	}
+	current := m.ReplicaNodes(key, n)
+	var out []*Node
+	for _, node := range m.FutureReplicaNodes(key, n) {
+		if !slices.ContainsFunc(current, func(c *Node) bool { return c.ID == node.ID }) {
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+func (m *Membership) anyDraining() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, n := range m.nodes {
+		if n.Draining {
+			return true
+		}
+	}
+	return false
+}
+
+// ─── Replicator side ──────────────────────────────────────────────────────────
+
+// Draining reports whether this node is being decommissioned.
+func (rep *Replicator) Draining() bool {
+	return rep.membership.IsDraining(rep.selfID)
+}
+
+// pendingPeers returns the pending owners of key other than us.
+func (rep *Replicator) pendingPeers(key string) []*Node {
+	return rep.peersOnly(rep.membership.PendingNodes(key, rep.Quorum().N))
+}
+
+// DecommissionStatus returns the state of this node's decommission.
+func (rep *Replicator) DecommissionStatus() DecommissionStatus {
+	st := rep.decommission.get()
+	st.Node = rep.selfID
+	return st
+}
+
+// Decommission starts decommissioning this node, or resumes a failed
+// attempt, and returns at once. It fails if the node has already left
+// or if it is the last member.
+func (rep *Replicator) Decommission(ctx context.Context) (DecommissionStatus, error) {
+	rep.decommission.mu.Lock()
+	defer rep.decommission.mu.Unlock()
+
+	st := rep.decommission.status
+	st.Node = rep.selfID
+	switch {
+	case st.running():
+		return st, nil
+	case st.State == DecommissionLeft:
+		return st, errors.New("node has already left the cluster")
+	case rep.membership.Ring().NodeCount() < 2:
+		return st, errors.New("cannot decommission the last node")
+	}
+
+	st = DecommissionStatus{Node: rep.selfID, State: DecommissionDraining, Started: time.Now().UTC()}
+	rep.decommission.status = st
+	// Detach from the request: the run outlives it.
+	go rep.runDecommission(logging.WithRequestID(context.Background(), logging.RequestID(ctx)), st)
+	return st, nil
+}
+
+func (rep *Replicator) runDecommission(ctx context.Context, st DecommissionStatus) {
+	logger := logging.FromContext(ctx)
+	fail := func(err error) {
+		st.State, st.Error, st.Finished = DecommissionFailed, err.Error(), time.Now().UTC()
+		rep.decommission.set(st)
+		logger.Error("decommission failed; node stays draining", "error", err)
+	}
+
+	// 1. Drain.
+	logger.Info("decommission started: draining")
+	if err := rep.membership.Drain(rep.selfID); err != nil {
+		fail(err)
+		return
+	}
+	if err := rep.BroadcastMembership(ctx, MembershipUpdate{Drain: []string{rep.selfID}}); err != nil {
+		// A member that missed it would keep writing only to us.
+		fail(fmt.Errorf("announce drain: %w", err))
+		return
+	}
+	select {
+	case <-time.After(rep.Timeouts().Quorum):
+	case <-ctx.Done():
+		fail(ctx.Err())
+		return
+	}
+
+	// 2. Stream.
+	st.State = DecommissionStreaming
+	rep.decommission.set(st)
+	logger.Info("decommission: streaming data to new owners")
+
+	rep.DeliverHints(ctx)
+	rep.deliverOutbox(ctx)
+
+	recs, _ := rep.store.BackupRecords() // namespaces are cluster-wide already
+	for _, rec := range recs {
+		if ctx.Err() != nil {
+			break
+		}
+		st.Keys++
+		for _, n := range rep.peersOnly(rep.membership.FutureReplicaNodes(rec.Key, rep.Quorum().N)) {
+			// Failures become hints on THIS node, which is leaving:
+			// they are counted and keep us from leaving.
+			if err := rep.sendReplicateRequest(ctx, n, rec.Key, rec.Value); err != nil {
+				st.Failed++
+			} else {
+				st.Sent++
+			}
+		}
+		if st.Keys%1000 == 0 {
+			rep.decommission.set(st)
+		}
+	}
+	rep.decommission.set(st)
+
+	hints, queued := 0, 0
+	for _, n := range rep.hints.pending() {
+		hints += n
+	}
+	for _, n := range rep.outbox.counts() {
+		queued += n
+	}
+	switch {
+	case ctx.Err() != nil:
+		fail(ctx.Err())
+		return
+	case st.Failed > 0 || hints > 0 || queued > 0:
+		fail(fmt.Errorf("%d records, %d hints and %d async writes not delivered; retry once every owner is up",
+			st.Failed, hints, queued))
+		return
+	}
+
+	// 3. Leave.
+	if err := rep.membership.Leave(rep.selfID); err != nil {
+		fail(err)
+		return
+	}
+	if err := rep.BroadcastMembership(ctx, MembershipUpdate{Leave: []string{rep.selfID}}); err != nil {
+		// Members that missed it catch up from the others' newer ring.
+		logger.Warn("leave propagation incomplete", "error", err)
+	}
+	st.State, st.Finished = DecommissionLeft, time.Now().UTC()
+	rep.decommission.set(st)
+	logger.Info("decommissioned: node left the ring and can be stopped",
+		"keys", st.Keys, "sent", st.Sent, "took", time.Since(st.Started))
+}
+
+// BroadcastMembership sends u, stamped with our ID and ring epoch,
+// to every other member.
+func (rep *Replicator) BroadcastMembership(ctx context.Context, u MembershipUpdate) error {
+	u.From = rep.selfID
+	u.Epoch = rep.membership.View().Epoch
+	return rep.Broadcast(ctx, http.MethodPost, "/internal/membership", u)
+}
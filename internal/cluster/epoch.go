@@ -0,0 +1,242 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// RING EPOCHS
+////////////////////////////////////////////////////////////////////////////////
+
+// Membership changes reach nodes one broadcast at a time. In between, two
+// nodes may disagree on who owns a key — and a coordinator with an old
+// ring would quietly write to a node that no longer owns it.
+//
+// So every ring has a view: an EPOCH that grows on every membership change,
+// plus a FINGERPRINT of the member set. Every peer request carries the
+// sender's view:
+//
+//	X-KV-Ring: 7-3fa2c1d0
+//	X-KV-Peer: n1
+//
+// The receiver compares it with its own:
+//
+//   - sender is ahead  → we are stale: pull the sender's membership
+//   - sender is behind → if that request only makes sense on the old ring
+//     (we do not own the key any more), reject it with 409 and our view;
+//     the sender pulls OUR membership and the client retries. A forwarded
+//     client request is re-forwarded to the right owner instead.
+//
+// Epochs converge: the node that applies a change bumps its epoch and
+// broadcasts the new value; receivers take max(own+1, broadcast).
+// Equal epochs with different fingerprints mean two changes raced;
+// that is logged, and the next membership change settles it.
+
+// RingHeader carries the sender's ring view on peer requests.
+const RingHeader = "X-KV-Ring"
+
+// PeerHeader carries the sender's node ID on peer requests.
+const PeerHeader = "X-KV-Peer"
+
+// ErrStaleRing is returned when a peer rejected a request because our ring
+// is older than its ring.
+var ErrStaleRing = errors.New("ring changed, retry")
+
+// RingView identifies one version of the ring.
+type RingView struct {
+	Epoch       uint64 `json:"epoch"`
+	Fingerprint uint32 `json:"fingerprint"` // FNV-1a of the sorted member IDs, weights, draining flags
+}
+
+func (v RingView) String() string {
+	return fmt.Sprintf("%d-%08x", v.Epoch, v.Fingerprint)
+}
+
+// ParseRingView parses the RingHeader format.
+func ParseRingView(s string) (RingView, bool) {
+	e, fp, ok := strings.Cut(s, "-")
+	if !ok {
+		return RingView{}, false
+	}
+	epoch, err1 := strconv.ParseUint(e, 10, 64)
+	f, err2 := strconv.ParseUint(fp, 16, 32)
+	if err1 != nil || err2 != nil {
+		return RingView{}, false
+	}
+	return RingView{Epoch: epoch, Fingerprint: uint32(f)}, true
+}
+
+// View returns the current ring view.
+func (m *Membership) View() RingView {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return RingView{Epoch: m.epoch, Fingerprint: m.fingerprint}
+}
+
+// advance records a membership change. hint is the epoch announced by
+// the node that made the change (0 if none). Caller must hold m.mu.
+func (m *Membership) advance(hint uint64) {
+	m.epoch = max(m.epoch+1, hint)
+	m.refingerprint()
+}
+
+// refingerprint recomputes the member set fingerprint. Weights are part of
+// it: they change ownership as much as members do. Caller must hold m.mu.
+func (m *Membership) refingerprint() {
+	ids := make([]string, 0, len(m.nodes))
+	for id := range m.nodes {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	h := fnv.New32a()
+	for _, id := range ids {
+		h.Write([]byte(id))
+		// Weight 1 adds nothing, so rings without weights keep their
+		// fingerprint.
+		if w := m.nodes[id].Weight; w > 1 {
+			fmt.Fprintf(h, "*%d", w)
+		}
+		// Draining changes who coordinates and where writes go.
+		if m.nodes[id].Draining {
+			h.Write([]byte("~"))
+		}
+		h.Write([]byte{0})
+	}
+	m.fingerprint = h.Sum32()
+}
+
+// replace makes the member list exactly nodes (keeping selfID) and adopts
+// epoch if it is newer. Used to catch up with a peer whose ring is ahead.
+func (m *Membership) replace(nodes []Node, epoch uint64, selfID string) (joined, left int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	want := make(map[string]Node, len(nodes))
+	for _, n := range nodes {
+		want[n.ID] = n
+	}
+	for id := range m.nodes {
+		if _, ok := want[id]; !ok && id != selfID {
+			delete(m.nodes, id)
+			m.ring.RemoveNode(id)
+			left++
+		}
+	}
+	for id, n := range want {
+		if id == "" {
+			continue
+		}
+		old, ok := m.nodes[id]
+		if ok && max(old.Weight, 1) == max(n.Weight, 1) && old.Draining == n.Draining {
+			continue
+		}
+		n.IsAlive = true
+		m.nodes[id] = &n
+		m.ring.AddNode(id, n.Weight)
+		if !ok {
+			joined++
+		}
+	}
+	m.epoch = max(m.epoch, epoch)
+	m.refingerprint()
+	return joined, left
+}
+
+// ─── Replicator side ──────────────────────────────────────────────────────────
+
+// ringSync rate-limits catch-up pulls.
+type ringSync struct {
+	running atomic.Bool
+	last    atomic.Int64 // unix nanos of the last pull
+}
+
+// minRingSyncInterval keeps a burst of requests from a newer peer
+// from turning into a burst of pulls.
+const minRingSyncInterval = time.Second
+
+// ObserveRing is called with the view a peer sent us. If the peer's ring
+// is newer, we pull its membership in the background.
+func (rep *Replicator) ObserveRing(ctx context.Context, peerID string, theirs RingView) {
+	ours := rep.membership.View()
+	switch {
+	case theirs.Epoch > ours.Epoch:
+		rep.syncRingAsync(ctx, peerID)
+	case theirs.Epoch == ours.Epoch && theirs.Fingerprint != ours.Fingerprint:
+		logging.FromContext(ctx).Warn("ring views diverged at the same epoch",
+			"peer", peerID, "ours", ours.String(), "theirs", theirs.String())
+	}
+}
+
+// Stale reports whether a request carrying view was routed with a ring
+// older than ours. Requests without a view (older nodes) are never stale.
+func (rep *Replicator) Stale(header string) bool {
+	theirs, ok := ParseRingView(header)
+	return ok && theirs.Epoch < rep.membership.View().Epoch
+}
+
+// syncRingAsync pulls peerID's membership in the background, at most once
+// per minRingSyncInterval.
+func (rep *Replicator) syncRingAsync(ctx context.Context, peerID string) {
+	if time.Since(time.Unix(0, rep.ringSync.last.Load())) < minRingSyncInterval {
+		return
+	}
+	if !rep.ringSync.running.CompareAndSwap(false, true) {
+		return
+	}
+	ctx = logging.WithRequestID(context.Background(), logging.RequestID(ctx))
+	go func() {
+		defer rep.ringSync.running.Store(false)
+		if err := rep.SyncRing(ctx, peerID); err != nil {
+			logging.FromContext(ctx).Warn("ring catch-up failed", "peer", peerID, "error", err)
+		}
+	}()
+}
+
+// SyncRing replaces our membership with peerID's, if its ring is newer.
+func (rep *Replicator) SyncRing(ctx context.Context, peerID string) error {
+	peer, ok := rep.membership.GetNode(peerID)
+	if !ok {
+		return fmt.Errorf("unknown peer %s", peerID)
+	}
+	rep.ringSync.last.Store(time.Now().UnixNano())
+
+	var st struct {
+		Ring  RingView `json:"ring"`
+		Nodes []Node   `json:"nodes"`
+	}
+	if err := rep.callPeer(ctx, peer, http.MethodGet, "/cluster/status", nil, &st); err != nil {
+		return err
+	}
+	before := rep.membership.View()
+	if st.Ring.Epoch <= before.Epoch {
+		return nil // someone else caught us up already
+	}
+	joined, left := rep.membership.replace(st.Nodes, st.Ring.Epoch, rep.selfID)
+	logging.FromContext(ctx).Info("ring caught up from peer", "peer", peerID,
+		"from", before.String(), "to", rep.membership.View().String(), "joined", joined, "left", left)
+	return nil
+}
+
+// staleRingError turns a 409 carrying a newer ring into ErrStaleRing,
+// and starts catching up with that peer.
+func (rep *Replicator) staleRingError(ctx context.Context, peer *Node, resp *http.Response) error {
+	if resp.StatusCode != http.StatusConflict {
+		return nil
+	}
+	theirs, ok := ParseRingView(resp.Header.Get(RingHeader))
+	if !ok {
+		return nil
+	}
+	rep.ObserveRing(ctx, peer.ID, theirs)
+	return fmt.Errorf("%w: %s is at ring %s", ErrStaleRing, peer.ID, theirs)
+}
@@ -0,0 +1,189 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// EVICTION NOTIFICATIONS
+////////////////////////////////////////////////////////////////////////////////
+
+// Besides expiry (expiry.go), which deletes a key on every replica like
+// a client would, the only way a key leaves a node without a delete is
+// eviction (store/memory.go). A cache in
+// front of the cluster, or a job cleaning up after keys, may want to know
+// when that happens. Watches carry it as "evict" events (see watch.go);
+// for consumers that cannot hold a stream open, --eviction-webhook POSTs
+// them:
+//
+//	POST <url>
+//	{"node": "n1", "events": [{"op": "evict", "namespace": "cache", "key": "user:42",
+//	                           "clock": {"n1": 3}, "updated_at": "…", "node": "n1"}]}
+//
+// Each node posts its own evictions, batched (up to evictWebhookBatch
+// events, or what arrived within evictWebhookLinger). A batch that fails
+// (a network error or a non-2xx answer) is retried with doubling waits,
+// --eviction-webhook-retries times, then dropped and counted. Delivery is
+// at most once past that, and events evicted while the feed lagged are
+// lost too: notifications are a hint, never the record of what a node
+// holds.
+
+const (
+	evictWebhookBatch   = 100
+	evictWebhookLinger  = 200 * time.Millisecond
+	evictWebhookTimeout = 5 * time.Second
+	evictWebhookBackoff = 250 * time.Millisecond // doubles per retry
+	evictWebhookMaxWait = 30 * time.Second
+)
+
+// EvictionWebhookConfig configures eviction notifications.
+type EvictionWebhookConfig struct {
+	URL     string // http(s) endpoint; empty = off
+	Retries int    // further attempts per batch after the first
+}
+
+// Validate checks that c is usable.
+func (c EvictionWebhookConfig) Validate() error {
+	if c.URL != "" && !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+		return fmt.Errorf("eviction webhook %q must be an http:// or https:// URL", c.URL)
+	}
+	if c.Retries < 0 {
+		return errors.New("eviction webhook retries must not be negative")
+	}
+	return nil
+}
+
+// EvictionEvent is one evicted key, as the webhook sends it.
+type EvictionEvent struct {
+	WatchEvent
+	Namespace string `json:"namespace"`
+}
+
+// EvictionWebhookStats counts what the webhook delivered.
+type EvictionWebhookStats struct {
+	Sent    uint64 `json:"sent"`    // events the endpoint accepted
+	Dropped uint64 `json:"dropped"` // events given up on after the retries
+}
+
+type evictWebhook struct {
+	sent, dropped atomic.Uint64
+}
+
+// EvictionWebhookStats returns the webhook's counters.
+func (rep *Replicator) EvictionWebhookStats() EvictionWebhookStats {
+	return EvictionWebhookStats{Sent: rep.evictHook.sent.Load(), Dropped: rep.evictHook.dropped.Load()}
+}
+
+// RunEvictionWebhook posts this node's evictions to cfg.URL until ctx is
+// done. It returns at once if cfg.URL is empty.
+func (rep *Replicator) RunEvictionWebhook(ctx context.Context, cfg EvictionWebhookConfig) {
+	if cfg.URL == "" {
+		return
+	}
+	log := logging.FromContext(ctx)
+	for ctx.Err() == nil {
+		w := rep.store.Watch("")
+		rep.forwardEvictions(ctx, cfg, w)
+		w.Close()
+		if w.Overflowed() {
+			log.Warn("eviction webhook fell behind the change feed; some evictions were not sent")
+		}
+	}
+}
+
+// forwardEvictions batches the evictions of w and posts them, until ctx
+// is done or w overflows.
+func (rep *Replicator) forwardEvictions(ctx context.Context, cfg EvictionWebhookConfig, w *store.Watcher) {
+	var (
+		batch []EvictionEvent
+		flush <-chan time.Time
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flush:
+			rep.postEvictions(ctx, cfg, batch)
+			batch, flush = nil, nil
+		case ch, ok := <-w.C:
+			if !ok {
+				return
+			}
+			if !ch.Evicted {
+				continue
+			}
+			ns, key := store.SplitKey(ch.Key)
+			batch = append(batch, EvictionEvent{
+				WatchEvent: WatchEvent{Op: "evict", Key: key, Clock: ch.Value.Clock, UpdatedAt: ch.Value.UpdatedAt, Node: rep.selfID},
+				Namespace:  ns,
+			})
+			switch {
+			case len(batch) >= evictWebhookBatch:
+				rep.postEvictions(ctx, cfg, batch)
+				batch, flush = nil, nil
+			case flush == nil:
+				flush = time.After(evictWebhookLinger)
+			}
+		}
+	}
+}
+
+// postEvictions delivers one batch, retrying as configured.
+func (rep *Replicator) postEvictions(ctx context.Context, cfg EvictionWebhookConfig, events []EvictionEvent) {
+	body, err := json.Marshal(struct {
+		Node   string          `json:"node"`
+		Events []EvictionEvent `json:"events"`
+	}{rep.selfID, events})
+	if err != nil {
+		return
+	}
+	wait := evictWebhookBackoff
+	for attempt := 0; ; attempt++ {
+		err = postWebhook(ctx, cfg.URL, body)
+		if err == nil {
+			rep.evictHook.sent.Add(uint64(len(events)))
+			return
+		}
+		if attempt == cfg.Retries || ctx.Err() != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, evictWebhookMaxWait)
+	}
+	rep.evictHook.dropped.Add(uint64(len(events)))
+	logging.FromContext(ctx).Warn("eviction webhook failed, dropping events",
+		"url", cfg.URL, "events", len(events), "error", err)
+}
+
+// postWebhook POSTs body as JSON to url; any 2xx is success.
+func postWebhook(ctx context.Context, url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, evictWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
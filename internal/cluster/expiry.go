@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// KEY EXPIRY
+////////////////////////////////////////////////////////////////////////////////
+
+// An expired value reads as absent at once (store/ttl.go) but stays in
+// memory until it is deleted. Every expiryInterval each node looks among
+// its own copies for expired keys it is the primary of — the first node
+// of the replica set, which also runs the key's transactions (txn.go) —
+// and deletes them. One node per key, so replicas do not write
+// tombstones that conflict with each other.
+//
+// The delete is conditional, under the key's transaction lock: a quorum
+// read must still find an expired version, and the tombstone descends
+// from it. A write that renewed the key in the meantime is kept.
+//
+// While a key's primary is down nobody deletes it; it still reads as
+// absent, and is deleted once the primary is back or the ring moves on.
+
+const (
+	expiryInterval = 5 * time.Second
+	expiryBatch    = 1000 // keys deleted per pass, at most
+)
+
+// RunExpiry deletes expired keys every expiryInterval until ctx is done.
+func (rep *Replicator) RunExpiry(ctx context.Context) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !rep.Draining() {
+			rep.expireKeys(ctx)
+		}
+	}
+}
+
+// expireKeys runs one pass.
+func (rep *Replicator) expireKeys(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	expired := 0
+	for _, key := range rep.store.ExpiredKeys(time.Now(), expiryBatch, rep.isPrimary) {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := rep.expireKey(ctx, key); err != nil {
+			logger.Warn("expire key", "key", key, "error", err)
+			continue
+		}
+		expired++
+	}
+	if expired > 0 {
+		logger.Debug("expired keys deleted", "keys", expired)
+	}
+}
+
+// isPrimary reports whether this node is the first replica of key.
+func (rep *Replicator) isPrimary(key string) bool {
+	nodes := rep.membership.ReplicaNodes(key, rep.Quorum().N)
+	return len(nodes) > 0 && nodes[0].ID == rep.selfID
+}
+
+// expireKey writes a tombstone over key if its current version has
+// expired.
+func (rep *Replicator) expireKey(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, rep.Timeouts().Quorum)
+	defer cancel()
+	unlock, err := rep.txnLocks.lock(ctx, []string{key})
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := rep.coordinateRead(WithReadPolicy(ctx, ReadRing), key)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.Tombstone || !current.Expired(time.Now()) {
+		return nil // renewed or already deleted
+	}
+	_, err = rep.commitLocal(ctx, []store.TxnWrite{{Key: key, Delete: true, Clock: current.Clock}})
+	return err
+}
@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// ONE-REPLICA READS
+////////////////////////////////////////////////////////////////////////////////
+
+// A client read (GET, batch gets, reached through CachedRead) that needs
+// a single answer has nothing to reconcile, so when this node is one of
+// the key's replicas it answers from its own copy:
+// no fanout, no channels, no read repair, no coalescing — a map lookup
+// under the shard lock. A read needs one answer when
+//
+//   - R = 1 (which implies W = N: every acked sync write is on every
+//     replica, so the local copy is as new as any), or
+//   - the read asked for the "one" policy (X-Read-Policy: one, or a
+//     namespace's read_policy), whatever R is.
+//
+// The second is a weak read, chosen explicitly: a replica that missed a
+// write — it was down, or the write was async — returns its older copy
+// until hinted handoff or anti-entropy bring it up to date, and nothing
+// on the read path repairs it.
+//
+// A node that is not a replica still coordinates: it asks the nearest
+// replica only (see nearest.go), and fails over to the next one.
+//
+// Reads that modify what they read — transactions, counters, locks,
+// If-Match, expiry — never take this path: they go through
+// coordinateRead with the ring policy pinned, and wait for R answers
+// even when a namespace or the node defaults to one.
+
+// readQuorum returns how many answers a read of key with ctx waits for.
+func (rep *Replicator) readQuorum(ctx context.Context, key string, q QuorumConfig) int {
+	if rep.readPolicyFor(ctx, key) == ReadOne {
+		return 1
+	}
+	return q.R
+}
+
+// localRead serves a one-answer read of key from this node's copy. ok is
+// false if the read needs more than one answer, or this node is not a
+// replica of key; the caller then coordinates it.
+func (rep *Replicator) localRead(ctx context.Context, key string) (v *store.Value, ok bool) {
+	if rep.readQuorum(ctx, key, rep.Quorum()) != 1 || !rep.IsOwner(key) {
+		return nil, false
+	}
+	rep.localReads.Add(1)
+	if val, found := rep.store.GetRaw(key); found {
+		return &val, true
+	}
+	return nil, true
+}
+
+// LocalReads returns how many client reads were served from the local copy.
+func (rep *Replicator) LocalReads() uint64 {
+	return rep.localReads.Load()
+}
@@ -0,0 +1,154 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync/atomic"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// SELF-FENCING
+////////////////////////////////////////////////////////////////////////////////
+
+// Ring epochs (epoch.go) catch a stale ring one request at a time, and
+// only when the sender is behind. A node can also end up on a ring no one
+// else has: a join it applied but could not broadcast, a leave it missed
+// while partitioned. Every write it coordinates then goes to replicas the
+// rest of the cluster does not read from.
+//
+// So each readiness check (readiness.go) also compares ring views: every
+// peer's /health answer carries its view, and the fingerprint held by
+// most of the nodes that answered, this one included, is the cluster's
+// ring. A node whose fingerprint differs from it FENCES itself:
+//
+//   - it refuses the writes it would coordinate with 503 and the reason,
+//     and /readyz fails, so load balancers route around it;
+//   - it pulls the membership of a node on the majority's ring — even an
+//     older epoch: the majority wins;
+//   - the next check, a second later, lifts the fence once it agrees.
+//
+// Only fingerprints are compared: epochs can differ while the members,
+// and so key placement, are the same. Nodes that do not answer are not
+// counted — a member only this node believes in is usually down — so
+// with one peer reachable, or no ring held by most, nothing is fenced:
+// quorums guard that case.
+
+// ErrFenced is returned for writes while this node is fenced.
+var ErrFenced = errors.New("node is fenced: its ring disagrees with the cluster's")
+
+// errNotOnMajorityRing is why a node that the majority removed stays
+// fenced: it cannot adopt a ring without itself.
+var errNotOnMajorityRing = errors.New("this node is not a member of the majority's ring")
+
+// fencing is this node's self-fencing state.
+type fencing struct {
+	off    atomic.Bool
+	reason atomic.Pointer[string] // nil = not fenced
+}
+
+// SetSelfFencing turns self-fencing on (the default) or off.
+func (rep *Replicator) SetSelfFencing(on bool) {
+	rep.fencing.off.Store(!on)
+	if !on {
+		rep.fencing.reason.Store(nil)
+	}
+}
+
+// Fenced reports whether this node is fenced, and why.
+func (rep *Replicator) Fenced() (string, bool) {
+	if r := rep.fencing.reason.Load(); r != nil {
+		return *r, true
+	}
+	return "", false
+}
+
+// fenceCheck compares our ring with the views in health, the peers'
+// probe results, and fences or unfences this node. If the majority is
+// on another ring it returns a peer on it, to resync from.
+func (rep *Replicator) fenceCheck(ctx context.Context, health map[string]peerHealth) (ReadinessCheck, string) {
+	check := ReadinessCheck{Name: "fence", OK: true}
+	if rep.fencing.off.Load() {
+		check.Detail = "off"
+		return check, ""
+	}
+
+	ours := rep.membership.View()
+	counts := map[uint32]int{ours.Fingerprint: 1}
+	peerOn := make(map[uint32]string)
+	answered := 1
+	for id, h := range health {
+		if !h.Up || h.Ring == nil {
+			continue // down, or too old to say
+		}
+		counts[h.Ring.Fingerprint]++
+		answered++
+		if prev, ok := peerOn[h.Ring.Fingerprint]; !ok || id < prev {
+			peerOn[h.Ring.Fingerprint] = id
+		}
+	}
+
+	majority, views := uint32(0), 0
+	for fp, n := range counts {
+		if n > answered/2 {
+			majority, views = fp, n
+		}
+	}
+	logger := logging.FromContext(ctx)
+	switch {
+	case answered == 1:
+		check.Detail = "no peer answered to compare rings with"
+		rep.unfence(ctx, ours)
+		return check, ""
+	case views == 0:
+		check.Detail = fmt.Sprintf("no ring held by most of the %d nodes that answered", answered)
+		rep.unfence(ctx, ours)
+		return check, ""
+	case majority == ours.Fingerprint:
+		check.Detail = fmt.Sprintf("ring %s agrees with %d of %d nodes", ours, views, answered)
+		rep.unfence(ctx, ours)
+		return check, ""
+	}
+
+	peer := peerOn[majority]
+	theirs := health[peer].Ring
+	reason := fmt.Sprintf("ring %s differs from %s, held by %d of %d nodes", ours, theirs, views, answered)
+	check.OK, check.Detail = false, "fenced: "+reason
+	if rep.fencing.reason.Swap(&reason) == nil {
+		logger.Error("node fenced itself: its ring disagrees with the majority",
+			"ours", ours.String(), "majority", theirs.String(), "held_by", views, "answered", answered)
+	}
+	return check, peer
+}
+
+func (rep *Replicator) unfence(ctx context.Context, ours RingView) {
+	if rep.fencing.reason.Swap(nil) != nil {
+		logging.FromContext(ctx).Info("fence lifted: ring agrees with the majority", "ring", ours.String())
+	}
+}
+
+// adoptRing replaces our membership with peerID's, whatever the epochs.
+func (rep *Replicator) adoptRing(ctx context.Context, peerID string) error {
+	peer, ok := rep.membership.GetNode(peerID)
+	if !ok {
+		return fmt.Errorf("unknown peer %s", peerID)
+	}
+	var st struct {
+		Ring  RingView `json:"ring"`
+		Nodes []Node   `json:"nodes"`
+	}
+	if err := rep.callPeer(ctx, peer, http.MethodGet, "/cluster/status", nil, &st); err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(st.Nodes, func(n Node) bool { return n.ID == rep.selfID }) {
+		return errNotOnMajorityRing
+	}
+	before := rep.membership.View()
+	joined, left := rep.membership.replace(st.Nodes, st.Ring.Epoch, rep.selfID)
+	logging.FromContext(ctx).Warn("fenced node adopted the majority's ring", "peer", peerID,
+		"from", before.String(), "to", rep.membership.View().String(), "joined", joined, "left", left)
+	return nil
+}
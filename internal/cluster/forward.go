@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// REQUEST FORWARDING
+////////////////////////////////////////////////////////////////////////////////
+
+// Why forward?
+//
+// Clients may send a request to ANY node (e.g. through a load balancer).
+// If that node is not one of the key's N replicas and just wrote locally,
+// the key would live on a node the ring never asks — invisible to quorum
+// reads and polluting placement.
+//
+// So a non-owner acts as a thin proxy: it passes the request to one of
+// the owners, which then coordinates the quorum as usual.
+//
+// Loops are impossible: a forwarded request carries ForwardedHeader and
+// is always handled locally by whoever receives it.
+
+// ErrUnknownNode is returned for a node ID that is not a member.
+var ErrUnknownNode = errors.New("node not in cluster")
+
+// ForwardedHeader marks a request that was already forwarded once.
+// Its value is the ID of the forwarding node.
+const ForwardedHeader = "X-KV-Forwarded-By"
+
+// hopHeaders must not be copied by proxies (RFC 9110 §7.6.1),
+// plus headers we deliberately replace.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Connection", "Te", "Trailer",
+	"Transfer-Encoding", "Upgrade",
+	"Authorization",   // replaced by the cluster token — this node already authenticated the client
+	"Accept-Encoding", // let the transport negotiate, we re-compress for the client
+}
+
+// Coordinates reports whether this node coordinates requests for key:
+// it owns key and is not being decommissioned.
+func (rep *Replicator) Coordinates(key string) bool {
+	return rep.IsOwner(key) && !rep.Draining()
+}
+
+// IsOwner reports whether this node is one of the N replicas of key.
+func (rep *Replicator) IsOwner(key string) bool {
+	return slices.ContainsFunc(rep.membership.ReplicaNodes(key, rep.Quorum().N), func(n *Node) bool {
+		return n.ID == rep.selfID
+	})
+}
+
+// ReplicaSet names the replica set of key: its owners' IDs in ring
+// order. Keys with the same name are forwarded to the same nodes.
+func (rep *Replicator) ReplicaSet(key string) string {
+	var b strings.Builder
+	for _, n := range rep.membership.ReplicaNodes(key, rep.Quorum().N) {
+		b.WriteString(n.ID)
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// Forward sends r to the first reachable owner of key and returns its
+// response. body is the already-read request body (may be nil), so it
+// can be replayed against the next owner if one is down.
+//
+// The caller must close the response body.
+func (rep *Replicator) Forward(ctx context.Context, key string, r *http.Request, body []byte) (*http.Response, error) {
+	// Never ourselves; draining owners, and those failing fast (down or
+	// shutting down), only if nobody else is left.
+	var owners, last []*Node
+	for _, n := range rep.membership.ReplicaNodes(key, rep.Quorum().N) {
+		switch {
+		case n.ID == rep.selfID:
+		case n.Draining || rep.breakers.isOpen(n.ID):
+			last = append(last, n)
+		default:
+			owners = append(owners, n)
+		}
+	}
+	owners = append(owners, last...)
+	if len(owners) == 0 {
+		return nil, fmt.Errorf("no owner for key")
+	}
+
+	var lastErr error
+	for _, owner := range owners {
+		resp, err := rep.forwardTo(ctx, owner, r, body)
+		if err != nil {
+			lastErr = fmt.Errorf("node %s: %w", owner.ID, err)
+			continue // try the next owner
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("forward to owners failed: %w", lastErr)
+}
+
+// ForwardTo sends r to the member nodeID, for requests that concern one
+// node rather than a key. The caller must close the response body.
+func (rep *Replicator) ForwardTo(ctx context.Context, nodeID string, r *http.Request, body []byte) (*http.Response, error) {
+	peer, ok := rep.membership.GetNode(nodeID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, nodeID)
+	}
+	resp, err := rep.forwardTo(ctx, peer, r, body)
+	if err != nil {
+		return nil, fmt.Errorf("node %s: %w", nodeID, err)
+	}
+	return resp, nil
+}
+
+// forwardTo replays r (with body) against peer.
+func (rep *Replicator) forwardTo(ctx context.Context, peer *Node, r *http.Request, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, r.Method, rep.peerURL(peer, r.URL.RequestURI()), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range r.Header {
+		req.Header[name] = slices.Clone(values)
+	}
+	for _, h := range hopHeaders {
+		req.Header.Del(h)
+	}
+	req.Header.Set(ForwardedHeader, rep.selfID)
+	if dl, ok := ctx.Deadline(); ok {
+		// Pass on what is left of the client's budget.
+		req.Header.Set(RequestTimeoutHeader, max(time.Until(dl), time.Millisecond).Round(time.Millisecond).String())
+	}
+	req.Header.Add("X-Forwarded-For", r.RemoteAddr)
+	rep.setHeaders(ctx, req)
+
+	return rep.httpClient.Do(req)
+}
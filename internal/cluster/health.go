@@ -0,0 +1,235 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// REPLICATION HEALTH
+////////////////////////////////////////////////////////////////////////////////
+
+// Every node counts what happens to the replication traffic it sends:
+// successes, retries, failures, hints, read repairs.
+//
+// GET /admin/replication asks every node for its counters, so an operator
+// sees the whole picture from one place: "n1 has not reached n3 in 4
+// minutes and holds 1200 hints for it" means n3 is down or partitioned;
+// only ONE node complaining about n3 points at the network between them.
+
+// PeerReplication is what one node knows about replicating to one peer.
+type PeerReplication struct {
+	Peer           string     `json:"peer"`
+	LastSuccess    *time.Time `json:"last_success,omitempty"`
+	LastFailure    *time.Time `json:"last_failure,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	Successes      int64      `json:"successes"`
+	Retries        int64      `json:"retries"`
+	Failures       int64      `json:"failures"` // gave up after all retries
+	HintsPending   int        `json:"hints_pending"`
+	HintsDelivered int64      `json:"hints_delivered"`
+	HintsDropped   int64      `json:"hints_dropped"`
+	OutboxPending  int        `json:"outbox_pending"`            // async writes not yet sent
+	ReadLatencyMs  float64    `json:"read_latency_ms,omitempty"` // moving average of fetches
+	SlowReplicates int64      `json:"slow_replicates,omitempty"` // see slow.go
+	SlowFetches    int64      `json:"slow_fetches,omitempty"`
+	Breaker        string     `json:"breaker,omitempty"` // closed, open or half-open
+	// ClockOffsetMs is the peer's clock minus ours, ± ClockErrorMs (see
+	// skew.go). Unset until a readiness probe has read it.
+	ClockOffsetMs *float64 `json:"clock_offset_ms,omitempty"`
+	ClockErrorMs  float64  `json:"clock_error_ms,omitempty"`
+	ClockSkewed   bool     `json:"clock_skewed,omitempty"` // offset over --max-clock-skew
+}
+
+// ReadRepairStats counts read repairs started by one node.
+type ReadRepairStats struct {
+	Repairs  int64 `json:"repairs"` // replicas sent a repair
+	Failures int64 `json:"failures"`
+}
+
+// ReplicationReport is one node's replication health.
+type ReplicationReport struct {
+	Node          string              `json:"node"`
+	Peers         []PeerReplication   `json:"peers"`
+	ReadRepair    ReadRepairStats     `json:"read_repair"`
+	Backpressure  BackpressureStats   `json:"backpressure"`
+	Slow          SlowStats           `json:"slow"`
+	ReadCache     ReadCacheStats      `json:"read_cache"`
+	Coalesced     uint64              `json:"reads_coalesced"` // client reads that shared a quorum read
+	LocalReads    uint64              `json:"reads_local"`     // client reads served from the local copy
+	Hedging       HedgeStats          `json:"read_hedging"`
+	Batching      ReplicateBatchStats `json:"replicate_batching"`
+	Sinks         []SinkStats         `json:"sinks,omitempty"`
+	RemoteCluster *RemoteClusterStats `json:"remote_cluster,omitempty"` // this node's bridge to another cluster
+	XDCApplied    uint64              `json:"xdc_applied"`              // writes from other clusters applied as coordinator
+	ClockSkew     ClockSkewStats      `json:"clock_skew"`
+}
+
+// replicationStats holds the counters behind ReplicationReport.
+type replicationStats struct {
+	mu     sync.Mutex
+	peers  map[string]*PeerReplication
+	repair ReadRepairStats
+	slow   SlowStats
+}
+
+func newReplicationStats() *replicationStats {
+	return &replicationStats{peers: make(map[string]*PeerReplication)}
+}
+
+// peer returns the counters for id. Caller must hold st.mu.
+func (st *replicationStats) peer(id string) *PeerReplication {
+	p, ok := st.peers[id]
+	if !ok {
+		p = &PeerReplication{Peer: id}
+		st.peers[id] = p
+	}
+	return p
+}
+
+func (st *replicationStats) success(id string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now().UTC()
+	p := st.peer(id)
+	p.Successes++
+	p.LastSuccess = &now
+}
+
+func (st *replicationStats) retry(id string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.peer(id).Retries++
+}
+
+func (st *replicationStats) failure(id string, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now().UTC()
+	p := st.peer(id)
+	p.Failures++
+	p.LastFailure = &now
+	p.LastError = err.Error()
+}
+
+func (st *replicationStats) hintDelivered(id string, n int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.peer(id).HintsDelivered += int64(n)
+}
+
+func (st *replicationStats) hintDropped(id string, n int) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.peer(id).HintsDropped += int64(n)
+}
+
+func (st *replicationStats) readRepair(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.repair.Repairs++
+	if err != nil {
+		st.repair.Failures++
+	}
+}
+
+func (st *replicationStats) slowPeer(id, op string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if op == "fetch" {
+		st.peer(id).SlowFetches++
+	} else {
+		st.peer(id).SlowReplicates++
+	}
+}
+
+func (st *replicationStats) slowQuorum(op string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if op == "read" {
+		st.slow.Reads++
+	} else {
+		st.slow.Writes++
+	}
+}
+
+// LocalReplicationReport returns this node's counters.
+func (rep *Replicator) LocalReplicationReport() ReplicationReport {
+	pending := rep.hints.pending()
+	cache := rep.ReadCacheStats()
+	queued := rep.outbox.counts()
+	breakers := rep.breakers.states()
+	clocks := rep.clockSamples()
+
+	rep.stats.mu.Lock()
+	defer rep.stats.mu.Unlock()
+
+	// Include every current peer, even if we never talked to it.
+	for _, n := range rep.membership.All() {
+		if n.ID != rep.selfID {
+			rep.stats.peer(n.ID)
+		}
+	}
+
+	r := ReplicationReport{Node: rep.selfID, ReadRepair: rep.stats.repair, Backpressure: rep.bp.stats(), Slow: rep.stats.slow, ReadCache: cache, Coalesced: rep.CoalescedReads(), LocalReads: rep.LocalReads(), Hedging: rep.HedgeStats(), Batching: rep.ReplicateBatchStats(), Sinks: rep.SinkStats(), RemoteCluster: rep.RemoteClusterStats(), XDCApplied: rep.XDCApplied(), ClockSkew: rep.ClockSkewStats()}
+	for id, p := range rep.stats.peers {
+		cp := *p
+		cp.HintsPending = pending[id]
+		cp.OutboxPending = queued[id]
+		cp.Breaker = breakers[id]
+		if d, ok := rep.latency.get(id); ok {
+			cp.ReadLatencyMs = float64(d.Microseconds()) / 1000
+		}
+		if c, ok := clocks[id]; ok {
+			off := ms(c.offset)
+			cp.ClockOffsetMs, cp.ClockErrorMs, cp.ClockSkewed = &off, ms(c.err), c.over
+		}
+		r.Peers = append(r.Peers, cp)
+	}
+	sort.Slice(r.Peers, func(i, j int) bool { return r.Peers[i].Peer < r.Peers[j].Peer })
+	return r
+}
+
+// ClusterReplicationReport is the response of GET /admin/replication.
+type ClusterReplicationReport struct {
+	Nodes       []ReplicationReport `json:"nodes"`
+	Unreachable []string            `json:"unreachable,omitempty"`
+}
+
+// ReplicationReport collects every node's report.
+func (rep *Replicator) ReplicationReport(ctx context.Context) ClusterReplicationReport {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		out = ClusterReplicationReport{Nodes: []ReplicationReport{rep.LocalReplicationReport()}}
+	)
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Add(1)
+		go func(p Node) {
+			defer wg.Done()
+			var r ReplicationReport
+			err := rep.callPeer(ctx, &p, http.MethodGet, "/internal/replication", nil, &r)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logging.FromContext(ctx).Warn("replication report: peer unavailable", "peer", p.ID, "error", err)
+				out.Unreachable = append(out.Unreachable, p.ID)
+				return
+			}
+			out.Nodes = append(out.Nodes, r)
+		}(n)
+	}
+	wg.Wait()
+
+	sort.Slice(out.Nodes, func(i, j int) bool { return out.Nodes[i].Node < out.Nodes[j].Node })
+	sort.Strings(out.Unreachable)
+	return out
+}
@@ -0,0 +1,115 @@
+package cluster
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// HEDGED READS
+////////////////////////////////////////////////////////////////////////////////
+
+// A nearest or one read (see nearest.go, fastread.go) asks only as many
+// replicas as it needs answers, and asks a spare only when one of them
+// fails. A replica that is slow rather than down — a GC pause, a full
+// disk queue — holds the read until it answers or the quorum times out.
+//
+// So the read hedges: if it still lacks answers after the hedge delay,
+// it asks the next spare too and takes whichever answers first. The
+// delay is the p99 of this node's recent peer fetches, so about one read
+// in a hundred sends a second request, and is never below
+// --hedge-min-delay. Until enough fetches have been timed, reads do not
+// hedge.
+//
+// A read hedges once: the slow replica is still asked, and a read that
+// is slow everywhere is not made to pay N requests. Ring reads ask every
+// replica from the start and have nothing to hedge with.
+
+// Hedge delay sampling.
+const (
+	hedgeSamples    = 256 // latest fetch latencies kept
+	hedgeMinSamples = 32  // fetches timed before reads hedge
+	hedgeRecompute  = 16  // fetches between p99 updates
+)
+
+// DefaultHedgeMinDelay is the default floor on the hedge delay.
+const DefaultHedgeMinDelay = 2 * time.Millisecond
+
+// hedging holds recent fetch latencies and the hedge counters.
+type hedging struct {
+	off atomic.Bool // --hedge-reads=false
+
+	hedged atomic.Uint64 // reads that asked a spare after the delay
+	won    atomic.Uint64 // ...and got that spare's answer first
+
+	mu       sync.Mutex
+	minDelay time.Duration
+	samples  [hedgeSamples]time.Duration
+	n        int           // fetches observed
+	p99      time.Duration // of samples, as of the last update
+}
+
+// HedgeStats reports read hedging, in GET /admin/replication.
+type HedgeStats struct {
+	Enabled bool    `json:"enabled"`
+	DelayMs float64 `json:"delay_ms"` // current hedge delay (0 = not enough fetches timed)
+	Hedged  uint64  `json:"hedged"`   // reads that asked a spare replica
+	Won     uint64  `json:"won"`      // hedges whose spare answered first
+}
+
+// SetHedgeReads turns read hedging on (the default) or off, and sets the
+// floor on its delay.
+func (rep *Replicator) SetHedgeReads(on bool, minDelay time.Duration) error {
+	if minDelay < 0 {
+		return errors.New("hedge min delay must not be negative")
+	}
+	h := &rep.hedge
+	h.off.Store(!on)
+	h.mu.Lock()
+	h.minDelay = minDelay
+	h.mu.Unlock()
+	return nil
+}
+
+// HedgeStats returns the state of read hedging.
+func (rep *Replicator) HedgeStats() HedgeStats {
+	h := &rep.hedge
+	d, _ := h.delay()
+	return HedgeStats{
+		Enabled: !h.off.Load(),
+		DelayMs: float64(d) / float64(time.Millisecond),
+		Hedged:  h.hedged.Load(),
+		Won:     h.won.Load(),
+	}
+}
+
+// observe records the latency of one successful fetch from a peer.
+func (h *hedging) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.samples[h.n%hedgeSamples] = d
+	h.n++
+	if h.n < hedgeMinSamples || h.n%hedgeRecompute != 0 {
+		return
+	}
+	s := slices.Clone(h.samples[:min(h.n, hedgeSamples)])
+	slices.Sort(s)
+	h.p99 = s[len(s)*99/100]
+}
+
+// delay returns how long a read waits before it hedges. ok is false if
+// it should not hedge: hedging is off, or too few fetches were timed.
+func (h *hedging) delay() (time.Duration, bool) {
+	if h.off.Load() {
+		return 0, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.n < hedgeMinSamples {
+		return 0, false
+	}
+	return max(h.p99, h.minDelay), true
+}
@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// HINTED HANDOFF
+////////////////////////////////////////////////////////////////////////////////
+
+// When a replica is down, a write still succeeds as long as W replicas ack.
+// But the down replica misses that write until a read happens to repair it.
+//
+// Hinted handoff closes that gap: the coordinator keeps a "hint"
+// (key + value) for the peer that failed, and keeps re-delivering it in the
+// background until the peer is back.
+//
+// Hints are held in memory only and capped per peer (maxHintsPerPeer).
+// Losing them (restart, overflow) is safe: read repair still converges the
+// replica eventually. Delivery goes through /internal/replicate, so clocks
+// decide — an old hint can never overwrite newer data.
+
+// maxHintsPerPeer bounds memory for a peer that stays down for long.
+const maxHintsPerPeer = 10000
+
+// hintStore holds undelivered writes per peer.
+// Only the latest value per key is kept.
+type hintStore struct {
+	mu    sync.Mutex
+	hints map[string]map[string]store.Value // peerID → key → value
+}
+
+func newHintStore() *hintStore {
+	return &hintStore{hints: make(map[string]map[string]store.Value)}
+}
+
+// add records a hint. Returns false if the peer's queue is full.
+func (hs *hintStore) add(peerID, key string, val store.Value) bool {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	q, ok := hs.hints[peerID]
+	if !ok {
+		q = make(map[string]store.Value)
+		hs.hints[peerID] = q
+	}
+	if old, ok := q[key]; ok {
+		if val.Clock.Compare(old.Clock) == store.Before {
+			return true // we already hold a newer hint
+		}
+	} else if len(q) >= maxHintsPerPeer {
+		return false
+	}
+	q[key] = val
+	return true
+}
+
+// pending returns the number of hints per peer.
+func (hs *hintStore) pending() map[string]int {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	out := make(map[string]int, len(hs.hints))
+	for id, q := range hs.hints {
+		out[id] = len(q)
+	}
+	return out
+}
+
+// snapshot copies one peer's hints so they can be delivered without the lock.
+func (hs *hintStore) snapshot(peerID string) map[string]store.Value {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	out := make(map[string]store.Value, len(hs.hints[peerID]))
+	for k, v := range hs.hints[peerID] {
+		out[k] = v
+	}
+	return out
+}
+
+// remove drops a delivered hint, unless it was replaced meanwhile.
+func (hs *hintStore) remove(peerID, key string, delivered store.Value) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	q := hs.hints[peerID]
+	if cur, ok := q[key]; ok && cur.Clock.Compare(delivered.Clock) == store.Equal {
+		delete(q, key)
+	}
+	if len(q) == 0 {
+		delete(hs.hints, peerID)
+	}
+}
+
+// drop forgets every hint for peerID (e.g. it left the cluster).
+func (hs *hintStore) drop(peerID string) int {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	n := len(hs.hints[peerID])
+	delete(hs.hints, peerID)
+	return n
+}
+
+// peers returns the IDs that have pending hints.
+func (hs *hintStore) peers() []string {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	out := make([]string, 0, len(hs.hints))
+	for id := range hs.hints {
+		out = append(out, id)
+	}
+	return out
+}
+
+// hint stores a write that could not be delivered to peer.
+func (rep *Replicator) hint(peer *Node, key string, val store.Value) {
+	if !rep.hints.add(peer.ID, key, val) {
+		rep.stats.hintDropped(peer.ID, 1)
+	}
+}
+
+// RunHintedHandoff re-delivers hints every interval until ctx is done.
+func (rep *Replicator) RunHintedHandoff(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rep.DeliverHints(ctx)
+		}
+	}
+}
+
+// DeliverHints makes one delivery pass over every peer's hints.
+//
+// A peer that fails once is skipped for the rest of the pass:
+// it is probably still down and we would just pile up timeouts.
+func (rep *Replicator) DeliverHints(ctx context.Context) {
+	for _, peerID := range rep.hints.peers() {
+		peer, ok := rep.membership.GetNode(peerID)
+		if !ok {
+			n := rep.hints.drop(peerID)
+			rep.stats.hintDropped(peerID, n)
+			continue
+		}
+
+		delivered := 0
+		for key, val := range rep.hints.snapshot(peerID) {
+			if err := rep.doHTTPReplicate(ctx, peer, ReplicateRequest{Key: key, Value: val}); err != nil {
+				break
+			}
+			rep.hints.remove(peerID, key, val)
+			rep.stats.success(peerID)
+			delivered++
+		}
+		if delivered > 0 {
+			rep.stats.hintDelivered(peerID, delivered)
+			logging.FromContext(ctx).Info("hints delivered", "peer", peerID, "count", delivered)
+		}
+	}
+}
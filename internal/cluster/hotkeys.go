@@ -0,0 +1,239 @@
+package cluster
+
+import (
+	"cmp"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"hash/maphash"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// HOT KEYS
+////////////////////////////////////////////////////////////////////////////////
+
+// Consistent hashing spreads keys, not load: one key read a thousand
+// times a second lands on the same N replicas every time. To find such
+// keys, each node counts the client operations it coordinates per key.
+//
+// Counting every key exactly would cost memory per key. Instead:
+//
+//   - a count-min sketch (hotSketchDepth rows of hotSketchWidth counters)
+//     estimates any key's count in fixed memory. Estimates can be too
+//     high (collisions add up), never too low.
+//   - a small candidate set keeps the hotKeyCandidates keys with the
+//     highest estimates. A key enters when its estimate beats the
+//     coldest candidate's.
+//   - every hotKeyHalfLife all counts are halved, so the ranking follows
+//     the current workload: a key hot an hour ago fades out.
+//
+// GET /admin/hotkeys lists the top keys of every node. Counts are
+// decayed operation counts, comparable between keys and nodes, not
+// totals.
+
+const (
+	hotSketchDepth   = 4
+	hotSketchWidth   = 1 << 12 // 4 × 4096 × 4 bytes = 64 KiB
+	hotKeyCandidates = 256
+	hotKeyHalfLife   = time.Minute
+)
+
+// HotKey is one frequently used key.
+type HotKey struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key"`
+	Count     uint32 `json:"count"`  // estimated operations, decayed
+	Reads     uint64 `json:"reads"`  // of those seen while a candidate
+	Writes    uint64 `json:"writes"` // of those seen while a candidate
+}
+
+// NodeHotKeys is one node's hottest keys, hottest first.
+type NodeHotKeys struct {
+	Node string   `json:"node"`
+	Keys []HotKey `json:"keys"`
+}
+
+// ClusterHotKeys is returned by HotKeys.
+type ClusterHotKeys struct {
+	Nodes       []NodeHotKeys `json:"nodes"`
+	Unreachable []string      `json:"unreachable,omitempty"`
+}
+
+// hotKeys is the sketch and candidate set of one node.
+type hotKeys struct {
+	seed      maphash.Seed
+	sketch    [hotSketchDepth][hotSketchWidth]atomic.Uint32
+	floor     atomic.Uint32 // smallest candidate count once the set is full
+	nextDecay atomic.Int64  // unix nanos
+
+	mu         sync.Mutex
+	candidates map[string]*hotCandidate
+}
+
+type hotCandidate struct {
+	count         uint32
+	reads, writes uint64
+}
+
+func newHotKeys() *hotKeys {
+	hk := &hotKeys{seed: maphash.MakeSeed(), candidates: make(map[string]*hotCandidate)}
+	hk.nextDecay.Store(time.Now().Add(hotKeyHalfLife).UnixNano())
+	return hk
+}
+
+// TouchKey counts one client operation on the internal key.
+func (rep *Replicator) TouchKey(key string, write bool) {
+	rep.hotKeys.touch(key, write, time.Now())
+}
+
+func (hk *hotKeys) touch(key string, write bool, now time.Time) {
+	if next := hk.nextDecay.Load(); now.UnixNano() >= next &&
+		hk.nextDecay.CompareAndSwap(next, now.Add(hotKeyHalfLife).UnixNano()) {
+		hk.decay()
+	}
+
+	// Kirsch–Mitzenmacher: row i uses h1 + i·h2.
+	h := maphash.String(hk.seed, key)
+	h1, h2 := uint32(h), uint32(h>>32)|1
+	est := uint32(math.MaxUint32)
+	for i := range hotSketchDepth {
+		est = min(est, hk.sketch[i][(h1+uint32(i)*h2)%hotSketchWidth].Add(1))
+	}
+	if est <= hk.floor.Load() {
+		return // colder than every candidate: the common case, lock-free
+	}
+
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+	c, ok := hk.candidates[key]
+	if !ok {
+		if len(hk.candidates) >= hotKeyCandidates {
+			coldest, lowest := hk.coldest()
+			if est <= lowest {
+				hk.floor.Store(lowest)
+				return
+			}
+			delete(hk.candidates, coldest)
+		}
+		c = &hotCandidate{}
+		hk.candidates[key] = c
+	}
+	c.count = est
+	if write {
+		c.writes++
+	} else {
+		c.reads++
+	}
+	if len(hk.candidates) >= hotKeyCandidates {
+		_, lowest := hk.coldest()
+		hk.floor.Store(lowest)
+	}
+}
+
+// coldest returns the candidate with the smallest count. Caller holds
+// hk.mu.
+func (hk *hotKeys) coldest() (string, uint32) {
+	var (
+		key    string
+		lowest = uint32(math.MaxUint32)
+	)
+	for k, c := range hk.candidates {
+		if c.count < lowest {
+			key, lowest = k, c.count
+		}
+	}
+	return key, lowest
+}
+
+// decay halves every count.
+func (hk *hotKeys) decay() {
+	for i := range hk.sketch {
+		for j := range hk.sketch[i] {
+			c := &hk.sketch[i][j]
+			for {
+				old := c.Load()
+				if old == 0 || c.CompareAndSwap(old, old/2) {
+					break
+				}
+			}
+		}
+	}
+	hk.mu.Lock()
+	defer hk.mu.Unlock()
+	for k, c := range hk.candidates {
+		c.count /= 2
+		c.reads /= 2
+		c.writes /= 2
+		if c.count == 0 {
+			delete(hk.candidates, k)
+		}
+	}
+	hk.floor.Store(0)
+}
+
+// top returns the limit hottest candidates.
+func (hk *hotKeys) top(limit int) []HotKey {
+	hk.mu.Lock()
+	out := make([]HotKey, 0, len(hk.candidates))
+	for k, c := range hk.candidates {
+		ns, key := store.SplitKey(k)
+		out = append(out, HotKey{Namespace: ns, Key: key, Count: c.count, Reads: c.reads, Writes: c.writes})
+	}
+	hk.mu.Unlock()
+
+	slices.SortFunc(out, func(a, b HotKey) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.Key, b.Key))
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// MaxHotKeys bounds the limit of HotKeys.
+const MaxHotKeys = hotKeyCandidates
+
+// LocalHotKeys returns this node's limit hottest keys.
+func (rep *Replicator) LocalHotKeys(limit int) NodeHotKeys {
+	return NodeHotKeys{Node: rep.selfID, Keys: rep.hotKeys.top(limit)}
+}
+
+// HotKeys collects every node's limit hottest keys.
+func (rep *Replicator) HotKeys(ctx context.Context, limit int) ClusterHotKeys {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		out = ClusterHotKeys{Nodes: []NodeHotKeys{rep.LocalHotKeys(limit)}}
+	)
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Go(func() {
+			var hk NodeHotKeys
+			err := rep.callPeer(ctx, &n, http.MethodGet, "/internal/hotkeys?limit="+strconv.Itoa(limit), nil, &hk)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logging.FromContext(ctx).Warn("hot keys: peer unavailable", "peer", n.ID, "error", err)
+				out.Unreachable = append(out.Unreachable, n.ID)
+				return
+			}
+			out.Nodes = append(out.Nodes, hk)
+		})
+	}
+	wg.Wait()
+
+	sort.Slice(out.Nodes, func(i, j int) bool { return out.Nodes[i].Node < out.Nodes[j].Node })
+	sort.Strings(out.Unreachable)
+	return out
+}
@@ -0,0 +1,366 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// RING INSPECTION
+////////////////////////////////////////////////////////////////////////////////
+
+// These are operator tools: "where does this key live?",
+// "how evenly is data spread over the ring?" and "what does each node
+// hold?".
+//
+// Key counts are always measured on the nodes themselves, never inferred
+// from the ring: a replica that missed writes shows up with fewer keys
+// than its siblings, which is exactly what an operator wants to see.
+
+// RangeUsage is how much data one node holds in one token range.
+type RangeUsage struct {
+	Keys  int `json:"keys"`
+	Bytes int `json:"bytes"`
+}
+
+// LocalShardUsage groups this node's live keys by token range
+// (keyed by range End).
+func (rep *Replicator) LocalShardUsage() map[uint32]RangeUsage {
+	ring := rep.membership.Ring()
+	out := make(map[uint32]RangeUsage)
+	for key, size := range rep.store.KeySizes() {
+		end, ok := ring.RangeEnd(ring.Token(key))
+		if !ok {
+			break
+		}
+		u := out[end]
+		u.Keys++
+		u.Bytes += size
+		out[end] = u
+	}
+	return out
+}
+
+// ShardRange is one token range with the usage reported by each replica.
+type ShardRange struct {
+	TokenRange
+	Usage map[string]RangeUsage `json:"usage"` // nodeID → usage
+}
+
+// NodeShards summarizes one node's share of the ring.
+type NodeShards struct {
+	ID        string  `json:"id"`
+	Weight    int     `json:"weight"`
+	Ranges    int     `json:"ranges"`    // ranges where it is primary
+	Ownership float64 `json:"ownership"` // fraction of the ring it is primary for
+	Keys      int     `json:"keys"`      // live keys it stores (all ranges)
+	Bytes     int     `json:"bytes"`
+	Reachable bool    `json:"reachable"`
+}
+
+// ShardMap is the response of GET /admin/shards.
+type ShardMap struct {
+	Vnodes int          `json:"vnodes"`
+	N      int          `json:"n"`
+	Nodes  []NodeShards `json:"nodes"`
+	Ranges []ShardRange `json:"ranges"`
+}
+
+// Shards collects the ring layout and every node's usage per range.
+func (rep *Replicator) Shards(ctx context.Context) ShardMap {
+	ring := rep.membership.Ring()
+	q := rep.Quorum()
+	ranges := ring.Ranges(q.N)
+
+	// Gather usage from every node in parallel.
+	usage := map[string]map[uint32]RangeUsage{rep.selfID: rep.LocalShardUsage()}
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Add(1)
+		go func(p Node) {
+			defer wg.Done()
+			var resp map[uint32]RangeUsage
+			if err := rep.callPeer(ctx, &p, http.MethodGet, "/internal/shards", nil, &resp); err != nil {
+				logging.FromContext(ctx).Warn("shards: peer unavailable", "peer", p.ID, "error", err)
+				return
+			}
+			mu.Lock()
+			usage[p.ID] = resp
+			mu.Unlock()
+		}(n)
+	}
+	wg.Wait()
+
+	nodes := make(map[string]*NodeShards)
+	for _, n := range rep.membership.All() {
+		_, ok := usage[n.ID]
+		nodes[n.ID] = &NodeShards{ID: n.ID, Weight: ring.Weight(n.ID), Reachable: ok}
+	}
+
+	m := ShardMap{Vnodes: ring.Vnodes(), N: q.N, Ranges: make([]ShardRange, 0, len(ranges))}
+	for _, tr := range ranges {
+		sr := ShardRange{TokenRange: tr, Usage: make(map[string]RangeUsage)}
+		for _, id := range tr.Replicas {
+			if u, ok := usage[id]; ok {
+				sr.Usage[id] = u[tr.End]
+			}
+		}
+		m.Ranges = append(m.Ranges, sr)
+
+		if ns, ok := nodes[tr.Replicas[0]]; ok {
+			ns.Ranges++
+			// uint32 arithmetic wraps, which is exactly right for the first range.
+			ns.Ownership += float64(tr.End-tr.Start) / (1 << 32)
+		}
+	}
+	if len(ranges) == 1 {
+		// A single vnode owns the whole ring (End-Start is 0).
+		nodes[ranges[0].Replicas[0]].Ownership = 1
+	}
+
+	for id, per := range usage {
+		ns, ok := nodes[id]
+		if !ok {
+			continue
+		}
+		for _, u := range per {
+			ns.Keys += u.Keys
+			ns.Bytes += u.Bytes
+		}
+	}
+	for _, id := range ring.Nodes() {
+		if ns, ok := nodes[id]; ok {
+			m.Nodes = append(m.Nodes, *ns)
+		}
+	}
+	return m
+}
+
+// ReplicaLocation is one replica of a located key.
+type ReplicaLocation struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Primary bool   `json:"primary"`
+	// Status is what the replica holds: "present", "deleted",
+	// "missing" or "unreachable".
+	Status string            `json:"status"`
+	Clock  map[string]uint64 `json:"clock,omitempty"`
+}
+
+// KeyLocation is the response of GET /admin/locate/:key.
+type KeyLocation struct {
+	Key      string            `json:"key"` // internal (namespaced) key
+	Token    uint32            `json:"token"`
+	Range    TokenRange        `json:"range"`
+	Replicas []ReplicaLocation `json:"replicas"`
+}
+
+// Locate reports where key lives and what each replica holds for it.
+func (rep *Replicator) Locate(ctx context.Context, key string) KeyLocation {
+	ring := rep.membership.Ring()
+	q := rep.Quorum()
+	loc := KeyLocation{Key: key, Token: ring.Token(key)}
+	if end, ok := ring.RangeEnd(loc.Token); ok {
+		for _, tr := range ring.Ranges(q.N) {
+			if tr.End == end {
+				loc.Range = tr
+				break
+			}
+		}
+	}
+
+	replicas := rep.membership.ReplicaNodes(key, q.N)
+	loc.Replicas = make([]ReplicaLocation, len(replicas))
+
+	var wg sync.WaitGroup
+	for i, n := range replicas {
+		loc.Replicas[i] = ReplicaLocation{ID: n.ID, Address: n.Address, Primary: i == 0}
+		wg.Add(1)
+		go func(rl *ReplicaLocation, n *Node) {
+			defer wg.Done()
+			if n.ID == rep.selfID {
+				v, ok := rep.store.GetRaw(key)
+				rl.Status, rl.Clock = replicaStatus(ok, v.Tombstone, nil), v.Clock
+				return
+			}
+			v, err := rep.fetchFromPeer(ctx, n, key)
+			if v != nil {
+				rl.Status, rl.Clock = replicaStatus(true, v.Tombstone, err), v.Clock
+				return
+			}
+			rl.Status = replicaStatus(false, false, err)
+		}(&loc.Replicas[i], n)
+	}
+	wg.Wait()
+	return loc
+}
+
+// ReplicaValue is one replica's copy of a key, as stored.
+type ReplicaValue struct {
+	ID      string `json:"id"`
+	Address string `json:"address"`
+	Primary bool   `json:"primary"`
+	Status  string `json:"status"` // as in ReplicaLocation
+	// Relation compares the copy with the version a read would return:
+	// "winner", "behind" (older clock), "concurrent" (lost the
+	// tie-break, see store/tiebreak.go), "conflict" (same clock, different value:
+	// read repair cannot tell them apart) or "missing". Empty when
+	// unreachable.
+	Relation string       `json:"relation,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Value    *store.Value `json:"value,omitempty"`
+}
+
+// KeyMeta is the response of GET /kv/:namespace/:key/meta.
+type KeyMeta struct {
+	Key       string         `json:"key"` // internal (namespaced) key
+	Divergent bool           `json:"divergent"`
+	Replicas  []ReplicaValue `json:"replicas"`
+}
+
+// KeyMeta fetches key from every replica and shows the copies side by
+// side, each judged against the winner a read would pick. It does not
+// repair anything.
+func (rep *Replicator) KeyMeta(ctx context.Context, key string) KeyMeta {
+	replicas := rep.membership.ReplicaNodes(key, rep.Quorum().N)
+	meta := KeyMeta{Key: key, Replicas: make([]ReplicaValue, len(replicas))}
+	responses := make([]ReplicaResponse, len(replicas))
+
+	var wg sync.WaitGroup
+	for i, n := range replicas {
+		meta.Replicas[i] = ReplicaValue{ID: n.ID, Address: n.Address, Primary: i == 0}
+		wg.Add(1)
+		go func(i int, n *Node) {
+			defer wg.Done()
+			r := ReplicaResponse{NodeID: n.ID}
+			if n.ID == rep.selfID {
+				if v, ok := rep.store.GetRaw(key); ok {
+					r.Value = &v
+				}
+			} else {
+				r.Value, r.Err = rep.fetchFromPeer(ctx, n, key)
+			}
+			responses[i] = r
+		}(i, n)
+	}
+	wg.Wait()
+
+	winner, _ := rep.reconcile(key, responses)
+	for i, r := range responses {
+		rv := &meta.Replicas[i]
+		rv.Value = r.Value
+		rv.Status = replicaStatus(r.Value != nil, r.Value != nil && r.Value.Tombstone, r.Err)
+		switch {
+		case r.Err != nil:
+			rv.Error = r.Err.Error()
+			continue
+		case r.Value == nil:
+			rv.Relation = "missing"
+		case rep.store.CompareClocks(r.Value.Clock, winner.Clock) == store.Equal && !sameContent(r.Value, winner):
+			rv.Relation = "conflict"
+		case rep.store.CompareClocks(r.Value.Clock, winner.Clock) == store.Equal:
+			rv.Relation = "winner"
+		case rep.store.CompareClocks(r.Value.Clock, winner.Clock) == store.Before:
+			rv.Relation = "behind"
+		default:
+			rv.Relation = "concurrent"
+		}
+		// With no copy anywhere, "missing" everywhere is not divergence.
+		if winner != nil && rv.Relation != "winner" {
+			meta.Divergent = true
+		}
+	}
+	return meta
+}
+
+// sameContent reports whether a and b hold the same data.
+func sameContent(a, b *store.Value) bool {
+	return a.Data == b.Data && a.Tombstone == b.Tombstone &&
+		a.Encoding == b.Encoding && bytes.Equal(a.Compressed, b.Compressed) &&
+		a.ContentType == b.ContentType
+}
+
+func replicaStatus(found, tombstone bool, err error) string {
+	switch {
+	case err != nil:
+		return "unreachable"
+	case !found:
+		return "missing"
+	case tombstone:
+		return "deleted"
+	}
+	return "present"
+}
+
+// NodeStats is one node's store statistics.
+type NodeStats struct {
+	Node    string    `json:"node"`
+	Version string    `json:"version,omitempty"` // empty from nodes older than this field
+	Started time.Time `json:"started,omitzero"`
+	store.Stats
+}
+
+// ClusterStats is the response of GET /admin/stats.
+type ClusterStats struct {
+	Nodes       []NodeStats `json:"nodes"`
+	Unreachable []string    `json:"unreachable,omitempty"`
+}
+
+// SetVersion sets the build version this node reports in its stats.
+func (rep *Replicator) SetVersion(v string) {
+	rep.version = v
+}
+
+// Version returns the build version set with SetVersion.
+func (rep *Replicator) Version() string { return rep.version }
+
+// LocalStats returns this node's store statistics.
+func (rep *Replicator) LocalStats() NodeStats {
+	return NodeStats{Node: rep.selfID, Version: rep.version, Started: rep.started, Stats: rep.store.Stats()}
+}
+
+// Stats collects every node's store statistics.
+func (rep *Replicator) Stats(ctx context.Context) ClusterStats {
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		out = ClusterStats{Nodes: []NodeStats{rep.LocalStats()}}
+	)
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Add(1)
+		go func(p Node) {
+			defer wg.Done()
+			var st NodeStats
+			err := rep.callPeer(ctx, &p, http.MethodGet, "/internal/stats", nil, &st)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logging.FromContext(ctx).Warn("stats: peer unavailable", "peer", p.ID, "error", err)
+				out.Unreachable = append(out.Unreachable, p.ID)
+				return
+			}
+			out.Nodes = append(out.Nodes, st)
+		}(n)
+	}
+	wg.Wait()
+
+	sort.Slice(out.Nodes, func(i, j int) bool { return out.Nodes[i].Node < out.Nodes[j].Node })
+	sort.Strings(out.Unreachable)
+	return out
+}
@@ -0,0 +1,170 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// LOCKS
+////////////////////////////////////////////////////////////////////////////////
+
+// A lock is a lease: held by one holder until it expires, unless that
+// holder renews it (a heartbeat) or releases it first. Services use it
+// for leader election and mutual exclusion without running another
+// consensus system next to the cluster.
+//
+// A lease is an ordinary replicated key, "_locks/<name>", whose value is
+// the JSON of Lease. Every change is a read-modify-write transaction on
+// the key's primary (UpdateKey, see txn.go): under the key's lock, read
+// the lease at quorum, decide, write it back. So no two callers are
+// ever handed the same lock.
+//
+// Each acquisition gets a fencing token one higher than the last. A
+// released lease is kept (without a holder), so tokens never go back. A
+// holder sends its token with every write to the resource it guards, and
+// the resource rejects tokens lower than the highest it has seen: a
+// holder that paused past its expiry cannot overwrite its successor.
+//
+// Limits:
+//   - Expiry is judged by the clock of the key's primary. After a
+//     failover, skew between the old and the new primary shortens or
+//     stretches leases already granted.
+//   - As for transactions, while the primary is down its locks can be
+//     neither acquired nor renewed.
+
+// Lease is the state of one lock.
+type Lease struct {
+	Name    string    `json:"name"`
+	Holder  string    `json:"holder,omitempty"` // "" = free
+	Token   uint64    `json:"token"`            // fencing token of the last acquisition
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// HeldAt reports whether l is held at now.
+func (l Lease) HeldAt(now time.Time) bool {
+	return l.Holder != "" && now.Before(l.Expires)
+}
+
+var (
+	// ErrLockHeld means another holder has the lock.
+	ErrLockHeld = errors.New("lock is held by another holder")
+	// ErrLockLost means the caller's token is no longer the lock's: it
+	// was released, or acquired by someone else after expiring.
+	ErrLockLost = errors.New("lock is no longer held with this token")
+)
+
+// Lease durations.
+const (
+	DefaultLeaseTTL = 15 * time.Second
+	MaxLeaseTTL     = time.Hour
+)
+
+// LockKey returns the internal key of lock name.
+func LockKey(name string) string {
+	return store.NamespacedKey(store.LocksNamespace, name)
+}
+
+// LockCoordinator returns the node that changes lock name: the primary
+// replica of its key.
+func (rep *Replicator) LockCoordinator(name string) (*Node, error) {
+	return rep.KeyCoordinator(LockKey(name))
+}
+
+// GetLock returns the lease of lock name; false if it was never taken.
+func (rep *Replicator) GetLock(ctx context.Context, name string) (Lease, bool, error) {
+	v, err := rep.CoordinateRead(ctx, LockKey(name))
+	if err != nil || v == nil {
+		return Lease{Name: name}, false, err
+	}
+	l, err := decodeLease(v)
+	return l, err == nil, err
+}
+
+// AcquireLock takes lock name for holder for ttl, with a new fencing
+// token. If holder already has it, the lease is extended instead, so
+// retrying an acquire is safe. Otherwise, if it is held, the error is
+// ErrLockHeld and the lease returned is the current one.
+func (rep *Replicator) AcquireLock(ctx context.Context, name, holder string, ttl time.Duration) (Lease, error) {
+	return rep.updateLease(ctx, name, func(l Lease, now time.Time) (Lease, error) {
+		switch {
+		case l.Holder == holder && l.HeldAt(now):
+		case l.HeldAt(now):
+			return l, ErrLockHeld
+		default:
+			l.Holder, l.Token = holder, l.Token+1
+		}
+		l.Expires = now.Add(ttl)
+		return l, nil
+	})
+}
+
+// RenewLock extends the lease of holder with token to ttl from now. It
+// still works after expiry, as long as no one else took the lock since.
+func (rep *Replicator) RenewLock(ctx context.Context, name, holder string, token uint64, ttl time.Duration) (Lease, error) {
+	return rep.updateLease(ctx, name, func(l Lease, now time.Time) (Lease, error) {
+		if l.Holder != holder || l.Token != token {
+			return l, ErrLockLost
+		}
+		l.Expires = now.Add(ttl)
+		return l, nil
+	})
+}
+
+// ReleaseLock frees the lock, if holder still has it with token.
+// Releasing twice is not an error.
+func (rep *Replicator) ReleaseLock(ctx context.Context, name, holder string, token uint64) (Lease, error) {
+	return rep.updateLease(ctx, name, func(l Lease, now time.Time) (Lease, error) {
+		if l.Holder == "" && l.Token == token {
+			return l, errUnchanged
+		}
+		if l.Holder != holder || l.Token != token {
+			return l, ErrLockLost
+		}
+		l.Holder, l.Expires = "", time.Time{}
+		return l, nil
+	})
+}
+
+// errUnchanged tells updateLease there is nothing to write.
+var errUnchanged = errors.New("lease unchanged")
+
+// updateLease applies change to the current lease of name and writes the
+// result back, as one UpdateKey. Must run on LockCoordinator(name).
+func (rep *Replicator) updateLease(ctx context.Context, name string, change func(Lease, time.Time) (Lease, error)) (Lease, error) {
+	var next Lease
+	_, err := rep.UpdateKey(ctx, LockKey(name), func(v *store.Value) (string, error) {
+		l := Lease{Name: name}
+		var err error
+		if v != nil {
+			if l, err = decodeLease(v); err != nil {
+				return "", err
+			}
+		}
+		if next, err = change(l, time.Now().UTC()); err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(next)
+		return string(data), err
+	})
+	if errors.Is(err, errUnchanged) {
+		err = nil
+	}
+	return next, err
+}
+
+func decodeLease(v *store.Value) (Lease, error) {
+	decoded, err := v.Decode()
+	if err != nil {
+		return Lease{}, err
+	}
+	var l Lease
+	if err := json.Unmarshal([]byte(decoded.Data), &l); err != nil {
+		return Lease{}, fmt.Errorf("decode lease: %w", err)
+	}
+	return l, nil
+}
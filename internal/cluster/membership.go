@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"fmt"
+	"net"
 	"sync"
 )
 
@@ -16,13 +17,19 @@ import (
 //	ID        → unique identifier (used in hashing ring)
 //	Address   → host:port for HTTP communication
 //	IsAlive   → simple liveness flag
+//	Weight    → share of the ring relative to other nodes (0 = 1)
+//	Zone      → failure/latency domain (rack, AZ); "" = unknown
+//	Draining  → being decommissioned: still a replica, never a coordinator
 //
 // In a real production system, liveness would be managed
 // automatically using heartbeats or a gossip protocol.
 type Node struct {
-	ID      string `json:"id"`
-	Address string `json:"address"` // host:port
-	IsAlive bool   `json:"is_alive"`
+	ID       string `json:"id"`
+	Address  string `json:"address"` // host:port
+	IsAlive  bool   `json:"is_alive"`
+	Weight   int    `json:"weight,omitempty"`
+	Zone     string `json:"zone,omitempty"`
+	Draining bool   `json:"draining,omitempty"` // see decommission.go
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -51,6 +58,10 @@ type Membership struct {
 	mu    sync.RWMutex
 	nodes map[string]*Node // nodeID → Node
 	ring  *Ring
+
+	// Ring view (see epoch.go): bumped on every change.
+	epoch       uint64
+	fingerprint uint32
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -79,8 +90,9 @@ func NewMembership(nodes []Node, vnodes int) *Membership {
 		n := nodes[i]
 		n.IsAlive = true
 		m.nodes[n.ID] = &n
-		m.ring.AddNode(n.ID)
+		m.ring.AddNode(n.ID, n.Weight)
 	}
+	m.refingerprint()
 
 	return m
 }
@@ -114,7 +126,8 @@ func (m *Membership) Join(node Node) error {
 
 	node.IsAlive = true
 	m.nodes[node.ID] = &node
-	m.ring.AddNode(node.ID)
+	m.ring.AddNode(node.ID, node.Weight)
+	m.advance(0)
 
 	return nil
 }
@@ -143,6 +156,7 @@ func (m *Membership) Leave(nodeID string) error {
 
 	delete(m.nodes, nodeID)
 	m.ring.RemoveNode(nodeID)
+	m.advance(0)
 
 	return nil
 }
@@ -232,3 +246,84 @@ func (m *Membership) ReplicaNodes(key string, n int) []*Node {
 
 	return nodes
 }
+
+////////////////////////////////////////////////////////////////////////////////
+// PROPAGATION
+////////////////////////////////////////////////////////////////////////////////
+
+// MembershipUpdate is a batch of membership changes sent between nodes.
+//
+// When one node handles /cluster/join or /cluster/leave, it sends an
+// update to every other member so all rings stay identical.
+// Joins carry the FULL member list, so a brand-new node learns
+// everyone in the same message.
+type MembershipUpdate struct {
+	From  string   `json:"from"`            // sender node ID
+	Epoch uint64   `json:"epoch,omitempty"` // sender's ring epoch after the change
+	Join  []Node   `json:"join,omitempty"`
+	Leave []string `json:"leave,omitempty"`
+	Drain []string `json:"drain,omitempty"` // nodes being decommissioned
+}
+
+// ResolveSender fills in the sender's host when it listed itself by
+// listen address only (":8080"), using the IP the update came from.
+func (u *MembershipUpdate) ResolveSender(remoteAddr string) {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return
+	}
+	for i, n := range u.Join {
+		if n.ID != u.From {
+			continue
+		}
+		if host, port, err := net.SplitHostPort(n.Address); err == nil && host == "" {
+			u.Join[i].Address = net.JoinHostPort(ip, port)
+		}
+	}
+}
+
+// Apply merges u into the membership.
+//
+// It is idempotent, so duplicates and reordered broadcasts are harmless:
+// joins of known nodes and leaves of unknown nodes are skipped.
+// selfID is never removed — a node does not take itself off its own ring.
+//
+// The ring epoch moves to at least u.Epoch, so every node that applied
+// the same change ends up with the same view.
+//
+// Returns true if anything changed.
+func (m *Membership) Apply(u MembershipUpdate, selfID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := false
+	for _, n := range u.Join {
+		if _, ok := m.nodes[n.ID]; ok || n.ID == "" {
+			continue
+		}
+		n.IsAlive = true
+		m.nodes[n.ID] = &n
+		m.ring.AddNode(n.ID, n.Weight)
+		changed = true
+	}
+	for _, id := range u.Leave {
+		if _, ok := m.nodes[id]; !ok || id == selfID {
+			continue
+		}
+		delete(m.nodes, id)
+		m.ring.RemoveNode(id)
+		changed = true
+	}
+	for _, id := range u.Drain {
+		if n, ok := m.nodes[id]; ok && !n.Draining {
+			m.setDraining(n)
+			changed = true
+		}
+	}
+	if changed {
+		m.advance(u.Epoch)
+	} else {
+		m.epoch = max(m.epoch, u.Epoch)
+	}
+	return changed
+}
@@ -0,0 +1,154 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsSink publishes events to NATS, one message per event, speaking the
+// core text protocol over one TCP connection:
+//
+//	nats://[user:pass@]host:4222/subject
+//
+// Core NATS has no broker acks, so a batch counts as accepted once the
+// server has answered the PING that follows its PUBs: it has read every
+// message by then. Subscribers that are not connected miss them; for
+// durable consumption, bind a JetStream stream to the subject.
+type natsSink struct {
+	addr, subject, user, pass, node string
+
+	mu   sync.Mutex // one batch at a time on the connection
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+const natsTimeout = 5 * time.Second
+
+func newNATSSink(u *url.URL, nodeID string) (*natsSink, error) {
+	subject := strings.Trim(u.Path, "/")
+	if u.Host == "" || subject == "" || strings.ContainsAny(subject, " \t/") {
+		return nil, fmt.Errorf("nats sink %q: want nats://host:port/subject", u.Redacted())
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	s := &natsSink{addr: addr, subject: subject, node: nodeID}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.pass, _ = u.User.Password()
+	}
+	return s, nil
+}
+
+func (s *natsSink) Send(ctx context.Context, events []SinkEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.send(ctx, events)
+	if err != nil {
+		s.closeLocked() // reconnect on the next batch
+	}
+	return err
+}
+
+func (s *natsSink) send(ctx context.Context, events []SinkEvent) error {
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	s.conn.SetDeadline(time.Now().Add(natsTimeout))
+
+	w := bufio.NewWriter(s.conn)
+	for _, ev := range events {
+		body, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "PUB %s %d\r\n", s.subject, len(body))
+		w.Write(body)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return s.awaitPong()
+}
+
+// connect dials the server, reads its INFO and introduces us.
+func (s *natsSink) connect(ctx context.Context) error {
+	d := net.Dialer{Timeout: natsTimeout}
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	s.conn, s.rd = conn, bufio.NewReader(conn)
+
+	line, err := s.rd.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+	opts, err := json.Marshal(map[string]any{
+		"verbose": false, "pedantic": false, "name": "kvstore-" + s.node,
+		"user": s.user, "pass": s.pass,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", opts)
+	if err != nil {
+		return err
+	}
+	return s.awaitPong()
+}
+
+// awaitPong reads until the server's PONG, answering its PINGs. A -ERR
+// line (bad credentials, a message over max_payload) fails the batch.
+func (s *natsSink) awaitPong() error {
+	for {
+		line, err := s.rd.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates need nothing.
+	}
+}
+
+func (s *natsSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeLocked()
+}
+
+func (s *natsSink) closeLocked() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn, s.rd = nil, nil
+	return err
+}
@@ -0,0 +1,159 @@
+package cluster
+
+import (
+	"cmp"
+	"context"
+	"distributed-kvstore/internal/store"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// READ ROUTING
+////////////////////////////////////////////////////////////////////////////////
+
+// By default a quorum read asks ALL N replicas and takes the first R
+// answers ("ring" policy). That is the fastest way to R answers, but it
+// sends N requests, some of them across zones.
+//
+// The "nearest" policy asks only R replicas — the closest ones — and
+// falls back to the others only if one of them fails:
+//
+//  1. this node, if it is a replica (no network at all)
+//  2. replicas in our zone (--zone)
+//  3. the rest, fastest first (moving average of past fetch latencies)
+//
+// Peers whose circuit breaker is open (see breaker.go) go last.
+//
+// The price: replicas that were not asked are not read-repaired by this
+// read. With R + W > N the answer is still the newest acked write.
+//
+// The "one" policy reads a single replica, whatever R is (see
+// fastread.go).
+//
+// The node default is --read-policy; a namespace's read_policy overrides
+// it, and a request overrides both with
+//
+//	X-Read-Policy: nearest
+
+// Read policies.
+const (
+	ReadRing    = "ring"
+	ReadNearest = "nearest"
+	ReadOne     = "one"
+)
+
+// ReadPolicies lists the read policies, for messages.
+const ReadPolicies = ReadRing + ", " + ReadNearest + " or " + ReadOne
+
+// ValidReadPolicy reports whether p is a read policy ("" = node default).
+func ValidReadPolicy(p string) bool {
+	return p == "" || p == ReadRing || p == ReadNearest || p == ReadOne
+}
+
+type readPolicyCtx struct{}
+
+// WithReadPolicy returns a ctx whose CoordinateRead uses policy p
+// instead of the node default.
+func WithReadPolicy(ctx context.Context, p string) context.Context {
+	return context.WithValue(ctx, readPolicyCtx{}, p)
+}
+
+// SetReadPolicy sets the node's default read policy.
+func (rep *Replicator) SetReadPolicy(p string) error {
+	if p == "" || !ValidReadPolicy(p) {
+		return fmt.Errorf("read policy must be %s", ReadPolicies)
+	}
+	rep.readPolicy = p
+	return nil
+}
+
+// readPolicyFor returns the policy for a read of key with ctx: ctx's,
+// else the read_policy of key's namespace, else the node's.
+func (rep *Replicator) readPolicyFor(ctx context.Context, key string) string {
+	if p, _ := ctx.Value(readPolicyCtx{}).(string); p != "" {
+		return p
+	}
+	ns, _ := store.SplitKey(key)
+	if info, ok := rep.store.GetNamespace(ns); ok && info.ReadPolicy != "" {
+		return info.ReadPolicy
+	}
+	return rep.readPolicy
+}
+
+// byProximity orders replicas nearest first. Ties keep ring order.
+func (rep *Replicator) byProximity(replicas []*Node) []*Node {
+	zone := ""
+	if self, ok := rep.membership.GetNode(rep.selfID); ok {
+		zone = self.Zone
+	}
+	rank := func(n *Node) int {
+		switch {
+		case n.ID == rep.selfID:
+			return 0
+		case rep.breakers.isOpen(n.ID):
+			return 3
+		case zone != "" && n.Zone == zone:
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	out := slices.Clone(replicas)
+	slices.SortStableFunc(out, func(a, b *Node) int {
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra - rb
+		}
+		return rep.latency.compare(a.ID, b.ID)
+	})
+	return out
+}
+
+// ─── Latency ──────────────────────────────────────────────────────────────────
+
+// latencyWeight is how much one fetch moves a peer's average.
+const latencyWeight = 0.2
+
+// peerLatency tracks an exponentially weighted moving average of fetch
+// latency per peer.
+type peerLatency struct {
+	mu sync.Mutex
+	m  map[string]time.Duration
+}
+
+func (pl *peerLatency) observe(id string, d time.Duration) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.m == nil {
+		pl.m = make(map[string]time.Duration)
+	}
+	if old, ok := pl.m[id]; ok {
+		d = old + time.Duration(latencyWeight*float64(d-old))
+	}
+	pl.m[id] = d
+}
+
+func (pl *peerLatency) get(id string) (time.Duration, bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	d, ok := pl.m[id]
+	return d, ok
+}
+
+// compare orders peers by average latency; unmeasured peers go last.
+func (pl *peerLatency) compare(a, b string) int {
+	da, oka := pl.get(a)
+	db, okb := pl.get(b)
+	switch {
+	case oka && okb:
+		return cmp.Compare(da, db)
+	case oka:
+		return -1
+	case okb:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,373 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// ASYNC REPLICATION
+////////////////////////////////////////////////////////////////////////////////
+
+// A sync write waits for W replicas. An async write is acknowledged as
+// soon as the LOCAL write is in the WAL; the copies to the other replicas
+// are queued in the outbox and sent in the background.
+//
+// That trades durability for latency: until the outbox drains, the write
+// lives on one node only. The outbox itself is on disk (outbox.log), so
+// a restart does not lose queued writes — only losing this node's disk
+// does.
+//
+// The outbox keeps the latest value per (peer, key), like hints. A hot key
+// written 1000 times while a peer is slow is still sent once. Delivery goes
+// through /internal/replicate, so clocks decide and redelivering an entry
+// after a crash is harmless.
+//
+// When the outbox is full, async writes fall back to sync replication
+// instead of failing.
+
+// DefaultOutboxSize bounds queued (peer, key) entries.
+const DefaultOutboxSize = 100000
+
+// errOutboxFull makes an async write fall back to sync replication.
+var errOutboxFull = errors.New("async replication outbox is full")
+
+// outboxEntry is one line of outbox.log.
+type outboxEntry struct {
+	Peer  string      `json:"peer"`
+	Key   string      `json:"key"`
+	Value store.Value `json:"value"`
+}
+
+type outboxKey struct{ peer, key string }
+
+// outbox is the durable queue of async replication writes.
+type outbox struct {
+	mu      sync.Mutex
+	path    string   // "" = memory only
+	file    *os.File // append-only log of enqueued entries
+	logged  int      // lines in file; compacted when mostly delivered
+	pending map[outboxKey]store.Value
+	max     int
+	wake    chan struct{} // signals the delivery loop
+}
+
+func newOutbox(max int) *outbox {
+	return &outbox{pending: make(map[outboxKey]store.Value), max: max, wake: make(chan struct{}, 1)}
+}
+
+// OpenOutbox makes the async replication queue durable at path,
+// re-queuing whatever a previous run left undelivered. Call before serving.
+func (rep *Replicator) OpenOutbox(path string) (int, error) {
+	ob := newOutbox(rep.outbox.max)
+	ob.path = path
+
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 64<<20)
+		for sc.Scan() {
+			var e outboxEntry
+			if json.Unmarshal(sc.Bytes(), &e) != nil {
+				continue // torn last line after a crash
+			}
+			ob.put(e)
+			ob.logged++
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return 0, err
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	ob.file = f
+	rep.outbox = ob
+	return len(ob.pending), nil
+}
+
+// put records e in pending, unless a newer value is already queued.
+// Caller must hold ob.mu (or own ob exclusively).
+func (ob *outbox) put(e outboxEntry) {
+	k := outboxKey{e.Peer, e.Key}
+	if old, ok := ob.pending[k]; ok && e.Value.Clock.Compare(old.Clock) == store.Before {
+		return
+	}
+	ob.pending[k] = e.Value
+}
+
+// enqueue durably queues entries. Either all of them are queued or none.
+func (ob *outbox) enqueue(entries []outboxEntry) error {
+	var buf []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	ob.mu.Lock()
+	if len(ob.pending)+len(entries) > ob.max {
+		ob.mu.Unlock()
+		return errOutboxFull
+	}
+	if ob.file != nil {
+		if _, err := ob.file.Write(buf); err != nil {
+			ob.mu.Unlock()
+			return err
+		}
+		ob.logged += len(entries)
+	}
+	for _, e := range entries {
+		ob.put(e)
+	}
+	f := ob.file
+	ob.mu.Unlock()
+
+	select {
+	case ob.wake <- struct{}{}:
+	default:
+	}
+	if f == nil {
+		return nil
+	}
+	// Outside the lock, as in the WAL: concurrent writers share flushes.
+	// If compact swapped the file meanwhile, the new one (already synced)
+	// holds our entries.
+	if err := f.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// remove drops a delivered entry, unless it was replaced meanwhile,
+// and compacts the log once most of it is delivered.
+func (ob *outbox) remove(peerID, key string, delivered store.Value) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	k := outboxKey{peerID, key}
+	if cur, ok := ob.pending[k]; ok && cur.Clock.Compare(delivered.Clock) == store.Equal {
+		delete(ob.pending, k)
+	}
+	ob.compact()
+}
+
+// drop forgets every entry for peerID (e.g. it left the cluster).
+func (ob *outbox) drop(peerID string) int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	n := 0
+	for k := range ob.pending {
+		if k.peer == peerID {
+			delete(ob.pending, k)
+			n++
+		}
+	}
+	ob.compact()
+	return n
+}
+
+// compact rewrites outbox.log with just the pending entries, when the log
+// is empty of live entries or mostly delivered. Caller must hold ob.mu.
+func (ob *outbox) compact() {
+	if ob.file == nil || ob.logged == 0 {
+		return
+	}
+	if len(ob.pending) > 0 && ob.logged < 2*len(ob.pending)+1000 {
+		return
+	}
+	if len(ob.pending) == 0 {
+		if err := ob.file.Truncate(0); err == nil {
+			ob.logged = 0
+		}
+		return
+	}
+
+	tmp := ob.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return // keep the long log; it is still correct
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for k, v := range ob.pending {
+		if err := enc.Encode(outboxEntry{Peer: k.peer, Key: k.key, Value: v}); err != nil {
+			f.Close()
+			return
+		}
+	}
+	if w.Flush() != nil || f.Sync() != nil || f.Close() != nil || os.Rename(tmp, ob.path) != nil {
+		return
+	}
+	nf, err := os.OpenFile(ob.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	ob.file.Close()
+	ob.file = nf
+	ob.logged = len(ob.pending)
+}
+
+// byPeer copies the pending entries grouped by peer.
+func (ob *outbox) byPeer() map[string]map[string]store.Value {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	out := make(map[string]map[string]store.Value)
+	for k, v := range ob.pending {
+		q, ok := out[k.peer]
+		if !ok {
+			q = make(map[string]store.Value)
+			out[k.peer] = q
+		}
+		q[k.key] = v
+	}
+	return out
+}
+
+// counts returns queued entries per peer.
+func (ob *outbox) counts() map[string]int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	out := make(map[string]int)
+	for k := range ob.pending {
+		out[k.peer]++
+	}
+	return out
+}
+
+// close closes the log file.
+func (ob *outbox) close() error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.file == nil {
+		return nil
+	}
+	return ob.file.Close()
+}
+
+// CloseOutbox closes outbox.log. Queued entries are kept for the next run.
+func (rep *Replicator) CloseOutbox() error {
+	return rep.outbox.close()
+}
+
+// ─── Writes ───────────────────────────────────────────────────────────────────
+
+// ReplicateWriteAsync writes locally and queues the copies for the other
+// replicas. It returns as soon as both are on disk.
+func (rep *Replicator) ReplicateWriteAsync(ctx context.Context, key, data, contentType string, clock store.VectorClock) (store.Value, error) {
+	val, err := rep.store.Put(ctx, key, data, contentType, clock)
+	if err != nil {
+		return store.Value{}, fmt.Errorf("local write: %w", err)
+	}
+	if err := rep.enqueueReplicas(key, val); err != nil {
+		return rep.fallbackSync(ctx, key, val, err)
+	}
+	rep.publishCommitted(ctx, store.BatchEntry{Key: key, Value: val})
+	return val, nil
+}
+
+// DeleteAsync deletes locally and queues the tombstone for the other replicas.
+func (rep *Replicator) DeleteAsync(ctx context.Context, key string) error {
+	if err := rep.store.Delete(ctx, key); err != nil {
+		return err
+	}
+	val, _ := rep.store.GetRaw(key)
+	if err := rep.enqueueReplicas(key, val); err != nil {
+		_, err = rep.fallbackSync(ctx, key, val, err)
+		return err
+	}
+	rep.publishCommitted(ctx, store.BatchEntry{Key: key, Value: val})
+	return nil
+}
+
+// enqueueReplicas queues val for every replica of key except us.
+func (rep *Replicator) enqueueReplicas(key string, val store.Value) error {
+	peers := append(rep.peersOnly(rep.membership.ReplicaNodes(key, rep.Quorum().N)), rep.pendingPeers(key)...)
+	if len(peers) == 0 {
+		return nil
+	}
+	entries := make([]outboxEntry, len(peers))
+	for i, p := range peers {
+		entries[i] = outboxEntry{Peer: p.ID, Key: key, Value: val}
+	}
+	return rep.outbox.enqueue(entries)
+}
+
+// fallbackSync replicates an already-local write synchronously,
+// after the outbox refused it with cause.
+func (rep *Replicator) fallbackSync(ctx context.Context, key string, val store.Value, cause error) (store.Value, error) {
+	logging.FromContext(ctx).Warn("async write replicated synchronously", "key", key, "reason", cause)
+	release, err := rep.bp.admit(ctx)
+	if err != nil {
+		return store.Value{}, err
+	}
+	defer release()
+	if err := rep.awaitWriteQuorum(ctx, key, val); err != nil {
+		return store.Value{}, err
+	}
+	rep.publishCommitted(ctx, store.BatchEntry{Key: key, Value: val})
+	return val, nil
+}
+
+// ─── Delivery ─────────────────────────────────────────────────────────────────
+
+// RunOutbox delivers queued async writes until ctx is done.
+// It wakes on every enqueue, and retries failed peers every retry interval.
+func (rep *Replicator) RunOutbox(ctx context.Context, retry time.Duration) {
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rep.outbox.wake:
+		case <-ticker.C:
+		}
+		rep.deliverOutbox(ctx)
+	}
+}
+
+// deliverOutbox makes one pass over the outbox, one goroutine per peer.
+// A peer that fails once is skipped until the next pass.
+func (rep *Replicator) deliverOutbox(ctx context.Context) {
+	var wg sync.WaitGroup
+	for peerID, entries := range rep.outbox.byPeer() {
+		peer, ok := rep.membership.GetNode(peerID)
+		if !ok {
+			logging.FromContext(ctx).Warn("dropping async writes for departed peer",
+				"peer", peerID, "count", rep.outbox.drop(peerID))
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key, val := range entries {
+				if err := rep.doHTTPReplicate(ctx, peer, ReplicateRequest{Key: key, Value: val}); err != nil {
+					rep.stats.retry(peerID)
+					return
+				}
+				rep.outbox.remove(peerID, key, val)
+				rep.stats.success(peerID)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// PROTOCOL VERSIONS
+////////////////////////////////////////////////////////////////////////////////
+
+// During a rolling upgrade, nodes of two builds share the cluster. Each
+// build speaks a wire protocol: a number raised whenever peers gain a
+// request or an encoding that older builds do not understand.
+//
+//	1  JSON replicate and fetch bodies
+//	2  msgpack replicate bodies and fetch responses (codec.go)
+//	3  POST /internal/replicate/batch (replbatch.go), protocol headers
+//
+// Every peer request and every response to one carries the sender's
+// protocol and build (ProtocolHeader, VersionHeader); /health has them
+// too. A node remembers what each peer last announced and talks to it in
+// what both understand: JSON to a peer below 2, single writes below 3.
+//
+// A peer that sends no header predates them. It is probed as before: a
+// 400 to msgpack or a 404 to a batch makes us fall back and remember.
+// Either way an upgraded peer is picked up from its next request or
+// readiness probe, without restarting anything.
+//
+// GET /cluster/status lists every node's build and protocol, and the
+// cluster protocol: the lowest of them, which every pair can speak. The
+// upgrade is over when it is ProtocolVersion.
+
+// Protocol levels.
+const (
+	protoJSON    = 1
+	protoMsgpack = 2
+	protoBatch   = 3
+)
+
+// ProtocolVersion is the wire protocol this build speaks.
+const ProtocolVersion = protoBatch
+
+// Headers on peer requests and responses.
+const (
+	ProtocolHeader = "X-KV-Protocol" // the sender's ProtocolVersion
+	VersionHeader  = "X-KV-Version"  // the sender's build
+)
+
+// NodeVersion is what a node runs, as last heard.
+type NodeVersion struct {
+	Node     string    `json:"node"`
+	Version  string    `json:"version,omitempty"`
+	Protocol int       `json:"protocol,omitempty"` // 0 = not heard from, or predates protocol headers
+	SeenAt   time.Time `json:"seen_at,omitzero"`
+}
+
+// peerVersions remembers what each peer announced.
+type peerVersions struct{ m sync.Map } // peer ID → NodeVersion
+
+func (pv *peerVersions) get(id string) NodeVersion {
+	if v, ok := pv.m.Load(id); ok {
+		return v.(NodeVersion)
+	}
+	return NodeVersion{Node: id}
+}
+
+// SetProtocolHeaders announces our protocol and build on a peer request
+// or a response to one.
+func (rep *Replicator) SetProtocolHeaders(h http.Header) {
+	h.Set(ProtocolHeader, strconv.Itoa(ProtocolVersion))
+	if rep.version != "" {
+		h.Set(VersionHeader, rep.version)
+	}
+}
+
+// ObserveVersion records the protocol and build peerID announced in h.
+// Headers without a protocol (older peers, clients) change nothing.
+func (rep *Replicator) ObserveVersion(ctx context.Context, peerID string, h http.Header) {
+	p, err := strconv.Atoi(h.Get(ProtocolHeader))
+	if err != nil || p < protoJSON || peerID == "" || peerID == rep.selfID {
+		return
+	}
+	nv := NodeVersion{Node: peerID, Version: h.Get(VersionHeader), Protocol: p, SeenAt: time.Now().UTC()}
+	old := rep.peerVersions.get(peerID)
+	if old.Protocol == p && old.Version == nv.Version && nv.SeenAt.Sub(old.SeenAt) < time.Second {
+		return
+	}
+	rep.peerVersions.m.Store(peerID, nv)
+	if old.Protocol == p && old.Version == nv.Version {
+		return
+	}
+
+	// What it can read now, it is sent from now on.
+	if p >= protoMsgpack {
+		rep.jsonOnly.m.Delete(peerID)
+	}
+	if p >= protoBatch {
+		rep.replBatch.unbatched.Delete(peerID)
+	}
+	if old.Protocol != 0 {
+		logging.FromContext(ctx).Info("peer version changed", "peer", peerID,
+			"version", nv.Version, "protocol", p, "was", old.Version, "was_protocol", old.Protocol)
+	}
+}
+
+// speaks reports whether peerID understands protocol level p: false only
+// if it announced an older one.
+func (rep *Replicator) speaks(peerID string, p int) bool {
+	v := rep.peerVersions.get(peerID).Protocol
+	return v == 0 || v >= p
+}
+
+// NodeVersions returns this node's version and what every other member
+// last announced, by node ID.
+func (rep *Replicator) NodeVersions() []NodeVersion {
+	var out []NodeVersion
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			out = append(out, NodeVersion{Node: n.ID, Version: rep.version, Protocol: ProtocolVersion})
+		} else {
+			out = append(out, rep.peerVersions.get(n.ID))
+		}
+	}
+	slices.SortFunc(out, func(a, b NodeVersion) int { return strings.Compare(a.Node, b.Node) })
+	return out
+}
+
+// ClusterProtocol returns the lowest protocol among the members this
+// node has heard from, itself included.
+func (rep *Replicator) ClusterProtocol() int {
+	lowest := ProtocolVersion
+	for _, v := range rep.NodeVersions() {
+		if v.Protocol > 0 {
+			lowest = min(lowest, v.Protocol)
+		}
+	}
+	return lowest
+}
@@ -0,0 +1,185 @@
+package cluster
+
+import (
+	"cmp"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// VECTOR CLOCK PRUNING
+////////////////////////////////////////////////////////////////////////////////
+
+// The store strips the clock entries of nodes that left (store/clockprune.go);
+// this side decides which nodes those are. Every 30s the members are
+// compared with the last ones seen, and departures are timestamped in
+// departed.json, so a restart does not reset the window.
+//
+// A node's entries are pruned --clock-prune-after its departure. The
+// window is for its last writes: hints, outboxes and read repair are
+// still moving them, and replicas that have not yet seen them must not
+// mistake them for old ones. Until then, --clock-max-entries sheds its
+// entries only from clocks that grew past the cap.
+//
+// A node that left before this one first started is never seen leaving,
+// so its entries are only shed past the cap. A node that rejoins under
+// its old ID stops being pruned, but entries already dropped stay
+// dropped: a rejoining node should take a new ID.
+
+// ClockPruneConfig is when dead clock entries go.
+type ClockPruneConfig struct {
+	After      time.Duration // prune a departed node's entries this long after it left; 0 = never
+	MaxEntries int           // shed departed nodes' entries from longer clocks; 0 = no cap
+}
+
+// DefaultClockPruneConfig is used unless flags say otherwise.
+var DefaultClockPruneConfig = ClockPruneConfig{After: 7 * 24 * time.Hour, MaxEntries: 32}
+
+// departureCheckEvery is how often membership is compared for departures.
+const departureCheckEvery = 30 * time.Second
+
+// departures is each departed node's leave time, as this node saw it.
+type departures struct {
+	mu   sync.Mutex
+	cfg  ClockPruneConfig
+	path string
+	file departedFile
+}
+
+// departedFile is the content of departed.json.
+type departedFile struct {
+	Members []string             `json:"members"` // as of the last check
+	Left    map[string]time.Time `json:"left"`
+}
+
+// OpenClockPruning loads departures from path and starts pruning with cfg.
+func (rep *Replicator) OpenClockPruning(path string, cfg ClockPruneConfig) error {
+	d := &rep.departures
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cfg, d.path = cfg, path
+	d.file = departedFile{Left: make(map[string]time.Time)}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		d.file.Members = rep.memberIDs()
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &d.file); err != nil {
+			return err
+		}
+		if d.file.Left == nil {
+			d.file.Left = make(map[string]time.Time)
+		}
+	}
+	rep.applyPruning(time.Now())
+	return nil
+}
+
+// RunClockPruning records departures until ctx is done.
+func (rep *Replicator) RunClockPruning(ctx context.Context) {
+	if rep.departures.path == "" {
+		return
+	}
+	t := time.NewTicker(departureCheckEvery)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			rep.checkDepartures(ctx, time.Now())
+		}
+	}
+}
+
+// checkDepartures timestamps the members that left since the last check.
+func (rep *Replicator) checkDepartures(ctx context.Context, now time.Time) {
+	d := &rep.departures
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	logger := logging.FromContext(ctx)
+	members := rep.memberIDs()
+	changed := false
+	for _, id := range d.file.Members {
+		if !slices.Contains(members, id) {
+			d.file.Left[id] = now
+			changed = true
+			logger.Info("node left: its vector clock entries will be pruned", "peer", id, "after", d.cfg.After)
+		}
+	}
+	for _, id := range members {
+		if left, ok := d.file.Left[id]; ok {
+			delete(d.file.Left, id)
+			changed = true
+			if d.cfg.After > 0 && now.Sub(left) >= d.cfg.After {
+				logger.Warn("node rejoined under a pruned ID: its old clock entries are gone, writes may conflict", "peer", id)
+			}
+		}
+	}
+	if !slices.Equal(members, d.file.Members) {
+		d.file.Members = members
+		changed = true
+	}
+	if changed {
+		if err := d.save(); err != nil {
+			logger.Error("save departed nodes", "error", err)
+		}
+	}
+	rep.applyPruning(now)
+}
+
+// applyPruning hands the store the departures as of now. Caller must hold
+// rep.departures.mu.
+func (rep *Replicator) applyPruning(now time.Time) {
+	d := &rep.departures
+	p := store.ClockPruning{Pruned: make(map[string]bool), MaxEntries: d.cfg.MaxEntries}
+	for id, left := range d.file.Left {
+		if d.cfg.After > 0 && now.Sub(left) >= d.cfg.After {
+			p.Pruned[id] = true
+		} else {
+			p.Departed = append(p.Departed, id)
+		}
+	}
+	slices.SortFunc(p.Departed, func(a, b string) int {
+		if c := d.file.Left[a].Compare(d.file.Left[b]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	rep.store.SetClockPruning(p)
+}
+
+// save writes departed.json (tmp + rename). Caller must hold d.mu.
+func (d *departures) save() error {
+	data, err := json.Marshal(d.file)
+	if err != nil {
+		return err
+	}
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.path)
+}
+
+// memberIDs returns the current members' IDs, sorted.
+func (rep *Replicator) memberIDs() []string {
+	nodes := rep.membership.All()
+	ids := make([]string, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,270 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// RUNTIME QUORUM CHANGES
+////////////////////////////////////////////////////////////////////////////////
+
+// N, W and R used to be fixed by flags at process start. Changing them
+// meant restarting every node with new flags — and until the last one was
+// restarted, nodes disagreed on who owns a key.
+//
+// Now the quorum is a versioned config:
+//
+//  1. PUT /admin/quorum on any node validates it, bumps the version and
+//     applies it locally.
+//  2. The node broadcasts it to every member (PUT /internal/quorum).
+//     A member only applies a config newer than its own, so late or
+//     repeated deliveries are harmless.
+//  3. Every node persists it to quorum.json, which wins over the flags
+//     on restart.
+//
+// Two operators changing it at the same time on different nodes produce
+// the same version; the config from the higher node ID wins everywhere.
+//
+// When N grows, a key gains replicas that never saw it. Each node then
+// walks its local data and pushes every key to its NEW replicas
+// (Rereplicate). Reads in the meantime are still correct: read repair
+// fills any replica the pass has not reached yet.
+//
+// Shrinking N does not delete anything: the extra copies simply stop
+// being read or written.
+
+// QuorumConfig is one version of the cluster's replication settings.
+type QuorumConfig struct {
+	N       int    `json:"n"`
+	W       int    `json:"w"`
+	R       int    `json:"r"`
+	Version uint64 `json:"version"`
+	Origin  string `json:"origin,omitempty"` // node that made the change
+}
+
+// ErrInvalidQuorum wraps every Validate failure.
+var ErrInvalidQuorum = errors.New("invalid quorum")
+
+// Validate checks the quorum rules. nodes <= 0 skips the cluster-size check.
+func (q QuorumConfig) Validate(nodes int) error {
+	switch {
+	case q.N < 1:
+		return fmt.Errorf("%w: N must be at least 1", ErrInvalidQuorum)
+	case q.W < 1 || q.W > q.N:
+		return fmt.Errorf("%w: W(%d) must be between 1 and N(%d)", ErrInvalidQuorum, q.W, q.N)
+	case q.R < 1 || q.R > q.N:
+		return fmt.Errorf("%w: R(%d) must be between 1 and N(%d)", ErrInvalidQuorum, q.R, q.N)
+	case q.W+q.R <= q.N:
+		return fmt.Errorf("%w: W(%d) + R(%d) must be > N(%d) for strong consistency", ErrInvalidQuorum, q.W, q.R, q.N)
+	case nodes > 0 && q.N > nodes:
+		return fmt.Errorf("%w: N(%d) exceeds the cluster size (%d nodes)", ErrInvalidQuorum, q.N, nodes)
+	}
+	return nil
+}
+
+// newerThan reports whether q should replace cur.
+func (q QuorumConfig) newerThan(cur QuorumConfig) bool {
+	if q.Version != cur.Version {
+		return q.Version > cur.Version
+	}
+	return q.Origin > cur.Origin
+}
+
+// RereplicationStatus reports the background pass started when N grows.
+type RereplicationStatus struct {
+	Running  bool      `json:"running"`
+	FromN    int       `json:"from_n,omitempty"`
+	ToN      int       `json:"to_n,omitempty"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+	Keys     int       `json:"keys"`   // keys that gained a replica
+	Sent     int       `json:"sent"`   // copies delivered
+	Failed   int       `json:"failed"` // copies left to hinted handoff
+}
+
+// Quorum returns the current quorum config.
+func (rep *Replicator) Quorum() QuorumConfig {
+	rep.quorumMu.RLock()
+	defer rep.quorumMu.RUnlock()
+	return rep.quorum
+}
+
+// Rereplication returns the state of the last re-replication pass.
+func (rep *Replicator) Rereplication() RereplicationStatus {
+	rep.quorumMu.RLock()
+	defer rep.quorumMu.RUnlock()
+	return rep.rereplication
+}
+
+// InitQuorum sets where the quorum config is persisted and picks the
+// starting config: def, unless path holds a newer one from an earlier run.
+func (rep *Replicator) InitQuorum(path string, def QuorumConfig) error {
+	q := def
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var saved QuorumConfig
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		if saved.newerThan(def) {
+			q = saved
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	if err := q.Validate(0); err != nil {
+		return err
+	}
+
+	rep.quorumMu.Lock()
+	rep.quorum, rep.quorumFile = q, path
+	rep.quorumMu.Unlock()
+	return nil
+}
+
+// SetQuorum changes N/W/R cluster-wide (steps 1 and 2 above).
+//
+// The new config is returned even when some peers could not be reached;
+// the error then lists them.
+func (rep *Replicator) SetQuorum(ctx context.Context, n, w, r int) (QuorumConfig, error) {
+	rep.quorumMu.Lock()
+	old := rep.quorum
+	q := QuorumConfig{N: n, W: w, R: r, Version: old.Version + 1, Origin: rep.selfID}
+	if err := q.Validate(rep.membership.Ring().NodeCount()); err != nil {
+		rep.quorumMu.Unlock()
+		return QuorumConfig{}, err
+	}
+	rep.quorum = q
+	rep.quorumMu.Unlock()
+
+	rep.quorumChanged(ctx, old, q)
+	return q, rep.Broadcast(ctx, http.MethodPut, "/internal/quorum", q)
+}
+
+// ApplyQuorum installs a config broadcast by a peer if it is newer
+// than ours. It reports whether anything changed.
+func (rep *Replicator) ApplyQuorum(ctx context.Context, q QuorumConfig) (bool, error) {
+	if err := q.Validate(0); err != nil {
+		return false, err
+	}
+
+	rep.quorumMu.Lock()
+	old := rep.quorum
+	if !q.newerThan(old) {
+		rep.quorumMu.Unlock()
+		return false, nil
+	}
+	rep.quorum = q
+	rep.quorumMu.Unlock()
+
+	rep.quorumChanged(ctx, old, q)
+	return true, nil
+}
+
+// quorumChanged persists q and, if N grew, starts re-replication.
+func (rep *Replicator) quorumChanged(ctx context.Context, old, q QuorumConfig) {
+	logger := logging.FromContext(ctx)
+	logger.Info("quorum changed", "n", q.N, "w", q.W, "r", q.R, "version", q.Version, "origin", q.Origin)
+
+	if err := rep.saveQuorum(q); err != nil {
+		// Not fatal: we run with q now, and peers persisted it too.
+		logger.Error("persist quorum", "error", err)
+	}
+	if q.N > old.N {
+		// Detach from the request: the pass outlives it.
+		go rep.Rereplicate(logging.WithRequestID(context.Background(), logging.RequestID(ctx)), old.N, q.N)
+	}
+}
+
+// saveQuorum writes q to the quorum file (tmp + rename, like snapshots).
+func (rep *Replicator) saveQuorum(q QuorumConfig) error {
+	rep.quorumMu.RLock()
+	path := rep.quorumFile
+	rep.quorumMu.RUnlock()
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Rereplicate pushes every local record to the replicas it gained when
+// N went from oldN to newN. Tombstones are pushed too, so a deleted key
+// cannot come back from a replica that missed the delete.
+//
+// Only one pass runs at a time; a second call waits for the first.
+func (rep *Replicator) Rereplicate(ctx context.Context, oldN, newN int) {
+	rep.rereplicateMu.Lock()
+	defer rep.rereplicateMu.Unlock()
+
+	status := RereplicationStatus{Running: true, FromN: oldN, ToN: newN, Started: time.Now().UTC()}
+	rep.setRereplication(status)
+
+	logger := logging.FromContext(ctx)
+	logger.Info("re-replication started", "from_n", oldN, "to_n", newN)
+
+	recs, _ := rep.store.BackupRecords()
+	for _, rec := range recs {
+		if ctx.Err() != nil {
+			break
+		}
+		before := rep.membership.ReplicaNodes(rec.Key, oldN)
+		var added []*Node
+		for _, n := range rep.membership.ReplicaNodes(rec.Key, newN) {
+			if n.ID != rep.selfID && !slices.ContainsFunc(before, func(b *Node) bool { return b.ID == n.ID }) {
+				added = append(added, n)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+
+		status.Keys++
+		for _, n := range added {
+			// sendReplicateRequest queues a hint on failure,
+			// so a down replica still gets the copy later.
+			if err := rep.sendReplicateRequest(ctx, n, rec.Key, rec.Value); err != nil {
+				status.Failed++
+			} else {
+				status.Sent++
+			}
+		}
+		if status.Keys%1000 == 0 {
+			rep.setRereplication(status)
+		}
+	}
+
+	status.Running, status.Finished = false, time.Now().UTC()
+	rep.setRereplication(status)
+
+	level := slog.LevelInfo
+	if status.Failed > 0 {
+		level = slog.LevelWarn
+	}
+	logger.Log(ctx, level, "re-replication finished", "keys", status.Keys, "sent", status.Sent,
+		"failed", status.Failed, "took", time.Since(status.Started))
+}
+
+func (rep *Replicator) setRereplication(s RereplicationStatus) {
+	rep.quorumMu.Lock()
+	rep.rereplication = s
+	rep.quorumMu.Unlock()
+}
@@ -0,0 +1,321 @@
+package cluster
+
+import (
+	"container/list"
+	"context"
+	"distributed-kvstore/internal/metrics"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// READ CACHE
+////////////////////////////////////////////////////////////////////////////////
+
+// Every quorum read asks R replicas. For a hot key read thousands of
+// times a second and written rarely, that is R network calls per read
+// for the same answer. The read cache keeps the winners of recent client
+// reads (GET, batch gets) on the coordinator, in an LRU of --read-cache-size
+// entries, and answers repeats from memory.
+//
+// An entry is one key at one version (its clock). It goes away when:
+//
+//   - this node applies another version of the key: a local write, a
+//     replicated one, a repair. The store's change feed tells the cache;
+//     a change at the cached clock (read repair writing the winner back)
+//     keeps the entry.
+//   - its TTL passes (--read-cache-ttl). This is the bound for writes
+//     this node never saw: a write whose W acks came from other replicas
+//     reaches us only with the hint or the next repair.
+//   - the change feed overflows: the whole cache is dropped.
+//
+// So a cached read may be up to TTL stale, where a quorum read would not.
+// Reads carrying a session (see session.go) never get a version older
+// than their token. Compare-and-set paths (transactions, counters, locks,
+// If-Match) read through CoordinateRead and never see the cache.
+
+// ReadCacheConfig sizes the read cache.
+type ReadCacheConfig struct {
+	Size int           // entries; 0 turns the cache off
+	TTL  time.Duration // longest an entry is served
+}
+
+// DefaultReadCacheConfig is used unless SetReadCache is called: off.
+var DefaultReadCacheConfig = ReadCacheConfig{TTL: time.Second}
+
+// Validate checks that c is usable.
+func (c ReadCacheConfig) Validate() error {
+	if c.Size < 0 {
+		return errors.New("read cache size must not be negative")
+	}
+	if c.Size > 0 && c.TTL <= 0 {
+		return errors.New("read cache TTL must be positive")
+	}
+	return nil
+}
+
+// ReadCacheStats describes the read cache of one node.
+type ReadCacheStats struct {
+	Size          int    `json:"size"` // 0 = off
+	Entries       int    `json:"entries"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// readCache is an LRU of read winners. The zero value is off.
+type readCache struct {
+	mu      sync.Mutex
+	cfg     ReadCacheConfig
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+	stats   ReadCacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	value   store.Value
+	expires time.Time
+}
+
+// SetReadCache sizes the read cache, dropping what it holds. Call it
+// before RunReadCache.
+func (rep *Replicator) SetReadCache(cfg ReadCacheConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	c := &rep.readCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = cfg
+	c.stats.Size = cfg.Size
+	c.clearLocked()
+	return nil
+}
+
+// ReadCacheStats returns the read cache's counters.
+func (rep *Replicator) ReadCacheStats() ReadCacheStats {
+	c := &rep.readCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.stats
+	st.Entries = len(c.entries)
+	return st
+}
+
+// CachedRead is CoordinateRead for client reads: through the read cache,
+// and shared with concurrent reads of key (see coalesce.go).
+func (rep *Replicator) CachedRead(ctx context.Context, key string) (*store.Value, error) {
+	c := &rep.readCache
+	if !c.on() {
+		return rep.readLive(ctx, key, rep.sharedRead)
+	}
+	s, session := sessionFrom(ctx)
+	// An entry does not outlive its value's TTL (see store/ttl.go).
+	now := time.Now()
+	if v, ok := c.get(key, func(v *store.Value) bool { return (!session || s.Covers(v)) && !v.Expired(now) }); ok {
+		return &v, nil
+	}
+	v, err := rep.readLive(ctx, key, rep.sharedRead)
+	if err == nil && v != nil {
+		c.add(key, *v, func() bool { return rep.heldNoNewer(key, *v) })
+	}
+	return v, err
+}
+
+// heldNoNewer reports whether this node's own copy of key is not newer
+// than v. If it is, a write raced with the read and its change may
+// already have gone by: caching v would keep it past the invalidation.
+// A write applied after the check is invalidated after add, which holds
+// the cache lock across both.
+func (rep *Replicator) heldNoNewer(key string, v store.Value) bool {
+	local, ok := rep.store.GetRaw(key)
+	if !ok {
+		return true
+	}
+	rel := local.Clock.Compare(v.Clock)
+	return rel == store.Before || rel == store.Equal
+}
+
+// RunReadCache drops cache entries as this node applies new versions,
+// until ctx is done. It returns at once if the cache is off.
+func (rep *Replicator) RunReadCache(ctx context.Context) {
+	c := &rep.readCache
+	if !c.on() {
+		return
+	}
+	for {
+		w := rep.store.Watch("")
+		// Anything cached before we subscribed may have missed its change.
+		c.clear()
+		if !c.drain(ctx, w) {
+			w.Close()
+			return
+		}
+	}
+}
+
+// drain invalidates entries from w until ctx is done (false) or w
+// overflows (true).
+func (c *readCache) drain(ctx context.Context, w *store.Watcher) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case ch, ok := <-w.C:
+			if !ok {
+				return true
+			}
+			c.invalidate(ch.Key, ch.Value.Clock)
+		}
+	}
+}
+
+func (c *readCache) on() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cfg.Size > 0
+}
+
+// get returns the cached winner of key if it is fresh and usable says
+// so, counting a hit or a miss.
+func (c *readCache) get(key string, usable func(*store.Value) bool) (store.Value, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return store.Value{}, false
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		c.stats.Misses++
+		return store.Value{}, false
+	}
+	if !usable(&e.value) {
+		c.stats.Misses++
+		return store.Value{}, false
+	}
+	c.lru.MoveToFront(el)
+	c.stats.Hits++
+	return e.value, true
+}
+
+// add caches v as the winner of key if current says it still is,
+// evicting the least recently used entry if the cache is full.
+func (c *readCache) add(key string, v store.Value, current func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cfg.Size == 0 || !current() {
+		return
+	}
+	expires := time.Now().Add(c.cfg.TTL)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.value, e.expires = v, expires
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: v, expires: expires})
+	for c.lru.Len() > c.cfg.Size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidate drops key unless it is cached at clock.
+func (c *readCache) invalidate(key string, clock store.VectorClock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok || el.Value.(*cacheEntry).value.Clock.Compare(clock) == store.Equal {
+		return
+	}
+	c.lru.Remove(el)
+	delete(c.entries, key)
+	c.stats.Invalidations++
+}
+
+func (c *readCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clearLocked()
+}
+
+func (c *readCache) clearLocked() {
+	c.lru = list.New()
+	c.entries = make(map[string]*list.Element)
+}
+
+// RegisterMetrics adds the replicator's read cache, read coalescing,
+// replicate batching, eviction webhook, event sink and cross-cluster
+// counters to reg.
+func (rep *Replicator) RegisterMetrics(reg *metrics.Registry) {
+	sinks := func(f func(SinkStats) float64) func() float64 {
+		return func() float64 {
+			var n float64
+			for _, s := range rep.SinkStats() {
+				n += f(s)
+			}
+			return n
+		}
+	}
+	reg.CounterFunc("kv_sink_published_total", "Committed writes queued for event sinks, summed over sinks.",
+		sinks(func(s SinkStats) float64 { return float64(s.Published) }))
+	reg.CounterFunc("kv_sink_delivered_total", "Events event sinks accepted.",
+		sinks(func(s SinkStats) float64 { return float64(s.Delivered) }))
+	reg.CounterFunc("kv_sink_dropped_total", "Events dropped because a sink's queue was full.",
+		sinks(func(s SinkStats) float64 { return float64(s.Dropped) }))
+	reg.GaugeFunc("kv_sink_pending", "Events queued for event sinks and not yet delivered.",
+		sinks(func(s SinkStats) float64 { return float64(s.Pending) }))
+	bridge := func(f func(*RemoteClusterStats) float64) func() float64 {
+		return func() float64 {
+			if s := rep.RemoteClusterStats(); s != nil {
+				return f(s)
+			}
+			return 0
+		}
+	}
+	reg.CounterFunc("kv_xdc_shipped_total", "Writes shipped to the remote cluster.",
+		bridge(func(s *RemoteClusterStats) float64 { return float64(s.Shipped) }))
+	reg.GaugeFunc("kv_xdc_lag_changes", "Changes logged here and not yet shipped to the remote cluster.",
+		bridge(func(s *RemoteClusterStats) float64 { return float64(s.Lag) }))
+	reg.CounterFunc("kv_xdc_gaps_total", "Times changes were deleted before they were shipped to the remote cluster.",
+		bridge(func(s *RemoteClusterStats) float64 { return float64(s.Gaps) }))
+	reg.CounterFunc("kv_xdc_applied_total", "Writes from other clusters applied as their coordinator.",
+		func() float64 { return float64(rep.XDCApplied()) })
+	reg.CounterFunc("kv_eviction_webhook_sent_total", "Eviction events the eviction webhook accepted.",
+		func() float64 { return float64(rep.EvictionWebhookStats().Sent) })
+	reg.CounterFunc("kv_eviction_webhook_dropped_total", "Eviction events dropped after the webhook's retries ran out.",
+		func() float64 { return float64(rep.EvictionWebhookStats().Dropped) })
+	reg.CounterFunc("kv_replicate_batches_total", "Replicate batches sent to peers.",
+		func() float64 { return float64(rep.ReplicateBatchStats().Batches) })
+	reg.CounterFunc("kv_replicate_batched_writes_total", "Replicated writes sent to peers in batches.",
+		func() float64 { return float64(rep.ReplicateBatchStats().Writes) })
+	reg.CounterFunc("kv_reads_coalesced_total", "Client reads that shared a concurrent quorum read of the same key.",
+		func() float64 { return float64(rep.CoalescedReads()) })
+	reg.CounterFunc("kv_reads_local_total", "Reads that needed one answer, served from this node's copy.",
+		func() float64 { return float64(rep.LocalReads()) })
+	reg.CounterFunc("kv_reads_hedged_total", "Reads that asked a spare replica after the hedge delay.",
+		func() float64 { return float64(rep.HedgeStats().Hedged) })
+	reg.CounterFunc("kv_reads_hedge_won_total", "Hedged reads whose spare replica answered first.",
+		func() float64 { return float64(rep.HedgeStats().Won) })
+	reg.GaugeFunc("kv_read_hedge_delay_seconds", "Current hedge delay: the p99 of recent peer fetches, at least --hedge-min-delay.",
+		func() float64 { return rep.HedgeStats().DelayMs / 1000 })
+	stat := func(f func(ReadCacheStats) float64) func() float64 {
+		return func() float64 { return f(rep.ReadCacheStats()) }
+	}
+	reg.CounterFunc("kv_read_cache_hits_total", "Client reads answered from the read cache.",
+		stat(func(s ReadCacheStats) float64 { return float64(s.Hits) }))
+	reg.CounterFunc("kv_read_cache_misses_total", "Client reads that went to a quorum with the read cache on.",
+		stat(func(s ReadCacheStats) float64 { return float64(s.Misses) }))
+	reg.CounterFunc("kv_read_cache_invalidations_total", "Read cache entries dropped because a newer version was applied.",
+		stat(func(s ReadCacheStats) float64 { return float64(s.Invalidations) }))
+	reg.GaugeFunc("kv_read_cache_entries", "Keys in the read cache.",
+		stat(func(s ReadCacheStats) float64 { return float64(s.Entries) }))
+}
@@ -0,0 +1,225 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// READINESS
+////////////////////////////////////////////////////////////////////////////////
+
+// A node is alive as soon as its process answers, but only ready for
+// client traffic once it can do its job:
+//
+//   - wal:    the store is loaded (the WAL and snapshots replayed). The
+//     Replicator exists only after that, so this check always passes here;
+//     see api.StartupHandler for what answers before.
+//   - ring:   this node is a member of the ring it routes with (not after
+//     it left or was decommissioned).
+//   - quorum: enough nodes, this one included, are up to gather
+//     max(W, R) replicas.
+//   - fence:  this node's ring is the one most nodes have (see fencing.go).
+//
+// Once shutdown has begun (see shutdown.go) a "shutdown" check fails too.
+//
+// RunReadiness re-checks periodically. Ready reports the latest result;
+// a node that is not ready shows it on /readyz and load balancers route
+// around it. Serving latches: it turns true the first time the node is
+// ready and stays so, because a node that lost its peers later should
+// still answer with quorum errors rather than refuse everything.
+
+// Readiness intervals: quick while starting, relaxed once ready.
+const (
+	readinessStartup = time.Second
+	readinessSteady  = 5 * time.Second
+)
+
+// ReadinessCheck is one condition of readiness.
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Readiness is the response of GET /readyz.
+type Readiness struct {
+	Ready     bool             `json:"ready"`
+	Checks    []ReadinessCheck `json:"checks"`
+	CheckedAt time.Time        `json:"checked_at,omitzero"`
+}
+
+// readiness holds the latest Readiness.
+type readiness struct {
+	mu      sync.Mutex
+	last    Readiness
+	serving atomic.Bool
+}
+
+// Ready returns the latest readiness. Before the first check it is not
+// ready.
+func (rep *Replicator) Ready() Readiness {
+	rep.readiness.mu.Lock()
+	defer rep.readiness.mu.Unlock()
+	if rep.readiness.last.Checks == nil {
+		return Readiness{Checks: []ReadinessCheck{{Name: "startup", Detail: "not checked yet"}}}
+	}
+	if rep.ShuttingDown() {
+		r := rep.readiness.last
+		r.Ready = false
+		r.Checks = append([]ReadinessCheck{{Name: "shutdown", Detail: ErrShuttingDown.Error()}}, r.Checks...)
+		return r
+	}
+	return rep.readiness.last
+}
+
+// Serving reports whether this node has been ready at least once, and
+// so takes coordinator traffic.
+func (rep *Replicator) Serving() bool {
+	return rep.readiness.serving.Load()
+}
+
+// RunReadiness checks readiness now and then periodically until ctx is
+// done.
+func (rep *Replicator) RunReadiness(ctx context.Context) {
+	for {
+		r := rep.CheckReadiness(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		wait := readinessSteady
+		if !r.Ready {
+			wait = readinessStartup
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// CheckReadiness evaluates every check, records the result and returns it.
+func (rep *Replicator) CheckReadiness(ctx context.Context) Readiness {
+	ring := rep.membership.Ring()
+	_, member := rep.membership.GetNode(rep.selfID)
+	health := rep.probePeers(ctx)
+	fence, resyncFrom := rep.fenceCheck(ctx, health)
+	checks := []ReadinessCheck{
+		{Name: "wal", OK: true, Detail: "replayed"},
+		{Name: "ring", OK: member && ring.NodeCount() > 0},
+		rep.quorumCheck(health),
+		fence,
+	}
+	if checks[1].OK {
+		checks[1].Detail = fmt.Sprintf("%d nodes", ring.NodeCount())
+	} else {
+		checks[1].Detail = "this node is not a member"
+	}
+
+	r := Readiness{Ready: true, Checks: checks, CheckedAt: time.Now().UTC()}
+	for _, c := range checks {
+		r.Ready = r.Ready && c.OK
+	}
+	rep.readiness.mu.Lock()
+	rep.readiness.last = r
+	rep.readiness.mu.Unlock()
+	if r.Ready && !rep.readiness.serving.Swap(true) {
+		logging.FromContext(ctx).Info("node is ready", "quorum", checks[2].Detail)
+	}
+	if resyncFrom != "" {
+		if err := rep.adoptRing(ctx, resyncFrom); err != nil && !errors.Is(err, errNotOnMajorityRing) {
+			logging.FromContext(ctx).Warn("fenced node could not resync its ring", "peer", resyncFrom, "error", err)
+		}
+	}
+	return r
+}
+
+// peerHealth is what a peer's /health answered.
+type peerHealth struct {
+	Up   bool
+	Ring *RingView // nil from nodes that predate self-fencing
+}
+
+// probePeers asks every peer's /health, in parallel.
+func (rep *Replicator) probePeers(ctx context.Context) map[string]peerHealth {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		health = make(map[string]peerHealth)
+	)
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Go(func() {
+			h := rep.probePeer(ctx, &n)
+			mu.Lock()
+			health[n.ID] = h
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	return health
+}
+
+// quorumCheck compares the nodes that are up with the largest quorum.
+func (rep *Replicator) quorumCheck(health map[string]peerHealth) ReadinessCheck {
+	q := rep.Quorum()
+	need := max(q.W, q.R)
+	up := 1 // ourselves
+	for _, h := range health {
+		if h.Up {
+			up++
+		}
+	}
+	return ReadinessCheck{
+		Name:   "quorum",
+		OK:     up >= need,
+		Detail: fmt.Sprintf("%d of %d nodes up, %d needed", up, len(health)+1, need),
+	}
+}
+
+// probePeer asks peer's /health. A peer still replaying its WAL is alive
+// but answers "starting", and is not up.
+func (rep *Replicator) probePeer(ctx context.Context, peer *Node) peerHealth {
+	ctx, cancel := rep.peerContext(ctx)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rep.peerURL(peer, "/health"), nil)
+	if err != nil {
+		return peerHealth{}
+	}
+	rep.setHeaders(ctx, req)
+	t0 := time.Now()
+	resp, err := rep.httpClient.Do(req)
+	if err != nil {
+		rep.forgetClock(peer.ID)
+		return peerHealth{}
+	}
+	defer resp.Body.Close()
+	rep.ObserveVersion(ctx, peer.ID, resp.Header)
+	var body struct {
+		Status string    `json:"status"`
+		Ring   string    `json:"ring"`
+		Time   time.Time `json:"time"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&body) != nil || body.Status != "ok" {
+		rep.forgetClock(peer.ID)
+		return peerHealth{}
+	}
+	if !body.Time.IsZero() { // zero from nodes that predate skew probing
+		rep.observeClock(ctx, peer.ID, t0, time.Now(), body.Time)
+	}
+	h := peerHealth{Up: true}
+	if v, ok := ParseRingView(body.Ring); ok {
+		h.Ring = &v
+	}
+	return h
+}
@@ -0,0 +1,343 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// REPAIR
+////////////////////////////////////////////////////////////////////////////////
+
+// Read repair only fixes keys that get read, and only in the background.
+// After an incident an operator wants them fixed NOW, and to see what
+// changed. RepairKey does what a read does, but completely and
+// synchronously:
+//
+//  1. Fetch the key from ALL N replicas (KeyMeta).
+//  2. Reconcile: the winner is the version a read would return.
+//  3. Push the winner to every replica that does not hold it, and wait.
+//
+// One case read repair cannot handle: two copies with the SAME clock but
+// different values (for example two clock-less writes through the same
+// coordinator, one of which a replica missed). Replicas ignore a value
+// whose clock equals theirs, so pushing the winner changes nothing.
+// RepairKey then takes the newest of those copies and writes it as a new
+// version — the merged clocks, bumped on this node — to every replica.
+//
+// A replica that cannot be reached gets a hint, like any failed
+// replication, and is reported as failed.
+
+// KeyRepair reports what RepairKey did.
+type KeyRepair struct {
+	Key      string            `json:"key"`                // internal (namespaced) key
+	Clock    store.VectorClock `json:"clock,omitempty"`    // the winner's; nil if no replica has the key
+	InSync   []string          `json:"in_sync,omitempty"`  // already held the winner
+	Repaired []string          `json:"repaired,omitempty"` // were sent the winner
+	Failed   map[string]string `json:"failed,omitempty"`   // replica → error (hinted)
+	Bumped   bool              `json:"bumped,omitempty"`   // winner re-versioned to settle a conflict
+}
+
+// ErrRepairIncomplete means some replicas could not be repaired.
+var ErrRepairIncomplete = errors.New("repair incomplete")
+
+// RepairKey reconciles key across all its replicas and writes the winner
+// back to every replica that needs it. The error is ErrRepairIncomplete
+// if any replica could not be repaired; the report is filled in either
+// way.
+func (rep *Replicator) RepairKey(ctx context.Context, key string) (KeyRepair, error) {
+	meta := rep.KeyMeta(ctx, key)
+	r := KeyRepair{Key: key}
+
+	// Among same-clock copies the newest wins, as for concurrent ones.
+	var winner *store.Value
+	conflict := false
+	for _, rv := range meta.Replicas {
+		if rv.Relation != "winner" && rv.Relation != "conflict" {
+			continue
+		}
+		conflict = conflict || rv.Relation == "conflict"
+		if winner == nil || store.CompareTime(*rv.Value, *winner) > 0 {
+			winner = rv.Value
+		}
+	}
+	if winner == nil {
+		// Nothing to repair from; unreachable replicas stay unknown.
+		for _, rv := range meta.Replicas {
+			if rv.Error != "" {
+				r.fail(rv.ID, errors.New(rv.Error))
+			}
+		}
+		return r, r.err()
+	}
+
+	val := *winner
+	if conflict {
+		val.Clock = make(store.VectorClock)
+		for _, rv := range meta.Replicas {
+			if rv.Value != nil {
+				val.Clock = val.Clock.Merge(rv.Value.Clock)
+			}
+		}
+		val.Clock.Increment(rep.selfID)
+		val.UpdatedAt, val.HLC = time.Now().UTC(), rep.store.Stamp()
+		r.Bumped = true
+	}
+	r.Clock = val.Clock
+
+	for _, rv := range meta.Replicas {
+		if rv.Relation == "winner" && !conflict {
+			r.InSync = append(r.InSync, rv.ID)
+			continue
+		}
+		if err := rep.repairReplica(ctx, rv.ID, key, val); err != nil {
+			r.fail(rv.ID, err)
+			continue
+		}
+		r.Repaired = append(r.Repaired, rv.ID)
+	}
+	return r, r.err()
+}
+
+// repairReplica writes val to one replica, waiting for it.
+func (rep *Replicator) repairReplica(ctx context.Context, nodeID, key string, val store.Value) error {
+	if nodeID == rep.selfID {
+		_, err := rep.store.ApplyRemote(key, val)
+		return err
+	}
+	node, ok := rep.membership.GetNode(nodeID)
+	if !ok {
+		return ErrUnknownNode
+	}
+	return rep.sendReplicateRequest(ctx, node, key, val)
+}
+
+func (r *KeyRepair) fail(nodeID string, err error) {
+	if r.Failed == nil {
+		r.Failed = make(map[string]string)
+	}
+	r.Failed[nodeID] = err.Error()
+}
+
+func (r *KeyRepair) err() error {
+	if len(r.Failed) > 0 {
+		return ErrRepairIncomplete
+	}
+	return nil
+}
+
+// ─── Full repair ──────────────────────────────────────────────────────────────
+//
+// RepairKey needs to know which key is wrong. A full repair finds out: it
+// walks every token range of the ring and, for each one,
+//
+//  1. asks every replica of the range for a digest of each key it holds
+//     there (tombstones included; see store.Value.Digest)
+//  2. compares them: a key whose digest differs between replicas, or that
+//     some replica lacks, goes through RepairKey
+//
+// Only digests cross the network for keys that are in sync. The job runs
+// in the background on the node it was started on; the status reports
+// its progress. If a replica cannot be reached, the keys of its ranges
+// that look in sync on the others cannot be verified and count as
+// failed.
+
+// Repair job states.
+const (
+	RepairRunning = "running"
+	RepairDone    = "done"
+	RepairFailed  = "failed"
+)
+
+// RepairStatus describes the last full repair started on this node.
+type RepairStatus struct {
+	ID          string    `json:"id,omitempty"`
+	Node        string    `json:"node"`
+	State       string    `json:"state,omitempty"` // "" = never started
+	Ranges      int       `json:"ranges"`
+	RangesDone  int       `json:"ranges_done"`
+	Scanned     int       `json:"scanned"`  // keys compared
+	Repaired    int       `json:"repaired"` // keys RepairKey fixed
+	Failed      int       `json:"failed"`   // keys not repaired or not verified
+	Unreachable []string  `json:"unreachable,omitempty"`
+	Started     time.Time `json:"started,omitzero"`
+	Finished    time.Time `json:"finished,omitzero"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// repairJob tracks the last full repair.
+type repairJob struct {
+	mu     sync.Mutex
+	status RepairStatus
+}
+
+func (j *repairJob) get() RepairStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := j.status
+	st.Unreachable = slices.Clone(st.Unreachable)
+	return st
+}
+
+func (j *repairJob) set(s RepairStatus) {
+	s.Unreachable = slices.Clone(s.Unreachable)
+	j.mu.Lock()
+	j.status = s
+	j.mu.Unlock()
+}
+
+// RepairStatus returns the state of the last full repair.
+func (rep *Replicator) RepairStatus() RepairStatus {
+	st := rep.repairJob.get()
+	st.Node = rep.selfID
+	return st
+}
+
+// StartRepair starts a full repair and returns at once. If one is
+// already running, it returns that one.
+func (rep *Replicator) StartRepair(ctx context.Context) RepairStatus {
+	rep.repairJob.mu.Lock()
+	defer rep.repairJob.mu.Unlock()
+
+	if st := rep.repairJob.status; st.State == RepairRunning {
+		st.Node = rep.selfID
+		return st
+	}
+	now := time.Now().UTC()
+	ranges := rep.membership.Ring().Ranges(rep.Quorum().N)
+	st := RepairStatus{
+		ID:      "repair-" + strconv.FormatInt(now.UnixMilli(), 10),
+		Node:    rep.selfID,
+		State:   RepairRunning,
+		Ranges:  len(ranges),
+		Started: now,
+	}
+	rep.repairJob.status = st
+	// Detach from the request: the run outlives it.
+	go rep.runRepair(logging.WithRequestID(context.Background(), logging.RequestID(ctx)), st, ranges)
+	return st
+}
+
+func (rep *Replicator) runRepair(ctx context.Context, st RepairStatus, ranges []TokenRange) {
+	logger := logging.FromContext(ctx)
+	logger.Info("repair started", "id", st.ID, "ranges", len(ranges))
+
+	for _, tr := range ranges {
+		if ctx.Err() != nil {
+			st.State, st.Error, st.Finished = RepairFailed, ctx.Err().Error(), time.Now().UTC()
+			rep.repairJob.set(st)
+			return
+		}
+		rep.repairRange(ctx, tr, &st)
+		st.RangesDone++
+		rep.repairJob.set(st)
+	}
+
+	st.State, st.Finished = RepairDone, time.Now().UTC()
+	rep.repairJob.set(st)
+	logger.Info("repair finished", "id", st.ID, "scanned", st.Scanned, "repaired", st.Repaired,
+		"failed", st.Failed, "took", time.Since(st.Started))
+}
+
+// repairRange compares the digests of one range across its replicas and
+// repairs the keys that differ, counting into st.
+func (rep *Replicator) repairRange(ctx context.Context, tr TokenRange, st *RepairStatus) {
+	digests := make([]map[string]uint64, len(tr.Replicas))
+	errs := make([]error, len(tr.Replicas))
+	var wg sync.WaitGroup
+	for i, id := range tr.Replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			digests[i], errs[i] = rep.replicaDigests(ctx, id, tr)
+		}()
+	}
+	wg.Wait()
+
+	complete := true
+	keys := make(map[string]struct{})
+	for i, err := range errs {
+		if err != nil {
+			logging.FromContext(ctx).Warn("repair: replica unavailable", "peer", tr.Replicas[i], "error", err)
+			if !slices.Contains(st.Unreachable, tr.Replicas[i]) {
+				st.Unreachable = append(st.Unreachable, tr.Replicas[i])
+				slices.Sort(st.Unreachable)
+			}
+			complete = false
+			continue
+		}
+		for k := range digests[i] {
+			keys[k] = struct{}{}
+		}
+	}
+
+	for key := range keys {
+		st.Scanned++
+		if inSync(digests, errs, key) {
+			if !complete {
+				st.Failed++ // cannot tell what the missing replica holds
+			}
+			continue
+		}
+		if _, err := rep.RepairKey(ctx, key); err != nil {
+			st.Failed++
+		} else {
+			st.Repaired++
+		}
+	}
+}
+
+// inSync reports whether every replica that answered holds key with the
+// same digest.
+func inSync(digests []map[string]uint64, errs []error, key string) bool {
+	var want uint64
+	first := true
+	for i, d := range digests {
+		if errs[i] != nil {
+			continue
+		}
+		got, ok := d[key]
+		if !ok {
+			return false
+		}
+		if first {
+			want, first = got, false
+		} else if got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// LocalDigests returns the digest of every local key in tr.
+func (rep *Replicator) LocalDigests(tr TokenRange) map[string]uint64 {
+	ring := rep.membership.Ring()
+	return rep.store.Digests(func(key string) bool { return tr.Contains(ring.Token(key)) })
+}
+
+// replicaDigests returns the digests replica nodeID holds for tr.
+func (rep *Replicator) replicaDigests(ctx context.Context, nodeID string, tr TokenRange) (map[string]uint64, error) {
+	if nodeID == rep.selfID {
+		return rep.LocalDigests(tr), nil
+	}
+	node, ok := rep.membership.GetNode(nodeID)
+	if !ok {
+		return nil, ErrUnknownNode
+	}
+	var out struct {
+		Digests map[string]uint64 `json:"digests"`
+	}
+	path := fmt.Sprintf("/internal/digests?start=%d&end=%d", tr.Start, tr.End)
+	if err := rep.callPeer(ctx, node, http.MethodGet, path, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Digests, nil
+}
@@ -0,0 +1,271 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/wire"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// REPLICATE BATCHING
+////////////////////////////////////////////////////////////////////////////////
+
+// Every replicated write is one POST per peer: headers, a connection
+// from the pool, a handler, a response. Under heavy write load that
+// per-request cost, not the bytes, is what peers spend their time on.
+//
+// With --replicate-batch N, replicate calls to a peer are queued and sent
+// together in one POST /internal/replicate/batch:
+//
+//   - as soon as N writes are queued for the peer, or
+//   - --replicate-batch-delay after the first one was, whichever comes
+//     first.
+//
+// So a write waits at most the delay longer for its acks, and a busy
+// peer gets N writes per request. Each write still succeeds or fails on
+// its own: the peer applies them one by one and reports the ones it
+// refused (stale routing) or failed to apply. Retries, hints and breakers
+// work as for single writes; a failed batch fails every write in it, and
+// each is retried or hinted by its own caller.
+//
+// Peers that do not know the batch endpoint (404), or announce a
+// protocol without it (see protocol.go), are sent single writes, as
+// jsonOnly peers are sent JSON.
+
+// ReplicateBatchConfig controls replicate batching.
+type ReplicateBatchConfig struct {
+	MaxEntries int           // writes per batch; 0 or 1 turns batching off
+	Delay      time.Duration // longest a write waits for others to join it
+}
+
+// DefaultReplicateBatchConfig is used unless SetReplicateBatch is called:
+// off.
+var DefaultReplicateBatchConfig = ReplicateBatchConfig{Delay: 2 * time.Millisecond}
+
+// Validate checks that c is usable.
+func (c ReplicateBatchConfig) Validate() error {
+	if c.MaxEntries < 0 {
+		return errors.New("replicate batch size must not be negative")
+	}
+	if c.MaxEntries > 1 && c.Delay <= 0 {
+		return errors.New("replicate batch delay must be positive")
+	}
+	return nil
+}
+
+// ReplicateBatchRequest is the body of POST /internal/replicate/batch.
+type ReplicateBatchRequest struct {
+	Writes []ReplicateRequest `json:"writes"`
+}
+
+// ReplicateBatchResponse reports the writes of a batch that were not
+// applied, by index. All others were.
+type ReplicateBatchResponse struct {
+	Stale  []int                   `json:"stale,omitempty"` // not ours on the sender's ring
+	Ring   string                  `json:"ring,omitempty"`  // our ring view, if any were stale
+	Failed []ReplicateBatchFailure `json:"failed,omitempty"`
+}
+
+// ReplicateBatchFailure is one write a peer failed to apply.
+type ReplicateBatchFailure struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// ReplicateBatchStats counts the batches one node sent.
+type ReplicateBatchStats struct {
+	MaxEntries int    `json:"max_entries"` // 0 = off
+	Batches    uint64 `json:"batches"`
+	Writes     uint64 `json:"writes"`
+}
+
+// replBatcher queues replicate calls per peer.
+type replBatcher struct {
+	cfg       atomic.Pointer[ReplicateBatchConfig]
+	unbatched sync.Map // peer ID → struct{}: peers without the batch endpoint
+	batches   atomic.Uint64
+	writes    atomic.Uint64
+
+	mu     sync.Mutex
+	queues map[string]*replQueue
+}
+
+// replQueue is the writes waiting for one peer's next batch.
+type replQueue struct {
+	writes []queuedWrite
+	timer  *time.Timer // flushes after the delay; nil while empty
+}
+
+type queuedWrite struct {
+	req  ReplicateRequest
+	done chan error // buffered: the flush never blocks on a caller
+}
+
+// take empties q. Caller holds the batcher's mu.
+func (q *replQueue) take() []queuedWrite {
+	if q.timer != nil {
+		q.timer.Stop()
+		q.timer = nil
+	}
+	writes := q.writes
+	q.writes = nil
+	return writes
+}
+
+// SetReplicateBatch changes replicate batching. Safe while serving:
+// writes already queued are sent with the old settings.
+func (rep *Replicator) SetReplicateBatch(cfg ReplicateBatchConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	rep.replBatch.cfg.Store(&cfg)
+	return nil
+}
+
+// ReplicateBatchStats returns the batching counters.
+func (rep *Replicator) ReplicateBatchStats() ReplicateBatchStats {
+	b := &rep.replBatch
+	return ReplicateBatchStats{MaxEntries: b.cfg.Load().MaxEntries, Batches: b.batches.Load(), Writes: b.writes.Load()}
+}
+
+// batching reports whether replicate calls to peer go into batches.
+func (rep *Replicator) batching(peer *Node) bool {
+	if rep.replBatch.cfg.Load().MaxEntries <= 1 {
+		return false
+	}
+	_, no := rep.replBatch.unbatched.Load(peer.ID)
+	return !no && rep.speaks(peer.ID, protoBatch)
+}
+
+// replicateBatched queues body for peer's next batch and waits for the
+// batch's answer about it.
+func (rep *Replicator) replicateBatched(ctx context.Context, peer *Node, body ReplicateRequest) error {
+	w := queuedWrite{req: body, done: make(chan error, 1)}
+	cfg := rep.replBatch.cfg.Load()
+	p := *peer
+
+	b := &rep.replBatch
+	b.mu.Lock()
+	if b.queues == nil {
+		b.queues = make(map[string]*replQueue)
+	}
+	q, ok := b.queues[p.ID]
+	if !ok {
+		q = &replQueue{}
+		b.queues[p.ID] = q
+	}
+	q.writes = append(q.writes, w)
+	switch {
+	case len(q.writes) >= cfg.MaxEntries:
+		go rep.flushBatch(&p, q.take())
+	case q.timer == nil:
+		q.timer = time.AfterFunc(cfg.Delay, func() {
+			b.mu.Lock()
+			writes := q.take()
+			b.mu.Unlock()
+			if len(writes) > 0 {
+				rep.flushBatch(&p, writes)
+			}
+		})
+	}
+	b.mu.Unlock()
+
+	select {
+	case err := <-w.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err() // the write may still arrive; clocks make that harmless
+	}
+}
+
+// flushBatch sends writes to peer and tells each caller how its write did.
+func (rep *Replicator) flushBatch(peer *Node, writes []queuedWrite) {
+	ctx := context.Background()
+	errs, err := rep.postReplicateBatch(ctx, peer, writes)
+
+	var se *statusError
+	if errors.As(err, &se) && se.Status == http.StatusNotFound {
+		// The peer predates batching: send them one by one, from now on.
+		logging.FromContext(ctx).Info("peer does not accept replicate batches, sending single writes", "peer", peer.ID)
+		rep.replBatch.unbatched.Store(peer.ID, struct{}{})
+		for _, w := range writes {
+			go func() { w.done <- rep.doHTTPReplicate(ctx, peer, w.req) }()
+		}
+		return
+	}
+
+	rep.replBatch.batches.Add(1)
+	rep.replBatch.writes.Add(uint64(len(writes)))
+	for i, w := range writes {
+		if err != nil {
+			w.done <- err
+			continue
+		}
+		w.done <- errs[i]
+	}
+}
+
+// postReplicateBatch sends one batch. err is for the whole batch;
+// otherwise errs has one entry per write, nil for those the peer applied.
+func (rep *Replicator) postReplicateBatch(ctx context.Context, peer *Node, writes []queuedWrite) (errs []error, err error) {
+	done, err := rep.guard(ctx, peer.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+
+	release, err := rep.bp.peer(ctx, peer.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	start := time.Now()
+	defer func() {
+		rep.slowPeer(ctx, "replicate batch", rep.SlowThresholds().Replicate, peer.ID,
+			fmt.Sprintf("%s (+%d)", writes[0].req.Key, len(writes)-1), time.Since(start), err)
+	}()
+
+	var resp ReplicateBatchResponse
+	if rep.jsonOnly.has(peer.ID) || !rep.speaks(peer.ID, protoMsgpack) {
+		body := ReplicateBatchRequest{Writes: make([]ReplicateRequest, len(writes))}
+		for i, w := range writes {
+			body.Writes[i] = w.req
+		}
+		err = rep.callPeer(ctx, peer, http.MethodPost, "/internal/replicate/batch", body, &resp)
+	} else {
+		body := make([]wire.Replicate, len(writes))
+		for i, w := range writes {
+			body[i] = wire.Replicate{Key: w.req.Key, Value: w.req.Value}
+		}
+		err = rep.postMsgpack(ctx, peer, "/internal/replicate/batch", wire.MarshalReplicateBatch(body), &resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	errs = make([]error, len(writes))
+	if len(resp.Stale) > 0 {
+		view, ok := ParseRingView(resp.Ring)
+		if ok {
+			rep.ObserveRing(ctx, peer.ID, view)
+		}
+		for _, i := range resp.Stale {
+			if i >= 0 && i < len(errs) {
+				errs[i] = fmt.Errorf("%w: %s is at ring %s", ErrStaleRing, peer.ID, resp.Ring)
+			}
+		}
+	}
+	for _, f := range resp.Failed {
+		if f.Index >= 0 && f.Index < len(errs) {
+			errs[f.Index] = fmt.Errorf("peer failed to apply: %s", f.Error)
+		}
+	}
+	return errs, nil
+}
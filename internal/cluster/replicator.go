@@ -3,12 +3,22 @@ package cluster
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"distributed-kvstore/internal/logging"
 	"distributed-kvstore/internal/store"
+	"distributed-kvstore/internal/wire"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -64,12 +74,68 @@ type Replicator struct {
 	selfID     string
 	membership *Membership
 	store      *store.Store
-	httpClient *http.Client
-
-	// Quorum parameters
-	N int // total replicas per key
-	W int // write quorum
-	R int // read quorum
+	scheme     string // "http" or "https"
+
+	// Peer clients share one transport (see transport.go).
+	httpClient   *http.Client // bounded by transportCfg.Timeout
+	streamClient *http.Client // no timeout, for backups
+	transportCfg TransportConfig
+	tlsCfg       *tls.Config
+
+	// clusterToken authenticates us to peers on /internal/* routes.
+	// Empty means the cluster runs without auth.
+	clusterToken string
+	peerAuth     string // how it is sent; see signing.go
+
+	stats *replicationStats // counters for /admin/replication
+	hints *hintStore        // writes waiting for a down peer
+	bp    *backpressure     // concurrency limits (see backpressure.go)
+
+	breakers *breakers                      // per-peer circuit breakers (see breaker.go)
+	timeouts atomic.Pointer[Timeouts]       // quorum/peer timeouts and retries (see timeouts.go)
+	slow     atomic.Pointer[SlowThresholds] // when operations are logged as slow (see slow.go)
+
+	jsonOnly     jsonPeers    // peers that cannot read msgpack (see codec.go)
+	peerVersions peerVersions // what each peer last announced (see protocol.go)
+	outbox       *outbox      // queued async writes (see outbox.go)
+	replBatch    replBatcher  // replicate calls queued per peer (see replbatch.go)
+	ringSync     ringSync     // catch-up pulls from peers with a newer ring (see epoch.go)
+
+	decommission decommission // this node's decommission (see decommission.go)
+	shutdown     shutdown     // stopping and handing over (see shutdown.go)
+	repairJob    repairJob    // the last full repair started here (see repair.go)
+	snapshots    snapshots    // cluster snapshots (see snapshot.go)
+	txnLocks     keyLocks     // per-key locks of the transactions we coordinate or prepare (see txn.go)
+	twoPhase     *twoPhase    // open two-phase transactions (see twophase.go)
+
+	version   string    // build version, reported in stats
+	started   time.Time // when this node came up
+	readiness readiness // latest /readyz result (see readiness.go)
+	fencing   fencing   // self-fencing on ring disagreement (see fencing.go)
+	skew      clockSkew // peer clock offsets (see skew.go)
+
+	departures departures // nodes that left, for clock pruning (see prune.go)
+
+	readPolicy string       // default read routing (see nearest.go)
+	latency    peerLatency  // fetch latency per peer, for nearest reads
+	readCache  readCache    // recent read winners (see readcache.go)
+	hotKeys    *hotKeys     // per-key operation counts (see hotkeys.go)
+	flights    readFlights  // running shared client reads (see coalesce.go)
+	evictHook  evictWebhook // eviction notification counters (see evictnotify.go)
+	sinks      []*sinkQueue // event sinks for committed writes (see sinks.go)
+	audit      *auditLog    // admin and cluster operations (see audit.go)
+	acls       acls         // per-token key prefix rules (see acl.go)
+	xdc        *xdcBridge   // bridge to a remote cluster, if any (see xdc.go)
+	xdcApplied atomic.Uint64
+	localReads atomic.Uint64 // reads served from the local copy (see fastread.go)
+	hedge      hedging       // hedge delay and counters (see hedge.go)
+
+	// Quorum parameters (N/W/R), changeable at runtime: see quorum.go.
+	quorumMu      sync.RWMutex
+	quorum        QuorumConfig
+	quorumFile    string // where quorum is persisted; "" = nowhere
+	rereplication RereplicationStatus
+	rereplicateMu sync.Mutex // one re-replication pass at a time
 }
 
 // NewReplicator creates a new replicator.
@@ -79,15 +145,47 @@ type Replicator struct {
 //
 //	W + R > N
 func NewReplicator(selfID string, m *Membership, s *store.Store, n, w, r int) *Replicator {
-	return &Replicator{
-		selfID:     selfID,
-		membership: m,
-		store:      s,
-		N:          n,
-		W:          w,
-		R:          r,
-		httpClient: &http.Client{Timeout: 5 * time.Second},
+	rep := &Replicator{
+		selfID:       selfID,
+		membership:   m,
+		store:        s,
+		quorum:       QuorumConfig{N: n, W: w, R: r},
+		scheme:       "http",
+		transportCfg: DefaultTransportConfig,
+		stats:        newReplicationStats(),
+		hints:        newHintStore(),
+		bp:           newBackpressure(DefaultConcurrency),
+		breakers:     newBreakers(DefaultBreakerConfig),
+		outbox:       newOutbox(DefaultOutboxSize),
+		twoPhase:     newTwoPhase(),
+		readPolicy:   ReadRing,
+		hotKeys:      newHotKeys(),
+		started:      time.Now().UTC(),
 	}
+	rep.timeouts.Store(&DefaultTimeouts)
+	rep.slow.Store(&DefaultSlowThresholds)
+	rep.readCache.cfg = DefaultReadCacheConfig
+	rep.hedge.minDelay = DefaultHedgeMinDelay
+	rep.replBatch.cfg.Store(&DefaultReplicateBatchConfig)
+	rep.rebuildClients()
+	return rep
+}
+
+// SetTLS switches peer traffic to HTTPS.
+//
+// cfg should come from LoadTLSConfig so we both verify the peer's
+// certificate and present our own (mutual TLS).
+func (rep *Replicator) SetTLS(cfg *tls.Config) {
+	rep.tlsCfg = cfg
+	rep.scheme = "https"
+	rep.rebuildClients()
+}
+
+// SetClusterToken sets the shared secret sent to peers
+// as "Authorization: Bearer <token>", or signing their requests
+// (see SetPeerAuth).
+func (rep *Replicator) SetClusterToken(token string) {
+	rep.clusterToken = token
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -106,16 +204,46 @@ func NewReplicator(selfID string, m *Membership, s *store.Store, n, w, r int) *R
 // 6) If timeout or insufficient acks → failure.
 //
 // Self always counts as 1 acknowledgement.
-func (rep *Replicator) ReplicateWrite(key, data string, clock store.VectorClock) (store.Value, error) {
+//
+// ctx carries the request ID, which is forwarded to every replica.
+func (rep *Replicator) ReplicateWrite(ctx context.Context, key, data, contentType string, clock store.VectorClock) (store.Value, error) {
+
+	release, err := rep.bp.admit(ctx)
+	if err != nil {
+		return store.Value{}, err
+	}
+	defer release()
 
 	// Step 1: Write locally.
-	val, err := rep.store.Put(key, data, clock)
+	val, err := rep.store.Put(ctx, key, data, contentType, clock)
 	if err != nil {
 		return store.Value{}, fmt.Errorf("local write: %w", err)
 	}
+	if err := rep.awaitWriteQuorum(ctx, key, val); err != nil {
+		return store.Value{}, err
+	}
+	rep.publishCommitted(ctx, store.BatchEntry{Key: key, Value: val})
+	return val, nil
+}
 
+// awaitWriteQuorum sends val (already written locally) to the other
+// replicas of key and waits until W of them, counting us, have acked.
+func (rep *Replicator) awaitWriteQuorum(ctx context.Context, key string, val store.Value) error {
+	// A range changing hands also gets the write; it does not count for W.
+	for _, p := range rep.pendingPeers(key) {
+		go rep.sendReplicateRequest(context.WithoutCancel(ctx), p, key, val)
+	}
+	return rep.awaitAcks(ctx, key, func(ctx context.Context, p *Node) error {
+		return rep.sendReplicateRequest(ctx, p, key, val)
+	})
+}
+
+// awaitAcks calls send for every other replica of key in parallel and
+// waits until W replicas, counting us, have acked.
+func (rep *Replicator) awaitAcks(ctx context.Context, key string, send func(context.Context, *Node) error) error {
 	// Step 2: Determine replicas.
-	replicas := rep.membership.ReplicaNodes(key, rep.N)
+	q := rep.Quorum()
+	replicas := rep.membership.ReplicaNodes(key, q.N)
 	peers := rep.peersOnly(replicas) // exclude self
 
 	type result struct {
@@ -124,46 +252,76 @@ func (rep *Replicator) ReplicateWrite(key, data string, clock store.VectorClock)
 	}
 	results := make(chan result, len(peers))
 
-	// Step 3: Send writes in parallel.
+	// Step 3: Send writes in parallel. Until the quorum is met, the client
+	// giving up cancels them (they become hints); after, they run on.
+	fctx, detach, cancelFanout := fanout(ctx)
+	met := false
+	remaining := len(peers)
+	defer func() {
+		if !met {
+			cancelFanout()
+			return
+		}
+		detach()
+		go func(n int) {
+			for range n {
+				<-results
+			}
+			cancelFanout()
+		}(remaining)
+	}()
+
+	timer := newQuorumTimer()
+	defer rep.slowQuorum(ctx, "write", rep.SlowThresholds().Write, key, timer)
 	for _, peer := range peers {
+		timer.ask(peer.ID)
 		go func(p *Node) {
-			err := rep.sendReplicateRequest(p, key, val)
+			err := send(fctx, p)
 			results <- result{p.ID, err}
 		}(peer)
 	}
 
 	// Step 4: Wait for quorum.
 	acks := 1 // self already acknowledged
-	required := rep.W
+	required := q.W
 	var errs []error
 
-	timeout := time.After(5 * time.Second)
-	remaining := len(peers)
+	wait, cancel := rep.quorumWait(ctx)
+	defer cancel()
 
 	for remaining > 0 {
 		select {
 		case r := <-results:
 			remaining--
+			timer.answer(r.nodeID)
 			if r.err == nil {
 				acks++
 				if acks >= required {
-					return val, nil // quorum reached
+					met = true
+					return nil // quorum reached
 				}
 			} else {
 				errs = append(errs, fmt.Errorf("node %s: %w", r.nodeID, r.err))
 			}
-		case <-timeout:
+		case <-wait.Done():
 			if acks >= required {
-				return val, nil
+				met = true
+				return nil
 			}
-			return store.Value{}, fmt.Errorf("write quorum timeout (%d/%d acks), errors: %v", acks, required, errs)
+			return fmt.Errorf("write quorum timeout (%d/%d acks): %w, errors: %v", acks, required, wait.Err(), errs)
 		}
 	}
 
 	if acks >= required {
-		return val, nil
+		met = true
+		return nil
 	}
-	return store.Value{}, fmt.Errorf("write quorum not met (%d/%d), errors: %v", acks, required, errs)
+	err := fmt.Errorf("write quorum not met (%d/%d), errors: %v", acks, required, errs)
+	if slices.ContainsFunc(errs, func(e error) bool { return errors.Is(e, ErrStaleRing) }) {
+		// We routed with an old ring; the caller should retry once we caught up.
+		return fmt.Errorf("%w: %w", ErrStaleRing, err)
+	}
+	return err
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -175,69 +333,153 @@ func (rep *Replicator) ReplicateWrite(key, data string, clock store.VectorClock)
 // Steps:
 //
 // 1) Identify N replica nodes.
-// 2) Ask all replicas in parallel.
+// 2) Ask all replicas in parallel (or the R nearest: see nearest.go).
 // 3) Wait for R responses.
 // 4) Compare versions using vector clocks.
 // 5) Return the newest value.
 // 6) If stale replicas detected → trigger read repair.
 //
 // Read repair keeps replicas eventually consistent.
-func (rep *Replicator) CoordinateRead(key string) (*store.Value, error) {
+//
+// A ctx from WithSession also waits for a value at least as new as the
+// session's (see session.go).
+//
+// Its callers read to modify (transactions, counters, locks, If-Match),
+// so it always reads the ring at R, whatever policy ctx, the namespace or
+// the node asks for: a one read of a stale copy would let a CAS pass or
+// hand out a fencing token twice.
+func (rep *Replicator) CoordinateRead(ctx context.Context, key string) (*store.Value, error) {
+	return rep.readLive(WithReadPolicy(ctx, ReadRing), key, rep.coordinateRead)
+}
+
+// readLive runs read, waits for ctx's session if the winner is older, and
+// hides tombstones and expired values.
+func (rep *Replicator) readLive(ctx context.Context, key string, read func(context.Context, string) (*store.Value, error)) (*store.Value, error) {
+	winner, err := read(ctx, key)
+	if s, ok := sessionFrom(ctx); ok && err == nil && !s.Covers(winner) {
+		winner, err = rep.awaitSession(ctx, key, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if winner == nil {
+		return nil, nil // not found
+	}
+	if winner.Tombstone {
+		return nil, nil // deleted
+	}
+	if winner.Expired(time.Now()) {
+		return nil, nil // expired, not yet reaped (see expiry.go)
+	}
+	return winner, nil
+}
+
+// coordinateRead is one quorum read. It returns the reconciled winner
+// as stored, tombstones included.
+func (rep *Replicator) coordinateRead(ctx context.Context, key string) (*store.Value, error) {
+	release, err := rep.bp.admit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	replicas := rep.membership.ReplicaNodes(key, rep.N)
+	q := rep.Quorum()
+	replicas := rep.membership.ReplicaNodes(key, q.N)
 	responses := make(chan ReplicaResponse, len(replicas))
 
-	// Step 1 & 2: Query replicas in parallel.
-	for _, node := range replicas {
-		go func(n *Node) {
-			if n.ID == rep.selfID {
-				// Local read.
-				v, ok := rep.store.GetRaw(key)
-				if !ok {
-					responses <- ReplicaResponse{NodeID: n.ID, Value: nil}
-					return
-				}
-				responses <- ReplicaResponse{NodeID: n.ID, Value: &v}
-			} else {
-				// Remote read.
-				v, err := rep.fetchFromPeer(n, key)
-				responses <- ReplicaResponse{NodeID: n.ID, Value: v, Err: err}
+	// Fetches are cancelled if the client leaves before R answers;
+	// after that they feed read repair.
+	fctx, detach, cancelFanout := fanout(ctx)
+
+	ask := func(n *Node) {
+		if n.ID == rep.selfID {
+			// Local read.
+			v, ok := rep.store.GetRaw(key)
+			if !ok {
+				responses <- ReplicaResponse{NodeID: n.ID, Value: nil}
+				return
 			}
-		}(node)
+			responses <- ReplicaResponse{NodeID: n.ID, Value: &v}
+		} else {
+			// Remote read.
+			v, err := rep.fetchFromPeer(fctx, n, key)
+			responses <- ReplicaResponse{NodeID: n.ID, Value: v, Err: err}
+		}
+	}
+
+	// Step 1 & 2: Query replicas in parallel. The nearest and one
+	// policies start with R of them (one for "one") and keep the others
+	// as spares.
+	required := rep.readQuorum(ctx, key, q)
+	order, asked := replicas, len(replicas)
+	if policy := rep.readPolicyFor(ctx, key); policy == ReadNearest || policy == ReadOne {
+		order, asked = rep.byProximity(replicas), min(required, len(replicas))
+	}
+	timer := newQuorumTimer()
+	defer rep.slowQuorum(ctx, "read", rep.SlowThresholds().Read, key, timer)
+	for _, node := range order[:asked] {
+		timer.ask(node.ID)
+		go ask(node)
 	}
 
 	// Step 3: Wait for R responses.
 	var collected []ReplicaResponse
-	timeout := time.After(5 * time.Second)
-	required := rep.R
+	wait, cancel := rep.quorumWait(ctx)
+	defer cancel()
+	received := 0
+
+	// A replica that is slow to answer gets a spare asked alongside it
+	// (see hedge.go).
+	var hedgeC <-chan time.Time
+	hedgeID := ""
+	if d, ok := rep.hedge.delay(); ok && asked < len(order) {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		hedgeC = t.C
+	}
 
 	for len(collected) < required {
 		select {
 		case r := <-responses:
+			received++
+			timer.answer(r.NodeID)
+			if r.Err != nil && asked < len(order) {
+				// Replace a failed replica with the next spare.
+				timer.ask(order[asked].ID)
+				go ask(order[asked])
+				asked++
+				continue
+			}
+			if r.Err == nil && r.NodeID == hedgeID {
+				rep.hedge.won.Add(1)
+			}
 			collected = append(collected, r)
-		case <-timeout:
-			if len(collected) >= required {
-				break
+		case <-hedgeC:
+			hedgeC = nil
+			if asked < len(order) {
+				hedgeID = order[asked].ID
+				rep.hedge.hedged.Add(1)
+				timer.ask(hedgeID)
+				go ask(order[asked])
+				asked++
 			}
-			return nil, fmt.Errorf("read quorum timeout (%d/%d responses)", len(collected), required)
+		case <-wait.Done():
+			cancelFanout()
+			return nil, fmt.Errorf("read quorum timeout (%d/%d responses): %w", len(collected), required, wait.Err())
 		}
 	}
+	detach()
 
 	// Step 4: Reconcile versions.
-	winner, stale := reconcile(collected)
-
-	if winner == nil {
-		return nil, nil // not found
-	}
-	if winner.Tombstone {
-		return nil, nil // deleted
-	}
-
-	// Step 6: Repair stale replicas asynchronously.
-	if len(stale) > 0 {
-		go rep.readRepair(key, *winner, stale)
-	}
-
+	winner, _ := rep.reconcile(key, collected)
+
+	// Step 5: Repair asynchronously. The remaining replicas are still
+	// answering; the repair waits for them too, so a replica that is
+	// missing the key is fixed even if it was not part of the quorum.
+	go func() {
+		defer cancelFanout()
+		rep.readRepair(fctx, key, collected, responses, asked-received)
+	}()
 	return winner, nil
 }
 
@@ -253,12 +495,22 @@ func (rep *Replicator) CoordinateRead(key string) (*store.Value, error) {
 //	Before    → strictly older
 //	Concurrent→ conflict
 //
-// If concurrent, we use wall-clock time as a tiebreaker.
+// If concurrent, the tie-break rules of key's namespace decide (see
+// store/tiebreak.go).
+//
+// It works in two passes, so every response is judged against the
+// FINAL winner (not whatever was winning when it arrived):
+//
+//  1. Pick the winner among the values returned.
+//  2. Every replica that answered with something else is stale:
+//     an older or losing version, OR no value at all ("not found").
+//
+// Replicas that failed to answer (Err != nil) are not stale, just unknown.
 //
 // Returns:
-//   - The winning value
-//   - List of stale node IDs
-func reconcile(responses []ReplicaResponse) (winner *store.Value, staleNodes []string) {
+//   - The winning value (nil if no replica has the key)
+//   - IDs of the replicas that need the winner
+func (rep *Replicator) reconcile(key string, responses []ReplicaResponse) (winner *store.Value, staleNodes []string) {
 	for _, r := range responses {
 		if r.Err != nil || r.Value == nil {
 			continue
@@ -267,38 +519,70 @@ func reconcile(responses []ReplicaResponse) (winner *store.Value, staleNodes []s
 			winner = r.Value
 			continue
 		}
-		rel := r.Value.Clock.Compare(winner.Clock)
-
-		switch rel {
+		switch rep.store.CompareClocks(r.Value.Clock, winner.Clock) {
 		case store.After:
-			staleNodes = append(staleNodes, "")
 			winner = r.Value
-		case store.Before:
-			staleNodes = append(staleNodes, r.NodeID)
 		case store.ConcurrentClocks:
-			if r.Value.UpdatedAt.After(winner.UpdatedAt) {
+			rep.noteConcurrent(*r.Value, *winner)
+			if rep.store.CompareConcurrent(key, *r.Value, *winner) > 0 {
 				winner = r.Value
-			} else {
-				staleNodes = append(staleNodes, r.NodeID)
 			}
 		}
 	}
+	if winner == nil {
+		return nil, nil
+	}
+
+	for _, r := range responses {
+		if r.Err != nil {
+			continue
+		}
+		if r.Value == nil || rep.store.CompareClocks(r.Value.Clock, winner.Clock) != store.Equal {
+			staleNodes = append(staleNodes, r.NodeID)
+		}
+	}
 	return winner, staleNodes
 }
 
-// readRepair fixes stale replicas.
+// readRepair fixes stale and missing replicas.
 //
 // Instead of running a background anti-entropy job,
 // we repair during reads.
 //
+// collected are the responses the read already used; pending more are
+// still coming on responses. We wait for those (bounded by the quorum
+// timeout), reconcile over everything and push the winner to every
+// replica that does not have it.
+//
 // This keeps replicas synchronized naturally.
-func (rep *Replicator) readRepair(key string, val store.Value, staleNodeIDs []string) {
-	for _, id := range staleNodeIDs {
+func (rep *Replicator) readRepair(ctx context.Context, key string, collected []ReplicaResponse, responses <-chan ReplicaResponse, pending int) {
+	timeout := time.After(rep.Timeouts().Quorum)
+wait:
+	for range pending {
+		select {
+		case r := <-responses:
+			collected = append(collected, r)
+		case <-timeout:
+			break wait
+		}
+	}
+
+	winner, stale := rep.reconcile(key, collected)
+	for _, id := range stale {
+		if id == rep.selfID {
+			_, err := rep.store.ApplyRemote(key, *winner)
+			if err != nil {
+				logging.FromContext(ctx).Warn("read repair failed", "key", key, "peer", id, "error", err)
+			}
+			rep.stats.readRepair(err)
+			continue
+		}
 		node, ok := rep.membership.GetNode(id)
 		if !ok {
 			continue
 		}
-		_ = rep.sendReplicateRequest(node, key, val) // best effort
+		logging.FromContext(ctx).Debug("read repair", "key", key, "peer", id)
+		rep.stats.readRepair(rep.sendReplicateRequest(ctx, node, key, *winner)) // best effort
 	}
 }
 
@@ -314,7 +598,7 @@ type ReplicateRequest struct {
 
 // sendReplicateRequest sends data to a peer.
 //
-// It uses exponential backoff:
+// It uses exponential backoff (defaults; see timeouts.go):
 //
 //	Attempt 1 → immediate
 //	Attempt 2 → wait 100ms
@@ -325,58 +609,118 @@ type ReplicateRequest struct {
 // If a node is overloaded,
 // retrying instantly makes things worse.
 // Backoff reduces pressure.
-func (rep *Replicator) sendReplicateRequest(peer *Node, key string, val store.Value) error {
+func (rep *Replicator) sendReplicateRequest(ctx context.Context, peer *Node, key string, val store.Value) error {
 
 	body := ReplicateRequest{Key: key, Value: val}
 
-	const maxRetries = 3
+	maxRetries := rep.Timeouts().Attempts
 
 	for attempt := range maxRetries {
 
-		if attempt > 0 {
-			delay := time.Duration(math.Pow(2, float64(attempt-1))*100) * time.Millisecond
-			time.Sleep(delay)
+		select {
+		case <-time.After(rep.backoff(attempt)):
+		case <-ctx.Done():
 		}
 
-		err := rep.doHTTPReplicate(peer, body)
+		err := rep.doHTTPReplicate(ctx, peer, body)
 		if err == nil {
+			rep.stats.success(peer.ID)
 			return nil
 		}
+		// The peer no longer owns key on the current ring: retrying
+		// (or hinting) would put the value where it does not belong.
+		if errors.Is(err, ErrStaleRing) {
+			rep.stats.failure(peer.ID, err)
+			return fmt.Errorf("replicate to %s: %w", peer.ID, err)
+		}
+		// The peer is known to be down, or the client gave up before the
+		// quorum was met: hint at once, skip the backoff.
+		if errors.Is(err, errBreakerOpen) || ctx.Err() != nil {
+			rep.stats.failure(peer.ID, err)
+			rep.hint(peer, key, val)
+			return fmt.Errorf("replicate to %s: %w", peer.ID, err)
+		}
 
 		if attempt == maxRetries-1 {
+			logging.FromContext(ctx).Warn("replication failed",
+				"peer", peer.ID, "key", key, "attempts", maxRetries, "error", err)
+			rep.stats.failure(peer.ID, err)
+			rep.hint(peer, key, val)
 			return fmt.Errorf("replicate to %s after %d attempts: %w", peer.ID, maxRetries, err)
 		}
+		rep.stats.retry(peer.ID)
 	}
 	return nil
 }
 
 // doHTTPReplicate performs the actual HTTP POST.
-func (rep *Replicator) doHTTPReplicate(peer *Node, body ReplicateRequest) error {
+func (rep *Replicator) doHTTPReplicate(ctx context.Context, peer *Node, body ReplicateRequest) (err error) {
+	if rep.batching(peer) {
+		return rep.replicateBatched(ctx, peer, body)
+	}
+	done, err := rep.guard(ctx, peer.ID)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
 
-	data, err := json.Marshal(body)
+	release, err := rep.bp.peer(ctx, peer.ID)
 	if err != nil {
 		return err
 	}
+	defer release()
+
+	start := time.Now()
+	defer func() {
+		rep.slowPeer(ctx, "replicate", rep.SlowThresholds().Replicate, peer.ID, body.Key, time.Since(start), err)
+	}()
+	return rep.postReplicate(ctx, peer, body)
+}
 
-	url := fmt.Sprintf("http://%s/internal/replicate", peer.Address)
+// callPeer sends one JSON request to a peer and checks the status code.
+//
+// body may be nil (no request body).
+// If out is non-nil, the JSON response is decoded into it.
+func (rep *Replicator) callPeer(ctx context.Context, peer *Node, method, path string, body, out any) error {
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Membership and admin calls finish even if the client that
+	// started them disconnects.
+	ctx, cancel := rep.peerContext(context.WithoutCancel(ctx))
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	req, err := http.NewRequestWithContext(ctx, method, rep.peerURL(peer, path), reader)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rep.setHeaders(ctx, req)
 
 	resp, err := rep.httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	rep.ObserveVersion(ctx, peer.ID, resp.Header)
 
+	if err := rep.staleRingError(ctx, peer, resp); err != nil {
+		return err
+	}
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("peer returned HTTP %d", resp.StatusCode)
+		return &statusError{Status: resp.StatusCode}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
 	}
 	return nil
 }
@@ -385,38 +729,88 @@ func (rep *Replicator) doHTTPReplicate(peer *Node, body ReplicateRequest) error
 //
 // We fetch raw values including tombstones
 // so reconciliation logic can decide correctly.
-func (rep *Replicator) fetchFromPeer(peer *Node, key string) (*store.Value, error) {
+func (rep *Replicator) fetchFromPeer(ctx context.Context, peer *Node, key string) (_ *store.Value, err error) {
+
+	done, err := rep.guard(ctx, peer.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+
+	release, err := rep.bp.peer(ctx, peer.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	url := fmt.Sprintf("http://%s/internal/fetch/%s", peer.Address, key)
+	url := rep.peerURL(peer, "/internal/fetch/"+keyPath(key))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := rep.peerContext(ctx)
 	defer cancel()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("Accept", wire.ContentType)
+	rep.setHeaders(ctx, req)
 
+	start := time.Now()
+	defer func() { rep.slowPeer(ctx, "fetch", rep.SlowThresholds().Fetch, peer.ID, key, time.Since(start), err) }()
 	resp, err := rep.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	took := time.Since(start)
+	rep.latency.observe(peer.ID, took)
+	rep.hedge.observe(took)
+	rep.ObserveVersion(ctx, peer.ID, resp.Header)
 
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, nil
 	}
+	if err := rep.staleRingError(ctx, peer, resp); err != nil {
+		return nil, err
+	}
 	if resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("peer returned HTTP %d", resp.StatusCode)
+		return nil, &statusError{Status: resp.StatusCode}
 	}
 
-	var val store.Value
-	if err := json.NewDecoder(resp.Body).Decode(&val); err != nil {
+	val, err := decodeValue(resp)
+	if err != nil {
 		return nil, err
 	}
 	return &val, nil
 }
 
+// peerURL builds the URL for path on peer, using http or https.
+func (rep *Replicator) peerURL(peer *Node, path string) string {
+	return fmt.Sprintf("%s://%s%s", rep.scheme, peer.Address, path)
+}
+
+// keyPath escapes a namespaced key for a peer URL: /internal/fetch/<ns>/<key>.
+// A "/" in the key must not read as another path segment.
+func keyPath(key string) string {
+	ns, k := store.SplitKey(key)
+	return url.PathEscape(ns) + "/" + url.PathEscape(k)
+}
+
+// setHeaders adds the headers every peer call carries:
+//   - the request ID (if any), so coordinator and replica logs can be correlated
+//   - the cluster token or a signature (if configured), so the peer accepts the call (see signing.go)
+//   - our ID and ring view, so the peer can spot stale routing (see epoch.go)
+//   - our protocol and build, so the peer talks back in what we read (see protocol.go)
+func (rep *Replicator) setHeaders(ctx context.Context, req *http.Request) {
+	req.Header.Set(PeerHeader, rep.selfID)
+	req.Header.Set(RingHeader, rep.membership.View().String())
+	rep.SetProtocolHeaders(req.Header)
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	rep.authenticate(req)
+}
+
 // peersOnly removes self from replica list.
 //
 // The coordinator already executed locally.
@@ -430,34 +824,178 @@ func (rep *Replicator) peersOnly(nodes []*Node) []*Node {
 	return peers
 }
 
+// Broadcast sends the same request to every other cluster member in parallel.
+//
+// Used for cluster-wide configuration (e.g. namespaces) that every node
+// must know about, as opposed to key data which only lives on N replicas.
+//
+// All peers are attempted; the returned error joins every failure.
+func (rep *Replicator) Broadcast(ctx context.Context, method, path string, body any) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Add(1)
+		go func(p Node) {
+			defer wg.Done()
+			if err := rep.callPeer(ctx, &p, method, path, body, nil); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("node %s: %w", p.ID, err))
+				mu.Unlock()
+			}
+		}(n)
+	}
+
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// ListKeys returns every live key of a namespace across the cluster.
+//
+// Each node only stores the keys it replicates, so we ask every node
+// for its local keys and merge them (sorted, de-duplicated).
+//
+// Unreachable nodes are skipped: with N replicas per key, a key is
+// only missing if all N of its replicas are down.
+func (rep *Replicator) ListKeys(ctx context.Context, namespace string) []string {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+	)
+	add := func(keys []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, k := range keys {
+			seen[k] = true
+		}
+	}
+
+	add(rep.store.Keys(namespace))
+
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Add(1)
+		go func(p Node) {
+			defer wg.Done()
+			var resp struct {
+				Keys []string `json:"keys"`
+			}
+			if err := rep.callPeer(ctx, &p, http.MethodGet, "/internal/keys/"+namespace, nil, &resp); err != nil {
+				logging.FromContext(ctx).Warn("list keys: peer unavailable", "peer", p.ID, "error", err)
+				return
+			}
+			add(resp.Keys)
+		}(n)
+	}
+	wg.Wait()
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ListKeysPage returns, in order, the first limit live keys of a
+// namespace that start with prefix, sort after after and pass f, across
+// the cluster; more reports whether there may be keys past the page.
+//
+// Every node sends its own first limit keys; the first limit of their
+// union are the cluster's. Unreachable nodes are skipped, as in ListKeys.
+// Each node matches f against its own copy of a value, so a key passes
+// if any replica's copy does: a replica that missed the latest write
+// can let through a key whose current value no longer matches.
+func (rep *Replicator) ListKeysPage(ctx context.Context, namespace, prefix, after string, limit int, f store.Filter) (keys []string, more bool) {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[string]bool)
+	)
+	add := func(keys []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(keys) >= limit {
+			more = true // that node may hold more
+		}
+		for _, k := range keys {
+			// Filter again: a node without paging returns all its keys.
+			if k > after && strings.HasPrefix(k, prefix) {
+				seen[k] = true
+			}
+		}
+	}
+
+	add(rep.store.KeysPage(namespace, prefix, after, limit, f))
+
+	q := url.Values{"prefix": {prefix}, "after": {after}, "limit": {strconv.Itoa(limit)}}
+	f.Encode(q)
+	for _, n := range rep.membership.All() {
+		if n.ID == rep.selfID {
+			continue
+		}
+		wg.Add(1)
+		go func(p Node) {
+			defer wg.Done()
+			var resp struct {
+				Keys []string `json:"keys"`
+			}
+			path := "/internal/keys/" + namespace + "?" + q.Encode()
+			if err := rep.callPeer(ctx, &p, http.MethodGet, path, nil, &resp); err != nil {
+				logging.FromContext(ctx).Warn("list keys: peer unavailable", "peer", p.ID, "error", err)
+				return
+			}
+			add(resp.Keys)
+		}(n)
+	}
+	wg.Wait()
+
+	keys = make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys, more = keys[:limit], true
+	}
+	return keys, more
+}
+
 // DeleteReplicated performs a quorum delete.
 //
 // Deletes are implemented using tombstones.
 // This prevents deleted data from reappearing
 // during reconciliation.
-func (rep *Replicator) DeleteReplicated(key string) error {
+//
+// The tombstone is a write like any other: it must reach W replicas,
+// counting us, or the delete fails. Replicas that miss it get a hint.
+func (rep *Replicator) DeleteReplicated(ctx context.Context, key string) error {
 
-	// Local delete first.
-	if err := rep.store.Delete(key); err != nil {
+	release, err := rep.bp.admit(ctx)
+	if err != nil {
 		return err
 	}
+	defer release()
+
+	// Local delete first.
+	if err := rep.store.Delete(ctx, key); err != nil {
+		return fmt.Errorf("local delete: %w", err)
+	}
 
 	// Fetch tombstone value.
 	val, _ := rep.store.GetRaw(key)
-
-	replicas := rep.membership.ReplicaNodes(key, rep.N)
-	peers := rep.peersOnly(replicas)
-
-	var wg sync.WaitGroup
-
-	for _, peer := range peers {
-		wg.Add(1)
-		go func(p *Node) {
-			defer wg.Done()
-			_ = rep.sendReplicateRequest(p, key, val)
-		}(peer)
+	if err := rep.awaitWriteQuorum(ctx, key, val); err != nil {
+		return err
 	}
-
-	wg.Wait()
+	rep.publishCommitted(ctx, store.BatchEntry{Key: key, Value: val})
 	return nil
 }
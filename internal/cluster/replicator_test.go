@@ -0,0 +1,85 @@
+package cluster
+
+import (
+	"distributed-kvstore/internal/store"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestReconcileDeleteConflicts reads a key that one replica wrote and
+// another concurrently deleted: read repair must pick what ApplyRemote
+// would, and mark the loser (and the replica missing the key) stale.
+// store/tiebreak_test.go covers every policy against ApplyRemote; these
+// rows are a tombstone and a write winning, by the rule and by the HLC.
+func TestReconcileDeleteConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		putLater bool // the write's HLC is after the delete's, else before
+		deleted  bool // whether the tombstone wins
+	}{
+		{"delete-wins over a later put", store.DeleteConflictsDeleteWins, true, true},
+		{"write-wins over a later delete", store.DeleteConflictsWriteWins, false, false},
+		{"tiebreak to a later delete", store.DeleteConflictsTiebreak, false, true},
+	}
+	key := store.NamespacedKey(store.DefaultNamespace, "k")
+	now := time.Now()
+
+	for _, tt := range tests {
+		put := &store.Value{Data: "v", Clock: store.VectorClock{"n1": 1}, UpdatedAt: now}
+		del := &store.Value{Tombstone: true, Clock: store.VectorClock{"n2": 1}, UpdatedAt: now}
+		if tt.putLater {
+			put.UpdatedAt = now.Add(time.Millisecond)
+		} else {
+			del.UpdatedAt = now.Add(time.Millisecond)
+		}
+		put.HLC, del.HLC = store.HLCAt(put.UpdatedAt), store.HLCAt(del.UpdatedAt)
+		winner, lost, loser := put, del, "n2"
+		if tt.deleted {
+			winner, lost, loser = del, put, "n1"
+		}
+		// The answers may come back in either order.
+		for _, order := range [][]ReplicaResponse{
+			{{NodeID: "n1", Value: put}, {NodeID: "n2", Value: del}, {NodeID: "n3"}},
+			{{NodeID: "n3"}, {NodeID: "n2", Value: del}, {NodeID: "n1", Value: put}},
+		} {
+			t.Run(tt.name+"/from "+order[0].NodeID, func(t *testing.T) {
+				rep := newTestReplicator(t)
+				if err := rep.store.SetDeleteConflicts(tt.policy); err != nil {
+					t.Fatal(err)
+				}
+				got, stale := rep.reconcile(key, order)
+				if got != winner {
+					t.Errorf("winner tombstone = %v, want %v", got.Tombstone, tt.deleted)
+				}
+				slices.Sort(stale)
+				if want := []string{loser, "n3"}; !slices.Equal(stale, want) {
+					t.Errorf("stale = %v, want %v", stale, want)
+				}
+
+				// Repairing the loser with the winner must stick there.
+				if _, err := rep.store.ApplyRemote(key, *lost); err != nil {
+					t.Fatal(err)
+				}
+				if applied, err := rep.store.ApplyRemote(key, *winner); err != nil || !applied {
+					t.Fatalf("repair ApplyRemote = %v, %v; want applied", applied, err)
+				}
+				if v, _ := rep.store.GetRaw(key); v.Tombstone != tt.deleted {
+					t.Errorf("repaired tombstone = %v, want %v", v.Tombstone, tt.deleted)
+				}
+			})
+		}
+	}
+}
+
+func newTestReplicator(t *testing.T) *Replicator {
+	t.Helper()
+	s, err := store.New(t.TempDir(), "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	m := NewMembership([]Node{{ID: "n1", Address: "127.0.0.1:1"}}, 8)
+	return NewReplicator("n1", m, s, 3, 2, 2)
+}
@@ -62,6 +62,15 @@ import (
 // Typical range: 100–200 virtual nodes per physical node.
 const defaultVnodes = 150
 
+// Weights:
+//
+// Nodes do not have to be equal. A node with weight 2 gets twice
+// the virtual nodes, so it owns about twice the keys.
+//
+// Virtual node i of a node is always at hash("nodeID#i"), whatever
+// its weight. Raising a weight from 2 to 3 only ADDS positions,
+// so only the keys that move to the bigger node move.
+
 ////////////////////////////////////////////////////////////////////////////////
 // RING STRUCTURE
 ////////////////////////////////////////////////////////////////////////////////
@@ -72,10 +81,11 @@ const defaultVnodes = 150
 //
 // Fields:
 //
-//	mu     → protects all ring state
-//	vnodes → number of virtual nodes per physical node
-//	ring   → maps ring position → nodeID
-//	sorted → sorted list of positions (for binary search)
+//	mu      → protects all ring state
+//	vnodes  → number of virtual nodes per physical node, at weight 1
+//	weights → nodeID → weight, for every node on the ring
+//	ring    → maps ring position → nodeID
+//	sorted  → sorted list of positions (for binary search)
 //
 // Why do we store `sorted`?
 //
@@ -85,10 +95,11 @@ const defaultVnodes = 150
 //
 // We use binary search on this sorted slice.
 type Ring struct {
-	mu     sync.RWMutex
-	vnodes int
-	ring   map[uint32]string
-	sorted []uint32
+	mu      sync.RWMutex
+	vnodes  int
+	weights map[string]int
+	ring    map[uint32]string
+	sorted  []uint32
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -104,8 +115,9 @@ func NewRing(vnodes int) *Ring {
 		vnodes = defaultVnodes
 	}
 	return &Ring{
-		vnodes: vnodes,
-		ring:   make(map[uint32]string),
+		vnodes:  vnodes,
+		weights: make(map[string]int),
+		ring:    make(map[uint32]string),
 	}
 }
 
@@ -113,26 +125,32 @@ func NewRing(vnodes int) *Ring {
 // NODE MANAGEMENT
 ////////////////////////////////////////////////////////////////////////////////
 
-// AddNode adds a physical node to the ring.
+// AddNode adds a physical node to the ring with the given weight
+// (weight <= 0 means 1). Adding a node that is already on the ring
+// changes its weight.
 //
 // Steps:
 //  1. Lock (write lock)
-//  2. For i = 0 → vnodes
-//  3. Hash "nodeID#i" to generate virtual position
-//  4. Insert into ring map
-//  5. Rebuild sorted positions
+//  2. Drop the node's old positions, if any
+//  3. For i = 0 → vnodes × weight
+//  4. Hash "nodeID#i" to generate virtual position
+//  5. Insert into ring map
+//  6. Rebuild sorted positions
 //
 // Why "nodeID#i"?
 //
 // So each virtual node hashes to a different position.
-func (r *Ring) AddNode(nodeID string) {
+func (r *Ring) AddNode(nodeID string, weight int) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for i := 0; i < r.vnodes; i++ {
+	weight = max(weight, 1)
+	r.removePositions(nodeID)
+	for i := 0; i < r.vnodes*weight; i++ {
 		pos := r.hash(fmt.Sprintf("%s#%d", nodeID, i))
 		r.ring[pos] = nodeID
 	}
+	r.weights[nodeID] = weight
 	r.rebuild()
 }
 
@@ -144,11 +162,22 @@ func (r *Ring) RemoveNode(nodeID string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for i := 0; i < r.vnodes; i++ {
+	r.removePositions(nodeID)
+	delete(r.weights, nodeID)
+	r.rebuild()
+}
+
+// removePositions deletes every virtual node of nodeID.
+// Caller must hold r.mu.
+func (r *Ring) removePositions(nodeID string) {
+	for i := 0; i < r.vnodes*r.weights[nodeID]; i++ {
 		pos := r.hash(fmt.Sprintf("%s#%d", nodeID, i))
-		delete(r.ring, pos)
+		// Two nodes' vnodes may (very rarely) hash to the same
+		// position; only free the ones we hold.
+		if r.ring[pos] == nodeID {
+			delete(r.ring, pos)
+		}
 	}
-	r.rebuild()
 }
 
 ////////////////////////////////////////////////////////////////////////////////
@@ -184,7 +213,12 @@ func (r *Ring) GetNodes(key string, n int) []string {
 		return nil
 	}
 
-	pos := r.hash(key)
+	return r.nodesAt(r.hash(key), n)
+}
+
+// nodesAt is GetNodes for a ring position instead of a key.
+// Caller must hold r.mu.
+func (r *Ring) nodesAt(pos uint32, n int) []string {
 	idx := r.search(pos)
 
 	seen := make(map[string]bool)
@@ -226,6 +260,74 @@ func (r *Ring) Nodes() []string {
 	return nodes
 }
 
+// Vnodes returns the number of virtual nodes per physical node.
+//
+// Anyone rebuilding this ring elsewhere (e.g. a smart client)
+// must use the same value, or keys would hash to different owners.
+func (r *Ring) Vnodes() int {
+	return r.vnodes
+}
+
+// Weight returns nodeID's weight, or 0 if it is not on the ring.
+func (r *Ring) Weight(nodeID string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.weights[nodeID]
+}
+
+// Token returns the ring position of key.
+func (r *Ring) Token(key string) uint32 {
+	return r.hash(key)
+}
+
+// TokenRange is one arc of the ring: positions in (Start, End]
+// belong to the vnode at End, i.e. to Replicas[0].
+//
+// The first range wraps around: its Start is the LAST position,
+// so Start > End.
+type TokenRange struct {
+	Start    uint32   `json:"start"`
+	End      uint32   `json:"end"`
+	Replicas []string `json:"replicas"` // primary first
+}
+
+// Contains reports whether token falls in the range. A ring with a
+// single vnode has one range, Start == End, covering every token.
+func (tr TokenRange) Contains(token uint32) bool {
+	switch {
+	case tr.Start == tr.End:
+		return true
+	case tr.Start < tr.End:
+		return token > tr.Start && token <= tr.End
+	}
+	return token > tr.Start || token <= tr.End
+}
+
+// Ranges returns every token range in ring order,
+// with the n nodes that replicate it.
+func (r *Ring) Ranges(n int) []TokenRange {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]TokenRange, len(r.sorted))
+	for i, end := range r.sorted {
+		start := r.sorted[(i+len(r.sorted)-1)%len(r.sorted)]
+		out[i] = TokenRange{Start: start, End: end, Replicas: r.nodesAt(end, n)}
+	}
+	return out
+}
+
+// RangeEnd returns the End of the range that contains token.
+func (r *Ring) RangeEnd(token uint32) (uint32, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.sorted) == 0 {
+		return 0, false
+	}
+	return r.sorted[r.search(token)], true
+}
+
 // NodeCount returns how many physical nodes exist.
 //
 // Note: This is NOT number of virtual nodes.
@@ -0,0 +1,116 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"fmt"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// SESSION GUARANTEES
+////////////////////////////////////////////////////////////////////////////////
+
+// Quorums make a read see the last acked write only while W + R > N and
+// the write went to the key's home replicas. Async writes (X-Replication:
+// async), hinted writes and R=1 reads all break that: a client can write
+// a value and read back an older one, or read a value and then an older
+// one from another node.
+//
+// A session fixes that for one client. Every write and read answers with
+// the version it wrote or saw (a vector clock and a timestamp); the client
+// sends it back with its next read of the key, and the read only returns
+// a value at least as new:
+//
+//   - read-your-writes: after a write, reads return that write or newer
+//   - monotonic reads: after a read, reads never go back in time
+//
+// A read whose quorum comes back older asks every replica again, backing
+// off, until one has caught up (read repair and hints move the value
+// along) or the quorum timeout passes: then it fails with
+// ErrSessionBehind. The version is per key; see api/session.go for how it
+// travels.
+
+// ErrSessionBehind means no replica caught up with the session's version
+// of the key in time.
+var ErrSessionBehind = errors.New("replicas have not caught up with the session yet")
+
+// Session is the newest version of one key a client has seen.
+type Session struct {
+	Clock     store.VectorClock `json:"clock"`
+	UpdatedAt time.Time         `json:"at"`
+	HLC       store.HLC         `json:"hlc,omitempty"`
+}
+
+// SessionOf returns the session version of v.
+func SessionOf(v store.Value) Session {
+	return Session{Clock: v.Clock, UpdatedAt: v.UpdatedAt, HLC: v.HLC}
+}
+
+// Covers reports whether v is at least as new as s: the same version, a
+// descendant, or a concurrent one that wins over s (the replicas resolve
+// concurrent writes by HLC, see store/tiebreak.go).
+func (s Session) Covers(v *store.Value) bool {
+	if len(s.Clock) == 0 {
+		return true
+	}
+	if v == nil {
+		return false
+	}
+	switch v.Clock.Compare(s.Clock) {
+	case store.After, store.Equal:
+		return true
+	case store.ConcurrentClocks:
+		return store.CompareTime(*v, store.Value{UpdatedAt: s.UpdatedAt, HLC: s.HLC}) >= 0
+	}
+	return false
+}
+
+type sessionCtx struct{}
+
+// WithSession returns a ctx whose CoordinateRead returns nothing older
+// than s.
+func WithSession(ctx context.Context, s Session) context.Context {
+	return context.WithValue(ctx, sessionCtx{}, s)
+}
+
+// sessionFrom returns the session in ctx, if any.
+func sessionFrom(ctx context.Context) (Session, bool) {
+	s, ok := ctx.Value(sessionCtx{}).(Session)
+	return s, ok && len(s.Clock) > 0
+}
+
+// Session polling: first retry soon, then back off up to the cap.
+const (
+	sessionRetryMin = 5 * time.Millisecond
+	sessionRetryMax = 100 * time.Millisecond
+)
+
+// awaitSession re-reads key from every replica until the winner covers
+// s, or the quorum timeout passes.
+func (rep *Replicator) awaitSession(ctx context.Context, key string, s Session) (*store.Value, error) {
+	wait, cancel := rep.quorumWait(ctx)
+	defer cancel()
+	all := WithReadPolicy(wait, ReadRing) // a nearest read may have skipped the fresh replica
+
+	start, backoff := time.Now(), sessionRetryMin
+	for {
+		select {
+		case <-wait.Done():
+			return nil, fmt.Errorf("%w: waited %s", ErrSessionBehind, time.Since(start).Round(time.Millisecond))
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, sessionRetryMax)
+
+		v, err := rep.coordinateRead(all, key)
+		switch {
+		case err != nil && wait.Err() != nil && ctx.Err() == nil:
+			continue // our own wait ran out mid-read: report it as behind
+		case err != nil:
+			return nil, err
+		case s.Covers(v):
+			return v, nil
+		}
+	}
+}
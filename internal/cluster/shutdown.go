@@ -0,0 +1,194 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// GRACEFUL SHUTDOWN
+////////////////////////////////////////////////////////////////////////////////
+
+// A node that just exits leaves its peers to find out by timeouts: every
+// write for it burns its retries before it becomes a hint, until the
+// breaker opens, and the hints it held for other down peers are lost.
+// On SIGTERM it hands over first:
+//
+//  1. STOP      coordinator routes answer 503 with Retry-After and
+//     /readyz fails, so load balancers and clients go elsewhere. Peer
+//     routes are still served: the node is a replica until it exits.
+//  2. NOTIFY    with --shutdown-mode restart (the default) peers are
+//     told the node is going down for a while. They open its breaker
+//     (breaker.go): their writes for it become hints at once, and reads
+//     and forwards skip it, until it answers again. With decommission
+//     the node decommissions (decommission.go) and leaves the ring; if
+//     that fails it stops as for a restart.
+//  3. DRAIN     main stops the HTTP and gRPC servers, which wait for
+//     the requests in flight, quorum operations included.
+//  4. HAND OVER hints and the async queue get a last delivery pass.
+//     Hints for peers still down go to a live peer, which delivers them
+//     in our place. The async queue is on disk and resumes on restart.
+//
+// Main then takes the last snapshot and exits. All of it shares
+// --shutdown-timeout; whatever is left when it runs out is skipped.
+
+// Shutdown modes.
+const (
+	ShutdownRestart      = "restart"      // down for a while, keeps its ranges
+	ShutdownDecommission = "decommission" // moves its data and leaves the ring
+)
+
+// ErrShuttingDown is returned for client requests once shutdown has begun.
+var ErrShuttingDown = errors.New("node is shutting down")
+
+// ShutdownNotice is the body of POST /internal/shutdown.
+type ShutdownNotice struct {
+	From string `json:"from"`
+}
+
+// HintHandover is the body of POST /internal/hints: hints for Peer that
+// From could not deliver before it stopped.
+type HintHandover struct {
+	From  string             `json:"from"`
+	Peer  string             `json:"peer"`
+	Hints []ReplicateRequest `json:"hints"`
+}
+
+// shutdown is this node's shutdown state.
+type shutdown struct {
+	mode     string
+	stopping atomic.Bool
+}
+
+// SetShutdownMode sets what BeginShutdown does. Call before serving.
+func (rep *Replicator) SetShutdownMode(mode string) error {
+	if mode != ShutdownRestart && mode != ShutdownDecommission {
+		return fmt.Errorf("shutdown mode must be %s or %s", ShutdownRestart, ShutdownDecommission)
+	}
+	rep.shutdown.mode = mode
+	return nil
+}
+
+// ShuttingDown reports whether BeginShutdown was called.
+func (rep *Replicator) ShuttingDown() bool {
+	return rep.shutdown.stopping.Load()
+}
+
+// BeginShutdown stops taking client requests and tells the cluster this
+// node is going: steps 1 and 2 above. It returns once peers know, or
+// once the decommission is over.
+func (rep *Replicator) BeginShutdown(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	rep.shutdown.stopping.Store(true)
+
+	if rep.shutdown.mode == ShutdownDecommission {
+		err := rep.decommissionAndWait(ctx)
+		if err == nil {
+			return
+		}
+		logger.Error("decommission on shutdown failed; stopping as for a restart", "error", err)
+	}
+	if err := rep.Broadcast(ctx, http.MethodPost, "/internal/shutdown", ShutdownNotice{From: rep.selfID}); err != nil {
+		logger.Warn("shutdown notice incomplete; those peers will find out by timeouts", "error", err)
+	}
+}
+
+// decommissionAndWait decommissions this node and waits for it to leave.
+func (rep *Replicator) decommissionAndWait(ctx context.Context) error {
+	st := rep.DecommissionStatus()
+	if st.State == DecommissionLeft {
+		return nil
+	}
+	st, err := rep.Decommission(ctx)
+	if err != nil {
+		return err
+	}
+	for st.running() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("still %s after %d keys: %w", st.State, st.Keys, ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+		st = rep.DecommissionStatus()
+	}
+	if st.State != DecommissionLeft {
+		return errors.New(st.Error)
+	}
+	return nil
+}
+
+// PeerShuttingDown handles a peer's shutdown notice: it is failed fast
+// until it answers again.
+func (rep *Replicator) PeerShuttingDown(ctx context.Context, peerID string) {
+	rep.breakers.trip(peerID)
+	logging.FromContext(ctx).Info("peer shutting down: routing around it", "peer", peerID)
+}
+
+// HandOver delivers what this node still holds for others: step 4 above.
+// Call after the servers have stopped, so no new hints come in.
+func (rep *Replicator) HandOver(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	rep.DeliverHints(ctx)
+	rep.deliverOutbox(ctx)
+
+	for _, peerID := range rep.hints.peers() {
+		hints := rep.hints.snapshot(peerID)
+		holder := rep.hintHolder(peerID)
+		if holder == nil {
+			logger.Warn("hints lost on shutdown: no live peer to hand them to", "peer", peerID, "count", len(hints))
+			continue
+		}
+		body := HintHandover{From: rep.selfID, Peer: peerID, Hints: make([]ReplicateRequest, 0, len(hints))}
+		for key, val := range hints {
+			body.Hints = append(body.Hints, ReplicateRequest{Key: key, Value: val})
+		}
+		if err := rep.callPeer(ctx, holder, http.MethodPost, "/internal/hints", body, nil); err != nil {
+			logger.Warn("hint handover failed; hints lost", "peer", peerID, "count", len(hints), "to", holder.ID, "error", err)
+			continue
+		}
+		rep.hints.drop(peerID)
+		logger.Info("hints handed over", "peer", peerID, "count", len(hints), "to", holder.ID)
+	}
+
+	queued := 0
+	for _, n := range rep.outbox.counts() {
+		queued += n
+	}
+	if queued > 0 {
+		logger.Info("async writes left for the next start", "count", queued)
+	}
+}
+
+// hintHolder picks the peer to hand hints for peerID to: a member other
+// than peerID that is not failing and not leaving.
+func (rep *Replicator) hintHolder(peerID string) *Node {
+	for _, n := range rep.membership.All() {
+		if n.ID != rep.selfID && n.ID != peerID && !n.Draining && !rep.breakers.isOpen(n.ID) {
+			return &n
+		}
+	}
+	return nil
+}
+
+// TakeHints adds hints handed over by a peer that is shutting down, and
+// returns how many were kept. Hints for this node are applied.
+func (rep *Replicator) TakeHints(h HintHandover) (int, error) {
+	kept := 0
+	for _, r := range h.Hints {
+		if h.Peer == rep.selfID {
+			if _, err := rep.store.ApplyRemote(r.Key, r.Value); err != nil {
+				return kept, err
+			}
+		} else if !rep.hints.add(h.Peer, r.Key, r.Value) {
+			rep.stats.hintDropped(h.Peer, 1)
+			continue
+		}
+		kept++
+	}
+	return kept, nil
+}
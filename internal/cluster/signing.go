@@ -0,0 +1,247 @@
+package cluster
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// REQUEST SIGNING
+////////////////////////////////////////////////////////////////////////////////
+
+// The cluster token is a bearer secret: every peer request carries it,
+// so anyone who sees one request (a proxy log, a packet capture, a
+// misdirected call) can replay it or make up their own. With request
+// signing the token never leaves the node. Instead each peer request is
+// signed with it:
+//
+//	X-KV-Signed-At:      unix seconds
+//	X-KV-Nonce:          26 random base32 characters (130 bits)
+//	X-KV-Content-SHA256: hex SHA-256 of the body
+//	X-KV-Signature:      hex HMAC-SHA256(token, method \n URI \n peer \n signed-at \n nonce \n content hash)
+//
+// The receiver recomputes the HMAC, refuses signatures older or newer
+// than SignatureWindow, and checks the body against its hash before any
+// handler reads it. A signature binds the sender's ID (PeerHeader) and
+// the exact route, so it cannot be moved to another request.
+//
+// Within the window a captured request would still verify, so the
+// receiver also remembers the nonce of every request it accepted
+// (ReplayGuard) for as long as its signature could verify, and refuses
+// the nonce a second time. A replay is refused even on the node it was
+// meant for; sent to another node, it fails there only if that node saw
+// the nonce too, which is why the window stays short. The memory this
+// takes is about 100 bytes per peer request of the last 4 to 8 minutes.
+//
+// --auth-file's "peer_auth" picks what peers send and accept:
+//
+//	token   the bearer cluster token (the default, and what older builds speak)
+//	signed  both; a signature is checked when present, else the token.
+//	        A signature without a nonce, from builds before nonces, is
+//	        accepted too, but could be replayed within the window
+//	strict  signatures with a nonce only; a peer without one must present
+//	        a client certificate verified against --tls-ca (mutual TLS)
+//
+// To switch a running cluster, restart every node with "signed", then
+// every node with "strict".
+
+// Peer authentication modes.
+const (
+	PeerAuthToken  = "token"
+	PeerAuthSigned = "signed"
+	PeerAuthStrict = "strict"
+)
+
+// Signature headers.
+const (
+	SignedAtHeader      = "X-KV-Signed-At"
+	NonceHeader         = "X-KV-Nonce"
+	ContentSHA256Header = "X-KV-Content-SHA256"
+	SignatureHeader     = "X-KV-Signature"
+)
+
+// SignatureWindow is how far a signature's time may be from the
+// receiver's clock.
+const SignatureWindow = 2 * time.Minute
+
+// ErrBadSignature is returned for requests whose signature does not verify.
+var ErrBadSignature = errors.New("invalid request signature")
+
+// ValidPeerAuth reports whether mode is a peer authentication mode.
+func ValidPeerAuth(mode string) bool {
+	return mode == PeerAuthToken || mode == PeerAuthSigned || mode == PeerAuthStrict
+}
+
+// SetPeerAuth sets what this node sends peers: see the modes above.
+// Call before serving.
+func (rep *Replicator) SetPeerAuth(mode string) error {
+	if !ValidPeerAuth(mode) {
+		return fmt.Errorf("peer auth must be %s, %s or %s", PeerAuthToken, PeerAuthSigned, PeerAuthStrict)
+	}
+	rep.peerAuth = mode
+	return nil
+}
+
+// authenticate adds our credentials to a peer request. Call last: the
+// signature covers the headers set before it.
+func (rep *Replicator) authenticate(req *http.Request) {
+	if rep.clusterToken == "" {
+		return
+	}
+	if rep.peerAuth != PeerAuthStrict {
+		req.Header.Set("Authorization", "Bearer "+rep.clusterToken)
+	} else {
+		req.Header.Del("Authorization") // a forwarded client's token
+	}
+	if rep.peerAuth == PeerAuthSigned || rep.peerAuth == PeerAuthStrict {
+		// Peer bodies are in memory, so this does not fail. If it did,
+		// the request would go unsigned and a strict peer refuse it.
+		_ = SignRequest(req, []byte(rep.clusterToken), time.Now())
+	}
+}
+
+// SignRequest signs req with secret. The body is read through
+// req.GetBody, which http.NewRequest sets for in-memory bodies.
+func SignRequest(req *http.Request, secret []byte, now time.Time) error {
+	sum := sha256.New()
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(sum, body)
+		body.Close()
+		if err != nil {
+			return err
+		}
+	} else if req.Body != nil && req.Body != http.NoBody {
+		return errors.New("request body cannot be re-read for signing")
+	}
+	contentHash := hex.EncodeToString(sum.Sum(nil))
+	signedAt := strconv.FormatInt(now.Unix(), 10)
+	nonce := rand.Text()
+
+	req.Header.Set(SignedAtHeader, signedAt)
+	req.Header.Set(NonceHeader, nonce)
+	req.Header.Set(ContentSHA256Header, contentHash)
+	req.Header.Set(SignatureHeader, signature(secret, req.Method, req.URL.RequestURI(), req.Header.Get(PeerHeader), signedAt, nonce, contentHash))
+	return nil
+}
+
+// VerifyRequest checks the signature on req against secret, and that
+// replays (if not nil) has not seen its nonce before. On success
+// req.Body is replaced by the verified body.
+func VerifyRequest(req *http.Request, secret []byte, now time.Time, replays *ReplayGuard) error {
+	signedAt := req.Header.Get(SignedAtHeader)
+	nonce := req.Header.Get(NonceHeader)
+	contentHash := req.Header.Get(ContentSHA256Header)
+	sent, err := hex.DecodeString(req.Header.Get(SignatureHeader))
+	if err != nil || len(sent) != sha256.Size {
+		return fmt.Errorf("%w: malformed", ErrBadSignature)
+	}
+	secs, err := strconv.ParseInt(signedAt, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed %s", ErrBadSignature, SignedAtHeader)
+	}
+	if skew := now.Sub(time.Unix(secs, 0)); skew > SignatureWindow || skew < -SignatureWindow {
+		return fmt.Errorf("%w: signed %s away from our clock, window is %s", ErrBadSignature, skew.Round(time.Second), SignatureWindow)
+	}
+	switch {
+	case nonce == "" && replays != nil && replays.requireNonce:
+		return fmt.Errorf("%w: no %s", ErrBadSignature, NonceHeader)
+	case nonce != "" && len(nonce) != nonceLen:
+		return fmt.Errorf("%w: malformed %s", ErrBadSignature, NonceHeader)
+	}
+
+	// Check the HMAC first: the body is only read for a sender that
+	// knows the secret.
+	want, _ := hex.DecodeString(signature(secret, req.Method, req.URL.RequestURI(), req.Header.Get(PeerHeader), signedAt, nonce, contentHash))
+	if !hmac.Equal(sent, want) {
+		return ErrBadSignature
+	}
+
+	var body []byte
+	if req.Body != nil {
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		req.Body.Close()
+	}
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != contentHash {
+		return fmt.Errorf("%w: body does not match %s", ErrBadSignature, ContentSHA256Header)
+	}
+	// Last: only a request that verified in full uses up its nonce.
+	if nonce != "" && replays != nil && !replays.first(nonce, now) {
+		return fmt.Errorf("%w: replayed (nonce already seen)", ErrBadSignature)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
+
+// signature computes the hex HMAC over a request's signed fields. An
+// empty nonce is left out, as builds before nonces signed.
+func signature(secret []byte, method, uri, peer, signedAt, nonce, contentHash string) string {
+	fields := []string{method, uri, peer, signedAt}
+	if nonce != "" {
+		fields = append(fields, nonce)
+	}
+	mac := hmac.New(sha256.New, secret)
+	for _, f := range append(fields, contentHash) {
+		mac.Write([]byte(f))
+		mac.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// nonceLen is the length of a nonce, as rand.Text makes them.
+const nonceLen = 26
+
+// nonceMemory is how long a nonce must be remembered: a signature
+// verifies from SignatureWindow before its time to SignatureWindow after.
+const nonceMemory = 2 * SignatureWindow
+
+// ReplayGuard remembers the nonces of the signed requests a node
+// accepted, so that each is accepted once. Nonces are kept in two
+// generations, each nonceMemory long: a nonce is refused while it is in
+// either, so it is remembered for at least nonceMemory.
+type ReplayGuard struct {
+	requireNonce bool
+
+	mu        sync.Mutex
+	cur, prev map[string]struct{}
+	rotated   time.Time
+}
+
+// NewReplayGuard returns an empty ReplayGuard. With requireNonce,
+// signatures without a nonce are refused (peer_auth strict).
+func NewReplayGuard(requireNonce bool) *ReplayGuard {
+	return &ReplayGuard{requireNonce: requireNonce, cur: make(map[string]struct{}), prev: make(map[string]struct{})}
+}
+
+// first reports whether nonce is new, and remembers it.
+func (g *ReplayGuard) first(nonce string, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.rotated) >= nonceMemory {
+		g.prev, g.cur, g.rotated = g.cur, make(map[string]struct{}), now
+	}
+	if _, ok := g.cur[nonce]; ok {
+		return false
+	}
+	if _, ok := g.prev[nonce]; ok {
+		return false
+	}
+	g.cur[nonce] = struct{}{}
+	return true
+}
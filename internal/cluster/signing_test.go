@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("cluster-secret")
+
+// signedRequest returns a peer request signed at now.
+func signedRequest(t *testing.T, body string, now time.Time) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://n2/internal/replicate", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(PeerHeader, "n1")
+	if err := SignRequest(req, testSecret, now); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// resend is req as it arrives again: same headers, same body.
+func resend(t *testing.T, req *http.Request, body string) *http.Request {
+	t.Helper()
+	again := req.Clone(req.Context())
+	again.Body = io.NopCloser(strings.NewReader(body))
+	return again
+}
+
+func TestVerifyRequest(t *testing.T) {
+	now := time.Now()
+	const body = `{"key":"default/a"}`
+
+	t.Run("accepted once", func(t *testing.T) {
+		g := NewReplayGuard(false)
+		req := signedRequest(t, body, now)
+		if req.Header.Get(NonceHeader) == "" {
+			t.Fatal("signed request has no nonce")
+		}
+		if err := VerifyRequest(resend(t, req, body), testSecret, now, g); err != nil {
+			t.Fatalf("first: %v", err)
+		}
+		err := VerifyRequest(resend(t, req, body), testSecret, now.Add(time.Second), g)
+		if !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("replay: err = %v, want ErrBadSignature", err)
+		}
+	})
+
+	t.Run("nonces differ", func(t *testing.T) {
+		g := NewReplayGuard(true)
+		for range 3 {
+			if err := VerifyRequest(signedRequest(t, body, now), testSecret, now, g); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("remembered for the whole window", func(t *testing.T) {
+		g := NewReplayGuard(false)
+		g.first("earlier", now.Add(-SignatureWindow))      // the generation started before
+		signedAt := now.Add(SignatureWindow - time.Second) // a sender clock ahead
+		req := signedRequest(t, body, signedAt)
+		if err := VerifyRequest(resend(t, req, body), testSecret, now, g); err != nil {
+			t.Fatal(err)
+		}
+		// In the next generation, still inside the signature's window.
+		later := signedAt.Add(SignatureWindow - time.Second)
+		if err := VerifyRequest(resend(t, req, body), testSecret, later, g); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("replay %s later: err = %v, want ErrBadSignature", later.Sub(now), err)
+		}
+	})
+
+	t.Run("refused requests keep their nonce unused", func(t *testing.T) {
+		g := NewReplayGuard(false)
+		req := signedRequest(t, body, now)
+		if err := VerifyRequest(resend(t, req, `{"key":"default/b"}`), testSecret, now, g); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("tampered body: err = %v, want ErrBadSignature", err)
+		}
+		if err := VerifyRequest(resend(t, req, body), testSecret, now, g); err != nil {
+			t.Fatalf("genuine request after a forged one: %v", err)
+		}
+	})
+
+	t.Run("tampered nonce", func(t *testing.T) {
+		req := signedRequest(t, body, now)
+		req.Header.Set(NonceHeader, strings.Repeat("A", nonceLen))
+		if err := VerifyRequest(req, testSecret, now, NewReplayGuard(false)); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("err = %v, want ErrBadSignature", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		req := signedRequest(t, body, now.Add(-SignatureWindow-time.Second))
+		if err := VerifyRequest(req, testSecret, now, NewReplayGuard(false)); !errors.Is(err, ErrBadSignature) {
+			t.Fatalf("err = %v, want ErrBadSignature", err)
+		}
+	})
+}
+
+// TestVerifyRequestWithoutNonce covers signatures from builds before
+// nonces: accepted by signed, refused by strict.
+func TestVerifyRequestWithoutNonce(t *testing.T) {
+	now := time.Now()
+	const body = `{}`
+	req := signedRequest(t, body, now)
+	// Re-sign as an older build did: no nonce in the header or the HMAC.
+	req.Header.Del(NonceHeader)
+	req.Header.Set(SignatureHeader, signature(testSecret, req.Method, req.URL.RequestURI(), "n1",
+		req.Header.Get(SignedAtHeader), "", req.Header.Get(ContentSHA256Header)))
+
+	if err := VerifyRequest(resend(t, req, body), testSecret, now, NewReplayGuard(false)); err != nil {
+		t.Errorf("signed: %v", err)
+	}
+	if err := VerifyRequest(resend(t, req, body), testSecret, now, NewReplayGuard(true)); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("strict: err = %v, want ErrBadSignature", err)
+	}
+}
@@ -0,0 +1,516 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// EVENT SINKS
+////////////////////////////////////////////////////////////////////////////////
+
+// Event sinks publish every committed write to an external system: a
+// search indexer, an audit trail, a cache in another region. A write is
+// committed once its coordinator has acked it to the client: after the W
+// acks of a sync write, the local WAL append of an async one, the commit
+// of a transaction. The coordinator then hands it to each sink whose
+// prefix (namespace/key prefix) it matches.
+//
+//	client ─► coordinator ─► quorum ─► ack ─► sink queue (sinks/<name>.log) ─► sink
+//
+// Delivery is at least once:
+//
+//   - The event is on disk in the sink's queue before the client gets
+//     its answer, so a crash right after the ack does not lose it.
+//   - A batch is acked in the queue only after the sink accepted all of
+//     it. A failed batch, or one in flight when the node stopped, is sent
+//     again: consumers must tolerate duplicates. Seq (per sink, per node)
+//     tells them apart.
+//   - Past --sink-queue events a sink's queue refuses new ones (counted as
+//     dropped), rather than growing without bound while the sink is down.
+//
+// Events come from the node that coordinated the write, so two writes of
+// a key coordinated by different nodes reach a sink in no particular
+// order; compare clocks to order them. Writes that reach a replica any
+// other way (repairs, hints, anti-entropy) are not new commits and are
+// not published, nor is the locks namespace.
+//
+// A sink is anything implementing EventSink. Built in, by URL scheme:
+//
+//	http://, https://   → POST {"node", "sink", "events": [...]} (webhook)
+//	nats://host/subject → PUB of each event on subject (core NATS, see natssink.go)
+//
+// There is no Kafka client in this tree; a Kafka REST proxy takes the
+// webhook's POSTs.
+
+const (
+	// DefaultSinkQueue bounds the events queued per sink.
+	DefaultSinkQueue = 100000
+
+	sinkBatch      = 100
+	sinkRetry      = time.Second      // idle poll; also the first retry wait
+	sinkMaxBackoff = 30 * time.Second // longest wait between retries
+)
+
+// SinkEvent is one committed write, as a sink receives it.
+type SinkEvent struct {
+	Seq         uint64            `json:"seq"` // per sink and node, increasing
+	Op          string            `json:"op"`  // "put" or "delete"
+	Namespace   string            `json:"namespace"`
+	Key         string            `json:"key"`
+	Value       string            `json:"value,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Clock       store.VectorClock `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Node        string            `json:"node"` // the coordinator
+}
+
+// EventSink publishes events to an external system. Send returns nil
+// only once the system has accepted every event; on an error the whole
+// batch is sent again later.
+type EventSink interface {
+	Send(ctx context.Context, events []SinkEvent) error
+	Close() error
+}
+
+// SinkConfig is one --sinks entry.
+type SinkConfig struct {
+	Name   string
+	URL    string
+	Prefix string // internal key prefix: "" = everything, "orders/" = one namespace
+}
+
+var sinkNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ParseSinks parses --sinks ("name=url,...") and --sink-prefixes
+// ("name=namespace/prefix,...").
+func ParseSinks(sinks, prefixes string) ([]SinkConfig, error) {
+	var out []SinkConfig
+	seen := make(map[string]int)
+	for entry := range strings.SplitSeq(sinks, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, u, ok := strings.Cut(entry, "=")
+		if !ok || !sinkNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid sink %q: want name=url, name of [a-z0-9_-]", entry)
+		}
+		if _, dup := seen[name]; dup {
+			return nil, fmt.Errorf("sink %q given twice", name)
+		}
+		seen[name] = len(out)
+		out = append(out, SinkConfig{Name: name, URL: u})
+	}
+	for entry := range strings.SplitSeq(prefixes, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, prefix, ok := strings.Cut(entry, "=")
+		i, known := seen[name]
+		if !ok || !known {
+			return nil, fmt.Errorf("invalid sink prefix %q: want name=prefix for a sink in --sinks", entry)
+		}
+		out[i].Prefix = prefix
+	}
+	return out, nil
+}
+
+// NewEventSink builds the sink for cfg's URL scheme.
+func NewEventSink(cfg SinkConfig, nodeID string) (EventSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("sink %s: %w", cfg.Name, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return &webhookSink{url: cfg.URL, name: cfg.Name, node: nodeID}, nil
+	case "nats":
+		return newNATSSink(u, nodeID)
+	case "kafka":
+		return nil, fmt.Errorf("sink %s: no Kafka client in this build; point an http(s) sink at a Kafka REST proxy", cfg.Name)
+	default:
+		return nil, fmt.Errorf("sink %s: unsupported scheme %q (http, https, nats)", cfg.Name, u.Scheme)
+	}
+}
+
+// webhookSink POSTs each batch as JSON.
+type webhookSink struct {
+	url, name, node string
+}
+
+func (w *webhookSink) Send(ctx context.Context, events []SinkEvent) error {
+	body, err := json.Marshal(struct {
+		Node   string      `json:"node"`
+		Sink   string      `json:"sink"`
+		Events []SinkEvent `json:"events"`
+	}{w.node, w.name, events})
+	if err != nil {
+		return err
+	}
+	return postWebhook(ctx, w.url, body)
+}
+
+func (w *webhookSink) Close() error { return nil }
+
+// SinkStats describes one sink on one node.
+type SinkStats struct {
+	Name      string `json:"name"`
+	Prefix    string `json:"prefix,omitempty"`
+	Pending   int    `json:"pending"`
+	Published uint64 `json:"published"` // queued since start
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"` // refused by a full queue
+}
+
+// sinkQueue is one sink and its durable queue.
+//
+// The queue file is append-only NDJSON: {"event": …} lines as events are
+// queued, {"ack": seq} lines as batches are delivered. Replaying it
+// yields the events after the last ack. It is rewritten with just those
+// once it is mostly acked, as outbox.log is.
+type sinkQueue struct {
+	cfg  SinkConfig
+	sink EventSink
+	max  int
+	wake chan struct{}
+
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	logged  int         // lines in file
+	pending []SinkEvent // Seq ascending
+	next    uint64
+
+	published, delivered, dropped atomic.Uint64
+	full                          atomic.Bool // dropping; logged once until the next delivery
+}
+
+type sinkLine struct {
+	Event *SinkEvent `json:"event,omitempty"`
+	Ack   uint64     `json:"ack,omitempty"`
+}
+
+// OpenSinks starts publishing committed writes to sinks, each queued
+// under dir, and returns how many events earlier runs left undelivered.
+// Call it before serving.
+func (rep *Replicator) OpenSinks(dir string, cfgs []SinkConfig, queue int) (int, error) {
+	if len(cfgs) == 0 {
+		return 0, nil
+	}
+	if queue <= 0 {
+		return 0, errors.New("sink queue must be positive")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, cfg := range cfgs {
+		sink, err := NewEventSink(cfg, rep.selfID)
+		if err != nil {
+			return 0, err
+		}
+		q := &sinkQueue{cfg: cfg, sink: sink, max: queue, wake: make(chan struct{}, 1), path: filepath.Join(dir, cfg.Name+".log")}
+		if err := q.open(); err != nil {
+			return 0, fmt.Errorf("sink %s: %w", cfg.Name, err)
+		}
+		pending += len(q.pending)
+		rep.sinks = append(rep.sinks, q)
+	}
+	return pending, nil
+}
+
+// open replays the queue file and opens it for appending.
+func (q *sinkQueue) open() error {
+	if f, err := os.Open(q.path); err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 64<<20)
+		for sc.Scan() {
+			var l sinkLine
+			if json.Unmarshal(sc.Bytes(), &l) != nil {
+				continue // torn last line after a crash
+			}
+			q.logged++
+			switch {
+			case l.Event != nil:
+				q.pending = append(q.pending, *l.Event)
+				q.next = max(q.next, l.Event.Seq+1)
+			case l.Ack > 0:
+				q.dropThrough(l.Ack)
+			}
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	q.next = max(q.next, 1)
+
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	q.file = f
+	return nil
+}
+
+// dropThrough forgets the events up to seq. Caller must hold q.mu (or
+// own q exclusively).
+func (q *sinkQueue) dropThrough(seq uint64) {
+	i := 0
+	for i < len(q.pending) && q.pending[i].Seq <= seq {
+		i++
+	}
+	q.pending = q.pending[i:]
+}
+
+// CloseSinks closes the sinks and their queue files. Undelivered events
+// are kept for the next run.
+func (rep *Replicator) CloseSinks() error {
+	var errs []error
+	for _, q := range rep.sinks {
+		errs = append(errs, q.sink.Close())
+		q.mu.Lock()
+		errs = append(errs, q.file.Close())
+		q.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// SinkStats returns every sink's counters.
+func (rep *Replicator) SinkStats() []SinkStats {
+	out := make([]SinkStats, 0, len(rep.sinks))
+	for _, q := range rep.sinks {
+		q.mu.Lock()
+		n := len(q.pending)
+		q.mu.Unlock()
+		out = append(out, SinkStats{
+			Name: q.cfg.Name, Prefix: q.cfg.Prefix, Pending: n,
+			Published: q.published.Load(), Delivered: q.delivered.Load(), Dropped: q.dropped.Load(),
+		})
+	}
+	return out
+}
+
+// ─── Publishing ───────────────────────────────────────────────────────────────
+
+// publishCommitted hands writes this node coordinated, now acked, to the sinks.
+func (rep *Replicator) publishCommitted(ctx context.Context, entries ...store.BatchEntry) {
+	if len(rep.sinks) == 0 {
+		return
+	}
+	for _, e := range entries {
+		ns, key := store.SplitKey(e.Key)
+		if ns == store.LocksNamespace {
+			continue
+		}
+		var ev *SinkEvent
+		for _, q := range rep.sinks {
+			if !strings.HasPrefix(e.Key, q.cfg.Prefix) {
+				continue
+			}
+			if ev == nil {
+				var err error
+				if ev, err = rep.sinkEvent(ns, key, e.Value); err != nil {
+					logging.FromContext(ctx).Error("sink event", "key", e.Key, "error", err)
+					return
+				}
+			}
+			err := q.enqueue(*ev)
+			switch {
+			case errors.Is(err, errSinkFull):
+				if !q.full.Swap(true) {
+					logging.FromContext(ctx).Warn("sink queue full, dropping events", "sink", q.cfg.Name, "queue", q.max)
+				}
+			case err != nil:
+				logging.FromContext(ctx).Error("sink queue", "sink", q.cfg.Name, "key", e.Key, "error", err)
+			}
+		}
+	}
+}
+
+func (rep *Replicator) sinkEvent(ns, key string, v store.Value) (*SinkEvent, error) {
+	ev := &SinkEvent{Op: "put", Namespace: ns, Key: key, Clock: v.Clock, UpdatedAt: v.UpdatedAt, Node: rep.selfID}
+	if v.Tombstone {
+		ev.Op = "delete"
+		return ev, nil
+	}
+	decoded, err := v.Decode()
+	if err != nil {
+		return nil, err
+	}
+	ev.Value, ev.ContentType = decoded.Data, decoded.ContentType
+	return ev, nil
+}
+
+// errSinkFull is the error of an event a full sink queue refused.
+var errSinkFull = errors.New("sink queue is full; event dropped")
+
+// enqueue durably queues ev, numbering it.
+func (q *sinkQueue) enqueue(ev SinkEvent) error {
+	q.mu.Lock()
+	if len(q.pending) >= q.max {
+		q.mu.Unlock()
+		q.dropped.Add(1)
+		return errSinkFull
+	}
+	ev.Seq = q.next
+	line, err := json.Marshal(sinkLine{Event: &ev})
+	if err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	if _, err := q.file.Write(append(line, '\n')); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	q.next++
+	q.logged++
+	q.pending = append(q.pending, ev)
+	f := q.file
+	q.mu.Unlock()
+
+	q.published.Add(1)
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	// Outside the lock, as in the outbox: concurrent writers share syncs.
+	if err := f.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// ─── Delivery ─────────────────────────────────────────────────────────────────
+
+// RunSinks delivers queued events to every sink until ctx is done.
+func (rep *Replicator) RunSinks(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, q := range rep.sinks {
+		wg.Go(func() { q.run(ctx) })
+	}
+	wg.Wait()
+}
+
+// run sends q's events in batches, backing off while the sink fails.
+func (q *sinkQueue) run(ctx context.Context) {
+	log := logging.FromContext(ctx).With("sink", q.cfg.Name)
+	wait := sinkRetry
+	failing := false
+	for {
+		batch := q.head(sinkBatch)
+		if len(batch) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			case <-time.After(sinkRetry):
+			}
+			continue
+		}
+		if err := q.sink.Send(ctx, batch); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if !failing {
+				log.Warn("sink delivery failed, retrying", "pending", q.len(), "error", err)
+				failing = true
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+			wait = min(2*wait, sinkMaxBackoff)
+			continue
+		}
+		if failing {
+			log.Info("sink delivering again")
+			failing = false
+		}
+		wait = sinkRetry
+		q.ack(batch[len(batch)-1].Seq, len(batch))
+	}
+}
+
+// head copies the oldest n pending events.
+func (q *sinkQueue) head(n int) []SinkEvent {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]SinkEvent(nil), q.pending[:min(n, len(q.pending))]...)
+}
+
+func (q *sinkQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// ack records that the events up to seq were delivered. The ack line is
+// not synced: losing it only redelivers the batch.
+func (q *sinkQueue) ack(seq uint64, n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dropThrough(seq)
+	q.delivered.Add(uint64(n))
+	q.full.Store(false)
+	if line, err := json.Marshal(sinkLine{Ack: seq}); err == nil {
+		if _, err := q.file.Write(append(line, '\n')); err == nil {
+			q.logged++
+		}
+	}
+	q.compact()
+}
+
+// compact rewrites the queue file with just the pending events once most
+// of it is delivered. Caller must hold q.mu.
+func (q *sinkQueue) compact() {
+	if q.logged < 2*len(q.pending)+1000 {
+		return
+	}
+	if len(q.pending) == 0 {
+		if err := q.file.Truncate(0); err == nil {
+			q.logged = 0
+		}
+		return
+	}
+
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return // keep the long file; it is still correct
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range q.pending {
+		if err := enc.Encode(sinkLine{Event: &q.pending[i]}); err != nil {
+			f.Close()
+			return
+		}
+	}
+	if w.Flush() != nil || f.Sync() != nil || f.Close() != nil || os.Rename(tmp, q.path) != nil {
+		return
+	}
+	nf, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	q.file.Close()
+	q.file = nf
+	q.logged = len(q.pending)
+}
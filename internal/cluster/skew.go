@@ -0,0 +1,167 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CLOCK SKEW
+////////////////////////////////////////////////////////////////////////////////
+
+// Concurrent writes are settled by HLC (see store/hlc.go). A write made
+// after its node saw the other wins regardless of clocks, but between two
+// that never saw each other the coordinators' wall clocks decide: if n2's
+// clock runs 3s ahead, n2's writes win every such conflict within 3s of a
+// write elsewhere, even when they came first.
+//
+// Each readiness probe (readiness.go) of a peer's /health also reads the
+// peer's clock. Taking the request's midpoint as the moment the peer
+// answered, the difference is the peer's offset from ours, give or take
+// half the round trip:
+//
+//	n1 ──GET /health──▶ n2      t0 = 12:00:00.000 (n1)
+//	n1 ◀── time ─────── n2      n2 says 12:00:03.010
+//	                            t1 = 12:00:00.020 (n1)
+//	offset = 12:00:03.010 − 12:00:00.010 = +3s ± 10ms
+//
+// A peer whose offset exceeds --max-clock-skew, beyond the round trip's
+// error, is logged, and /admin/replication shows it. While one is, every
+// conflict a read here settles by time is counted and warned about (at
+// most once a minute). Nothing is refused: replicas that settled differently
+// would diverge for good. Run with --tiebreak node-id on every node
+// instead, which does not read clocks at all.
+
+// DefaultMaxClockSkew is the default --max-clock-skew.
+const DefaultMaxClockSkew = 500 * time.Millisecond
+
+// skewWarnEvery rate-limits the warnings about conflicts settled by time
+// while the clocks are skewed.
+const skewWarnEvery = time.Minute
+
+// clockSkew holds the latest offset of every peer's clock.
+type clockSkew struct {
+	mu    sync.Mutex
+	max   time.Duration // 0 = no threshold
+	peers map[string]skewSample
+
+	over     atomic.Int32  // peers over max
+	resolved atomic.Uint64 // conflicts settled by time while over
+	lastWarn atomic.Int64  // unix nanos
+}
+
+type skewSample struct {
+	offset time.Duration // the peer's clock minus ours
+	err    time.Duration // half the round trip
+	over   bool
+}
+
+// ClockSkewStats is this node's view of the cluster's clocks.
+type ClockSkewStats struct {
+	MaxMs    float64  `json:"max_ms"` // --max-clock-skew; 0 = no threshold
+	Skewed   []string `json:"skewed,omitempty"`
+	Tiebreak string   `json:"tiebreak"`
+	// ResolvedWhileSkewed counts the concurrent writes this node settled
+	// by time while a peer was skewed.
+	ResolvedWhileSkewed uint64 `json:"resolved_while_skewed"`
+}
+
+// SetMaxClockSkew sets the largest peer clock offset that is not
+// reported (0 = never report).
+func (rep *Replicator) SetMaxClockSkew(d time.Duration) {
+	rep.skew.mu.Lock()
+	defer rep.skew.mu.Unlock()
+	rep.skew.max = d
+}
+
+// observeClock records peer's clock, read as peerTime by a request sent
+// at t0 and answered at t1 (our clock).
+func (rep *Replicator) observeClock(ctx context.Context, peer string, t0, t1, peerTime time.Time) {
+	half := t1.Sub(t0) / 2
+	s := skewSample{offset: peerTime.Sub(t0.Add(half)), err: half}
+
+	rep.skew.mu.Lock()
+	if rep.skew.peers == nil {
+		rep.skew.peers = make(map[string]skewSample)
+	}
+	prev := rep.skew.peers[peer]
+	abs := max(s.offset, -s.offset)
+	s.over = rep.skew.max > 0 && abs-s.err > rep.skew.max
+	rep.skew.peers[peer] = s
+	limit := rep.skew.max
+	rep.skew.mu.Unlock()
+
+	logger := logging.FromContext(ctx)
+	switch {
+	case s.over && !prev.over:
+		rep.skew.over.Add(1)
+		logger.Warn("peer clock skew exceeds --max-clock-skew: conflicts settled by time may pick the wrong write",
+			"peer", peer, "offset", s.offset, "error", s.err, "max", limit)
+	case !s.over && prev.over:
+		rep.skew.over.Add(-1)
+		logger.Info("peer clock skew back within --max-clock-skew", "peer", peer, "offset", s.offset)
+	}
+}
+
+// forgetClock drops a peer's sample, e.g. when it stops answering.
+func (rep *Replicator) forgetClock(peer string) {
+	rep.skew.mu.Lock()
+	defer rep.skew.mu.Unlock()
+	if rep.skew.peers[peer].over {
+		rep.skew.over.Add(-1)
+	}
+	delete(rep.skew.peers, peer)
+}
+
+// noteConcurrent is called when a read here settles a and b, two
+// concurrent writes.
+func (rep *Replicator) noteConcurrent(a, b store.Value) {
+	if rep.skew.over.Load() == 0 || rep.store.Tiebreak() != store.TiebreakTime {
+		return
+	}
+	if a.Tombstone != b.Tombstone && rep.store.DeleteConflicts() != store.DeleteConflictsTiebreak {
+		return // settled by the delete policy, not by time
+	}
+	n := rep.skew.resolved.Add(1)
+	now := time.Now().UnixNano()
+	last := rep.skew.lastWarn.Load()
+	if now-last < int64(skewWarnEvery) || !rep.skew.lastWarn.CompareAndSwap(last, now) {
+		return
+	}
+	slog.Warn("concurrent writes settled by wall clock while peer clocks are skewed",
+		slog.Uint64("total", n), "tiebreak", store.TiebreakTime)
+}
+
+// clockSamples returns every peer's latest sample.
+func (rep *Replicator) clockSamples() map[string]skewSample {
+	rep.skew.mu.Lock()
+	defer rep.skew.mu.Unlock()
+	return maps.Clone(rep.skew.peers)
+}
+
+// ClockSkewStats returns this node's clock skew summary.
+func (rep *Replicator) ClockSkewStats() ClockSkewStats {
+	rep.skew.mu.Lock()
+	defer rep.skew.mu.Unlock()
+	st := ClockSkewStats{
+		MaxMs:               ms(rep.skew.max),
+		Tiebreak:            rep.store.Tiebreak(),
+		ResolvedWhileSkewed: rep.skew.resolved.Load(),
+	}
+	for id, s := range rep.skew.peers {
+		if s.over {
+			st.Skewed = append(st.Skewed, id)
+		}
+	}
+	slices.Sort(st.Skewed)
+	return st
+}
+
+func ms(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"errors"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// SLOW OPERATIONS
+////////////////////////////////////////////////////////////////////////////////
+
+// A sick node rarely fails outright: its disk stalls, its GC pauses, its
+// link drops packets, and every quorum it is part of gets slower. The
+// errors never come, so nothing is logged, and the only symptom is a
+// latency graph.
+//
+// So operations that take longer than a threshold are logged at WARN and
+// counted (GET /admin/replication):
+//
+//	Write     → a quorum write, from sending to the replicas until W acks
+//	Read      → a quorum read, until R replicas answered
+//	Replicate → one replicate call to one peer
+//	Fetch     → one fetch from one peer
+//
+// The quorum logs list every replica and how long it took, "pending" for
+// those that had not answered, so the slow one stands out:
+//
+//	msg="slow quorum write" key=users/42 took=812ms slowest=n3 replicas="n2=9ms n3=pending"
+//
+// The per-peer counters tell the same story over time: one peer with
+// many slow calls, seen from every coordinator, is the sick node.
+
+// SlowThresholds are the durations past which an operation is logged as
+// slow. Zero turns one off.
+type SlowThresholds struct {
+	Write     time.Duration
+	Read      time.Duration
+	Replicate time.Duration
+	Fetch     time.Duration
+}
+
+// DefaultSlowThresholds is used unless SetSlowThresholds is called.
+var DefaultSlowThresholds = SlowThresholds{
+	Write:     500 * time.Millisecond,
+	Read:      500 * time.Millisecond,
+	Replicate: time.Second,
+	Fetch:     time.Second,
+}
+
+// Validate checks that t is usable.
+func (t SlowThresholds) Validate() error {
+	if t.Write < 0 || t.Read < 0 || t.Replicate < 0 || t.Fetch < 0 {
+		return errors.New("slow thresholds must not be negative")
+	}
+	return nil
+}
+
+// SlowStats counts the slow quorum operations one node coordinated.
+type SlowStats struct {
+	Writes int64 `json:"writes"`
+	Reads  int64 `json:"reads"`
+}
+
+// SetSlowThresholds replaces the thresholds. Safe while serving.
+func (rep *Replicator) SetSlowThresholds(t SlowThresholds) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	rep.slow.Store(&t)
+	return nil
+}
+
+// SlowThresholds returns the thresholds in force.
+func (rep *Replicator) SlowThresholds() SlowThresholds {
+	return *rep.slow.Load()
+}
+
+// slowPeer logs and counts one peer call (op is "replicate" or "fetch")
+// if it took longer than limit.
+func (rep *Replicator) slowPeer(ctx context.Context, op string, limit time.Duration, peer, key string, took time.Duration, err error) {
+	if limit == 0 || took < limit {
+		return
+	}
+	rep.stats.slowPeer(peer, op)
+	attrs := []any{"peer", peer, "key", key, "took", took.Round(time.Millisecond), "threshold", limit}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	logging.FromContext(ctx).Warn("slow "+op, attrs...)
+}
+
+// quorumTimer times one quorum operation and the replicas in it.
+type quorumTimer struct {
+	start    time.Time
+	replicas []string                 // asked, in order
+	answered map[string]time.Duration // replica → time to its answer
+}
+
+func newQuorumTimer() *quorumTimer {
+	return &quorumTimer{start: time.Now(), answered: make(map[string]time.Duration)}
+}
+
+// ask records that replica id was sent the operation.
+func (t *quorumTimer) ask(id string) { t.replicas = append(t.replicas, id) }
+
+// answer records that replica id answered now.
+func (t *quorumTimer) answer(id string) { t.answered[id] = time.Since(t.start) }
+
+// slowQuorum logs and counts a quorum operation (op is "write" or
+// "read") if it took longer than limit.
+func (rep *Replicator) slowQuorum(ctx context.Context, op string, limit time.Duration, key string, t *quorumTimer) {
+	took := time.Since(t.start)
+	if limit == 0 || took < limit {
+		return
+	}
+	rep.stats.slowQuorum(op)
+
+	var (
+		b       strings.Builder
+		slowest string
+		worst   time.Duration
+	)
+	for i, id := range t.replicas {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		d, ok := t.answered[id]
+		if !ok {
+			b.WriteString(id + "=pending")
+			d = took
+		} else {
+			b.WriteString(id + "=" + d.Round(time.Millisecond).String())
+		}
+		if d > worst || slowest == "" {
+			slowest, worst = id, d
+		}
+	}
+	logging.FromContext(ctx).Warn("slow quorum "+op,
+		"key", key, "took", took.Round(time.Millisecond), "threshold", limit,
+		"slowest", slowest, "replicas", b.String())
+}
@@ -0,0 +1,496 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CLUSTER SNAPSHOTS
+////////////////////////////////////////////////////////////////////////////////
+
+// BackupCluster reads the nodes one after the other: on a large cluster
+// the last node is copied minutes after the first, and the archive mixes
+// data from all of those moments. A cluster snapshot has every node copy
+// its data at (about) the same moment instead:
+//
+//  1. The coordinator — the node asked — sends every member, in parallel,
+//     POST /internal/cluster-snapshot with a new snapshot ID.
+//  2. Each node copies its records in memory (store.BackupRecords, under
+//     its shard locks) as the request arrives and answers at once; the
+//     copies are therefore taken within about one round trip of each
+//     other. It then writes the copy in the background to
+//     <dir>/<id>/<node>.kvbak, a node backup archive.
+//  3. The coordinator polls the nodes until every part is written, then
+//     stores the manifest — each part's size, checksum and change number,
+//     plus the ring and the quorum — as <dir>/<id>/manifest.json on every
+//     node, so any node can serve it.
+//
+// The cut is approximate: a write coordinated during that round trip can
+// be in some replicas' parts and not in others'. Restoring every part
+// merges the replicas by vector clock, as a restore always does, so each
+// key comes back at its newest version in the cut.
+
+// Snapshot states.
+const (
+	SnapshotRunning = "running"
+	SnapshotDone    = "done"
+	SnapshotFailed  = "failed"
+)
+
+// snapshotPoll is how often the coordinator checks the parts being written.
+const snapshotPoll = 500 * time.Millisecond
+
+var (
+	// ErrSnapshotsDisabled is returned when no snapshot directory is set.
+	ErrSnapshotsDisabled = errors.New("cluster snapshots are not enabled on this node")
+	// ErrSnapshotNotFound is returned for an unknown snapshot or part.
+	ErrSnapshotNotFound = errors.New("cluster snapshot not found")
+	// ErrSnapshotRunning refuses to delete a snapshot being taken.
+	ErrSnapshotRunning = errors.New("cluster snapshot is still running")
+)
+
+// validSnapshotID matches the IDs NewSnapshotID makes; they name files.
+var validSnapshotID = regexp.MustCompile(`^[0-9A-Za-z-]{1,64}$`)
+
+// SnapshotManifest describes a cluster snapshot.
+type SnapshotManifest struct {
+	ID          string         `json:"id"`
+	State       string         `json:"state"`
+	Coordinator string         `json:"coordinator"`
+	Started     time.Time      `json:"started"`
+	Finished    time.Time      `json:"finished,omitzero"`
+	Error       string         `json:"error,omitempty"`
+	Ring        string         `json:"ring"` // the coordinator's ring view (see epoch.go)
+	Vnodes      int            `json:"vnodes"`
+	Quorum      QuorumConfig   `json:"quorum"`
+	Nodes       []Node         `json:"nodes"`
+	Parts       []SnapshotPart `json:"parts"`
+	// CutSpread is how far apart the first and last copies were taken,
+	// by the nodes' clocks.
+	CutSpread string `json:"cut_spread,omitempty"`
+}
+
+// SnapshotPart is one node's share of a cluster snapshot.
+type SnapshotPart struct {
+	Node    string    `json:"node"`
+	State   string    `json:"state"`
+	File    string    `json:"file"` // in the snapshot's directory
+	Records int       `json:"records"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	SHA256  string    `json:"sha256,omitempty"`
+	Seq     uint64    `json:"seq"` // the node's change number at the copy (see store/cdc.go)
+	TakenAt time.Time `json:"taken_at"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// snapshots is a node's snapshot bookkeeping.
+type snapshots struct {
+	dir     string // "" = disabled
+	mu      sync.Mutex
+	parts   map[string]SnapshotPart     // this node's parts, by snapshot ID
+	running map[string]SnapshotManifest // snapshots this node coordinates
+}
+
+// SetSnapshotDir enables cluster snapshots, kept under dir.
+// Call it before serving.
+func (rep *Replicator) SetSnapshotDir(dir string) {
+	rep.snapshots = snapshots{
+		dir:     dir,
+		parts:   make(map[string]SnapshotPart),
+		running: make(map[string]SnapshotManifest),
+	}
+}
+
+// NewSnapshotID returns a new snapshot ID: the UTC time and a random
+// suffix, e.g. 20261014-151933-9f2c.
+func NewSnapshotID() string {
+	b := make([]byte, 2)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+func (rep *Replicator) snapshotPath(id string, name ...string) (string, error) {
+	if rep.snapshots.dir == "" {
+		return "", ErrSnapshotsDisabled
+	}
+	if !validSnapshotID.MatchString(id) {
+		return "", ErrSnapshotNotFound
+	}
+	return filepath.Join(append([]string{rep.snapshots.dir, id}, name...)...), nil
+}
+
+// ─── Coordinator ──────────────────────────────────────────────────────────────
+
+// StartClusterSnapshot starts a cluster snapshot coordinated by this
+// node and returns it at once, running. SnapshotStatus follows it.
+func (rep *Replicator) StartClusterSnapshot(ctx context.Context) (SnapshotManifest, error) {
+	if rep.snapshots.dir == "" {
+		return SnapshotManifest{}, ErrSnapshotsDisabled
+	}
+	m := SnapshotManifest{
+		ID:          NewSnapshotID(),
+		State:       SnapshotRunning,
+		Coordinator: rep.selfID,
+		Started:     time.Now().UTC(),
+		Ring:        rep.membership.View().String(),
+		Vnodes:      rep.membership.Ring().Vnodes(),
+		Quorum:      rep.Quorum(),
+		Nodes:       rep.membership.All(),
+	}
+	rep.snapshots.mu.Lock()
+	rep.snapshots.running[m.ID] = m
+	rep.snapshots.mu.Unlock()
+
+	// Detach from the request: the snapshot outlives it.
+	go rep.runClusterSnapshot(logging.WithRequestID(context.Background(), logging.RequestID(ctx)), m)
+	return m, nil
+}
+
+func (rep *Replicator) runClusterSnapshot(ctx context.Context, m SnapshotManifest) {
+	logger := logging.FromContext(ctx)
+	logger.Info("cluster snapshot started", "id", m.ID, "nodes", len(m.Nodes))
+
+	// The cut: every node copies its data now, in parallel.
+	m.Parts = make([]SnapshotPart, len(m.Nodes))
+	var wg sync.WaitGroup
+	for i, n := range m.Nodes {
+		wg.Go(func() {
+			part, err := rep.takePartOn(ctx, n, m.ID)
+			if err != nil {
+				part = SnapshotPart{Node: n.ID, State: SnapshotFailed, Error: err.Error()}
+			}
+			m.Parts[i] = part
+		})
+	}
+	wg.Wait()
+	rep.updateRunning(m)
+
+	// Then wait for the parts to be written.
+	for !partsSettled(m.Parts) {
+		time.Sleep(snapshotPoll)
+		for i, part := range m.Parts {
+			if part.State != SnapshotRunning {
+				continue
+			}
+			n := m.Nodes[i]
+			var st SnapshotPart
+			if err := rep.partStatusOn(ctx, n, m.ID, &st); err != nil {
+				st = SnapshotPart{Node: n.ID, State: SnapshotFailed, Error: err.Error()}
+			}
+			m.Parts[i] = st
+		}
+		rep.updateRunning(m)
+	}
+
+	m.State, m.Finished = SnapshotDone, time.Now().UTC()
+	var failed []string
+	for _, part := range m.Parts {
+		if part.State != SnapshotDone {
+			failed = append(failed, fmt.Sprintf("node %s: %s", part.Node, part.Error))
+		}
+	}
+	if len(failed) > 0 {
+		m.State, m.Error = SnapshotFailed, strings.Join(failed, "; ")
+	}
+	m.CutSpread = cutSpread(m.Parts).String()
+
+	if err := rep.SaveSnapshotManifest(m); err != nil {
+		// Keep reporting it from memory, failed.
+		m.State, m.Error = SnapshotFailed, "save manifest: "+err.Error()
+		rep.updateRunning(m)
+	} else {
+		rep.snapshots.mu.Lock()
+		delete(rep.snapshots.running, m.ID)
+		rep.snapshots.mu.Unlock()
+		if err := rep.Broadcast(ctx, http.MethodPut, "/internal/cluster-snapshot/"+m.ID, m); err != nil {
+			// The coordinator has the manifest; the others only serve copies.
+			logger.Warn("cluster snapshot manifest propagation incomplete", "id", m.ID, "error", err)
+		}
+	}
+	logger.Info("cluster snapshot finished", "id", m.ID, "state", m.State, "cut_spread", m.CutSpread,
+		"took", time.Since(m.Started), "error", m.Error)
+}
+
+func (rep *Replicator) updateRunning(m SnapshotManifest) {
+	m.Parts = slices.Clone(m.Parts)
+	rep.snapshots.mu.Lock()
+	rep.snapshots.running[m.ID] = m
+	rep.snapshots.mu.Unlock()
+}
+
+func partsSettled(parts []SnapshotPart) bool {
+	return !slices.ContainsFunc(parts, func(p SnapshotPart) bool { return p.State == SnapshotRunning })
+}
+
+// cutSpread is the time between the first and last copy.
+func cutSpread(parts []SnapshotPart) time.Duration {
+	var first, last time.Time
+	for _, p := range parts {
+		if p.TakenAt.IsZero() {
+			continue
+		}
+		if first.IsZero() || p.TakenAt.Before(first) {
+			first = p.TakenAt
+		}
+		if p.TakenAt.After(last) {
+			last = p.TakenAt
+		}
+	}
+	return last.Sub(first)
+}
+
+// takePartOn has node n copy its part of snapshot id.
+func (rep *Replicator) takePartOn(ctx context.Context, n Node, id string) (SnapshotPart, error) {
+	if n.ID == rep.selfID {
+		return rep.TakeSnapshotPart(id)
+	}
+	var part SnapshotPart
+	err := rep.callPeer(ctx, &n, http.MethodPost, "/internal/cluster-snapshot", map[string]string{"id": id}, &part)
+	return part, err
+}
+
+func (rep *Replicator) partStatusOn(ctx context.Context, n Node, id string, out *SnapshotPart) error {
+	if n.ID == rep.selfID {
+		var err error
+		*out, err = rep.SnapshotPartStatus(id)
+		return err
+	}
+	return rep.callPeer(ctx, &n, http.MethodGet, "/internal/cluster-snapshot/"+id+"/part", nil, out)
+}
+
+// ─── Node parts ───────────────────────────────────────────────────────────────
+
+// TakeSnapshotPart copies this node's records for snapshot id and
+// writes them to disk in the background. It returns the part, running.
+func (rep *Replicator) TakeSnapshotPart(id string) (SnapshotPart, error) {
+	dir, err := rep.snapshotPath(id)
+	if err != nil {
+		return SnapshotPart{}, err
+	}
+	rep.snapshots.mu.Lock()
+	if part, ok := rep.snapshots.parts[id]; ok {
+		rep.snapshots.mu.Unlock()
+		return part, nil // a retried request
+	}
+	recs, nss := rep.store.BackupRecords()
+	part := SnapshotPart{
+		Node:    rep.selfID,
+		State:   SnapshotRunning,
+		File:    rep.selfID + ".kvbak",
+		Records: len(recs),
+		Seq:     rep.store.ChangeSeq(),
+		TakenAt: time.Now().UTC(),
+	}
+	rep.snapshots.parts[id] = part
+	rep.snapshots.mu.Unlock()
+
+	go func() {
+		var err error
+		part.Bytes, part.SHA256, err = writeSnapshotPart(dir, part, recs, nss)
+		part.State = SnapshotDone
+		if err != nil {
+			part.State, part.Error = SnapshotFailed, err.Error()
+		}
+		rep.snapshots.mu.Lock()
+		rep.snapshots.parts[id] = part
+		rep.snapshots.mu.Unlock()
+	}()
+	return part, nil
+}
+
+// writeSnapshotPart writes recs as dir/part.File, atomically, and
+// returns its size and SHA-256.
+func writeSnapshotPart(dir string, part SnapshotPart, recs []store.BackupRecord, nss []store.Namespace) (int64, string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, "", err
+	}
+	tmp, err := os.CreateTemp(dir, part.File+".*.tmp")
+	if err != nil {
+		return 0, "", err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	sum := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(tmp, sum)}
+	bw, err := store.NewBackupWriter(cw, store.BackupHeader{
+		Node:       part.Node,
+		Scope:      "snapshot",
+		CreatedAt:  part.TakenAt,
+		Namespaces: nss,
+	})
+	if err == nil {
+		for _, rec := range recs {
+			if err = bw.Write(rec); err != nil {
+				break
+			}
+		}
+		err = errors.Join(err, bw.Close())
+	}
+	err = errors.Join(err, tmp.Sync(), tmp.Close())
+	if err != nil {
+		return 0, "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, part.File)); err != nil {
+		return 0, "", err
+	}
+	return cw.n, hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// SnapshotPartStatus returns this node's part of snapshot id.
+func (rep *Replicator) SnapshotPartStatus(id string) (SnapshotPart, error) {
+	if _, err := rep.snapshotPath(id); err != nil {
+		return SnapshotPart{}, err
+	}
+	rep.snapshots.mu.Lock()
+	defer rep.snapshots.mu.Unlock()
+	part, ok := rep.snapshots.parts[id]
+	if !ok {
+		return SnapshotPart{}, ErrSnapshotNotFound
+	}
+	return part, nil
+}
+
+// OpenSnapshotPart opens node's archive of snapshot id, on this node or
+// streamed from node.
+func (rep *Replicator) OpenSnapshotPart(ctx context.Context, id, node string) (io.ReadCloser, error) {
+	if node != rep.selfID {
+		n, ok := rep.membership.GetNode(node)
+		if !ok {
+			return nil, ErrUnknownNode
+		}
+		body, err := rep.streamPeer(ctx, n, "/internal/cluster-snapshot/"+id+"/archive")
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", node, err)
+		}
+		return body, nil
+	}
+	path, err := rep.snapshotPath(id, rep.selfID+".kvbak")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSnapshotNotFound
+	}
+	return f, err
+}
+
+// ─── Manifests ────────────────────────────────────────────────────────────────
+
+// SaveSnapshotManifest stores m on this node.
+func (rep *Replicator) SaveSnapshotManifest(m SnapshotManifest) error {
+	path, err := rep.snapshotPath(m.ID, "manifest.json")
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// SnapshotStatus returns snapshot id: running here, or finished and
+// stored on this node.
+func (rep *Replicator) SnapshotStatus(id string) (SnapshotManifest, error) {
+	path, err := rep.snapshotPath(id, "manifest.json")
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+	rep.snapshots.mu.Lock()
+	m, ok := rep.snapshots.running[id]
+	rep.snapshots.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return SnapshotManifest{}, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return SnapshotManifest{}, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// Snapshots lists the snapshots this node knows, oldest first.
+func (rep *Replicator) Snapshots() ([]SnapshotManifest, error) {
+	if rep.snapshots.dir == "" {
+		return nil, ErrSnapshotsDisabled
+	}
+	entries, err := os.ReadDir(rep.snapshots.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var list []SnapshotManifest
+	for _, e := range entries {
+		if m, err := rep.SnapshotStatus(e.Name()); err == nil {
+			list, seen[m.ID] = append(list, m), true
+		}
+	}
+	rep.snapshots.mu.Lock()
+	for id, m := range rep.snapshots.running {
+		if !seen[id] {
+			list = append(list, m)
+		}
+	}
+	rep.snapshots.mu.Unlock()
+	slices.SortFunc(list, func(a, b SnapshotManifest) int { return a.Started.Compare(b.Started) })
+	return list, nil
+}
+
+// RemoveSnapshot deletes this node's files of snapshot id.
+func (rep *Replicator) RemoveSnapshot(id string) error {
+	dir, err := rep.snapshotPath(id)
+	if err != nil {
+		return err
+	}
+	rep.snapshots.mu.Lock()
+	m, coordinated := rep.snapshots.running[id]
+	part, ok := rep.snapshots.parts[id]
+	if coordinated && m.State == SnapshotRunning || ok && part.State == SnapshotRunning {
+		rep.snapshots.mu.Unlock()
+		return ErrSnapshotRunning
+	}
+	delete(rep.snapshots.running, id)
+	delete(rep.snapshots.parts, id)
+	rep.snapshots.mu.Unlock()
+	return os.RemoveAll(dir)
+}
@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TIMEOUTS AND RETRIES
+////////////////////////////////////////////////////////////////////////////////
+
+// A LAN cluster wants reads to fail in tens of milliseconds; a cluster
+// spread over regions needs seconds. So the latency budget is config:
+//
+//	Quorum       → longest wait for W (or R) replicas
+//	Peer         → one call to one peer
+//	Attempts     → tries per replica write before it becomes a hint
+//	RetryBackoff → wait before the 2nd try; doubles after each try
+//
+// A request can only shorten the budget: if its context has a deadline
+// (the client sent X-Request-Timeout), quorum waits end there too.
+//
+// Cancellation follows the quorum (see fanout): while the client waits,
+// its disconnect or deadline cancels the replica calls — unfinished
+// writes become hints. Once the quorum is met, the remaining calls are
+// detached and run to their own timeout, so every replica still gets
+// the write (and read repair still runs).
+
+// RequestTimeoutHeader carries a client's remaining time budget.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
+// Timeouts configures the replicator's latency budget.
+type Timeouts struct {
+	Quorum       time.Duration
+	Peer         time.Duration
+	Attempts     int
+	RetryBackoff time.Duration
+}
+
+// DefaultTimeouts is used unless SetTimeouts is called.
+var DefaultTimeouts = Timeouts{
+	Quorum:       5 * time.Second,
+	Peer:         3 * time.Second,
+	Attempts:     3,
+	RetryBackoff: 100 * time.Millisecond,
+}
+
+// Validate checks that t is usable.
+func (t Timeouts) Validate() error {
+	if t.Quorum <= 0 || t.Peer <= 0 || t.Attempts < 1 || t.RetryBackoff < 0 {
+		return errors.New("timeouts must be positive and attempts at least 1")
+	}
+	return nil
+}
+
+// SetTimeouts replaces the timeouts. Safe while serving: operations
+// already running keep the values they started with.
+func (rep *Replicator) SetTimeouts(t Timeouts) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	rep.timeouts.Store(&t)
+	return nil
+}
+
+// Timeouts returns the timeouts in force.
+func (rep *Replicator) Timeouts() Timeouts {
+	return *rep.timeouts.Load()
+}
+
+// quorumWait bounds one quorum wait: the configured timeout, or the
+// request's deadline if that comes first.
+func (rep *Replicator) quorumWait(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, rep.Timeouts().Quorum)
+}
+
+// peerContext derives the context for one peer call: ctx, bounded by
+// the peer timeout.
+func (rep *Replicator) peerContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, rep.Timeouts().Peer)
+}
+
+// fanout derives the context for the replica calls of one quorum
+// operation. It is cancelled when ctx is, until detach is called;
+// after that it lives on (with ctx's values) until cancel.
+func fanout(ctx context.Context) (fctx context.Context, detach func() bool, cancel context.CancelFunc) {
+	fctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	return fctx, context.AfterFunc(ctx, cancel), cancel
+}
+
+// backoff returns the wait before attempt (0-based; attempt 0 = none).
+func (rep *Replicator) backoff(attempt int) time.Duration {
+	if attempt == 0 {
+		return 0
+	}
+	return rep.Timeouts().RetryBackoff << (attempt - 1)
+}
@@ -0,0 +1,96 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// PEER TRANSPORT
+////////////////////////////////////////////////////////////////////////////////
+
+// Replication is many small requests to the same few hosts, so
+// connection reuse matters more than anything else.
+//
+// Go's default transport keeps only 2 idle connections per host. Under a
+// write burst every request beyond the first two opens a fresh TCP (and
+// TLS) connection, and closes it right after — thousands of handshakes
+// per second and sockets piling up in TIME_WAIT.
+//
+// So every node uses ONE transport for all peer traffic:
+//
+//   - a large idle pool per peer (MaxIdleConnsPerHost)
+//   - TCP keep-alives, so dead peers are noticed by the kernel
+//   - HTTP/2 over TLS (negotiated via ALPN, falls back to HTTP/1.1)
+//   - optionally HTTP/2 without TLS (h2c), for plaintext clusters
+//
+// With HTTP/2 a single connection per peer multiplexes every request.
+
+// TransportConfig tunes peer connections.
+type TransportConfig struct {
+	Timeout             time.Duration // whole request, for non-streaming calls
+	DialTimeout         time.Duration
+	KeepAlive           time.Duration // TCP keep-alive probe interval
+	IdleConnTimeout     time.Duration // close idle pooled connections after this
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int  // 0 = unlimited
+	H2C                 bool // HTTP/2 without TLS; every peer must accept it
+}
+
+// DefaultTransportConfig is used unless SetTransport is called.
+var DefaultTransportConfig = TransportConfig{
+	Timeout:             5 * time.Second,
+	DialTimeout:         2 * time.Second,
+	KeepAlive:           30 * time.Second,
+	IdleConnTimeout:     90 * time.Second,
+	MaxIdleConnsPerHost: 64,
+}
+
+// newPeerTransport builds the shared transport. tlsCfg may be nil.
+func newPeerTransport(cfg TransportConfig, tlsCfg *tls.Config) *http.Transport {
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+	t := &http.Transport{
+		Proxy:                 nil, // peers are never reached through a proxy
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsCfg,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          0, // bounded per host below
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.DialTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if cfg.H2C && tlsCfg == nil {
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return t
+}
+
+// ServerProtocols returns the protocols a node's HTTP server should accept:
+// HTTP/1.1 and HTTP/2, including h2c so peers may use TransportConfig.H2C.
+func ServerProtocols() *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	p.SetUnencryptedHTTP2(true)
+	return p
+}
+
+// SetTransport replaces the peer transport settings. Call before serving.
+func (rep *Replicator) SetTransport(cfg TransportConfig) {
+	rep.transportCfg = cfg
+	rep.rebuildClients()
+}
+
+// rebuildClients recreates the shared peer clients from the current
+// transport settings and TLS config.
+func (rep *Replicator) rebuildClients() {
+	t := newPeerTransport(rep.transportCfg, rep.tlsCfg)
+	rep.httpClient = &http.Client{Timeout: rep.transportCfg.Timeout, Transport: t}
+	// Same transport (and pool), no overall timeout: backups stream for minutes.
+	rep.streamClient = &http.Client{Transport: t}
+}
@@ -0,0 +1,635 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TWO-PHASE COMMIT
+////////////////////////////////////////////////////////////////////////////////
+
+// A transaction whose keys live on different replicas has no single node
+// that can lock and write them all (see txn.go). It runs as a two-phase
+// commit instead, coordinated by whichever node received it:
+//
+//  1. Prepare: every replica of every key locks the keys it holds and
+//     logs them as prepared in its txn.log. A replica whose locks are
+//     taken by another transaction votes no, and the coordinator aborts.
+//  2. The coordinator reads the keys at quorum and evaluates the checks.
+//  3. Decide: if every replica voted yes and the checks hold, the
+//     coordinator logs the new versions as committed in ITS txn.log.
+//     That line is the commit point.
+//  4. Commit: each replica applies its share of the writes as one batch
+//     (see store/txn.go) and releases its locks. On abort the replicas
+//     only release.
+//
+// After a crash:
+//   - The coordinator logs nothing before deciding, so a transaction it
+//     has no record of never committed (presumed abort).
+//   - It reloads the commits not yet applied everywhere and re-sends
+//     them until every replica has acknowledged (RunTxnRecovery).
+//   - A replica reloads its prepared transactions and takes their locks
+//     again. One left prepared for long asks the coordinator for the
+//     outcome (GET /internal/txn/:id) and commits or aborts.
+//
+// The price is availability: every replica of every key must vote yes,
+// so one down replica fails the transaction. And a replica prepared for
+// a coordinator that never comes back keeps its keys locked against
+// other transactions (not against plain writes) until it does.
+
+// Transaction outcomes, as reported by GET /internal/txn/:id.
+const (
+	TxnPending   = "pending"
+	TxnCommitted = "committed"
+	TxnAborted   = "aborted"
+)
+
+// The other states of a txn.log line.
+const (
+	txnPrepared = "prepared" // participant: locked, waiting for the outcome
+	txnDone     = "done"     // coordinator: every replica applied the commit
+)
+
+// Roles of a txn.log line.
+const (
+	roleCoordinator = "coordinator"
+	roleParticipant = "participant"
+)
+
+// ErrTxnAborted means a two-phase transaction was aborted before its
+// checks could be evaluated: a replica did not prepare.
+var ErrTxnAborted = errors.New("transaction aborted")
+
+// PhaseRequest is the body of POST /internal/txn/{prepare,commit,abort}.
+type PhaseRequest struct {
+	ID          string             `json:"id"`
+	Coordinator string             `json:"coordinator,omitempty"` // prepare: who decides
+	Keys        []string           `json:"keys,omitempty"`        // prepare: keys to lock
+	Entries     []store.BatchEntry `json:"entries,omitempty"`     // commit: writes to apply
+}
+
+// TxnDecision is the body of GET /internal/txn/:id.
+type TxnDecision struct {
+	State   string             `json:"state"`             // TxnPending, TxnCommitted or TxnAborted
+	Entries []store.BatchEntry `json:"entries,omitempty"` // committed: the asking node's writes
+}
+
+// txnRecord is one line of txn.log. The last line of an (ID, Role) wins.
+type txnRecord struct {
+	ID          string              `json:"id"`
+	Role        string              `json:"role"`
+	State       string              `json:"state"`
+	Coordinator string              `json:"coordinator,omitempty"` // participant
+	Keys        []string            `json:"keys,omitempty"`        // participant: keys locked
+	Shares      map[string][]string `json:"shares,omitempty"`      // coordinator: replica → its keys
+	Entries     []store.BatchEntry  `json:"entries,omitempty"`     // coordinator: the writes
+	Time        time.Time           `json:"time"`
+}
+
+// live reports whether rec still needs work after a restart.
+func (rec txnRecord) live() bool {
+	return rec.Role == roleCoordinator && rec.State == TxnCommitted ||
+		rec.Role == roleParticipant && rec.State == txnPrepared
+}
+
+// entriesFor returns the writes to keys.
+func (rec txnRecord) entriesFor(keys []string) []store.BatchEntry {
+	var out []store.BatchEntry
+	for _, e := range rec.Entries {
+		if slices.Contains(keys, e.Key) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// preparedTxn is a transaction this node has prepared, holding its locks.
+type preparedTxn struct {
+	rec    txnRecord
+	unlock func()
+}
+
+// twoPhase holds this node's open two-phase transactions, in both roles,
+// and the log that carries them over a restart.
+type twoPhase struct {
+	mu       sync.Mutex
+	path     string                  // "" = memory only
+	file     *os.File                // append-only txn.log
+	logged   int                     // lines in file; compacted when mostly finished
+	running  map[string]bool         // coordinating, not decided yet
+	decided  map[string]*txnRecord   // coordinating, committed, not applied everywhere
+	prepared map[string]*preparedTxn // participating, waiting for the outcome
+}
+
+func newTwoPhase() *twoPhase {
+	return &twoPhase{
+		running:  make(map[string]bool),
+		decided:  make(map[string]*txnRecord),
+		prepared: make(map[string]*preparedTxn),
+	}
+}
+
+// OpenTxnLog makes two-phase transactions durable at path. It reloads
+// what a previous run left open, taking the locks of prepared ones again,
+// and returns how many. Call before serving.
+func (rep *Replicator) OpenTxnLog(path string) (int, error) {
+	tp := newTwoPhase()
+	tp.path = path
+
+	last := make(map[[2]string]txnRecord)
+	if f, err := os.Open(path); err == nil {
+		sc := bufio.NewScanner(f)
+		sc.Buffer(nil, 64<<20)
+		for sc.Scan() {
+			var rec txnRecord
+			if json.Unmarshal(sc.Bytes(), &rec) != nil {
+				continue // torn last line after a crash
+			}
+			last[[2]string{rec.ID, rec.Role}] = rec
+			tp.logged++
+		}
+		f.Close()
+		if err := sc.Err(); err != nil {
+			return 0, err
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	for _, rec := range last {
+		if !rec.live() {
+			continue
+		}
+		if rec.Role == roleCoordinator {
+			tp.decided[rec.ID] = &rec
+			continue
+		}
+		// Held together before the restart, so they cannot block each other.
+		unlock, err := rep.txnLocks.lock(context.Background(), rec.Keys)
+		if err != nil {
+			return 0, err
+		}
+		tp.prepared[rec.ID] = &preparedTxn{rec: rec, unlock: unlock}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	tp.file = f
+	tp.compact()
+	rep.twoPhase = tp
+	return len(tp.decided) + len(tp.prepared), nil
+}
+
+// CloseTxnLog closes txn.log. Open transactions are kept for the next run.
+func (rep *Replicator) CloseTxnLog() error {
+	tp := rep.twoPhase
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if tp.file == nil {
+		return nil
+	}
+	return tp.file.Close()
+}
+
+// log appends rec to txn.log and syncs it. Caller must hold tp.mu.
+func (tp *twoPhase) log(rec txnRecord) error {
+	if tp.file == nil {
+		return nil
+	}
+	rec.Time = time.Now().UTC()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := tp.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	tp.logged++
+	return tp.file.Sync()
+}
+
+// compact rewrites txn.log with just the open transactions, once most of
+// it is finished. Caller must hold tp.mu (or own tp exclusively).
+func (tp *twoPhase) compact() {
+	live := len(tp.decided) + len(tp.prepared)
+	if tp.file == nil || tp.logged == 0 || live > 0 && tp.logged < 2*live+1000 {
+		return
+	}
+	if live == 0 {
+		if err := tp.file.Truncate(0); err == nil {
+			tp.logged = 0
+		}
+		return
+	}
+
+	tmp := tp.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return // keep the long log; it is still correct
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range tp.decided {
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return
+		}
+	}
+	for _, p := range tp.prepared {
+		if err := enc.Encode(p.rec); err != nil {
+			f.Close()
+			return
+		}
+	}
+	if w.Flush() != nil || f.Sync() != nil || f.Close() != nil || os.Rename(tmp, tp.path) != nil {
+		return
+	}
+	nf, err := os.OpenFile(tp.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	tp.file.Close()
+	tp.file = nf
+	tp.logged = live
+}
+
+// ─── Coordinator ──────────────────────────────────────────────────────────────
+
+// ExecuteDistributedTxn runs t as a two-phase commit coordinated by this
+// node. As with ExecuteTxn, failed checks are not an error; a replica
+// that does not prepare is (ErrTxnAborted).
+func (rep *Replicator) ExecuteDistributedTxn(ctx context.Context, t Txn) (TxnResult, error) {
+	if err := t.Validate(); err != nil {
+		return TxnResult{}, err
+	}
+	keys := t.Keys()
+	shares, err := rep.txnShares(keys)
+	if err != nil {
+		return TxnResult{}, err
+	}
+
+	tp := rep.twoPhase
+	id := "txn-" + rep.selfID + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	tp.mu.Lock()
+	tp.running[id] = true
+	tp.mu.Unlock()
+	defer func() {
+		tp.mu.Lock()
+		delete(tp.running, id)
+		tp.mu.Unlock()
+	}()
+	logger := logging.FromContext(ctx).With("txn", id)
+
+	// 1. Prepare.
+	if err := rep.prepareAll(ctx, id, shares); err != nil {
+		rep.abortAll(ctx, id, shares)
+		logger.Warn("transaction aborted", "error", err)
+		return TxnResult{}, fmt.Errorf("%w: %w", ErrTxnAborted, err)
+	}
+
+	// 2. Read and check.
+	current, err := rep.readAll(ctx, keys)
+	if err != nil {
+		rep.abortAll(ctx, id, shares)
+		return TxnResult{}, err
+	}
+	failed, err := t.failedChecks(current)
+	if err != nil || len(failed) > 0 {
+		rep.abortAll(ctx, id, shares)
+		return TxnResult{Failed: failed}, err
+	}
+
+	// 3. Decide.
+	entries, err := rep.store.NewVersions(ctx, t.writes(current))
+	if err != nil {
+		rep.abortAll(ctx, id, shares)
+		return TxnResult{}, err
+	}
+	rec := txnRecord{ID: id, Role: roleCoordinator, State: TxnCommitted, Shares: shares, Entries: entries}
+	tp.mu.Lock()
+	err = tp.log(rec)
+	if err == nil {
+		tp.decided[id] = &rec
+	}
+	tp.mu.Unlock()
+	if err != nil {
+		rep.abortAll(ctx, id, shares)
+		return TxnResult{}, fmt.Errorf("log commit: %w", err)
+	}
+
+	// 4. Commit. Replicas that miss it get it from RunTxnRecovery.
+	if pending := rep.deliverCommit(ctx, id); len(pending) > 0 {
+		logger.Warn("transaction committed; some replicas will apply it later", "pending", pending)
+	}
+	rep.replicatePending(ctx, entries)
+	rep.publishCommitted(ctx, entries...)
+	return committed(entries), nil
+}
+
+// txnShares returns the keys each replica of keys holds.
+func (rep *Replicator) txnShares(keys []string) (map[string][]string, error) {
+	n := rep.Quorum().N
+	shares := make(map[string][]string)
+	for _, key := range keys {
+		nodes := rep.membership.ReplicaNodes(key, n)
+		if len(nodes) == 0 {
+			return nil, errors.New("no replicas available")
+		}
+		for _, node := range nodes {
+			shares[node.ID] = append(shares[node.ID], key)
+		}
+	}
+	return shares, nil
+}
+
+// prepareAll asks every replica to prepare its share, in parallel.
+func (rep *Replicator) prepareAll(ctx context.Context, id string, shares map[string][]string) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for nodeID, keys := range shares {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := PhaseRequest{ID: id, Coordinator: rep.selfID, Keys: keys}
+			if err := rep.sendPhase(ctx, nodeID, "prepare", req); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("node %s: %w", nodeID, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// abortAll tells every replica to release, in the background. One that
+// does not hear it asks later, and gets TxnAborted.
+func (rep *Replicator) abortAll(ctx context.Context, id string, shares map[string][]string) {
+	ctx = context.WithoutCancel(ctx)
+	for nodeID := range shares {
+		go rep.sendPhase(ctx, nodeID, "abort", PhaseRequest{ID: id})
+	}
+}
+
+// deliverCommit sends a decided commit to the replicas that have not
+// applied it yet, logging it done once none is left. It returns those
+// that still have not.
+func (rep *Replicator) deliverCommit(ctx context.Context, id string) []string {
+	tp := rep.twoPhase
+	tp.mu.Lock()
+	rec, ok := tp.decided[id]
+	var shares map[string][]string
+	if ok {
+		shares = make(map[string][]string, len(rec.Shares))
+		for nodeID, keys := range rec.Shares {
+			shares[nodeID] = keys
+		}
+	}
+	tp.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		acked []string
+	)
+	for nodeID, keys := range shares {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := PhaseRequest{ID: id, Entries: rec.entriesFor(keys)}
+			switch err := rep.sendPhase(ctx, nodeID, "commit", req); {
+			case errors.Is(err, ErrUnknownNode):
+				logging.FromContext(ctx).Warn("dropping transaction commit for departed peer", "txn", id, "peer", nodeID)
+			case err != nil:
+				logging.FromContext(ctx).Warn("transaction commit not delivered",
+					"txn", id, "peer", nodeID, "error", err)
+				return
+			}
+			mu.Lock()
+			acked = append(acked, nodeID)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	for _, nodeID := range acked {
+		delete(rec.Shares, nodeID)
+	}
+	var pending []string
+	for nodeID := range rec.Shares {
+		pending = append(pending, nodeID)
+	}
+	slices.Sort(pending)
+	if len(pending) == 0 {
+		// Without this line, a restart only re-sends the commit.
+		_ = tp.log(txnRecord{ID: id, Role: roleCoordinator, State: txnDone})
+		delete(tp.decided, id)
+		tp.compact()
+	}
+	return pending
+}
+
+// sendPhase delivers one phase of transaction req.ID to a replica. This
+// node is a replica like any other, without the HTTP round trip.
+func (rep *Replicator) sendPhase(ctx context.Context, nodeID, phase string, req PhaseRequest) error {
+	if nodeID == rep.selfID {
+		switch phase {
+		case "prepare":
+			return rep.PrepareTxn(ctx, req)
+		case "commit":
+			return rep.CommitTxn(req)
+		}
+		rep.AbortTxn(req.ID)
+		return nil
+	}
+	node, ok := rep.membership.GetNode(nodeID)
+	if !ok {
+		return ErrUnknownNode
+	}
+	return rep.guardedCall(ctx, node, http.MethodPost, "/internal/txn/"+phase, req, nil)
+}
+
+// TxnDecision reports the outcome of transaction id, coordinated here,
+// to replica nodeID: with its writes, if committed.
+func (rep *Replicator) TxnDecision(id, nodeID string) TxnDecision {
+	tp := rep.twoPhase
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	switch rec, ok := tp.decided[id]; {
+	case ok:
+		return TxnDecision{State: TxnCommitted, Entries: rec.entriesFor(rec.Shares[nodeID])}
+	case tp.running[id]:
+		return TxnDecision{State: TxnPending}
+	}
+	return TxnDecision{State: TxnAborted}
+}
+
+// ─── Participant ──────────────────────────────────────────────────────────────
+
+// PrepareTxn prepares this node's share of transaction req.ID: it locks
+// req.Keys and logs them, so the locks survive a restart. It gives up on
+// locks held by another transaction after half the peer timeout, so the
+// coordinator aborts before its own call times out. Preparing twice is
+// a no-op.
+func (rep *Replicator) PrepareTxn(ctx context.Context, req PhaseRequest) error {
+	tp := rep.twoPhase
+	tp.mu.Lock()
+	_, dup := tp.prepared[req.ID]
+	tp.mu.Unlock()
+	if dup {
+		return nil
+	}
+
+	lctx, cancel := context.WithTimeout(ctx, rep.Timeouts().Peer/2)
+	defer cancel()
+	unlock, err := rep.txnLocks.lock(lctx, req.Keys)
+	if err != nil {
+		return err
+	}
+
+	rec := txnRecord{ID: req.ID, Role: roleParticipant, State: txnPrepared, Coordinator: req.Coordinator, Keys: req.Keys}
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	if err := tp.log(rec); err != nil {
+		unlock()
+		return err
+	}
+	rec.Time = time.Now().UTC()
+	tp.prepared[req.ID] = &preparedTxn{rec: rec, unlock: unlock}
+	return nil
+}
+
+// CommitTxn applies this node's writes of transaction req.ID and
+// releases its locks. Committing an unknown or finished transaction just
+// applies the writes; clocks make that harmless.
+func (rep *Replicator) CommitTxn(req PhaseRequest) error {
+	if len(req.Entries) > 0 {
+		if _, err := rep.store.ApplyBatch(req.Entries); err != nil {
+			return err
+		}
+	}
+	rep.twoPhase.resolve(req.ID, TxnCommitted)
+	return nil
+}
+
+// AbortTxn releases the locks of transaction id, if it is prepared here.
+func (rep *Replicator) AbortTxn(id string) {
+	rep.twoPhase.resolve(id, TxnAborted)
+}
+
+// resolve ends a prepared transaction with state. If that cannot be
+// logged, a restart takes the locks again and asks the coordinator,
+// which is wasteful but safe: the writes are already applied.
+func (tp *twoPhase) resolve(id, state string) {
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	p, ok := tp.prepared[id]
+	if !ok {
+		return
+	}
+	_ = tp.log(txnRecord{ID: id, Role: roleParticipant, State: state})
+	p.unlock()
+	delete(tp.prepared, id)
+	tp.compact()
+}
+
+// ─── Recovery ─────────────────────────────────────────────────────────────────
+
+// RunTxnRecovery finishes two-phase transactions left open by a crash or
+// a lost message, every interval until ctx is done. It re-sends decided
+// commits, and asks the coordinator of each transaction prepared here for
+// longer than interval how it ended.
+func (rep *Replicator) RunTxnRecovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rep.recoverTxns(ctx, interval)
+	}
+}
+
+func (rep *Replicator) recoverTxns(ctx context.Context, stale time.Duration) {
+	tp := rep.twoPhase
+	tp.mu.Lock()
+	var undelivered []string
+	for id := range tp.decided {
+		if !tp.running[id] { // the coordinator is still delivering it
+			undelivered = append(undelivered, id)
+		}
+	}
+	var inDoubt []txnRecord
+	for _, p := range tp.prepared {
+		if time.Since(p.rec.Time) > stale {
+			inDoubt = append(inDoubt, p.rec)
+		}
+	}
+	tp.mu.Unlock()
+
+	logger := logging.FromContext(ctx)
+	for _, id := range undelivered {
+		if pending := rep.deliverCommit(ctx, id); len(pending) == 0 {
+			logger.Info("transaction commit delivered", "txn", id)
+		}
+	}
+	for _, rec := range inDoubt {
+		d, err := rep.askCoordinator(ctx, rec)
+		if err != nil {
+			logger.Warn("transaction in doubt", "txn", rec.ID, "coordinator", rec.Coordinator, "error", err)
+			continue
+		}
+		switch d.State {
+		case TxnCommitted:
+			if err := rep.CommitTxn(PhaseRequest{ID: rec.ID, Entries: d.Entries}); err != nil {
+				logger.Warn("transaction commit failed", "txn", rec.ID, "error", err)
+				continue
+			}
+			logger.Info("in-doubt transaction committed", "txn", rec.ID)
+		case TxnAborted:
+			rep.AbortTxn(rec.ID)
+			logger.Info("in-doubt transaction aborted", "txn", rec.ID)
+		}
+	}
+}
+
+// askCoordinator fetches the outcome of a transaction prepared here.
+func (rep *Replicator) askCoordinator(ctx context.Context, rec txnRecord) (TxnDecision, error) {
+	if rec.Coordinator == rep.selfID {
+		return rep.TxnDecision(rec.ID, rep.selfID), nil
+	}
+	node, ok := rep.membership.GetNode(rec.Coordinator)
+	if !ok {
+		return TxnDecision{}, ErrUnknownNode
+	}
+	var d TxnDecision
+	path := "/internal/txn/" + url.PathEscape(rec.ID) + "?node=" + url.QueryEscape(rep.selfID)
+	err := rep.callPeer(ctx, node, http.MethodGet, path, nil, &d)
+	return d, err
+}
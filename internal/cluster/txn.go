@@ -0,0 +1,500 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// TRANSACTIONS
+////////////////////////////////////////////////////////////////////////////////
+
+// Two PUTs cannot move a value from one key to another safely: another
+// client can write in between, and a failure can leave one done and the
+// other not. A transaction is a list of checks and a list of writes:
+//
+//	checks: a exists, b == "10", c is still at clock {n1:4}
+//	ops:    put a = "x", delete b
+//
+// The writes happen only if every check holds, all together.
+//
+// This is the single-coordinator form. Every key of a transaction must
+// have the same N replicas, and the transaction runs on the first of
+// them (other nodes forward it there). That node:
+//
+//  1. locks the keys (per-key locks, taken in a fixed order), so
+//     transactions on the same keys run one after the other
+//  2. reads every key at quorum
+//  3. evaluates the checks; if one fails, nothing is written
+//  4. writes all ops locally as ONE WAL entry (see store/txn.go), then
+//     sends them as one batch to the other replicas, which apply it the
+//     same way, and waits for W of them
+//
+// So on every replica the writes appear together or not at all. A
+// replica that misses the batch gets each key as a hint, and catches up
+// key by key.
+//
+// Keys that do not share their replicas have no such node; those
+// transactions run as a two-phase commit instead (see twophase.go).
+//
+// Limits:
+//   - The locks only order transactions. A plain PUT to the same key, on
+//     any coordinator, is not blocked; check clocks to detect one.
+//   - If the primary is down, transactions on its ranges fail until it is
+//     back: failing over would let two nodes hold the same locks.
+//   - As for a plain write, a quorum failure after the local write leaves
+//     the outcome unknown: it may surface once the replicas catch up.
+
+// TxnCheck is one condition of a transaction. Set exactly one of
+// Exists, Value and Clock.
+type TxnCheck struct {
+	Key    string            `json:"key"`
+	Exists *bool             `json:"exists,omitempty"` // key is live (true) or absent/deleted (false)
+	Value  *string           `json:"value,omitempty"`  // key is live and holds exactly this
+	Clock  store.VectorClock `json:"clock,omitempty"`  // key is live at exactly this version (from GET)
+}
+
+// TxnOp is one write of a transaction.
+type TxnOp struct {
+	Op    string `json:"op"` // "put" or "delete"
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// Txn is a transaction. Keys are internal (namespaced) keys.
+type Txn struct {
+	Checks []TxnCheck `json:"checks,omitempty"`
+	Ops    []TxnOp    `json:"ops"`
+}
+
+// TxnResult reports the outcome of a transaction.
+type TxnResult struct {
+	Committed bool                         `json:"committed"`
+	Failed    []int                        `json:"failed_checks,omitempty"` // indexes into Checks
+	Clocks    map[string]store.VectorClock `json:"clocks,omitempty"`        // written key → new version
+}
+
+var (
+	// ErrTxnInvalid wraps the reason a transaction is malformed.
+	ErrTxnInvalid = errors.New("invalid transaction")
+	// ErrTxnOwners means the keys of a transaction are not all on the
+	// same replicas.
+	ErrTxnOwners = errors.New("transaction keys do not share the same replicas")
+)
+
+// maxTxnKeys bounds the number of distinct keys in one transaction.
+const maxTxnKeys = 64
+
+// Keys returns every key t touches, sorted, without duplicates.
+func (t Txn) Keys() []string {
+	var keys []string
+	for _, c := range t.Checks {
+		keys = append(keys, c.Key)
+	}
+	for _, op := range t.Ops {
+		keys = append(keys, op.Key)
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// Validate checks the shape of t, not its keys' owners.
+func (t Txn) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrTxnInvalid, fmt.Sprintf(format, args...))
+	}
+	if len(t.Ops) == 0 {
+		return invalid("no ops")
+	}
+	if n := len(t.Keys()); n > maxTxnKeys {
+		return invalid("%d keys, at most %d", n, maxTxnKeys)
+	}
+	for i, c := range t.Checks {
+		set := 0
+		for _, on := range []bool{c.Exists != nil, c.Value != nil, c.Clock != nil} {
+			if on {
+				set++
+			}
+		}
+		if set != 1 {
+			return invalid("check %d: set exactly one of exists, value and clock", i)
+		}
+	}
+	written := make(map[string]bool)
+	for i, op := range t.Ops {
+		if op.Op != "put" && op.Op != "delete" {
+			return invalid("op %d: unknown op %q (put or delete)", i, op.Op)
+		}
+		if written[op.Key] {
+			return invalid("op %d: key written twice", i)
+		}
+		written[op.Key] = true
+	}
+	return nil
+}
+
+// TxnCoordinator returns the node that runs t: the primary replica of
+// its first key (in sorted order). All its keys must have the same
+// replicas, in any order.
+func (rep *Replicator) TxnCoordinator(t Txn) (*Node, error) {
+	n := rep.Quorum().N
+	keys := t.Keys()
+	var primary *Node
+	var want []string
+	for _, key := range keys {
+		nodes := rep.membership.ReplicaNodes(key, n)
+		if len(nodes) == 0 {
+			return nil, errors.New("no replicas available")
+		}
+		ids := nodeIDs(nodes)
+		if primary == nil {
+			primary, want = nodes[0], ids
+			continue
+		}
+		if !slices.Equal(ids, want) {
+			return nil, fmt.Errorf("%w: %s is on %v, %s on %v", ErrTxnOwners, keys[0], want, key, ids)
+		}
+	}
+	return primary, nil
+}
+
+// KeyCoordinator returns the node that runs read-modify-writes of key:
+// its primary replica.
+func (rep *Replicator) KeyCoordinator(key string) (*Node, error) {
+	return rep.TxnCoordinator(Txn{Ops: []TxnOp{{Op: "put", Key: key}}})
+}
+
+// nodeIDs returns the sorted IDs of nodes.
+func nodeIDs(nodes []*Node) []string {
+	ids := make([]string, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// ExecuteTxn runs t on this node, which should be its TxnCoordinator.
+// A failed check is not an error: the result says which ones failed.
+func (rep *Replicator) ExecuteTxn(ctx context.Context, t Txn) (TxnResult, error) {
+	if err := t.Validate(); err != nil {
+		return TxnResult{}, err
+	}
+	keys := t.Keys()
+
+	// 1. Lock.
+	unlock, err := rep.txnLocks.lock(ctx, keys)
+	if err != nil {
+		return TxnResult{}, err
+	}
+	defer unlock()
+
+	// 2. Read.
+	current, err := rep.readAll(ctx, keys)
+	if err != nil {
+		return TxnResult{}, err
+	}
+
+	// 3. Check.
+	failed, err := t.failedChecks(current)
+	if err != nil || len(failed) > 0 {
+		return TxnResult{Failed: failed}, err
+	}
+
+	// 4. Write.
+	entries, err := rep.commitLocal(ctx, t.writes(current))
+	if err != nil {
+		return TxnResult{}, err
+	}
+	return committed(entries), nil
+}
+
+// UpdateKey is a read-modify-write of one key, run as a transaction on
+// this node, which should be the key's TxnCoordinator. Under the key's
+// lock it reads the key at quorum and calls change with its value (nil
+// if absent); what change returns is written. If change fails, nothing
+// is, and its error is returned.
+func (rep *Replicator) UpdateKey(ctx context.Context, key string, change func(current *store.Value) (string, error)) (store.Value, error) {
+	unlock, err := rep.txnLocks.lock(ctx, []string{key})
+	if err != nil {
+		return store.Value{}, err
+	}
+	defer unlock()
+
+	current, err := rep.CoordinateRead(ctx, key)
+	if err != nil {
+		return store.Value{}, err
+	}
+	data, err := change(current)
+	if err != nil {
+		return store.Value{}, err
+	}
+	w := store.TxnWrite{Key: key, Data: data}
+	if current != nil {
+		w.Clock = current.Clock
+	}
+	entries, err := rep.commitLocal(ctx, []store.TxnWrite{w})
+	if err != nil {
+		return store.Value{}, err
+	}
+	return entries[0].Value, nil
+}
+
+// ErrPreconditionFailed means the condition of a WriteIf did not hold.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// WriteIf writes w (a put or a delete) only if cond holds for the key's
+// current value (nil if absent or deleted). Like UpdateKey, it runs under
+// the key's lock on its TxnCoordinator, so two conditional writes of one
+// key cannot both pass on the same version.
+func (rep *Replicator) WriteIf(ctx context.Context, w store.TxnWrite, cond func(current *store.Value) bool) (store.Value, error) {
+	unlock, err := rep.txnLocks.lock(ctx, []string{w.Key})
+	if err != nil {
+		return store.Value{}, err
+	}
+	defer unlock()
+
+	current, err := rep.CoordinateRead(ctx, w.Key)
+	if err != nil {
+		return store.Value{}, err
+	}
+	if !cond(current) {
+		return store.Value{}, ErrPreconditionFailed
+	}
+	if current != nil {
+		w.Clock = current.Clock
+	}
+	entries, err := rep.commitLocal(ctx, []store.TxnWrite{w})
+	if err != nil {
+		return store.Value{}, err
+	}
+	return entries[0].Value, nil
+}
+
+// commitLocal writes a transaction whose keys' replicas include this
+// node: locally as one batch, then to the other replicas, waiting for W.
+func (rep *Replicator) commitLocal(ctx context.Context, writes []store.TxnWrite) ([]store.BatchEntry, error) {
+	entries, err := rep.store.ApplyTxn(ctx, writes)
+	if err != nil {
+		return nil, err
+	}
+	rep.replicatePending(ctx, entries)
+	err = rep.awaitAcks(ctx, writes[0].Key, func(ctx context.Context, p *Node) error {
+		return rep.sendBatch(ctx, p, entries)
+	})
+	if err != nil {
+		return nil, err
+	}
+	rep.publishCommitted(ctx, entries...)
+	return entries, nil
+}
+
+// failedChecks returns the indexes of the checks that do not hold
+// against current.
+func (t Txn) failedChecks(current map[string]*store.Value) ([]int, error) {
+	var failed []int
+	for i, c := range t.Checks {
+		ok, err := c.holds(current[c.Key])
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			failed = append(failed, i)
+		}
+	}
+	return failed, nil
+}
+
+// writes turns the ops into store writes descending from current.
+func (t Txn) writes(current map[string]*store.Value) []store.TxnWrite {
+	writes := make([]store.TxnWrite, len(t.Ops))
+	for i, op := range t.Ops {
+		writes[i] = store.TxnWrite{Key: op.Key, Data: op.Value, Delete: op.Op == "delete"}
+		if v := current[op.Key]; v != nil {
+			writes[i].Clock = v.Clock
+		}
+	}
+	return writes
+}
+
+// replicatePending sends a transaction's writes to the nodes joining
+// their ranges, which are not part of the quorum.
+func (rep *Replicator) replicatePending(ctx context.Context, entries []store.BatchEntry) {
+	for _, e := range entries {
+		for _, p := range rep.pendingPeers(e.Key) {
+			go rep.sendReplicateRequest(context.WithoutCancel(ctx), p, e.Key, e.Value)
+		}
+	}
+}
+
+// committed is the result of a transaction that wrote entries.
+func committed(entries []store.BatchEntry) TxnResult {
+	res := TxnResult{Committed: true, Clocks: make(map[string]store.VectorClock, len(entries))}
+	for _, e := range entries {
+		res.Clocks[e.Key] = e.Value.Clock
+	}
+	return res
+}
+
+// holds evaluates c against the key's current value (nil = absent).
+func (c TxnCheck) holds(v *store.Value) (bool, error) {
+	switch {
+	case c.Exists != nil:
+		return (v != nil) == *c.Exists, nil
+	case c.Value != nil:
+		if v == nil {
+			return false, nil
+		}
+		decoded, err := v.Decode()
+		if err != nil {
+			return false, err
+		}
+		return decoded.Data == *c.Value, nil
+	}
+	return v != nil && v.Clock.Compare(c.Clock) == store.Equal, nil
+}
+
+// readAll reads every key at quorum, in parallel. Absent and deleted
+// keys map to nil.
+func (rep *Replicator) readAll(ctx context.Context, keys []string) (map[string]*store.Value, error) {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		out  = make(map[string]*store.Value, len(keys))
+		errs []error
+	)
+	for _, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := rep.CoordinateRead(ctx, key)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("read %s: %w", key, err))
+				return
+			}
+			out[key] = v
+		}()
+	}
+	wg.Wait()
+	return out, errors.Join(errs...)
+}
+
+// BatchRequest is the body of POST /internal/txn.
+type BatchRequest struct {
+	Entries []store.BatchEntry `json:"entries"`
+}
+
+// sendBatch replicates a transaction's writes to one peer, retrying
+// like sendReplicateRequest. If the peer cannot take them, every entry
+// is hinted.
+func (rep *Replicator) sendBatch(ctx context.Context, peer *Node, entries []store.BatchEntry) error {
+	hintAll := func() {
+		for _, e := range entries {
+			rep.hint(peer, e.Key, e.Value)
+		}
+	}
+	attempts := rep.Timeouts().Attempts
+	for attempt := range attempts {
+		select {
+		case <-time.After(rep.backoff(attempt)):
+		case <-ctx.Done():
+		}
+
+		err := rep.postBatch(ctx, peer, entries)
+		if err == nil {
+			rep.stats.success(peer.ID)
+			return nil
+		}
+		switch {
+		case errors.Is(err, ErrStaleRing):
+			rep.stats.failure(peer.ID, err)
+			return fmt.Errorf("replicate batch to %s: %w", peer.ID, err)
+		case errors.Is(err, errBreakerOpen) || ctx.Err() != nil || attempt == attempts-1:
+			logging.FromContext(ctx).Warn("batch replication failed",
+				"peer", peer.ID, "keys", len(entries), "attempts", attempt+1, "error", err)
+			rep.stats.failure(peer.ID, err)
+			hintAll()
+			return fmt.Errorf("replicate batch to %s: %w", peer.ID, err)
+		}
+		rep.stats.retry(peer.ID)
+	}
+	return nil
+}
+
+func (rep *Replicator) postBatch(ctx context.Context, peer *Node, entries []store.BatchEntry) error {
+	return rep.guardedCall(ctx, peer, http.MethodPost, "/internal/txn", BatchRequest{Entries: entries}, nil)
+}
+
+// guardedCall is callPeer behind the peer's circuit breaker and
+// concurrency limit, as for replication.
+func (rep *Replicator) guardedCall(ctx context.Context, peer *Node, method, path string, body, out any) (err error) {
+	done, err := rep.guard(ctx, peer.ID)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	release, err := rep.bp.peer(ctx, peer.ID)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return rep.callPeer(ctx, peer, method, path, body, out)
+}
+
+// ─── Key locks ────────────────────────────────────────────────────────────────
+
+// keyLocks serializes transactions on the same keys. Keys hash to one
+// of txnStripes locks; a transaction takes its stripes in index order,
+// so two transactions never wait on each other in a cycle. Unrelated
+// keys may share a stripe and then wait for each other — briefly.
+type keyLocks struct {
+	once    sync.Once
+	stripes []chan struct{} // capacity 1: held while full
+}
+
+const txnStripes = 1024
+
+// lock takes the stripes of keys, waiting at most until ctx is done.
+func (l *keyLocks) lock(ctx context.Context, keys []string) (unlock func(), err error) {
+	l.once.Do(func() {
+		l.stripes = make([]chan struct{}, txnStripes)
+		for i := range l.stripes {
+			l.stripes[i] = make(chan struct{}, 1)
+		}
+	})
+
+	idx := make([]int, 0, len(keys))
+	for _, k := range keys {
+		h := fnv.New32a()
+		h.Write([]byte(k))
+		idx = append(idx, int(h.Sum32()%txnStripes))
+	}
+	slices.Sort(idx)
+	idx = slices.Compact(idx)
+
+	release := func(n int) {
+		for _, i := range idx[:n] {
+			<-l.stripes[i]
+		}
+	}
+	for n, i := range idx {
+		select {
+		case l.stripes[i] <- struct{}{}:
+		case <-ctx.Done():
+			release(n)
+			return nil, fmt.Errorf("waiting for transaction locks: %w", ctx.Err())
+		}
+	}
+	return func() { release(len(idx)) }, nil
+}
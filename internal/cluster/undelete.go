@@ -0,0 +1,80 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"errors"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// UNDELETE
+////////////////////////////////////////////////////////////////////////////////
+
+// A delete leaves a tombstone, and a namespace with Versions > 0 keeps
+// the value it replaced in the key's history (see versions.go). Undelete
+// puts that value back: the newest live version any replica still holds
+// is written again, with a clock descending from the tombstone, so it
+// wins over the delete everywhere instead of being dropped as old.
+//
+// Like a counter increment, it is a read-modify-write on the key's
+// primary, under the key's lock: two undeletes, or an undelete racing a
+// conditional write, cannot both act on the same tombstone. Whether the
+// version is still there depends on the namespace's Versions and on how
+// many writes replaced it since; history is in memory, so a restart
+// forgets versions older than the last snapshot (WAL compaction keeps
+// them).
+
+var (
+	// ErrNotDeleted means Undelete found the key live.
+	ErrNotDeleted = errors.New("key is not deleted")
+	// ErrNoLiveVersion means no replica retains a version of the key
+	// from before its delete.
+	ErrNoLiveVersion = errors.New("no earlier version retained")
+)
+
+// Undelete restores the newest live version of deleted key and returns
+// the new value and the version it was restored from. Must run on
+// KeyCoordinator(key).
+func (rep *Replicator) Undelete(ctx context.Context, key string) (restored, from store.Value, err error) {
+	unlock, err := rep.txnLocks.lock(ctx, []string{key})
+	if err != nil {
+		return store.Value{}, store.Value{}, err
+	}
+	defer unlock()
+
+	current, err := rep.CoordinateRead(ctx, key)
+	if err != nil {
+		return store.Value{}, store.Value{}, err
+	}
+	if current != nil {
+		return store.Value{}, store.Value{}, ErrNotDeleted
+	}
+
+	// Newest first; the first live one is what the delete removed, or
+	// what was live before a run of deletes. The new clock covers every
+	// version seen, tombstones included, so no replica keeps the delete.
+	var (
+		found bool
+		clock = make(store.VectorClock)
+	)
+	for _, kv := range rep.KeyVersions(ctx, key).Versions {
+		clock = clock.Merge(kv.Clock)
+		if !kv.Tombstone && !found {
+			from, found = kv.Value, true
+		}
+	}
+	if !found {
+		return store.Value{}, store.Value{}, ErrNoLiveVersion
+	}
+	decoded, err := from.Decode()
+	if err != nil {
+		return store.Value{}, store.Value{}, err
+	}
+
+	w := store.TxnWrite{Key: key, Data: decoded.Data, ContentType: decoded.ContentType, Clock: clock}
+	entries, err := rep.commitLocal(ctx, []store.TxnWrite{w})
+	if err != nil {
+		return store.Value{}, store.Value{}, err
+	}
+	return entries[0].Value, from, nil
+}
@@ -0,0 +1,125 @@
+package cluster
+
+import (
+	"context"
+	"distributed-kvstore/internal/store"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// VERSION HISTORY
+////////////////////////////////////////////////////////////////////////////////
+
+// Each replica keeps the versions of a key it saw replaced (namespaces
+// with Versions > 0, see store/versions.go). The replicas do not see the
+// same ones: a replica that was down missed a few, read repair may have
+// jumped another over an intermediate version. So the history of a key is
+// the union of every replica's, one entry per version, with the replicas
+// that hold it.
+
+// KeyVersion is one version of a key, as stored.
+type KeyVersion struct {
+	store.Value
+	Current  bool     `json:"current,omitempty"` // the version a read returns now
+	Replicas []string `json:"replicas"`          // replicas that have it (current or in history)
+}
+
+// KeyVersions is the history of one key, newest first.
+type KeyVersions struct {
+	Key         string       `json:"key"`
+	Versions    []KeyVersion `json:"versions"`
+	Unreachable []string     `json:"unreachable,omitempty"`
+}
+
+// KeyVersions collects key's versions from every replica.
+func (rep *Replicator) KeyVersions(ctx context.Context, key string) KeyVersions {
+	replicas := rep.membership.ReplicaNodes(key, rep.Quorum().N)
+	var (
+		wg          sync.WaitGroup
+		mu          sync.Mutex
+		byReplica   = make(map[string][]store.Value, len(replicas))
+		unreachable []string
+	)
+	for _, n := range replicas {
+		wg.Go(func() {
+			var vs []store.Value
+			var err error
+			if n.ID == rep.selfID {
+				vs = rep.store.Versions(key)
+			} else {
+				err = rep.callPeer(ctx, n, http.MethodGet, "/internal/versions/"+keyPath(key), nil, &vs)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				unreachable = append(unreachable, n.ID)
+				return
+			}
+			byReplica[n.ID] = vs
+		})
+	}
+	wg.Wait()
+
+	out := KeyVersions{Key: key, Versions: rep.mergeVersions(key, byReplica)}
+	sort.Strings(unreachable)
+	out.Unreachable = unreachable
+	return out
+}
+
+// mergeVersions unions the replicas' histories of key: one entry per clock,
+// newest first, with the reconciled winner of the current values marked.
+func (rep *Replicator) mergeVersions(key string, byReplica map[string][]store.Value) []KeyVersion {
+	ids := make([]string, 0, len(byReplica))
+	for id := range byReplica {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var (
+		out     []KeyVersion
+		current []ReplicaResponse
+	)
+	for _, id := range ids {
+		for i, v := range byReplica[id] {
+			if i == 0 {
+				current = append(current, ReplicaResponse{NodeID: id, Value: &v})
+			}
+			j := indexVersion(out, v)
+			if j < 0 {
+				out = append(out, KeyVersion{Value: v})
+				j = len(out) - 1
+			}
+			out[j].Replicas = append(out[j].Replicas, id)
+		}
+	}
+	if winner, _ := rep.reconcile(key, current); winner != nil {
+		if j := indexVersion(out, *winner); j >= 0 {
+			out[j].Current = true
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return store.CompareTime(out[i].Value, out[j].Value) > 0 })
+	return out
+}
+
+// indexVersion returns the index of v's version in vs, or -1.
+func indexVersion(vs []KeyVersion, v store.Value) int {
+	for i := range vs {
+		if vs[i].Clock.Compare(v.Clock) == store.Equal && vs[i].UpdatedAt.Equal(v.UpdatedAt) {
+			return i
+		}
+	}
+	return -1
+}
+
+// KeyVersion returns the version of key with clock, from whichever
+// replica still has it; ok is false if none does.
+func (rep *Replicator) KeyVersion(ctx context.Context, key string, clock store.VectorClock) (v store.Value, ok bool) {
+	for _, kv := range rep.KeyVersions(ctx, key).Versions {
+		if kv.Clock.Compare(clock) == store.Equal {
+			return kv.Value, true
+		}
+	}
+	return store.Value{}, false
+}
@@ -0,0 +1,256 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// WATCH
+////////////////////////////////////////////////////////////////////////////////
+
+// A watch tails the changes of a namespace (optionally under a prefix)
+// across the cluster.
+//
+// Each node only sees the writes it applies itself, i.e. to the keys it
+// replicates. So the node serving a watch subscribes to its own store
+// and to every peer (GET /internal/watch/:namespace), and merges the
+// streams. A write reaches up to N replicas and so arrives up to N
+// times; by default only the first copy is passed on (a copy whose clock
+// does not add to what was already sent for the key is dropped). With
+// allReplicas every copy is passed on, with the node that applied it,
+// which shows replication at work.
+//
+// Limits:
+//   - A watch starts now: it does not replay history, and what happens
+//     while a client is reconnecting is not sent later.
+//   - A peer that is down while watched is retried in the background;
+//     its changes are missed in the meantime (their other replicas still
+//     report them).
+//   - Changes of different keys may arrive out of order across nodes.
+//
+// Keys a node evicts to stay under --max-memory come as "evict" events
+// from that node. Eviction is per node (the other replicas keep the
+// key), so evict events are never dropped as copies: one per node that
+// evicted the key.
+
+// WatchEvent is one change seen by a watch.
+type WatchEvent struct {
+	Op          string            `json:"op"`  // "put", "delete" or "evict"
+	Key         string            `json:"key"` // without the namespace
+	Value       string            `json:"value,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	Clock       store.VectorClock `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Node        string            `json:"node"` // the replica that applied it
+}
+
+// ErrWatchLagged ends a watch whose reader fell behind the writes.
+var ErrWatchLagged = errors.New("watch fell behind the writes; changes were dropped")
+
+const (
+	// maxWatchKeys bounds the clocks kept to drop duplicate copies. Past
+	// it they are forgotten, and a few copies may get through twice.
+	maxWatchKeys = 100_000
+	// watchPeerRetry is the wait before a peer stream is reopened; the
+	// membership is checked for new peers as often.
+	watchPeerRetry = 2 * time.Second
+)
+
+// WatchLocal calls fn for every change this node applies to the keys of
+// namespace under prefix, until ctx is done, fn fails or the watch lags
+// behind (ErrWatchLagged).
+func (rep *Replicator) WatchLocal(ctx context.Context, namespace, prefix string, fn func(WatchEvent) error) error {
+	w := rep.store.Watch(store.NamespacedKey(namespace, prefix))
+	defer w.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ch, ok := <-w.C:
+			if !ok {
+				return ErrWatchLagged
+			}
+			ev, err := rep.watchEvent(ch)
+			if err != nil {
+				return err
+			}
+			if err := fn(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (rep *Replicator) watchEvent(ch store.Change) (WatchEvent, error) {
+	_, key := store.SplitKey(ch.Key)
+	ev := WatchEvent{Op: "put", Key: key, Clock: ch.Value.Clock, UpdatedAt: ch.Value.UpdatedAt, Node: rep.selfID}
+	if ch.Evicted {
+		ev.Op = "evict"
+		return ev, nil
+	}
+	if ch.Value.Tombstone {
+		ev.Op = "delete"
+		return ev, nil
+	}
+	v, err := ch.Value.Decode()
+	if err != nil {
+		return WatchEvent{}, fmt.Errorf("watch %s: %w", key, err)
+	}
+	ev.Value, ev.ContentType = v.Data, v.ContentType
+	return ev, nil
+}
+
+// Watch calls fn for the changes of namespace under prefix anywhere in
+// the cluster, until ctx is done, fn fails or this node's own stream
+// lags behind.
+func (rep *Replicator) Watch(ctx context.Context, namespace, prefix string, allReplicas bool, fn func(WatchEvent) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan WatchEvent, 256)
+	send := func(ev WatchEvent) error {
+		select {
+		case events <- ev:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	localErr := make(chan error, 1)
+	go func() { localErr <- rep.WatchLocal(ctx, namespace, prefix, send) }()
+	go rep.watchPeers(ctx, namespace, prefix, send)
+
+	seen := make(map[string]store.VectorClock)
+	for {
+		var ev WatchEvent
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-localErr:
+			return err
+		case ev = <-events:
+		}
+		if !allReplicas && ev.Op != "evict" {
+			last, ok := seen[ev.Key]
+			if ok {
+				if rel := ev.Clock.Compare(last); rel == store.Before || rel == store.Equal {
+					continue // a copy of what was sent already
+				}
+			}
+			if len(seen) >= maxWatchKeys {
+				clear(seen)
+			}
+			seen[ev.Key] = ev.Clock.Merge(last)
+		}
+		if err := fn(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// watchPeers streams the changes of every peer to send, picking up
+// nodes that join, until ctx is done.
+func (rep *Replicator) watchPeers(ctx context.Context, namespace, prefix string, send func(WatchEvent) error) {
+	var (
+		mu      sync.Mutex
+		watched = make(map[string]bool)
+	)
+	ticker := time.NewTicker(watchPeerRetry)
+	defer ticker.Stop()
+	for {
+		for _, n := range rep.membership.All() {
+			mu.Lock()
+			start := n.ID != rep.selfID && !watched[n.ID]
+			if start {
+				watched[n.ID] = true
+			}
+			mu.Unlock()
+			if !start {
+				continue
+			}
+			go func(id string) {
+				rep.watchPeer(ctx, id, namespace, prefix, send)
+				mu.Lock()
+				delete(watched, id)
+				mu.Unlock()
+			}(n.ID)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchPeer streams the changes of peer id, reopening the stream when it
+// drops, until ctx is done or the peer leaves the cluster.
+func (rep *Replicator) watchPeer(ctx context.Context, id, namespace, prefix string, send func(WatchEvent) error) {
+	path := "/internal/watch/" + url.PathEscape(namespace) + "?" + url.Values{"prefix": {prefix}}.Encode()
+	down := false // logged already: stay quiet until it comes back
+	for {
+		peer, ok := rep.membership.GetNode(id)
+		if !ok {
+			return
+		}
+		opened, err := rep.readPeerWatch(ctx, peer, path, send)
+		if ctx.Err() != nil {
+			return
+		}
+		if opened || !down {
+			logging.FromContext(ctx).Warn("watch: peer stream dropped", "peer", id, "error", err)
+		}
+		down = !opened
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchPeerRetry):
+		}
+	}
+}
+
+// readPeerWatch reads one NDJSON watch stream of peer. opened tells
+// whether the peer answered at all.
+func (rep *Replicator) readPeerWatch(ctx context.Context, peer *Node, path string, send func(WatchEvent) error) (opened bool, err error) {
+	body, err := rep.streamPeer(ctx, peer, path)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 64*1024), 64<<20)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue // heartbeat
+		}
+		var msg struct {
+			WatchEvent
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return true, err
+		}
+		if msg.Error != "" {
+			return true, errors.New(msg.Error)
+		}
+		if err := send(msg.WatchEvent); err != nil {
+			return true, err
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return true, err
+	}
+	return true, errors.New("stream ended")
+}
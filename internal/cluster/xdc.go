@@ -0,0 +1,468 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////
+// CROSS-CLUSTER REPLICATION
+////////////////////////////////////////////////////////////////////////////////
+
+// A bridge ships this cluster's writes to another cluster, asynchronously,
+// for disaster recovery or to serve reads (and writes) in another region.
+// Every node runs one: it tails its own change feed (store/cdc.go) and
+// POSTs batches of it to the remote cluster's /internal/xdc.
+//
+//	local write ─► WAL ─► change feed ─► bridge ─► POST /internal/xdc ─► remote coordinator ─► remote quorum
+//
+// Each replica of a key logs its own copy of a write, so a node ships
+// only the keys it coordinates (their first live replica). When that
+// node is down the next replica coordinates, and ships, in its place;
+// a write shipped twice while coordinators change is harmless.
+//
+// On the remote side the receiving node hands every write to its own
+// coordinator for the key, which applies it like a replicated copy
+// (ApplyRemote: vector clocks decide, concurrent writes go to the later
+// HLC) and then replicates it to W of its replicas. A write the
+// remote already has, including one it shipped to us itself, compares
+// Equal and is dropped, so two clusters can each bridge to the other.
+// Vector clocks only tell the clusters' writes apart if node IDs are
+// unique across both.
+//
+// Each node keeps the number of the last change it shipped in xdc.pos,
+// so a restart resumes where it stopped. Changes a snapshot deleted
+// before they were shipped (see --cdc-retention) are gone: the bridge
+// logs it, counts a gap and carries on from the oldest change retained;
+// anti-entropy does not cross clusters, so repair the remote from a
+// backup. A new bridge likewise starts at the oldest change retained.
+
+const (
+	xdcBatch      = 100                    // changes read per batch
+	xdcBatchBytes = 2 << 20                // and value bytes, well under the remote's body limit
+	xdcLinger     = 100 * time.Millisecond // longest wait to fill a batch
+	xdcTimeout    = 10 * time.Second       // per POST to the remote cluster
+)
+
+// RemoteClusterConfig is a bridge to another cluster.
+type RemoteClusterConfig struct {
+	Endpoints  []string // base URLs of the remote cluster's nodes
+	Token      string   // the remote cluster's cluster token, if it has one
+	Namespaces []string // namespaces shipped; none = all
+}
+
+// ParseRemoteCluster parses --remote-cluster ("url,url,...") and
+// --remote-namespaces ("ns,ns,..."). It returns nil without endpoints.
+func ParseRemoteCluster(endpoints, token, namespaces string) (*RemoteClusterConfig, error) {
+	if strings.TrimSpace(endpoints) == "" {
+		return nil, nil
+	}
+	cfg := &RemoteClusterConfig{Token: token}
+	for ep := range strings.SplitSeq(endpoints, ",") {
+		ep = strings.TrimRight(strings.TrimSpace(ep), "/")
+		u, err := url.Parse(ep)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("remote cluster endpoint %q: want http(s)://host:port", ep)
+		}
+		cfg.Endpoints = append(cfg.Endpoints, ep)
+	}
+	for ns := range strings.SplitSeq(namespaces, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" {
+			continue
+		}
+		if !store.ValidNamespace(ns) {
+			return nil, fmt.Errorf("remote namespace %q: %w", ns, store.ErrInvalidNamespace)
+		}
+		cfg.Namespaces = append(cfg.Namespaces, ns)
+	}
+	return cfg, nil
+}
+
+// XDCRequest is the body of POST /internal/xdc.
+type XDCRequest struct {
+	Source    string             `json:"source"` // the shipping node
+	Entries   []store.BatchEntry `json:"entries"`
+	Forwarded bool               `json:"forwarded,omitempty"` // handed on by a node of this cluster: apply here
+}
+
+// XDCResponse answers POST /internal/xdc.
+type XDCResponse struct {
+	Applied int `json:"applied"` // writes that were new to this cluster
+}
+
+// RemoteClusterStats is the bridge's progress on one node.
+type RemoteClusterStats struct {
+	Endpoints  []string `json:"endpoints"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Position   uint64   `json:"position"` // last change shipped or skipped
+	Lag        uint64   `json:"lag"`      // changes synced here since
+	Shipped    uint64   `json:"shipped"`
+	Failures   uint64   `json:"failures"`
+	Gaps       uint64   `json:"gaps"` // times changes were gone before they were shipped
+	LastError  string   `json:"last_error,omitempty"`
+}
+
+// xdcBridge is this node's bridge.
+type xdcBridge struct {
+	cfg    RemoteClusterConfig
+	path   string // position file
+	client *http.Client
+	next   int // endpoint tried first
+
+	pos                     atomic.Uint64
+	shipped, failures, gaps atomic.Uint64
+
+	mu      sync.Mutex
+	lastErr string
+}
+
+// OpenRemoteCluster sets up the bridge to cfg (nil = none), resuming
+// after the change number saved in path. Call RunRemoteCluster to start
+// shipping. It returns the saved position.
+func (rep *Replicator) OpenRemoteCluster(path string, cfg *RemoteClusterConfig) (uint64, error) {
+	if cfg == nil {
+		return 0, nil
+	}
+	b := &xdcBridge{cfg: *cfg, path: path, client: &http.Client{Timeout: xdcTimeout}}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return 0, err
+	default:
+		pos, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		b.pos.Store(pos)
+	}
+	rep.xdc = b
+	return b.pos.Load(), nil
+}
+
+// RemoteClusterStats returns the bridge's progress, or nil without one.
+func (rep *Replicator) RemoteClusterStats() *RemoteClusterStats {
+	b := rep.xdc
+	if b == nil {
+		return nil
+	}
+	pos := b.pos.Load()
+	b.mu.Lock()
+	lastErr := b.lastErr
+	b.mu.Unlock()
+	return &RemoteClusterStats{
+		Endpoints: b.cfg.Endpoints, Namespaces: b.cfg.Namespaces,
+		Position: pos, Lag: rep.store.ChangeSeq() - min(pos, rep.store.ChangeSeq()),
+		Shipped: b.shipped.Load(), Failures: b.failures.Load(), Gaps: b.gaps.Load(),
+		LastError: lastErr,
+	}
+}
+
+// XDCApplied returns how many writes shipped from other clusters this
+// node applied as their coordinator.
+func (rep *Replicator) XDCApplied() uint64 { return rep.xdcApplied.Load() }
+
+// ─── Shipping ─────────────────────────────────────────────────────────────────
+
+// RunRemoteCluster ships changes to the remote cluster until ctx is done.
+func (rep *Replicator) RunRemoteCluster(ctx context.Context) {
+	b := rep.xdc
+	if b == nil {
+		return
+	}
+	log := logging.FromContext(ctx).With("remote_cluster", b.cfg.Endpoints[0])
+	for {
+		err := b.tail(ctx, rep)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, store.ErrChangesGone) {
+			b.gaps.Add(1)
+			oldest := rep.store.OldestChange()
+			log.Error("changes were deleted before they were shipped; the remote cluster misses them",
+				"from", b.pos.Load()+1, "resuming_at", oldest, "error", err)
+			if oldest > 0 {
+				if err := b.save(oldest - 1); err != nil {
+					log.Error("save remote cluster position", "error", err)
+				}
+			}
+			continue
+		}
+		log.Warn("remote cluster feed stopped, restarting", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sinkRetry):
+		}
+	}
+}
+
+// tail reads the change feed after the saved position and ships it in
+// batches, saving the position after each.
+func (b *xdcBridge) tail(ctx context.Context, rep *Replicator) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := make(chan store.LoggedChange, xdcBatch)
+	errc := make(chan error, 1)
+	go func() {
+		from := b.pos.Load()
+		if from > 0 {
+			from++ // else: the oldest retained
+		}
+		errc <- rep.store.Changes(ctx, from, func(ch store.LoggedChange) error {
+			select {
+			case changes <- ch:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	for {
+		var first store.LoggedChange
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			return err
+		case first = <-changes:
+		}
+		batch, last := b.collect(rep, first, changes)
+		if len(batch) > 0 {
+			if err := b.ship(ctx, rep, batch); err != nil {
+				return err
+			}
+		}
+		if err := b.save(last); err != nil {
+			return err
+		}
+	}
+}
+
+// collect reads up to xdcBatch changes (or xdcBatchBytes of them),
+// starting with first, waiting at most xdcLinger for more. It returns the ones to ship and the number of
+// the last one read.
+func (b *xdcBridge) collect(rep *Replicator, first store.LoggedChange, changes <-chan store.LoggedChange) ([]store.BatchEntry, uint64) {
+	var batch []store.BatchEntry
+	linger := time.NewTimer(xdcLinger)
+	defer linger.Stop()
+	ch := first
+	size := 0
+	for n := 1; ; n++ {
+		if b.wanted(rep, ch.Change) {
+			batch = append(batch, store.BatchEntry{Key: ch.Key, Value: ch.Value})
+			size += len(ch.Key) + len(ch.Value.Data) + len(ch.Value.Compressed)
+		}
+		if n == xdcBatch || size >= xdcBatchBytes {
+			return batch, ch.Seq
+		}
+		select {
+		case next := <-changes:
+			ch = next
+		case <-linger.C:
+			return batch, ch.Seq
+		}
+	}
+}
+
+// wanted reports whether ch is this node's to ship.
+func (b *xdcBridge) wanted(rep *Replicator, ch store.Change) bool {
+	if ch.Evicted {
+		return false // memory pressure here says nothing about the remote's
+	}
+	ns, _ := store.SplitKey(ch.Key)
+	if ns == store.LocksNamespace || (len(b.cfg.Namespaces) > 0 && !slices.Contains(b.cfg.Namespaces, ns)) {
+		return false
+	}
+	coord, err := rep.KeyCoordinator(ch.Key)
+	return err != nil || coord.ID == rep.selfID // unsure: ship, duplicates are harmless
+}
+
+// ship POSTs entries to the remote cluster until one of its nodes takes
+// them, backing off between rounds. Only ctx ends it early.
+func (b *xdcBridge) ship(ctx context.Context, rep *Replicator, entries []store.BatchEntry) error {
+	body, err := json.Marshal(XDCRequest{Source: rep.selfID, Entries: entries})
+	if err != nil {
+		return err
+	}
+	log := logging.FromContext(ctx)
+	wait := sinkRetry
+	failing := false
+	for {
+		err := b.post(ctx, body)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		b.failures.Add(1)
+		b.mu.Lock()
+		b.lastErr = err.Error()
+		b.mu.Unlock()
+		if !failing {
+			log.Warn("remote cluster unreachable, retrying", "endpoints", b.cfg.Endpoints, "error", err)
+			failing = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, sinkMaxBackoff)
+	}
+	if failing {
+		log.Info("remote cluster reachable again")
+	}
+	b.shipped.Add(uint64(len(entries)))
+	return nil
+}
+
+// post sends body to each endpoint in turn, starting with the last one
+// that worked.
+func (b *xdcBridge) post(ctx context.Context, body []byte) error {
+	var errs []error
+	for i := range b.cfg.Endpoints {
+		idx := (b.next + i) % len(b.cfg.Endpoints)
+		ep := b.cfg.Endpoints[idx]
+		err := b.postTo(ctx, ep, body)
+		if err == nil {
+			b.next = idx
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", ep, err))
+	}
+	return errors.Join(errs...)
+}
+
+func (b *xdcBridge) postTo(ctx context.Context, endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/internal/xdc", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.cfg.Token)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// save records pos as the last change handled (tmp + rename).
+func (b *xdcBridge) save(pos uint64) error {
+	if pos == b.pos.Load() {
+		return nil
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(pos, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		return err
+	}
+	b.pos.Store(pos)
+	return nil
+}
+
+// ─── Receiving ────────────────────────────────────────────────────────────────
+
+// ApplyXDC applies writes shipped from another cluster. Each goes to its
+// coordinator here, which applies it if it is new and replicates it to
+// W replicas; req.Forwarded ones are applied on this node. It returns
+// how many were new.
+func (rep *Replicator) ApplyXDC(ctx context.Context, req XDCRequest) (int, error) {
+	groups := make(map[string][]store.BatchEntry)
+	nodes := make(map[string]*Node)
+	for _, e := range req.Entries {
+		id := rep.selfID
+		if !req.Forwarded {
+			if coord, err := rep.KeyCoordinator(e.Key); err == nil {
+				id, nodes[coord.ID] = coord.ID, coord
+			}
+		}
+		groups[id] = append(groups[id], e)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		applied int
+		errs    []error
+	)
+	for id, entries := range groups {
+		wg.Go(func() {
+			var n int
+			var err error
+			if id == rep.selfID {
+				n, err = rep.applyXDC(ctx, entries)
+			} else {
+				var resp XDCResponse
+				err = rep.guardedCall(ctx, nodes[id], http.MethodPost, "/internal/xdc",
+					XDCRequest{Source: req.Source, Entries: entries, Forwarded: true}, &resp)
+				n = resp.Applied
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			applied += n
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			}
+		})
+	}
+	wg.Wait()
+	return applied, errors.Join(errs...)
+}
+
+// applyXDC applies entries locally and replicates the new ones.
+func (rep *Replicator) applyXDC(ctx context.Context, entries []store.BatchEntry) (int, error) {
+	var (
+		wg      sync.WaitGroup
+		applied atomic.Int64
+		mu      sync.Mutex
+		errs    []error
+	)
+	for _, e := range entries {
+		wg.Go(func() {
+			ok, err := rep.store.ApplyRemote(e.Key, e.Value)
+			if err == nil && ok {
+				applied.Add(1)
+				rep.xdcApplied.Add(1)
+				if err = rep.awaitWriteQuorum(ctx, e.Key, e.Value); err == nil {
+					rep.publishCommitted(ctx, e)
+				}
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", e.Key, err))
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	return int(applied.Load()), errors.Join(errs...)
+}
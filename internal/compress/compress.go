@@ -0,0 +1,132 @@
+// Package compress wraps the compression codecs used by the store
+// (value compression) and by the HTTP layer (Content-Encoding).
+//
+// Supported codecs:
+//
+//	zstd   → best ratio, still fast. Good default for large JSON blobs.
+//	snappy → lower ratio, very cheap CPU. Good for latency-sensitive paths.
+//	gzip   → HTTP only, because every HTTP client speaks it.
+//
+// The codec names double as HTTP Content-Encoding tokens.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	None   = ""
+	Zstd   = "zstd"
+	Snappy = "snappy"
+	Gzip   = "gzip"
+)
+
+// zstd encoders/decoders are expensive to create but safe for
+// concurrent EncodeAll/DecodeAll calls, so we share one of each.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// Valid reports whether codec is a known codec name (or None).
+func Valid(codec string) bool {
+	switch codec {
+	case None, Zstd, Snappy, Gzip:
+		return true
+	}
+	return false
+}
+
+// Encode compresses data with codec.
+func Encode(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case Zstd:
+		return zstdEncoder.EncodeAll(data, nil), nil
+	case Snappy:
+		return snappy.Encode(nil, data), nil
+	case Gzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case None:
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown codec %q", codec)
+}
+
+// Decode decompresses data produced by Encode.
+func Decode(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case Zstd:
+		return zstdDecoder.DecodeAll(data, nil)
+	case Snappy:
+		return snappy.Decode(nil, data)
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case None:
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown codec %q", codec)
+}
+
+// NewReader wraps r so that reading from it yields decompressed bytes.
+// Used for HTTP request bodies sent with Content-Encoding.
+func NewReader(codec string, r io.Reader) (io.ReadCloser, error) {
+	switch codec {
+	case Zstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case Snappy:
+		return io.NopCloser(snappy.NewReader(r)), nil
+	case Gzip:
+		return gzip.NewReader(r)
+	case None:
+		return io.NopCloser(r), nil
+	}
+	return nil, fmt.Errorf("unknown codec %q", codec)
+}
+
+// Negotiate picks the best codec we support from an
+// Accept-Encoding header value. Returns None if nothing matches.
+//
+// Preference order: zstd, snappy, gzip.
+func Negotiate(acceptEncoding string) string {
+	offered := make(map[string]bool)
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue // explicitly refused
+			}
+		}
+		offered[strings.ToLower(name)] = true
+	}
+	for _, codec := range []string{Zstd, Snappy, Gzip} {
+		if offered[codec] {
+			return codec
+		}
+	}
+	return None
+}
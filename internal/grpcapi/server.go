@@ -0,0 +1,364 @@
+// Package grpcapi serves the public KV API over gRPC (proto/kv/v1).
+//
+// The HTTP API carries a lot of behavior around each operation: tokens
+// and scopes, rate limits and quotas, request deadlines, forwarding to
+// the key's owners, conditional writes, sessions, metrics and logs. A
+// second implementation of all that would drift from the first.
+//
+// So there is none: every RPC is turned into the matching HTTP request
+// and served in-process by the node's router, and its answer turned back:
+//
+//	Get    → GET    /kv/:namespace/:key
+//	Put    → PUT    /kv/:namespace/:key
+//	Delete → DELETE /kv/:namespace/:key
+//	Scan   → GET    /kv?namespace=&prefix=&cursor=&stream=true
+//	Watch  → GET    /watch/:namespace?prefix=&replicas=
+//
+// gRPC metadata becomes request headers (authorization, x-replication,
+// if-match, x-session, ...) and the call's deadline the request's
+// timeout; the ETag and X-Session of the answer come back as header
+// metadata. HTTP statuses map to gRPC codes (see grpcCode), with the
+// HTTP error message as the status message.
+package grpcapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"distributed-kvstore/internal/cluster"
+	kvv1 "distributed-kvstore/proto/kv/v1"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// NewServer returns a gRPC server whose KV service is served by routes,
+// the node's HTTP handler. tlsCfg (nil = plaintext) is the node's.
+func NewServer(routes http.Handler, tlsCfg *tls.Config) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	s := grpc.NewServer(opts...)
+	kvv1.RegisterKVServer(s, &kvServer{routes: routes})
+	return s
+}
+
+// kvServer implements kvv1.KVServer on top of the HTTP routes.
+type kvServer struct {
+	kvv1.UnimplementedKVServer
+	routes http.Handler
+}
+
+// valueBody is the JSON of a value, as GET and PUT /kv/... return it.
+type valueBody struct {
+	Value       string            `json:"value"`
+	ContentType string            `json:"content_type"`
+	Clock       map[string]uint64 `json:"clock"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+func (s *kvServer) Get(ctx context.Context, req *kvv1.GetRequest) (*kvv1.GetResponse, error) {
+	var v valueBody
+	hdr, err := s.unary(ctx, http.MethodGet, keyPath(req.Namespace, req.Key), nil, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &kvv1.GetResponse{
+		Namespace: req.Namespace, Key: req.Key, Value: v.Value, ContentType: v.ContentType,
+		Clock: v.Clock, UpdatedAt: timestamppb.New(v.UpdatedAt), Etag: hdr.Get("ETag"),
+	}, nil
+}
+
+func (s *kvServer) Put(ctx context.Context, req *kvv1.PutRequest) (*kvv1.PutResponse, error) {
+	body := map[string]string{"value": req.Value, "content_type": req.ContentType}
+	var v valueBody
+	hdr, err := s.unary(ctx, http.MethodPut, keyPath(req.Namespace, req.Key), body, &v)
+	if err != nil {
+		return nil, err
+	}
+	return &kvv1.PutResponse{Clock: v.Clock, Etag: hdr.Get("ETag")}, nil
+}
+
+func (s *kvServer) Delete(ctx context.Context, req *kvv1.DeleteRequest) (*kvv1.DeleteResponse, error) {
+	if _, err := s.unary(ctx, http.MethodDelete, keyPath(req.Namespace, req.Key), nil, nil); err != nil {
+		return nil, err
+	}
+	return &kvv1.DeleteResponse{}, nil
+}
+
+func (s *kvServer) Scan(req *kvv1.ScanRequest, stream kvv1.KV_ScanServer) error {
+	q := url.Values{"namespace": {req.Namespace}, "stream": {"true"}}
+	if req.Prefix != "" {
+		q.Set("prefix", req.Prefix)
+	}
+	if req.After != "" {
+		q.Set("cursor", base64.RawURLEncoding.EncodeToString([]byte(req.After)))
+	}
+	if req.PageSize != 0 {
+		q.Set("limit", strconv.Itoa(int(req.PageSize)))
+	}
+	return s.lines(stream.Context(), "/kv?"+q.Encode(), false, func(line []byte) error {
+		var k struct {
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(line, &k); err != nil {
+			return err
+		}
+		return stream.Send(&kvv1.ScanResponse{Key: k.Key})
+	})
+}
+
+func (s *kvServer) Watch(req *kvv1.WatchRequest, stream kvv1.KV_WatchServer) error {
+	q := url.Values{}
+	if req.Prefix != "" {
+		q.Set("prefix", req.Prefix)
+	}
+	if req.AllReplicas {
+		q.Set("replicas", "all")
+	}
+	path := "/watch/" + url.PathEscape(req.Namespace)
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	return s.lines(stream.Context(), path, true, func(line []byte) error {
+		var ev cluster.WatchEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return err
+		}
+		return stream.Send(&kvv1.WatchEvent{
+			Op: watchOps[ev.Op], Key: ev.Key, Value: ev.Value, ContentType: ev.ContentType,
+			Clock: ev.Clock, UpdatedAt: timestamppb.New(ev.UpdatedAt), Node: ev.Node,
+		})
+	})
+}
+
+var watchOps = map[string]kvv1.WatchEvent_Op{
+	"put":    kvv1.WatchEvent_OP_PUT,
+	"delete": kvv1.WatchEvent_OP_DELETE,
+	"evict":  kvv1.WatchEvent_OP_EVICT,
+}
+
+func keyPath(namespace, key string) string {
+	return "/kv/" + url.PathEscape(namespace) + "/" + url.PathEscape(key)
+}
+
+// ─── Calling the routes ───────────────────────────────────────────────────────
+
+// unary serves one request with JSON body in (nil = none) and decodes a
+// 2xx answer into out (nil = ignore it). It returns the answer's headers.
+func (s *kvServer) unary(ctx context.Context, method, path string, in, out any) (http.Header, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	resp := s.serve(ctx, method, path, body)
+	defer resp.body.Close()
+	data, err := io.ReadAll(resp.body)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if resp.status/100 != 2 {
+		return nil, httpError(resp.status, data)
+	}
+	_ = grpc.SetHeader(ctx, responseMetadata(resp.header))
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	return resp.header, nil
+}
+
+// lines serves a GET of an NDJSON stream and hands fn its lines, skipping
+// heartbeats. A closing {"error": ...} line ends the RPC with
+// UNAVAILABLE, as does the end of a stream that should not end (live).
+func (s *kvServer) lines(ctx context.Context, path string, live bool, fn func([]byte) error) error {
+	resp := s.serve(ctx, http.MethodGet, path, nil)
+	defer resp.body.Close()
+	if resp.status/100 != 2 {
+		data, _ := io.ReadAll(resp.body)
+		return httpError(resp.status, data)
+	}
+	_ = grpc.SetHeader(ctx, responseMetadata(resp.header))
+
+	dec := json.NewDecoder(resp.body)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		switch {
+		case ctx.Err() != nil:
+			return status.FromContextError(ctx.Err()).Err()
+		case err == io.EOF && !live:
+			return nil
+		case err == io.EOF:
+			return status.Error(codes.Unavailable, "stream ended")
+		case err != nil:
+			return status.Error(codes.Internal, err.Error())
+		}
+		var closing struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(raw, &closing) == nil && closing.Error != "" {
+			return status.Error(codes.Unavailable, closing.Error)
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// response is what the routes answered. Read body to its end or close it.
+type response struct {
+	status int
+	header http.Header
+	body   *io.PipeReader
+}
+
+// serve runs the request through the routes, returning as soon as they
+// have written the status; the body follows as they write it.
+func (s *kvServer) serve(ctx context.Context, method, path string, body []byte) *response {
+	pr, pw := io.Pipe()
+	w := &responseWriter{header: make(http.Header), status: make(chan int, 1), body: pw}
+	req, err := newRequest(ctx, method, path, body)
+	if err != nil {
+		pw.CloseWithError(err)
+		return &response{status: http.StatusBadRequest, header: w.header, body: pr}
+	}
+	go func() {
+		defer pw.Close()
+		s.routes.ServeHTTP(w, req)
+		w.WriteHeader(http.StatusOK) // wrote nothing at all
+	}()
+	code := <-w.status
+	return &response{status: code, header: w.header, body: pr}
+}
+
+// newRequest builds the HTTP request of an RPC from its context.
+func newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, rd)
+	if err != nil {
+		return nil, err
+	}
+	req.RequestURI = path
+	md, _ := metadata.FromIncomingContext(ctx)
+	for k, vs := range md {
+		if strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") || k == "content-type" || k == "te" {
+			continue
+		}
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		req.Header.Set(cluster.RequestTimeoutHeader, max(time.Until(dl), time.Millisecond).Round(time.Millisecond).String())
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		req.RemoteAddr = p.Addr.String()
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			req.TLS = &info.State
+		}
+	}
+	return req, nil
+}
+
+// responseWriter hands what the routes write to the RPC as they write it.
+type responseWriter struct {
+	header http.Header
+	once   sync.Once
+	status chan int // the status code, once written
+	body   *io.PipeWriter
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.once.Do(func() { w.status <- code })
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// Flush is a no-op: every Write reaches the RPC at once.
+func (w *responseWriter) Flush() {}
+
+// responseMetadata is the header metadata sent back for h.
+func responseMetadata(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for _, name := range []string{"ETag", "X-Session", "Retry-After"} {
+		if v := h.Get(name); v != "" {
+			md.Set(name, v)
+		}
+	}
+	return md
+}
+
+// httpError turns an HTTP error answer into a gRPC status.
+func httpError(code int, body []byte) error {
+	var e struct {
+		Error string `json:"error"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		msg = e.Error
+	}
+	if msg == "" {
+		msg = http.StatusText(code)
+	}
+	return status.Error(grpcCode(code), msg)
+}
+
+// grpcCode maps an HTTP status to the closest gRPC code.
+func grpcCode(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	case http.StatusInternalServerError:
+		return codes.Internal
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,332 @@
+// Package metrics keeps counters, gauges and histograms and writes them
+// in the Prometheus text format (GET /metrics).
+//
+// Big idea:
+//
+// Logs tell the story of one request; metrics tell the shape of all of
+// them: how many requests per route, how many failed, how slow the
+// slowest 1% were. A scraper (Prometheus, or anything that reads its
+// format) polls every node and graphs the history.
+//
+// This is a deliberately small implementation of the exposition format
+// (https://prometheus.io/docs/instrumenting/exposition_formats/): no
+// client library, just what the node needs.
+//
+//	reg := metrics.NewRegistry()
+//	reqs := reg.Counter("kv_requests_total", "Requests handled.", "route", "code")
+//	reqs.With("/kv/:namespace/:key", "200").Inc()
+//	reg.WriteTo(w)
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, for request
+// latencies from a local hit (~1ms) to a slow quorum (10s).
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	names    map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// family is one named metric with all its label combinations.
+type family interface {
+	write(w *strings.Builder)
+}
+
+func (r *Registry) add(name string, f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: " + name + " registered twice")
+	}
+	r.names[name] = true
+	r.families = append(r.families, f)
+}
+
+// WriteTo writes every metric in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ContentType is the media type of WriteTo's output.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ─── Labels ──────────────────────────────────────────────────────────────────
+
+// vec maps label values to one series each.
+type vec[S any] struct {
+	name, help, kind string
+	labels           []string
+
+	mu        sync.RWMutex
+	series    map[string]*S
+	values    map[string][]string
+	newSeries func() *S
+}
+
+func newVec[S any](name, help, kind string, labels []string, mk func() *S) *vec[S] {
+	return &vec[S]{name: name, help: help, kind: kind, labels: labels,
+		series: make(map[string]*S), values: make(map[string][]string), newSeries: mk}
+}
+
+// with returns the series for values, creating it on first use.
+func (v *vec[S]) with(values []string) *S {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	s, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return s
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s, ok := v.series[key]; ok {
+		return s
+	}
+	s = v.newSeries()
+	v.series[key] = s
+	v.values[key] = slices.Clone(values)
+	return s
+}
+
+// each calls fn for every series, sorted by label values so the output
+// is stable between scrapes.
+func (v *vec[S]) each(b *strings.Builder, fn func(labels string, s *S)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	type entry struct {
+		labels string
+		s      *S
+	}
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		entries[i] = entry{formatLabels(v.labels, v.values[k]), v.series[k]}
+	}
+	v.mu.RUnlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	for _, e := range entries {
+		fn(e.labels, e.s)
+	}
+}
+
+// formatLabels renders {a="x",b="y"}, or "" without labels.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string { return labelEscaper.Replace(v) }
+
+// withLabel appends one more label to a rendered label set.
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// ─── Counters ────────────────────────────────────────────────────────────────
+
+// CounterVec is a counter per combination of label values.
+type CounterVec struct{ v *vec[Counter] }
+
+// Counter only goes up.
+type Counter struct{ n atomic.Uint64 }
+
+// Inc adds 1.
+func (c *Counter) Inc() { c.n.Add(1) }
+
+// Add adds n.
+func (c *Counter) Add(n uint64) { c.n.Add(n) }
+
+// Counter registers a counter named name with the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	cv := &CounterVec{newVec(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+	r.add(name, cv)
+	return cv
+}
+
+// With returns the counter for the label values, in registration order.
+func (cv *CounterVec) With(values ...string) *Counter { return cv.v.with(values) }
+
+func (cv *CounterVec) write(b *strings.Builder) {
+	cv.v.each(b, func(labels string, c *Counter) {
+		fmt.Fprintf(b, "%s%s %d\n", cv.v.name, labels, c.n.Load())
+	})
+}
+
+// ─── Gauges ──────────────────────────────────────────────────────────────────
+
+// GaugeVec is a gauge per combination of label values.
+type GaugeVec struct{ v *vec[Gauge] }
+
+// Gauge goes up and down.
+type Gauge struct{ n atomic.Int64 }
+
+// Add adds d (which may be negative).
+func (g *Gauge) Add(d int64) { g.n.Add(d) }
+
+// Set sets the gauge to n.
+func (g *Gauge) Set(n int64) { g.n.Store(n) }
+
+// Gauge registers a gauge named name with the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	gv := &GaugeVec{newVec(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+	r.add(name, gv)
+	return gv
+}
+
+// With returns the gauge for the label values, in registration order.
+func (gv *GaugeVec) With(values ...string) *Gauge { return gv.v.with(values) }
+
+func (gv *GaugeVec) write(b *strings.Builder) {
+	gv.v.each(b, func(labels string, g *Gauge) {
+		fmt.Fprintf(b, "%s%s %d\n", gv.v.name, labels, g.n.Load())
+	})
+}
+
+// funcMetric is a label-less counter or gauge read when scraped.
+type funcMetric struct {
+	name, help, kind string
+	fn               func() float64
+}
+
+// GaugeFunc registers a label-less gauge whose value fn returns at
+// every scrape: for figures something else already keeps (queue
+// lengths, key counts).
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.add(name, &funcMetric{name, help, "gauge", fn})
+}
+
+// CounterFunc is GaugeFunc for a figure that only goes up (counts kept
+// elsewhere).
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.add(name, &funcMetric{name, help, "counter", fn})
+}
+
+func (m *funcMetric) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", m.name, m.help, m.name, m.kind, m.name, formatFloat(m.fn()))
+}
+
+// ─── Histograms ──────────────────────────────────────────────────────────────
+
+// HistogramVec is a histogram per combination of label values.
+type HistogramVec struct {
+	v       *vec[Histogram]
+	buckets []float64
+}
+
+// Histogram counts observations into buckets by upper bound.
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64 // per bucket (not cumulative); last is +Inf
+	sum     atomic.Uint64   // float64 bits
+}
+
+// Histogram registers a histogram named name. buckets are increasing
+// upper bounds (nil = DefaultBuckets); +Inf is implied.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	if !slices.IsSorted(buckets) {
+		panic("metrics: " + name + " buckets are not sorted")
+	}
+	hv := &HistogramVec{buckets: buckets}
+	hv.v = newVec(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets)+1)}
+	})
+	r.add(name, hv)
+	return hv
+}
+
+// With returns the histogram for the label values, in registration order.
+func (hv *HistogramVec) With(values ...string) *Histogram { return hv.v.with(values) }
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.buckets, v) // first bound >= v
+	h.counts[i].Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (hv *HistogramVec) write(b *strings.Builder) {
+	name := hv.v.name
+	hv.v.each(b, func(labels string, h *Histogram) {
+		var cum uint64
+		for i, bound := range hv.buckets {
+			cum += h.counts[i].Load()
+			fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(bound)), cum)
+		}
+		cum += h.counts[len(hv.buckets)].Load()
+		fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), cum)
+		fmt.Fprintf(b, "%s_sum%s %s\n", name, labels, formatFloat(math.Float64frombits(h.sum.Load())))
+		fmt.Fprintf(b, "%s_count%s %d\n", name, labels, cum)
+	})
+}
@@ -0,0 +1,361 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Change data capture
+//
+// The WAL already holds every change this node applied, in order; the
+// writer numbers them (see wal.go). Changes streams them from a number
+// on: first what the log files still hold, then each group commit as it
+// is synced. A consumer keeps the last number it processed and resumes
+// after it, across its own restarts and the node's.
+//
+// What the files hold shrinks at every snapshot, which deletes the log
+// segments it covers. --cdc-retention keeps those as wal.log.cdc-<n>
+// instead (replay never reads them), up to a total size; past it the
+// oldest go. A consumer asking for a change no longer there gets
+// ErrChangesGone and must start over from a backup or a scan.
+//
+// The feed is this node's: local writes, replicated copies, repairs,
+// hints and evictions, once each, as applied. Every replica of a key
+// logs its own copy of a write, so a consumer of the whole cluster reads
+// one node per range or dedupes by clock.
+
+// ErrChangesGone means a change asked for is older than what the log
+// files retain.
+var ErrChangesGone = errors.New("changes no longer retained")
+
+// LoggedChange is one change as the WAL numbered it.
+type LoggedChange struct {
+	Seq uint64
+	Change
+}
+
+// SetCDCRetention keeps up to n bytes of snapshotted log segments for
+// Changes (0 = none). Call it after New, before serving.
+func (s *Store) SetCDCRetention(n int64) error {
+	if n < 0 {
+		return fmt.Errorf("%w: cdc retention must not be negative", ErrInvalidConfig)
+	}
+	s.wal.mu.Lock()
+	defer s.wal.mu.Unlock()
+	s.wal.retain = n
+	return s.wal.pruneRetained()
+}
+
+// ChangeSeq returns the number of the last change this node has synced
+// to its WAL.
+func (s *Store) ChangeSeq() uint64 { return s.wal.durable.Load() }
+
+// OldestChange returns the number of the oldest change the log files
+// still hold (or of the next one, if they hold none), or 0 if no change
+// was ever numbered.
+func (s *Store) OldestChange() uint64 {
+	for _, path := range append(s.wal.cdcFiles(), s.wal.path) {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		seq := firstSeq(f)
+		f.Close()
+		if seq > 0 {
+			return seq
+		}
+	}
+	return 0
+}
+
+// firstSeq returns the number of the first change in r: after its SEQ
+// line if it has one, else its first numbered entry's.
+func firstSeq(r io.Reader) uint64 {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), maxEntrySize)
+	for sc.Scan() {
+		e, _, err := parseEntry(sc.Bytes())
+		switch {
+		case err != nil:
+		case e.Op == opSeq:
+			return e.Seq + 1
+		case e.Seq > 0:
+			return e.Seq
+		}
+	}
+	return 0
+}
+
+// Changes calls fn with every change numbered from on, oldest first,
+// then with new changes as they are synced, until ctx is done or fn
+// returns an error. from = 0 starts at the oldest change retained;
+// asking for one older than that fails with ErrChangesGone.
+func (s *Store) Changes(ctx context.Context, from uint64, fn func(LoggedChange) error) error {
+	c := &changeCursor{w: s.wal, next: max(from, 1), strict: from > 0, fn: fn}
+	for {
+		before := c.next
+		if err := c.history(ctx); err != nil {
+			return err
+		}
+		err := c.follow(ctx)
+		var gap changeGap
+		if !errors.As(err, &gap) {
+			return err
+		}
+		// The live log starts past what we have read: segments sealed
+		// since we listed them hold the rest, unless a snapshot deleted
+		// them already.
+		if c.next == before {
+			return c.gone(gap)
+		}
+	}
+}
+
+// changeCursor is one reader of the feed.
+type changeCursor struct {
+	w      *WAL
+	next   uint64 // the next change wanted
+	strict bool   // next must be found: the reader asked for it, or got the one before
+	fn     func(LoggedChange) error
+}
+
+// changeGap is a SEQ line past the next change wanted: the changes in
+// between are in another file, or gone.
+type changeGap struct{ last uint64 }
+
+func (g changeGap) Error() string { return fmt.Sprintf("log continues after change %d", g.last) }
+
+func (c *changeCursor) gone(g changeGap) error {
+	return fmt.Errorf("%w: change %d was wanted, the log continues after %d", ErrChangesGone, c.next, g.last)
+}
+
+// history reads the retained and sealed segments, oldest first.
+func (c *changeCursor) history(ctx context.Context) error {
+list:
+	for {
+		for _, path := range c.w.cdcFiles() {
+			f, err := os.Open(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue list // retained or removed meanwhile: list again
+			}
+			if err != nil {
+				return err
+			}
+			_, err = c.read(ctx, bufio.NewReader(f), nil)
+			f.Close()
+			var gap changeGap
+			if errors.As(err, &gap) {
+				return c.gone(gap) // the files before it are gone
+			}
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// follow reads the live log, and the next one after each rotation,
+// waiting for group commits at its end.
+func (c *changeCursor) follow(ctx context.Context) error {
+	for {
+		f, gen, err := c.w.openLive()
+		if err != nil {
+			return err
+		}
+		err = c.tail(ctx, f, gen)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// tail reads f, segment gen, until the WAL has moved on from it.
+func (c *changeCursor) tail(ctx context.Context, f *os.File, gen int) error {
+	r := bufio.NewReader(f)
+	var partial []byte
+	for {
+		synced, now := c.w.changed()
+		var err error
+		partial, err = c.read(ctx, r, partial)
+		if err != io.EOF {
+			return err
+		}
+		if now != gen {
+			// Sealed before we hit its end: f is complete and read.
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-synced:
+		}
+	}
+}
+
+// read hands the changes of r's lines to fn until r's end (io.EOF). A
+// line r ends in the middle of is returned, to be completed by the next
+// read.
+func (c *changeCursor) read(ctx context.Context, r *bufio.Reader, partial []byte) ([]byte, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err != nil {
+			return partial, err
+		}
+		e, _, perr := parseEntry(partial[:len(partial)-1])
+		partial = partial[:0]
+		if perr != nil {
+			continue // skipped on replay too
+		}
+		if err := c.entry(ctx, e); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// entry hands e's wanted changes to fn, once they are synced.
+func (c *changeCursor) entry(ctx context.Context, e walEntry) error {
+	switch {
+	case e.Op == opSeq:
+		if e.Seq >= c.next {
+			if c.strict {
+				return changeGap{last: e.Seq}
+			}
+			c.next = e.Seq + 1
+		}
+		return nil
+	case e.Seq == 0 || e.lastSeq() < c.next:
+		return nil // written before numbering, or read already
+	}
+	if err := c.w.awaitDurable(ctx, e.lastSeq()); err != nil {
+		return err
+	}
+	for i, op := range e.ops() {
+		seq := e.Seq + uint64(i)
+		if seq < c.next {
+			continue
+		}
+		ch := Change{Key: NamespacedKey(SplitKey(op.Key)), Value: op.Value, Evicted: op.Op == opEvict}
+		if err := c.fn(LoggedChange{Seq: seq, Change: ch}); err != nil {
+			return err
+		}
+		c.next, c.strict = seq+1, true
+	}
+	return nil
+}
+
+// ─── WAL side ─────────────────────────────────────────────────────────────────
+
+// markDurable records that the changes up to last are synced, and wakes
+// the feed's readers.
+func (w *WAL) markDurable(last uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if last > w.durable.Load() {
+		w.durable.Store(last)
+	}
+	close(w.synced)
+	w.synced = make(chan struct{})
+}
+
+// changed returns a channel closed at the next group commit, and the
+// number of the live log's segment-to-be.
+func (w *WAL) changed() (<-chan struct{}, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.synced, w.seq
+}
+
+// awaitDurable waits until change seq is synced.
+func (w *WAL) awaitDurable(ctx context.Context, seq uint64) error {
+	for w.durable.Load() < seq {
+		synced, _ := w.changed()
+		if w.durable.Load() >= seq {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-synced:
+		}
+	}
+	return nil
+}
+
+// openLive opens the live log for reading, with the number it will be
+// sealed as minus one.
+func (w *WAL) openLive() (*os.File, int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, err := os.Open(w.path)
+	return f, w.seq, err
+}
+
+// retainedPath names the kept copy of sealed segment seq.
+func (w *WAL) retainedPath(seq int) string {
+	return w.path + ".cdc-" + strconv.Itoa(seq)
+}
+
+// retained lists the kept segments, oldest first.
+func (w *WAL) retained() []segment {
+	matches, _ := filepath.Glob(w.path + ".cdc-*")
+	var out []segment
+	for _, m := range matches {
+		if seq, err := strconv.Atoi(strings.TrimPrefix(m, w.path+".cdc-")); err == nil {
+			out = append(out, segment{seq: seq, path: m})
+		}
+	}
+	slices.SortFunc(out, func(a, b segment) int { return a.seq - b.seq })
+	return out
+}
+
+// cdcFiles lists the files holding changes before the live log, oldest
+// first: the kept segments, then the sealed ones.
+func (w *WAL) cdcFiles() []string {
+	segs := w.retained()
+	if sealed, err := w.sealed(); err == nil {
+		segs = append(segs, sealed...)
+	}
+	// Stable: a segment compacted in place (wal_compact.go) comes after
+	// the kept copy of what it was.
+	slices.SortStableFunc(segs, func(a, b segment) int { return a.seq - b.seq })
+	paths := make([]string, len(segs))
+	for i, seg := range segs {
+		paths[i] = seg.path
+	}
+	return paths
+}
+
+// pruneRetained deletes the oldest kept segments until they fit the
+// retention. Caller holds w.mu.
+func (w *WAL) pruneRetained() error {
+	segs := w.retained()
+	sizes := make([]int64, len(segs))
+	var total int64
+	for i, seg := range segs {
+		if fi, err := os.Stat(seg.path); err == nil {
+			sizes[i] = fi.Size()
+			total += sizes[i]
+		}
+	}
+	for i, seg := range segs {
+		if total <= w.retain {
+			break
+		}
+		if err := os.Remove(seg.path); err != nil {
+			return err
+		}
+		total -= sizes[i]
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"maps"
+	"sync/atomic"
+)
+
+// ─── Vector clock pruning ─────────────────────────────────────────────────────
+//
+// A clock gains an entry for every node that ever wrote the key, and
+// nodes that left the cluster never write again. In a cluster that
+// replaces nodes often, long-lived keys carry a growing list of dead
+// entries on every read, write and replicate.
+//
+// The cluster package (cluster/prune.go) tells the store which entries
+// can go:
+//
+//   - Pruned: nodes that left more than a safety window ago. Their
+//     entries are dropped from every clock this node writes, and ignored
+//     when this node compares clocks to decide what to keep. So a
+//     pruned version still supersedes the one it came from: {n1:4}
+//     after {n1:3, old:5} is newer, not concurrent.
+//   - MaxEntries: a clock this node writes that is still longer sheds
+//     the entries of nodes that left within the window, the longest
+//     gone first. Members are never shed: their writes are still
+//     arriving. A version that shed an entry compares as concurrent with
+//     its predecessor on nodes that have not pruned it yet, and is
+//     settled by the tie-break (tiebreak.go), which a fresh write wins
+//     under "time".
+//
+// Stored values are not rewritten: an old clock loses its dead entries
+// the next time the key is written.
+
+// ClockPruning says what the store strips from vector clocks.
+type ClockPruning struct {
+	Pruned     map[string]bool // dropped everywhere
+	Departed   []string        // shed past MaxEntries, longest gone first
+	MaxEntries int             // 0 = no cap
+}
+
+// clockPruning holds the current ClockPruning and what it has removed.
+type clockPruning struct {
+	cfg    atomic.Pointer[ClockPruning]
+	pruned atomic.Uint64 // entries dropped or shed from clocks written here
+}
+
+// SetClockPruning replaces what the store strips from vector clocks.
+func (s *Store) SetClockPruning(p ClockPruning) {
+	s.prune.cfg.Store(&p)
+}
+
+// ClockEntriesPruned counts the entries dropped from clocks written here.
+func (s *Store) ClockEntriesPruned() uint64 {
+	return s.prune.pruned.Load()
+}
+
+// pruneClock removes the entries c should not carry into a new version.
+// It may modify c.
+func (s *Store) pruneClock(c VectorClock) VectorClock {
+	p := s.prune.cfg.Load()
+	if p == nil {
+		return c
+	}
+	before := len(c)
+	if p.prunes(c) {
+		maps.DeleteFunc(c, func(id string, _ uint64) bool { return p.Pruned[id] })
+	}
+	for _, id := range p.Departed {
+		if p.MaxEntries == 0 || len(c) <= p.MaxEntries {
+			break
+		}
+		delete(c, id)
+	}
+	s.prune.pruned.Add(uint64(before - len(c)))
+	return c
+}
+
+// CompareClocks compares a with b as ApplyRemote does: without the
+// entries of pruned nodes.
+func (s *Store) CompareClocks(a, b VectorClock) ClockRelation {
+	a, b = s.unpruned(a, b)
+	return a.Compare(b)
+}
+
+// unpruned returns a and b without the entries of pruned nodes, copied
+// only if they have any.
+func (s *Store) unpruned(a, b VectorClock) (VectorClock, VectorClock) {
+	p := s.prune.cfg.Load()
+	if p == nil || !p.prunes(a) && !p.prunes(b) {
+		return a, b
+	}
+	return p.strip(a), p.strip(b)
+}
+
+// prunes reports whether c has an entry of a pruned node.
+func (p *ClockPruning) prunes(c VectorClock) bool {
+	for id := range c {
+		if p.Pruned[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// strip returns a copy of c without the entries of pruned nodes.
+func (p *ClockPruning) strip(c VectorClock) VectorClock {
+	c = c.Copy()
+	maps.DeleteFunc(c, func(id string, _ uint64) bool { return p.Pruned[id] })
+	return c
+}
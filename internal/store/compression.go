@@ -0,0 +1,111 @@
+package store
+
+import (
+	"distributed-kvstore/internal/compress"
+	"fmt"
+)
+
+// Value compression
+//
+// Large values (think JSON blobs) are compressed before they hit the WAL.
+// The compressed bytes are what we keep in memory, write to the snapshot,
+// and ship to replicas — so one compression saves space everywhere.
+//
+// Small values are left alone: below a few hundred bytes the codec
+// header overhead outweighs the savings.
+//
+// Reads decompress transparently (Get, Value.Decode).
+
+// CompressionOff disables compression for a namespace even if the node
+// has a default codec.
+const CompressionOff = "none"
+
+// compressionConfig is the node-wide default.
+type compressionConfig struct {
+	codec     string // compress.None disables it
+	threshold int    // only values >= threshold bytes are compressed
+}
+
+// validValueCodec reports whether codec can be used for stored values.
+// gzip is HTTP-only: it is slower than zstd with a worse ratio.
+func validValueCodec(codec string) bool {
+	return codec == compress.None || codec == compress.Zstd || codec == compress.Snappy
+}
+
+// SetCompression sets the node-wide default codec and size threshold.
+// Call before serving traffic.
+func (s *Store) SetCompression(codec string, threshold int) error {
+	if codec == CompressionOff {
+		codec = compress.None
+	}
+	if !validValueCodec(codec) {
+		return fmt.Errorf("unknown compression %q: expected zstd, snappy or none", codec)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compression = compressionConfig{codec: codec, threshold: threshold}
+	return nil
+}
+
+// codecFor returns the codec and size threshold for writes to key,
+// from its namespace config and the node default. Caller must hold s.mu.
+func (s *Store) codecFor(key string) (codec string, threshold int) {
+	nsName, _ := SplitKey(key)
+
+	codec = s.compression.codec
+	switch c := s.namespaces[nsName].Compression; c {
+	case "":
+		// inherit node default
+	case CompressionOff:
+		codec = compress.None
+	default:
+		codec = c
+	}
+	return codec, s.compression.threshold
+}
+
+// compressValue compresses v.Data in place with codec
+// if the value is at least threshold bytes.
+func compressValue(v *Value, codec string, threshold int) error {
+	if codec == compress.None || len(v.Data) < threshold {
+		return nil
+	}
+
+	out, err := compress.Encode(codec, []byte(v.Data))
+	if err != nil {
+		return err
+	}
+	if len(out) >= len(v.Data) {
+		return nil // incompressible — not worth it
+	}
+
+	v.Encoding = codec
+	v.Compressed = out
+	v.Data = ""
+	return nil
+}
+
+// Decode returns a copy of v with Data decompressed.
+// Plain values are returned unchanged.
+func (v Value) Decode() (Value, error) {
+	if v.Encoding == "" {
+		return v, nil
+	}
+	data, err := compress.Decode(v.Encoding, v.Compressed)
+	if err != nil {
+		return Value{}, fmt.Errorf("decode %s value: %w", v.Encoding, err)
+	}
+	v.Data = string(data)
+	v.Encoding = ""
+	v.Compressed = nil
+	return v, nil
+}
+
+// Size returns the number of bytes v occupies as stored
+// (compressed size if compressed).
+func (v Value) Size() int {
+	if v.Encoding != "" {
+		return len(v.Compressed)
+	}
+	return len(v.Data)
+}
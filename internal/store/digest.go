@@ -0,0 +1,69 @@
+package store
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+)
+
+// ─── Digests ──────────────────────────────────────────────────────────────────
+//
+// Anti-entropy compares replicas without shipping values: each side sends
+// a small hash per key, and only keys whose hashes differ are fetched and
+// repaired. A digest covers everything that makes two copies different
+// to a read — clock, tombstone flag, content and expiry — but not
+// UpdatedAt, which only breaks ties between concurrent versions.
+
+// Digest returns a hash of v's clock, tombstone flag and content.
+func (v Value) Digest() uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+
+	ids := make([]string, 0, len(v.Clock))
+	for id := range v.Clock {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		h.Write([]byte(id))
+		binary.BigEndian.PutUint64(buf[:], v.Clock[id])
+		h.Write(buf[:])
+	}
+	if v.Tombstone {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	h.Write([]byte(v.Encoding))
+	h.Write([]byte{0})
+	h.Write([]byte(v.Data))
+	h.Write(v.Compressed)
+	// Only when set, so untyped values keep the digests older nodes
+	// compute for them.
+	if v.ContentType != "" {
+		h.Write([]byte{0})
+		h.Write([]byte(v.ContentType))
+	}
+	if !v.ExpiresAt.IsZero() {
+		h.Write([]byte{1})
+		binary.BigEndian.PutUint64(buf[:], uint64(v.ExpiresAt.UnixNano()))
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
+
+// Digests returns the digest of every stored key, tombstones included,
+// for which keep returns true.
+func (s *Store) Digests(keep func(key string) bool) map[string]uint64 {
+	out := make(map[string]uint64)
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for k, v := range sh.data {
+			if keep(k) {
+				out[k] = v.Digest()
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return out
+}
@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/metrics"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Disk space
+//
+// A full disk does not fail cleanly. The WAL writer gets ENOSPC in the
+// middle of a group commit and leaves a torn line, snapshots fail
+// halfway, and hints, the outbox and txn.log stop being written while
+// the writes they protect go on. So a node keeps a reserve:
+//
+//	--min-free-disk 1GiB   (or 5%: of the data dir's file system)
+//
+// Once free space on the data dir's file system falls below it, the
+// store refuses what would fill it further with ErrDiskFull (507):
+// local writes that add data, and replicated writes and batches unless
+// they are tombstones. Reads, deletes, replicated tombstones and
+// evictions go on; deleting is how an operator makes room, and a
+// tombstone that is not replicated comes back as a resurrected key.
+//
+// Free space is checked every second. The reserve must cover what a
+// second of writes adds, plus the next snapshot, which may need as much
+// as the data takes in memory. Crossing the line either way is logged,
+// and kv_disk_low reports it for alerting.
+
+// ErrDiskFull is returned for writes refused while free disk space is
+// below the reserve.
+var ErrDiskFull = errors.New("disk space low")
+
+// DiskReserve is the free space a node keeps on its data dir.
+type DiskReserve struct {
+	Bytes   int64   // absolute; 0 = use Percent
+	Percent float64 // of the file system's size
+}
+
+// DefaultDiskReserve is used unless --min-free-disk says otherwise.
+var DefaultDiskReserve = DiskReserve{Bytes: 1 << 30}
+
+// diskCheckInterval is how often RunDiskMonitor looks at free space.
+const diskCheckInterval = time.Second
+
+// ParseDiskReserve parses a --min-free-disk value: a size (512MiB, 2G)
+// or a percentage (5%). 0 turns the reserve off.
+func ParseDiskReserve(v string) (DiskReserve, error) {
+	if pct, ok := strings.CutSuffix(v, "%"); ok {
+		p, err := strconv.ParseFloat(pct, 64)
+		if err != nil || p < 0 || p >= 100 {
+			return DiskReserve{}, fmt.Errorf("invalid percentage %q", v)
+		}
+		return DiskReserve{Percent: p}, nil
+	}
+	n, err := parseSize(v)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("invalid size %q", v)
+	}
+	return DiskReserve{Bytes: n}, err
+}
+
+func (r DiskReserve) String() string {
+	if r.Bytes == 0 && r.Percent > 0 {
+		return strconv.FormatFloat(r.Percent, 'g', -1, 64) + "%"
+	}
+	return formatSize(r.Bytes)
+}
+
+// of returns the reserve in bytes on a file system of total bytes.
+func (r DiskReserve) of(total int64) int64 {
+	if r.Bytes > 0 {
+		return r.Bytes
+	}
+	return int64(r.Percent / 100 * float64(total))
+}
+
+// diskMonitor is the data dir's free space as last measured.
+type diskMonitor struct {
+	reserve atomic.Pointer[DiskReserve]
+	free    atomic.Int64 // bytes; -1 = not measured (unsupported platform)
+	total   atomic.Int64
+	low     atomic.Bool
+	refused atomic.Uint64 // writes refused while low
+}
+
+// DiskStats describes the data dir's file system.
+type DiskStats struct {
+	DiskFree    int64  `json:"disk_free_bytes,omitempty"` // 0 = not measured
+	DiskReserve int64  `json:"disk_reserve_bytes,omitempty"`
+	DiskLow     bool   `json:"disk_low,omitempty"` // writes are refused
+	DiskRefused uint64 `json:"disk_refused_writes,omitempty"`
+}
+
+// SetDiskReserve replaces the free space the store keeps, and measures
+// it right away.
+func (s *Store) SetDiskReserve(r DiskReserve) error {
+	if r.Bytes < 0 || r.Percent < 0 || r.Percent >= 100 {
+		return fmt.Errorf("%w: disk reserve must be a size or a percentage under 100", ErrInvalidConfig)
+	}
+	s.disk.reserve.Store(&r)
+	s.checkDiskSpace() // RunDiskMonitor reports a failure
+	return nil
+}
+
+// RunDiskMonitor measures free space every second until ctx is done,
+// logging when the store starts and stops refusing writes.
+func (s *Store) RunDiskMonitor(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(diskCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := s.checkDiskSpace()
+			if err != nil {
+				logger.Warn("cannot measure free disk space: writes are not guarded", "dir", s.dataDir, "error", err)
+				return
+			}
+			if !changed {
+				continue
+			}
+			st := s.DiskStats()
+			if st.DiskLow {
+				logger.Error("disk space low: refusing writes", "dir", s.dataDir,
+					"free_bytes", st.DiskFree, "reserve_bytes", st.DiskReserve)
+			} else {
+				logger.Info("disk space recovered: accepting writes", "dir", s.dataDir,
+					"free_bytes", st.DiskFree, "refused", st.DiskRefused)
+			}
+		}
+	}
+}
+
+// checkDiskSpace measures free space and reports whether the store
+// started or stopped refusing writes.
+func (s *Store) checkDiskSpace() (changed bool, err error) {
+	free, total, err := diskSpace(s.dataDir)
+	if err != nil {
+		s.disk.free.Store(-1)
+		return false, err
+	}
+	s.disk.free.Store(free)
+	s.disk.total.Store(total)
+	low := false
+	if r := s.disk.reserve.Load(); r != nil {
+		low = free < r.of(total)
+	}
+	return s.disk.low.Swap(low) != low, nil
+}
+
+// checkDisk refuses a write that adds data while free space is below
+// the reserve.
+func (s *Store) checkDisk() error {
+	if !s.disk.low.Load() {
+		return nil
+	}
+	s.disk.refused.Add(1)
+	st := s.DiskStats()
+	return fmt.Errorf("%w: %d bytes free on the data dir, reserve is %d", ErrDiskFull, st.DiskFree, st.DiskReserve)
+}
+
+// DiskStats returns the data dir's free space as last measured.
+func (s *Store) DiskStats() DiskStats {
+	st := DiskStats{DiskLow: s.disk.low.Load(), DiskRefused: s.disk.refused.Load()}
+	if free := s.disk.free.Load(); free > 0 {
+		st.DiskFree = free
+	}
+	if r := s.disk.reserve.Load(); r != nil {
+		st.DiskReserve = r.of(s.disk.total.Load())
+	}
+	return st
+}
+
+// registerDiskMetrics adds free space and refusals to reg.
+func (s *Store) registerDiskMetrics(reg *metrics.Registry) {
+	reg.GaugeFunc("kv_disk_free_bytes", "Free space on the data dir's file system, as last measured.",
+		func() float64 { return float64(max(s.disk.free.Load(), 0)) })
+	reg.GaugeFunc("kv_disk_low", "1 while free disk space is below --min-free-disk and writes are refused.",
+		func() float64 {
+			if s.disk.low.Load() {
+				return 1
+			}
+			return 0
+		})
+	reg.CounterFunc("kv_disk_refused_writes_total", "Writes refused for low disk space.",
+		func() float64 { return float64(s.disk.refused.Load()) })
+}
@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package store
+
+import "errors"
+
+// Elsewhere free space is not measured, and writes are never refused for it.
+
+func diskSpace(path string) (free, total int64, err error) {
+	return 0, 0, errors.New("free disk space is not measured on this platform")
+}
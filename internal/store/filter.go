@@ -0,0 +1,131 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scan filters
+//
+// A Filter narrows a key scan (KeysPage, GET /kv) to keys whose value
+// matches, so a client looking for a few keys under a prefix does not
+// list and fetch all of them to pick them out itself. Each condition
+// given must hold:
+//
+//	contains=err          the value contains "err"
+//	field=user.plan       the value is JSON with that field (dotted path;
+//	equals=pro            a number picks an array element) — equal to
+//	                      "pro": a string field compares unquoted, any
+//	                      other as compact JSON (42, true, null, {...})
+//	updated_after=<time>  written after the RFC 3339 time
+//
+// The conditions are checked on this node's copy of each value, while
+// the scan walks the shards: a page is still the first limit keys that
+// match, however many were passed over to find them.
+
+// ErrInvalidFilter wraps every filter parse failure.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Filter selects values in a key scan. The zero Filter selects all.
+type Filter struct {
+	Contains     string    // Data contains this
+	Field        string    // Data is JSON with a value at this dotted path...
+	Equals       string    // ...and it equals this ("" = any value, with Field)
+	UpdatedAfter time.Time // UpdatedAt is after this
+}
+
+// IsZero reports whether f selects every value.
+func (f Filter) IsZero() bool {
+	return f.Contains == "" && f.Field == "" && f.UpdatedAfter.IsZero()
+}
+
+// ParseFilter reads a filter from query parameters (see above).
+func ParseFilter(q url.Values) (Filter, error) {
+	f := Filter{Contains: q.Get("contains"), Field: q.Get("field"), Equals: q.Get("equals")}
+	if f.Equals != "" && f.Field == "" {
+		return Filter{}, fmt.Errorf("%w: equals needs a field", ErrInvalidFilter)
+	}
+	if v := q.Get("updated_after"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return Filter{}, fmt.Errorf("%w: updated_after must be an RFC 3339 time", ErrInvalidFilter)
+		}
+		f.UpdatedAfter = t
+	}
+	return f, nil
+}
+
+// Encode adds f to q, as ParseFilter reads it.
+func (f Filter) Encode(q url.Values) {
+	if f.Contains != "" {
+		q.Set("contains", f.Contains)
+	}
+	if f.Field != "" {
+		q.Set("field", f.Field)
+	}
+	if f.Equals != "" {
+		q.Set("equals", f.Equals)
+	}
+	if !f.UpdatedAfter.IsZero() {
+		q.Set("updated_after", f.UpdatedAfter.Format(time.RFC3339Nano))
+	}
+}
+
+// Match reports whether v, decoded, passes f. Tombstones never do.
+func (f Filter) Match(v Value) bool {
+	if v.Tombstone || !f.UpdatedAfter.IsZero() && !v.UpdatedAt.After(f.UpdatedAfter) {
+		return false
+	}
+	if f.Contains != "" && !strings.Contains(v.Data, f.Contains) {
+		return false
+	}
+	if f.Field == "" {
+		return true
+	}
+	dec := json.NewDecoder(strings.NewReader(v.Data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return false
+	}
+	leaf, ok := jsonPath(doc, f.Field)
+	if !ok {
+		return false
+	}
+	if f.Equals == "" {
+		return true
+	}
+	if s, ok := leaf.(string); ok {
+		return s == f.Equals
+	}
+	b, err := json.Marshal(leaf)
+	return err == nil && string(b) == f.Equals
+}
+
+// jsonPath follows the dotted path from doc.
+func jsonPath(doc any, path string) (any, bool) {
+	for _, seg := range strings.Split(path, ".") {
+		switch node := doc.(type) {
+		case map[string]any:
+			next, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			doc = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			doc = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ─── Hybrid logical clock ─────────────────────────────────────────────────────
+//
+// The time tie-break (tiebreak.go) used to compare UpdatedAt, the wall
+// clock of whichever node coordinated the write. A node that reads a value
+// stamped by a peer 3s ahead, then overwrites it from another branch of
+// the clock, stamps its own write 3s "earlier" and loses to the value it
+// meant to replace.
+//
+// Every write now also carries an HLC: wall milliseconds in the high 48
+// bits, a logical counter in the low 16. Each node keeps the largest HLC
+// it has issued or seen, from its own writes, replication, replay and
+// snapshots, and stamps the next write just above it:
+//
+//	n2 (3s ahead) writes         hlc = 12:00:03.000 · 0
+//	n1 applies it                n1's clock jumps to 12:00:03.000 · 0
+//	n1 writes at 12:00:00.500    hlc = 12:00:03.000 · 1   (not 12:00:00.500)
+//
+// So a write stamped after seeing another always wins the tie-break
+// against it, and one node's stamps never go backwards, even if its wall
+// clock does. Writes that never saw each other are still ordered by
+// (skewed) wall time; cluster/skew.go reports how far off that can be.
+//
+// The flip side: one value stamped far in the future (a clock set wrong)
+// carries every node that sees it along, and their stamps run ahead of
+// wall time until it catches up. Stats reports the lead as hlc_ahead_ms.
+//
+// Values written before HLCs have none. Timestamp derives one from
+// UpdatedAt (logical 0), so they compare with newer values as they did
+// before, and pick up a real HLC the next time they are written.
+
+// HLC is a hybrid logical clock timestamp.
+type HLC uint64
+
+const hlcLogicalBits = 16
+
+// HLCAt returns the HLC of wall time t, logical 0.
+func HLCAt(t time.Time) HLC {
+	return HLC(t.UnixMilli()) << hlcLogicalBits
+}
+
+// Time is the wall-clock part of h.
+func (h HLC) Time() time.Time {
+	return time.UnixMilli(int64(h >> hlcLogicalBits)).UTC()
+}
+
+// Logical is the counter part of h.
+func (h HLC) Logical() uint16 {
+	return uint16(h)
+}
+
+// String formats h as "<RFC 3339 millis>+<logical>".
+func (h HLC) String() string {
+	return fmt.Sprintf("%s+%d", h.Time().Format("2006-01-02T15:04:05.000Z07:00"), h.Logical())
+}
+
+// Timestamp returns v's HLC, derived from UpdatedAt for values written
+// before HLCs.
+func (v Value) Timestamp() HLC {
+	if v.HLC != 0 {
+		return v.HLC
+	}
+	return HLCAt(v.UpdatedAt)
+}
+
+// CompareTime orders a and b by HLC, then by UpdatedAt: > 0 if a is
+// later, < 0 if b is, 0 if they were stamped alike.
+func CompareTime(a, b Value) int {
+	if ta, tb := a.Timestamp(), b.Timestamp(); ta != tb {
+		if ta > tb {
+			return 1
+		}
+		return -1
+	}
+	return a.UpdatedAt.Compare(b.UpdatedAt)
+}
+
+// hlcClock is the largest HLC this node has issued or seen.
+type hlcClock struct {
+	last atomic.Uint64
+}
+
+// now issues an HLC above every one issued or seen before.
+func (c *hlcClock) now() HLC {
+	wall := uint64(HLCAt(time.Now()))
+	for {
+		last := c.last.Load()
+		next := max(wall, last+1) // logical overflow carries into the millis
+		if c.last.CompareAndSwap(last, next) {
+			return HLC(next)
+		}
+	}
+}
+
+// observe moves the clock up to h.
+func (c *hlcClock) observe(h HLC) {
+	for {
+		last := c.last.Load()
+		if uint64(h) <= last || c.last.CompareAndSwap(last, uint64(h)) {
+			return
+		}
+	}
+}
+
+// Stamp issues the HLC of a write this node makes outside the store's own
+// Put and Delete, such as a repair that bumps a clock.
+func (s *Store) Stamp() HLC {
+	return s.hlc.now()
+}
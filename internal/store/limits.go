@@ -0,0 +1,108 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Size limits
+//
+// Without limits a single huge PUT is held in memory, written to the WAL,
+// and then copied to every replica before anything can fail. Limits are
+// checked on local writes (Put, Delete) BEFORE any of that happens.
+//
+// They are not checked in ApplyRemote: the coordinator already checked
+// the write, and a replica with a smaller limit refusing it would only
+// leave the replicas diverged.
+//
+// Key syntax
+//
+// A key is any non-empty UTF-8 string without control characters, other
+// than "." and "..", which URL paths resolve away. Keys travel in URLs
+// (/kv/:namespace/:key), so a "/" in a key — or "%", "?", "#", a space —
+// is sent percent-encoded: "a/b" is /kv/app/a%2Fb, which names the key
+// "a/b". Sent bare, /kv/app/a/b finds no route, or another one.
+
+// DefaultMaxKeyLength is the default limit on a key's length in bytes
+// (the namespace prefix is not counted).
+const DefaultMaxKeyLength = 1024
+
+// DefaultMaxValueSize is the default limit on a value's size in bytes
+// (before compression).
+const DefaultMaxValueSize = 1 << 20 // 1 MiB
+
+var (
+	// ErrInvalidKey is returned for keys that break the key syntax.
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrKeyTooLong is returned for keys longer than Limits.MaxKeyLength.
+	ErrKeyTooLong = errors.New("key too long")
+	// ErrValueTooLarge is returned for values larger than Limits.MaxValueSize.
+	ErrValueTooLarge = errors.New("value too large")
+)
+
+// Limits bounds what a single write may contain. Zero means unlimited.
+type Limits struct {
+	MaxKeyLength int
+	MaxValueSize int
+}
+
+// CheckKey validates the syntax and length of key (without namespace).
+func (l Limits) CheckKey(key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	if l.MaxKeyLength > 0 && len(key) > l.MaxKeyLength {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrKeyTooLong, len(key), l.MaxKeyLength)
+	}
+	return nil
+}
+
+// ValidateKey checks key (without namespace) against the key syntax.
+func ValidateKey(key string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("%w: empty", ErrInvalidKey)
+	case key == "." || key == "..":
+		return fmt.Errorf("%w: %q is not a key", ErrInvalidKey, key)
+	case !utf8.ValidString(key):
+		return fmt.Errorf("%w: not valid UTF-8", ErrInvalidKey)
+	}
+	if i := strings.IndexFunc(key, unicode.IsControl); i >= 0 {
+		return fmt.Errorf("%w: control character at byte %d", ErrInvalidKey, i)
+	}
+	return nil
+}
+
+// CheckValue validates the size of data.
+func (l Limits) CheckValue(data string) error {
+	if l.MaxValueSize > 0 && len(data) > l.MaxValueSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrValueTooLarge, len(data), l.MaxValueSize)
+	}
+	return nil
+}
+
+// SetLimits sets the key/value size limits. Call before serving traffic.
+func (s *Store) SetLimits(l Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = l
+}
+
+// Limits returns the configured size limits.
+func (s *Store) Limits() Limits {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.limits
+}
+
+// checkLimits validates a local write. Caller must hold s.mu.
+func (s *Store) checkLimits(key, data string) error {
+	_, k := SplitKey(key)
+	if err := s.limits.CheckKey(k); err != nil {
+		return err
+	}
+	return s.limits.CheckValue(data)
+}
@@ -0,0 +1,397 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"distributed-kvstore/internal/metrics"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Memory accounting and eviction
+//
+// Everything lives in memory, so a node keeps growing until the kernel
+// kills it. For a durable store the answer is more nodes. For a cache it
+// is a bound: --max-memory, with a policy for what happens once the data
+// reaches it.
+//
+//	reject → local writes that add data fail with ErrMemoryFull (507);
+//	         deletes and replicated writes still apply
+//	lru    → writes always apply; a background evictor then drops the
+//	         least recently used keys until the data is under the bound
+//	ttl    → as lru, but keys with a TTL (see ttl.go) go first, those
+//	         that expire soonest before the others; keys without one are
+//	         evicted least recently used once no sampled key has a TTL
+//
+// The accounting is an estimate: key and value bytes (compressed values
+// count compressed), the clock and content type, kept versions, and a
+// fixed overhead per entry for the map and the Value struct. It is what
+// the data costs, not what the Go heap holds; leave headroom.
+//
+// ttl suits a cache that sets TTLs on what it can most easily lose:
+// those keys would be gone soon anyway. There is no policy that evicts
+// only keys with a TTL: a node whose keys have none would stay over the
+// bound for good, so ttl falls back to lru.
+//
+// Eviction is local. An evicted key is removed from this node's map and
+// WAL (an EVICT entry, so replay drops it too) — not deleted: other
+// replicas keep their copies, and read repair or anti-entropy may bring
+// it back, where it counts as recently used again. Delta snapshots write
+// an evicted key as null. The locks namespace is never evicted: leases
+// must not vanish under their holders.
+//
+// LRU is approximated the way Redis does it: each round samples a few
+// keys from random shards and evicts the ones read or written longest
+// ago (ttl: expiring soonest). It costs a last-access time per key while
+// lru or ttl is on, and nothing while they are off.
+
+// Eviction policies.
+const (
+	EvictReject = "reject"
+	EvictLRU    = "lru"
+	EvictTTL    = "ttl"
+)
+
+// ErrMemoryFull is returned for writes refused by the reject policy.
+var ErrMemoryFull = errors.New("memory limit reached")
+
+// errNothingToEvict stops an eviction pass that found no candidates.
+var errNothingToEvict = errors.New("no evictable keys")
+
+const (
+	entryOverhead     = 128 // map slot, Value struct and headers, roughly
+	evictSampleShards = 16  // shards sampled per eviction round
+	evictSamplePerSh  = 5   // keys sampled per shard
+	evictPerRound     = 16  // most keys evicted per round (one WAL entry)
+)
+
+// MemoryConfig bounds the memory the data may use.
+type MemoryConfig struct {
+	MaxBytes int64  // 0 = unbounded
+	Policy   string // EvictReject, EvictLRU or EvictTTL
+}
+
+// DefaultMemoryConfig is used unless SetMemory is called: unbounded.
+var DefaultMemoryConfig = MemoryConfig{Policy: EvictReject}
+
+// Validate checks that c is usable.
+func (c MemoryConfig) Validate() error {
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("%w: max memory must not be negative", ErrInvalidConfig)
+	}
+	if c.Policy != EvictReject && !c.evicts() {
+		return fmt.Errorf("%w: eviction policy must be %s, %s or %s, not %q", ErrInvalidConfig, EvictReject, EvictLRU, EvictTTL, c.Policy)
+	}
+	return nil
+}
+
+// evicts reports whether c's policy evicts keys (rather than refusing
+// writes) at the bound.
+func (c MemoryConfig) evicts() bool {
+	return c.Policy == EvictLRU || c.Policy == EvictTTL
+}
+
+// ParseMemorySize parses a --max-memory value, as snapshot policy sizes
+// are written (512MiB, 2G, or plain bytes).
+func ParseMemorySize(v string) (int64, error) {
+	n, err := parseSize(v)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("invalid size %q", v)
+	}
+	return n, err
+}
+
+// MemoryStats describes the data's memory use on one node.
+type MemoryStats struct {
+	Bytes     int64  `json:"memory_bytes"`               // estimated, see memory.go
+	MaxBytes  int64  `json:"max_memory_bytes,omitempty"` // 0 = unbounded
+	Policy    string `json:"eviction_policy,omitempty"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// memory is the store's accounting and evictor.
+type memory struct {
+	bytes     atomic.Int64
+	evictions atomic.Uint64
+	cfg       atomic.Pointer[MemoryConfig]
+	lru       atomic.Bool // track access times
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	wake      chan struct{} // buffered 1: a write went over the bound
+	stop      chan struct{}
+}
+
+// SetMemory bounds the data's memory. Call it after New, before serving:
+// with lru it records an access time for every key loaded so far.
+func (s *Store) SetMemory(cfg MemoryConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s.mem.cfg.Store(&cfg)
+	if cfg.MaxBytes == 0 || !cfg.evicts() {
+		return nil
+	}
+
+	if !s.mem.lru.Swap(true) {
+		now := time.Now().UnixNano()
+		for _, sh := range s.shards {
+			sh.mu.Lock()
+			for k := range sh.data {
+				sh.touch(k, now)
+			}
+			sh.mu.Unlock()
+		}
+	}
+	s.mem.startOnce.Do(func() { go s.evictor() })
+	s.mem.signal()
+	return nil
+}
+
+// MemoryStats returns the memory use and eviction counters.
+func (s *Store) MemoryStats() MemoryStats {
+	cfg := s.mem.cfg.Load()
+	st := MemoryStats{Bytes: s.mem.bytes.Load(), Evictions: s.mem.evictions.Load()}
+	if cfg.MaxBytes > 0 {
+		st.MaxBytes, st.Policy = cfg.MaxBytes, cfg.Policy
+	}
+	return st
+}
+
+// RegisterMetrics adds the memory estimate, eviction count and free disk
+// space (disk.go) to reg.
+func (s *Store) RegisterMetrics(reg *metrics.Registry) {
+	s.registerDiskMetrics(reg)
+	reg.GaugeFunc("kv_memory_bytes", "Estimated memory used by keys, values and kept versions.",
+		func() float64 { return float64(s.mem.bytes.Load()) })
+	reg.CounterFunc("kv_evictions_total", "Keys evicted to stay under --max-memory.",
+		func() float64 { return float64(s.mem.evictions.Load()) })
+}
+
+// checkMemory refuses a local write that adds data while the reject
+// policy's bound is reached.
+func (s *Store) checkMemory() error {
+	cfg := s.mem.cfg.Load()
+	if cfg.MaxBytes == 0 || cfg.Policy != EvictReject {
+		return nil
+	}
+	if used := s.mem.bytes.Load(); used >= cfg.MaxBytes {
+		return fmt.Errorf("%w: %d bytes used, limit is %s", ErrMemoryFull, used, formatSize(cfg.MaxBytes))
+	}
+	return nil
+}
+
+// footprint estimates what key costs: its value and kept versions.
+// Caller holds sh.mu.
+func (sh *shard) footprint(key string) int64 {
+	v, ok := sh.data[key]
+	if !ok {
+		return 0
+	}
+	n := valueFootprint(key, v)
+	for _, old := range sh.history[key] {
+		n += valueFootprint("", old)
+	}
+	return n
+}
+
+func valueFootprint(key string, v Value) int64 {
+	n := entryOverhead + len(key) + v.Size() + len(v.ContentType) + len(v.Encoding)
+	for node := range v.Clock {
+		n += len(node) + 8
+	}
+	return int64(n)
+}
+
+// account records that key's footprint changed from before. Caller
+// holds sh.mu.
+func (s *Store) account(sh *shard, key string, before int64) {
+	delta := sh.footprint(key) - before
+	if delta == 0 {
+		return
+	}
+	ns, _ := SplitKey(key)
+	s.counts.addBytes(ns, delta)
+	used := s.mem.bytes.Add(delta)
+	if cfg := s.mem.cfg.Load(); delta > 0 && cfg.MaxBytes > 0 && used > cfg.MaxBytes && cfg.evicts() {
+		s.mem.signal()
+	}
+}
+
+// touch records an access to key, giving it a slot if it has none.
+// Caller holds sh.mu for writing.
+func (sh *shard) touch(key string, now int64) {
+	if t, ok := sh.access[key]; ok {
+		t.Store(now)
+		return
+	}
+	t := new(atomic.Int64)
+	t.Store(now)
+	sh.access[key] = t
+}
+
+// accessed records a read of key. The slot already exists (set made it),
+// so a read lock on sh is enough.
+func (s *Store) accessed(sh *shard, key string) {
+	if !s.mem.lru.Load() {
+		return
+	}
+	if t, ok := sh.access[key]; ok {
+		t.Store(time.Now().UnixNano())
+	}
+}
+
+// remove drops key from the map and its history, as eviction does, and
+// tells the watchers. It is the only way out of the map; like set, it
+// keeps the counters right. Caller holds sh.mu.
+func (s *Store) remove(sh *shard, key string) {
+	v, ok := sh.data[key]
+	if !ok {
+		return
+	}
+	before := sh.footprint(key)
+	ns, _ := SplitKey(key)
+	if !v.Tombstone {
+		s.counts.add(ns, -1)
+	}
+	delete(sh.data, key)
+	delete(sh.history, key)
+	delete(sh.access, key)
+	sh.dirty[key] = struct{}{} // a delta snapshot records it as gone
+	s.counts.addBytes(ns, -before)
+	s.mem.bytes.Add(-before)
+	s.watchers.publish(Change{Key: key, Value: v, Evicted: true})
+}
+
+func (m *memory) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// evictor evicts keys whenever the data is over the bound, until the
+// store is closed.
+func (s *Store) evictor() {
+	for {
+		select {
+		case <-s.mem.stop:
+			return
+		case <-s.mem.wake:
+		}
+		for {
+			cfg := s.mem.cfg.Load()
+			if cfg.MaxBytes == 0 || !cfg.evicts() || s.mem.bytes.Load() <= cfg.MaxBytes {
+				break
+			}
+			if err := s.evictRound(s.mem.bytes.Load()-cfg.MaxBytes, cfg.Policy); err != nil {
+				if !errors.Is(err, errNothingToEvict) {
+					logging.FromContext(context.Background()).Error("eviction failed", "error", err)
+				}
+				break // wait for the next write
+			}
+		}
+	}
+}
+
+// evictCandidate is one sampled key.
+type evictCandidate struct {
+	key     string
+	access  int64
+	expires int64 // UnixNano; 0 = no TTL
+	size    int64
+}
+
+// evictOrder orders candidates for eviction under policy: least recently
+// used first, and with ttl, keys expiring soonest before all of those.
+func evictOrder(policy string) func(a, b evictCandidate) int {
+	lru := func(a, b evictCandidate) int { return cmp.Compare(a.access, b.access) }
+	if policy != EvictTTL {
+		return lru
+	}
+	return func(a, b evictCandidate) int {
+		switch {
+		case a.expires == 0 && b.expires == 0:
+			return lru(a, b)
+		case a.expires == 0:
+			return 1
+		case b.expires == 0:
+			return -1
+		}
+		return cmp.Or(cmp.Compare(a.expires, b.expires), lru(a, b))
+	}
+}
+
+// evictRound samples keys and evicts the first of them in policy's
+// order, enough to free need bytes if the sample allows (at most
+// evictPerRound).
+func (s *Store) evictRound(need int64, policy string) error {
+	var cands []evictCandidate
+	start := rand.IntN(numShards)
+	for i := range evictSampleShards {
+		sh := s.shards[(start+i)%numShards]
+		sh.mu.RLock()
+		taken := 0
+		for k, t := range sh.access { // map order is random: a fair sample
+			if taken == evictSamplePerSh {
+				break
+			}
+			if strings.HasPrefix(k, LocksNamespace+"/") {
+				continue
+			}
+			c := evictCandidate{key: k, access: t.Load(), size: sh.footprint(k)}
+			if exp := sh.data[k].ExpiresAt; !exp.IsZero() {
+				c.expires = exp.UnixNano()
+			}
+			cands = append(cands, c)
+			taken++
+		}
+		sh.mu.RUnlock()
+	}
+	if len(cands) == 0 {
+		return errNothingToEvict
+	}
+	slices.SortFunc(cands, evictOrder(policy))
+
+	var freed int64
+	n := 0
+	for n < len(cands) && n < evictPerRound && freed < need {
+		freed += cands[n].size
+		n++
+	}
+	cands = cands[:n]
+
+	keys := make([]string, len(cands))
+	for i, c := range cands {
+		keys[i] = c.key
+	}
+	unlock := s.lockShardsOf(keys)
+	defer unlock()
+
+	// Keys read or written since they were sampled are no longer the
+	// coldest (and may have a new TTL): leave them.
+	batch := walEntry{Op: opBatch}
+	for _, c := range cands {
+		if t, ok := s.shardFor(c.key).access[c.key]; ok && t.Load() == c.access {
+			batch.Batch = append(batch.Batch, walEntry{Op: opEvict, Key: c.key})
+		}
+	}
+	if len(batch.Batch) == 0 {
+		return nil // all of them were used meanwhile: sample again
+	}
+	if err := s.wal.append(batch); err != nil {
+		return fmt.Errorf("wal append: %w", err)
+	}
+	for _, e := range batch.Batch {
+		s.remove(s.shardFor(e.Key), e.Key)
+	}
+	s.mem.evictions.Add(uint64(len(batch.Batch)))
+	return nil
+}
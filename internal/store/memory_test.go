@@ -0,0 +1,44 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEvictOrder(t *testing.T) {
+	cands := []evictCandidate{
+		{key: "hot-forever", access: 40},
+		{key: "cold-forever", access: 10},
+		{key: "late-ttl", access: 5, expires: 900},
+		{key: "soon-ttl", access: 30, expires: 100},
+		{key: "soon-ttl-colder", access: 20, expires: 100},
+	}
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{EvictLRU, []string{"late-ttl", "cold-forever", "soon-ttl-colder", "soon-ttl", "hot-forever"}},
+		{EvictTTL, []string{"soon-ttl-colder", "soon-ttl", "late-ttl", "cold-forever", "hot-forever"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			sorted := slices.Clone(cands)
+			slices.SortFunc(sorted, evictOrder(tt.policy))
+			var got []string
+			for _, c := range sorted {
+				got = append(got, c.key)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryConfigPolicies(t *testing.T) {
+	for policy, ok := range map[string]bool{EvictReject: true, EvictLRU: true, EvictTTL: true, "volatile": false} {
+		if err := (MemoryConfig{MaxBytes: 1 << 20, Policy: policy}).Validate(); (err == nil) != ok {
+			t.Errorf("policy %q: Validate() = %v", policy, err)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Namespaces (a.k.a. buckets) let several applications share one cluster
+// without stepping on each other's keys.
+//
+// How it works:
+//
+// Internally the store still has ONE flat map.
+// We simply prefix every key with its namespace:
+//
+//	namespace "app1", key "user:42"  →  "app1/user:42"
+//
+// That prefix is what lands in the WAL and snapshot, and what the ring
+// hashes, so namespaces are isolated everywhere without a second code path.
+//
+// Namespace names cannot contain "/", so splitting on the FIRST "/"
+// always recovers (namespace, key).
+//
+// Each namespace also has a small config (quotas, compression, and
+// defaults for the writes and reads made to it) stored in namespaces.json.
+//
+// Quotas are per node: max_keys and max_bytes bound what this node holds
+// of the namespace, and rate_limit the requests it coordinates for it.
+// A node over a quota refuses local writes that would add to it (507) or
+// requests beyond the rate (429); deletes always go through.
+
+// DefaultNamespace always exists and cannot be deleted.
+// Keys written before namespaces existed are migrated into it.
+const DefaultNamespace = "default"
+
+// LocksNamespace holds the cluster's leases (see cluster/locks.go). It
+// always exists, and its name fails ValidNamespace, so the KV and
+// namespace APIs cannot touch it.
+const LocksNamespace = "_locks"
+
+const namespaceSep = "/"
+
+var (
+	// ErrNamespaceNotFound is returned when writing to an unknown namespace.
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	// ErrNamespaceNotEmpty is returned when deleting a namespace that still has keys.
+	ErrNamespaceNotEmpty = errors.New("namespace is not empty")
+	// ErrInvalidNamespace is returned for names that fail validation.
+	ErrInvalidNamespace = errors.New("invalid namespace name: use 1-63 chars of [a-z0-9_-]")
+	// ErrQuotaExceeded is returned when a write would exceed a namespace quota.
+	ErrQuotaExceeded = errors.New("namespace quota exceeded")
+	// ErrInvalidConfig is returned when a namespace config is rejected.
+	ErrInvalidConfig = errors.New("invalid namespace config")
+)
+
+// Replication modes for Namespace.Replication.
+const (
+	ReplicationSync  = "sync"  // acknowledge after W replicas (default)
+	ReplicationAsync = "async" // acknowledge after the local write
+)
+
+var namespaceRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Namespace is the configuration of one namespace.
+type Namespace struct {
+	Name     string `json:"name"`
+	MaxKeys  int    `json:"max_keys,omitempty"`  // 0 = unlimited
+	MaxBytes int64  `json:"max_bytes,omitempty"` // estimated as in memory.go; 0 = unlimited
+	// RateLimit is the requests/sec each node coordinates for the
+	// namespace (enforced in the API); 0 = unlimited.
+	RateLimit float64 `json:"rate_limit,omitempty"`
+	// Compression overrides the node-wide codec for this namespace:
+	// "" = use node default, "none" = never compress, "zstd"/"snappy".
+	Compression string `json:"compression,omitempty"`
+	// Replication is the default write mode: "" or "sync", or "async".
+	Replication string `json:"replication,omitempty"`
+	// Versions is how many replaced values each key keeps (see versions.go).
+	Versions int `json:"versions,omitempty"`
+	// TTLSeconds is how long written values live (see ttl.go); 0 = forever.
+	TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+	// ReadPolicy is the default read routing, "ring" or "nearest" (see
+	// cluster/nearest.go); "" = the node's --read-policy.
+	ReadPolicy string `json:"read_policy,omitempty"`
+	// Tiebreak and DeleteConflicts settle concurrent writes to the
+	// namespace (see tiebreak.go); "" = the node's rules.
+	Tiebreak        string    `json:"tiebreak,omitempty"`
+	DeleteConflicts string    `json:"delete_conflicts,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// NamespaceInfo is a Namespace plus its current usage on this node.
+type NamespaceInfo struct {
+	Namespace
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// ValidNamespace reports whether name is a legal namespace name.
+func ValidNamespace(name string) bool {
+	return namespaceRe.MatchString(name)
+}
+
+// ValidReplication reports whether mode is a replication mode ("" = sync).
+func ValidReplication(mode string) bool {
+	return mode == "" || mode == ReplicationSync || mode == ReplicationAsync
+}
+
+// NamespacedKey builds the internal key for (namespace, key).
+func NamespacedKey(namespace, key string) string {
+	return namespace + namespaceSep + key
+}
+
+// SplitKey is the inverse of NamespacedKey.
+//
+// Keys without a prefix (written before namespaces existed)
+// belong to DefaultNamespace.
+func SplitKey(internal string) (namespace, key string) {
+	ns, k, ok := strings.Cut(internal, namespaceSep)
+	if !ok {
+		return DefaultNamespace, internal
+	}
+	return ns, k
+}
+
+// ─── Public API ───────────────────────────────────────────────────────────────
+
+// PutNamespace creates a namespace or updates its config.
+//
+// It is idempotent, so the same call can be broadcast to every node.
+func (s *Store) PutNamespace(ns Namespace) (Namespace, error) {
+	if !ValidNamespace(ns.Name) {
+		return Namespace{}, ErrInvalidNamespace
+	}
+	if ns.MaxKeys < 0 {
+		return Namespace{}, fmt.Errorf("%w: max_keys must be >= 0", ErrInvalidConfig)
+	}
+	if ns.MaxBytes < 0 {
+		return Namespace{}, fmt.Errorf("%w: max_bytes must be >= 0", ErrInvalidConfig)
+	}
+	if ns.RateLimit < 0 {
+		return Namespace{}, fmt.Errorf("%w: rate_limit must be >= 0", ErrInvalidConfig)
+	}
+	if !validValueCodec(ns.Compression) && ns.Compression != CompressionOff {
+		return Namespace{}, fmt.Errorf("%w: unknown compression %q", ErrInvalidConfig, ns.Compression)
+	}
+	if !ValidReplication(ns.Replication) {
+		return Namespace{}, fmt.Errorf("%w: replication must be %q or %q", ErrInvalidConfig, ReplicationSync, ReplicationAsync)
+	}
+	if ns.Versions < 0 || ns.Versions > MaxVersions {
+		return Namespace{}, fmt.Errorf("%w: versions must be 0-%d", ErrInvalidConfig, MaxVersions)
+	}
+	if ns.TTLSeconds < 0 || ns.TTLSeconds > int64(MaxTTL/time.Second) {
+		return Namespace{}, fmt.Errorf("%w: ttl_seconds must be 0-%d", ErrInvalidConfig, int64(MaxTTL/time.Second))
+	}
+	if ns.Tiebreak != "" && ns.Tiebreak != TiebreakTime && ns.Tiebreak != TiebreakNodeID {
+		return Namespace{}, fmt.Errorf("%w: tiebreak must be %q or %q", ErrInvalidConfig, TiebreakTime, TiebreakNodeID)
+	}
+	if ns.DeleteConflicts != "" && !slices.Contains(deletePolicies, ns.DeleteConflicts) {
+		return Namespace{}, fmt.Errorf("%w: delete_conflicts must be one of %s", ErrInvalidConfig, strings.Join(deletePolicies, ", "))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.namespaces[ns.Name]; ok {
+		ns.CreatedAt = existing.CreatedAt // keep original creation time
+	} else if ns.CreatedAt.IsZero() {
+		ns.CreatedAt = time.Now().UTC()
+	}
+
+	s.namespaces[ns.Name] = ns
+	s.refreshRetention()
+	s.refreshConflictRules()
+	if err := s.saveNamespaces(); err != nil {
+		return Namespace{}, err
+	}
+	return ns, nil
+}
+
+// DeleteNamespace removes a namespace.
+//
+// Only empty namespaces can be deleted: silently dropping every key
+// in a namespace is too dangerous for a single call.
+func (s *Store) DeleteNamespace(name string) error {
+	if name == DefaultNamespace || name == LocksNamespace {
+		return fmt.Errorf("%w: cannot delete the %q namespace", ErrInvalidConfig, name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.namespaces[name]; !ok {
+		return ErrNamespaceNotFound
+	}
+	if s.counts.get(name) > 0 {
+		return ErrNamespaceNotEmpty
+	}
+
+	delete(s.namespaces, name)
+	s.refreshRetention()
+	s.refreshConflictRules()
+	return s.saveNamespaces()
+}
+
+// GetNamespace returns one namespace with its usage.
+func (s *Store) GetNamespace(name string) (NamespaceInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ns, ok := s.namespaces[name]
+	if !ok {
+		return NamespaceInfo{}, false
+	}
+	return NamespaceInfo{Namespace: ns, Keys: s.counts.get(name), Bytes: s.counts.getBytes(name)}, true
+}
+
+// Namespaces returns every namespace sorted by name.
+func (s *Store) Namespaces() []NamespaceInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]NamespaceInfo, 0, len(s.namespaces))
+	for name, ns := range s.namespaces {
+		out = append(out, NamespaceInfo{Namespace: ns, Keys: s.counts.get(name), Bytes: s.counts.getBytes(name)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// ─── Internal helpers ─────────────────────────────────────────────────────────
+
+// reserveKey verifies that writing key would not exceed its namespace
+// limits, and holds a slot in the quota until the returned func is called.
+//
+// Writes to different shards run in parallel, so checking the count and
+// counting the key later would let two writers both take the last slot.
+// Caller must hold sh.mu (the shard of key) and s.mu.
+func (s *Store) reserveKey(sh *shard, key string) (release func(), err error) {
+	nsName, _ := SplitKey(key)
+	ns, ok := s.namespaces[nsName]
+	if !ok {
+		return nil, ErrNamespaceNotFound
+	}
+
+	// Overwriting a live key does not change the key count.
+	if existing, ok := sh.data[key]; ns.MaxKeys == 0 || (ok && !existing.Tombstone) {
+		return func() {}, nil
+	}
+	if !s.counts.reserve(nsName, ns.MaxKeys) {
+		return nil, fmt.Errorf("%w: %q allows %d keys", ErrQuotaExceeded, nsName, ns.MaxKeys)
+	}
+	return func() { s.counts.add(nsName, -1) }, nil
+}
+
+// reserveBytes verifies that storing v under key would keep its
+// namespace within max_bytes, and holds the growth in the quota until
+// the returned func is called, as reserveKey does for the key count.
+// Only the new value against the one it replaces is checked; replaced
+// versions kept in history (versions.go) count toward usage but are
+// not reserved. Caller must hold sh.mu and s.mu.
+func (s *Store) reserveBytes(sh *shard, key string, v Value) (release func(), err error) {
+	nsName, _ := SplitKey(key)
+	ns := s.namespaces[nsName]
+	grow := valueFootprint(key, v)
+	if old, ok := sh.data[key]; ok {
+		grow -= valueFootprint(key, old)
+	}
+	if ns.MaxBytes == 0 || grow <= 0 {
+		return func() {}, nil
+	}
+	if !s.counts.reserveBytes(nsName, grow, ns.MaxBytes) {
+		return nil, fmt.Errorf("%w: %q allows %s", ErrQuotaExceeded, nsName, formatSize(ns.MaxBytes))
+	}
+	return func() { s.counts.addBytes(nsName, -grow) }, nil
+}
+
+// set stores v under key, keeps per-namespace counters and the memory
+// estimate up to date, records the value it replaces in the key's
+// history (versions.go), marks key for the next delta snapshot and
+// tells the watchers.
+//
+// EVERY mutation of a shard's data must go through here,
+// otherwise the counters drift. Caller must hold sh.mu.
+func (s *Store) set(sh *shard, key string, v Value) {
+	nsName, _ := SplitKey(key)
+	before := sh.footprint(key)
+
+	delta := 0
+	if old, ok := sh.data[key]; ok {
+		if !old.Tombstone {
+			delta--
+		}
+		s.keepVersion(sh, key, old, v)
+	}
+	if !v.Tombstone {
+		delta++
+	}
+	if delta != 0 {
+		s.counts.add(nsName, delta)
+	}
+	sh.data[key] = v
+	sh.dirty[key] = struct{}{}
+	s.hlc.observe(v.Timestamp())
+	if s.mem.lru.Load() {
+		sh.touch(key, time.Now().UnixNano())
+	}
+	s.account(sh, key, before)
+	s.watchers.publish(Change{Key: key, Value: v})
+}
+
+// loadNamespaces reads namespaces.json (if present)
+// and makes sure the default and locks namespaces exist.
+func (s *Store) loadNamespaces() error {
+	s.namespaces = make(map[string]Namespace)
+
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "namespaces.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var list []Namespace
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+		for _, ns := range list {
+			s.namespaces[ns.Name] = ns
+		}
+	}
+
+	for _, name := range []string{DefaultNamespace, LocksNamespace} {
+		if _, ok := s.namespaces[name]; !ok {
+			s.namespaces[name] = Namespace{Name: name, CreatedAt: time.Now().UTC()}
+		}
+	}
+	s.refreshRetention()
+	s.refreshConflictRules()
+	return nil
+}
+
+// saveNamespaces writes namespaces.json atomically (tmp + rename).
+// Caller must hold s.mu.
+func (s *Store) saveNamespaces() error {
+	list := make([]Namespace, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		list = append(list, ns)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dataDir, "namespaces.json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// ─── Recovery progress ────────────────────────────────────────────────────────
+//
+// New rebuilds memory from the snapshot chain and the WAL before it
+// returns, which for a big data directory takes minutes. A Recovery
+// passed to NewWithRecovery is updated as it goes, so the caller can log
+// progress and answer probes meanwhile:
+//
+//	phase     snapshot → wal → done
+//	bytes     read so far, of every snapshot file and WAL segment to load
+//	records   snapshot records and WAL entries applied
+//
+// The remaining time is estimated from the read rate so far.
+
+// Recovery phases.
+const (
+	RecoverySnapshot = "snapshot"
+	RecoveryWAL      = "wal"
+	RecoveryDone     = "done"
+)
+
+// Recovery tracks the progress of loading a store. The zero value is
+// ready to use; a nil *Recovery tracks nothing.
+type Recovery struct {
+	started      time.Time
+	phase        atomic.Pointer[string]
+	file         atomic.Pointer[string]
+	bytesTotal   atomic.Int64
+	bytesDone    atomic.Int64
+	snapshotKeys atomic.Int64
+	walEntries   atomic.Int64
+	finished     atomic.Int64 // unix nanos
+}
+
+// RecoveryStatus is a point-in-time view of a Recovery.
+type RecoveryStatus struct {
+	Phase        string `json:"phase"`
+	File         string `json:"file,omitempty"` // being read
+	BytesDone    int64  `json:"bytes_done"`
+	BytesTotal   int64  `json:"bytes_total"`
+	SnapshotKeys int64  `json:"snapshot_keys"`
+	WALEntries   int64  `json:"wal_entries"`
+	ElapsedMs    int64  `json:"elapsed_ms"`
+	RemainingMs  int64  `json:"remaining_ms,omitempty"` // estimate; 0 = unknown or done
+}
+
+// Status returns where r is.
+func (r *Recovery) Status() RecoveryStatus {
+	st := RecoveryStatus{
+		Phase:        RecoverySnapshot,
+		BytesDone:    r.bytesDone.Load(),
+		BytesTotal:   r.bytesTotal.Load(),
+		SnapshotKeys: r.snapshotKeys.Load(),
+		WALEntries:   r.walEntries.Load(),
+	}
+	if p := r.phase.Load(); p != nil {
+		st.Phase = *p
+	}
+	if f := r.file.Load(); f != nil {
+		st.File = *f
+	}
+	end := time.Now()
+	if ns := r.finished.Load(); ns != 0 {
+		end = time.Unix(0, ns)
+	}
+	elapsed := end.Sub(r.started)
+	st.ElapsedMs = elapsed.Milliseconds()
+	if st.Phase != RecoveryDone && st.BytesDone > 0 && st.BytesTotal > st.BytesDone {
+		rate := float64(st.BytesDone) / elapsed.Seconds()
+		st.RemainingMs = int64(float64(st.BytesTotal-st.BytesDone) / rate * 1000)
+	}
+	return st
+}
+
+func (r *Recovery) start(total int64) {
+	if r == nil {
+		return
+	}
+	r.started = time.Now()
+	r.bytesTotal.Store(total)
+}
+
+func (r *Recovery) enter(phase, file string) {
+	if r == nil {
+		return
+	}
+	r.phase.Store(&phase)
+	r.file.Store(&file)
+}
+
+func (r *Recovery) finish() {
+	if r == nil {
+		return
+	}
+	r.enter(RecoveryDone, "")
+	r.finished.Store(time.Now().UnixNano())
+}
+
+func (r *Recovery) appliedKeys(n int) {
+	if r != nil {
+		r.snapshotKeys.Add(int64(n))
+	}
+}
+
+func (r *Recovery) appliedEntries(n int) {
+	if r != nil {
+		r.walEntries.Add(int64(n))
+	}
+}
+
+// reader counts what is read from rd toward r's bytes.
+func (r *Recovery) reader(rd io.Reader) io.Reader {
+	if r == nil {
+		return rd
+	}
+	return &countingReader{r: rd, n: &r.bytesDone}
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// recoveryBytes sums the files New will read from dataDir.
+func recoveryBytes(dataDir, walPath string) int64 {
+	var total int64
+	size := func(path string) {
+		if fi, err := os.Stat(path); err == nil {
+			total += fi.Size()
+		}
+	}
+	if files, err := listChain(dataDir); err == nil {
+		base := 0
+		for i, f := range files {
+			if f.full {
+				base = i
+			}
+		}
+		for _, f := range files[min(base, len(files)):] {
+			size(f.path)
+		}
+	}
+	if segs, err := sealedSegments(walPath); err == nil {
+		for _, seg := range segs {
+			size(seg.path)
+		}
+	}
+	size(walPath)
+	return total
+}
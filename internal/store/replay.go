@@ -0,0 +1,229 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ─── Parallel recovery ────────────────────────────────────────────────────────
+//
+// Loading a store is CPU bound: the time goes to decoding JSON and to set.
+// Both are spread over the cores:
+//
+//	snapshot  reader ──(key, raw record)──► appliers: decode + set
+//	WAL       reader ──lines──► decoders ──entries, in file order──► appliers: set
+//
+// Appliers split the shards between them: shard i belongs to applier
+// i % n, so two appliers never touch the same key, and each applies its
+// ops in the order it was handed them. Per-key order is therefore that
+// of the files, however the work interleaves across keys. Everything
+// else set touches (counters, memory, HLC, watchers) is already safe for
+// concurrent writers.
+//
+// WAL lines carry batches that span shards, so they are decoded in
+// chunks by a pool and put back in file order before their ops are
+// handed out. Snapshot records are one key each and need no reordering;
+// the applier that owns the key decodes it.
+//
+// With GOMAXPROCS=1 everything runs inline, as before.
+
+// replayChunk is how many lines or ops are handed on at once.
+const replayChunk = 512
+
+// recoveryWorkers is how many decoders and appliers recovery runs.
+func recoveryWorkers() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// replayOp is one record to apply.
+type replayOp struct {
+	key      string // namespaced
+	evict    bool
+	value    Value
+	snapshot bool            // a snapshot record, counted in rec's keys
+	raw      json.RawMessage // snapshot record left for the applier to decode
+}
+
+// record sets op from a decoded snapshot record: nil is a key evicted
+// (delta only).
+func (op *replayOp) record(v *Value) {
+	if v == nil {
+		op.evict = true
+	} else {
+		op.value = *v
+	}
+}
+
+// applier applies ops to the shards, each shard from one goroutine.
+type applier struct {
+	s       *Store
+	rec     *Recovery
+	queues  []chan []replayOp // nil when inline
+	pending [][]replayOp
+	wg      sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+}
+
+func (s *Store) newApplier(rec *Recovery) *applier {
+	a := &applier{s: s, rec: rec}
+	n := recoveryWorkers()
+	if n == 1 {
+		return a
+	}
+	a.queues = make([]chan []replayOp, n)
+	a.pending = make([][]replayOp, n)
+	for i := range a.queues {
+		a.queues[i] = make(chan []replayOp, 4)
+		a.wg.Add(1)
+		go func(q chan []replayOp) {
+			defer a.wg.Done()
+			for ops := range q {
+				a.apply(ops)
+			}
+		}(a.queues[i])
+	}
+	return a
+}
+
+// inline reports whether ops are applied as they are added.
+func (a *applier) inline() bool {
+	return a.queues == nil
+}
+
+// add hands op to the applier owning its key.
+func (a *applier) add(op replayOp) {
+	if a.inline() {
+		a.apply([]replayOp{op})
+		return
+	}
+	i := shardIndex(op.key) % len(a.queues)
+	a.pending[i] = append(a.pending[i], op)
+	if len(a.pending[i]) == replayChunk {
+		a.queues[i] <- a.pending[i]
+		a.pending[i] = make([]replayOp, 0, replayChunk)
+	}
+}
+
+// wait applies what is pending, stops the appliers and returns the first
+// record that failed to decode.
+func (a *applier) wait() error {
+	for i, q := range a.queues {
+		if len(a.pending[i]) > 0 {
+			q <- a.pending[i]
+		}
+		close(q)
+	}
+	a.wg.Wait()
+	return a.err
+}
+
+func (a *applier) apply(ops []replayOp) {
+	keys := 0
+	for _, op := range ops {
+		sh := a.s.shardFor(op.key)
+		if op.raw != nil {
+			var v *Value
+			if err := json.Unmarshal(op.raw, &v); err != nil {
+				a.errOnce.Do(func() { a.err = err })
+				continue
+			}
+			op.record(v)
+		}
+		if op.snapshot {
+			keys++
+		}
+		if op.evict {
+			a.s.remove(sh, op.key)
+			continue
+		}
+		a.s.set(sh, op.key, op.value)
+	}
+	a.rec.appliedKeys(keys)
+}
+
+// decodeEntries parses the WAL lines in r and hands the entries to fn in
+// the order they were written. Lines that fail to parse are skipped.
+func decodeEntries(r io.Reader, fn func(walEntry)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxEntrySize)
+
+	n := recoveryWorkers()
+	if n == 1 {
+		for scanner.Scan() {
+			if e, ok := parseLine(scanner.Bytes()); ok {
+				fn(e)
+			}
+		}
+		return scanner.Err()
+	}
+
+	type chunk struct {
+		lines [][]byte
+		out   chan []walEntry
+	}
+	jobs := make(chan *chunk)
+	order := make(chan *chunk, 2*n) // bounds the chunks in flight
+	for range n {
+		go func() {
+			for c := range jobs {
+				entries := make([]walEntry, 0, len(c.lines))
+				for _, line := range c.lines {
+					if e, ok := parseLine(line); ok {
+						entries = append(entries, e)
+					}
+				}
+				c.out <- entries
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for c := range order {
+			for _, e := range <-c.out {
+				fn(e)
+			}
+		}
+	}()
+
+	cur := &chunk{out: make(chan []walEntry, 1)}
+	flush := func() {
+		order <- cur
+		jobs <- cur
+		cur = &chunk{out: make(chan []walEntry, 1)}
+	}
+	for scanner.Scan() {
+		cur.lines = append(cur.lines, append([]byte(nil), scanner.Bytes()...))
+		if len(cur.lines) == replayChunk {
+			flush()
+		}
+	}
+	if len(cur.lines) > 0 {
+		flush()
+	}
+	close(jobs)
+	close(order)
+	<-done
+	return scanner.Err()
+}
+
+// parseLine parses one WAL line, reporting false for blank and corrupt
+// ones.
+func parseLine(line []byte) (walEntry, bool) {
+	if len(line) == 0 {
+		return walEntry{}, false
+	}
+	e, _, err := parseEntry(line)
+	if err != nil {
+		// If one line is corrupted, we skip it.
+		// In a real production system, we would likely stop
+		// and raise an alert instead of silently skipping.
+		return walEntry{}, false
+	}
+	return e, true
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Sharded locking
+//
+// One RWMutex over the whole map means every write waits for every
+// other write — including its WAL fsync. With many clients writing
+// different keys, the node spends its time queueing on that lock.
+//
+// So the map is split into numShards shards by a hash of the key.
+// Each shard has its own lock:
+//
+//	"app/user:1" → fnv32 % 256 = 17  → shards[17].mu
+//	"app/user:2" → fnv32 % 256 = 203 → shards[203].mu
+//
+// Writes to different shards run (and fsync) in parallel; writes to
+// the SAME key still serialize, so WAL order per key is preserved.
+//
+// What else is shared, and who guards it:
+//
+//   - s.mu:     namespace configs, compression and limits (rarely written)
+//   - s.counts: live keys and bytes per namespace (own mutex, held for nanoseconds)
+//
+// Put and Delete hold s.mu's read lock until they finish, so creating or
+// deleting a namespace waits for in-flight writes instead of racing them.
+//
+// Lock order is always shard → s.mu → s.counts. Whole-store reads that
+// must be consistent (backups) lock every shard in index order; writes
+// that span shards (transactions) lock theirs in index order too.
+
+const numShards = 256
+
+// shard is one slice of the key space.
+type shard struct {
+	mu    sync.RWMutex
+	data  map[string]Value
+	dirty map[string]struct{} // keys written since the last snapshot
+
+	history map[string][]Value       // replaced versions, newest first (see versions.go)
+	access  map[string]*atomic.Int64 // last read or write, UnixNano; only with lru or ttl eviction (see memory.go)
+}
+
+func newShards() [numShards]*shard {
+	var shards [numShards]*shard
+	for i := range shards {
+		shards[i] = &shard{
+			data:    make(map[string]Value),
+			dirty:   make(map[string]struct{}),
+			history: make(map[string][]Value),
+			access:  make(map[string]*atomic.Int64),
+		}
+	}
+	return shards
+}
+
+// shardFor returns the shard owning key.
+func (s *Store) shardFor(key string) *shard {
+	return s.shards[shardIndex(key)]
+}
+
+// shardIndex hashes key to its shard (FNV-1a, no allocation).
+func shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % numShards)
+}
+
+// lockShardsOf write-locks the shards of keys in index order — the
+// order every multi-shard writer uses, so two of them cannot deadlock —
+// and returns the unlock.
+func (s *Store) lockShardsOf(keys []string) (unlock func()) {
+	idx := make([]int, 0, len(keys))
+	for _, k := range keys {
+		idx = append(idx, shardIndex(k))
+	}
+	slices.Sort(idx)
+	idx = slices.Compact(idx)
+	for _, i := range idx {
+		s.shards[i].mu.Lock()
+	}
+	return func() {
+		for _, i := range idx {
+			s.shards[i].mu.Unlock()
+		}
+	}
+}
+
+// rlockAll read-locks every shard, for a point-in-time view.
+func (s *Store) rlockAll() {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+	}
+}
+
+func (s *Store) runlockAll() {
+	for _, sh := range s.shards {
+		sh.mu.RUnlock()
+	}
+}
+
+// len returns the number of records (tombstones included).
+// Caller must hold every shard lock, or accept an approximate answer.
+func (s *Store) len() int {
+	n := 0
+	for _, sh := range s.shards {
+		n += len(sh.data)
+	}
+	return n
+}
+
+// keyCounts tracks live (non-tombstone) keys and estimated bytes
+// (memory.go) per namespace.
+type keyCounts struct {
+	mu    sync.Mutex
+	m     map[string]int
+	bytes map[string]int64
+}
+
+func (c *keyCounts) get(ns string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.m[ns]
+}
+
+func (c *keyCounts) add(ns string, delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[ns] += delta
+}
+
+// reserve counts one more key in ns if that stays within max.
+// The caller releases the reservation with add(ns, -1) once the
+// write has either landed (and been counted by set) or failed.
+func (c *keyCounts) reserve(ns string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m[ns] >= max {
+		return false
+	}
+	c.m[ns]++
+	return true
+}
+
+func (c *keyCounts) getBytes(ns string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.bytes[ns]
+}
+
+func (c *keyCounts) addBytes(ns string, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bytes[ns] += delta
+}
+
+// reserveBytes counts n more bytes in ns if that stays within max,
+// released like reserve with addBytes(ns, -n).
+func (c *keyCounts) reserveBytes(ns string, n, max int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.bytes[ns]+n > max {
+		return false
+	}
+	c.bytes[ns] += n
+	return true
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ─── Snapshot chains ─────────────────────────────────────────────────────────
+//
+// A full snapshot rewrites every record, even if only a few changed since
+// the last one. A delta snapshot writes only the records written since
+// the previous snapshot of either kind (every shard tracks its dirty
+// keys). Records are not removed from the map — deletes are tombstones
+// — so a delta is upserts, plus null for a key evicted since (see
+// memory.go).
+//
+// Snapshot files are numbered by the WAL segment they replace:
+//
+//	snapshot-000012.json        full snapshot: the base
+//	snapshot-000015.delta.json  changes from 12 to 15
+//	snapshot-000019.delta.json  changes from 15 to 19
+//	wal.log                     changes since 19
+//
+// Recovery loads the newest base, then its deltas in order, then replays
+// the WAL. Files older than the base are leftovers of a crash between
+// writing a base and cleaning up; they are ignored. snapshot.json (from
+// before chains) counts as base 0.
+//
+// Every delta makes recovery a little longer, so the chain is folded:
+// the next snapshot is a full one once the chain has max-deltas deltas,
+// or once half the records changed (the delta would be about as big).
+// A full snapshot deletes the files before it.
+
+// legacySnapshotFile is the single snapshot file used before chains.
+const legacySnapshotFile = "snapshot.json"
+
+// snapshotChain describes the snapshot files on disk.
+type snapshotChain struct {
+	seq      int  // number of the newest file (0 = none)
+	hasBase  bool // a full snapshot is on disk
+	deltas   int  // deltas on top of it
+	needFull bool // a failed snapshot lost track of the dirty keys
+}
+
+// chainFile is one snapshot file.
+type chainFile struct {
+	seq  int
+	full bool
+	path string
+}
+
+// snapshotFile returns the file name of snapshot seq.
+func snapshotFile(seq int, full bool) string {
+	if full {
+		return fmt.Sprintf("snapshot-%06d.json", seq)
+	}
+	return fmt.Sprintf("snapshot-%06d.delta.json", seq)
+}
+
+// listChain returns the snapshot files in dir, oldest first.
+func listChain(dir string) ([]chainFile, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "snapshot-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var files []chainFile
+	if _, err := os.Stat(filepath.Join(dir, legacySnapshotFile)); err == nil {
+		files = append(files, chainFile{seq: 0, full: true, path: filepath.Join(dir, legacySnapshotFile)})
+	}
+	for _, m := range matches {
+		name, seq := filepath.Base(m), scanSeq(filepath.Base(m))
+		switch name {
+		case snapshotFile(seq, true):
+			files = append(files, chainFile{seq: seq, full: true, path: m})
+		case snapshotFile(seq, false):
+			files = append(files, chainFile{seq: seq, full: false, path: m})
+		}
+	}
+	slices.SortFunc(files, func(a, b chainFile) int { return a.seq - b.seq })
+	return files, nil
+}
+
+// scanSeq returns the number in a snapshot file name (-1 if none).
+func scanSeq(name string) int {
+	var seq int
+	if _, err := fmt.Sscanf(name, "snapshot-%d", &seq); err != nil {
+		return -1
+	}
+	return seq
+}
+
+// SnapshotDelta takes a delta snapshot, or a full one when the chain is
+// due for folding: no base yet, maxDeltas deltas on it already, half the
+// records changed, or a failed snapshot lost track of the changes.
+// maxDeltas 0 means always full. It reports which it took.
+func (s *Store) SnapshotDelta(maxDeltas int) (full bool, err error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	full = !s.chain.hasBase || s.chain.needFull || s.chain.deltas >= maxDeltas
+	if !full {
+		dirty, total := s.dirtyCount()
+		full = dirty*2 >= total
+	}
+	return full, s.snapshot(full)
+}
+
+// dirtyCount returns how many records changed since the last snapshot,
+// and how many there are.
+func (s *Store) dirtyCount() (dirty, total int) {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		dirty += len(sh.dirty)
+		total += len(sh.data)
+		sh.mu.RUnlock()
+	}
+	return dirty, total
+}
+
+// loadSnapshot loads the newest base and its deltas (if any) into memory.
+//
+// If no snapshot exists, this is not an error.
+func (s *Store) loadSnapshot(rec *Recovery) error {
+	files, err := listChain(s.dataDir)
+	if err != nil {
+		return err
+	}
+	base := -1
+	for i, f := range files {
+		if f.full {
+			base = i
+		}
+	}
+	if base < 0 {
+		if len(files) > 0 {
+			return fmt.Errorf("%s has no base snapshot", filepath.Base(files[0].path))
+		}
+		return nil // no snapshot yet — that's fine
+	}
+
+	for _, f := range files[base:] {
+		rec.enter(RecoverySnapshot, filepath.Base(f.path))
+		if err := s.loadSnapshotFile(f.path, rec); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(f.path), err)
+		}
+		if !f.full {
+			s.chain.deltas++
+		}
+		s.chain.seq = f.seq
+		s.setLastSnapshot(f.path)
+	}
+	s.chain.hasBase = true
+
+	// What was loaded is on disk already; only the WAL makes keys dirty.
+	for _, sh := range s.shards {
+		sh.dirty = make(map[string]struct{})
+	}
+	return nil
+}
+
+// loadSnapshotFile applies one snapshot file to memory.
+func (s *Store) loadSnapshotFile(path string, rec *Recovery) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The file is one JSON object; split it a key at a time so progress
+	// tracks what is applied and the whole map is never held at once.
+	// With several appliers, they decode the records (replay.go).
+	dec := json.NewDecoder(rec.reader(f))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("expected an object, got %v", tok)
+	}
+	a := s.newApplier(rec)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			a.wait()
+			return err
+		}
+		op := replayOp{key: NamespacedKey(SplitKey(tok.(string))), snapshot: true} // migrates pre-namespace keys
+		if a.inline() {
+			var v *Value
+			err = dec.Decode(&v)
+			op.record(v)
+		} else {
+			err = dec.Decode(&op.raw)
+		}
+		if err != nil {
+			a.wait()
+			return err
+		}
+		a.add(op)
+	}
+	if err := a.wait(); err != nil {
+		return err
+	}
+	_, err = dec.Token() // closing brace
+	return err
+}
+
+// removeChainBefore deletes the snapshot files older than seq, once a
+// full snapshot seq is on disk.
+func (s *Store) removeChainBefore(seq int) error {
+	files, err := listChain(s.dataDir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.seq >= seq {
+			break
+		}
+		if err := os.Remove(f.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
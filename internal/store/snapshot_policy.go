@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"distributed-kvstore/internal/logging"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ─── Snapshot policy ─────────────────────────────────────────────────────────
+//
+// A snapshot costs a full copy of the data; replaying the WAL on restart
+// costs one step per entry written since the last snapshot. So instead of
+// a fixed timer, snapshots follow the WAL:
+//
+//	wal-bytes    → the WAL has grown to this size
+//	wal-entries  → ... or holds this many entries
+//	max-interval → ... or its oldest entry is this old (a quiet node still
+//	               snapshots now and then)
+//	min-interval → but never sooner than this after the last snapshot
+//	max-deltas   → delta snapshots between two full ones (see
+//	               snapshot_chain.go); 0 = every snapshot is full
+//
+// An empty WAL never triggers a snapshot: an idle node does not rewrite
+// the same data over and over.
+
+// SnapshotPolicy decides when RunSnapshots takes a snapshot.
+// A zero threshold is disabled.
+type SnapshotPolicy struct {
+	WALBytes    int64
+	WALEntries  int
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	MaxDeltas   int
+}
+
+// DefaultSnapshotPolicy is used unless --snapshot-policy says otherwise.
+var DefaultSnapshotPolicy = SnapshotPolicy{
+	WALBytes:    64 << 20,
+	WALEntries:  100_000,
+	MinInterval: 10 * time.Second,
+	MaxInterval: 10 * time.Minute,
+}
+
+// snapshotCheckInterval is how often RunSnapshots looks at the WAL.
+const snapshotCheckInterval = time.Second
+
+// ParseSnapshotPolicy parses "wal-bytes=64MiB,wal-entries=100000,
+// min-interval=10s,max-interval=10m,max-deltas=0". Missing keys keep the
+// DefaultSnapshotPolicy value; 0 disables a threshold.
+func ParseSnapshotPolicy(s string) (SnapshotPolicy, error) {
+	p := DefaultSnapshotPolicy
+	if s == "" {
+		return p, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return p, fmt.Errorf("snapshot policy %q: expected key=value", part)
+		}
+		var err error
+		switch k {
+		case "wal-bytes":
+			p.WALBytes, err = parseSize(v)
+		case "wal-entries":
+			p.WALEntries, err = strconv.Atoi(v)
+		case "min-interval":
+			p.MinInterval, err = time.ParseDuration(v)
+		case "max-interval":
+			p.MaxInterval, err = time.ParseDuration(v)
+		case "max-deltas":
+			p.MaxDeltas, err = strconv.Atoi(v)
+		default:
+			return p, fmt.Errorf("snapshot policy: unknown key %q", k)
+		}
+		if err != nil {
+			return p, fmt.Errorf("snapshot policy %s: %w", k, err)
+		}
+	}
+	if p.WALBytes < 0 || p.WALEntries < 0 || p.MinInterval < 0 || p.MaxInterval < 0 || p.MaxDeltas < 0 {
+		return p, errors.New("snapshot policy values cannot be negative")
+	}
+	return p, nil
+}
+
+func (p SnapshotPolicy) String() string {
+	return fmt.Sprintf("wal-bytes=%s,wal-entries=%d,min-interval=%s,max-interval=%s,max-deltas=%d",
+		formatSize(p.WALBytes), p.WALEntries, p.MinInterval, p.MaxInterval, p.MaxDeltas)
+}
+
+// formatSize is the inverse of parseSize.
+func formatSize(n int64) string {
+	for _, u := range []struct {
+		suffix string
+		shift  uint
+	}{{"GiB", 30}, {"MiB", 20}, {"KiB", 10}} {
+		if n != 0 && n%(1<<u.shift) == 0 {
+			return fmt.Sprintf("%d%s", n>>u.shift, u.suffix)
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// parseSize parses a byte count with an optional binary suffix
+// (64MiB, 64MB and 64M are all 64 × 2^20).
+func parseSize(v string) (int64, error) {
+	num := strings.TrimRight(strings.ToUpper(v), "IB")
+	shift := 0
+	if n := len(num); n > 0 {
+		switch num[n-1] {
+		case 'K':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		}
+		if shift > 0 {
+			num = num[:n-1]
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", v)
+	}
+	return n << shift, nil
+}
+
+// due returns why a snapshot should be taken now, or "".
+func (p SnapshotPolicy) due(st WALStats, now time.Time) string {
+	switch {
+	case st.Entries == 0:
+		return ""
+	case now.Sub(st.Truncated) < p.MinInterval:
+		return ""
+	case p.WALBytes > 0 && st.Bytes >= p.WALBytes:
+		return "wal-bytes"
+	case p.WALEntries > 0 && st.Entries >= p.WALEntries:
+		return "wal-entries"
+	case p.MaxInterval > 0 && now.Sub(st.Oldest) >= p.MaxInterval:
+		return "max-interval"
+	}
+	return ""
+}
+
+// WALStats returns the size and age of the WAL since the last snapshot.
+func (s *Store) WALStats() WALStats {
+	return s.wal.currentStats()
+}
+
+// RunSnapshots takes a snapshot whenever p says so, until ctx is done.
+func (s *Store) RunSnapshots(ctx context.Context, p SnapshotPolicy) {
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(snapshotCheckInterval)
+	defer ticker.Stop()
+
+	var failed time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			st := s.WALStats()
+			reason := p.due(st, now)
+			if reason == "" || now.Sub(failed) < p.MinInterval {
+				continue
+			}
+			full, err := s.SnapshotDelta(p.MaxDeltas)
+			if err != nil {
+				// Retry after MinInterval, not on every tick.
+				failed = now
+				logger.Error("snapshot failed", "reason", reason, "error", err)
+				continue
+			}
+			logger.Debug("snapshot saved", "reason", reason, "full", full, "wal_bytes", st.Bytes,
+				"wal_entries", st.Entries, "took", time.Since(now))
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"os"
+	"time"
+)
+
+// Stats describes what a node holds.
+type Stats struct {
+	Keys         int       `json:"keys"` // live keys
+	Tombstones   int       `json:"tombstones"`
+	ValueBytes   int64     `json:"value_bytes"` // as stored: compressed values count compressed
+	WALBytes     int64     `json:"wal_bytes"`   // since the last snapshot
+	WALEntries   int       `json:"wal_entries"`
+	WALCommits   int       `json:"wal_commits"`                   // group commits that wrote those entries
+	WALSyncs     int       `json:"wal_syncs"`                     // fsyncs of those commits
+	WALSync      string    `json:"wal_sync"`                      // sync mode (see wal_sync.go)
+	LastSnapshot time.Time `json:"last_snapshot,omitzero"`        // zero = never
+	LastCompact  time.Time `json:"last_wal_compaction,omitzero"`  // zero = never (see wal_compact.go)
+	WALCompacted int64     `json:"wal_compacted_bytes,omitempty"` // removed from the WAL by compaction
+	ChangeSeq    uint64    `json:"change_seq"`                    // last change synced (see cdc.go)
+	OldestChange uint64    `json:"oldest_change,omitempty"`       // oldest the log retains
+	HLCAheadMs   int64     `json:"hlc_ahead_ms,omitempty"`        // how far the HLC runs ahead of the wall clock (see hlc.go)
+	ClockPruned  uint64    `json:"clock_entries_pruned"`          // dropped from clocks written here (see clockprune.go)
+	MemoryStats
+	DiskStats
+	Namespaces []NamespaceUsage `json:"namespaces,omitempty"`
+}
+
+// NamespaceUsage is what a node holds of one namespace, against its quotas.
+type NamespaceUsage struct {
+	Name     string `json:"name"`
+	Keys     int    `json:"keys"`
+	MaxKeys  int    `json:"max_keys,omitempty"`
+	Bytes    int64  `json:"bytes"`
+	MaxBytes int64  `json:"max_bytes,omitempty"`
+}
+
+// Stats counts the store's records, one shard at a time (so the totals
+// are not a point-in-time view while writes run).
+func (s *Store) Stats() Stats {
+	var st Stats
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for _, v := range sh.data {
+			if v.Tombstone {
+				st.Tombstones++
+			} else {
+				st.Keys++
+			}
+			st.ValueBytes += int64(v.Size())
+		}
+		sh.mu.RUnlock()
+	}
+	st.MemoryStats = s.MemoryStats()
+	st.DiskStats = s.DiskStats()
+	for _, ns := range s.Namespaces() {
+		st.Namespaces = append(st.Namespaces, NamespaceUsage{
+			Name: ns.Name, Keys: ns.Keys, MaxKeys: ns.MaxKeys, Bytes: ns.Bytes, MaxBytes: ns.MaxBytes,
+		})
+	}
+	wal := s.wal.currentStats()
+	st.WALBytes, st.WALEntries, st.WALCommits, st.WALSyncs = wal.Bytes, wal.Entries, wal.Commits, wal.Syncs
+	st.WALSync = s.wal.mode()
+	st.ChangeSeq, st.OldestChange = s.ChangeSeq(), s.OldestChange()
+	st.ClockPruned = s.ClockEntriesPruned()
+	st.HLCAheadMs = max(0, HLC(s.hlc.last.Load()).Time().Sub(time.Now()).Milliseconds())
+	if ns := s.lastSnapshot.Load(); ns != 0 {
+		st.LastSnapshot = time.Unix(0, ns).UTC()
+	}
+	if ns := s.wal.compacted.last.Load(); ns != 0 {
+		st.LastCompact = time.Unix(0, ns).UTC()
+	}
+	st.WALCompacted = s.wal.compacted.saved.Load()
+	return st
+}
+
+// setLastSnapshot records when the newest snapshot file was written.
+func (s *Store) setLastSnapshot(path string) {
+	if fi, err := os.Stat(path); err == nil {
+		s.lastSnapshot.Store(fi.ModTime().UnixNano())
+	}
+}
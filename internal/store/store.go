@@ -18,18 +18,24 @@
 //     After that, we only need to replay newer WAL entries.
 //
 //  3. Concurrency
-//     We use sync.RWMutex so:
+//     The map is split into 256 shards, each with its own sync.RWMutex
+//     (see shard.go), so:
 //     - Many readers can read at the same time
-//     - Only one writer can write at a time
-//     This pattern works well for read-heavy systems.
+//     - Writers to different keys do not wait for each other
+//     - Writers to the same key are serialized
 package store
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -41,15 +47,30 @@ import (
 //   - A tombstone flag (used for soft deletes in distributed replication)
 //   - A timestamp for tie-breaking conflicts
 //
+// Large values may be stored compressed (see compression.go).
+// Then Data is empty and the bytes live in Compressed, encoded with Encoding.
+// Call Decode to get the plain value back.
+//
+// ContentType is opaque to the store: it is kept and replicated with
+// Data, so readers can tell JSON from msgpack without guessing.
+//
+// A value with an ExpiresAt reads as absent from then on (see ttl.go).
+//
 // Why tombstone?
 // In distributed systems, deletes must also be replicated.
 // If we just removed the key, other nodes would not know it was deleted.
 // So we mark it as deleted instead.
 type Value struct {
-	Data      string      `json:"data"`
-	Clock     VectorClock `json:"clock"`      // Version information for conflict detection
-	Tombstone bool        `json:"tombstone"`  // Marks a soft delete
-	UpdatedAt time.Time   `json:"updated_at"` // Used as tie-breaker in conflicts
+	Data       string      `json:"data"`
+	Clock      VectorClock `json:"clock"`                // Version information for conflict detection
+	Tombstone  bool        `json:"tombstone"`            // Marks a soft delete
+	UpdatedAt  time.Time   `json:"updated_at"`           // Coordinator's wall clock when written
+	HLC        HLC         `json:"hlc,omitempty"`        // Used as tie-breaker in conflicts (see hlc.go)
+	Encoding   string      `json:"encoding,omitempty"`   // Compression codec ("" = plain)
+	Compressed []byte      `json:"compressed,omitempty"` // Compressed Data when Encoding != ""
+
+	ContentType string    `json:"content_type,omitempty"` // Media type of Data, as the writer gave it ("" = unknown)
+	ExpiresAt   time.Time `json:"expires_at,omitzero"`    // When the value's TTL runs out (zero = never)
 }
 
 // Store is the main storage object.
@@ -57,17 +78,43 @@ type Value struct {
 // It is safe for concurrent use.
 //
 // Fields:
-//   - mu: mutex to protect access to the map
-//   - data: in-memory key-value storage
+//   - shards: the in-memory key-value storage, one lock per shard
+//   - mu: protects namespaces, compression and limits
 //   - wal: write-ahead log for durability
 //   - dataDir: folder where snapshot and WAL are stored
 //   - nodeID: unique ID of this node (used in vector clocks)
+//   - namespaces: namespace configs (see namespace.go)
+//   - counts: live (non-tombstone) key count per namespace
+//   - compression: default codec and size threshold (see compression.go)
+//   - limits: key/value size limits (see limits.go)
+//   - snapshotMu: one snapshot at a time; guards chain
+//   - chain: what the snapshot files on disk hold (see snapshot_chain.go)
+//   - lastSnapshot: when the newest snapshot file was written (UnixNano)
+//   - watchers: subscribers to the change feed (see watch.go)
+//   - mem: memory estimate and eviction (see memory.go)
 type Store struct {
-	mu      sync.RWMutex
-	data    map[string]Value
-	wal     *WAL
-	dataDir string
-	nodeID  string
+	shards       [numShards]*shard
+	mu           sync.RWMutex
+	wal          *WAL
+	dataDir      string
+	nodeID       string
+	namespaces   map[string]Namespace
+	counts       keyCounts
+	compression  compressionConfig
+	limits       Limits
+	snapshotMu   sync.Mutex
+	chain        snapshotChain
+	lastSnapshot atomic.Int64
+	watchers     watchHub
+	versions     atomic.Pointer[map[string]int]           // namespace → versions kept (see versions.go)
+	conflicts    atomic.Pointer[map[string]conflictRules] // namespace → its own conflict rules (see tiebreak.go)
+	mem          memory
+
+	tiebreakNodeID atomic.Bool  // see tiebreak.go
+	deletePolicy   atomic.Int32 // index into deletePolicies (see tiebreak.go)
+	hlc            hlcClock     // see hlc.go
+	prune          clockPruning // see clockprune.go
+	disk           diskMonitor  // see disk.go
 }
 
 // New creates or opens a Store.
@@ -75,37 +122,57 @@ type Store struct {
 // Startup process:
 //
 // 1) Create the data directory (if it doesn't exist)
-// 2) Load the latest snapshot into memory
-// 3) Open the WAL file
-// 4) Replay WAL entries written after the snapshot
+// 2) Load namespace configs
+// 3) Load the latest snapshot (and its deltas) into memory
+// 4) Open the WAL file
+// 5) Replay WAL entries written after the snapshot
 //
 // After this finishes, the store is fully rebuilt in memory.
 func New(dataDir, nodeID string) (*Store, error) {
+	return NewWithRecovery(dataDir, nodeID, nil)
+}
+
+// NewWithRecovery is New, reporting its progress in rec (see recovery.go).
+func NewWithRecovery(dataDir, nodeID string, rec *Recovery) (*Store, error) {
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("create data dir: %w", err)
 	}
 
 	s := &Store{
-		data:    make(map[string]Value),
+		shards:  newShards(),
 		dataDir: dataDir,
 		nodeID:  nodeID,
+		counts:  keyCounts{m: make(map[string]int), bytes: make(map[string]int64)},
+		limits:  Limits{MaxKeyLength: DefaultMaxKeyLength, MaxValueSize: DefaultMaxValueSize},
+	}
+	s.mem.cfg.Store(&DefaultMemoryConfig)
+	s.mem.wake, s.mem.stop = make(chan struct{}, 1), make(chan struct{})
+
+	if err := s.loadNamespaces(); err != nil {
+		return nil, fmt.Errorf("load namespaces: %w", err)
 	}
 
-	// Step 1: load snapshot (if any) into memory.
-	if err := s.loadSnapshot(); err != nil {
+	walPath := filepath.Join(dataDir, "wal.log")
+	rec.start(recoveryBytes(dataDir, walPath))
+
+	// Step 1: load the snapshot chain (if any) into memory.
+	if err := s.loadSnapshot(rec); err != nil {
 		return nil, fmt.Errorf("load snapshot: %w", err)
 	}
 
 	// Step 2: open WAL and replay any entries written after the last snapshot.
-	wal, err := newWAL(filepath.Join(dataDir, "wal.log"))
+	wal, err := newWAL(walPath)
 	if err != nil {
 		return nil, fmt.Errorf("open wal: %w", err)
 	}
+	// Segment numbers name snapshot files too: continue after the newest.
+	wal.seq = max(wal.seq, s.chain.seq)
 	s.wal = wal
 
-	if err := s.replayWAL(); err != nil {
+	if err := s.replayWAL(rec); err != nil {
 		return nil, fmt.Errorf("replay wal: %w", err)
 	}
+	rec.finish()
 
 	return s, nil
 }
@@ -115,30 +182,82 @@ func New(dataDir, nodeID string) (*Store, error) {
 // Put stores or updates a key.
 //
 // Steps:
-//  1. Lock for writing
-//  2. Increment this node's vector clock
-//  3. Write the operation to the WAL (disk first!)
-//  4. Update the in-memory map
+//  1. Lock the key's shard for writing; give up if ctx is done by then
+//  2. Check the size limits, that the namespace exists and its quota
+//     allows the write, and that --max-memory does not refuse it
+//  3. Increment this node's vector clock
+//  4. Write the operation to the WAL (disk first!), in a group commit
+//     with other writers' (see wal.go)
+//  5. Update the in-memory map
+//
+// key is the internal key (see NamespacedKey). Once the WAL write starts
+// it completes: ctx cannot leave a write half-done.
 //
 // Important rule:
 //
 //	We ALWAYS write to WAL before changing memory.
 //	This guarantees crash safety.
-func (s *Store) Put(key, data string, clock VectorClock) (Value, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *Store) Put(ctx context.Context, key, data, contentType string, clock VectorClock) (Value, error) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	// The caller may have given up while we waited for the shard.
+	if err := ctx.Err(); err != nil {
+		return Value{}, err
+	}
+
+	// Held until the write lands, so namespace changes wait for it.
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.checkLimits(key, data); err != nil {
+		return Value{}, err
+	}
+	if err := s.checkMemory(); err != nil {
+		return Value{}, err
+	}
+	if err := s.checkDisk(); err != nil {
+		return Value{}, err
+	}
+	codec, threshold := s.codecFor(key)
+
+	release, err := s.reserveKey(sh, key)
+	if err != nil {
+		return Value{}, err
+	}
+	defer release()
 
 	if clock == nil {
+		// A blind write succeeds what we have, like Delete: starting
+		// from an empty clock would make every overwrite look like the
+		// first write, and replicas would drop it as already applied.
 		clock = make(VectorClock)
+		if existing, ok := sh.data[key]; ok {
+			clock = existing.Clock.Copy()
+		}
 	}
+	clock = s.pruneClock(clock)
 	clock.Increment(s.nodeID) // bump our own counter on every write
 
+	now := time.Now().UTC()
 	v := Value{
-		Data:      data,
-		Clock:     clock,
-		Tombstone: false,
-		UpdatedAt: time.Now().UTC(),
+		Data:        data,
+		Clock:       clock,
+		Tombstone:   false,
+		UpdatedAt:   now,
+		HLC:         s.hlc.now(),
+		ContentType: contentType,
+		ExpiresAt:   s.expiry(ctx, key, now),
 	}
+	if err := compressValue(&v, codec, threshold); err != nil {
+		return Value{}, fmt.Errorf("compress: %w", err)
+	}
+	releaseBytes, err := s.reserveBytes(sh, key, v)
+	if err != nil {
+		return Value{}, err
+	}
+	defer releaseBytes()
 
 	// WAL-first: persist before mutating memory.
 	entry := walEntry{Op: opPut, Key: key, Value: v}
@@ -146,37 +265,48 @@ func (s *Store) Put(key, data string, clock VectorClock) (Value, error) {
 		return Value{}, fmt.Errorf("wal append: %w", err)
 	}
 
-	s.data[key] = v
+	s.set(sh, key, v)
 	return v, nil
 }
 
-// Get returns the value for a key.
+// Get returns the value for a key, decompressed.
 //
 // If the key does not exist OR
 // if it was deleted (tombstone),
-// it returns (Value{}, false).
+// it returns (Value{}, false, nil).
 //
 // This hides tombstones from normal reads.
-func (s *Store) Get(key string) (Value, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-
-	v, ok := s.data[key]
-	if !ok || v.Tombstone {
-		return Value{}, false
+func (s *Store) Get(ctx context.Context, key string) (Value, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Value{}, false, err
+	}
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	v, ok := sh.data[key]
+	s.accessed(sh, key)
+	sh.mu.RUnlock()
+
+	if !ok || v.Tombstone || v.Expired(time.Now()) {
+		return Value{}, false, nil
+	}
+	v, err := v.Decode()
+	if err != nil {
+		return Value{}, false, err
 	}
-	return v, true
+	return v, true, nil
 }
 
 // GetRaw returns the stored Value exactly as it exists,
-// including tombstones.
+// including tombstones (and still compressed).
 //
 // This is used internally for replication so that
 // deletes can be propagated across nodes.
 func (s *Store) GetRaw(key string) (Value, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	v, ok := s.data[key]
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	v, ok := sh.data[key]
+	s.accessed(sh, key)
 	return v, ok
 }
 
@@ -193,21 +323,39 @@ func (s *Store) GetRaw(key string) (Value, bool) {
 //   - We increment vector clock
 //   - We write to WAL first
 //   - Then update memory
-func (s *Store) Delete(key string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+func (s *Store) Delete(ctx context.Context, key string) error {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-	existing, ok := s.data[key]
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ns, k := SplitKey(key)
+	if err := s.limits.CheckKey(k); err != nil {
+		return err
+	}
+	if _, ok := s.namespaces[ns]; !ok {
+		return ErrNamespaceNotFound
+	}
+
+	existing, ok := sh.data[key]
 	clock := make(VectorClock)
 	if ok {
 		clock = existing.Clock.Copy()
 	}
+	clock = s.pruneClock(clock)
 	clock.Increment(s.nodeID)
 
 	v := Value{
 		Clock:     clock,
 		Tombstone: true,
 		UpdatedAt: time.Now().UTC(),
+		HLC:       s.hlc.now(),
 	}
 
 	entry := walEntry{Op: opDelete, Key: key, Value: v}
@@ -215,7 +363,7 @@ func (s *Store) Delete(key string) error {
 		return fmt.Errorf("wal append: %w", err)
 	}
 
-	s.data[key] = v
+	s.set(sh, key, v)
 	return nil
 }
 
@@ -228,7 +376,8 @@ func (s *Store) Delete(key string) error {
 //   - If incoming is older → ignore it
 //   - If incoming is newer → accept it
 //   - If both are concurrent (true conflict):
-//     use UpdatedAt as a tie-breaker
+//     use the HLC as a tie-breaker (or node IDs, or the delete policy
+//     when one side is a tombstone: see tiebreak.go)
 //
 // This approach is:
 //
@@ -237,21 +386,16 @@ func (s *Store) Delete(key string) error {
 // In a real production system, we might return conflicts
 // to the application instead of auto-resolving.
 func (s *Store) ApplyRemote(key string, incoming Value) (applied bool, err error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
 
-	existing, ok := s.data[key]
-	if ok {
-		rel := incoming.Clock.Compare(existing.Clock)
-		switch rel {
-		case ConcurrentClocks:
-			if incoming.UpdatedAt.Before(existing.UpdatedAt) {
-				return false, nil // keep existing
-			}
-		case Before:
-			// Incoming is strictly older — discard it.
-			return false, nil
-			// After or Equal: incoming wins, fall through.
+	if existing, ok := sh.data[key]; ok && !s.supersedes(key, incoming, existing) {
+		return false, nil
+	}
+	if !incoming.Tombstone {
+		if err := s.checkDisk(); err != nil {
+			return false, err
 		}
 	}
 
@@ -259,35 +403,140 @@ func (s *Store) ApplyRemote(key string, incoming Value) (applied bool, err error
 	if err := s.wal.append(entry); err != nil {
 		return false, err
 	}
-	s.data[key] = incoming
+	s.set(sh, key, incoming)
 	return true, nil
 }
 
-// Keys returns all keys that are NOT tombstoned.
+// supersedes reports whether a replicated value should replace the
+// stored one.
+func (s *Store) supersedes(key string, incoming, existing Value) bool {
+	switch s.CompareClocks(incoming.Clock, existing.Clock) {
+	case ConcurrentClocks:
+		return s.CompareConcurrent(key, incoming, existing) >= 0
+	case Before:
+		// Incoming is strictly older — discard it.
+		return false
+	case Equal:
+		// Same version already applied (e.g. a retried replication).
+		// Skipping keeps retries from rewriting the WAL.
+		return false
+	}
+	return true // After: incoming wins
+}
+
+// Keys returns all keys of a namespace that are NOT tombstoned,
+// without the namespace prefix.
 //
 // We do not expose deleted keys to users.
-func (s *Store) Keys() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+func (s *Store) Keys(namespace string) []string {
+	keys := make([]string, 0, s.counts.get(namespace))
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for k, v := range sh.data {
+			if v.Tombstone || v.Expired(now) {
+				continue
+			}
+			if ns, key := SplitKey(k); ns == namespace {
+				keys = append(keys, key)
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return keys
+}
 
-	keys := make([]string, 0, len(s.data))
-	for k, v := range s.data {
-		if !v.Tombstone {
-			keys = append(keys, k)
+// KeysPage returns, in order, the first limit live keys of namespace
+// that start with prefix, sort after after, and pass f.
+//
+// The shards are unordered, so every key is still visited; but at most
+// about 2×limit are held at once, however big the namespace. Values are
+// matched against f outside the shard lock: decoding and parsing them
+// must not hold up writes.
+func (s *Store) KeysPage(namespace, prefix, after string, limit int, f Filter) []string {
+	var (
+		keys  []string
+		bound string // once trimmed, keys >= bound cannot make the page
+		full  bool
+	)
+	type candidate struct {
+		key string
+		val Value
+	}
+	var candidates []candidate
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for k, v := range sh.data {
+			if v.Tombstone || v.Expired(now) {
+				continue
+			}
+			ns, key := SplitKey(k)
+			if ns != namespace || key <= after || !strings.HasPrefix(key, prefix) || full && key >= bound {
+				continue
+			}
+			if f.IsZero() {
+				keys = append(keys, key)
+			} else {
+				candidates = append(candidates, candidate{key, v})
+			}
 		}
+		sh.mu.RUnlock()
+		for _, cand := range candidates {
+			if v, err := cand.val.Decode(); err == nil && f.Match(v) {
+				keys = append(keys, cand.key)
+			}
+		}
+		candidates = candidates[:0]
+		if len(keys) > 2*limit {
+			slices.Sort(keys)
+			keys = keys[:limit]
+			bound, full = keys[limit-1], true
+		}
+	}
+	slices.Sort(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
 	}
 	return keys
 }
 
+// KeySizes returns every live internal key with its stored size in bytes
+// (after compression). Used to report data distribution on the ring.
+func (s *Store) KeySizes() map[string]int {
+	out := make(map[string]int, s.len())
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for k, v := range sh.data {
+			if !v.Tombstone {
+				out[k] = v.Size()
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return out
+}
+
 // ─── Snapshot ─────────────────────────────────────────────────────────────────
 
-// Snapshot saves the entire in-memory state to disk.
+// Snapshot saves the entire in-memory state to disk as a full snapshot
+// (see snapshot_chain.go for deltas).
 //
 // Steps:
-//  1. Copy in-memory map (while holding read lock)
-//  2. Write it to a temporary file
-//  3. Atomically rename it to snapshot.json
-//  4. Truncate the WAL (since snapshot now contains everything)
+//  1. Seal the WAL (see rotate): new writes go to a fresh log
+//  2. Copy the map ONE SHARD AT A TIME and stream it to a temporary file
+//  3. Atomically rename it to snapshot-<n>.json
+//  4. Delete the sealed WAL (the snapshot now contains all of it) and
+//     the older snapshot files
+//
+// Each shard is read-locked only while its records are copied — 1/256 of
+// the map, and values are never modified in place, so the copy is
+// shallow. Encoding and disk I/O happen with no lock held. Writes to a
+// shard wait at most for its copy, never for the whole snapshot.
+//
+// The result is not a point-in-time view across shards: a write that
+// lands mid-snapshot may or may not be in it. It is always in the new
+// WAL, and replaying it on top of the snapshot gives the right state.
 //
 // Why atomic rename?
 // If we crash during write, the old snapshot remains safe.
@@ -295,58 +544,138 @@ func (s *Store) Keys() []string {
 // After snapshot:
 //
 //	Recovery is much faster because we replay fewer WAL entries.
+//
+// Only one snapshot runs at a time; a second call waits for the first.
 func (s *Store) Snapshot() error {
-	s.mu.RLock()
-	snapshot := make(map[string]Value, len(s.data))
-	for k, v := range s.data {
-		snapshot[k] = v
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	return s.snapshot(true)
+}
+
+// snapshot writes a full snapshot, or a delta of the records changed
+// since the previous one. Caller must hold s.snapshotMu.
+func (s *Store) snapshot(full bool) (err error) {
+	defer func() {
+		if err != nil {
+			// The attempt may have reset the dirty sets: only a full
+			// snapshot is sure to include those records now.
+			s.chain.needFull = true
+		}
+	}()
+
+	seq, err := s.wal.rotate(true)
+	if err != nil {
+		return fmt.Errorf("seal wal: %w", err)
 	}
-	s.mu.RUnlock()
 
-	path := filepath.Join(s.dataDir, "snapshot.json")
+	path := filepath.Join(s.dataDir, snapshotFile(seq, full))
 	tmp := path + ".tmp"
 
 	f, err := os.Create(tmp)
 	if err != nil {
 		return err
 	}
-	if err := json.NewEncoder(f).Encode(snapshot); err != nil {
-		f.Close()
+	w := bufio.NewWriterSize(f, 1<<20)
+	err = s.writeSnapshot(w, full)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
 		return err
 	}
-	f.Close()
 
 	// Atomic rename: if we crash between Create and Rename the old snapshot
-	// is still valid.
+	// is still valid, and the sealed WAL is still there to replay.
 	if err := os.Rename(tmp, path); err != nil {
 		return err
 	}
+	s.setLastSnapshot(path)
+
+	if full {
+		s.chain = snapshotChain{seq: seq, hasBase: true}
+		if err := s.removeChainBefore(seq); err != nil {
+			return err
+		}
+	} else {
+		s.chain.seq = seq
+		s.chain.deltas++
+	}
 
-	// Truncate WAL — everything is now captured in the snapshot.
-	return s.wal.truncate()
+	// Delete the sealed WAL — everything in it is now in the snapshot.
+	return s.wal.removeSealed(seq)
 }
 
-// loadSnapshot loads snapshot.json (if it exists)
-// and restores it into memory.
-//
-// If no snapshot exists, this is not an error.
-func (s *Store) loadSnapshot() error {
-	path := filepath.Join(s.dataDir, "snapshot.json")
-	f, err := os.Open(path)
-	if os.IsNotExist(err) {
-		return nil // no snapshot yet — that's fine
-	}
-	if err != nil {
-		return err
-	}
-	defer f.Close()
+// writeSnapshot writes the records to w as one JSON object (what
+// loadSnapshot decodes), locking one shard at a time: all of them, or
+// for a delta only the dirty ones. Either way the dirty sets start over.
+func (s *Store) writeSnapshot(w *bufio.Writer, full bool) error {
+	var (
+		batch []BackupRecord
+		gone  []string // dirty keys evicted since: null in a delta
+	)
+	first := true
+
+	w.WriteByte('{')
+	for _, sh := range s.shards {
+		// The read lock is enough to swap sh.dirty: writers (the only
+		// other users) hold the write lock, and snapshots s.snapshotMu.
+		sh.mu.RLock()
+		batch, gone = batch[:0], gone[:0]
+		if full {
+			for k, v := range sh.data {
+				batch = append(batch, BackupRecord{Key: k, Value: v})
+			}
+		} else {
+			for k := range sh.dirty {
+				if v, ok := sh.data[k]; ok {
+					batch = append(batch, BackupRecord{Key: k, Value: v})
+				} else {
+					gone = append(gone, k)
+				}
+			}
+		}
+		sh.dirty = make(map[string]struct{})
+		sh.mu.RUnlock()
 
-	var snapshot map[string]Value
-	if err := json.NewDecoder(f).Decode(&snapshot); err != nil {
-		return err
+		for _, rec := range batch {
+			key, err := json.Marshal(rec.Key)
+			if err != nil {
+				return err
+			}
+			val, err := json.Marshal(rec.Value)
+			if err != nil {
+				return err
+			}
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			w.Write(key)
+			w.WriteByte(':')
+			w.Write(val)
+		}
+		for _, k := range gone {
+			key, err := json.Marshal(k)
+			if err != nil {
+				return err
+			}
+			if !first {
+				w.WriteByte(',')
+			}
+			first = false
+			w.Write(key)
+			w.WriteString(":null")
+		}
 	}
-	s.data = snapshot
-	return nil
+	_, err := w.WriteString("}\n")
+	return err // bufio.Writer keeps the first error
 }
 
 // replayWAL reads all WAL entries
@@ -355,20 +684,23 @@ func (s *Store) loadSnapshot() error {
 // Important:
 // We DO NOT re-write them to the WAL again.
 // We are only rebuilding memory.
-func (s *Store) replayWAL() error {
-	entries, err := s.wal.readAll()
-	if err != nil {
-		return err
-	}
-	for _, e := range entries {
-		// Apply directly without re-writing to WAL.
-		s.data[e.Key] = e.Value
-	}
-	return nil
+func (s *Store) replayWAL(rec *Recovery) error {
+	a := s.newApplier(rec)
+	err := s.wal.readAll(rec, func(e walEntry) {
+		rec.appliedEntries(1)
+		for _, op := range e.ops() {
+			// Apply directly without re-writing to WAL.
+			k := NamespacedKey(SplitKey(op.Key)) // migrates pre-namespace keys
+			a.add(replayOp{key: k, evict: op.Op == opEvict, value: op.Value})
+		}
+	})
+	a.wait() // WAL ops have no records to decode
+	return err
 }
 
-// Close closes the WAL file.
+// Close stops the evictor and closes the WAL file.
 // Call this during shutdown.
 func (s *Store) Close() error {
+	s.mem.stopOnce.Do(func() { close(s.mem.stop) })
 	return s.wal.close()
 }
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ─── Conflict tie-break ───────────────────────────────────────────────────────
+//
+// Two writes with concurrent vector clocks have no causal order, so every
+// node picks the same one by a fixed rule:
+//
+//   - time (default): the later HLC (hlc.go). A write stamped after its
+//     node saw the other wins; otherwise wall time decides, so a node whose
+//     clock runs ahead wins conflicts it should lose. cluster/skew.go
+//     measures how far apart the clocks are.
+//   - node-id: of the nodes whose counters differ, the greatest ID decides:
+//     the write that counts more of its updates wins. Unaffected by skew,
+//     but no longer "last writer wins": conflicts favour high node IDs.
+//
+// A delete racing a write is the same kind of conflict, and by default
+// settled the same way: the delete wins if its stamp is later. That makes
+// the outcome depend on clocks and timing, so --delete-conflicts can fix
+// it instead:
+//
+//   - delete-wins: the tombstone beats any concurrent write. A key deleted
+//     anywhere stays deleted until a write that saw the delete.
+//   - write-wins: any concurrent write beats the tombstone. A delete only
+//     removes the writes it saw.
+//
+// The tie-break rule above still decides between two writes, or two
+// deletes.
+//
+// A namespace can set its own rules (tiebreak and delete_conflicts in its
+// config); the flags are the rules of the namespaces that do not.
+//
+// Every node must use the same rules. Replicas that pick differently each
+// keep their own pick, and read repair cannot settle it. Namespace rules
+// reach every node with the namespace config, so change them while the
+// namespace is quiet: writes racing the change may be settled either way.
+
+// Tie-break rules.
+const (
+	TiebreakTime   = "time"
+	TiebreakNodeID = "node-id"
+)
+
+// Delete conflict policies.
+const (
+	DeleteConflictsTiebreak   = "tiebreak"
+	DeleteConflictsDeleteWins = "delete-wins"
+	DeleteConflictsWriteWins  = "write-wins"
+)
+
+var deletePolicies = []string{DeleteConflictsTiebreak, DeleteConflictsDeleteWins, DeleteConflictsWriteWins}
+
+// SetTiebreak sets the rule for concurrent writes.
+func (s *Store) SetTiebreak(rule string) error {
+	switch rule {
+	case TiebreakTime, "":
+		s.tiebreakNodeID.Store(false)
+	case TiebreakNodeID:
+		s.tiebreakNodeID.Store(true)
+	default:
+		return fmt.Errorf("unknown tie-break %q: expected time or node-id", rule)
+	}
+	return nil
+}
+
+// Tiebreak returns the rule for concurrent writes.
+func (s *Store) Tiebreak() string {
+	if s.tiebreakNodeID.Load() {
+		return TiebreakNodeID
+	}
+	return TiebreakTime
+}
+
+// SetDeleteConflicts sets the policy for a delete concurrent with a write.
+func (s *Store) SetDeleteConflicts(policy string) error {
+	if policy == "" {
+		policy = DeleteConflictsTiebreak
+	}
+	i := slices.Index(deletePolicies, policy)
+	if i < 0 {
+		return fmt.Errorf("unknown delete conflict policy %q: expected tiebreak, delete-wins or write-wins", policy)
+	}
+	s.deletePolicy.Store(int32(i))
+	return nil
+}
+
+// DeleteConflicts returns the policy for a delete concurrent with a write.
+func (s *Store) DeleteConflicts() string {
+	return deletePolicies[s.deletePolicy.Load()]
+}
+
+// conflictRules are a namespace's own rules; "" = the node's.
+type conflictRules struct {
+	tiebreak, deletes string
+}
+
+// refreshConflictRules republishes the namespaces' rules for
+// CompareConcurrent, which holds no store lock. Caller must hold s.mu.
+func (s *Store) refreshConflictRules() {
+	m := make(map[string]conflictRules)
+	for name, ns := range s.namespaces {
+		if ns.Tiebreak != "" || ns.DeleteConflicts != "" {
+			m[name] = conflictRules{tiebreak: ns.Tiebreak, deletes: ns.DeleteConflicts}
+		}
+	}
+	s.conflicts.Store(&m)
+}
+
+// CompareConcurrent decides between a and b, two values of key with
+// concurrent clocks: > 0 if a wins, < 0 if b wins, 0 if the rules cannot
+// tell them apart (callers keep what they have).
+func (s *Store) CompareConcurrent(key string, a, b Value) int {
+	ns, _ := SplitKey(key)
+	rules := (*s.conflicts.Load())[ns]
+	if a.Tombstone != b.Tombstone {
+		policy := rules.deletes
+		if policy == "" {
+			policy = deletePolicies[s.deletePolicy.Load()]
+		}
+		switch policy {
+		case DeleteConflictsDeleteWins:
+			if a.Tombstone {
+				return 1
+			}
+			return -1
+		case DeleteConflictsWriteWins:
+			if a.Tombstone {
+				return -1
+			}
+			return 1
+		}
+	}
+	byNodeID := s.tiebreakNodeID.Load()
+	if rules.tiebreak != "" {
+		byNodeID = rules.tiebreak == TiebreakNodeID
+	}
+	if byNodeID {
+		if c := compareByNodeID(s.unpruned(a.Clock, b.Clock)); c != 0 {
+			return c
+		}
+	}
+	return CompareTime(a, b)
+}
+
+// compareByNodeID compares a and b at the greatest node ID whose counters
+// differ. It is 0 only for equal clocks.
+func compareByNodeID(a, b VectorClock) int {
+	top, found := "", false
+	for _, c := range []VectorClock{a, b} {
+		for id := range c {
+			if a[id] != b[id] && (!found || id > top) {
+				top, found = id, true
+			}
+		}
+	}
+	switch {
+	case !found:
+		return 0
+	case a[top] > b[top]:
+		return 1
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+// raceCase is a delete racing a write: concurrent clocks, stamped
+// putHLC and delHLC milliseconds after a common base.
+type raceCase struct {
+	name           string
+	policy         string
+	putHLC, delHLC int64
+	deleted        bool // whether the tombstone wins
+}
+
+var raceCases = []raceCase{
+	{"delete-wins/equal hlc", DeleteConflictsDeleteWins, 0, 0, true},
+	{"delete-wins/put later", DeleteConflictsDeleteWins, 5, 0, true},
+	{"delete-wins/delete later", DeleteConflictsDeleteWins, 0, 5, true},
+	{"write-wins/equal hlc", DeleteConflictsWriteWins, 0, 0, false},
+	{"write-wins/put later", DeleteConflictsWriteWins, 5, 0, false},
+	{"write-wins/delete later", DeleteConflictsWriteWins, 0, 5, false},
+	{"tiebreak/put later", DeleteConflictsTiebreak, 5, 0, false},
+	{"tiebreak/delete later", DeleteConflictsTiebreak, 0, 5, true},
+}
+
+// racingValues returns the write and the delete of tc.
+func racingValues(tc raceCase) (put, del Value) {
+	base := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(ms int64) (time.Time, HLC) {
+		t := base.Add(time.Duration(ms) * time.Millisecond)
+		return t, HLCAt(t)
+	}
+	put = Value{Data: "v", Clock: VectorClock{"n1": 1}}
+	put.UpdatedAt, put.HLC = at(tc.putHLC)
+	del = Value{Tombstone: true, Clock: VectorClock{"n2": 1}}
+	del.UpdatedAt, del.HLC = at(tc.delHLC)
+	return put, del
+}
+
+func TestDeleteConflictsApplyRemote(t *testing.T) {
+	key := NamespacedKey(DefaultNamespace, "k")
+	for _, tc := range raceCases {
+		put, del := racingValues(tc)
+		if put.Clock.Compare(del.Clock) != ConcurrentClocks {
+			t.Fatalf("%s: clocks are not concurrent", tc.name)
+		}
+		// Either order of arrival must settle the same way.
+		for _, order := range []struct {
+			name            string
+			stored, arrives Value
+		}{
+			{"put then delete", put, del},
+			{"delete then put", del, put},
+		} {
+			t.Run(tc.name+"/"+order.name, func(t *testing.T) {
+				s := newTestStore(t)
+				if err := s.SetDeleteConflicts(tc.policy); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.ApplyRemote(key, order.stored); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.ApplyRemote(key, order.arrives); err != nil {
+					t.Fatal(err)
+				}
+				got, ok := s.GetRaw(key)
+				if !ok {
+					t.Fatal("key missing after ApplyRemote")
+				}
+				if got.Tombstone != tc.deleted {
+					t.Errorf("tombstone = %v, want %v", got.Tombstone, tc.deleted)
+				}
+			})
+		}
+	}
+}
+
+func TestDeleteConflictsCompareConcurrent(t *testing.T) {
+	key := NamespacedKey(DefaultNamespace, "k")
+	for _, tc := range raceCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStore(t)
+			if err := s.SetDeleteConflicts(tc.policy); err != nil {
+				t.Fatal(err)
+			}
+			put, del := racingValues(tc)
+			want := -1
+			if tc.deleted {
+				want = 1
+			}
+			if got := s.CompareConcurrent(key, del, put); got != want {
+				t.Errorf("CompareConcurrent(delete, put) = %d, want %d", got, want)
+			}
+			if got := s.CompareConcurrent(key, put, del); got != -want {
+				t.Errorf("CompareConcurrent(put, delete) = %d, want %d", got, -want)
+			}
+		})
+	}
+}
+
+func TestDeleteConflictsNamespaceRule(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.SetDeleteConflicts(DeleteConflictsWriteWins); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PutNamespace(Namespace{Name: "tombs", DeleteConflicts: DeleteConflictsDeleteWins}); err != nil {
+		t.Fatal(err)
+	}
+	put, del := racingValues(raceCase{putHLC: 5})
+	if got := s.CompareConcurrent(NamespacedKey("tombs", "k"), del, put); got <= 0 {
+		t.Errorf("namespace delete-wins: CompareConcurrent(delete, put) = %d, want > 0", got)
+	}
+	if got := s.CompareConcurrent(NamespacedKey(DefaultNamespace, "k"), del, put); got >= 0 {
+		t.Errorf("node write-wins: CompareConcurrent(delete, put) = %d, want < 0", got)
+	}
+}
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := New(t.TempDir(), "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
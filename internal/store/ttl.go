@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// Key expiry
+//
+// A namespace with ttl_seconds = T gives every value written to it an
+// ExpiresAt T seconds after the write; a write can choose its own TTL
+// with WithTTL (the API's X-TTL header), down to none. The coordinator
+// stamps ExpiresAt once, and replicas keep the stamp, so every copy of
+// a version expires at the same moment.
+//
+// An expired value reads as absent at once: Get, Keys and KeysPage skip
+// it, and so do quorum reads (cluster/replicator.go). It is still stored,
+// until the key's primary replaces it with a tombstone (cluster/expiry.go)
+// — a delete like any other, which replicates, feeds watchers and CDC,
+// and is collected with the other tombstones. Rewriting the key before
+// then starts it over with a new ExpiresAt.
+//
+// Expiry compares ExpiresAt with each node's own clock, so keys expire
+// on nodes whose clocks run ahead a little early.
+
+// MaxTTL bounds TTLs, so ExpiresAt stays a sane time.
+const MaxTTL = 10 * 365 * 24 * time.Hour
+
+type ttlCtx struct{}
+
+// WithTTL returns a ctx whose writes expire ttl after they are made,
+// instead of after their namespace's ttl_seconds. ttl 0 means never.
+func WithTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, ttlCtx{}, ttl)
+}
+
+// Expired reports whether v's TTL had run out at now.
+func (v Value) Expired(now time.Time) bool {
+	return !v.ExpiresAt.IsZero() && !now.Before(v.ExpiresAt)
+}
+
+// expiry returns when a write of key made at now expires (zero = never):
+// ctx's TTL if it has one, else the namespace's. Caller must hold s.mu.
+func (s *Store) expiry(ctx context.Context, key string, now time.Time) time.Time {
+	ttl, ok := ctx.Value(ttlCtx{}).(time.Duration)
+	if !ok {
+		ns, _ := SplitKey(key)
+		ttl = time.Duration(s.namespaces[ns].TTLSeconds) * time.Second
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// ExpiredKeys returns up to limit internal keys whose live value had
+// expired at now, among those for which keep returns true.
+func (s *Store) ExpiredKeys(now time.Time, limit int, keep func(key string) bool) []string {
+	var keys []string
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for k, v := range sh.data {
+			if v.Tombstone || !v.Expired(now) || !keep(k) {
+				continue
+			}
+			keys = append(keys, k)
+			if len(keys) == limit {
+				sh.mu.RUnlock()
+				return keys
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return keys
+}
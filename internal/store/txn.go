@@ -0,0 +1,241 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ─── Multi-key writes ─────────────────────────────────────────────────────────
+//
+// A transaction's writes must all land or none, also on disk: a crash
+// between two WAL lines would replay half of them. So they are written
+// as ONE WAL entry,
+//
+//	{"op":"BATCH","batch":[{"op":"PUT","key":...},{"op":"DELETE",...}],"crc":N}
+//
+// which replay applies whole, or skips whole if it is torn or fails its
+// checksum. In memory, every shard involved is locked for the duration,
+// so no reader sees some of the writes without the others.
+//
+// Deciding WHETHER to write (the checks of a transaction) is the
+// coordinator's job; see cluster/txn.go.
+
+// TxnWrite is one write of a transaction.
+type TxnWrite struct {
+	Key         string      // internal key
+	Data        string      // ignored for deletes
+	ContentType string      // ignored for deletes
+	Delete      bool        // write a tombstone
+	Clock       VectorClock // the version the coordinator read; may be nil
+}
+
+// BatchEntry is one key of a replicated batch.
+type BatchEntry struct {
+	Key   string `json:"key"`
+	Value Value  `json:"value"`
+}
+
+// Errors returned by ApplyTxn for a malformed batch.
+var (
+	ErrEmptyBatch   = errors.New("batch has no writes")
+	ErrDuplicateKey = errors.New("key written twice in one batch")
+)
+
+// ApplyTxn performs writes atomically: one WAL entry, every shard
+// locked. Each new version descends from both the stored one and
+// w.Clock, bumped on this node. Keys must be distinct. It returns the
+// stored entries, to be replicated with ApplyBatch.
+func (s *Store) ApplyTxn(ctx context.Context, writes []TxnWrite) ([]BatchEntry, error) {
+	if len(writes) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	keys := make([]string, len(writes))
+	seen := make(map[string]bool, len(writes))
+	for i, w := range writes {
+		if seen[w.Key] {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateKey, w.Key)
+		}
+		seen[w.Key] = true
+		keys[i] = w.Key
+	}
+	unlock := s.lockShardsOf(keys)
+	defer unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Validate everything before writing anything.
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+	now, hlc := time.Now().UTC(), s.hlc.now() // one stamp for the whole batch
+	out := make([]BatchEntry, len(writes))
+	batch := walEntry{Op: opBatch, Batch: make([]walEntry, len(writes))}
+	for i, w := range writes {
+		sh := s.shardFor(w.Key)
+		ns, k := SplitKey(w.Key)
+		if w.Delete {
+			if err := s.limits.CheckKey(k); err != nil {
+				return nil, err
+			}
+			if _, ok := s.namespaces[ns]; !ok {
+				return nil, ErrNamespaceNotFound
+			}
+		} else {
+			if err := s.checkLimits(w.Key, w.Data); err != nil {
+				return nil, err
+			}
+			if err := s.checkMemory(); err != nil {
+				return nil, err
+			}
+			if err := s.checkDisk(); err != nil {
+				return nil, err
+			}
+			release, err := s.reserveKey(sh, w.Key)
+			if err != nil {
+				return nil, err
+			}
+			releases = append(releases, release)
+		}
+
+		var base VectorClock
+		if existing, ok := sh.data[w.Key]; ok {
+			base = existing.Clock
+		}
+		v, err := s.newVersion(w, base, now, hlc, s.expiry(ctx, w.Key, now))
+		if err != nil {
+			return nil, err
+		}
+		if !w.Delete {
+			release, err := s.reserveBytes(sh, w.Key, v)
+			if err != nil {
+				return nil, err
+			}
+			releases = append(releases, release)
+		}
+		op := opPut
+		if w.Delete {
+			op = opDelete
+		}
+		out[i] = BatchEntry{Key: w.Key, Value: v}
+		batch.Batch[i] = walEntry{Op: op, Key: w.Key, Value: v}
+	}
+
+	if err := s.wal.append(batch); err != nil {
+		return nil, fmt.Errorf("wal append: %w", err)
+	}
+	for _, e := range out {
+		s.set(s.shardFor(e.Key), e.Key, e.Value)
+	}
+	return out, nil
+}
+
+// ApplyBatch applies a batch replicated by a transaction's coordinator,
+// atomically like ApplyTxn. Each entry is judged as in ApplyRemote; the
+// ones that win are written as one WAL entry. It returns how many did.
+func (s *Store) ApplyBatch(entries []BatchEntry) (int, error) {
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+	unlock := s.lockShardsOf(keys)
+	defer unlock()
+
+	batch := walEntry{Op: opBatch}
+	var apply []BatchEntry
+	for _, e := range entries {
+		if existing, ok := s.shardFor(e.Key).data[e.Key]; ok && !s.supersedes(e.Key, e.Value, existing) {
+			continue
+		}
+		if !e.Value.Tombstone {
+			if err := s.checkDisk(); err != nil {
+				return 0, err
+			}
+		}
+		op := opPut
+		if e.Value.Tombstone {
+			op = opDelete
+		}
+		batch.Batch = append(batch.Batch, walEntry{Op: op, Key: e.Key, Value: e.Value})
+		apply = append(apply, e)
+	}
+	if len(apply) == 0 {
+		return 0, nil
+	}
+	if err := s.wal.append(batch); err != nil {
+		return 0, err
+	}
+	for _, e := range apply {
+		s.set(s.shardFor(e.Key), e.Key, e.Value)
+	}
+	return len(apply), nil
+}
+
+// NewVersions builds the values writes would store, without storing
+// them: for a coordinator that holds none of the keys itself (see
+// cluster/twophase.go). Each descends from w.Clock, bumped on this node.
+// Limits and namespaces are checked; quotas are not, as for replicated
+// writes.
+func (s *Store) NewVersions(ctx context.Context, writes []TxnWrite) ([]BatchEntry, error) {
+	if len(writes) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now, hlc := time.Now().UTC(), s.hlc.now() // one stamp for the whole batch
+	out := make([]BatchEntry, len(writes))
+	seen := make(map[string]bool, len(writes))
+	for i, w := range writes {
+		if seen[w.Key] {
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateKey, w.Key)
+		}
+		seen[w.Key] = true
+
+		ns, k := SplitKey(w.Key)
+		if w.Delete {
+			if err := s.limits.CheckKey(k); err != nil {
+				return nil, err
+			}
+		} else if err := s.checkLimits(w.Key, w.Data); err != nil {
+			return nil, err
+		}
+		if _, ok := s.namespaces[ns]; !ok {
+			return nil, ErrNamespaceNotFound
+		}
+		v, err := s.newVersion(w, nil, now, hlc, s.expiry(ctx, w.Key, now))
+		if err != nil {
+			return nil, err
+		}
+		out[i] = BatchEntry{Key: w.Key, Value: v}
+	}
+	return out, nil
+}
+
+// newVersion builds the value of w: its clock descends from base and
+// w.Clock, bumped on this node; puts are compressed as configured and
+// expire at expires. Caller must hold s.mu.
+func (s *Store) newVersion(w TxnWrite, base VectorClock, now time.Time, hlc HLC, expires time.Time) (Value, error) {
+	clock := s.pruneClock(base.Merge(w.Clock))
+	clock.Increment(s.nodeID)
+
+	v := Value{Clock: clock, UpdatedAt: now, HLC: hlc}
+	if w.Delete {
+		v.Tombstone = true
+		return v, nil
+	}
+	v.Data, v.ContentType, v.ExpiresAt = w.Data, w.ContentType, expires
+	codec, threshold := s.codecFor(w.Key)
+	if err := compressValue(&v, codec, threshold); err != nil {
+		return Value{}, fmt.Errorf("compress: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ─── Offline verification ─────────────────────────────────────────────────────
+//
+// Replay is forgiving: a bad WAL line is skipped, so a node starts even
+// after a torn write. That also hides damage. Verify reads a data
+// directory the way New would — namespaces, snapshot chain, sealed
+// segments, wal.log — without changing anything, and reports every
+// problem with its location:
+//
+//   - WAL framing: lines that are not JSON, lack their newline (a torn
+//     last write) or exceed maxEntrySize
+//   - checksums: lines whose CRC does not match
+//   - snapshots: files that do not decode, deltas without a base
+//   - replay: entries with no key or an unknown op, deletes that are not
+//     tombstones, clocks that go backwards for a key, and values in the
+//     final state that have no clock or do not decompress
+//
+// Run it against a stopped node: a running one keeps appending.
+
+// Problem is one thing wrong in a data directory.
+type Problem struct {
+	File   string `json:"file"`
+	Line   int    `json:"line,omitempty"`   // WAL line, 1-based
+	Offset int64  `json:"offset,omitempty"` // byte offset in File
+	Key    string `json:"key,omitempty"`
+	Msg    string `json:"problem"`
+}
+
+func (p Problem) String() string {
+	loc := p.File
+	if p.Line > 0 {
+		loc += fmt.Sprintf(":%d", p.Line)
+	}
+	if p.Offset > 0 {
+		loc += fmt.Sprintf(" (offset %d)", p.Offset)
+	}
+	if p.Key != "" {
+		loc += " key " + p.Key
+	}
+	return loc + ": " + p.Msg
+}
+
+// VerifiedFile summarizes one file Verify read.
+type VerifiedFile struct {
+	File    string `json:"file"`
+	Kind    string `json:"kind"` // "namespaces", "snapshot", "delta" or "wal"
+	Records int    `json:"records"`
+	Ignored bool   `json:"ignored,omitempty"` // older than the base: recovery skips it
+}
+
+// VerifyReport is the result of Verify.
+type VerifyReport struct {
+	Files      []VerifiedFile `json:"files"`
+	Keys       int            `json:"keys"`
+	Tombstones int            `json:"tombstones"`
+	Unchecked  int            `json:"unchecked"` // WAL lines from before checksums
+	Problems   []Problem      `json:"problems,omitempty"`
+}
+
+// OK reports whether no problem was found.
+func (r *VerifyReport) OK() bool { return len(r.Problems) == 0 }
+
+func (r *VerifyReport) problem(p Problem) { r.Problems = append(r.Problems, p) }
+
+// Verify checks the data directory of a stopped node. The error is for
+// a directory it cannot read at all; damage goes into the report.
+func Verify(dataDir string) (*VerifyReport, error) {
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, err
+	}
+	r := &VerifyReport{}
+	state := make(map[string]Value)
+
+	// Namespaces.
+	if data, err := os.ReadFile(filepath.Join(dataDir, "namespaces.json")); err == nil {
+		var list []Namespace
+		if err := json.Unmarshal(data, &list); err != nil {
+			r.problem(Problem{File: "namespaces.json", Offset: jsonOffset(err), Msg: err.Error()})
+		}
+		r.Files = append(r.Files, VerifiedFile{File: "namespaces.json", Kind: "namespaces", Records: len(list)})
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Snapshot chain: the newest base and the deltas after it.
+	files, err := listChain(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	base := -1
+	for i, f := range files {
+		if f.full {
+			base = i
+		}
+	}
+	for i, f := range files {
+		name := filepath.Base(f.path)
+		vf := VerifiedFile{File: name, Kind: "delta", Ignored: i < base}
+		if f.full {
+			vf.Kind = "snapshot"
+		}
+		if base < 0 {
+			r.problem(Problem{File: name, Msg: "delta snapshot without a base snapshot"})
+		}
+		n, err := verifySnapshotFile(f.path, state, !vf.Ignored && base >= 0)
+		if err != nil {
+			r.problem(Problem{File: name, Offset: jsonOffset(err), Msg: "does not decode: " + err.Error()})
+		}
+		vf.Records = n
+		r.Files = append(r.Files, vf)
+	}
+
+	// WAL: sealed segments, then wal.log.
+	walPath := filepath.Join(dataDir, "wal.log")
+	segs, err := sealedSegments(walPath)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(segs)+1)
+	for _, seg := range segs {
+		paths = append(paths, seg.path)
+	}
+	if _, err := os.Stat(walPath); err == nil {
+		paths = append(paths, walPath)
+	}
+	for _, path := range paths {
+		n, err := r.verifyWAL(path, state)
+		if err != nil {
+			return nil, err
+		}
+		r.Files = append(r.Files, VerifiedFile{File: filepath.Base(path), Kind: "wal", Records: n})
+	}
+
+	// Final state.
+	for k, v := range state {
+		if v.Tombstone {
+			r.Tombstones++
+		} else {
+			r.Keys++
+		}
+		if len(v.Clock) == 0 {
+			r.problem(Problem{File: "(replayed state)", Key: k, Msg: "value has no vector clock"})
+		}
+		if _, err := v.Decode(); err != nil {
+			r.problem(Problem{File: "(replayed state)", Key: k, Msg: "value does not decode: " + err.Error()})
+		}
+	}
+	return r, nil
+}
+
+// verifySnapshotFile decodes one snapshot file, applying it to state if
+// apply. It returns the number of records.
+func verifySnapshotFile(path string, state map[string]Value, apply bool) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var snapshot map[string]*Value
+	if err := json.NewDecoder(bufio.NewReader(f)).Decode(&snapshot); err != nil {
+		return 0, err
+	}
+	if apply {
+		for k, v := range snapshot {
+			if v == nil {
+				delete(state, NamespacedKey(SplitKey(k))) // evicted
+				continue
+			}
+			state[NamespacedKey(SplitKey(k))] = *v
+		}
+	}
+	return len(snapshot), nil
+}
+
+// verifyWAL checks every line of one WAL file and replays the good ones
+// into state. It returns the number of good entries.
+func (r *VerifyReport) verifyWAL(path string, state map[string]Value) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+	br := bufio.NewReaderSize(f, 64<<10)
+	var off int64
+	good := 0
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		at := Problem{File: name, Line: lineNo, Offset: off}
+		off += int64(len(line))
+		if err == io.EOF {
+			if len(line) > 0 {
+				at.Msg = "last entry has no newline (torn write)"
+				r.problem(at)
+			}
+			return good, nil
+		}
+		if err != nil {
+			return good, err
+		}
+		line = line[:len(line)-1]
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) > maxEntrySize {
+			at.Msg = fmt.Sprintf("entry of %d bytes exceeds the %d byte limit", len(line), maxEntrySize)
+			r.problem(at)
+			continue
+		}
+
+		e, checked, err := parseEntry(line)
+		switch {
+		case errors.Is(err, errChecksum):
+			at.Msg = "checksum mismatch"
+			r.problem(at)
+			continue
+		case err != nil:
+			at.Msg = "not a valid entry: " + err.Error()
+			r.problem(at)
+			continue
+		}
+		if !checked {
+			r.Unchecked++
+		}
+		if e.Op == opBatch && len(e.Batch) == 0 {
+			at.Msg = "empty BATCH entry"
+			r.problem(at)
+			continue
+		}
+
+		// A batch is applied whole or not at all, like on replay.
+		ops := e.ops()
+		bad := false
+		for _, op := range ops {
+			if msg := checkOp(op); msg != "" {
+				at.Key, at.Msg = op.Key, msg
+				r.problem(at)
+				bad = true
+			}
+		}
+		if bad {
+			continue
+		}
+		for _, op := range ops {
+			k := NamespacedKey(SplitKey(op.Key))
+			if op.Op == opEvict {
+				delete(state, k)
+				continue
+			}
+			if prev, ok := state[k]; ok && op.Value.Clock.Compare(prev.Clock) == Before {
+				// Local writes advance the clock and older remote ones are
+				// dropped, so the log never steps back for a key.
+				at.Key, at.Msg = op.Key, "vector clock goes backwards"
+				r.problem(at)
+			}
+			state[k] = op.Value
+		}
+		good++
+	}
+}
+
+// checkOp returns what is wrong with one PUT, DELETE or EVICT entry, or "".
+func checkOp(op walEntry) string {
+	switch {
+	case op.Key == "":
+		return "entry has no key"
+	case op.Op != opPut && op.Op != opDelete && op.Op != opEvict:
+		return fmt.Sprintf("unknown op %q", op.Op)
+	case op.Op == opDelete && !op.Value.Tombstone:
+		return "DELETE entry is not a tombstone"
+	}
+	return ""
+}
+
+// jsonOffset returns where a JSON decode error happened, if known.
+func jsonOffset(err error) int64 {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		return syntax.Offset
+	case errors.As(err, &typ):
+		return typ.Offset
+	}
+	return 0
+}
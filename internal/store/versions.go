@@ -0,0 +1,99 @@
+package store
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Version history: a namespace with Versions = K keeps, besides each
+// key's current value, the last K values it replaced (tombstones
+// included), newest first. GET /kv/:namespace/:key/versions shows them,
+// GET /kv/:namespace/:key?clock=… reads one back, and putting an old
+// version again is an undo.
+//
+// The history lives in memory only. It is rebuilt from the WAL at
+// startup, so versions written before the last snapshot are gone after
+// a restart; WAL compaction keeps the K+1 writes it needs (wal_compact.go).
+// It is a debugging aid, not a backup.
+
+// MaxVersions bounds Namespace.Versions.
+const MaxVersions = 100
+
+// retention returns how many old versions the namespace of key keeps.
+func (s *Store) retention(key string) int {
+	ns, _ := SplitKey(key)
+	return (*s.versions.Load())[ns]
+}
+
+// refreshRetention republishes the namespaces' Versions settings for
+// set, which holds only the shard lock. Caller must hold s.mu.
+func (s *Store) refreshRetention() {
+	m := make(map[string]int)
+	for name, ns := range s.namespaces {
+		if ns.Versions > 0 {
+			m[name] = ns.Versions
+		}
+	}
+	s.versions.Store(&m)
+}
+
+// keepVersion records old, about to be replaced by v, in key's history.
+// Caller must hold sh.mu.
+func (s *Store) keepVersion(sh *shard, key string, old, v Value) {
+	k := s.retention(key)
+	if k == 0 {
+		delete(sh.history, key)
+		return
+	}
+	if old.Clock.Compare(v.Clock) == Equal {
+		return
+	}
+	h := append([]Value{old}, sh.history[key]...)
+	if len(h) > k {
+		h = h[:k]
+	}
+	sh.history[key] = h
+}
+
+// Versions returns key's current value and its history, newest first,
+// as stored. Empty if the key is unknown here.
+func (s *Store) Versions(key string) []Value {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+
+	cur, ok := sh.data[key]
+	if !ok {
+		return nil
+	}
+	return append([]Value{cur}, sh.history[key]...)
+}
+
+// ParseClock parses a vector clock written as "node1:3,node2:1".
+func ParseClock(s string) (VectorClock, error) {
+	vc := make(VectorClock)
+	for part := range strings.SplitSeq(s, ",") {
+		node, n, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || node == "" {
+			return nil, fmt.Errorf("invalid clock %q: want node:counter pairs", s)
+		}
+		c, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid clock %q: %w", s, err)
+		}
+		vc[node] = c
+	}
+	return vc, nil
+}
+
+// FormatClock writes vc the way ParseClock reads it, nodes sorted.
+func FormatClock(vc VectorClock) string {
+	parts := make([]string, 0, len(vc))
+	for _, node := range slices.Sorted(maps.Keys(vc)) {
+		parts = append(parts, node+":"+strconv.FormatUint(vc[node], 10))
+	}
+	return strings.Join(parts, ",")
+}
@@ -1,10 +1,19 @@
 package store
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // WAL (Write-Ahead Log)
@@ -27,11 +36,41 @@ import (
 // This is fast because disks are very good at sequential writes.
 //
 // This is the same basic idea used by real databases.
+//
+// Segments:
+// A snapshot does not truncate the log after it is written — writes that
+// land while it runs would be lost. Instead, BEFORE copying the map, it
+// seals the log: wal.log is renamed to wal.log.<n> and a fresh wal.log
+// takes the new writes. Once the snapshot file is in place, the sealed
+// segments are deleted. On startup, sealed segments (oldest first) are
+// replayed before wal.log; they are only there if a snapshot failed or
+// the process crashed during one.
+//
+// Group commit:
+// An fsync takes about as long for one line as for a thousand, and the
+// disk can only do so many a second. So appends do not write the file
+// themselves. They queue their line for the WAL's writer goroutine and
+// wait. The writer takes every line queued so far (up to
+// walGroupMaxBytes), writes them with one Write, syncs once, and then
+// tells each waiting appender. While it syncs, new lines queue up for the
+// next group. Under load, many writes share one fsync; a lone write pays
+// for one fsync, as before. append still returns only once its line is
+// on disk, unless --wal-sync says otherwise (see wal_sync.go).
+//
+// Change numbers:
+// The writer also numbers the changes, in the order it writes them: each
+// line gets "seq", the number of its change (of the first one, for a
+// BATCH). They never repeat, across restarts and snapshots: a new log
+// after rotate starts with a SEQ line holding the last number used. The
+// change data capture feed (cdc.go) is read off these numbers.
 
 // These define the type of operation stored in the WAL.
 const (
 	opPut    = "PUT"
 	opDelete = "DELETE"
+	opBatch  = "BATCH" // several PUT/DELETE entries written as one (see txn.go)
+	opEvict  = "EVICT" // key dropped from memory by eviction; no value (see memory.go)
+	opSeq    = "SEQ"   // last change number so far, at the top of a new log; no change
 )
 
 // walEntry represents one line in the WAL file.
@@ -43,10 +82,87 @@ const (
 //
 // We store the full Value so recovery is simple.
 // During replay we just restore it directly into memory.
+//
+// Each line ends with a CRC-32 of the rest of it:
+//
+//	{"op":"PUT","key":"default/a","value":{...},"crc":1234567890}
+//
+// The CRC covers the line as written without its `,"crc":N` suffix.
+// A line that fails it (a flipped bit, a torn write) is skipped on
+// replay; `kvcli admin verify` reports it. Lines written before
+// checksums have none and are accepted as they are.
 type walEntry struct {
-	Op    string `json:"op"`
-	Key   string `json:"key"`
-	Value Value  `json:"value"`
+	Seq   uint64     `json:"seq,omitempty"` // change number; set by the writer
+	Op    string     `json:"op"`
+	Key   string     `json:"key,omitempty"`
+	Value Value      `json:"value,omitzero"`
+	Batch []walEntry `json:"batch,omitempty"` // opBatch only
+}
+
+// ops returns the PUT/DELETE/EVICT entries e stands for: itself, the
+// entries of a batch, or none for a SEQ line.
+func (e walEntry) ops() []walEntry {
+	switch e.Op {
+	case opBatch:
+		return e.Batch
+	case opSeq:
+		return nil
+	}
+	return []walEntry{e}
+}
+
+// lastSeq returns the number of e's last change, or of the last change
+// before it for a SEQ line; 0 for lines written before numbering.
+func (e walEntry) lastSeq() uint64 {
+	if e.Seq == 0 || e.Op == opSeq {
+		return e.Seq
+	}
+	return e.Seq + uint64(max(len(e.ops()), 1)) - 1
+}
+
+// maxEntrySize bounds one WAL line. Values can be 1 MiB and more, far
+// past bufio.Scanner's 64 KiB default.
+const maxEntrySize = 256 << 20
+
+var crcField = []byte(`,"crc":`)
+
+// errChecksum means a WAL line does not match its CRC.
+var errChecksum = errors.New("checksum mismatch")
+
+// withCRC appends the CRC of line (one JSON object) to it.
+func withCRC(line []byte) []byte {
+	sum := crc32.ChecksumIEEE(line)
+	line = append(line[:len(line)-1], crcField...)
+	line = strconv.AppendUint(line, uint64(sum), 10)
+	return append(line, '}')
+}
+
+// stamp appends line, one entry as append encoded it, to buf as a WAL
+// line: numbered seq, with its CRC and a newline.
+func stamp(buf []byte, seq uint64, line []byte) []byte {
+	start := len(buf)
+	buf = append(buf, `{"seq":`...)
+	buf = strconv.AppendUint(buf, seq, 10)
+	buf = append(buf, ',')
+	buf = append(buf, line[1:]...)
+	buf = append(buf[:start], withCRC(buf[start:])...)
+	return append(buf, '\n')
+}
+
+// parseEntry decodes one WAL line, checking its CRC if it has one.
+// checked reports whether it had one.
+func parseEntry(line []byte) (e walEntry, checked bool, err error) {
+	if i := bytes.LastIndex(line, crcField); i >= 0 && bytes.HasSuffix(line, []byte("}")) {
+		if sum, perr := strconv.ParseUint(string(line[i+len(crcField):len(line)-1]), 10, 32); perr == nil {
+			body := append(line[:i:i], '}')
+			if crc32.ChecksumIEEE(body) != uint32(sum) {
+				return e, true, errChecksum
+			}
+			checked = true
+		}
+	}
+	err = json.Unmarshal(line, &e)
+	return e, checked, err
 }
 
 // WAL represents the write-ahead log file.
@@ -54,11 +170,57 @@ type walEntry struct {
 // Fields:
 //   - mu: ensures only one goroutine writes at a time
 //   - file: the open file handle
-//   - path: file location (used for truncate/reopen logic)
+//   - path: file location (used for rotate/reopen logic)
+//   - seq: number of the newest sealed segment
+//   - stats: size and age of the log, for the snapshot policy
+//   - last: the last change number given out; durable: the last one synced
+//   - synced: closed and replaced after every group commit
+//   - retain: bytes of sealed segments kept for change data capture
+//   - compacted: what compactions removed (see wal_compact.go)
+//   - syncMode, syncEvery: see wal_sync.go
 type WAL struct {
-	mu   sync.Mutex
-	file *os.File
-	path string
+	mu      sync.Mutex
+	file    *os.File
+	path    string
+	seq     int
+	stats   WALStats
+	last    uint64
+	durable atomic.Uint64
+	synced  chan struct{}
+	retain  int64
+
+	compacted compactionStats
+
+	syncMode  atomic.Int32 // index into WALSyncModes
+	syncEvery atomic.Int64 // interval mode's period, as a time.Duration
+
+	queueMu sync.RWMutex // held to send on queue; close takes it to close queue
+	closed  bool
+	queue   chan walWrite
+	stopped chan struct{} // closed when the writer has returned
+}
+
+// walWrite is one encoded entry waiting for the writer, which numbers it
+// and adds the CRC and newline.
+type walWrite struct {
+	line    []byte
+	changes uint64     // change numbers it takes
+	done    chan error // buffered: the writer never waits on an appender
+}
+
+const (
+	walQueueSize     = 4096    // lines waiting for the writer
+	walGroupMaxBytes = 4 << 20 // most bytes written by one group commit
+)
+
+// WALStats describes what the WAL holds since the last snapshot.
+type WALStats struct {
+	Bytes     int64
+	Entries   int
+	Commits   int       // group commits that wrote those entries
+	Syncs     int       // fsyncs of those commits (fewer in interval mode)
+	Truncated time.Time // start of the last snapshot (or process start)
+	Oldest    time.Time // first entry since then; zero if empty
 }
 
 // newWAL opens (or creates) the WAL file.
@@ -70,22 +232,161 @@ type WAL struct {
 //	O_APPEND → always write at the end of file
 //
 // We use O_APPEND to guarantee we never overwrite old entries.
+//
+// Sealed segments left over from an unfinished snapshot count towards
+// the stats, so the next snapshot comes soon.
 func newWAL(path string) (*WAL, error) {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	f, err := openLog(path)
 	if err != nil {
 		return nil, err
 	}
-	return &WAL{file: f, path: path}, nil
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &WAL{file: f, path: path, queue: make(chan walWrite, walQueueSize), stopped: make(chan struct{}), synced: make(chan struct{})}
+	w.stats.Bytes, w.stats.Truncated = fi.Size(), time.Now()
+
+	sealed, err := w.sealed()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, seg := range sealed {
+		w.seq = seg.seq
+		if fi, err := os.Stat(seg.path); err == nil {
+			w.stats.Bytes += fi.Size()
+		}
+	}
+	go w.writer()
+	return w, nil
+}
+
+func openLog(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+}
+
+// segment is one sealed log file, wal.log.<seq>.
+type segment struct {
+	seq  int
+	path string
+}
+
+// sealed lists the sealed segments, oldest first.
+func (w *WAL) sealed() ([]segment, error) {
+	return sealedSegments(w.path)
+}
+
+// sealedSegments lists the sealed segments of the log at path.
+func sealedSegments(path string) ([]segment, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var out []segment
+	for _, m := range matches {
+		seq, err := strconv.Atoi(strings.TrimPrefix(m, path+"."))
+		if err != nil {
+			continue // not ours
+		}
+		out = append(out, segment{seq: seq, path: m})
+	}
+	slices.SortFunc(out, func(a, b segment) int { return a.seq - b.seq })
+	return out, nil
 }
 
 // append writes a new entry to the WAL.
 //
 // Steps:
-//  1. Lock (only one writer allowed)
-//  2. Convert entry to JSON
-//  3. Add newline (so each entry is one line)
-//  4. Write to file
-//  5. Call Sync() to flush to disk
+//  1. Convert entry to JSON
+//  2. Queue it for the writer (see Group commit above), which numbers
+//     it, adds the CRC and a newline (so each entry is one line)
+//  3. Wait until the writer has written and synced it
+//
+// The store locks per shard, so several writers may append at once;
+// their lines go out in the order they were queued. Encoding happens
+// here, in the caller, so the writer only stamps and copies bytes.
+func (w *WAL) append(entry walEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	wr := walWrite{line: data, changes: uint64(max(len(entry.ops()), 1)), done: make(chan error, 1)}
+
+	w.queueMu.RLock()
+	if w.closed {
+		w.queueMu.RUnlock()
+		return os.ErrClosed
+	}
+	w.queue <- wr
+	w.queueMu.RUnlock()
+	return <-wr.done
+}
+
+// writer commits queued lines in groups until the queue is closed.
+//
+// In interval mode it also syncs: tick is armed by the first commit
+// left unsynced, and fires a sync an interval later.
+func (w *WAL) writer() {
+	defer close(w.stopped)
+	var (
+		group    []walWrite
+		buf      []byte
+		tick     <-chan time.Time
+		syncFail error // of the last periodic sync, for the next group
+	)
+	for {
+		var first walWrite
+		select {
+		case wr, ok := <-w.queue:
+			if !ok {
+				if tick != nil {
+					w.syncWritten()
+				}
+				return
+			}
+			first = wr
+		case <-tick:
+			tick = nil
+			if syncFail = w.syncWritten(); syncFail != nil {
+				tick = time.After(time.Duration(w.syncEvery.Load()))
+			}
+			continue
+		}
+
+		mode := w.mode()
+		group = append(group[:0], first)
+		size := len(first.line)
+	more:
+		for mode != WALSyncAlways && size < walGroupMaxBytes {
+			select {
+			case wr, ok := <-w.queue:
+				if !ok {
+					break more
+				}
+				group, size = append(group, wr), size+len(wr.line)
+			default:
+				break more
+			}
+		}
+		var err error
+		buf, err = w.commit(group, buf[:0], mode != WALSyncInterval)
+		if err == nil && mode == WALSyncInterval {
+			err, syncFail = syncFail, nil
+			if tick == nil {
+				tick = time.After(time.Duration(w.syncEvery.Load()))
+			}
+		}
+		for _, wr := range group {
+			wr.done <- err
+		}
+		clear(group) // let the lines be collected
+	}
+}
+
+// commit numbers one group of entries, writes them (into buf) and, with
+// sync, syncs them. It returns buf for reuse.
 //
 // Why Sync() is important:
 //
@@ -96,93 +397,209 @@ func newWAL(path string) (*WAL, error) {
 // could lose the last write even though Write() succeeded.
 //
 // This is what makes the WAL durable.
-func (w *WAL) append(entry walEntry) error {
+//
+// Numbers are given out under w.mu, with the write, so they are in file
+// order across rotations. A failed write leaves a gap in them.
+func (w *WAL) commit(group []walWrite, buf []byte, sync bool) ([]byte, error) {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	data, err := json.Marshal(entry)
-	if err != nil {
-		return err
+	for _, wr := range group {
+		buf = stamp(buf, w.last+1, wr.line)
+		w.last += wr.changes
+	}
+	last := w.last
+	f := w.file
+	n, err := f.Write(buf)
+	w.stats.Bytes += int64(n)
+	if err == nil {
+		if w.stats.Entries == 0 {
+			w.stats.Oldest = time.Now()
+		}
+		w.stats.Entries += len(group)
+		w.stats.Commits++
+	}
+	w.mu.Unlock()
+	if err != nil || !sync {
+		return buf, err
+	}
+	if err := w.sync(f); err != nil {
+		return buf, err
 	}
-	data = append(data, '\n')
+	w.markDurable(last)
+	return buf, nil
+}
 
-	if _, err := w.file.Write(data); err != nil {
+// sync syncs f, the log as of a commit, and counts it.
+func (w *WAL) sync(f *os.File) error {
+	// Sync runs outside the lock, so a snapshot can rotate meanwhile.
+	if err := f.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
 		return err
 	}
-	return w.file.Sync() // ensures data is physically written to disk
+	// ErrClosed: rotate sealed f in between, after syncing it.
+	w.mu.Lock()
+	w.stats.Syncs++
+	w.mu.Unlock()
+	return nil
 }
 
-// readAll reads the entire WAL file from the beginning.
+// readAll reads every sealed segment, then the current log, from the
+// beginning, and hands each entry to fn.
 //
 // Used during startup to replay operations.
 //
 // Steps:
-//  1. Seek to beginning of file
+//  1. Open each sealed segment (oldest first), then seek to the
+//     beginning of the current log
 //  2. Read line by line
-//  3. Parse each JSON line
-//  4. Return all entries in order
+//  3. Parse each JSON line (on every core, see replay.go)
+//  4. Hand the entries to fn in order
 //
 // Important:
 // Entries must be applied in the same order they were written.
 // Order matters because later writes override earlier ones.
-func (w *WAL) readAll() ([]walEntry, error) {
+func (w *WAL) readAll(rec *Recovery, fn func(walEntry)) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	// Move file pointer to beginning before reading.
-	if _, err := w.file.Seek(0, 0); err != nil {
-		return nil, err
+	sealed, err := w.sealed()
+	if err != nil {
+		return err
 	}
-
-	var entries []walEntry
-	scanner := bufio.NewScanner(w.file)
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		if len(line) == 0 {
-			continue
+	count := func(e walEntry) {
+		w.last = max(w.last, e.lastSeq())
+		if e.Op != opSeq {
+			w.stats.Entries++
 		}
-
-		var e walEntry
-		if err := json.Unmarshal(line, &e); err != nil {
-			// If one line is corrupted, we skip it.
-			// In a real production system, we would likely stop
-			// and raise an alert instead of silently skipping.
-			continue
+		fn(e)
+	}
+	for _, seg := range sealed {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return err
+		}
+		rec.enter(RecoveryWAL, filepath.Base(seg.path))
+		err = decodeEntries(rec.reader(f), count)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(seg.path), err)
 		}
-		entries = append(entries, e)
 	}
 
-	return entries, scanner.Err()
+	// Move file pointer to beginning before reading.
+	if _, err := w.file.Seek(0, 0); err != nil {
+		return err
+	}
+	rec.enter(RecoveryWAL, filepath.Base(w.path))
+	err = decodeEntries(rec.reader(w.file), count)
+	if w.stats.Entries > 0 {
+		w.stats.Oldest = time.Now()
+	}
+	w.durable.Store(w.last)
+	return err
 }
 
-// truncate clears the WAL file.
+// rotate seals the current log as wal.log.<n> and opens an empty one.
+// It returns n.
 //
 // When do we call this?
-// After taking a snapshot.
+// At the START of a snapshot, before the map is copied.
 //
 // Why?
-// Because the snapshot already contains all data.
-// So old WAL entries are no longer needed.
+// Every entry in a sealed segment was applied to memory before rotate
+// (writers append and apply under their shard lock), so the snapshot
+// that copies the map afterwards contains it. Entries written later go
+// to the new log and survive the snapshot, even if they were appended
+// while it ran. Some of those may be in the snapshot too; replaying
+// them again is harmless.
 //
-// Instead of deleting the file,
-// we truncate it (set size to 0).
-// This keeps the file handle open and simplifies logic.
-func (w *WAL) truncate() error {
+// truncate says a snapshot is starting, so the stats start over; a
+// compaction (wal_compact.go) keeps them.
+func (w *WAL) rotate(truncate bool) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Sync first: an appender may have written without syncing yet, and
+	// will find the file closed.
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	seq := w.seq + 1
+	sealedPath := fmt.Sprintf("%s.%d", w.path, seq)
+	if err := os.Rename(w.path, sealedPath); err != nil {
+		return 0, err
+	}
+	f, err := openLog(w.path)
+	if err != nil {
+		// Keep appending to the old file, under its old name.
+		if rerr := os.Rename(sealedPath, w.path); rerr != nil {
+			return 0, errors.Join(err, rerr)
+		}
+		return 0, err
+	}
+	w.file.Close()
+	w.file, w.seq = f, seq
+	if truncate {
+		w.stats = WALStats{Truncated: time.Now()}
+	}
+
+	// Replay may not see the sealed segment again: carry the numbering.
+	if w.last > 0 {
+		line, err := json.Marshal(walEntry{Op: opSeq, Seq: w.last})
+		if err == nil {
+			_, err = f.Write(append(withCRC(line), '\n'))
+		}
+		if err == nil {
+			err = f.Sync()
+		}
+		if err != nil {
+			return 0, fmt.Errorf("number new log: %w", err)
+		}
+	}
+	return seq, nil
+}
+
+// removeSealed deletes the sealed segments up to seq, once a snapshot
+// containing them is on disk. With a CDC retention they are kept as
+// wal.log.cdc-<n> instead, which replay ignores, and the oldest of those
+// go once they add up to more than it.
+func (w *WAL) removeSealed(seq int) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if err := w.file.Truncate(0); err != nil {
+	sealed, err := w.sealed()
+	if err != nil {
 		return err
 	}
+	for _, seg := range sealed {
+		if seg.seq > seq {
+			break
+		}
+		if err := w.retire(seg); err != nil {
+			return err
+		}
+	}
+	return w.pruneRetained()
+}
 
-	// Move file pointer back to start.
-	_, err := w.file.Seek(0, 0)
-	return err
+// currentStats returns the WAL stats.
+func (w *WAL) currentStats() WALStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
 }
 
-// close closes the WAL file.
+// close stops the writer, once it has committed every queued line, and
+// closes the WAL file. Appends after close fail with os.ErrClosed.
 // Should be called during graceful shutdown.
 func (w *WAL) close() error {
+	w.queueMu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.queueMu.Unlock()
+	<-w.stopped
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.file.Close()
 }
@@ -0,0 +1,331 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"distributed-kvstore/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// ─── WAL compaction ───────────────────────────────────────────────────────────
+//
+// Between snapshots the WAL keeps every write. A workload that updates a
+// few keys over and over logs thousands of versions of each, and replay
+// applies them all to keep the last. A snapshot fixes that but copies
+// the whole data set; compaction rewrites only the log:
+//
+//  1. Seal the live log, as a snapshot does (wal.log → wal.log.<n>).
+//  2. Read the sealed segments to count each key's writes.
+//  3. Write the last of each, in log order, to wal.log.compact.tmp; sync
+//     it.
+//  4. Rename it over wal.log.<n>, then delete the older segments.
+//
+// A crash before 4 leaves the segments as they were; one during 4 leaves
+// the compacted segment after the older ones, which replays to the same
+// state. Snapshots and compactions take turns (s.snapshotMu), and the
+// stats the snapshot policy reads shrink with the log, so a compacted
+// log snapshots later.
+//
+// A namespace with Versions = K (versions.go) keeps each key's last K+1
+// writes instead: the history is rebuilt from the log at startup, and
+// undelete (cluster/undelete.go) restores from it. K is the namespace's
+// setting when the compaction runs.
+//
+// A batch is kept whole while all its writes are kept;
+// otherwise what is left of it is written as single entries under their
+// own change numbers. Lines that fail their checksum are dropped, as
+// replay skips them anyway.
+//
+// The CDC feed (cdc.go) loses the changes compaction drops. Where the
+// numbering skips, the compacted segment has a SEQ line, so a consumer
+// that wanted them gets ErrChangesGone instead of a silent gap. With
+// --cdc-retention the segments as they were are kept first, as
+// wal.log.cdc-<n>, and the feed reads those.
+
+// WALCompaction describes one compaction.
+type WALCompaction struct {
+	Segments int   // sealed segments merged
+	Before   int64 // their bytes
+	After    int64 // bytes of the compacted segment
+	Writes   int   // writes read
+	Kept     int   // writes kept
+}
+
+// compactionStats is what compactions have done since the process started.
+type compactionStats struct {
+	last  atomic.Int64 // UnixNano of the last one
+	saved atomic.Int64 // bytes removed from the log
+}
+
+// CompactWAL rewrites the WAL keeping only the last write of each key,
+// and the writes its version history holds. It waits for a snapshot in
+// progress, and the next one waits for it.
+func (s *Store) CompactWAL() (WALCompaction, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	return s.wal.compact(s.retention)
+}
+
+// RunWALCompaction compacts the WAL whenever it has grown by every bytes
+// since the last compaction or snapshot, until ctx is done. 0 = never.
+func (s *Store) RunWALCompaction(ctx context.Context, every int64) {
+	if every <= 0 {
+		return
+	}
+	logger := logging.FromContext(ctx)
+	ticker := time.NewTicker(snapshotCheckInterval)
+	defer ticker.Stop()
+
+	var (
+		base      int64     // log bytes after the last compaction
+		truncated time.Time // start of the snapshot base was measured after
+	)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			st := s.WALStats()
+			if !st.Truncated.Equal(truncated) {
+				base, truncated = 0, st.Truncated // a snapshot emptied the log
+			}
+			if st.Bytes-base < every {
+				continue
+			}
+			c, err := s.CompactWAL()
+			if err != nil {
+				// Retry once the log has grown as much again.
+				base = st.Bytes
+				logger.Error("wal compaction failed", "error", err)
+				continue
+			}
+			st = s.WALStats()
+			base, truncated = st.Bytes, st.Truncated
+			logger.Info("wal compacted", "segments", c.Segments, "bytes", c.Before, "to", c.After,
+				"writes", c.Writes, "kept", c.Kept, "took", time.Since(now))
+		}
+	}
+}
+
+// compact seals the live log and merges the sealed segments into the
+// newest one, keeping the last 1+retention(key) writes of each key.
+// Caller holds s.snapshotMu, so no segment is sealed or removed
+// meanwhile.
+func (w *WAL) compact(retention func(key string) int) (WALCompaction, error) {
+	var c WALCompaction
+	if _, err := w.rotate(false); err != nil {
+		return c, fmt.Errorf("seal wal: %w", err)
+	}
+	segs, err := w.sealed()
+	if err != nil || len(segs) == 0 {
+		return c, err
+	}
+	c.Segments = len(segs)
+
+	// Pass 1: how many writes each key has.
+	left := make(map[string]int)
+	lines := 0
+	err = eachSegmentEntry(segs, func(e walEntry, _ []byte) error {
+		if e.Op != opSeq {
+			lines++
+		}
+		for _, op := range e.ops() {
+			left[NamespacedKey(SplitKey(op.Key))]++
+			c.Writes++
+		}
+		return nil
+	})
+	if err != nil {
+		return c, err
+	}
+
+	// Pass 2: write them.
+	tmp := w.path + ".compact.tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return c, err
+	}
+	out := &compactWriter{w: bufio.NewWriterSize(f, 1<<20)}
+	err = eachSegmentEntry(segs, func(e walEntry, line []byte) error {
+		ops := e.ops()
+		keep := make([]bool, len(ops))
+		n := 0
+		for i, op := range ops {
+			key := NamespacedKey(SplitKey(op.Key))
+			if left[key] <= 1+retention(key) {
+				keep[i] = true
+				n++
+			}
+			left[key]--
+		}
+		c.Kept += n
+		return out.entry(e, line, keep, n)
+	})
+	if err == nil {
+		err = out.end()
+	}
+	if err == nil {
+		err = out.w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return c, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, seg := range segs {
+		if fi, err := os.Stat(seg.path); err == nil {
+			c.Before += fi.Size()
+		}
+	}
+	if fi, err := os.Stat(tmp); err == nil {
+		c.After = fi.Size()
+	}
+	newest := segs[len(segs)-1]
+	if w.retain > 0 {
+		if err := os.Link(newest.path, w.retainedPath(newest.seq)); err != nil && !errors.Is(err, os.ErrExist) {
+			os.Remove(tmp)
+			return c, err
+		}
+	}
+	if err := os.Rename(tmp, newest.path); err != nil {
+		return c, err
+	}
+	for _, seg := range segs[:len(segs)-1] {
+		if err := w.retire(seg); err != nil {
+			return c, err
+		}
+	}
+
+	w.stats.Bytes += c.After - c.Before
+	w.stats.Entries += out.lines - lines
+	w.compacted.last.Store(time.Now().UnixNano())
+	w.compacted.saved.Add(c.Before - c.After)
+	return c, w.pruneRetained()
+}
+
+// eachSegmentEntry calls fn with every entry of segs, in order, and the
+// line it was read from. Lines that fail to parse are skipped.
+func eachSegmentEntry(segs []segment, fn func(e walEntry, line []byte) error) error {
+	for _, seg := range segs {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return err
+		}
+		sc := bufio.NewScanner(f)
+		sc.Buffer(make([]byte, 64<<10), maxEntrySize)
+		for sc.Scan() {
+			if e, ok := parseLine(sc.Bytes()); ok {
+				if err = fn(e, sc.Bytes()); err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			err = sc.Err()
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(seg.path), err)
+		}
+	}
+	return nil
+}
+
+// compactWriter writes the kept entries of a compaction, with a SEQ line
+// wherever the change numbers skip.
+type compactWriter struct {
+	w     *bufio.Writer
+	next  uint64 // the change number the last entry written leads to; 0 = none yet
+	last  uint64 // the last change number read
+	lines int    // entries written, SEQ lines aside
+}
+
+// entry writes what is kept of e: its line if all of it (keep[i] for
+// each op, n of them), else the kept ops one by one.
+func (cw *compactWriter) entry(e walEntry, line []byte, keep []bool, n int) error {
+	cw.last = max(cw.last, e.lastSeq())
+	switch {
+	case e.Op == opSeq || n == 0:
+		return nil
+	case n == len(keep):
+		return cw.write(e.Seq, e.lastSeq(), line)
+	}
+	for i, op := range e.ops() {
+		if !keep[i] {
+			continue
+		}
+		if e.Seq > 0 {
+			op.Seq = e.Seq + uint64(i)
+		}
+		data, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		if err := cw.write(op.Seq, op.Seq, withCRC(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes line, numbered first to last (0 for lines written before
+// numbering).
+func (cw *compactWriter) write(first, last uint64, line []byte) error {
+	if first > 0 && first != max(cw.next, 1) {
+		if err := cw.seq(first - 1); err != nil {
+			return err
+		}
+	}
+	cw.w.Write(line)
+	cw.w.WriteByte('\n')
+	if last > 0 {
+		cw.next = last + 1
+	}
+	cw.lines++
+	return nil
+}
+
+// end numbers the changes dropped after the last entry written.
+func (cw *compactWriter) end() error {
+	if cw.last > 0 && cw.next != cw.last+1 {
+		return cw.seq(cw.last)
+	}
+	return nil
+}
+
+func (cw *compactWriter) seq(last uint64) error {
+	line, err := json.Marshal(walEntry{Op: opSeq, Seq: last})
+	if err != nil {
+		return err
+	}
+	cw.w.Write(withCRC(line))
+	_, err = cw.w.WriteString("\n")
+	cw.next = last + 1
+	return err // bufio.Writer keeps the first error
+}
+
+// retire removes a sealed segment replay no longer needs, keeping it as
+// wal.log.cdc-<n> with a CDC retention (unless a compaction kept it
+// already). Caller holds w.mu.
+func (w *WAL) retire(seg segment) error {
+	if w.retain > 0 {
+		if _, err := os.Stat(w.retainedPath(seg.seq)); errors.Is(err, os.ErrNotExist) {
+			return os.Rename(seg.path, w.retainedPath(seg.seq))
+		}
+	}
+	return os.Remove(seg.path)
+}
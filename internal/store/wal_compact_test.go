@@ -0,0 +1,52 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestCompactWALKeepsHistory(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir, "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PutNamespace(Namespace{Name: "audit", Versions: 2}); err != nil {
+		t.Fatal(err)
+	}
+	kept, plain := NamespacedKey("audit", "k"), NamespacedKey(DefaultNamespace, "k")
+	for i := range 5 {
+		for _, key := range []string{kept, plain} {
+			if _, err := s.Put(context.Background(), key, fmt.Sprint("v", i), "", nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	c, err := s.CompactWAL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Writes != 10 || c.Kept != 3+1 {
+		t.Errorf("compaction kept %d of %d writes, want 4 of 10", c.Kept, c.Writes)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = New(dir, "n1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for key, want := range map[string][]string{kept: {"v4", "v3", "v2"}, plain: {"v4"}} {
+		var got []string
+		for _, v := range s.Versions(key) {
+			got = append(got, v.Data)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s after reopen: versions %v, want %v", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ─── WAL sync modes ───────────────────────────────────────────────────────────
+//
+// When a write returns, its WAL line is on disk: that is what group
+// commit (wal.go) keeps cheap. --wal-sync picks where the store stands
+// between durability and fsyncs:
+//
+//   - group (default): a write waits for the fsync of its group; writers
+//     that queue while one runs share the next.
+//   - always: every entry gets its own fsync. No write waits on another's
+//     group, but writers take turns at the disk: throughput is at most
+//     one write per fsync.
+//   - interval: a write returns once its line is written to the file,
+//     and the writer syncs every --wal-sync-interval. A crash of the
+//     process loses nothing (the OS has the lines); a crash of the
+//     machine loses up to an interval of acknowledged writes.
+//
+// In every mode the change feed (cdc.go) only hands out changes once
+// they are synced. A periodic sync that fails is retried at the next
+// tick, and fails the writes of the next group commit, so the error is
+// not lost with the goroutine that hit it.
+
+// WAL sync modes.
+const (
+	WALSyncGroup    = "group"
+	WALSyncAlways   = "always"
+	WALSyncInterval = "interval"
+)
+
+// WALSyncModes lists the modes, default first.
+var WALSyncModes = []string{WALSyncGroup, WALSyncAlways, WALSyncInterval}
+
+// DefaultWALSyncInterval is how often interval mode syncs by default.
+const DefaultWALSyncInterval = 10 * time.Millisecond
+
+// SetWALSync sets the WAL sync mode, and how often interval mode syncs.
+func (s *Store) SetWALSync(mode string, interval time.Duration) error {
+	if mode == "" {
+		mode = WALSyncGroup
+	}
+	i := slices.Index(WALSyncModes, mode)
+	if i < 0 {
+		return fmt.Errorf("unknown WAL sync mode %q: expected group, always or interval", mode)
+	}
+	if mode == WALSyncInterval && interval <= 0 {
+		return errors.New("WAL sync interval must be positive")
+	}
+	s.wal.syncEvery.Store(int64(interval))
+	s.wal.syncMode.Store(int32(i))
+	return nil
+}
+
+// WALSync returns the WAL sync mode and the interval of interval mode.
+func (s *Store) WALSync() (mode string, interval time.Duration) {
+	return s.wal.mode(), time.Duration(s.wal.syncEvery.Load())
+}
+
+func (w *WAL) mode() string {
+	return WALSyncModes[w.syncMode.Load()]
+}
+
+// syncWritten syncs what commit wrote without syncing, in interval mode.
+func (w *WAL) syncWritten() error {
+	w.mu.Lock()
+	f, last := w.file, w.last
+	w.mu.Unlock()
+	if last <= w.durable.Load() {
+		return nil
+	}
+	if err := w.sync(f); err != nil {
+		return err
+	}
+	w.markDurable(last)
+	return nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWALSyncModes(t *testing.T) {
+	for _, mode := range WALSyncModes {
+		t.Run(mode, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := New(dir, "n1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetWALSync(mode, time.Millisecond); err != nil {
+				t.Fatal(err)
+			}
+			const writes = 50
+			var wg sync.WaitGroup
+			for i := range writes {
+				wg.Go(func() {
+					if _, err := s.Put(context.Background(), NamespacedKey(DefaultNamespace, fmt.Sprint(i)), "v", "", nil); err != nil {
+						t.Error(err)
+					}
+				})
+			}
+			wg.Wait()
+
+			// Every mode syncs eventually; the change feed waits for it.
+			deadline := time.Now().Add(time.Second)
+			for s.ChangeSeq() < writes && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			if got := s.ChangeSeq(); got != writes {
+				t.Errorf("synced changes = %d, want %d", got, writes)
+			}
+			st := s.WALStats()
+			if mode == WALSyncAlways && st.Syncs != writes {
+				t.Errorf("always: %d fsyncs for %d writes", st.Syncs, writes)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err = New(dir, "n1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if got := len(s.Keys(DefaultNamespace)); got != writes {
+				t.Errorf("after reopen: %d keys, want %d", got, writes)
+			}
+		})
+	}
+}
+
+func TestSetWALSync(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.SetWALSync("sometimes", 0); err == nil {
+		t.Error("unknown mode accepted")
+	}
+	if err := s.SetWALSync(WALSyncInterval, 0); err == nil {
+		t.Error("interval mode without an interval accepted")
+	}
+	if err := s.SetWALSync(WALSyncInterval, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if mode, every := s.WALSync(); mode != WALSyncInterval || every != 5*time.Millisecond {
+		t.Errorf("WALSync() = %s, %s", mode, every)
+	}
+}
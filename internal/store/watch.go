@@ -0,0 +1,104 @@
+package store
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ─── Change feed ──────────────────────────────────────────────────────────────
+//
+// Watch subscribes to what this node's store applies: local puts and
+// deletes, replicated copies, transactions and batches. All of them go
+// through set, which publishes to the watchers. Keys evicted to stay
+// under --max-memory (memory.go) are published too, marked Evicted.
+//
+// Publishing never blocks a write. Each watcher has a buffer; one that
+// falls further behind is cut off (its channel closed, Overflowed true)
+// and must subscribe again. Changes of one key arrive in the order they
+// were applied.
+
+// watchBuffer is the number of changes a watcher may fall behind by.
+const watchBuffer = 1024
+
+// Change is one applied write. Value is as stored: possibly compressed,
+// a tombstone for deletes.
+type Change struct {
+	Key     string // internal key
+	Value   Value
+	Evicted bool // dropped by this node's eviction; Value is the last one it held
+}
+
+// Watcher receives the changes of the keys under a prefix.
+type Watcher struct {
+	C <-chan Change
+
+	ch       chan Change
+	prefix   string
+	hub      *watchHub
+	overflow atomic.Bool
+	once     sync.Once
+}
+
+// Overflowed reports whether C was closed because the watcher fell
+// behind, rather than by Close.
+func (w *Watcher) Overflowed() bool { return w.overflow.Load() }
+
+// Close unsubscribes w and closes C.
+func (w *Watcher) Close() {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+	w.hub.remove(w)
+}
+
+type watchHub struct {
+	mu   sync.Mutex
+	subs map[*Watcher]struct{}
+	n    atomic.Int32 // len(subs), read without mu on every write
+}
+
+// Watch subscribes to the changes of the internal keys starting with
+// prefix. Close the watcher when done.
+func (s *Store) Watch(prefix string) *Watcher {
+	ch := make(chan Change, watchBuffer)
+	w := &Watcher{C: ch, ch: ch, prefix: prefix, hub: &s.watchers}
+
+	s.watchers.mu.Lock()
+	defer s.watchers.mu.Unlock()
+	if s.watchers.subs == nil {
+		s.watchers.subs = make(map[*Watcher]struct{})
+	}
+	s.watchers.subs[w] = struct{}{}
+	s.watchers.n.Add(1)
+	return w
+}
+
+// publish hands a change to the watchers of key. Called by set, under
+// the key's shard lock.
+func (h *watchHub) publish(ch Change) {
+	if h.n.Load() == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.subs {
+		if !strings.HasPrefix(ch.Key, w.prefix) {
+			continue
+		}
+		select {
+		case w.ch <- ch:
+		default:
+			w.overflow.Store(true)
+			h.remove(w)
+		}
+	}
+}
+
+// remove unsubscribes w. Caller must hold h.mu.
+func (h *watchHub) remove(w *Watcher) {
+	w.once.Do(func() {
+		delete(h.subs, w)
+		h.n.Add(-1)
+		close(w.ch)
+	})
+}
@@ -0,0 +1,335 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Just enough MessagePack for our schema: maps, arrays, strings, binary,
+// unsigned ints, bools and timestamps — plus skipping anything else.
+
+func appendBE16(b []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(b, v) }
+func appendBE32(b []byte, v uint32) []byte { return binary.BigEndian.AppendUint32(b, v) }
+func appendBE64(b []byte, v uint64) []byte { return binary.BigEndian.AppendUint64(b, v) }
+
+func appendMapLen(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return appendBE16(append(b, 0xde), uint16(n))
+	}
+	return appendBE32(append(b, 0xdf), uint32(n))
+}
+
+func appendArrayLen(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return appendBE16(append(b, 0xdc), uint16(n))
+	}
+	return appendBE32(append(b, 0xdd), uint32(n))
+}
+
+func appendStr(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = appendBE16(append(b, 0xda), uint16(n))
+	default:
+		b = appendBE32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendBin(b []byte, p []byte) []byte {
+	switch n := len(p); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = appendBE16(append(b, 0xc5), uint16(n))
+	default:
+		b = appendBE32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, p...)
+}
+
+func appendUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return appendBE16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return appendBE32(append(b, 0xce), uint32(v))
+	}
+	return appendBE64(append(b, 0xcf), v)
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+// decoder reads msgpack from buf. Every method checks bounds and
+// returns ErrMalformed instead of panicking on truncated input.
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w at byte %d: %s", ErrMalformed, d.pos, fmt.Sprintf(format, args...))
+}
+
+func (d *decoder) nextIsNil() bool {
+	return d.pos < len(d.buf) && d.buf[d.pos] == 0xc0
+}
+
+// take returns the next n bytes.
+func (d *decoder) take(n int) ([]byte, error) {
+	if n < 0 || len(d.buf)-d.pos < n {
+		return nil, d.errorf("truncated")
+	}
+	p := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return p, nil
+}
+
+func (d *decoder) readByte() (byte, error) {
+	p, err := d.take(1)
+	if err != nil {
+		return 0, err
+	}
+	return p[0], nil
+}
+
+// length reads a big-endian length of size bytes (1, 2 or 4).
+func (d *decoder) length(size int) (int, error) {
+	p, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int(p[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(p)), nil
+	}
+	return int(binary.BigEndian.Uint32(p)), nil
+}
+
+func (d *decoder) mapLen() (int, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c&0xf0 == 0x80:
+		return int(c & 0x0f), nil
+	case c == 0xde:
+		return d.length(2)
+	case c == 0xdf:
+		return d.length(4)
+	}
+	return 0, d.errorf("expected map, got 0x%02x", c)
+}
+
+func (d *decoder) arrayLen() (int, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c&0xf0 == 0x90:
+		return int(c & 0x0f), nil
+	case c == 0xdc:
+		return d.length(2)
+	case c == 0xdd:
+		return d.length(4)
+	}
+	return 0, d.errorf("expected array, got 0x%02x", c)
+}
+
+func (d *decoder) str() (string, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return "", err
+	}
+	var n int
+	switch {
+	case c&0xe0 == 0xa0:
+		n = int(c & 0x1f)
+	case c == 0xd9:
+		n, err = d.length(1)
+	case c == 0xda:
+		n, err = d.length(2)
+	case c == 0xdb:
+		n, err = d.length(4)
+	default:
+		return "", d.errorf("expected string, got 0x%02x", c)
+	}
+	if err != nil {
+		return "", err
+	}
+	p, err := d.take(n)
+	return string(p), err
+}
+
+func (d *decoder) bin() ([]byte, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var n int
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc4:
+		n, err = d.length(1)
+	case 0xc5:
+		n, err = d.length(2)
+	case 0xc6:
+		n, err = d.length(4)
+	default:
+		return nil, d.errorf("expected binary, got 0x%02x", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), p...), nil // don't alias the request buffer
+}
+
+func (d *decoder) uint() (uint64, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	if c < 0x80 {
+		return uint64(c), nil
+	}
+	if c < 0xcc || c > 0xcf {
+		return 0, d.errorf("expected unsigned int, got 0x%02x", c)
+	}
+	size := 1 << (c - 0xcc) // 0xcc..0xcf → 1, 2, 4, 8 bytes
+	p, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, x := range p {
+		v = v<<8 | uint64(x)
+	}
+	return v, nil
+}
+
+func (d *decoder) bool() (bool, error) {
+	c, err := d.readByte()
+	if err != nil {
+		return false, err
+	}
+	switch c {
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	}
+	return false, d.errorf("expected bool, got 0x%02x", c)
+}
+
+// time reads the 96-bit timestamp written by appendTime.
+func (d *decoder) time() (time.Time, error) {
+	p, err := d.take(3)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if p[0] != 0xc7 || p[1] != 12 || int8(p[2]) != timeExt {
+		return time.Time{}, d.errorf("expected timestamp")
+	}
+	p, err = d.take(12)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nsec := binary.BigEndian.Uint32(p[:4])
+	sec := int64(binary.BigEndian.Uint64(p[4:]))
+	return time.Unix(sec, int64(nsec)).UTC(), nil
+}
+
+// skip consumes one value of any type (for fields we do not know).
+func (d *decoder) skip() error {
+	c, err := d.readByte()
+	if err != nil {
+		return err
+	}
+	var n int // payload bytes to drop
+	switch {
+	case c <= 0x7f, c >= 0xe0, c == 0xc0, c == 0xc2, c == 0xc3:
+		return nil // fixint, nil, bool
+	case c&0xf0 == 0x80: // fixmap
+		return d.skipN(2 * int(c&0x0f))
+	case c&0xf0 == 0x90: // fixarray
+		return d.skipN(int(c & 0x0f))
+	case c&0xe0 == 0xa0: // fixstr
+		n = int(c & 0x1f)
+	case c == 0xcc, c == 0xd0:
+		n = 1
+	case c == 0xcd, c == 0xd1:
+		n = 2
+	case c == 0xce, c == 0xd2, c == 0xca:
+		n = 4
+	case c == 0xcf, c == 0xd3, c == 0xcb:
+		n = 8
+	case c == 0xd4, c == 0xd5, c == 0xd6, c == 0xd7, c == 0xd8: // fixext
+		n = 1 + 1<<(c-0xd4)
+	case c == 0xc4, c == 0xd9:
+		n, err = d.length(1)
+	case c == 0xc5, c == 0xda:
+		n, err = d.length(2)
+	case c == 0xc6, c == 0xdb:
+		n, err = d.length(4)
+	case c == 0xc7, c == 0xc8, c == 0xc9: // ext 8/16/32
+		n, err = d.length(1 << (c - 0xc7))
+		n++ // type byte
+	case c == 0xdc, c == 0xdd: // array 16/32
+		if n, err = d.length(2 << (c - 0xdc)); err != nil {
+			return err
+		}
+		return d.skipN(n)
+	case c == 0xde, c == 0xdf: // map 16/32
+		if n, err = d.length(2 << (c - 0xde)); err != nil {
+			return err
+		}
+		return d.skipN(2 * n)
+	default:
+		return d.errorf("unknown type 0x%02x", c)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = d.take(n)
+	return err
+}
+
+// skipN skips n consecutive values.
+func (d *decoder) skipN(n int) error {
+	for range n {
+		if err := d.skip(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
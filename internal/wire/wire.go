@@ -0,0 +1,290 @@
+// Package wire is the binary encoding of values on the replication path.
+//
+// Replication moves store.Value back and forth all day: every write is
+// sent to N-1 replicas, every quorum read fetches R values. With JSON,
+// encoding/json's reflection and the base64 of compressed bytes dominate
+// CPU on replication-heavy workloads.
+//
+// So peers speak MessagePack (https://msgpack.org) when both sides can:
+//
+//	Content-Type: application/msgpack
+//
+// The encoder is hand-written for exactly our types — no reflection,
+// one allocation per message. Values are msgpack maps keyed by the same
+// names as the JSON fields, so the format is self-describing and unknown
+// keys are skipped: a newer node can add fields without breaking older
+// ones.
+//
+// JSON stays supported on every endpoint. Negotiation lives in the
+// cluster package (requests) and the api package (responses).
+package wire
+
+import (
+	"distributed-kvstore/internal/store"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ContentType is the media type of msgpack bodies.
+const ContentType = "application/msgpack"
+
+// ErrMalformed is returned for bodies that are not valid for our schema.
+var ErrMalformed = errors.New("malformed msgpack")
+
+// ─── store.Value ──────────────────────────────────────────────────────────────
+
+// AppendValue appends v in msgpack to b.
+func AppendValue(b []byte, v store.Value) []byte {
+	fields := 4 // data, clock, tombstone, updated_at
+	if v.Encoding != "" {
+		fields += 2 // encoding, compressed
+	}
+	if v.ContentType != "" {
+		fields++
+	}
+	if v.HLC != 0 {
+		fields++
+	}
+	if !v.ExpiresAt.IsZero() {
+		fields++
+	}
+	b = appendMapLen(b, fields)
+
+	b = appendStr(b, "data")
+	b = appendStr(b, v.Data)
+
+	b = appendStr(b, "clock")
+	b = appendMapLen(b, len(v.Clock))
+	for node, n := range v.Clock {
+		b = appendStr(b, node)
+		b = appendUint(b, n)
+	}
+
+	b = appendStr(b, "tombstone")
+	b = appendBool(b, v.Tombstone)
+
+	b = appendStr(b, "updated_at")
+	b = appendTime(b, v.UpdatedAt)
+
+	if v.HLC != 0 {
+		b = appendStr(b, "hlc")
+		b = appendUint(b, uint64(v.HLC))
+	}
+
+	if v.Encoding != "" {
+		b = appendStr(b, "encoding")
+		b = appendStr(b, v.Encoding)
+		b = appendStr(b, "compressed")
+		b = appendBin(b, v.Compressed)
+	}
+	if v.ContentType != "" {
+		b = appendStr(b, "content_type")
+		b = appendStr(b, v.ContentType)
+	}
+	if !v.ExpiresAt.IsZero() {
+		b = appendStr(b, "expires_at")
+		b = appendTime(b, v.ExpiresAt)
+	}
+	return b
+}
+
+// MarshalValue encodes v.
+func MarshalValue(v store.Value) []byte {
+	return AppendValue(make([]byte, 0, valueSizeHint(v)), v)
+}
+
+// UnmarshalValue decodes a value written by MarshalValue.
+func UnmarshalValue(data []byte) (store.Value, error) {
+	d := decoder{buf: data}
+	v, err := d.value()
+	if err == nil && d.pos != len(d.buf) {
+		err = fmt.Errorf("%w: %d trailing bytes", ErrMalformed, len(d.buf)-d.pos)
+	}
+	return v, err
+}
+
+// ─── Replicate request ────────────────────────────────────────────────────────
+
+// MarshalReplicate encodes the body of POST /internal/replicate.
+func MarshalReplicate(key string, v store.Value) []byte {
+	b := make([]byte, 0, len(key)+valueSizeHint(v)+16)
+	return appendReplicate(b, key, v)
+}
+
+// UnmarshalReplicate decodes a body written by MarshalReplicate.
+func UnmarshalReplicate(data []byte) (key string, v store.Value, err error) {
+	d := decoder{buf: data}
+	return d.replicate()
+}
+
+// Replicate is one write of a replicate batch.
+type Replicate struct {
+	Key   string
+	Value store.Value
+}
+
+// MarshalReplicateBatch encodes the body of POST /internal/replicate/batch:
+// {"writes": [replicate, ...]}, each element as MarshalReplicate writes it.
+func MarshalReplicateBatch(writes []Replicate) []byte {
+	size := 16
+	for _, w := range writes {
+		size += len(w.Key) + valueSizeHint(w.Value) + 16
+	}
+	b := make([]byte, 0, size)
+	b = appendMapLen(b, 1)
+	b = appendStr(b, "writes")
+	b = appendArrayLen(b, len(writes))
+	for _, w := range writes {
+		b = appendReplicate(b, w.Key, w.Value)
+	}
+	return b
+}
+
+// UnmarshalReplicateBatch decodes a body written by MarshalReplicateBatch.
+func UnmarshalReplicateBatch(data []byte) ([]Replicate, error) {
+	d := decoder{buf: data}
+	n, err := d.mapLen()
+	if err != nil {
+		return nil, err
+	}
+	var writes []Replicate
+	for range n {
+		field, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		if field != "writes" {
+			if err := d.skip(); err != nil {
+				return nil, fmt.Errorf("field %q: %w", field, err)
+			}
+			continue
+		}
+		count, err := d.arrayLen()
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", field, err)
+		}
+		writes = make([]Replicate, 0, min(count, len(data)))
+		for i := range count {
+			key, v, err := d.replicate()
+			if err != nil {
+				return nil, fmt.Errorf("write %d: %w", i, err)
+			}
+			writes = append(writes, Replicate{Key: key, Value: v})
+		}
+	}
+	return writes, nil
+}
+
+func appendReplicate(b []byte, key string, v store.Value) []byte {
+	b = appendMapLen(b, 2)
+	b = appendStr(b, "key")
+	b = appendStr(b, key)
+	b = appendStr(b, "value")
+	return AppendValue(b, v)
+}
+
+func (d *decoder) replicate() (key string, v store.Value, err error) {
+	n, err := d.mapLen()
+	if err != nil {
+		return "", store.Value{}, err
+	}
+	for range n {
+		field, err := d.str()
+		if err != nil {
+			return "", store.Value{}, err
+		}
+		switch field {
+		case "key":
+			key, err = d.str()
+		case "value":
+			v, err = d.value()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return "", store.Value{}, fmt.Errorf("field %q: %w", field, err)
+		}
+	}
+	return key, v, nil
+}
+
+// value decodes one store.Value map.
+func (d *decoder) value() (store.Value, error) {
+	var v store.Value
+	n, err := d.mapLen()
+	if err != nil {
+		return v, err
+	}
+	for range n {
+		field, err := d.str()
+		if err != nil {
+			return v, err
+		}
+		switch field {
+		case "data":
+			v.Data, err = d.str()
+		case "clock":
+			v.Clock, err = d.clock()
+		case "tombstone":
+			v.Tombstone, err = d.bool()
+		case "updated_at":
+			v.UpdatedAt, err = d.time()
+		case "hlc":
+			var h uint64
+			h, err = d.uint()
+			v.HLC = store.HLC(h)
+		case "encoding":
+			v.Encoding, err = d.str()
+		case "compressed":
+			v.Compressed, err = d.bin()
+		case "content_type":
+			v.ContentType, err = d.str()
+		case "expires_at":
+			v.ExpiresAt, err = d.time()
+		default:
+			err = d.skip()
+		}
+		if err != nil {
+			return v, fmt.Errorf("field %q: %w", field, err)
+		}
+	}
+	return v, nil
+}
+
+func (d *decoder) clock() (store.VectorClock, error) {
+	if d.nextIsNil() {
+		d.pos++
+		return nil, nil
+	}
+	n, err := d.mapLen()
+	if err != nil {
+		return nil, err
+	}
+	vc := make(store.VectorClock, n)
+	for range n {
+		node, err := d.str()
+		if err != nil {
+			return nil, err
+		}
+		if vc[node], err = d.uint(); err != nil {
+			return nil, err
+		}
+	}
+	return vc, nil
+}
+
+// valueSizeHint estimates the encoded size of v, to size buffers once.
+func valueSizeHint(v store.Value) int {
+	return 64 + len(v.Data) + len(v.Compressed) + len(v.ContentType) + 16*len(v.Clock)
+}
+
+// timeExt is the msgpack timestamp extension type.
+const timeExt = -1
+
+// appendTime uses the 96-bit timestamp form: nanoseconds + seconds.
+func appendTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xc7, 12, byte(timeExt&0xff))
+	b = appendBE32(b, uint32(t.Nanosecond()))
+	return appendBE64(b, uint64(t.Unix()))
+}
@@ -0,0 +1,481 @@
+// Package kv runs a key-value node inside a Go program.
+//
+// The server binary (cmd/server) is one way to run a node; Open is the
+// other. The node is the same — store, WAL, replication, quorum, the
+// HTTP API its peers and other clients talk to — but the program that
+// embeds it calls it directly:
+//
+//	node, err := kv.Open(kv.Config{
+//		ID:      "app1",
+//		DataDir: "/var/lib/app/kv",
+//		Addr:    ":8080",
+//		Peers:   map[string]string{"app2": "app2.internal:8080", "app3": "app3.internal:8080"},
+//	})
+//	if err != nil { ... }
+//	defer node.Close()
+//
+//	v, err := node.Put(ctx, "default", "user:42", `{"name":"alice"}`, "application/json")
+//	item, err := node.Get(ctx, "default", "user:42")
+//
+// A call for a key this node is a replica of runs the quorum write or
+// read right here, with no HTTP and no JSON on the way in or out; only
+// the replication to the other replicas crosses the network. A key
+// owned by other nodes only (N smaller than the cluster) is forwarded to
+// one of them over HTTP, as the server does for its clients.
+//
+// Everything else the HTTP API offers (transactions, locks, admin) is
+// reachable through Handler, which serves the full API in-process.
+package kv
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"distributed-kvstore/internal/api"
+	"distributed-kvstore/internal/cluster"
+	"distributed-kvstore/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Errors a node's calls can return, for errors.Is.
+var (
+	ErrNotFound          = errors.New("key not found")
+	ErrNamespaceNotFound = store.ErrNamespaceNotFound
+	ErrInvalidNamespace  = store.ErrInvalidNamespace
+	ErrKeyTooLong        = store.ErrKeyTooLong
+	ErrValueTooLarge     = store.ErrValueTooLarge
+	ErrQuotaExceeded     = store.ErrQuotaExceeded
+	ErrFenced            = cluster.ErrFenced // writes only; reads still work
+)
+
+// Config configures a node. ID and DataDir are required; the rest
+// default like the server's flags.
+type Config struct {
+	ID      string // unique node ID (--id)
+	DataDir string // the node keeps its files in DataDir/ID (--data-dir)
+
+	// Addr is where the node serves its peers and HTTP clients, e.g.
+	// ":8080" (--addr). Empty for a single node that only this program
+	// uses; a node with Peers needs it.
+	Addr string
+	// Advertise is the address peers dial (--advertise); empty = Addr.
+	Advertise string
+	// Peers are the other members: node ID → host:port (--peers).
+	Peers map[string]string
+
+	// Quorum (--n, --w, --r); 0 = 3, 2, 2. Capped at the number of nodes.
+	N, W, R int
+
+	// AuthFile is the server's --auth-file: its cluster token is required
+	// of peers, its tokens of HTTP clients. Calls on the Node itself are
+	// not authenticated.
+	AuthFile string
+	// TLSCert, TLSKey and TLSCA serve and dial peers over (mutual) TLS
+	// (--tls-cert, --tls-key, --tls-ca).
+	TLSCert, TLSKey, TLSCA string
+
+	// Tiebreak and DeleteConflicts settle concurrent writes (--tiebreak,
+	// --delete-conflicts); empty = "time", "tiebreak". Every node of a
+	// cluster must use the same.
+	Tiebreak, DeleteConflicts string
+
+	// WALSync and WALSyncInterval say when WAL writes are synced
+	// (--wal-sync, --wal-sync-interval); empty = "group".
+	WALSync         string
+	WALSyncInterval time.Duration
+}
+
+// Version is the version of a key a write created.
+type Version struct {
+	Clock map[string]uint64
+	ETag  string // for If-Match on the HTTP API
+}
+
+// Item is a key's current value.
+type Item struct {
+	Namespace   string
+	Key         string
+	Value       string
+	ContentType string
+	Clock       map[string]uint64
+	UpdatedAt   time.Time
+}
+
+// Event is a change seen by Watch.
+type Event struct {
+	Op          string // "put", "delete" or "evict"
+	Key         string // without the namespace
+	Value       string
+	ContentType string
+	Clock       map[string]uint64
+	UpdatedAt   time.Time
+	Node        string // the replica that applied it
+}
+
+// Node is a running node.
+type Node struct {
+	id      string
+	store   *store.Store
+	rep     *cluster.Replicator
+	handler *api.Handler
+	router  http.Handler
+	srv     *http.Server // nil without Addr
+	stop    context.CancelFunc
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Open starts a node: it replays the node's WAL, joins the members in
+// cfg.Peers and, with cfg.Addr, starts serving them. Close stops it.
+func Open(cfg Config) (*Node, error) {
+	if cfg.ID == "" || cfg.DataDir == "" {
+		return nil, fmt.Errorf("kv: ID and DataDir are required")
+	}
+	if len(cfg.Peers) > 0 && cfg.Addr == "" {
+		return nil, fmt.Errorf("kv: a node with peers needs an Addr to serve them on")
+	}
+	cfg.N, cfg.W, cfg.R = cmp.Or(cfg.N, 3), cmp.Or(cfg.W, 2), cmp.Or(cfg.R, 2)
+	dir := filepath.Join(cfg.DataDir, cfg.ID)
+
+	s, err := store.New(dir, cfg.ID)
+	if err != nil {
+		return nil, fmt.Errorf("kv: open store: %w", err)
+	}
+	n, err := start(cfg, dir, s)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// start sets up replication and the HTTP API around s, as the server's
+// main does.
+func start(cfg Config, dir string, s *store.Store) (*Node, error) {
+	if err := s.SetTiebreak(cfg.Tiebreak); err != nil {
+		return nil, fmt.Errorf("kv: %w", err)
+	}
+	if err := s.SetDeleteConflicts(cfg.DeleteConflicts); err != nil {
+		return nil, fmt.Errorf("kv: %w", err)
+	}
+	if err := s.SetWALSync(cfg.WALSync, cmp.Or(cfg.WALSyncInterval, store.DefaultWALSyncInterval)); err != nil {
+		return nil, fmt.Errorf("kv: %w", err)
+	}
+	self := cluster.Node{ID: cfg.ID, Address: cmp.Or(cfg.Advertise, cfg.Addr)}
+	nodes := []cluster.Node{self}
+	for id, addr := range cfg.Peers {
+		nodes = append(nodes, cluster.Node{ID: id, Address: addr})
+	}
+	membership := cluster.NewMembership(nodes, 150)
+	rep := cluster.NewReplicator(cfg.ID, membership, s, cfg.N, cfg.W, cfg.R)
+
+	var authCfg *api.AuthConfig
+	if cfg.AuthFile != "" {
+		var err error
+		if authCfg, err = api.LoadAuthConfig(cfg.AuthFile); err != nil {
+			return nil, fmt.Errorf("kv: load auth file: %w", err)
+		}
+		rep.SetClusterToken(authCfg.ClusterToken)
+		if err := rep.SetPeerAuth(authCfg.PeerAuth); err != nil {
+			return nil, fmt.Errorf("kv: %w", err)
+		}
+	}
+	var tlsCfg *tls.Config
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		var err error
+		if tlsCfg, _, err = cluster.LoadTLSConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSCA); err != nil {
+			return nil, fmt.Errorf("kv: load tls config: %w", err)
+		}
+		rep.SetTLS(tlsCfg)
+	}
+
+	size := membership.Ring().NodeCount()
+	quorum := cluster.QuorumConfig{N: min(cfg.N, size), W: min(cfg.W, size), R: min(cfg.R, size)}
+	if err := rep.InitQuorum(filepath.Join(dir, "quorum.json"), quorum); err != nil {
+		return nil, fmt.Errorf("kv: load quorum: %w", err)
+	}
+	if err := rep.InitACLs(filepath.Join(dir, "acl.json")); err != nil {
+		return nil, fmt.Errorf("kv: load ACLs: %w", err)
+	}
+	if _, err := rep.OpenOutbox(filepath.Join(dir, "outbox.log")); err != nil {
+		return nil, fmt.Errorf("kv: open outbox: %w", err)
+	}
+	if _, err := rep.OpenTxnLog(filepath.Join(dir, "txn.log")); err != nil {
+		rep.CloseOutbox()
+		return nil, fmt.Errorf("kv: open transaction log: %w", err)
+	}
+	rep.SetSnapshotDir(filepath.Join(dir, "cluster-snapshots"))
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.Use(api.RequestID(), api.Logger(), api.Recovery(), api.Auth(api.NewAuthenticator(authCfg)),
+		api.Compression(0), api.BodyLimit(api.DefaultMaxBodySize), api.ValidateRequests())
+	if tlsCfg != nil && cfg.TLSCA != "" {
+		router.Use(api.RequirePeerCert())
+	}
+	handler := api.NewHandler(s, rep, membership, cfg.ID)
+	handler.Register(router)
+
+	n := &Node{id: cfg.ID, store: s, rep: rep, handler: handler, router: router}
+	if cfg.Addr != "" {
+		ln, err := net.Listen("tcp", cfg.Addr)
+		if err != nil {
+			rep.CloseTxnLog()
+			rep.CloseOutbox()
+			return nil, fmt.Errorf("kv: listen: %w", err)
+		}
+		n.srv = &http.Server{
+			Handler:      router,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+			TLSConfig:    tlsCfg,
+			Protocols:    cluster.ServerProtocols(),
+		}
+		n.srv.RegisterOnShutdown(handler.StopWatches)
+		go func() {
+			if tlsCfg != nil {
+				n.srv.ServeTLS(ln, "", "")
+			} else {
+				n.srv.Serve(ln)
+			}
+		}()
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	n.stop = stop
+	go s.RunSnapshots(ctx, store.DefaultSnapshotPolicy)
+	go rep.RunHintedHandoff(ctx, 10*time.Second)
+	go rep.RunOutbox(ctx, time.Second)
+	go rep.RunTxnRecovery(ctx, 10*time.Second)
+	go rep.RunReadiness(ctx)
+	go rep.RunReadCache(ctx)
+	go rep.RunACLSync(ctx)
+	go rep.RunExpiry(ctx)
+	return n, nil
+}
+
+// Close stops serving, takes a final snapshot and closes the node's
+// files. In-flight HTTP requests get up to 15s to finish.
+func (n *Node) Close() error {
+	n.closeOnce.Do(func() {
+		n.stop()
+		if _, err := n.store.SnapshotDelta(store.DefaultSnapshotPolicy.MaxDeltas); err != nil {
+			n.closeErr = fmt.Errorf("kv: final snapshot: %w", err)
+		}
+		if n.srv != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			n.srv.Shutdown(ctx)
+			cancel()
+		} else {
+			n.handler.StopWatches()
+		}
+		n.rep.CloseTxnLog()
+		n.rep.CloseOutbox()
+		n.closeErr = errors.Join(n.closeErr, n.store.Close())
+	})
+	return n.closeErr
+}
+
+// Handler serves the node's whole HTTP API, for a program that mounts it
+// on a server of its own (with Addr empty) or tests against it.
+func (n *Node) Handler() http.Handler { return n.router }
+
+// ID returns the node's ID.
+func (n *Node) ID() string { return n.id }
+
+// ─── KV calls ─────────────────────────────────────────────────────────────────
+
+// Put writes value to key in namespace and waits for the write quorum.
+// contentType is the value's media type, e.g. "application/json"; ""
+// for none.
+func (n *Node) Put(ctx context.Context, namespace, key, value, contentType string) (Version, error) {
+	k, err := n.checkKey(namespace, key)
+	if err != nil {
+		return Version{}, err
+	}
+	if contentType != "" {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return Version{}, fmt.Errorf("kv: content type %q: %w", contentType, err)
+		}
+	}
+	if err := n.store.Limits().CheckValue(value); err != nil {
+		return Version{}, err
+	}
+	if _, fenced := n.rep.Fenced(); fenced {
+		return Version{}, ErrFenced
+	}
+	if !n.rep.Coordinates(k) {
+		var out struct {
+			Clock map[string]uint64 `json:"clock"`
+		}
+		body, _ := json.Marshal(map[string]string{"value": value, "content_type": contentType})
+		hdr, err := n.forward(ctx, http.MethodPut, k, body, &out)
+		return Version{Clock: out.Clock, ETag: hdr.Get("ETag")}, err
+	}
+	n.rep.TouchKey(k, true)
+	val, err := n.rep.ReplicateWrite(ctx, k, value, contentType, nil)
+	if err != nil {
+		return Version{}, err
+	}
+	return Version{Clock: val.Clock, ETag: `"` + store.FormatClock(val.Clock) + `"`}, nil
+}
+
+// Get reads key in namespace with the read quorum. It returns
+// ErrNotFound if the key does not exist or was deleted.
+func (n *Node) Get(ctx context.Context, namespace, key string) (*Item, error) {
+	k, err := n.checkKey(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	if !n.rep.Coordinates(k) {
+		var out struct {
+			Value       string            `json:"value"`
+			ContentType string            `json:"content_type"`
+			Clock       map[string]uint64 `json:"clock"`
+			UpdatedAt   time.Time         `json:"updated_at"`
+		}
+		if _, err := n.forward(ctx, http.MethodGet, k, nil, &out); err != nil {
+			return nil, err
+		}
+		return &Item{Namespace: namespace, Key: key, Value: out.Value, ContentType: out.ContentType, Clock: out.Clock, UpdatedAt: out.UpdatedAt}, nil
+	}
+	n.rep.TouchKey(k, false)
+	val, err := n.rep.CachedRead(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return nil, ErrNotFound
+	}
+	decoded, err := val.Decode()
+	if err != nil {
+		return nil, err
+	}
+	return &Item{
+		Namespace: namespace, Key: key, Value: decoded.Data, ContentType: decoded.ContentType,
+		Clock: decoded.Clock, UpdatedAt: decoded.UpdatedAt,
+	}, nil
+}
+
+// Delete deletes key in namespace (a tombstone, replicated like a
+// write) and waits for the write quorum.
+func (n *Node) Delete(ctx context.Context, namespace, key string) error {
+	k, err := n.checkKey(namespace, key)
+	if err != nil {
+		return err
+	}
+	if _, fenced := n.rep.Fenced(); fenced {
+		return ErrFenced
+	}
+	if !n.rep.Coordinates(k) {
+		_, err := n.forward(ctx, http.MethodDelete, k, nil, nil)
+		return err
+	}
+	n.rep.TouchKey(k, true)
+	return n.rep.DeleteReplicated(ctx, k)
+}
+
+// Keys returns up to limit live keys of namespace starting with prefix,
+// in sorted order, after the key after (empty = from the start), across
+// the cluster. more reports whether there are more: call again with the
+// last key returned.
+func (n *Node) Keys(ctx context.Context, namespace, prefix, after string, limit int) (keys []string, more bool, err error) {
+	if _, ok := n.store.GetNamespace(namespace); !ok {
+		return nil, false, ErrNamespaceNotFound
+	}
+	if limit < 1 {
+		return nil, false, fmt.Errorf("kv: limit must be at least 1")
+	}
+	keys, more = n.rep.ListKeysPage(ctx, namespace, prefix, after, limit, store.Filter{})
+	return keys, more, nil
+}
+
+// Watch calls fn with each change to the keys of namespace starting
+// with prefix, as it happens, until ctx is done or fn returns an error.
+func (n *Node) Watch(ctx context.Context, namespace, prefix string, fn func(Event) error) error {
+	if _, ok := n.store.GetNamespace(namespace); !ok {
+		return ErrNamespaceNotFound
+	}
+	return n.rep.Watch(ctx, namespace, prefix, false, func(ev cluster.WatchEvent) error {
+		return fn(Event{
+			Op: ev.Op, Key: ev.Key, Value: ev.Value, ContentType: ev.ContentType,
+			Clock: ev.Clock, UpdatedAt: ev.UpdatedAt, Node: ev.Node,
+		})
+	})
+}
+
+// CreateNamespace creates namespace with default settings on every node
+// (PUT /namespaces/:namespace). It is not an error if it exists.
+func (n *Node) CreateNamespace(ctx context.Context, namespace string) error {
+	ns, err := n.store.PutNamespace(store.Namespace{Name: namespace})
+	if err != nil {
+		return err
+	}
+	return n.rep.Broadcast(ctx, http.MethodPut, "/internal/namespaces/"+ns.Name, ns)
+}
+
+// checkKey validates namespace and key and returns the store key.
+func (n *Node) checkKey(namespace, key string) (string, error) {
+	if !store.ValidNamespace(namespace) {
+		return "", ErrInvalidNamespace
+	}
+	if err := n.store.Limits().CheckKey(key); err != nil {
+		return "", err
+	}
+	return store.NamespacedKey(namespace, key), nil
+}
+
+// forward sends a call for a key this node does not own to an owner
+// over HTTP, and decodes its 2xx answer into out (nil = ignore it).
+func (n *Node) forward(ctx context.Context, method, key string, body []byte, out any) (http.Header, error) {
+	ns, k := store.SplitKey(key)
+	path := "/kv/" + url.PathEscape(ns) + "/" + url.PathEscape(k)
+	req, err := http.NewRequestWithContext(ctx, method, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := n.rep.Forward(ctx, key, req, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(data, &e)
+		switch {
+		case resp.StatusCode == http.StatusNotFound && e.Error == ErrNotFound.Error():
+			return nil, ErrNotFound
+		case e.Error == ErrNamespaceNotFound.Error():
+			return nil, ErrNamespaceNotFound
+		}
+		return nil, fmt.Errorf("kv: owner answered %s: %s", resp.Status, e.Error)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return nil, err
+		}
+	}
+	return resp.Header, nil
+}
@@ -0,0 +1,5 @@
+// Package kvv1 is the Go code generated from kv.proto: the messages of
+// the gRPC API and its KV client and server.
+package kvv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative kv/v1/kv.proto